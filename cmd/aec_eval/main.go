@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
+)
+
+// 离线评估回声消除：读取麦克风录音与同步的参考（播放）音频，输出消除后的音频并打印统计
+func main() {
+	micPath := flag.String("mic", "mic.wav", "麦克风录音（单声道 WAV）")
+	refPath := flag.String("ref", "ref.wav", "参考信号，即设备播放的音频（单声道 WAV，与麦克风录音同一起点）")
+	outPath := flag.String("out", "out.wav", "消除回声后的输出")
+	frameMs := flag.Int("frame", 20, "帧长（毫秒）")
+	flag.Parse()
+
+	mic, sampleRate, err := aec.ReadWavFile(*micPath)
+	if err != nil {
+		fmt.Printf("读取麦克风录音失败: %v\n", err)
+		os.Exit(1)
+	}
+	ref, refRate, err := aec.ReadWavFile(*refPath)
+	if err != nil {
+		fmt.Printf("读取参考信号失败: %v\n", err)
+		os.Exit(1)
+	}
+	if refRate != sampleRate {
+		fmt.Printf("参考信号采样率 %d 与麦克风 %d 不一致\n", refRate, sampleRate)
+		os.Exit(1)
+	}
+
+	c := aec.New(aec.Config{SampleRate: sampleRate})
+	// 参考信号一次性写入，相当于服务端已提前下发
+	c.PushReferenceAt(0, ref)
+
+	frame := sampleRate * *frameMs / 1000
+	out := make([]float32, 0, len(mic))
+	var frames, playback, nearEnd int
+	var in, residual float64
+	var last aec.Result
+	for pos := 0; pos+frame <= len(mic); pos += frame {
+		last = c.ProcessAt(int64(pos), mic[pos:pos+frame])
+		out = append(out, last.Output...)
+		frames++
+		if last.PlaybackActive {
+			playback++
+			if last.NearEnd {
+				nearEnd++
+			}
+			in += energy(mic[pos : pos+frame])
+			residual += energy(last.Output)
+		}
+	}
+	if err := aec.WriteWavFile(*outPath, out, sampleRate); err != nil {
+		fmt.Printf("写入输出失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("采样率: %d Hz, 帧数: %d, 播放期间帧数: %d, 其中判定近端语音: %d\n", sampleRate, frames, playback, nearEnd)
+	fmt.Printf("回声延迟: %d ms, 滤波器收敛: %v, ERLE: %.1f dB\n", last.DelayMs, last.Converged, last.ERLE)
+	if residual > 0 {
+		fmt.Printf("播放期间能量衰减（含近端语音）: %.1f dB\n", 10*math.Log10(in/residual))
+	}
+}
+
+func energy(data []float32) float64 {
+	var sum float64
+	for _, v := range data {
+		sum += float64(v) * float64(v)
+	}
+	return sum
+}
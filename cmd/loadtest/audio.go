@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/hraban/opus.v2"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
+)
+
+const (
+	sampleRate = 16000
+	channels   = 1
+)
+
+// audioFrame 一个 Opus 包及其时长，发送时按时长控制节奏模拟实时采集
+type audioFrame struct {
+	Data     []byte
+	Duration time.Duration
+}
+
+// utterance 一句预先编码好的语音
+type utterance struct {
+	Name   string
+	Frames []audioFrame
+}
+
+func (u utterance) duration() time.Duration {
+	var d time.Duration
+	for _, f := range u.Frames {
+		d += f.Duration
+	}
+	return d
+}
+
+// loadUtterances 加载语音素材：支持 16kHz 单声道 WAV（启动时编码为 Opus）和 Ogg Opus 文件，
+// 目录按文件名顺序加载其中的 .wav/.ogg/.opus；未指定时使用内置的合成语音，不依赖任何文件和网络
+func loadUtterances(paths []string, frameMs int) ([]utterance, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".wav", ".ogg", ".opus":
+				names = append(names, filepath.Join(p, e.Name()))
+			}
+		}
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+
+	if len(files) == 0 {
+		if len(paths) > 0 {
+			return nil, fmt.Errorf("未找到语音文件: %s", strings.Join(paths, ","))
+		}
+		u, err := syntheticUtterance(frameMs)
+		if err != nil {
+			return nil, err
+		}
+		return []utterance{u}, nil
+	}
+
+	utterances := make([]utterance, 0, len(files))
+	for _, file := range files {
+		var (
+			u   utterance
+			err error
+		)
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".wav":
+			u, err = loadWav(file, frameMs)
+		case ".ogg", ".opus":
+			u, err = loadOggOpus(file)
+		default:
+			err = fmt.Errorf("不支持的语音文件格式")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("加载语音文件 %s 失败: %w", file, err)
+		}
+		if len(u.Frames) == 0 {
+			return nil, fmt.Errorf("语音文件 %s 中没有音频", file)
+		}
+		utterances = append(utterances, u)
+	}
+	return utterances, nil
+}
+
+func loadWav(path string, frameMs int) (utterance, error) {
+	pcm, rate, err := aec.ReadWavFile(path)
+	if err != nil {
+		return utterance{}, err
+	}
+	if rate != sampleRate {
+		return utterance{}, fmt.Errorf("只支持 %d Hz 采样率，实际 %d Hz", sampleRate, rate)
+	}
+	frames, err := encodePCM(pcm, frameMs)
+	if err != nil {
+		return utterance{}, err
+	}
+	return utterance{Name: filepath.Base(path), Frames: frames}, nil
+}
+
+// encodePCM 按帧长把 PCM 编码为 Opus，末尾不足一帧的部分补静音
+func encodePCM(pcm []float32, frameMs int) ([]audioFrame, error) {
+	enc, err := opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %w", err)
+	}
+	frameSize := sampleRate * frameMs / 1000
+	buf := make([]byte, 1500)
+	frames := make([]audioFrame, 0, len(pcm)/frameSize+1)
+	for pos := 0; pos < len(pcm); pos += frameSize {
+		frame := make([]float32, frameSize)
+		copy(frame, pcm[pos:])
+		n, err := enc.EncodeFloat32(frame, buf)
+		if err != nil {
+			return nil, fmt.Errorf("Opus编码失败: %w", err)
+		}
+		frames = append(frames, audioFrame{
+			Data:     append([]byte(nil), buf[:n]...),
+			Duration: time.Duration(frameMs) * time.Millisecond,
+		})
+	}
+	return frames, nil
+}
+
+// syntheticUtterance 生成约 1.5 秒带音节起伏的谐波音，能触发服务端 VAD，用于无素材时压测
+func syntheticUtterance(frameMs int) (utterance, error) {
+	const seconds = 1.5
+	pcm := make([]float32, int(sampleRate*seconds))
+	for i := range pcm {
+		t := float64(i) / sampleRate
+		// 4Hz 音节包络 + 基频与两个谐波
+		envelope := 0.5 - 0.5*math.Cos(2*math.Pi*4*t)
+		v := math.Sin(2*math.Pi*180*t) + 0.5*math.Sin(2*math.Pi*360*t) + 0.25*math.Sin(2*math.Pi*720*t)
+		pcm[i] = float32(0.3 * envelope * v)
+	}
+	frames, err := encodePCM(pcm, frameMs)
+	if err != nil {
+		return utterance{}, err
+	}
+	return utterance{Name: "synthetic", Frames: frames}, nil
+}
+
+// silenceFrame 一帧静音，auto 模式下在语音结束后持续发送，让服务端 VAD 判断说话结束
+func silenceFrame(frameMs int) (audioFrame, error) {
+	frames, err := encodePCM(make([]float32, sampleRate*frameMs/1000), frameMs)
+	if err != nil {
+		return audioFrame{}, err
+	}
+	return frames[0], nil
+}
+
+// loadOggOpus 从 Ogg 容器中取出 Opus 包，跳过 OpusHead/OpusTags 头
+func loadOggOpus(path string) (utterance, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return utterance{}, err
+	}
+	packets, err := oggPackets(data)
+	if err != nil {
+		return utterance{}, err
+	}
+	u := utterance{Name: filepath.Base(path)}
+	for _, pkt := range packets {
+		if bytes.HasPrefix(pkt, []byte("OpusHead")) || bytes.HasPrefix(pkt, []byte("OpusTags")) {
+			continue
+		}
+		d, err := opusPacketDuration(pkt)
+		if err != nil {
+			return utterance{}, err
+		}
+		u.Frames = append(u.Frames, audioFrame{Data: pkt, Duration: d})
+	}
+	return u, nil
+}
+
+// oggPackets 按页头的分段表把 Ogg 页拼回完整的包，只支持单个逻辑流
+func oggPackets(data []byte) ([][]byte, error) {
+	var (
+		packets [][]byte
+		current []byte
+	)
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || string(data[pos:pos+4]) != "OggS" {
+			return nil, fmt.Errorf("无效的 Ogg 页，偏移 %d", pos)
+		}
+		segments := int(data[pos+26])
+		if len(data)-pos < 27+segments {
+			return nil, fmt.Errorf("Ogg 页头不完整，偏移 %d", pos)
+		}
+		lacing := data[pos+27 : pos+27+segments]
+		body := pos + 27 + segments
+		for _, l := range lacing {
+			size := int(l)
+			if body+size > len(data) {
+				return nil, fmt.Errorf("Ogg 页数据不完整，偏移 %d", pos)
+			}
+			current = append(current, data[body:body+size]...)
+			body += size
+			// 分段长度小于 255 表示包结束，等于 255 的包延续到下一段
+			if size < 255 {
+				packets = append(packets, current)
+				current = nil
+			}
+		}
+		pos = body
+	}
+	return packets, nil
+}
+
+// opusPacketDuration 根据 TOC 字节计算 Opus 包的时长（RFC 6716 3.1）
+func opusPacketDuration(pkt []byte) (time.Duration, error) {
+	if len(pkt) == 0 {
+		return 0, fmt.Errorf("空的 Opus 包")
+	}
+	config := pkt[0] >> 3
+	var frame time.Duration
+	switch {
+	case config < 12:
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+	count := 1
+	switch pkt[0] & 0x3 {
+	case 1, 2:
+		count = 2
+	case 3:
+		if len(pkt) < 2 {
+			return 0, fmt.Errorf("Opus 包缺少帧数字段")
+		}
+		count = int(pkt[1] & 0x3f)
+	}
+	return frame * time.Duration(count), nil
+}
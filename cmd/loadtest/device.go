@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	transportWebsocket = "websocket"
+	transportMqttUdp   = "mqtt_udp"
+)
+
+// event 服务端下发的一条控制消息或一帧音频；Err 非空表示连接已断开
+type event struct {
+	At    time.Time
+	Audio bool
+	Type  string
+	State string
+	Raw   []byte
+	Err   error
+}
+
+// serverMessage 压测关心的服务端消息字段
+type serverMessage struct {
+	Type      string `json:"type"`
+	State     string `json:"state,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+func textEvent(data []byte) event {
+	ev := event{At: time.Now(), Raw: data}
+	var msg serverMessage
+	if err := json.Unmarshal(data, &msg); err == nil {
+		ev.Type, ev.State = msg.Type, msg.State
+	}
+	return ev
+}
+
+// clientMessage 设备上行的控制消息
+type clientMessage struct {
+	Type        string       `json:"type"`
+	SessionID   string       `json:"session_id,omitempty"`
+	State       string       `json:"state,omitempty"`
+	Mode        string       `json:"mode,omitempty"`
+	Version     int          `json:"version,omitempty"`
+	Transport   string       `json:"transport,omitempty"`
+	AudioParams *audioParams `json:"audio_params,omitempty"`
+}
+
+type audioParams struct {
+	Format        string `json:"format"`
+	SampleRate    int    `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	FrameDuration int    `json:"frame_duration"`
+}
+
+// deviceConn 一种传输方式下的设备连接
+type deviceConn interface {
+	// Hello 完成 hello 握手
+	Hello(ctx context.Context) error
+	SendJSON(msg clientMessage) error
+	SendAudio(frame []byte) error
+	// Events 服务端消息和音频帧，连接断开时收到 Err 非空的事件后关闭
+	Events() <-chan event
+	Close() error
+}
+
+// identity 模拟设备的身份，按序号生成，多次压测使用同一批设备
+type identity struct {
+	MAC      string
+	ClientID string
+}
+
+func newIdentity(prefix string, index int) identity {
+	mac := fmt.Sprintf("%s:%02x:%02x:%02x", prefix, byte(index>>16), byte(index>>8), byte(index))
+	return identity{
+		MAC:      mac,
+		ClientID: uuid.NewSHA1(uuid.NameSpaceOID, []byte(mac)).String(),
+	}
+}
+
+func dial(ctx context.Context, transport string, cfg *config, id identity) (deviceConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	switch transport {
+	case transportWebsocket:
+		return dialWebsocket(ctx, cfg, id)
+	case transportMqttUdp:
+		return dialMqttUdp(ctx, cfg, id)
+	default:
+		return nil, fmt.Errorf("不支持的传输方式: %s", transport)
+	}
+}
+
+// waitHello 等待服务端的 hello 回复
+func waitHello(ctx context.Context, events <-chan event, timeout time.Duration) (event, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return event{}, ctx.Err()
+		case <-timer.C:
+			return event{}, fmt.Errorf("等待 hello 回复超时")
+		case ev, ok := <-events:
+			if !ok {
+				return event{}, errConnClosed
+			}
+			if ev.Err != nil {
+				return event{}, ev.Err
+			}
+			if ev.Type == "hello" {
+				return ev, nil
+			}
+		}
+	}
+}
+
+var errConnClosed = errors.New("连接已关闭")
+
+// 失败原因，按类别统计错误率
+const (
+	errConnect      = "connect"
+	errHello        = "hello"
+	errSend         = "send"
+	errTimeout      = "timeout"
+	errDisconnected = "disconnected"
+	errNoAudio      = "no_audio"
+)
+
+type turnError struct {
+	kind string
+	err  error
+}
+
+func (e *turnError) Error() string {
+	return fmt.Sprintf("%s: %v", e.kind, e.err)
+}
+
+// turnResult 一轮对话的时间点，延迟都以说话结束（manual 模式下为发送 listen stop）为起点
+type turnResult struct {
+	stopAt       time.Time
+	sttAt        time.Time
+	firstAudioAt time.Time
+	doneAt       time.Time
+}
+
+// device 一个模拟设备：连接、握手，然后按语音素材循环对话
+type device struct {
+	index     int
+	transport string
+	id        identity
+	cfg       *config
+	stats     *collector
+	conn      deviceConn
+}
+
+func (d *device) run(ctx context.Context) {
+	d.stats.deviceStarted(d.transport)
+	connected := false
+	failed := false
+	defer func() { d.stats.deviceFinished(d.transport, connected, failed) }()
+
+	start := time.Now()
+	conn, err := dial(ctx, d.transport, d.cfg, d.id)
+	if err != nil {
+		if ctx.Err() == nil {
+			failed = true
+			d.stats.recordError(d.transport, errConnect, fmt.Errorf("设备 %s: %w", d.id.MAC, err))
+		}
+		return
+	}
+	d.conn = conn
+	defer conn.Close()
+	d.stats.observe(d.transport, metricConnect, time.Since(start))
+
+	start = time.Now()
+	if err := conn.Hello(ctx); err != nil {
+		if ctx.Err() == nil {
+			failed = true
+			d.stats.recordError(d.transport, errHello, fmt.Errorf("设备 %s: %w", d.id.MAC, err))
+		}
+		return
+	}
+	d.stats.observe(d.transport, metricHello, time.Since(start))
+	connected = true
+
+	for turn := 0; d.cfg.Turns == 0 || turn < d.cfg.Turns; turn++ {
+		u := d.cfg.Utterances[(d.index+turn)%len(d.cfg.Utterances)]
+		result, err := d.turn(ctx, u)
+		if ctx.Err() != nil {
+			// 压测结束时进行中的一轮不计入结果
+			return
+		}
+		if err != nil {
+			var te *turnError
+			errors.As(err, &te)
+			d.stats.turnFailed(d.transport, te.kind, fmt.Errorf("设备 %s 第 %d 轮: %w", d.id.MAC, turn+1, te.err))
+			if te.kind != errTimeout {
+				failed = true
+				return
+			}
+			// 超时后打断本轮继续下一轮
+			if err := conn.SendJSON(clientMessage{Type: "abort"}); err != nil {
+				failed = true
+				return
+			}
+		} else {
+			d.stats.turnSucceeded(d.transport, result)
+		}
+		if err := d.pause(ctx, d.cfg.Think); err != nil {
+			if ctx.Err() == nil {
+				failed = true
+				d.stats.recordError(d.transport, errDisconnected, fmt.Errorf("设备 %s: %w", d.id.MAC, err))
+			}
+			return
+		}
+	}
+}
+
+// turn 发送一句语音并等待服务端播放完回复
+func (d *device) turn(ctx context.Context, u utterance) (turnResult, error) {
+	var r turnResult
+	if err := d.conn.SendJSON(clientMessage{Type: "listen", State: "start", Mode: d.cfg.Mode}); err != nil {
+		return r, &turnError{errSend, err}
+	}
+
+	events := d.conn.Events()
+	// 按帧时长发送，模拟设备实时采集
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for i := 0; i < len(u.Frames); {
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case ev, ok := <-events:
+			if done, err := d.handle(&r, ev, ok); done || err != nil {
+				return r, err
+			}
+		case <-timer.C:
+			if err := d.conn.SendAudio(u.Frames[i].Data); err != nil {
+				return r, &turnError{errSend, err}
+			}
+			next = next.Add(u.Frames[i].Duration)
+			timer.Reset(time.Until(next))
+			i++
+		}
+	}
+
+	r.stopAt = time.Now()
+	// auto 模式下由服务端 VAD 判断说话结束，继续发送静音直到服务端开始回复
+	var silence <-chan time.Time
+	if d.cfg.Mode == "auto" {
+		ticker := time.NewTicker(d.cfg.Silence.Duration)
+		defer ticker.Stop()
+		silence = ticker.C
+	} else if err := d.conn.SendJSON(clientMessage{Type: "listen", State: "stop", Mode: d.cfg.Mode}); err != nil {
+		return r, &turnError{errSend, err}
+	}
+
+	deadline := time.NewTimer(d.cfg.TurnTimeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-deadline.C:
+			return r, &turnError{errTimeout, fmt.Errorf("%s 内未收到完整回复", d.cfg.TurnTimeout)}
+		case <-silence:
+			if !r.sttAt.IsZero() || !r.firstAudioAt.IsZero() {
+				silence = nil
+				continue
+			}
+			if err := d.conn.SendAudio(d.cfg.Silence.Data); err != nil {
+				return r, &turnError{errSend, err}
+			}
+		case ev, ok := <-events:
+			if done, err := d.handle(&r, ev, ok); done || err != nil {
+				return r, err
+			}
+		}
+	}
+}
+
+// handle 处理一轮对话中收到的事件，返回本轮是否结束
+func (d *device) handle(r *turnResult, ev event, ok bool) (bool, error) {
+	if !ok {
+		return true, &turnError{errDisconnected, errConnClosed}
+	}
+	if ev.Err != nil {
+		return true, &turnError{errDisconnected, ev.Err}
+	}
+	// 说话结束前到达的音频是上一轮回复的尾包，不计入本轮
+	if r.stopAt.IsZero() {
+		return false, nil
+	}
+	switch {
+	case ev.Audio:
+		if r.firstAudioAt.IsZero() {
+			r.firstAudioAt = ev.At
+		}
+	case ev.Type == "stt":
+		if r.sttAt.IsZero() {
+			r.sttAt = ev.At
+		}
+	case ev.Type == "tts" && ev.State == "stop":
+		r.doneAt = ev.At
+		if r.firstAudioAt.IsZero() {
+			return true, &turnError{errNoAudio, fmt.Errorf("回复结束但没有收到音频")}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// pause 两轮对话之间的停顿，期间丢弃收到的消息但检查连接状态
+func (d *device) pause(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case ev, ok := <-d.conn.Events():
+			if !ok {
+				return errConnClosed
+			}
+			if ev.Err != nil {
+				return ev.Err
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/mqtt_udp"
+)
+
+// fakeServer 模拟服务端的 WebSocket 协议：hello 握手，listen stop 后回复 stt、tts 和几帧音频
+type fakeServer struct {
+	silent      bool // 不回复对话，用于测试超时
+	audioFrames atomic.Int64
+	aborts      atomic.Int64
+}
+
+func (f *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Device-Id") == "" {
+		http.Error(w, "缺少 Device-Id 请求头", http.StatusBadRequest)
+		return
+	}
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var writeMu sync.Mutex
+	send := func(messageType int, data []byte) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.WriteMessage(messageType, data)
+	}
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			f.audioFrames.Add(1)
+			continue
+		}
+		var msg clientMessage
+		json.Unmarshal(data, &msg)
+		switch {
+		case msg.Type == "hello":
+			send(websocket.TextMessage, []byte(`{"type":"hello","transport":"websocket","session_id":"s1"}`))
+		case msg.Type == "abort":
+			f.aborts.Add(1)
+		case msg.Type == "listen" && msg.State == "stop" && !f.silent:
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				send(websocket.TextMessage, []byte(`{"type":"stt","text":"你好"}`))
+				send(websocket.TextMessage, []byte(`{"type":"tts","state":"start"}`))
+				for i := 0; i < 3; i++ {
+					send(websocket.BinaryMessage, []byte{0xf8, 0xff, 0xfe})
+				}
+				send(websocket.TextMessage, []byte(`{"type":"tts","state":"stop"}`))
+			}()
+		}
+	}
+}
+
+// testFrames 构造 n 个 20ms 的 Opus 包（TOC config=1 即 SILK 20ms），测试不依赖 libopus
+func testFrames(n, size int) []audioFrame {
+	frames := make([]audioFrame, n)
+	for i := range frames {
+		data := bytes.Repeat([]byte{byte(i)}, size)
+		data[0] = 1 << 3
+		frames[i] = audioFrame{Data: data, Duration: 20 * time.Millisecond}
+	}
+	return frames
+}
+
+func testConfig(server string) *config {
+	return &config{
+		Server:         server,
+		Transports:     []string{transportWebsocket},
+		Stages:         []stage{{Duration: 0, Target: 3}},
+		Turns:          2,
+		Mode:           "manual",
+		FrameMs:        20,
+		TurnTimeout:    2 * time.Second,
+		ConnectTimeout: 2 * time.Second,
+		Think:          10 * time.Millisecond,
+		MacPrefix:      "02:4c:54",
+		Utterances:     []utterance{{Name: "test", Frames: testFrames(10, 40)}},
+		Silence:        testFrames(1, 3)[0],
+		HTTPClient:     http.DefaultClient,
+	}
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/xiaozhi/v1/"
+}
+
+func TestRunCompletesTurns(t *testing.T) {
+	fake := &fakeServer{}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	defer server.Close()
+
+	cfg := testConfig(wsURL(server))
+	r := run(context.Background(), cfg)
+
+	total := r.Total
+	if total.Devices.Started != 3 || total.Devices.Completed != 3 || total.Devices.Failed != 0 {
+		t.Fatalf("设备统计不符: %+v", total.Devices)
+	}
+	if total.Turns.Succeeded != 6 || total.Turns.Failed != 0 {
+		t.Fatalf("对话统计不符: %+v, 错误: %v", total.Turns, r.SampleErrors)
+	}
+	for _, metric := range []string{metricConnect, metricHello, metricSTT, metricFirstAudio, metricTurn} {
+		want := 6
+		if metric == metricConnect || metric == metricHello {
+			want = 3
+		}
+		if got := total.Latency[metric].Count; got != want {
+			t.Errorf("%s 样本数 %d，期望 %d", metric, got, want)
+		}
+	}
+	if s := total.Latency[metricFirstAudio]; s.Min < 10 {
+		t.Errorf("首包延迟应不小于服务端的 10ms 处理时间: %+v", s)
+	}
+	if got, want := fake.audioFrames.Load(), int64(6*len(cfg.Utterances[0].Frames)); got != want {
+		t.Errorf("服务端收到 %d 帧音频，期望 %d", got, want)
+	}
+
+	dir := t.TempDir()
+	if err := r.writeJSON(filepath.Join(dir, "report.json")); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	if err := r.writeHTML(filepath.Join(dir, "report.html")); err != nil {
+		t.Fatalf("writeHTML: %v", err)
+	}
+	html, _ := os.ReadFile(filepath.Join(dir, "report.html"))
+	if !bytes.Contains(html, []byte(metricFirstAudio)) {
+		t.Error("HTML 报告缺少延迟表")
+	}
+}
+
+func TestTurnTimeoutIsCountedAndAborted(t *testing.T) {
+	fake := &fakeServer{silent: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	defer server.Close()
+
+	cfg := testConfig(wsURL(server))
+	cfg.Stages = []stage{{Target: 1}}
+	cfg.TurnTimeout = 100 * time.Millisecond
+	r := run(context.Background(), cfg)
+
+	if r.Total.Turns.Failed != 2 || r.Total.Errors[errTimeout] != 2 || r.Total.Turns.ErrorRate != 1 {
+		t.Fatalf("超时应计入失败: %+v %v", r.Total.Turns, r.Total.Errors)
+	}
+	// 超时只影响本轮，设备继续下一轮直到结束
+	if r.Total.Devices.Completed != 1 {
+		t.Fatalf("设备统计不符: %+v", r.Total.Devices)
+	}
+	if fake.aborts.Load() != 2 {
+		t.Fatalf("超时后应发送 abort，实际 %d 次", fake.aborts.Load())
+	}
+}
+
+func TestConnectErrorIsCounted(t *testing.T) {
+	cfg := testConfig("ws://127.0.0.1:1/xiaozhi/v1/")
+	cfg.Stages = []stage{{Target: 2}}
+	r := run(context.Background(), cfg)
+	if r.Total.Devices.Failed != 2 || r.Total.Errors[errConnect] != 2 {
+		t.Fatalf("连接失败应计入错误: %+v %v", r.Total.Devices, r.Total.Errors)
+	}
+}
+
+func TestStagesSchedule(t *testing.T) {
+	stages, err := parseStages("10s:5, 20s:5, 5s:10")
+	if err != nil {
+		t.Fatalf("parseStages: %v", err)
+	}
+	offsets := schedule(stages)
+	want := []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second, 8 * time.Second,
+		30 * time.Second, 31 * time.Second, 32 * time.Second, 33 * time.Second, 34 * time.Second}
+	if len(offsets) != len(want) {
+		t.Fatalf("启动时间 %v，期望 %v", offsets, want)
+	}
+	for i := range want {
+		if offsets[i] != want[i] {
+			t.Fatalf("启动时间 %v，期望 %v", offsets, want)
+		}
+	}
+
+	for _, spec := range []string{"10s:5,10s:3", "10s", "x:1", ""} {
+		if _, err := parseStages(spec); err == nil {
+			t.Errorf("%q 应解析失败", spec)
+		}
+	}
+}
+
+func TestOggOpusRoundTrip(t *testing.T) {
+	// 包含超过 255 字节、跨多个分段的包
+	u := utterance{Frames: append(testFrames(5, 40), testFrames(2, 600)...)}
+	path := filepath.Join(t.TempDir(), "synthetic.opus")
+	if err := writeOggOpus(path, u.Frames); err != nil {
+		t.Fatalf("writeOggOpus: %v", err)
+	}
+	loaded, err := loadUtterances([]string{filepath.Dir(path)}, 60)
+	if err != nil {
+		t.Fatalf("loadUtterances: %v", err)
+	}
+	got := loaded[0]
+	if len(got.Frames) != len(u.Frames) || got.duration() != u.duration() {
+		t.Fatalf("读回 %d 帧 %s，期望 %d 帧 %s", len(got.Frames), got.duration(), len(u.Frames), u.duration())
+	}
+	for i := range u.Frames {
+		if !bytes.Equal(got.Frames[i].Data, u.Frames[i].Data) {
+			t.Fatalf("第 %d 帧内容不一致", i)
+		}
+	}
+}
+
+// writeOggOpus 把 Opus 包写成 Ogg Opus 文件，测试中用来构造素材
+func writeOggOpus(path string, frames []audioFrame) error {
+	var buf bytes.Buffer
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = channels
+	binary.LittleEndian.PutUint32(head[12:], sampleRate)
+	tags := append([]byte("OpusTags"), make([]byte, 8)...)
+
+	var granule uint64
+	seq := uint32(0)
+	writePage := func(pkt []byte, flags byte) {
+		lacing := make([]byte, 0, len(pkt)/255+1)
+		for n := len(pkt); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+		header := make([]byte, 27)
+		copy(header, "OggS")
+		header[5] = flags
+		binary.LittleEndian.PutUint64(header[6:], granule)
+		binary.LittleEndian.PutUint32(header[14:], 1)
+		binary.LittleEndian.PutUint32(header[18:], seq)
+		header[26] = byte(len(lacing))
+		// 本工具读取时不校验 CRC，这里留空
+		buf.Write(header)
+		buf.Write(lacing)
+		buf.Write(pkt)
+		seq++
+	}
+	writePage(head, 0x02)
+	writePage(tags, 0)
+	for i, f := range frames {
+		granule += uint64(f.Duration * 48000 / time.Second)
+		flags := byte(0)
+		if i == len(frames)-1 {
+			flags = 0x04
+		}
+		writePage(f.Data, flags)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// TestUdpPacketDecryptsOnServer 压测端加密的音频包能被服务端的 UDP 会话解密
+func TestUdpPacketDecryptsOnServer(t *testing.T) {
+	session := &mqtt_udp.UdpSession{AesKey: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, Nonce: [8]byte{0xaa, 0xbb, 0xcc, 0xdd, 1, 2, 3, 4}}
+	block, err := aes.NewCipher(session.AesKey[:])
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	session.Block = block
+	key, nonce := session.GetAesKeyAndNonce()
+
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer ln.Close()
+
+	c := &mqttUdpConn{cfg: &config{}, events: make(chan event, 16), closed: make(chan struct{})}
+	var hello udpHello
+	hello.UDP.Server = "127.0.0.1"
+	hello.UDP.Port = ln.LocalAddr().(*net.UDPAddr).Port
+	hello.UDP.Key, hello.UDP.Nonce = key, nonce
+	if err := c.openUDP(hello); err != nil {
+		t.Fatalf("openUDP: %v", err)
+	}
+	defer c.udp.Close()
+
+	buf := make([]byte, 2048)
+	for i, frame := range [][]byte{[]byte("first opus frame"), []byte("second")} {
+		if err := c.SendAudio(frame); err != nil {
+			t.Fatalf("SendAudio: %v", err)
+		}
+		ln.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := ln.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("ReadFromUDP: %v", err)
+		}
+		packet := buf[:n]
+		// 服务端按 nonce 的 4-8 字节查找会话
+		if !bytes.Equal(packet[4:12], session.Nonce[:]) {
+			t.Fatalf("nonce 中的会话标识不符: %x", packet[:16])
+		}
+		if seq := binary.BigEndian.Uint32(packet[12:16]); seq != uint32(i+1) {
+			t.Fatalf("序号 %d，期望 %d", seq, i+1)
+		}
+		decrypted, err := session.Decrypt(packet)
+		if err != nil || !bytes.Equal(decrypted, frame) {
+			t.Fatalf("服务端解密结果 %q (%v)，期望 %q", decrypted, err, frame)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stage 一个爬坡阶段：在 Duration 内把并发设备数线性增加到 Target
+type stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// parseStages 解析 "30s:50,1m:100" 形式的爬坡阶段，目标设备数不能下降
+func parseStages(spec string) ([]stage, error) {
+	var stages []stage
+	prev := 0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		durationStr, targetStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("阶段格式应为 时长:设备数，实际 %q", part)
+		}
+		d, err := time.ParseDuration(durationStr)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("无效的阶段时长 %q", durationStr)
+		}
+		target, err := strconv.Atoi(targetStr)
+		if err != nil || target < prev {
+			return nil, fmt.Errorf("无效的阶段设备数 %q，设备数不能小于上一阶段", targetStr)
+		}
+		stages = append(stages, stage{Duration: d, Target: target})
+		prev = target
+	}
+	if prev == 0 {
+		return nil, fmt.Errorf("阶段中没有设备: %q", spec)
+	}
+	return stages, nil
+}
+
+func formatStages(stages []stage) string {
+	parts := make([]string, len(stages))
+	for i, s := range stages {
+		parts[i] = fmt.Sprintf("%s:%d", s.Duration, s.Target)
+	}
+	return strings.Join(parts, ",")
+}
+
+// schedule 计算每个设备相对压测开始的启动时间
+func schedule(stages []stage) []time.Duration {
+	var (
+		offsets []time.Duration
+		elapsed time.Duration
+		prev    int
+	)
+	for _, s := range stages {
+		added := s.Target - prev
+		for n := 0; n < added; n++ {
+			offsets = append(offsets, elapsed+s.Duration*time.Duration(n)/time.Duration(added))
+		}
+		elapsed += s.Duration
+		prev = s.Target
+	}
+	return offsets
+}
+
+// config 压测参数
+type config struct {
+	Server         string
+	Ota            string
+	Transports     []string
+	Stages         []stage
+	Turns          int
+	Duration       time.Duration
+	Mode           string
+	FrameMs        int
+	TurnTimeout    time.Duration
+	ConnectTimeout time.Duration
+	Think          time.Duration
+	Token          string
+	MacPrefix      string
+	Insecure       bool
+	Utterances     []utterance
+	Silence        audioFrame
+	HTTPClient     *http.Client
+	// Progress 进度打印间隔，0 为不打印
+	Progress time.Duration
+}
+
+func (c *config) devices() int {
+	if len(c.Stages) == 0 {
+		return 0
+	}
+	return c.Stages[len(c.Stages)-1].Target
+}
+
+// run 按爬坡阶段启动全部设备，等待结束后生成报告
+func run(ctx context.Context, cfg *config) *report {
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	stats := newCollector()
+
+	tickerDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-tickerDone:
+				return
+			case <-ticker.C:
+				p := stats.tick()
+				if cfg.Progress > 0 && p.Second%int(max(cfg.Progress/time.Second, 1)) == 0 {
+					fmt.Printf("[%4ds] 在线设备 %d, 本秒完成 %d 轮, 失败 %d 轮\n", p.Second, p.ActiveDevices, p.TurnsOK, p.TurnsFailed)
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, offset := range schedule(cfg.Stages) {
+		if wait := time.Until(start.Add(offset)); wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		d := &device{
+			index:     i,
+			transport: cfg.Transports[i%len(cfg.Transports)],
+			id:        newIdentity(cfg.MacPrefix, i),
+			cfg:       cfg,
+			stats:     stats,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.run(ctx)
+		}()
+	}
+	wg.Wait()
+	close(tickerDone)
+	stats.tick()
+	return stats.report(cfg)
+}
+
+// 压测：模拟大量设备通过 WebSocket 或 MQTT+UDP 接入，完成 hello 握手后循环发送预录语音，
+// 统计首包音频延迟、整轮对话延迟和错误率，输出 JSON/HTML 报告
+func main() {
+	server := flag.String("server", "ws://127.0.0.1:8989/xiaozhi/v1/", "WebSocket 地址")
+	ota := flag.String("ota", "http://127.0.0.1:8989/xiaozhi/ota/", "OTA 地址，MQTT+UDP 设备通过它获取 MQTT 凭据")
+	transport := flag.String("transport", transportWebsocket, "传输方式 websocket/mqtt_udp，逗号分隔时设备轮流使用")
+	devices := flag.Int("devices", 10, "设备数，未指定 -stages 时使用")
+	ramp := flag.Duration("ramp", 10*time.Second, "在多长时间内启动全部设备，未指定 -stages 时使用")
+	stagesSpec := flag.String("stages", "", "爬坡阶段，如 30s:50,2m:50,30s:200 表示 30 秒升到 50 台、保持 2 分钟、再 30 秒升到 200 台")
+	turns := flag.Int("turns", 3, "每台设备的对话轮数，0 表示持续到 -duration 结束")
+	duration := flag.Duration("duration", 0, "压测总时长，到时结束所有设备，0 表示不限")
+	mode := flag.String("mode", "manual", "拾音模式 manual/auto")
+	audio := flag.String("audio", "", "语音素材：16kHz 单声道 WAV 或 Ogg Opus 文件/目录，逗号分隔；为空时使用内置合成语音")
+	frameMs := flag.Int("frame", 60, "WAV 编码及 hello 中声明的帧长（毫秒）")
+	turnTimeout := flag.Duration("turn-timeout", 30*time.Second, "说话结束后等待回复播放完的超时")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "连接和 hello 握手超时")
+	think := flag.Duration("think", time.Second, "两轮对话之间的停顿")
+	token := flag.String("token", "", "WebSocket Authorization token")
+	macPrefix := flag.String("mac-prefix", "02:4c:54", "设备 MAC 前三字节，设备按序号生成 MAC，多次压测使用同一批设备")
+	insecure := flag.Bool("insecure", false, "跳过 TLS 证书校验")
+	jsonPath := flag.String("json", "loadtest_report.json", "JSON 报告路径，为空不输出")
+	htmlPath := flag.String("html", "loadtest_report.html", "HTML 报告路径，为空不输出")
+	maxErrorRate := flag.Float64("max-error-rate", 1, "对话错误率超过该值时以非 0 退出，用于 CI")
+	flag.Parse()
+
+	cfg := &config{
+		Server:         *server,
+		Ota:            *ota,
+		Turns:          *turns,
+		Duration:       *duration,
+		Mode:           *mode,
+		FrameMs:        *frameMs,
+		TurnTimeout:    *turnTimeout,
+		ConnectTimeout: *connectTimeout,
+		Think:          *think,
+		Token:          *token,
+		MacPrefix:      *macPrefix,
+		Insecure:       *insecure,
+		HTTPClient: &http.Client{
+			Timeout:   *connectTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure}},
+		},
+		Progress: 5 * time.Second,
+	}
+	for _, t := range strings.Split(*transport, ",") {
+		t = strings.TrimSpace(t)
+		if t != transportWebsocket && t != transportMqttUdp {
+			fmt.Printf("不支持的传输方式: %s\n", t)
+			os.Exit(1)
+		}
+		cfg.Transports = append(cfg.Transports, t)
+	}
+	if cfg.Mode != "manual" && cfg.Mode != "auto" {
+		fmt.Printf("无效的拾音模式: %s，只支持 manual 或 auto\n", cfg.Mode)
+		os.Exit(1)
+	}
+	if cfg.Turns <= 0 && cfg.Duration <= 0 {
+		fmt.Println("-turns 为 0 时必须指定 -duration")
+		os.Exit(1)
+	}
+	if *stagesSpec != "" {
+		stages, err := parseStages(*stagesSpec)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cfg.Stages = stages
+	} else {
+		if *devices <= 0 {
+			fmt.Println("-devices 必须大于 0")
+			os.Exit(1)
+		}
+		cfg.Stages = []stage{{Duration: *ramp, Target: *devices}}
+	}
+
+	var paths []string
+	if *audio != "" {
+		paths = strings.Split(*audio, ",")
+	}
+	utterances, err := loadUtterances(paths, cfg.FrameMs)
+	if err != nil {
+		fmt.Printf("加载语音素材失败: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.Utterances = utterances
+	if cfg.Silence, err = silenceFrame(cfg.FrameMs); err != nil {
+		fmt.Printf("生成静音帧失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("开始压测: 传输方式 %s, 设备 %d, 阶段 %s, 语音素材 %d 条\n",
+		strings.Join(cfg.Transports, ","), cfg.devices(), formatStages(cfg.Stages), len(cfg.Utterances))
+
+	// Ctrl+C 提前结束时仍输出已收集的结果
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	r := run(ctx, cfg)
+	r.printSummary()
+
+	if *jsonPath != "" {
+		if err := r.writeJSON(*jsonPath); err != nil {
+			fmt.Printf("写入 JSON 报告失败: %v\n", err)
+		} else {
+			fmt.Printf("JSON 报告: %s\n", *jsonPath)
+		}
+	}
+	if *htmlPath != "" {
+		if err := r.writeHTML(*htmlPath); err != nil {
+			fmt.Printf("写入 HTML 报告失败: %v\n", err)
+		} else {
+			fmt.Printf("HTML 报告: %s\n", *htmlPath)
+		}
+	}
+	if r.Total.Turns.Attempted == 0 || r.Total.Turns.ErrorRate > *maxErrorRate {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// otaResponse OTA 接口返回中压测需要的部分
+type otaResponse struct {
+	Mqtt *struct {
+		Endpoint     string `json:"endpoint"`
+		ClientId     string `json:"client_id"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		PublishTopic string `json:"publish_topic"`
+	} `json:"mqtt"`
+	Activation *struct {
+		Code string `json:"code"`
+	} `json:"activation"`
+}
+
+// udpHello 服务端 hello 回复中的 UDP 通道参数
+type udpHello struct {
+	SessionID string `json:"session_id"`
+	UDP       struct {
+		Server string `json:"server"`
+		Port   int    `json:"port"`
+		Key    string `json:"key"`
+		Nonce  string `json:"nonce"`
+	} `json:"udp"`
+}
+
+// mqttUdpConn MQTT+UDP 设备连接：先走 OTA 获取 MQTT 凭据，控制消息走 MQTT，音频走 AES-CTR 加密的 UDP
+type mqttUdpConn struct {
+	cfg          *config
+	client       mqtt.Client
+	publishTopic string
+	sessionID    string
+
+	udp   *net.UDPConn
+	block cipher.Block
+	nonce []byte
+	seq   uint32
+
+	events chan event
+	closed chan struct{}
+	once   sync.Once
+}
+
+func dialMqttUdp(ctx context.Context, cfg *config, id identity) (deviceConn, error) {
+	ota, err := fetchOta(ctx, cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttUdpConn{
+		cfg:          cfg,
+		publishTopic: ota.Mqtt.PublishTopic,
+		events:       make(chan event, 1024),
+		closed:       make(chan struct{}),
+	}
+
+	broker := ota.Mqtt.Endpoint
+	if !strings.Contains(broker, "://") {
+		// 与固件一致：8883 端口走 TLS，其余为明文 TCP
+		scheme := "tcp"
+		if strings.HasSuffix(broker, ":8883") {
+			scheme = "ssl"
+		}
+		broker = scheme + "://" + broker
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(ota.Mqtt.ClientId).
+		SetUsername(ota.Mqtt.Username).
+		SetPassword(ota.Mqtt.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetKeepAlive(60 * time.Second).
+		SetTLSConfig(&tls.Config{InsecureSkipVerify: cfg.Insecure}).
+		SetDefaultPublishHandler(func(_ mqtt.Client, msg mqtt.Message) {
+			c.emit(textEvent(msg.Payload()))
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			c.emit(event{At: time.Now(), Err: fmt.Errorf("MQTT 连接断开: %w", err)})
+		})
+	c.client = mqtt.NewClient(opts)
+	token := c.client.Connect()
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return nil, fmt.Errorf("连接 MQTT %s 超时", broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("连接 MQTT %s 失败: %w", broker, err)
+	}
+	return c, nil
+}
+
+// fetchOta 以设备身份请求 OTA 接口，获取 MQTT 凭据
+func fetchOta(ctx context.Context, cfg *config, id identity) (*otaResponse, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"version":     2,
+		"mac_address": id.MAC,
+		"uuid":        id.ClientID,
+		"application": map[string]string{"name": "xiaozhi", "version": "1.6.0"},
+		"board":       map[string]string{"type": "loadtest", "mac": id.MAC},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Ota, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Device-Id", id.MAC)
+	req.Header.Set("Client-Id", id.ClientID)
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 OTA 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OTA 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var ota otaResponse
+	if err := json.Unmarshal(data, &ota); err != nil {
+		return nil, fmt.Errorf("解析 OTA 响应失败: %w", err)
+	}
+	if ota.Activation != nil && ota.Activation.Code != "" {
+		return nil, fmt.Errorf("设备未激活，激活码 %s", ota.Activation.Code)
+	}
+	if ota.Mqtt == nil || ota.Mqtt.Endpoint == "" {
+		return nil, fmt.Errorf("OTA 未下发 MQTT 配置")
+	}
+	return &ota, nil
+}
+
+func (c *mqttUdpConn) emit(ev event) {
+	select {
+	case c.events <- ev:
+	case <-c.closed:
+	}
+}
+
+func (c *mqttUdpConn) Hello(ctx context.Context) error {
+	err := c.SendJSON(clientMessage{
+		Type:      "hello",
+		Version:   3,
+		Transport: "udp",
+		AudioParams: &audioParams{
+			Format:        "opus",
+			SampleRate:    sampleRate,
+			Channels:      channels,
+			FrameDuration: c.cfg.FrameMs,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ev, err := waitHello(ctx, c.events, c.cfg.ConnectTimeout)
+	if err != nil {
+		return err
+	}
+	var hello udpHello
+	if err := json.Unmarshal(ev.Raw, &hello); err != nil {
+		return fmt.Errorf("解析 hello 回复失败: %w", err)
+	}
+	c.sessionID = hello.SessionID
+	return c.openUDP(hello)
+}
+
+func (c *mqttUdpConn) openUDP(hello udpHello) error {
+	key, err := hex.DecodeString(hello.UDP.Key)
+	if err != nil {
+		return fmt.Errorf("无效的 UDP 密钥: %w", err)
+	}
+	nonce, err := hex.DecodeString(hello.UDP.Nonce)
+	if err != nil || len(nonce) != aes.BlockSize {
+		return fmt.Errorf("无效的 UDP nonce: %s", hello.UDP.Nonce)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", hello.UDP.Server, hello.UDP.Port))
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	c.udp, c.block, c.nonce = conn, block, nonce
+	go c.udpReadLoop()
+	return nil
+}
+
+// udpReadLoop 只记录下行音频的到达时间，不解密
+func (c *mqttUdpConn) udpReadLoop() {
+	buf := make([]byte, 2048)
+	for {
+		n, err := c.udp.Read(buf)
+		if err != nil {
+			return
+		}
+		if n > aes.BlockSize {
+			c.emit(event{At: time.Now(), Audio: true})
+		}
+	}
+}
+
+func (c *mqttUdpConn) SendJSON(msg clientMessage) error {
+	if msg.SessionID == "" {
+		msg.SessionID = c.sessionID
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	token := c.client.Publish(c.publishTopic, 0, false, data)
+	if !token.WaitTimeout(c.cfg.ConnectTimeout) {
+		return fmt.Errorf("发布 %s 消息超时", msg.Type)
+	}
+	return token.Error()
+}
+
+// SendAudio 加密后发送一帧音频，nonce 为 hello 下发的模板填入长度和序号
+func (c *mqttUdpConn) SendAudio(frame []byte) error {
+	if c.udp == nil {
+		return fmt.Errorf("UDP 通道未建立")
+	}
+	c.seq++
+	packet := make([]byte, aes.BlockSize+len(frame))
+	copy(packet, c.nonce)
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(frame)))
+	binary.BigEndian.PutUint32(packet[12:16], c.seq)
+	cipher.NewCTR(c.block, packet[:aes.BlockSize]).XORKeyStream(packet[aes.BlockSize:], frame)
+	_, err := c.udp.Write(packet)
+	return err
+}
+
+func (c *mqttUdpConn) Events() <-chan event {
+	return c.events
+}
+
+func (c *mqttUdpConn) Close() error {
+	c.once.Do(func() {
+		if c.sessionID != "" {
+			c.SendJSON(clientMessage{Type: "goodbye"})
+		}
+		close(c.closed)
+		c.client.Disconnect(100)
+		if c.udp != nil {
+			c.udp.Close()
+		}
+	})
+	return nil
+}
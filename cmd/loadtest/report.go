@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// report 压测报告，同时输出为 JSON 和 HTML
+type report struct {
+	StartedAt    time.Time                  `json:"started_at"`
+	DurationMs   int64                      `json:"duration_ms"`
+	Config       reportConfig               `json:"config"`
+	Total        transportReport            `json:"total"`
+	Transports   map[string]transportReport `json:"transports"`
+	Timeline     []timelinePoint            `json:"timeline"`
+	SampleErrors []string                   `json:"sample_errors,omitempty"`
+}
+
+type reportConfig struct {
+	Server     string   `json:"server,omitempty"`
+	Ota        string   `json:"ota,omitempty"`
+	Transports []string `json:"transports"`
+	Devices    int      `json:"devices"`
+	Stages     string   `json:"stages"`
+	Turns      int      `json:"turns"`
+	Duration   string   `json:"duration,omitempty"`
+	Mode       string   `json:"mode"`
+	Utterances []string `json:"utterances"`
+}
+
+type transportReport struct {
+	Devices struct {
+		Started   int `json:"started"`
+		Connected int `json:"connected"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"devices"`
+	Turns struct {
+		Attempted int     `json:"attempted"`
+		Succeeded int     `json:"succeeded"`
+		Failed    int     `json:"failed"`
+		ErrorRate float64 `json:"error_rate"`
+	} `json:"turns"`
+	Latency map[string]summary `json:"latency"`
+	Errors  map[string]int     `json:"errors"`
+}
+
+func buildTransportReport(stats []*transportStats) transportReport {
+	var r transportReport
+	samples := make(map[string][]float64)
+	r.Errors = make(map[string]int)
+	for _, s := range stats {
+		r.Devices.Started += s.started
+		r.Devices.Connected += s.connected
+		r.Devices.Completed += s.completed
+		r.Devices.Failed += s.failed
+		r.Turns.Succeeded += s.turnsOK
+		r.Turns.Failed += s.turnsFailed
+		for metric, values := range s.samples {
+			samples[metric] = append(samples[metric], values...)
+		}
+		for kind, n := range s.errors {
+			r.Errors[kind] += n
+		}
+	}
+	r.Turns.Attempted = r.Turns.Succeeded + r.Turns.Failed
+	if r.Turns.Attempted > 0 {
+		r.Turns.ErrorRate = float64(r.Turns.Failed) / float64(r.Turns.Attempted)
+	}
+	r.Latency = make(map[string]summary, len(metricOrder))
+	for _, metric := range metricOrder {
+		r.Latency[metric] = summarize(samples[metric])
+	}
+	return r
+}
+
+// report 生成报告，在所有设备结束后调用
+func (c *collector) report(cfg *config) *report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &report{
+		StartedAt:    c.start,
+		DurationMs:   time.Since(c.start).Milliseconds(),
+		Transports:   make(map[string]transportReport),
+		Timeline:     append([]timelinePoint(nil), c.timeline...),
+		SampleErrors: append([]string(nil), c.sampleErrors...),
+		Config: reportConfig{
+			Transports: cfg.Transports,
+			Devices:    cfg.devices(),
+			Stages:     formatStages(cfg.Stages),
+			Turns:      cfg.Turns,
+			Mode:       cfg.Mode,
+		},
+	}
+	for _, t := range cfg.Transports {
+		switch t {
+		case transportWebsocket:
+			r.Config.Server = cfg.Server
+		case transportMqttUdp:
+			r.Config.Ota = cfg.Ota
+		}
+	}
+	if cfg.Duration > 0 {
+		r.Config.Duration = cfg.Duration.String()
+	}
+	for _, u := range cfg.Utterances {
+		r.Config.Utterances = append(r.Config.Utterances, u.Name)
+	}
+
+	names := make([]string, 0, len(c.transports))
+	for name := range c.transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	all := make([]*transportStats, 0, len(names))
+	for _, name := range names {
+		r.Transports[name] = buildTransportReport([]*transportStats{c.transports[name]})
+		all = append(all, c.transports[name])
+	}
+	r.Total = buildTransportReport(all)
+	return r
+}
+
+func (r *report) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (r *report) writeHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return reportTemplate.Execute(f, r)
+}
+
+// printSummary 在终端打印结果摘要
+func (r *report) printSummary() {
+	t := r.Total
+	fmt.Printf("\n压测结束, 耗时 %s\n", time.Duration(r.DurationMs)*time.Millisecond)
+	fmt.Printf("设备: 启动 %d, 握手成功 %d, 完成 %d, 失败 %d\n",
+		t.Devices.Started, t.Devices.Connected, t.Devices.Completed, t.Devices.Failed)
+	fmt.Printf("对话: %d 轮, 成功 %d, 失败 %d, 错误率 %.2f%%\n",
+		t.Turns.Attempted, t.Turns.Succeeded, t.Turns.Failed, t.Turns.ErrorRate*100)
+	fmt.Printf("%-16s %8s %8s %8s %8s %8s %8s\n", "指标(ms)", "count", "mean", "p50", "p90", "p99", "max")
+	for _, metric := range metricOrder {
+		s := t.Latency[metric]
+		fmt.Printf("%-16s %8d %8.1f %8.1f %8.1f %8.1f %8.1f\n", metric, s.Count, s.Mean, s.P50, s.P90, s.P99, s.Max)
+	}
+	if len(t.Errors) > 0 {
+		kinds := make([]string, 0, len(t.Errors))
+		for kind, n := range t.Errors {
+			kinds = append(kinds, fmt.Sprintf("%s=%d", kind, n))
+		}
+		sort.Strings(kinds)
+		fmt.Printf("错误: %s\n", strings.Join(kinds, ", "))
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"metrics": func() []string { return metricOrder },
+	"percent": func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) },
+	"sparkline": func(points []timelinePoint, field string) template.HTML {
+		// 简单的 SVG 折线，避免依赖外部图表库，报告可离线打开
+		const width, height = 800.0, 120.0
+		if len(points) == 0 {
+			return ""
+		}
+		values := make([]int, len(points))
+		maxValue := 1
+		for i, p := range points {
+			switch field {
+			case "active":
+				values[i] = p.ActiveDevices
+			case "ok":
+				values[i] = p.TurnsOK
+			case "failed":
+				values[i] = p.TurnsFailed
+			}
+			if values[i] > maxValue {
+				maxValue = values[i]
+			}
+		}
+		var b strings.Builder
+		for i, v := range values {
+			x := width * float64(i) / float64(max(len(values)-1, 1))
+			y := height - height*float64(v)/float64(maxValue)
+			fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+		}
+		return template.HTML(fmt.Sprintf(
+			`<svg viewBox="0 0 %.0f %.0f" width="100%%" height="%.0f" preserveAspectRatio="none"><polyline fill="none" stroke="#409eff" stroke-width="2" points="%s"/></svg><div class="axis">峰值 %d</div>`,
+			width, height, height, b.String(), maxValue))
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>压测报告 {{.StartedAt.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 24px; color: #1f2937; }
+h1 { font-size: 22px; } h2 { font-size: 18px; margin-top: 32px; }
+table { border-collapse: collapse; margin-top: 8px; }
+th, td { border: 1px solid #e5e7eb; padding: 6px 12px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f3f4f6; }
+.axis { font-size: 12px; color: #6b7280; }
+.errors li { font-family: monospace; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>压测报告</h1>
+<p>开始时间 {{.StartedAt.Format "2006-01-02 15:04:05"}}，耗时 {{.DurationMs}} ms，
+传输方式 {{range $i, $t := .Config.Transports}}{{if $i}}, {{end}}{{$t}}{{end}}，
+设备 {{.Config.Devices}}，阶段 {{.Config.Stages}}，每设备 {{if .Config.Turns}}{{.Config.Turns}} 轮{{else}}持续 {{.Config.Duration}}{{end}}，拾音模式 {{.Config.Mode}}</p>
+
+<h2>汇总</h2>
+<table>
+<tr><th>传输方式</th><th>设备启动</th><th>握手成功</th><th>完成</th><th>失败</th><th>对话轮数</th><th>成功</th><th>失败</th><th>错误率</th></tr>
+<tr><td>全部</td><td>{{.Total.Devices.Started}}</td><td>{{.Total.Devices.Connected}}</td><td>{{.Total.Devices.Completed}}</td><td>{{.Total.Devices.Failed}}</td><td>{{.Total.Turns.Attempted}}</td><td>{{.Total.Turns.Succeeded}}</td><td>{{.Total.Turns.Failed}}</td><td>{{percent .Total.Turns.ErrorRate}}</td></tr>
+{{range $name, $t := .Transports}}<tr><td>{{$name}}</td><td>{{$t.Devices.Started}}</td><td>{{$t.Devices.Connected}}</td><td>{{$t.Devices.Completed}}</td><td>{{$t.Devices.Failed}}</td><td>{{$t.Turns.Attempted}}</td><td>{{$t.Turns.Succeeded}}</td><td>{{$t.Turns.Failed}}</td><td>{{percent $t.Turns.ErrorRate}}</td></tr>
+{{end}}</table>
+
+<h2>延迟（毫秒）</h2>
+<table>
+<tr><th>指标</th><th>count</th><th>min</th><th>mean</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>max</th></tr>
+{{range $m := metrics}}{{with index $.Total.Latency $m}}<tr><td>{{$m}}</td><td>{{.Count}}</td><td>{{.Min}}</td><td>{{.Mean}}</td><td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P95}}</td><td>{{.P99}}</td><td>{{.Max}}</td></tr>
+{{end}}{{end}}</table>
+<p class="axis">stt_ms / first_audio_ms / turn_ms 均从说话结束（manual 模式为 listen stop）开始计时，first_audio_ms 即首包音频延迟。</p>
+
+{{if .Total.Errors}}<h2>错误</h2>
+<table>
+<tr><th>类型</th><th>次数</th></tr>
+{{range $kind, $n := .Total.Errors}}<tr><td>{{$kind}}</td><td>{{$n}}</td></tr>
+{{end}}</table>
+{{if .SampleErrors}}<ul class="errors">{{range .SampleErrors}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+
+<h2>时间线</h2>
+<p>在线设备数</p>
+{{sparkline .Timeline "active"}}
+<p>每秒完成对话轮数</p>
+{{sparkline .Timeline "ok"}}
+<p>每秒失败对话轮数</p>
+{{sparkline .Timeline "failed"}}
+</body>
+</html>
+`))
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 延迟指标，单位毫秒
+const (
+	metricConnect    = "connect_ms"
+	metricHello      = "hello_ms"
+	metricSTT        = "stt_ms"
+	metricFirstAudio = "first_audio_ms"
+	metricTurn       = "turn_ms"
+)
+
+var metricOrder = []string{metricConnect, metricHello, metricSTT, metricFirstAudio, metricTurn}
+
+// maxSampleErrors 报告中保留的错误样例条数
+const maxSampleErrors = 20
+
+// transportStats 单个传输方式的计数和延迟样本
+type transportStats struct {
+	started, connected, completed, failed int
+	active                                int
+	turnsOK, turnsFailed                  int
+	samples                               map[string][]float64
+	errors                                map[string]int
+}
+
+func newTransportStats() *transportStats {
+	return &transportStats{samples: make(map[string][]float64), errors: make(map[string]int)}
+}
+
+// collector 汇总所有设备的结果，并发安全
+type collector struct {
+	mu           sync.Mutex
+	start        time.Time
+	transports   map[string]*transportStats
+	sampleErrors []string
+	timeline     []timelinePoint
+	lastOK       int
+	lastFailed   int
+}
+
+func newCollector() *collector {
+	return &collector{start: time.Now(), transports: make(map[string]*transportStats)}
+}
+
+func (c *collector) get(transport string) *transportStats {
+	s, ok := c.transports[transport]
+	if !ok {
+		s = newTransportStats()
+		c.transports[transport] = s
+	}
+	return s
+}
+
+func (c *collector) deviceStarted(transport string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(transport)
+	s.started++
+	s.active++
+}
+
+func (c *collector) deviceFinished(transport string, connected, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(transport)
+	s.active--
+	if connected {
+		s.connected++
+	}
+	if failed {
+		s.failed++
+	} else if connected {
+		s.completed++
+	}
+}
+
+func (c *collector) observe(transport, metric string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(transport)
+	s.samples[metric] = append(s.samples[metric], float64(d.Microseconds())/1000)
+}
+
+func (c *collector) recordError(transport, kind string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(transport).errors[kind]++
+	if len(c.sampleErrors) < maxSampleErrors {
+		c.sampleErrors = append(c.sampleErrors, err.Error())
+	}
+}
+
+func (c *collector) turnFailed(transport, kind string, err error) {
+	c.recordError(transport, kind, err)
+	c.mu.Lock()
+	c.get(transport).turnsFailed++
+	c.mu.Unlock()
+}
+
+func (c *collector) turnSucceeded(transport string, r turnResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(transport)
+	s.turnsOK++
+	add := func(metric string, at time.Time) {
+		if !at.IsZero() && at.After(r.stopAt) {
+			s.samples[metric] = append(s.samples[metric], float64(at.Sub(r.stopAt).Microseconds())/1000)
+		}
+	}
+	add(metricSTT, r.sttAt)
+	add(metricFirstAudio, r.firstAudioAt)
+	add(metricTurn, r.doneAt)
+}
+
+// timelinePoint 每秒的在线设备数和完成的对话轮数
+type timelinePoint struct {
+	Second        int `json:"second"`
+	ActiveDevices int `json:"active_devices"`
+	TurnsOK       int `json:"turns_ok"`
+	TurnsFailed   int `json:"turns_failed"`
+}
+
+// tick 记录一个时间线点，由压测主循环每秒调用
+func (c *collector) tick() timelinePoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var active, ok, failed int
+	for _, s := range c.transports {
+		active += s.active
+		ok += s.turnsOK
+		failed += s.turnsFailed
+	}
+	p := timelinePoint{
+		Second:        int(time.Since(c.start).Round(time.Second) / time.Second),
+		ActiveDevices: active,
+		TurnsOK:       ok - c.lastOK,
+		TurnsFailed:   failed - c.lastFailed,
+	}
+	c.lastOK, c.lastFailed = ok, failed
+	c.timeline = append(c.timeline, p)
+	return p
+}
+
+// summary 一个延迟指标的统计
+type summary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func summarize(samples []float64) summary {
+	if len(samples) == 0 {
+		return summary{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	// 最近秩法取分位数
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return round(sorted[rank])
+	}
+	return summary{
+		Count: len(sorted),
+		Min:   round(sorted[0]),
+		Mean:  round(sum / float64(len(sorted))),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P95:   percentile(95),
+		P99:   percentile(99),
+		Max:   round(sorted[len(sorted)-1]),
+	}
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
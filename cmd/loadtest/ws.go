@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn WebSocket 设备连接：控制消息为文本帧，音频为二进制帧（协议版本 1，裸 Opus）
+type wsConn struct {
+	conn    *websocket.Conn
+	cfg     *config
+	writeMu sync.Mutex
+	events  chan event
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func dialWebsocket(ctx context.Context, cfg *config, id identity) (deviceConn, error) {
+	header := http.Header{}
+	header.Set("Device-Id", id.MAC)
+	header.Set("Client-Id", id.ClientID)
+	header.Set("Protocol-Version", "1")
+	if cfg.Token != "" {
+		header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: cfg.ConnectTimeout,
+		TLSClientConfig:  &tls.Config{InsecureSkipVerify: cfg.Insecure},
+	}
+	conn, _, err := dialer.DialContext(ctx, cfg.Server, header)
+	if err != nil {
+		return nil, err
+	}
+	c := &wsConn{
+		conn:   conn,
+		cfg:    cfg,
+		events: make(chan event, 1024),
+		closed: make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *wsConn) readLoop() {
+	defer close(c.events)
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.emit(event{At: time.Now(), Err: err})
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			c.emit(event{At: time.Now(), Audio: true})
+		} else {
+			c.emit(textEvent(data))
+		}
+	}
+}
+
+func (c *wsConn) emit(ev event) {
+	select {
+	case c.events <- ev:
+	case <-c.closed:
+	}
+}
+
+func (c *wsConn) Hello(ctx context.Context) error {
+	err := c.SendJSON(clientMessage{
+		Type:      "hello",
+		Version:   1,
+		Transport: transportWebsocket,
+		AudioParams: &audioParams{
+			Format:        "opus",
+			SampleRate:    sampleRate,
+			Channels:      channels,
+			FrameDuration: c.cfg.FrameMs,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = waitHello(ctx, c.events, c.cfg.ConnectTimeout)
+	return err
+}
+
+func (c *wsConn) SendJSON(msg clientMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *wsConn) SendAudio(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func (c *wsConn) Events() <-chan event {
+	return c.events
+}
+
+func (c *wsConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		c.writeMu.Lock()
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		c.writeMu.Unlock()
+		err = c.conn.Close()
+	})
+	return err
+}
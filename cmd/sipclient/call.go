@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo"
+	sipmsg "github.com/emiago/sipgo/sip"
+	"github.com/pion/rtp"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/sip"
+)
+
+// dtmfStep 通话开始后 At 时刻按下 Digit
+type dtmfStep struct {
+	At    time.Duration
+	Digit byte
+}
+
+// callConfig 一次测试呼叫的参数
+type callConfig struct {
+	// 网关地址 host:port
+	Server  string
+	From    string
+	To      string
+	Codec   sip.Codec
+	LocalIP string
+	// 接通后发送的语音，采样率与 Codec.SampleRate 一致，发完后发送静音
+	Audio []int16
+	DTMF  []dtmfStep
+	// 通话时长，到时本端挂机
+	Duration time.Duration
+}
+
+// callResult 呼叫结果
+type callResult struct {
+	Codec        string
+	SetupTime    time.Duration
+	Talked       time.Duration
+	PacketsSent  int
+	PacketsRecv  int
+	DTMFSent     int
+	RemoteHangup bool
+	// 收到的回复音频，采样率为 Codec.SampleRate
+	Received []int16
+}
+
+// placeCall 作为 SIP UAC 呼叫网关：发送带 SDP 的 INVITE，接通后按 20ms 节奏发送 RTP 语音和
+// RFC 4733 按键，同时录下网关回复的音频，到时或对端挂机后结束
+func placeCall(ctx context.Context, cfg callConfig) (*callResult, error) {
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(cfg.LocalIP)})
+	if err != nil {
+		return nil, fmt.Errorf("监听RTP端口失败: %w", err)
+	}
+	defer rtpConn.Close()
+
+	ua, err := sipgo.NewUA(sipgo.WithUserAgent("xiaozhi-sipclient"), sipgo.WithUserAgentHostname(cfg.LocalIP))
+	if err != nil {
+		return nil, err
+	}
+	defer ua.Close()
+	client, err := sipgo.NewClient(ua, sipgo.WithClientHostname(cfg.LocalIP))
+	if err != nil {
+		return nil, err
+	}
+	server, err := sipgo.NewServer(ua)
+	if err != nil {
+		return nil, err
+	}
+	// 信令端口用于接收网关发来的 BYE
+	sigConn, err := net.ListenPacket("udp", net.JoinHostPort(cfg.LocalIP, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("监听SIP端口失败: %w", err)
+	}
+	defer sigConn.Close()
+	go server.ServeUDP(sigConn)
+
+	contact := sipmsg.ContactHeader{
+		Address: sipmsg.Uri{Scheme: "sip", User: cfg.From, Host: cfg.LocalIP, Port: sigConn.LocalAddr().(*net.UDPAddr).Port},
+	}
+	dialogs := sipgo.NewDialogClientCache(client, contact)
+	server.OnBye(func(req *sipmsg.Request, tx sipmsg.ServerTransaction) {
+		if err := dialogs.ReadBye(req, tx); err != nil {
+			tx.Respond(sipmsg.NewResponseFromRequest(req, sipmsg.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil))
+		}
+	})
+
+	host, portStr, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("无效的网关地址 %q: %w", cfg.Server, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的网关端口 %q", portStr)
+	}
+
+	offer, err := sip.BuildSDP(cfg.LocalIP, rtpConn.LocalAddr().(*net.UDPAddr).Port, []sip.Codec{cfg.Codec}, sip.DefaultDTMFPayloadType)
+	if err != nil {
+		return nil, err
+	}
+	fromParams := sipmsg.NewParams()
+	fromParams.Add("tag", sipmsg.GenerateTagN(8))
+	contentType := sipmsg.ContentTypeHeader("application/sdp")
+
+	start := time.Now()
+	session, err := dialogs.Invite(ctx, sipmsg.Uri{Scheme: "sip", User: cfg.To, Host: host, Port: port}, offer,
+		&sipmsg.FromHeader{DisplayName: cfg.From, Address: sipmsg.Uri{Scheme: "sip", User: cfg.From, Host: cfg.LocalIP}, Params: fromParams},
+		&contentType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("发送INVITE失败: %w", err)
+	}
+	defer session.Close()
+	if err := session.WaitAnswer(ctx, sipgo.AnswerOptions{}); err != nil {
+		var resErr *sipgo.ErrDialogResponse
+		if errors.As(err, &resErr) {
+			return nil, fmt.Errorf("呼叫被拒绝: %d %s", resErr.Res.StatusCode, resErr.Res.Reason)
+		}
+		return nil, fmt.Errorf("等待应答失败: %w", err)
+	}
+	media, err := sip.ParseSDP(session.InviteResponse.Body(), []string{cfg.Codec.Name})
+	if err != nil {
+		session.Bye(context.Background())
+		return nil, fmt.Errorf("解析应答SDP失败: %w", err)
+	}
+	if err := session.Ack(ctx); err != nil {
+		return nil, fmt.Errorf("发送ACK失败: %w", err)
+	}
+
+	result := &callResult{Codec: media.Codec.Name, SetupTime: time.Since(start)}
+	talkStart := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		receiveRTP(rtpConn, media, result)
+	}()
+
+	remoteHangup := sendRTP(ctx, session.Context(), rtpConn, media, cfg, result)
+	result.RemoteHangup = remoteHangup
+	result.Talked = time.Since(talkStart)
+	if !remoteHangup {
+		byeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := session.Bye(byeCtx); err != nil {
+			fmt.Printf("发送BYE失败: %v\n", err)
+		}
+		cancel()
+	}
+	// 关闭 RTP 端口结束接收
+	rtpConn.Close()
+	wg.Wait()
+	return result, nil
+}
+
+// sendRTP 按包时长发送语音、静音和按键，返回是否由对端挂机
+func sendRTP(ctx, dialogCtx context.Context, conn *net.UDPConn, media *sip.RemoteMedia, cfg callConfig, result *callResult) bool {
+	encode := media.Codec.NewEncoder()
+	frameSamples := media.Codec.FrameSamples()
+	silence := make([]int16, frameSamples)
+	header := rtp.Header{
+		Version:        2,
+		PayloadType:    media.Codec.PayloadType,
+		SequenceNumber: uint16(rand.Uint32()),
+		Timestamp:      rand.Uint32(),
+		SSRC:           rand.Uint32(),
+		Marker:         true,
+	}
+	send := func(h rtp.Header, payload []byte) {
+		pkt := rtp.Packet{Header: h, Payload: payload}
+		data, err := pkt.Marshal()
+		if err != nil {
+			return
+		}
+		if _, err := conn.WriteToUDP(data, media.Addr); err == nil {
+			result.PacketsSent++
+		}
+	}
+
+	ticker := time.NewTicker(sip.PacketDuration)
+	defer ticker.Stop()
+	deadline := time.After(cfg.Duration)
+	start := time.Now()
+	pending := cfg.DTMF
+	var payload []byte
+	for pos := 0; ; pos += frameSamples {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return false
+		case <-dialogCtx.Done():
+			return true
+		case <-ticker.C:
+		}
+
+		frame := silence
+		if pos+frameSamples <= len(cfg.Audio) {
+			frame = cfg.Audio[pos : pos+frameSamples]
+		}
+		payload = encode(payload[:0], frame)
+		send(header, payload)
+		header.Marker = false
+		header.SequenceNumber++
+
+		if len(pending) > 0 && time.Since(start) >= pending[0].At {
+			if media.DTMF {
+				sendDTMF(send, &header, media.DTMFPayloadType, pending[0].Digit)
+				result.DTMFSent++
+			} else {
+				fmt.Printf("网关不支持 RFC 4733 按键，跳过按键 %c\n", pending[0].Digit)
+			}
+			pending = pending[1:]
+		}
+		header.Timestamp += media.Codec.TimestampStep()
+	}
+}
+
+// sendDTMF 发送一次按键：一个开始包和三个重复的结束包，同一按键的所有包使用相同时间戳
+func sendDTMF(send func(rtp.Header, []byte), header *rtp.Header, payloadType uint8, digit byte) {
+	const duration = 800 // 100ms，8kHz 时钟
+	h := *header
+	h.PayloadType = payloadType
+	h.Marker = true
+	send(h, sip.DTMFEvent{Digit: digit, Volume: 10, Duration: duration / 2}.Marshal())
+	h.Marker = false
+	end := sip.DTMFEvent{Digit: digit, End: true, Volume: 10, Duration: duration}.Marshal()
+	for i := 0; i < 3; i++ {
+		h.SequenceNumber++
+		send(h, end)
+	}
+	header.SequenceNumber = h.SequenceNumber + 1
+}
+
+// receiveRTP 接收并解码网关发来的音频，直到连接关闭
+func receiveRTP(conn *net.UDPConn, media *sip.RemoteMedia, result *callResult) {
+	decode := media.Codec.NewDecoder()
+	buf := make([]byte, 1500)
+	var pcm []int16
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(buf[:n]); err != nil || pkt.PayloadType != media.Codec.PayloadType {
+			continue
+		}
+		result.PacketsRecv++
+		pcm = decode(pcm[:0], pkt.Payload)
+		result.Received = append(result.Received, pcm...)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/sip"
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
+	"xiaozhi-esp32-server-golang/internal/util"
+)
+
+// parseDTMF 解析 "5s:1,12s:#" 形式的按键计划，时间相对接通时刻，必须递增
+func parseDTMF(spec string) ([]dtmfStep, error) {
+	var steps []dtmfStep
+	var prev time.Duration
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		atStr, digits, ok := strings.Cut(part, ":")
+		if !ok || len(digits) != 1 || (sip.DTMFEvent{Digit: digits[0]}).Marshal() == nil {
+			return nil, fmt.Errorf("按键格式应为 时间:按键，按键为 0-9*#A-D，实际 %q", part)
+		}
+		at, err := time.ParseDuration(atStr)
+		if err != nil || at < prev {
+			return nil, fmt.Errorf("无效的按键时间 %q，时间必须递增", atStr)
+		}
+		steps = append(steps, dtmfStep{At: at, Digit: digits[0]})
+		prev = at
+	}
+	return steps, nil
+}
+
+// loadAudio 读取单声道 WAV 并重采样到编码采样率，path 为空时生成约 1.5 秒带音节起伏的谐波音
+func loadAudio(path string, sampleRate int) ([]int16, error) {
+	if path == "" {
+		pcm := make([]float32, sampleRate*3/2)
+		for i := range pcm {
+			t := float64(i) / float64(sampleRate)
+			envelope := 0.5 - 0.5*math.Cos(2*math.Pi*4*t)
+			v := math.Sin(2*math.Pi*180*t) + 0.5*math.Sin(2*math.Pi*360*t) + 0.25*math.Sin(2*math.Pi*720*t)
+			pcm[i] = float32(0.3 * envelope * v)
+		}
+		return util.Float32SliceToInt16Slice(pcm), nil
+	}
+	pcm, rate, err := aec.ReadWavFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) == 0 {
+		return nil, fmt.Errorf("WAV 文件中没有音频: %s", path)
+	}
+	if rate != sampleRate {
+		pcm = util.ResampleLinearFloat32(pcm, rate, sampleRate)
+	}
+	return util.Float32SliceToInt16Slice(pcm), nil
+}
+
+// localIPFor 返回访问目标地址时使用的本机地址
+func localIPFor(server string) (string, error) {
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+func writeRecording(path string, pcm []int16, sampleRate int) error {
+	samples := make([]float32, len(pcm))
+	for i, v := range pcm {
+		samples[i] = float32(v) / math.MaxInt16
+	}
+	return aec.WriteWavFile(path, samples, sampleRate)
+}
+
+// SIP 测试话机：向电话网关发起一次呼叫，发送语音和按键并录下回复，不依赖外部 SIP 服务
+func main() {
+	server := flag.String("server", "127.0.0.1:5060", "SIP 网关地址 host:port")
+	from := flag.String("from", "10086", "主叫号码，网关据此映射设备ID")
+	to := flag.String("to", "xiaozhi", "被叫号码")
+	codecName := flag.String("codec", "G722", "音频编码 G722/PCMU/PCMA")
+	audio := flag.String("audio", "", "接通后发送的语音，单声道 WAV，会重采样到编码采样率；为空时使用内置合成语音")
+	dtmfSpec := flag.String("dtmf", "", "按键计划，如 5s:1,12s:# 表示接通 5 秒后按 1、12 秒后按 #")
+	duration := flag.Duration("duration", 30*time.Second, "通话时长，到时本端挂机")
+	record := flag.String("record", "sipclient_reply.wav", "回复音频的录音路径，为空不录音")
+	localIP := flag.String("local-ip", "", "本机地址，写入 SDP 和 Contact，默认按路由自动选择")
+	flag.Parse()
+
+	codec, ok := sip.LookupCodec(*codecName)
+	if !ok {
+		fmt.Printf("不支持的音频编码: %s\n", *codecName)
+		os.Exit(1)
+	}
+	steps, err := parseDTMF(*dtmfSpec)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	pcm, err := loadAudio(*audio, codec.SampleRate)
+	if err != nil {
+		fmt.Printf("加载语音失败: %v\n", err)
+		os.Exit(1)
+	}
+	if *localIP == "" {
+		if *localIP, err = localIPFor(*server); err != nil {
+			fmt.Printf("获取本机地址失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("呼叫 %s@%s, 主叫 %s, 编码 %s\n", *to, *server, *from, codec.Name)
+	result, err := placeCall(ctx, callConfig{
+		Server:   *server,
+		From:     *from,
+		To:       *to,
+		Codec:    codec,
+		LocalIP:  *localIP,
+		Audio:    pcm,
+		DTMF:     steps,
+		Duration: *duration,
+	})
+	if err != nil {
+		fmt.Printf("呼叫失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	hangup := "本端"
+	if result.RemoteHangup {
+		hangup = "网关"
+	}
+	fmt.Printf("通话结束: 编码 %s, 接通耗时 %s, 通话 %s, %s挂机\n", result.Codec, result.SetupTime.Round(time.Millisecond), result.Talked.Round(time.Second), hangup)
+	fmt.Printf("发送 RTP %d 包（按键 %d 次）, 收到 RTP %d 包, 回复音频 %.1f 秒\n",
+		result.PacketsSent, result.DTMFSent, result.PacketsRecv, float64(len(result.Received))/float64(codec.SampleRate))
+	if *record != "" && len(result.Received) > 0 {
+		if err := writeRecording(*record, result.Received, codec.SampleRate); err != nil {
+			fmt.Printf("写入录音失败: %v\n", err)
+		} else {
+			fmt.Printf("录音: %s\n", *record)
+		}
+	}
+}
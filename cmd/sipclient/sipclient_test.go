@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/sip"
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+)
+
+func TestParseDTMF(t *testing.T) {
+	steps, err := parseDTMF("5s:1, 12s:#,12s:*")
+	require.NoError(t, err)
+	assert.Equal(t, []dtmfStep{{5 * time.Second, '1'}, {12 * time.Second, '#'}, {12 * time.Second, '*'}}, steps)
+
+	steps, err = parseDTMF("")
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	for _, spec := range []string{"5s", "5s:x", "5s:12", "abc:1", "5s:1,2s:2"} {
+		_, err := parseDTMF(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// fakeSession 代替 ChatManager：回复 hello，记录设备消息并把上行音频原样回放
+type fakeSession struct {
+	mu       sync.Mutex
+	messages []map[string]any
+	closed   chan string
+}
+
+func (f *fakeSession) handle(conn types.IConn) {
+	conn.OnClose(func(deviceID string) { f.closed <- deviceID })
+	go func() {
+		for {
+			data, err := conn.RecvAudio(context.Background(), 10)
+			if err != nil {
+				return
+			}
+			conn.SendAudio(data)
+		}
+	}()
+	go func() {
+		for {
+			data, err := conn.RecvCmd(context.Background(), 10)
+			if err != nil {
+				return
+			}
+			var msg map[string]any
+			json.Unmarshal(data, &msg)
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			if msg["type"] == "hello" {
+				conn.SendCmd([]byte(`{"type":"hello","transport":"sip"}`))
+			}
+		}
+	}()
+}
+
+func (f *fakeSession) snapshot() []map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]any(nil), f.messages...)
+}
+
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func rms(pcm []int16) float64 {
+	var sum float64
+	for _, v := range pcm {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(max(len(pcm), 1)))
+}
+
+// TestCallGateway 用测试话机呼叫本地网关：主叫映射为设备，语音经 RTP/Opus 转码往返，按键映射为命令，# 挂机由网关发送 BYE
+func TestCallGateway(t *testing.T) {
+	for _, codecName := range []string{"G722", "PCMU"} {
+		t.Run(codecName, func(t *testing.T) {
+			codec, ok := sip.LookupCodec(codecName)
+			require.True(t, ok)
+			processor, err := audio.GetAudioProcesser(codec.SampleRate, 1, 20)
+			if err != nil {
+				t.Skipf("opus不可用，跳过: %v", err)
+			}
+			if _, err := processor.Encoder(make([]int16, codec.FrameSamples()), make([]byte, 4000)); err != nil {
+				t.Skipf("opus不可用，跳过: %v", err)
+			}
+
+			session := &fakeSession{closed: make(chan string, 1)}
+			server, err := sip.NewSipServer(sip.SipConfig{
+				ListenHost:   "127.0.0.1",
+				ListenPort:   freeUDPPort(t),
+				ExternalHost: "127.0.0.1",
+				Codecs:       []string{codecName},
+				WakeupText:   "你好小智",
+				DTMF:         map[string]string{"1": "text:讲个笑话", "#": sip.DTMFActionHangup},
+				CallerDevices: map[string]string{
+					"10086": "ba:8f:17:de:94:94",
+				},
+			}, sip.WithOnNewConnection(session.handle))
+			require.NoError(t, err)
+			require.NoError(t, server.Start())
+			defer server.Stop()
+
+			pcm, err := loadAudio("", codec.SampleRate)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			result, err := placeCall(ctx, callConfig{
+				Server:   server.Addr().String(),
+				From:     "10086",
+				To:       "xiaozhi",
+				Codec:    codec,
+				LocalIP:  "127.0.0.1",
+				Audio:    pcm,
+				DTMF:     []dtmfStep{{600 * time.Millisecond, '1'}, {1800 * time.Millisecond, '#'}},
+				Duration: 10 * time.Second,
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, codecName, result.Codec)
+			assert.True(t, result.RemoteHangup, "按 # 后应由网关挂机")
+			assert.Equal(t, 2, result.DTMFSent)
+			assert.Greater(t, result.PacketsRecv, 10)
+			// 回放的合成语音经过两次转码后仍有明显能量
+			assert.Greater(t, rms(result.Received), 500.0)
+
+			select {
+			case deviceID := <-session.closed:
+				assert.Equal(t, "ba:8f:17:de:94:94", deviceID)
+			case <-time.After(2 * time.Second):
+				t.Fatal("未通知连接关闭")
+			}
+
+			var got []string
+			for _, msg := range session.snapshot() {
+				entry, _ := msg["type"].(string)
+				if state, ok := msg["state"].(string); ok {
+					entry += ":" + state
+				}
+				if text, ok := msg["text"].(string); ok {
+					entry += ":" + text
+				}
+				got = append(got, entry)
+			}
+			assert.Equal(t, []string{"hello", "listen:start", "listen:detect:你好小智", "listen:detect:讲个笑话", "goodbye"}, got)
+		})
+	}
+}
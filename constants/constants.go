@@ -4,6 +4,7 @@ const (
 	VadTypeSileroVad = "silero_vad"
 	VadTypeWebRTCVad = "webrtc_vad"
 	VadTypeTenVad    = "ten_vad"
+	VadTypeMock      = "mock"
 )
 
 const (
@@ -11,6 +12,7 @@ const (
 	AsrTypeDoubao       = "doubao"
 	AsrTypeAliyunFunASR = "aliyun_funasr"
 	AsrTypeAliyunQwen3  = "aliyun_qwen3"
+	AsrTypeMock         = "mock"
 )
 
 const (
@@ -20,6 +22,7 @@ const (
 	LlmTypeEino    = "eino"
 	LlmTypeDify    = "dify"
 	LlmTypeCoze    = "coze"
+	LlmTypeMock    = "mock"
 )
 
 const (
@@ -34,4 +37,5 @@ const (
 	TtsTypeMinimax      = "minimax"
 	TtsTypeAliyunQwen   = "aliyun_qwen"
 	TtsTypeIndexTTSVLLM = "indextts_vllm"
+	TtsTypeMock         = "mock"
 )
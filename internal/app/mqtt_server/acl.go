@@ -0,0 +1,64 @@
+package mqtt_server
+
+import (
+	"sync"
+	"time"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+
+	client "xiaozhi-esp32-server-golang/internal/data/msg"
+)
+
+// clientIdentity 连接鉴权通过后确定的身份，ACL 只依据该身份判断，不再信任连接后的其他字段
+type clientIdentity struct {
+	admin bool
+	// mac 为 clientId 中的设备标识（冒号已替换为下划线），与设备主题后缀一致
+	mac         string
+	connectedAt time.Time
+}
+
+// identityStore 记录每个连接的身份，按连接对象区分，同 ID 新连接接管旧连接时互不影响
+type identityStore struct {
+	mu         sync.RWMutex
+	identities map[*mqttServer.Client]clientIdentity
+}
+
+func newIdentityStore() *identityStore {
+	return &identityStore{identities: make(map[*mqttServer.Client]clientIdentity)}
+}
+
+func (s *identityStore) set(cl *mqttServer.Client, identity clientIdentity) {
+	s.mu.Lock()
+	s.identities[cl] = identity
+	s.mu.Unlock()
+}
+
+func (s *identityStore) get(cl *mqttServer.Client) (clientIdentity, bool) {
+	s.mu.RLock()
+	identity, ok := s.identities[cl]
+	s.mu.RUnlock()
+	return identity, ok
+}
+
+func (s *identityStore) remove(cl *mqttServer.Client) {
+	s.mu.Lock()
+	delete(s.identities, cl)
+	s.mu.Unlock()
+}
+
+// deviceSubTopic 设备下行主题，每个设备只能接收自己的下行消息
+func deviceSubTopic(mac string) string {
+	return client.MDeviceSubTopicPrefix + mac
+}
+
+// allowDevice 普通设备的权限：只能发布到上行主题，只能订阅/接收自己的下行主题
+func allowDevice(identity clientIdentity, topic string, write bool) bool {
+	if identity.mac == "" {
+		return false
+	}
+	if write {
+		return topic == client.MDeviceMockPubTopicPrefix
+	}
+	// OTA 下发的订阅主题为占位值，固件可能照常订阅，放行但不会有消息
+	return topic == deviceSubTopic(identity.mac) || topic == client.MDeviceMockSubTopicPrefix
+}
@@ -0,0 +1,222 @@
+package mqtt_server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	mqttServer "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/spf13/viper"
+
+	client "xiaozhi-esp32-server-golang/internal/data/msg"
+	"xiaozhi-esp32-server-golang/internal/util"
+)
+
+const (
+	testSignatureKey = "test-signature-key"
+	testAdminUser    = "admin"
+	testAdminPass    = "admin-pass"
+)
+
+// startTestBroker 在随机端口启动带鉴权的进程内 broker，setup 在 Serve 前执行，返回连接地址和停止函数
+func startTestBroker(t *testing.T, setup ...func(*mqttServer.Server)) (string, func()) {
+	t.Helper()
+	for key, value := range map[string]interface{}{
+		"mqtt_server.enable_auth": true,
+		"mqtt_server.username":    testAdminUser,
+		"mqtt_server.password":    testAdminPass,
+		"ota.signature_key":       testSignatureKey,
+	} {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	srv, err := newServer(newIdentityStore())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	for _, fn := range setup {
+		fn(srv)
+	}
+	if err := srv.AddListener(listeners.NewTCP(listeners.Config{Type: "tcp", ID: "test", Address: address})); err != nil {
+		t.Fatalf("AddListener: %v", err)
+	}
+	if err := srv.Serve(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var once sync.Once
+	stop := func() { once.Do(func() { srv.Close() }) }
+	t.Cleanup(stop)
+	return "tcp://" + address, stop
+}
+
+type testClient struct {
+	paho.Client
+	received chan paho.Message
+}
+
+func connect(t *testing.T, broker, clientID, username, password string, options ...func(*paho.ClientOptions)) (*testClient, error) {
+	t.Helper()
+	tc := &testClient{received: make(chan paho.Message, 16)}
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
+		SetDefaultPublishHandler(func(_ paho.Client, m paho.Message) { tc.received <- m })
+	for _, option := range options {
+		option(opts)
+	}
+	tc.Client = paho.NewClient(opts)
+	token := tc.Connect()
+	if !token.WaitTimeout(3 * time.Second) {
+		return nil, fmt.Errorf("connect timeout")
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { tc.Disconnect(100) })
+	return tc, nil
+}
+
+func connectDevice(t *testing.T, broker, mac, uuid string) (*testClient, string) {
+	t.Helper()
+	creds, err := util.GenerateMqttCredentials(mac, uuid, "127.0.0.1", testSignatureKey)
+	if err != nil {
+		t.Fatalf("GenerateMqttCredentials: %v", err)
+	}
+	tc, err := connect(t, broker, creds.ClientId, creds.Username, creds.Password)
+	if err != nil {
+		t.Fatalf("设备 %s 连接失败: %v", mac, err)
+	}
+	return tc, parseMacFromClientId(creds.ClientId)
+}
+
+func (tc *testClient) expectMessage(t *testing.T, topic string) {
+	t.Helper()
+	select {
+	case m := <-tc.received:
+		if m.Topic() != topic {
+			t.Fatalf("收到主题 %s，期望 %s", m.Topic(), topic)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("未收到主题 %s 的消息", topic)
+	}
+}
+
+func (tc *testClient) expectNothing(t *testing.T) {
+	t.Helper()
+	select {
+	case m := <-tc.received:
+		t.Fatalf("不应收到消息，实际收到主题 %s", m.Topic())
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestDeviceCannotSubscribeToOtherDevices(t *testing.T) {
+	broker, _ := startTestBroker(t)
+	devA, _ := connectDevice(t, broker, "aa:bb:cc:dd:ee:01", "uuid-a")
+	devB, macB := connectDevice(t, broker, "aa:bb:cc:dd:ee:02", "uuid-b")
+	admin, err := connect(t, broker, "xiaozhi_server", testAdminUser, testAdminPass)
+	if err != nil {
+		t.Fatalf("管理员连接失败: %v", err)
+	}
+
+	for _, filter := range []string{client.MDeviceSubTopicPrefix + "#", deviceSubTopic(macB), "#"} {
+		token := devA.Subscribe(filter, 0, nil)
+		token.WaitTimeout(2 * time.Second)
+		if code := token.(*paho.SubscribeToken).Result()[filter]; code < 0x80 {
+			t.Fatalf("订阅 %s 应被拒绝，返回码 %#x", filter, code)
+		}
+	}
+
+	// 下行消息只投递给目标设备（连接时自动订阅）
+	admin.Publish(deviceSubTopic(macB), 0, false, []byte(`{"type":"hello"}`)).Wait()
+	devB.expectMessage(t, deviceSubTopic(macB))
+	devA.expectNothing(t)
+}
+
+func TestDevicePublishIsRestricted(t *testing.T) {
+	broker, _ := startTestBroker(t)
+	devA, macA := connectDevice(t, broker, "aa:bb:cc:dd:ee:01", "uuid-a")
+	_, macB := connectDevice(t, broker, "aa:bb:cc:dd:ee:02", "uuid-b")
+	admin, err := connect(t, broker, "xiaozhi_server", testAdminUser, testAdminPass)
+	if err != nil {
+		t.Fatalf("管理员连接失败: %v", err)
+	}
+	admin.Subscribe("#", 0, nil).Wait()
+
+	// 冒充服务端给其他设备下发消息被丢弃
+	devA.Publish(deviceSubTopic(macB), 0, false, []byte(`{"type":"hello"}`)).Wait()
+	admin.expectNothing(t)
+
+	// 上行消息按鉴权身份改写为设备自己的主题
+	devA.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"hello"}`)).Wait()
+	admin.expectMessage(t, client.MDevicePubTopicPrefix+macA)
+}
+
+func TestAuthRejectsForgedCredentials(t *testing.T) {
+	broker, _ := startTestBroker(t)
+
+	creds, err := util.GenerateMqttCredentials("aa:bb:cc:dd:ee:01", "uuid-a", "127.0.0.1", testSignatureKey)
+	if err != nil {
+		t.Fatalf("GenerateMqttCredentials: %v", err)
+	}
+	// 用设备 A 的密码冒充设备 B
+	forgedID := "GID_test@@@aa_bb_cc_dd_ee_02@@@uuid-a"
+	if _, err := connect(t, broker, forgedID, creds.Username, creds.Password); err == nil {
+		t.Fatal("冒充其他设备的 clientId 应被拒绝")
+	}
+
+	// 未配置签名密钥时不再接受任何设备凭据
+	viper.Set("ota.signature_key", "")
+	if _, err := connect(t, broker, creds.ClientId, creds.Username, creds.Password); err == nil {
+		t.Fatal("未配置 signature_key 时设备连接应被拒绝")
+	}
+}
+
+func TestCheckAuthConfig(t *testing.T) {
+	set := func(key string, value interface{}) {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+	set("mqtt_server.enable_auth", nil)
+	set("ota.signature_key", "")
+	set("mqtt_server.signature_key", "")
+
+	// 未配置 enable_auth 时默认开启鉴权，没有签名密钥拒绝启动
+	if err := checkAuthConfig(); err == nil {
+		t.Fatal("未配置签名密钥时应拒绝启动")
+	}
+	// 旧配置只写了 mqtt_server.signature_key，OTA 与 broker 读取同一个密钥
+	viper.Set("mqtt_server.signature_key", "legacy-key")
+	if err := checkAuthConfig(); err != nil || util.MqttSignatureKey() != "legacy-key" {
+		t.Fatalf("旧配置的签名密钥应被使用: %v %q", err, util.MqttSignatureKey())
+	}
+	viper.Set("ota.signature_key", testSignatureKey)
+	if util.MqttSignatureKey() != testSignatureKey {
+		t.Fatalf("应以 ota.signature_key 为准，got %q", util.MqttSignatureKey())
+	}
+	// 显式关闭鉴权时允许启动
+	viper.Set("ota.signature_key", "")
+	viper.Set("mqtt_server.signature_key", "")
+	viper.Set("mqtt_server.enable_auth", false)
+	if err := checkAuthConfig(); err != nil {
+		t.Fatalf("关闭鉴权时不应拒绝启动: %v", err)
+	}
+}
@@ -1,10 +1,8 @@
 package mqtt_server
 
 import (
-	"bytes"
-	"crypto/aes"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"time"
 
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
@@ -15,11 +13,12 @@ import (
 )
 
 // AuthHook 实现自定义鉴权逻辑
-// 支持普通用户和超级管理员
-// 普通用户: 用户名为 base64 后的 {"ip":"1.202.193.194"}，密码为 HMAC-SHA256 签名
-// 超级管理员: 用户名 admin，密码 shijingbo!@#
+// 支持普通设备和超级管理员，鉴权通过后把身份记录到 identities 供 DeviceHook 做 ACL
+// 超级管理员: 用户名、密码与 mqtt_server.username / mqtt_server.password 一致
+// 普通设备: OTA 下发的设备凭据，密码为 clientId|username 的 HMAC-SHA256 签名，clientId 中包含设备 MAC
 type AuthHook struct {
 	mqttServer.HookBase
+	identities *identityStore
 }
 
 func (h *AuthHook) ID() string {
@@ -31,94 +30,69 @@ func (h *AuthHook) Provides(b byte) bool {
 }
 
 func (h *AuthHook) OnConnectAuthenticate(cl *mqttServer.Client, pk packets.Packet) bool {
-	// 检查是否启用鉴权
-	enableAuth := viper.GetBool("mqtt_server.enable_auth")
-	if !enableAuth {
-		//log.Infof("MQTT鉴权已禁用，允许所有连接")
-		return true
+	identity, ok := h.authenticate(pk)
+	if ok {
+		identity.connectedAt = time.Now()
+		h.identities.set(cl, identity)
 	}
+	return ok
+}
 
+func (h *AuthHook) authenticate(pk packets.Packet) (clientIdentity, bool) {
 	username := string(pk.Connect.Username)
 	password := string(pk.Connect.Password)
 	clientId := string(pk.Connect.ClientIdentifier)
 
-	// 超级管理员校验
 	adminUsername := viper.GetString("mqtt_server.username")
 	adminPassword := viper.GetString("mqtt_server.password")
-	if username == adminUsername && password == adminPassword {
+
+	if !authEnabled() {
+		// 未启用鉴权时身份无法校验，仍按用户名和 clientId 区分管理员与设备，设备只能访问自己的主题
+		if adminUsername != "" && username == adminUsername {
+			return clientIdentity{admin: true}, true
+		}
+		return clientIdentity{mac: parseMacFromClientId(clientId)}, true
+	}
+
+	// 超级管理员校验
+	if adminUsername != "" && username == adminUsername && password == adminPassword {
 		log.Infof("超级管理员登录成功: %s", username)
-		return true
+		return clientIdentity{admin: true}, true
 	}
 
-	// 普通用户校验 - 使用新的签名验证逻辑
-	signatureKey := viper.GetString("mqtt_server.signature_key")
+	// 普通设备校验 - 签名覆盖 clientId，通过后 clientId 中的 MAC 即为可信身份
+	signatureKey := util.MqttSignatureKey()
 	if signatureKey != "" {
 		credentialInfo, err := util.ValidateMqttCredentials(clientId, username, password, signatureKey)
-		//log.Infof("MQTT用户验证开始: clientId=%s, username=%s, password=%s, signatureKey=%s",
-		//	clientId, username, password, signatureKey)
-		//log.Infof("MQTT用户验证开始: credentialInfo=%+v", credentialInfo)
-
 		if err != nil {
-			log.Warnf("MQTT凭据验证失败: %v", err)
-			return false
+			log.Warnf("MQTT凭据验证失败: clientId=%s, %v", clientId, err)
+			return clientIdentity{}, false
 		}
 
-		log.Infof("MQTT用户验证成功: groupId=%s, macAddress=%s, uuid=%s",
+		log.Infof("MQTT设备验证成功: groupId=%s, macAddress=%s, uuid=%s",
 			credentialInfo.GroupId, credentialInfo.MacAddress, credentialInfo.UUID)
-		return true
+		return clientIdentity{mac: parseMacFromClientId(clientId)}, true
 	}
 
-	// 如果没有配置签名密钥，回退到原来的AES验证逻辑
-	log.Warnf("缺少OTA签名密钥配置，使用AES验证方式")
-	return h.validateWithAes(username, password)
+	// 旧的 AES 方式所有设备共用同一密钥，任何设备都能冒充其他 clientId，不再支持
+	log.Warnf("缺少 ota.signature_key 配置，拒绝设备连接: clientId=%s", clientId)
+	return clientIdentity{}, false
 }
 
-// validateWithAes 使用AES方式验证密码（向后兼容）
-func (h *AuthHook) validateWithAes(username, password string) bool {
-	// 普通用户校验
-	decoded, err := base64.StdEncoding.DecodeString(username)
-	if err != nil {
-		return false
-	}
-	var userInfo map[string]string
-	if err := json.Unmarshal(decoded, &userInfo); err != nil {
-		return false
-	}
-	if _, ok := userInfo["ip"]; !ok {
-		return false
-	}
-	// 校验 password 是否为 AES 加密后的 username
-	if !checkAesPassword(username, password) {
-		return false
-	}
-	return true
-}
-
-// checkAesPassword 校验 password 是否为 AES-ECB 加密后 base64(username)
-func checkAesPassword(username, password string) bool {
-	key := []byte("xiaozhi_aes_key_1") // 16字节密钥，实际建议配置
-	ciphertext, err := aesEncryptECB([]byte(username), key)
-	if err != nil {
-		return false
-	}
-	cipherBase64 := base64.StdEncoding.EncodeToString(ciphertext)
-	return cipherBase64 == password
+// authEnabled mqtt_server.enable_auth 未配置时默认开启鉴权
+func authEnabled() bool {
+	return !viper.IsSet("mqtt_server.enable_auth") || viper.GetBool("mqtt_server.enable_auth")
 }
 
-// aesEncryptECB 实现 AES-ECB 加密
-func aesEncryptECB(src, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
+// checkAuthConfig 启动前检查鉴权配置：开启鉴权却没有签名密钥时所有设备都连不上，直接拒绝启动；
+// 关闭鉴权时任何人都能用设备的 clientId 冒充设备，打印警告
+func checkAuthConfig() error {
+	if !authEnabled() {
+		log.Warnf("mqtt_server.enable_auth 已关闭，内置MQTT服务器不校验设备凭据，任何人都可以冒充设备，请勿在生产环境使用")
+		return nil
 	}
-	blockSize := block.BlockSize()
-	// PKCS7 填充
-	padding := blockSize - len(src)%blockSize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	src = append(src, padtext...)
-	encrypted := make([]byte, len(src))
-	for bs, be := 0, blockSize; bs < len(src); bs, be = bs+blockSize, be+blockSize {
-		block.Encrypt(encrypted[bs:be], src[bs:be])
+	if util.MqttSignatureKey() == "" {
+		return errors.New("内置MQTT服务器已开启鉴权但未配置 ota.signature_key，设备凭据无法签发和校验")
 	}
-	return encrypted, nil
+	return nil
 }
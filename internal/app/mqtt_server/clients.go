@@ -0,0 +1,77 @@
+package mqtt_server
+
+import (
+	"sort"
+	"time"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+)
+
+// ClientInfo 内置 MQTT 服务器上的客户端，供管理后台查看
+type ClientInfo struct {
+	ClientID      string     `json:"client_id"`
+	Online        bool       `json:"online"` // false 表示从持久化存储恢复、尚未重连的会话
+	Admin         bool       `json:"admin"`
+	MAC           string     `json:"mac,omitempty"`
+	Remote        string     `json:"remote,omitempty"`
+	Listener      string     `json:"listener,omitempty"`
+	Protocol      byte       `json:"protocol"`
+	Subscriptions []string   `json:"subscriptions"`
+	ConnectedAt   *time.Time `json:"connected_at,omitempty"`
+}
+
+// ClientList 当前节点的客户端列表
+type ClientList struct {
+	Node    string       `json:"node"`
+	Running bool         `json:"running"`
+	Clients []ClientInfo `json:"clients"`
+}
+
+// ListClients 列出当前节点内置 MQTT 服务器上的客户端，未启动时 Running 为 false
+func ListClients() ClientList {
+	serverMu.Lock()
+	srv, identities := currentServer, currentIdentities
+	serverMu.Unlock()
+
+	list := ClientList{Node: nodeID(), Clients: []ClientInfo{}}
+	if srv == nil {
+		return list
+	}
+	list.Running = true
+	list.Clients = listClients(srv, identities)
+	return list
+}
+
+func listClients(srv *mqttServer.Server, identities *identityStore) []ClientInfo {
+	clients := make([]ClientInfo, 0)
+	for _, cl := range srv.Clients.GetAll() {
+		if cl.Net.Inline {
+			continue
+		}
+		info := ClientInfo{
+			ClientID:      cl.ID,
+			Online:        !cl.Closed(),
+			Remote:        cl.Net.Remote,
+			Listener:      cl.Net.Listener,
+			Protocol:      cl.Properties.ProtocolVersion,
+			Subscriptions: make([]string, 0),
+		}
+		if identity, ok := identities.get(cl); ok {
+			info.Admin = identity.admin
+			info.MAC = identity.mac
+			connectedAt := identity.connectedAt
+			info.ConnectedAt = &connectedAt
+			if !identity.admin && identity.mac != "" {
+				// 设备的下行主题由服务端直接订阅，不在客户端自身的订阅列表中
+				info.Subscriptions = append(info.Subscriptions, deviceSubTopic(identity.mac))
+			}
+		}
+		for filter := range cl.State.Subscriptions.GetAll() {
+			info.Subscriptions = append(info.Subscriptions, filter)
+		}
+		sort.Strings(info.Subscriptions)
+		clients = append(clients, info)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+	return clients
+}
@@ -0,0 +1,312 @@
+package mqtt_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	defaultClusterChannel = "xiaozhi:mqtt:cluster"
+	clusterPublishTimeout = 2 * time.Second
+	// clusterShareOwnerTTL 共享订阅组对某个主题的归属节点保留时长，归属节点每次投递时续期
+	clusterShareOwnerTTL = 2 * time.Minute
+)
+
+// nodeID 当前 broker 节点标识，未配置时使用主机名
+func nodeID() string {
+	if id := viper.GetString("mqtt_server.cluster.node_id"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// clusterTransport 节点间转发消息的通道，每个节点都会收到其他节点（也包括自己）发布的消息
+type clusterTransport interface {
+	Publish(ctx context.Context, payload []byte) error
+	Messages() <-chan []byte
+	// Claim 争抢 key 的归属，返回归属节点；key 已归属 node 时续期
+	Claim(ctx context.Context, key, node string, ttl time.Duration) (string, error)
+	Close() error
+}
+
+// clusterMessage 节点间转发的 MQTT 消息
+type clusterMessage struct {
+	Node    string `json:"node"`
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	Qos     byte   `json:"qos"`
+	Retain  bool   `json:"retain"`
+	// Delivered 在来源节点已投递过的共享订阅组，其他节点不再投递
+	Delivered []string `json:"delivered,omitempty"`
+}
+
+// ClusterHook 多个 broker 节点部署在负载均衡之后时，把本节点客户端发布的消息转发给其他节点，
+// 其他节点以内联客户端重新发布，设备连在哪个节点上都能收到主程序的下行消息，主程序也能收到所有设备的上行消息。
+// 共享订阅（主程序订阅 $share/xiaozhi/...）在整个集群只投递一次：设备所在节点有该组成员时由它投递，
+// 否则由争抢到该组、该主题归属的节点投递，同一设备的消息在归属有效期内固定由同一节点处理
+type ClusterHook struct {
+	mqttServer.HookBase
+	server    *mqttServer.Server
+	node      string
+	transport clusterTransport
+	done      chan struct{}
+
+	// sharedAllowed 正在重新发布的转发消息可以由本节点投递的共享订阅组，只在 receiveLoop 发布期间有效
+	sharedMu      sync.Mutex
+	sharedAllowed map[string]bool
+}
+
+func (h *ClusterHook) ID() string {
+	return "cluster-bridge-hook"
+}
+
+func (h *ClusterHook) Provides(b byte) bool {
+	return b == mqttServer.OnPublished || b == mqttServer.OnSelectSubscribers
+}
+
+// Init 开始接收其他节点转发的消息
+func (h *ClusterHook) Init(config any) error {
+	h.done = make(chan struct{})
+	go h.receiveLoop()
+	return nil
+}
+
+// Stop 停止转发并关闭通道
+func (h *ClusterHook) Stop() error {
+	err := h.transport.Close()
+	<-h.done
+	return err
+}
+
+// OnPublished 转发本节点客户端发布的消息；内联客户端发布的消息来自其他节点或服务端自身，不再转发避免回环
+func (h *ClusterHook) OnPublished(cl *mqttServer.Client, pk packets.Packet) {
+	if cl.Net.Inline || strings.HasPrefix(pk.TopicName, "$") {
+		return
+	}
+	payload, err := json.Marshal(clusterMessage{
+		Node:      h.node,
+		Topic:     pk.TopicName,
+		Payload:   pk.Payload,
+		Qos:       pk.FixedHeader.Qos,
+		Retain:    pk.FixedHeader.Retain,
+		Delivered: h.sharedGroups(pk.TopicName),
+	})
+	if err != nil {
+		log.Warnf("MQTT集群消息序列化失败, topic=%s: %v", pk.TopicName, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+	if err := h.transport.Publish(ctx, payload); err != nil {
+		log.Warnf("MQTT集群消息转发失败, topic=%s: %v", pk.TopicName, err)
+	}
+}
+
+func (h *ClusterHook) receiveLoop() {
+	defer close(h.done)
+	for payload := range h.transport.Messages() {
+		var msg clusterMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			log.Warnf("MQTT集群消息解析失败: %v", err)
+			continue
+		}
+		if msg.Node == h.node {
+			continue
+		}
+		// 内联发布同步完成投递，OnSelectSubscribers 在本协程内读取 sharedAllowed
+		h.setSharedAllowed(h.claimSharedGroups(msg))
+		if err := h.server.Publish(msg.Topic, msg.Payload, msg.Retain, msg.Qos); err != nil {
+			log.Warnf("MQTT集群消息投递失败, from=%s topic=%s: %v", msg.Node, msg.Topic, err)
+		}
+		h.setSharedAllowed(nil)
+	}
+}
+
+// OnSelectSubscribers 其他节点转发的消息只投递给本节点可以投递的共享订阅组，本节点客户端发布的消息照常投递
+func (h *ClusterHook) OnSelectSubscribers(subs *mqttServer.Subscribers, pk packets.Packet) *mqttServer.Subscribers {
+	if pk.Origin != mqttServer.InlineClientId {
+		return subs
+	}
+	h.sharedMu.Lock()
+	allowed := h.sharedAllowed
+	h.sharedMu.Unlock()
+	for group := range subs.Shared {
+		if !allowed[group] {
+			delete(subs.Shared, group)
+		}
+	}
+	selectSharedByTopic(subs, pk.TopicName)
+	return subs
+}
+
+func (h *ClusterHook) setSharedAllowed(allowed map[string]bool) {
+	h.sharedMu.Lock()
+	h.sharedAllowed = allowed
+	h.sharedMu.Unlock()
+}
+
+// sharedGroups 本节点匹配该主题的共享订阅组
+func (h *ClusterHook) sharedGroups(topic string) []string {
+	subs := h.server.Topics.Subscribers(topic)
+	groups := make([]string, 0, len(subs.Shared))
+	for group := range subs.Shared {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// claimSharedGroups 来源节点没有投递过的共享订阅组，本节点争抢到该组、该主题的归属后才投递
+func (h *ClusterHook) claimSharedGroups(msg clusterMessage) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, group := range h.sharedGroups(msg.Topic) {
+		if containsString(msg.Delivered, group) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+		owner, err := h.transport.Claim(ctx, group+"|"+msg.Topic, h.node, clusterShareOwnerTTL)
+		cancel()
+		if err != nil {
+			log.Warnf("MQTT集群共享订阅归属查询失败, group=%s topic=%s: %v", group, msg.Topic, err)
+			continue
+		}
+		allowed[group] = owner == h.node
+	}
+	return allowed
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// redisClusterTransport 通过 Redis pub/sub 在节点间转发
+type redisClusterTransport struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	channel  string
+	messages chan []byte
+}
+
+func newRedisClusterTransport(client *redis.Client, channel string) (*redisClusterTransport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageOpenTimeout)
+	defer cancel()
+	pubsub := client.Subscribe(ctx, channel)
+	// 等待订阅确认，Redis 不可用时启动失败而不是静默丢消息
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		return nil, err
+	}
+	t := &redisClusterTransport{
+		client:   client,
+		pubsub:   pubsub,
+		channel:  channel,
+		messages: make(chan []byte, 256),
+	}
+	go func() {
+		defer close(t.messages)
+		for msg := range pubsub.Channel() {
+			t.messages <- []byte(msg.Payload)
+		}
+	}()
+	return t, nil
+}
+
+func (t *redisClusterTransport) Publish(ctx context.Context, payload []byte) error {
+	return t.client.Publish(ctx, t.channel, payload).Err()
+}
+
+func (t *redisClusterTransport) Messages() <-chan []byte {
+	return t.messages
+}
+
+func (t *redisClusterTransport) Claim(ctx context.Context, key, node string, ttl time.Duration) (string, error) {
+	key = t.channel + ":owner:" + key
+	ok, err := t.client.SetNX(ctx, key, node, ttl).Result()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return node, nil
+	}
+	owner, err := t.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// 归属刚好过期，下一条消息再争抢
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if owner == node {
+		t.client.Expire(ctx, key, ttl)
+	}
+	return owner, nil
+}
+
+func (t *redisClusterTransport) Close() error {
+	err := t.pubsub.Close()
+	if cerr := t.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// addClusterHook 按 mqtt_server.cluster 配置挂载节点间消息转发
+func addClusterHook(srv *mqttServer.Server) error {
+	if !viper.GetBool("mqtt_server.cluster.enable") {
+		return nil
+	}
+	// 未单独配置时复用全局 redis 配置
+	host := viper.GetString("mqtt_server.cluster.redis.host")
+	port := viper.GetInt("mqtt_server.cluster.redis.port")
+	password := viper.GetString("mqtt_server.cluster.redis.password")
+	db := viper.GetInt("mqtt_server.cluster.redis.db")
+	if host == "" {
+		host = viper.GetString("redis.host")
+		port = viper.GetInt("redis.port")
+		password = viper.GetString("redis.password")
+		db = viper.GetInt("redis.db")
+	}
+	if port == 0 {
+		port = 6379
+	}
+	channel := viper.GetString("mqtt_server.cluster.channel")
+	if channel == "" {
+		channel = defaultClusterChannel
+	}
+	address := fmt.Sprintf("%s:%d", host, port)
+	transport, err := newRedisClusterTransport(redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+		DB:       db,
+	}), channel)
+	if err != nil {
+		return fmt.Errorf("连接MQTT集群 redis %s 失败: %w", address, err)
+	}
+	hook := &ClusterHook{server: srv, node: nodeID(), transport: transport}
+	if err := srv.AddHook(hook, nil); err != nil {
+		transport.Close()
+		return err
+	}
+	log.Infof("MQTT 集群转发已启用, node=%s, redis=%s, channel=%s", hook.node, address, channel)
+	return nil
+}
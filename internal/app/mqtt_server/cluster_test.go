@@ -0,0 +1,198 @@
+package mqtt_server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	client "xiaozhi-esp32-server-golang/internal/data/msg"
+)
+
+// memoryBus 进程内的集群通道，模拟 Redis pub/sub：每条消息投递给所有节点（包括发送方）
+type memoryBus struct {
+	mu     sync.Mutex
+	nodes  []*memoryTransport
+	owners map[string]string
+}
+
+type memoryTransport struct {
+	bus      *memoryBus
+	messages chan []byte
+	once     sync.Once
+}
+
+func (b *memoryBus) join() *memoryTransport {
+	t := &memoryTransport{bus: b, messages: make(chan []byte, 64)}
+	b.mu.Lock()
+	b.nodes = append(b.nodes, t)
+	b.mu.Unlock()
+	return t
+}
+
+func (t *memoryTransport) Publish(ctx context.Context, payload []byte) error {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	for _, node := range t.bus.nodes {
+		node.messages <- payload
+	}
+	return nil
+}
+
+func (t *memoryTransport) Messages() <-chan []byte {
+	return t.messages
+}
+
+func (t *memoryTransport) Claim(ctx context.Context, key, node string, ttl time.Duration) (string, error) {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	if t.bus.owners == nil {
+		t.bus.owners = make(map[string]string)
+	}
+	if _, ok := t.bus.owners[key]; !ok {
+		t.bus.owners[key] = node
+	}
+	return t.bus.owners[key], nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	for i, node := range t.bus.nodes {
+		if node == t {
+			t.bus.nodes = append(t.bus.nodes[:i], t.bus.nodes[i+1:]...)
+			break
+		}
+	}
+	t.once.Do(func() { close(t.messages) })
+	return nil
+}
+
+func withCluster(bus *memoryBus, node string) func(*mqttServer.Server) {
+	return func(srv *mqttServer.Server) {
+		hook := &ClusterHook{server: srv, node: node, transport: bus.join()}
+		if err := srv.AddHook(hook, nil); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestClusterDeliversAcrossNodes(t *testing.T) {
+	bus := &memoryBus{}
+	nodeA, _ := startTestBroker(t, withCluster(bus, "a"))
+	nodeB, _ := startTestBroker(t, withCluster(bus, "b"))
+
+	// 主程序连在节点 A，设备连在节点 B
+	admin, err := connect(t, nodeA, "xiaozhi_server", testAdminUser, testAdminPass)
+	if err != nil {
+		t.Fatalf("管理员连接失败: %v", err)
+	}
+	admin.Subscribe(client.MServerSubTopicPrefix, 0, nil).Wait()
+	dev, mac := connectDevice(t, nodeB, "aa:bb:cc:dd:ee:01", "uuid-a")
+	other, _ := connectDevice(t, nodeB, "aa:bb:cc:dd:ee:02", "uuid-b")
+
+	dev.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"hello"}`)).Wait()
+	admin.expectMessage(t, client.MDevicePubTopicPrefix+mac)
+
+	admin.Publish(deviceSubTopic(mac), 0, false, []byte(`{"type":"hello"}`)).Wait()
+	dev.expectMessage(t, deviceSubTopic(mac))
+	// 转发到其他节点的消息同样受设备 ACL 约束
+	other.expectNothing(t)
+	// 节点 A 收到的转发消息不会再转发回来
+	admin.expectNothing(t)
+}
+
+// receivedBy 等待各管理员收到的消息，返回收到消息的管理员下标
+func receivedBy(t *testing.T, admins []*testClient) []int {
+	t.Helper()
+	time.Sleep(300 * time.Millisecond)
+	var got []int
+	for i, admin := range admins {
+		for {
+			select {
+			case <-admin.received:
+				got = append(got, i)
+				continue
+			default:
+			}
+			break
+		}
+	}
+	return got
+}
+
+func TestClusterSharedSubscriptionDeliversOnce(t *testing.T) {
+	bus := &memoryBus{}
+	nodeA, _ := startTestBroker(t, withCluster(bus, "a"))
+	nodeB, _ := startTestBroker(t, withCluster(bus, "b"))
+	nodeC, _ := startTestBroker(t, withCluster(bus, "c"))
+
+	// 每个节点上都有一个主程序以共享订阅接收上行消息，节点 C 上没有
+	var admins []*testClient
+	for i, node := range []string{nodeA, nodeB} {
+		admin, err := connect(t, node, "xiaozhi_server_"+string(rune('a'+i)), testAdminUser, testAdminPass)
+		if err != nil {
+			t.Fatalf("管理员连接失败: %v", err)
+		}
+		admin.Subscribe(client.MServerShareSubTopic, 0, nil).Wait()
+		admins = append(admins, admin)
+	}
+	devA, _ := connectDevice(t, nodeA, "aa:bb:cc:dd:ee:01", "uuid-a")
+	devB, _ := connectDevice(t, nodeB, "aa:bb:cc:dd:ee:02", "uuid-b")
+	devC, _ := connectDevice(t, nodeC, "aa:bb:cc:dd:ee:03", "uuid-c")
+
+	// 设备所在节点有主程序时由该节点处理，其他节点不重复处理
+	devA.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"hello"}`)).Wait()
+	if got := receivedBy(t, admins); len(got) != 1 || got[0] != 0 {
+		t.Fatalf("节点 A 的设备消息应只由节点 A 的主程序处理一次, got %v", got)
+	}
+	devB.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"hello"}`)).Wait()
+	if got := receivedBy(t, admins); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("节点 B 的设备消息应只由节点 B 的主程序处理一次, got %v", got)
+	}
+
+	// 设备所在节点没有主程序时只由一个节点处理，且同一设备的后续消息仍由它处理
+	devC.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"hello"}`)).Wait()
+	first := receivedBy(t, admins)
+	if len(first) != 1 {
+		t.Fatalf("节点 C 的设备消息应只处理一次, got %v", first)
+	}
+	devC.Publish(client.MDeviceMockPubTopicPrefix, 0, false, []byte(`{"type":"listen"}`)).Wait()
+	if got := receivedBy(t, admins); len(got) != 1 || got[0] != first[0] {
+		t.Fatalf("同一设备的消息应由同一主程序处理, first %v got %v", first, got)
+	}
+}
+
+func TestSelectSharedByTopicIsSticky(t *testing.T) {
+	subs := &mqttServer.Subscribers{Shared: map[string]map[string]packets.Subscription{
+		"$share/xiaozhi/" + client.MServerSubTopicPrefix: {
+			"server-1": {Filter: client.MServerSubTopicPrefix},
+			"server-2": {Filter: client.MServerSubTopicPrefix},
+			"server-3": {Filter: client.MServerSubTopicPrefix},
+		},
+	}}
+	picked := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		topic := client.MDevicePubTopicPrefix + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		selectSharedByTopic(subs, topic)
+		if len(subs.SharedSelected) != 1 {
+			t.Fatalf("每个共享组应只选出一个成员: %v", subs.SharedSelected)
+		}
+		var id string
+		for id = range subs.SharedSelected {
+		}
+		for j := 0; j < 5; j++ {
+			selectSharedByTopic(subs, topic)
+			if _, ok := subs.SharedSelected[id]; !ok {
+				t.Fatalf("同一主题应固定选中 %s, got %v", id, subs.SharedSelected)
+			}
+		}
+		picked[id] = true
+	}
+	if len(picked) < 2 {
+		t.Fatalf("不同设备应分散到不同成员: %v", picked)
+	}
+}
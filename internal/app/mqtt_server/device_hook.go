@@ -2,6 +2,7 @@ package mqtt_server
 
 import (
 	"fmt"
+	"hash/fnv"
 	"strings"
 	"time"
 
@@ -13,10 +14,11 @@ import (
 )
 
 // DeviceHook 设备权限与自动订阅钩子
-// 普通用户禁止显式订阅，只允许发布指定 topic，连接时自动订阅 /devices/p2p/{mac}
+// 普通设备只允许发布到上行 topic、只能订阅自己的下行 topic，连接时自动订阅 /p2p/device_sub/{mac}
 type DeviceHook struct {
 	mqttServer.HookBase
-	server *mqttServer.Server
+	server     *mqttServer.Server
+	identities *identityStore
 }
 
 func (h *DeviceHook) ID() string {
@@ -24,32 +26,76 @@ func (h *DeviceHook) ID() string {
 }
 
 func (h *DeviceHook) Provides(b byte) bool {
-	return b == mqttServer.OnDisconnect || b == mqttServer.OnACLCheck || b == mqttServer.OnSessionEstablished || b == mqttServer.OnSubscribe || b == mqttServer.OnPublish
+	return b == mqttServer.OnDisconnect || b == mqttServer.OnACLCheck || b == mqttServer.OnSessionEstablished || b == mqttServer.OnSubscribe || b == mqttServer.OnPublish || b == mqttServer.OnSelectSubscribers
 }
 
-// OnACLCheck 发布/订阅权限控制
-func (h *DeviceHook) OnACLCheck(cl *mqttServer.Client, topic string, write bool) bool {
-	isAdmin := isAdminUser(cl)
+// OnSelectSubscribers 共享订阅组按主题固定选择成员，同一设备的上行消息始终由同一个主程序处理
+func (h *DeviceHook) OnSelectSubscribers(subs *mqttServer.Subscribers, pk packets.Packet) *mqttServer.Subscribers {
+	selectSharedByTopic(subs, pk.TopicName)
+	return subs
+}
 
-	if isAdmin {
+// selectSharedByTopic 每个共享订阅组按 clientId 与主题的哈希选出一个成员（最高随机权重），
+// 组内成员增减时只有少数主题换到其他成员
+func selectSharedByTopic(subs *mqttServer.Subscribers, topic string) {
+	subs.SharedSelected = map[string]packets.Subscription{}
+	for _, members := range subs.Shared {
+		var selected string
+		var best uint64
+		for id := range members {
+			hash := fnv.New64a()
+			hash.Write([]byte(id))
+			hash.Write([]byte{0})
+			hash.Write([]byte(topic))
+			if score := mix64(hash.Sum64()); selected == "" || score > best || (score == best && id < selected) {
+				selected, best = id, score
+			}
+		}
+		if selected == "" {
+			continue
+		}
+		sub := members[selected]
+		if cls, ok := subs.SharedSelected[selected]; ok {
+			sub = cls.Merge(sub)
+		}
+		subs.SharedSelected[selected] = sub
+	}
+}
+
+// mix64 splitmix64 的终结步骤，FNV 对末尾几个字节的差异扩散不够，直接比较会让同一成员总是胜出
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// OnACLCheck 发布/订阅权限控制，订阅和投递消息时都会检查（write=false）
+func (h *DeviceHook) OnACLCheck(cl *mqttServer.Client, topic string, write bool) bool {
+	identity, ok := h.identities.get(cl)
+	if !ok {
+		log.Warnf("客户端 %s 没有鉴权身份，拒绝访问 %s", cl.ID, topic)
+		return false
+	}
+	if identity.admin {
 		return true // 超级管理员无限制
 	}
 
+	if allowDevice(identity, topic, write) {
+		return true
+	}
 	if write {
-		// 只允许普通用户发布到 "device-server"
-		if topic == client.MDeviceMockPubTopicPrefix {
-			return true
-		}
-		log.Warnf("禁止普通用户发布到 %s", topic)
-		return false
+		log.Warnf("禁止设备 %s 发布到 %s", cl.ID, topic)
+	} else {
+		log.Warnf("禁止设备 %s 订阅 %s", cl.ID, topic)
 	}
-	// 禁止显式订阅
-	//return false
-	return true
+	return false
 }
 
 func (h *DeviceHook) OnConnect(cl *mqttServer.Client, pk packets.Packet) error {
-	isAdmin := isAdminUser(cl)
+	isAdmin := h.isAdminUser(cl)
 	if isAdmin {
 		return nil
 	}
@@ -58,7 +104,8 @@ func (h *DeviceHook) OnConnect(cl *mqttServer.Client, pk packets.Packet) error {
 }
 
 func (h *DeviceHook) OnDisconnect(cl *mqttServer.Client, err error, ok bool) {
-	isAdmin := isAdminUser(cl)
+	isAdmin := h.isAdminUser(cl)
+	h.identities.remove(cl)
 	if isAdmin {
 		return
 	}
@@ -71,7 +118,7 @@ func (h *DeviceHook) OnDisconnect(cl *mqttServer.Client, err error, ok bool) {
 		log.Info("警告: 无法从客户端ID解析MAC地址:", cl.ID)
 		return
 	}
-	topic := fmt.Sprintf("%s%s", client.MDeviceSubTopicPrefix, mac)
+	topic := deviceSubTopic(mac)
 
 	action := h.server.Topics.Unsubscribe(topic, cl.ID)
 	log.Infof("取消订阅客户端 %s 到主题 %s, action: %v", cl.ID, topic, action)
@@ -81,7 +128,7 @@ func (h *DeviceHook) OnDisconnect(cl *mqttServer.Client, err error, ok bool) {
 
 // OnSessionEstablished 连接建立后自动订阅
 func (h *DeviceHook) OnSessionEstablished(cl *mqttServer.Client, pk packets.Packet) {
-	isAdmin := isAdminUser(cl)
+	isAdmin := h.isAdminUser(cl)
 	mac := parseMacFromClientId(cl.ID)
 	if isAdmin {
 		return // 超级管理员不做限制
@@ -91,7 +138,7 @@ func (h *DeviceHook) OnSessionEstablished(cl *mqttServer.Client, pk packets.Pack
 		return
 	}
 
-	topic := fmt.Sprintf("%s%s", client.MDeviceSubTopicPrefix, mac)
+	topic := deviceSubTopic(mac)
 
 	// 使用服务器的API直接订阅，而不是注入数据包
 	clientID := cl.ID
@@ -123,13 +170,17 @@ func (h *DeviceHook) OnSubscribe(cl *mqttServer.Client, pk packets.Packet) packe
 
 // OnPublish 打印发布包
 func (h *DeviceHook) OnPublish(cl *mqttServer.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline {
+		return pk, nil // 服务端内联发布（含集群其他节点转发的消息），主题已是最终主题
+	}
+
 	log.Info("=== 收到发布包 ===")
 	log.Infof("客户端ID: %s", cl.ID)
 	log.Infof("包类型: %v", pk.FixedHeader.Type)
 	log.Infof("包ID: %d", pk.PacketID)
 	log.Infof("主题: %s", pk.TopicName)
 
-	if isAdminUser(cl) {
+	if h.isAdminUser(cl) {
 		return pk, nil
 	}
 
@@ -158,9 +209,10 @@ func (h *DeviceHook) OnPublish(cl *mqttServer.Client, pk packets.Packet) (packet
 	return pk, nil
 }
 
-// 判断是否超级管理员
-func isAdminUser(cl *mqttServer.Client) bool {
-	return string(cl.Properties.Username) == "admin"
+// 判断是否超级管理员，以鉴权时记录的身份为准
+func (h *DeviceHook) isAdminUser(cl *mqttServer.Client) bool {
+	identity, _ := h.identities.get(cl)
+	return identity.admin
 }
 
 // 解析 clientId，获取 mac 地址
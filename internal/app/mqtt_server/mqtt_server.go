@@ -14,8 +14,9 @@ import (
 )
 
 var (
-	currentServer *mqttServer.Server
-	serverMu      sync.Mutex
+	currentServer     *mqttServer.Server
+	currentIdentities *identityStore
+	serverMu          sync.Mutex
 )
 
 // StartMqttServer 启动 MQTT 服务器（可被 StopMqttServer 后再次调用以热更）
@@ -25,27 +26,43 @@ func StartMqttServer() error {
 	if currentServer != nil {
 		return errors.New("mqtt_server 已在运行，请先 StopMqttServer")
 	}
-	srv := mqttServer.New(&mqttServer.Options{
-		InlineClient: true,
-	})
-
-	if err := srv.AddHook(&AuthHook{}, nil); err != nil {
-		log.Errorf("添加 AuthHook 失败: %v", err)
+	if err := checkAuthConfig(); err != nil {
 		return err
 	}
-	deviceHook := &DeviceHook{server: srv}
-	if err := srv.AddHook(deviceHook, nil); err != nil {
-		log.Errorf("添加 DeviceHook 失败: %v", err)
+	identities := newIdentityStore()
+	srv, err := newServer(identities)
+	if err != nil {
 		return err
 	}
 
+	address, err := addListeners(srv)
+	if err != nil {
+		// 关闭已打开的持久化存储和集群连接，避免下次启动时文件被占用
+		srv.Close()
+		return err
+	}
+
+	currentServer = srv
+	currentIdentities = identities
+	log.Infof("MQTT 服务器启动，监听 %s 地址...", address)
+	go func() {
+		// Serve() 在库内启动 listener 协程后即返回，不会阻塞，故不在此处清 currentServer
+		if err := srv.Serve(); err != nil {
+			log.Warnf("MQTT Server Serve 退出: %v", err)
+		}
+	}()
+	return nil
+}
+
+// addListeners 按配置添加 TCP（以及可选的 TLS）监听，返回 TCP 监听地址
+func addListeners(srv *mqttServer.Server) (string, error) {
 	if viper.GetBool("mqtt_server.tls.enable") {
 		pemFile := viper.GetString("mqtt_server.tls.pem")
 		keyFile := viper.GetString("mqtt_server.tls.key")
 		cert, err := tls.LoadX509KeyPair(pemFile, keyFile)
 		if err != nil {
 			log.Errorf("加载证书失败: %v", err)
-			return err
+			return "", err
 		}
 		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
 		ssltcp := listeners.NewTCP(listeners.Config{
@@ -54,30 +71,49 @@ func StartMqttServer() error {
 			TLSConfig: tlsConfig,
 		})
 		if err := srv.AddListener(ssltcp); err != nil {
-			return err
+			return "", err
 		}
 	}
 
 	host := viper.GetString("mqtt_server.listen_host")
 	port := viper.GetInt("mqtt_server.listen_port")
 	if port == 0 {
-		return errors.New("mqtt_server.port 配置错误，请检查配置文件")
+		return "", errors.New("mqtt_server.port 配置错误，请检查配置文件")
 	}
 	address := fmt.Sprintf("%s:%d", host, port)
 	tcp := listeners.NewTCP(listeners.Config{Type: "tcp", ID: "t1", Address: address})
 	if err := srv.AddListener(tcp); err != nil {
-		return err
+		return "", err
 	}
+	return address, nil
+}
 
-	currentServer = srv
-	log.Infof("MQTT 服务器启动，监听 %s 地址...", address)
-	go func() {
-		// Serve() 在库内启动 listener 协程后即返回，不会阻塞，故不在此处清 currentServer
-		if err := srv.Serve(); err != nil {
-			log.Warnf("MQTT Server Serve 退出: %v", err)
-		}
-	}()
-	return nil
+// newServer 创建挂载鉴权、设备 ACL、持久化存储和集群转发钩子的 MQTT 服务器（未添加监听）
+func newServer(identities *identityStore) (*mqttServer.Server, error) {
+	srv := mqttServer.New(&mqttServer.Options{
+		InlineClient: true,
+	})
+
+	if err := srv.AddHook(&AuthHook{identities: identities}, nil); err != nil {
+		log.Errorf("添加 AuthHook 失败: %v", err)
+		return nil, err
+	}
+	deviceHook := &DeviceHook{server: srv, identities: identities}
+	if err := srv.AddHook(deviceHook, nil); err != nil {
+		log.Errorf("添加 DeviceHook 失败: %v", err)
+		return nil, err
+	}
+	if err := addStorageHook(srv); err != nil {
+		log.Errorf("添加 MQTT 持久化存储失败: %v", err)
+		srv.Close()
+		return nil, err
+	}
+	if err := addClusterHook(srv); err != nil {
+		log.Errorf("添加 MQTT 集群转发失败: %v", err)
+		srv.Close()
+		return nil, err
+	}
+	return srv, nil
 }
 
 // StopMqttServer 停止当前 MQTT 服务器，便于热更后重新 StartMqttServer
@@ -97,6 +133,7 @@ func StopMqttServer() error {
 	}
 	serverMu.Lock()
 	currentServer = nil
+	currentIdentities = nil
 	serverMu.Unlock()
 	log.Info("MQTT 服务器已停止")
 	return nil
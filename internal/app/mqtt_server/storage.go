@@ -0,0 +1,80 @@
+package mqtt_server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/bolt"
+	"github.com/mochi-mqtt/server/v2/hooks/storage/redis"
+	"github.com/spf13/viper"
+	"go.etcd.io/bbolt"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	defaultStoragePath = "data/mqtt_server.db"
+	storageOpenTimeout = 5 * time.Second
+)
+
+// addStorageHook 按 mqtt_server.storage.type 挂载持久化存储，保存会话、订阅、保留消息和未确认的 QoS 消息，重启后恢复
+// 未配置或为 memory 时保持原来的纯内存行为
+func addStorageHook(srv *mqttServer.Server) error {
+	storageType := viper.GetString("mqtt_server.storage.type")
+	switch storageType {
+	case "", "memory":
+		return nil
+	case "bolt":
+		path := viper.GetString("mqtt_server.storage.bolt.path")
+		if path == "" {
+			path = defaultStoragePath
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("创建MQTT存储目录失败: %w", err)
+		}
+		if err := srv.AddHook(new(bolt.Hook), &bolt.Options{
+			Path:    path,
+			Options: &bbolt.Options{Timeout: storageOpenTimeout},
+		}); err != nil {
+			return fmt.Errorf("打开MQTT bolt存储 %s 失败: %w", path, err)
+		}
+		log.Infof("MQTT 服务器使用 bolt 持久化存储: %s", path)
+		return nil
+	case "redis":
+		// 未单独配置时复用全局 redis 配置；多个节点共用一个 Redis 时按节点区分键前缀，避免会话互相覆盖
+		host := viper.GetString("mqtt_server.storage.redis.host")
+		port := viper.GetInt("mqtt_server.storage.redis.port")
+		password := viper.GetString("mqtt_server.storage.redis.password")
+		db := viper.GetInt("mqtt_server.storage.redis.db")
+		if host == "" {
+			host = viper.GetString("redis.host")
+			port = viper.GetInt("redis.port")
+			password = viper.GetString("redis.password")
+			db = viper.GetInt("redis.db")
+		}
+		if port == 0 {
+			port = 6379
+		}
+		prefix := viper.GetString("mqtt_server.storage.redis.prefix")
+		if prefix == "" {
+			prefix = "xiaozhi:mqtt:"
+		}
+		prefix += nodeID() + ":"
+		address := fmt.Sprintf("%s:%d", host, port)
+		if err := srv.AddHook(new(redis.Hook), &redis.Options{
+			Address:  address,
+			Password: password,
+			Database: db,
+			HPrefix:  prefix,
+		}); err != nil {
+			return fmt.Errorf("连接MQTT redis存储 %s 失败: %w", address, err)
+		}
+		log.Infof("MQTT 服务器使用 redis 持久化存储: %s, prefix=%s", address, prefix)
+		return nil
+	default:
+		return fmt.Errorf("不支持的MQTT存储类型: %s", storageType)
+	}
+}
@@ -0,0 +1,51 @@
+package mqtt_server
+
+import (
+	"path/filepath"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+
+	client "xiaozhi-esp32-server-golang/internal/data/msg"
+)
+
+func TestBoltStorageRestoresSessionsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt", "mqtt_server.db")
+	for key, value := range map[string]interface{}{
+		"mqtt_server.storage.type":      "bolt",
+		"mqtt_server.storage.bolt.path": path,
+	} {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+	persistent := func(opts *paho.ClientOptions) { opts.SetCleanSession(false) }
+
+	broker, stop := startTestBroker(t)
+	admin, err := connect(t, broker, "xiaozhi_server", testAdminUser, testAdminPass, persistent)
+	if err != nil {
+		t.Fatalf("管理员连接失败: %v", err)
+	}
+	admin.Subscribe(client.MServerSubTopicPrefix, 1, nil).Wait()
+	admin.Publish("retained/notice", 1, true, []byte("hello")).Wait()
+	admin.Disconnect(100)
+	stop()
+
+	// 重启后不重新订阅，恢复的会话仍能收到设备上行消息，保留消息也还在
+	broker, _ = startTestBroker(t)
+	admin, err = connect(t, broker, "xiaozhi_server", testAdminUser, testAdminPass, persistent)
+	if err != nil {
+		t.Fatalf("重启后管理员连接失败: %v", err)
+	}
+	dev, mac := connectDevice(t, broker, "aa:bb:cc:dd:ee:01", "uuid-a")
+	dev.Publish(client.MDeviceMockPubTopicPrefix, 1, false, []byte(`{"type":"hello"}`)).Wait()
+	admin.expectMessage(t, client.MDevicePubTopicPrefix+mac)
+
+	reader, err := connect(t, broker, "reader", testAdminUser, testAdminPass)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	reader.Subscribe("retained/#", 0, nil).Wait()
+	reader.expectMessage(t, "retained/notice")
+}
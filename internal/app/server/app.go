@@ -10,11 +10,14 @@ import (
 	"xiaozhi-esp32-server-golang/internal/app/mqtt_server"
 	"xiaozhi-esp32-server-golang/internal/app/server/chat"
 	"xiaozhi-esp32-server-golang/internal/app/server/mqtt_udp"
+	"xiaozhi-esp32-server-golang/internal/app/server/sip"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/app/server/webrtc"
 	"xiaozhi-esp32-server-golang/internal/app/server/websocket"
 	"xiaozhi-esp32-server-golang/internal/data/history"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/openclaw"
 	"xiaozhi-esp32-server-golang/internal/pool"
@@ -31,6 +34,7 @@ type App struct {
 	wsServer       *websocket.WebSocketServer
 	mqttUdpAdapter *mqtt_udp.MqttUdpAdapter
 	mqttUdpMu      sync.RWMutex
+	sipServer      *sip.SipServer
 
 	// ChatManager管理 - 使用concurrent map
 	chatManagers cmap.ConcurrentMap[string, *chat.ChatManager]
@@ -47,6 +51,7 @@ func NewApp() *App {
 		log.Errorf("newMqttUdpAdapter err: %+v", err)
 		return nil
 	}
+	app.sipServer = app.newSipServer()
 	return app
 }
 
@@ -67,12 +72,19 @@ func (a *App) Run() {
 	if adapter != nil {
 		go adapter.Start() // 非阻塞，连接与重试在 adapter 内部后台执行
 	}
+	if a.sipServer != nil {
+		if err := a.sipServer.Start(); err != nil {
+			log.Errorf("启动 SIP 网关失败: %v", err)
+		}
+	}
 
 	// 注册聊天相关的本地MCP工具
 	a.registerChatMCPTools()
 
 	a.registerHandler()
 
+	a.setupEventBridge()
+
 	a.initEventHandle()
 
 	// 启动资源池统计监控（每5分钟输出一次到日志）
@@ -82,6 +94,9 @@ func (a *App) Run() {
 	// 启动资源池统计上报（每5秒上报一次到 manager backend）
 	pool.StartStatsReporter(ctx)
 
+	// 启动设备定时提醒投递
+	a.startReminderScheduler(ctx)
+
 	select {} // 阻塞主线程
 }
 
@@ -118,6 +133,9 @@ func (app *App) currentMqttConfig() *mqtt_udp.MqttConfig {
 		ClientID: viper.GetString("mqtt.client_id"),
 		Username: viper.GetString("mqtt.username"),
 		Password: viper.GetString("mqtt.password"),
+		// 内置 MQTT Server 集群模式下必须共享订阅，否则每个节点上的主程序都会处理同一条上行消息
+		SharedSubscription: viper.GetBool("mqtt.shared_subscription") ||
+			(viper.GetBool("mqtt_server.enable") && viper.GetBool("mqtt_server.cluster.enable")),
 	}
 }
 
@@ -155,11 +173,57 @@ func (app *App) newUdpServer() (*mqtt_udp.UdpServer, error) {
 
 func (app *App) newWebSocketServer() *websocket.WebSocketServer {
 	port := viper.GetInt("websocket.port")
-	return websocket.NewWebSocketServer(
-		port,
+	opts := []websocket.WebSocketServerOption{
 		websocket.WithOnNewConnection(app.OnNewConnection),
 		websocket.WithOnOpenClawResponse(app.OnOpenClawResponse),
-	)
+	}
+	if path, handler := app.newMCPServerHandler(); handler != nil {
+		opts = append(opts, websocket.WithMCPServer(path, handler))
+	}
+	if webrtcServer := app.newWebRTCServer(); webrtcServer != nil {
+		path := viper.GetString("webrtc.path")
+		if path == "" {
+			path = "/xiaozhi/webrtc/v1/offer"
+		}
+		opts = append(opts, websocket.WithWebRTC(path, webrtcServer.HandleOffer))
+	}
+	return websocket.NewWebSocketServer(port, opts...)
+}
+
+// newWebRTCServer 根据 webrtc 配置创建 WebRTC 传输，未启用时返回 nil
+func (app *App) newWebRTCServer() *webrtc.WebRTCServer {
+	if !viper.GetBool("webrtc.enable") {
+		return nil
+	}
+	var config webrtc.WebRTCConfig
+	if err := viper.UnmarshalKey("webrtc", &config); err != nil {
+		log.Errorf("解析 webrtc 配置失败: %v", err)
+		return nil
+	}
+	server, err := webrtc.NewWebRTCServer(config, webrtc.WithOnNewConnection(app.OnNewConnection))
+	if err != nil {
+		log.Errorf("创建 WebRTC 服务失败: %v", err)
+		return nil
+	}
+	return server
+}
+
+// newSipServer 根据 sip 配置创建电话网关，未启用时返回 nil
+func (app *App) newSipServer() *sip.SipServer {
+	if !viper.GetBool("sip.enable") {
+		return nil
+	}
+	var config sip.SipConfig
+	if err := viper.UnmarshalKey("sip", &config); err != nil {
+		log.Errorf("解析 sip 配置失败: %v", err)
+		return nil
+	}
+	server, err := sip.NewSipServer(config, sip.WithOnNewConnection(app.OnNewConnection))
+	if err != nil {
+		log.Errorf("创建 SIP 网关失败: %v", err)
+		return nil
+	}
+	return server
 }
 
 func (app *App) startMqttServer() error {
@@ -311,6 +375,9 @@ func (a *App) OnNewConnection(transport types.IConn) {
 	// OpenClaw离线消息补发（延迟重试，避免连接刚建立时会话尚未初始化）
 	go a.replayOpenClawOfflineMessages(deviceID)
 
+	// 补发设备离线期间到期的定时提醒
+	go a.deliverRemindersOnConnect(deviceID)
+
 	// 启动ChatManager
 	go func() {
 		defer func() {
@@ -428,6 +495,8 @@ func (s *App) registerChatMCPTools() {
 }
 
 func (s *App) DeviceOnline(deviceID string) {
+	eventbus.Publish(eventbus.TopicDeviceOnline, &eventbus.DeviceEvent{DeviceID: deviceID, Timestamp: time.Now()})
+
 	eventData := map[string]interface{}{
 		"device_id": deviceID,
 	}
@@ -441,6 +510,8 @@ func (s *App) DeviceOnline(deviceID string) {
 }
 
 func (s *App) DeviceOffline(deviceID string) {
+	eventbus.Publish(eventbus.TopicDeviceOffline, &eventbus.DeviceEvent{DeviceID: deviceID, Timestamp: time.Now()})
+
 	eventData := map[string]interface{}{
 		"device_id": deviceID,
 	}
@@ -462,7 +533,17 @@ func (a *App) registerHandler() {
 		return
 	}
 	provider.RegisterMessageEventHandler(context.Background(), config_types.EventHandleMessageInject, a.HandleInjectMsg)
-	log.Infof("registerHandler: registered paths=[%s]", config_types.EventHandleMessageInject)
+	provider.RegisterMessageEventHandler(context.Background(), config_types.EventHandleMqttClients, a.HandleMqttClients)
+	log.Infof("registerHandler: registered paths=[%s %s]", config_types.EventHandleMessageInject, config_types.EventHandleMqttClients)
+}
+
+// HandleMqttClients 返回本节点内置 MQTT 服务器的客户端列表（JSON）
+func (a *App) HandleMqttClients(ctx context.Context, eventType string, eventData map[string]interface{}) (string, error) {
+	data, err := json.Marshal(mqtt_server.ListClients())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // 向客户端注入消息
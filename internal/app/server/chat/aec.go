@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// ensureEchoCanceller 按拾音模式初始化或关闭回声消除：只有 realtime 模式（边播边听）且单声道输入时启用
+func (s *ChatSession) ensureEchoCanceller() {
+	state := s.clientState
+	if !viper.GetBool("chat.aec.enable") || !state.IsRealTime() {
+		state.SetEchoCanceller(nil)
+		return
+	}
+	if state.InputAudioFormat.Channels != 1 {
+		log.Warnf("设备 %s 输入音频为 %d 声道，回声消除只支持单声道，跳过", state.DeviceID, state.InputAudioFormat.Channels)
+		state.SetEchoCanceller(nil)
+		return
+	}
+	if c := state.EchoCanceller(); c != nil && c.SampleRate() == state.InputAudioFormat.SampleRate {
+		return
+	}
+	state.SetEchoCanceller(aec.New(aec.Config{
+		SampleRate:      state.InputAudioFormat.SampleRate,
+		TailMs:          viper.GetInt("chat.aec.tail_ms"),
+		MaxDelayMs:      viper.GetInt("chat.aec.max_delay_ms"),
+		StepSize:        viper.GetFloat64("chat.aec.step_size"),
+		SuppressDB:      viper.GetFloat64("chat.aec.suppress_db"),
+		NearEndMarginDB: viper.GetFloat64("chat.aec.near_end_margin_db"),
+		CouplingDB:      viper.GetFloat64("chat.aec.coupling_db"),
+	}))
+	log.Debugf("设备 %s 启用回声消除, sampleRate: %d", state.DeviceID, state.InputAudioFormat.SampleRate)
+}
+
+// pushEchoReference 把刚下发的 TTS 帧解码后作为回声消除参考信号，playAt 为该帧在设备端的计划播放时间
+func (t *TTSManager) pushEchoReference(frame []byte, playAt time.Time) {
+	canceller := t.clientState.EchoCanceller()
+	if canceller == nil {
+		return
+	}
+	format := t.clientState.OutputAudioFormat
+	if t.echoRefDecoder == nil {
+		decoder, err := audio.GetAudioProcesser(format.SampleRate, format.Channels, format.FrameDuration)
+		if err != nil {
+			log.Errorf("创建回声消除参考信号解码器失败: %v", err)
+			return
+		}
+		t.echoRefDecoder = decoder
+		// 最大帧时长 120ms
+		t.echoRefPcm = make([]float32, format.SampleRate*format.Channels*120/1000)
+	}
+	n, err := t.echoRefDecoder.DecoderFloat32(frame, t.echoRefPcm)
+	if err != nil {
+		log.Debugf("解码回声消除参考信号失败: %v", err)
+		return
+	}
+	pcm := t.echoRefPcm[:n*format.Channels]
+	if format.Channels > 1 {
+		// 多声道下混为单声道
+		mono := make([]float32, n)
+		for i := range mono {
+			var sum float32
+			for ch := 0; ch < format.Channels; ch++ {
+				sum += pcm[i*format.Channels+ch]
+			}
+			mono[i] = sum / float32(format.Channels)
+		}
+		pcm = mono
+	}
+	canceller.PushReference(pcm, format.SampleRate, playAt)
+}
@@ -11,6 +11,7 @@ import (
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	"xiaozhi-esp32-server-golang/internal/domain/asr"
 	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
 	"xiaozhi-esp32-server-golang/internal/domain/speaker"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/inter"
 	"xiaozhi-esp32-server-golang/internal/pool"
@@ -179,6 +180,13 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 				var vadPcmData []float32
 				pcmData := pcmFrame[:n]
 
+				// 回声消除：在 VAD/ASR 之前去除设备播放的 TTS 回声
+				var echoResult aec.Result
+				if canceller := state.EchoCanceller(); canceller != nil {
+					echoResult = canceller.Process(pcmData, time.Now())
+					pcmData = echoResult.Output
+				}
+
 				// 检查帧大小是否一致（正常情况下应该一致，但不一致时使用实际值）
 				if n != frameSize {
 					log.Debugf("帧大小不一致: 期望=%d, 实际=%d，使用实际值", frameSize, n)
@@ -223,9 +231,17 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 							log.Errorf("processAsrAudio VAD检测失败: %v", err)
 							continue
 						}
+						// 播放期间只有判定为近端语音的帧才算有声，避免自身回声触发打断
+						if haveVoice && echoResult.PlaybackActive && !echoResult.NearEnd {
+							haveVoice = false
+						}
 
 						//首次触发识别到语音时,为了语音数据完整性 将vadPcmData赋值给pcmData, 之后的音频数据全部进入asr
 						if haveVoice && !clientHaveVoice {
+							// 新的一句话开始，清空上一句的部分识别结果
+							if detector := state.Endpointer(); detector != nil {
+								detector.Reset()
+							}
 							//首次检测到语音时，最多只保留200ms的前静音数据
 							allData := state.AsrAudioBuffer.GetAndClearAllData()
 							pcmData = allData
@@ -262,6 +278,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 						if !hasTriggeredCancel {
 							//realtime模式下, 如果此时有正在进行的llm和tts则取消掉
 							log.Debugf("realtime模式vad打断下 && 语音时长超过%d ms 如果此时有正在进行的llm和tts则取消掉", continuousVoiceDuration)
+							state.Conversation.Interrupt("realtime_vad")
 							state.AfterAsrSessionCtx.Cancel()
 							if a.session != nil {
 								a.session.InterruptAndClearTTSQueue()
@@ -323,7 +340,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					}
 
 					idleDuration := state.Vad.GetIdleDuration()
-					if state.IsSilence(idleDuration) { //从有声音到 静默的判断
+					if state.IsEndOfUtterance(idleDuration) { //从有声音到 静默的判断
 						// 在 OnVoiceSilence 之前重置标志位，以便下次可以再次触发
 						hasTriggeredCancel = false
 						state.OnVoiceSilence()
@@ -477,13 +494,18 @@ func (a *ASRManager) StartAsrRecognitionLoop(
 			}
 
 			//统计asr耗时
-			log.Debugf("处理asr结果: %s, 耗时: %d ms", text, state.GetAsrDuration())
+			log.Debugf("处理asr结果: %s, 耗时: %d ms, turnID: %s", text, state.GetAsrDuration(), state.TurnID())
 
 			if text != "" {
 				// 识别成功后重置空结果计数
 				emptyResultWindowStart = time.Now()
 				emptyResultCount = 0
 
+				// auto 语言模式下按本轮识别结果切换对话语言
+				if previousLanguage, language := state.UpdateLanguage(state.Asr.DetectedLanguage, text); language != previousLanguage {
+					log.Infof("设备 %s 对话语言切换: %s -> %s", state.DeviceID, previousLanguage, language)
+				}
+
 				// 创建用户消息
 				userMsg := &schema.Message{
 					Role:    schema.User,
@@ -515,6 +537,7 @@ func (a *ASRManager) StartAsrRecognitionLoop(
 				//如果是realtime模式下，需要停止 当前的llm和tts
 				if state.IsRealTime() && viper.GetInt("chat.realtime_mode") == 2 {
 					log.Debugf("OnListenStart realtime模式下, 停止当前的llm和tts")
+					state.Conversation.Interrupt("realtime_asr_final")
 					state.AfterAsrSessionCtx.Cancel()
 					if a.session != nil {
 						a.session.InterruptAndClearTTSQueue()
@@ -589,14 +612,10 @@ func (a *ASRManager) StartAsrRecognitionLoop(
 				default:
 				}
 
-				log.Debugf("ready Restart Asr, state.Status: %s", state.Status)
-				// realtime 模式下，即使状态是 LLMStart 或 TTSStart，也应该继续监听（允许重启ASR）
-				// 非 realtime 模式下，只有 Listening 或 ListenStop 状态才允许重启ASR
-				isAllowedToRestart := state.Status == ClientStatusListening || state.Status == ClientStatusListenStop
-				if state.IsRealTime() {
-					// realtime 模式下，除了 Init 状态外，都允许重启（因为需要持续监听）
-					isAllowedToRestart = state.Status != ClientStatusInit
-				}
+				conversationState := state.GetState()
+				log.Debugf("ready Restart Asr, state: %s", conversationState)
+				// realtime 模式下，即使在思考或播报中，也应该继续监听（允许重启ASR）
+				isAllowedToRestart := AsrRestartAllowed(conversationState, state.IsRealTime())
 
 				if isAllowedToRestart {
 					// 状态允许重启，重置等待计数
@@ -625,11 +644,11 @@ func (a *ASRManager) StartAsrRecognitionLoop(
 					invalidStatusWaitCount++
 					if invalidStatusWaitCount >= maxInvalidStatusWaitCount {
 						// 等待超时，退出循环
-						log.Debugf("状态为 %s，realtime: %v，等待%d次后仍无变化，退出ASR识别循环", state.Status, state.IsRealTime(), maxInvalidStatusWaitCount)
+						log.Debugf("状态为 %s，realtime: %v，等待%d次后仍无变化，退出ASR识别循环", conversationState, state.IsRealTime(), maxInvalidStatusWaitCount)
 						return
 					}
 					// 短暂等待后继续循环，等待状态恢复
-					log.Debugf("状态为 %s，realtime: %v，不允许重启，等待状态恢复 (等待次数: %d/%d)", state.Status, state.IsRealTime(), invalidStatusWaitCount, maxInvalidStatusWaitCount)
+					log.Debugf("状态为 %s，realtime: %v，不允许重启，等待状态恢复 (等待次数: %d/%d)", conversationState, state.IsRealTime(), invalidStatusWaitCount, maxInvalidStatusWaitCount)
 					time.Sleep(200 * time.Millisecond) // 等待100ms
 					continue
 				}
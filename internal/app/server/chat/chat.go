@@ -99,7 +99,6 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 	clientState := &ClientState{
 		IsActivated:       isDeviceActivated,
 		Dialogue:          &Dialogue{},
-		Abort:             false,
 		ListenMode:        "auto",
 		DeviceID:          deviceID,
 		AgentID:           deviceConfig.AgentId,
@@ -122,6 +121,7 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 		SessionCtx: Ctx{},
 	}
 	applyOutputAudioFormatForTTS(clientState)
+	clientState.SetEndpointer(newEndpointer(deviceConfig))
 
 	return clientState, nil
 }
@@ -158,6 +158,7 @@ func (c *ChatManager) ReloadDeviceConfig(ctx context.Context) error {
 	c.clientState.AgentID = deviceConfig.AgentId
 	c.clientState.DeviceConfig = deviceConfig
 	c.clientState.SystemPrompt = deviceConfig.SystemPrompt
+	c.clientState.SetEndpointer(newEndpointer(deviceConfig))
 	// 切换角色后清空声纹临时TTS配置，避免旧配置污染
 	c.clientState.SpeakerTTSConfig = nil
 	// OpenClaw模式状态由 openclaw manager 按 agent session 维护，配置刷新时主动退出模式。
@@ -201,7 +202,7 @@ func (c *ChatManager) OnClose(deviceId string) {
 	log.Infof("设备 %s 断开连接", deviceId)
 	c.cancel()
 	if c.clientState != nil {
-		eventbus.Get().Publish(eventbus.TopicSessionEnd, c.clientState)
+		eventbus.Publish(eventbus.TopicSessionEnd, c.clientState)
 	}
 	return
 }
@@ -1,6 +1,7 @@
 package chat
 
 func (s *ChatSession) StopSpeaking(isSendTtsStop bool) {
+	s.clientState.Conversation.Interrupt("stop_speaking")
 	s.clientState.SessionCtx.Cancel()
 	s.clientState.AfterAsrSessionCtx.Cancel()
 
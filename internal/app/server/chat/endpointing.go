@@ -0,0 +1,23 @@
+package chat
+
+import (
+	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/endpointing"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// newEndpointer 按智能体的断句档位（asr_speed）创建自适应断句检测器，未启用 chat.endpointing 时返回 nil（使用固定静音阈值）
+func newEndpointer(deviceConfig utypes.UConfig) *endpointing.Detector {
+	if !viper.GetBool("chat.endpointing.enable") {
+		return nil
+	}
+	var overrides map[string]endpointing.Profile
+	if err := viper.UnmarshalKey("chat.endpointing.profiles", &overrides); err != nil {
+		log.Warnf("解析 chat.endpointing.profiles 失败，使用内置档位: %v", err)
+		overrides = nil
+	}
+	profile := endpointing.ResolveProfile(deviceConfig.AsrSpeed, overrides)
+	return endpointing.NewDetector(profile, endpointing.GetClassifier(viper.GetString("chat.endpointing.classifier")))
+}
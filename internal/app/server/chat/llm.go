@@ -16,6 +16,7 @@ import (
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
@@ -28,6 +29,7 @@ import (
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
 )
 
 const (
@@ -43,6 +45,7 @@ type contextKey int
 const (
 	ttsStopDelayDuration time.Duration = 200 * time.Millisecond
 	fullTextKey          contextKey    = iota
+	toolRoundKey                       // 本轮对话已进行的工具调用轮数
 )
 
 const (
@@ -87,6 +90,9 @@ type LLMManager struct {
 	// key: role (user/assistant), value: MessageID
 	lastMessageID   map[string]string
 	lastMessageIDMu sync.RWMutex // 保护 lastMessageID 的并发访问
+
+	// 等待用户语音确认的敏感工具调用
+	toolConfirm toolConfirmState
 }
 
 func NewLLMManager(clientState *ClientState, serverTransport *ServerTransport, ttsManager *TTSManager) *LLMManager {
@@ -240,9 +246,11 @@ func (l *LLMManager) handleLLMResponseChannelAsync(ctx context.Context, userMess
 			l.ttsManager.EnqueueTtsStart(ctx)
 		}
 		onEndFunc = func(err error, args ...any) {
-			// 非 realtime 模式下，由 runSenderLoop 统一发送 TtsStop
+			// 非 realtime 模式下，由 runSenderLoop 统一发送 TtsStop；realtime 模式不发 TtsStop，本轮结束时单独结束备用TTS保持
 			if !l.clientState.IsRealTime() {
 				l.ttsManager.EnqueueTtsStop(ctx)
+			} else {
+				l.ttsManager.resetTTSFallback()
 			}
 
 			// 从 closure 中获取 fullText
@@ -267,8 +275,9 @@ func (l *LLMManager) handleLLMResponseChannelAsync(ctx context.Context, userMess
 
 				// 发布事件：第二阶段（更新音频）
 				assistantMsg := schema.AssistantMessage(strFullText, nil)
-				eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+				eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
 					ClientState: l.clientState,
+					TurnID:      l.clientState.TurnID(),
 					Msg:         *assistantMsg,
 					MessageID:   messageID,
 					AudioData:   audioData, // 第二阶段：有音频
@@ -340,6 +349,8 @@ func (l *LLMManager) HandleLLMResponseChannelSync(ctx context.Context, userMessa
 	if needSendTtsCmd {
 		if !l.clientState.IsRealTime() {
 			l.ttsManager.EnqueueTtsStop(ctx)
+		} else {
+			l.ttsManager.resetTTSFallback()
 		}
 
 		// 收集TTS音频并发送聊天历史事件
@@ -365,8 +376,9 @@ func (l *LLMManager) HandleLLMResponseChannelSync(ctx context.Context, userMessa
 
 			// 发布事件：第二阶段（更新音频）
 			assistantMsg := schema.AssistantMessage(fullText.String(), nil)
-			eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+			eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
 				ClientState: l.clientState,
+				TurnID:      l.clientState.TurnID(),
 				Msg:         *assistantMsg,
 				MessageID:   messageID,
 				AudioData:   audioData, // 第二阶段：有音频
@@ -498,6 +510,8 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 						lctx := context.WithValue(ctx, "nest", 2)
 						// 将 fullText 传递到新的 context（toolCalls 直接作为参数传递）
 						lctx = context.WithValue(lctx, fullTextKey, fullText)
+						// 记录连续工具调用轮数，防止模型反复调用工具
+						lctx = context.WithValue(lctx, toolRoundKey, toolRoundFromContext(ctx)+1)
 						invokeToolSuccess, err := l.handleToolCallResponse(lctx, userMessage, schema.AssistantMessage(fullText.String(), toolCalls), toolCalls)
 						if err != nil {
 							log.Errorf("处理工具调用响应失败: %v", err)
@@ -532,7 +546,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 
 	state := l.clientState
 
-	log.Infof("处理 %d 个工具调用", len(tools))
+	log.Infof("处理 %d 个工具调用, turnID: %s", len(tools), state.TurnID())
 
 	var invokeToolSuccess bool
 
@@ -557,34 +571,57 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 		messageList = append(messageList, respMsg)
 	}
 
-	addMessageFunc := func(toolCall schema.ToolCall, result string) {
+	addMessageFunc := func(toolCall schema.ToolCall, result string) *schema.Message {
 		toolResultMsg := &schema.Message{
 			Role:       schema.Tool,
 			ToolCallID: toolCall.ID,
 			Content:    result,
 		}
+		// 用户确认后执行的调用，结果消息附带确认记录
+		if approved, ok := approvedToolCallFromContext(ctx, toolCall.ID); ok {
+			toolResultMsg.Extra = toolConfirmExtra(approved.record)
+		}
 		messageList = append(messageList, toolResultMsg)
+		return toolResultMsg
 	}
 
 	var findExitTool bool
 
-	for _, toolCall := range tools {
+	policy := loadToolCallPolicy()
+	if round := toolRoundFromContext(ctx); policy.MaxRounds > 0 && round > policy.MaxRounds {
+		// 模型反复调用工具，不再执行，要求其根据已有信息直接回答
+		log.Warnf("工具调用已连续 %d 轮，超过上限 %d，停止执行工具, turnID: %s", round-1, policy.MaxRounds, state.TurnID())
+		for _, toolCall := range tools {
+			addMessageFunc(toolCall, fmt.Sprintf("工具调用次数已达上限（%d 轮），请不要再调用工具，根据已有信息直接回答用户", policy.MaxRounds))
+			l.publishToolCall(toolCall, "", "工具调用轮数超过上限", 0)
+		}
+		l.saveToolCallMessages(ctx, messageList)
+		l.DoLLmRequest(ctx, nil, nil, true, nil)
+		return true, nil
+	}
+
+	// 按 allow / confirm / deny 策略过滤，需要确认的调用本轮只询问不执行
+	tools, confirmQuestion := l.gateToolCalls(ctx, tools, l.lookupTool, addMessageFunc)
+
+	for _, callResult := range l.executeToolCalls(toolCtx, tools, policy) {
+		toolCall := callResult.call
 		toolName := toolCall.Function.Name
-		tool, ok := mcp.GetToolByName(state.DeviceID, state.AgentID, toolName, state.DeviceConfig.MCPServiceNames)
-		if !ok || tool == nil {
+		tool := callResult.tool
+		if tool == nil {
 			log.Errorf("未找到工具: %s", toolName)
 			addMessageFunc(toolCall, fmt.Sprintf("未找到工具: %s", toolName))
+			l.publishToolCall(toolCall, "", "未找到工具", 0)
 			continue
 		}
-		log.Infof("进行工具调用请求: %s, 参数: %+v", toolName, toolCall.Function.Arguments)
-		startTs := time.Now().UnixMilli()
-		fcResult, err := tool.InvokableRun(toolCtx, toolCall.Function.Arguments)
-		if err != nil {
+		log.Infof("工具调用完成: %s, 参数: %+v, 尝试次数: %d", toolName, toolCall.Function.Arguments, callResult.attempts)
+		if err := callResult.err; err != nil {
 			log.Errorf("工具调用失败: %v", err)
 			addMessageFunc(toolCall, fmt.Sprintf("工具 %s 调用失败: %v", toolName, err))
+			l.publishToolCall(toolCall, "", err.Error(), callResult.duration)
 			continue
 		}
-		costTs := time.Now().UnixMilli() - startTs
+		fcResult := callResult.output
+		costTs := callResult.duration.Milliseconds()
 		invokeToolSuccess = true
 		if len(fcResult) > 2048 {
 			log.Infof("工具调用结果 len: %d, 耗时: %dms", len(fcResult), costTs)
@@ -647,26 +684,18 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 				result = mcpContent
 			}
 		}
+		result = l.fitToolResult(ctx, toolName, result, policy)
 		addMessageFunc(toolCall, result)
+		l.publishToolCall(toolCall, result, "", callResult.duration)
 	}
 
-	if len(messageList) > 0 {
-		for _, msg := range messageList {
-			// 过滤掉Content为空的assistant消息，避免保存到历史记录中
-			// 空的assistant消息会导致后续LLM调用时出现400错误
-			if msg != nil && msg.Role == schema.Assistant && msg.Content == "" && len(msg.ToolCalls) == 0 {
-				log.Debugf("跳过保存空的assistant消息")
-				continue
-			}
-			l.AddLlmMessage(ctx, msg)
-		}
-	}
+	l.saveToolCallMessages(ctx, messageList)
 
 	wg.Wait()
 
 	if findExitTool {
 		// 发布退出聊天事件
-		eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
+		eventbus.Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
 			ClientState: l.clientState,
 			Reason:      "工具调用退出",
 			TriggerType: "tool_call",
@@ -677,6 +706,12 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 		return invokeToolSuccess, nil
 	}
 
+	if confirmQuestion != "" {
+		// 等用户回答后再执行，见 HandleToolConfirmAnswer
+		l.askToolConfirm(ctx, confirmQuestion)
+		return true, nil
+	}
+
 	// 如果工具调用成功且没有被标记为停止处理，则继续LLM调用
 	if invokeToolSuccess && !shouldStopLLMProcessing {
 		l.DoLLmRequest(ctx, nil, l.einoTools, true, nil)
@@ -685,6 +720,34 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 	return invokeToolSuccess, nil
 }
 
+// saveToolCallMessages 保存工具调用的助手消息与工具结果消息
+func (l *LLMManager) saveToolCallMessages(ctx context.Context, messageList []*schema.Message) {
+	for _, msg := range messageList {
+		// 过滤掉Content为空的assistant消息，避免保存到历史记录中
+		// 空的assistant消息会导致后续LLM调用时出现400错误
+		if msg != nil && msg.Role == schema.Assistant && msg.Content == "" && len(msg.ToolCalls) == 0 {
+			log.Debugf("跳过保存空的assistant消息")
+			continue
+		}
+		l.AddLlmMessage(ctx, msg)
+	}
+}
+
+// publishToolCall 发布工具调用事件
+func (l *LLMManager) publishToolCall(toolCall schema.ToolCall, result string, errMsg string, duration time.Duration) {
+	eventbus.Publish(eventbus.TopicToolCall, &eventbus.ToolCallEvent{
+		ClientState: l.clientState,
+		TurnID:      l.clientState.TurnID(),
+		ToolCallID:  toolCall.ID,
+		ToolName:    toolCall.Function.Name,
+		Arguments:   toolCall.Function.Arguments,
+		Result:      result,
+		Error:       errMsg,
+		Duration:    duration,
+		Timestamp:   time.Now(),
+	})
+}
+
 func (l *LLMManager) handleResourceLink(ctx context.Context, resourceLink mcp_go.ResourceLink, toolCall tool.InvokableTool, wg *sync.WaitGroup) error {
 	wg.Add(1)
 	//从resourceLink中获取资源
@@ -1041,14 +1104,14 @@ func (l *LLMManager) handleLLMWithContextAndTools(
 }
 
 func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Message, einoTools []*schema.ToolInfo, isSync bool, speakerResult *speaker.IdentifyResult) error {
-	log.Debugf("发送带工具的 LLM 请求, seesionID: %s, requestEinoMessages: %+v", l.clientState.SessionID, userMessage)
+	log.Debugf("发送带工具的 LLM 请求, seesionID: %s, turnID: %s, requestEinoMessages: %+v", l.clientState.SessionID, l.clientState.TurnID(), userMessage)
 	clientState := l.clientState
 
 	l.einoTools = einoTools
 
 	//组装历史消息和当前用户的消息
 	requestMessages := l.GetMessages(ctx, userMessage, MaxMessageCount, speakerResult)
-	clientState.SetStatus(ClientStatusLLMStart)
+	clientState.SetState(StateThinking, "llm_request")
 
 	// 调用内部方法处理 LLM 响应，资源在方法内部管理
 	responseSentences, err := l.handleLLMWithContextAndTools(
@@ -1105,8 +1168,9 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 
 	// Tool 角色消息：直接保存，不涉及两阶段保存（无音频）
 	if msg.Role == schema.Tool {
-		eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+		eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
 			ClientState: l.clientState,
+			TurnID:      l.clientState.TurnID(),
 			Msg:         *msg,
 			MessageID:   messageID,
 			AudioData:   nil, // Tool 角色无音频
@@ -1128,8 +1192,9 @@ func (l *LLMManager) AddMessage(ctx context.Context, msg *schema.Message) error
 	}
 
 	// 发布事件：第一阶段（仅文本，无音频）
-	eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+	eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
 		ClientState: l.clientState,
+		TurnID:      l.clientState.TurnID(),
 		Msg:         *msg,
 		MessageID:   messageID,
 		AudioData:   nil, // 第一阶段：无音频
@@ -1164,9 +1229,9 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 	// 构建 system prompt
 	systemPrompt := l.clientState.SystemPrompt
 
-	// 添加当前时间和日期信息
-	now := time.Now()
-	systemPrompt += fmt.Sprintf("\n当前时间和日期: %s %s", now.Format("2006年01月02日 15:04:05"), now.Format("Monday"))
+	// 添加当前时间和日期信息（按对话语言格式化）
+	language := l.clientState.GetLanguage()
+	systemPrompt += fmt.Sprintf("\n%s: %s", i18n.DateTimeLabel(language), i18n.FormatDateTime(time.Now(), language))
 
 	if memoryMode == MemoryModeLong && l.clientState.MemoryContext != "" {
 		systemPrompt += fmt.Sprintf("\n用户个性化信息: \n%s", l.clientState.MemoryContext)
@@ -1201,6 +1266,12 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 	}
 
 	systemPrompt += buildKnowledgeSearchRoutingPolicy(l.clientState.DeviceConfig.KnowledgeBases)
+	systemPrompt += buildMCPResourceContext(ctx, l.clientState.DeviceConfig.MCPResources, l.readMCPResource)
+
+	// 非默认中文或 auto 模式时明确要求回复语言
+	if i18n.NormalizeSetting(l.clientState.DeviceConfig.Language) != i18n.DefaultLanguage {
+		systemPrompt += "\n" + i18n.ReplyInstruction(language)
+	}
 
 	retMessage := make([]*schema.Message, 0)
 	retMessage = append(retMessage, &schema.Message{
@@ -1238,6 +1309,48 @@ func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Messag
 	return retMessage
 }
 
+// readMCPResource 读取智能体挂载的 MCP 资源，正文有缓存，仅首次或资源变更后访问 MCP 服务器
+func (l *LLMManager) readMCPResource(ctx context.Context, ref config_types.MCPResourceRef) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, mcpResourceReadTimeout())
+	defer cancel()
+	return mcp.ReadResourceText(ctx, l.clientState.AgentID, l.clientState.DeviceID, ref.Source, ref.Server, ref.URI)
+}
+
+func mcpResourceReadTimeout() time.Duration {
+	if timeout := viper.GetDuration("mcp.resources.read_timeout"); timeout > 0 {
+		return timeout
+	}
+	return 3 * time.Second
+}
+
+// buildMCPResourceContext 把挂载资源的正文拼成参考资料段落，读取失败的资源跳过，不影响对话
+func buildMCPResourceContext(ctx context.Context, refs []config_types.MCPResourceRef, read func(context.Context, config_types.MCPResourceRef) (string, error)) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, ref := range refs {
+		text, err := read(ctx, ref)
+		if err != nil {
+			log.Warnf("读取挂载的MCP资源失败: source=%s server=%s uri=%s err=%v", ref.Source, ref.Server, ref.URI, err)
+			continue
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		title := strings.TrimSpace(ref.Name)
+		if title == "" {
+			title = ref.URI
+		}
+		sb.WriteString(fmt.Sprintf("\n【%s】\n%s\n", title, text))
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "\n参考资料（回答时遵循其中的约定）:" + sb.String()
+}
+
 func buildKnowledgeSearchRoutingPolicy(knowledgeBases []config_types.KnowledgeBaseRef) string {
 	if len(knowledgeBases) == 0 {
 		return ""
@@ -1,8 +1,13 @@
 package chat
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
 )
 
@@ -53,3 +58,31 @@ func TestHandleToolResultAcceptsMCPJSON(t *testing.T) {
 		t.Fatalf("expected parsed text content, got %q", textContent.Text)
 	}
 }
+
+func TestBuildMCPResourceContextSkipsFailedResources(t *testing.T) {
+	refs := []config_types.MCPResourceRef{
+		{Source: "global", Server: "docs", URI: "file:///rules.md", Name: "家规"},
+		{Source: "agent", URI: "memo://missing"},
+		{Source: "global", Server: "docs", URI: "file:///empty.md"},
+	}
+	read := func(_ context.Context, ref config_types.MCPResourceRef) (string, error) {
+		switch ref.URI {
+		case "file:///rules.md":
+			return "晚上九点后不播放音乐", nil
+		case "file:///empty.md":
+			return "  ", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	got := buildMCPResourceContext(context.Background(), refs, read)
+	if !strings.Contains(got, "【家规】\n晚上九点后不播放音乐") {
+		t.Fatalf("context = %q", got)
+	}
+	if strings.Contains(got, "memo://missing") || strings.Contains(got, "empty.md") {
+		t.Fatalf("failed or empty resources should be skipped: %q", got)
+	}
+	if buildMCPResourceContext(context.Background(), refs[1:2], read) != "" {
+		t.Fatal("expected empty context when no resource is readable")
+	}
+}
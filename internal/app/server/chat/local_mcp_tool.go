@@ -9,7 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/data/reminder"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	mcp_manager "xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/rag"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	//"github.com/scroot/music-sd/pkg/netease"
@@ -31,12 +34,12 @@ func InitChatLocalMCPTools() {
 	log.Info("初始化聊天相关的本地MCP工具...")
 
 	localTools := map[string]LocalMcpTool{
-		/*"get_current_datetime": {
+		"get_current_datetime": {
 			Name:        "get_current_datetime",
-			Description: "获取当前时间和日期信息",
-			Params:      struct{}{},
+			Description: "获取当前时间和日期信息，可选传入 IANA 时区（如 Asia/Tokyo）查询其它地区的当前时间",
+			Params:      GetCurrentDateTimeParams{},
 			Handle:      getCurrentDateTimeHandler,
-		},*/
+		},
 		"exit_conversation": {
 			Name:        "exit_conversation",
 			Description: "当用户明确表示要结束对话、退出系统或告别时使用，用于优雅地关闭当前聊天会话",
@@ -67,6 +70,24 @@ func InitChatLocalMCPTools() {
 			Params:      SearchKnowledgeParams{},
 			Handle:      searchKnowledgeHandler,
 		},
+		"create_reminder": {
+			Name:        "create_reminder",
+			Description: "当用户要求在某个时间提醒他做某事时使用（如“20分钟后提醒我关火”“每天晚上8点提醒我吃药”），到点后设备会主动播报提醒内容；delay_minutes、run_at、cron 三选一，一次性相对时间用 delay_minutes，指定时刻用 run_at，周期提醒用 cron",
+			Params:      CreateReminderParams{},
+			Handle:      createReminderHandler,
+		},
+		"list_reminders": {
+			Name:        "list_reminders",
+			Description: "当用户询问当前设置了哪些提醒时使用，返回当前设备待执行的提醒列表（包含提醒ID）",
+			Params:      struct{}{},
+			Handle:      listRemindersHandler,
+		},
+		"cancel_reminder": {
+			Name:        "cancel_reminder",
+			Description: "当用户要求取消某个提醒时使用，需要先通过 list_reminders 获取提醒ID",
+			Params:      CancelReminderParams{},
+			Handle:      cancelReminderHandler,
+		},
 		/*"play_music": {
 			Name:        "play_music",
 			Description: "当用户想听歌、无聊时、想放空大脑时使用，用于播放指定名称的音乐，当用户想随便听一首音乐时请推荐出具体的歌曲名称，当有多个音乐播放工具时优先使用此工具，**此工具调用耗时较长，需要先返回友好的过渡性提示语**",
@@ -75,6 +96,13 @@ func InitChatLocalMCPTools() {
 		},*/
 	}
 
+	// 提醒存储在 manager，非 manager 模式下不注册提醒工具
+	if !reminder.Enabled() {
+		delete(localTools, "create_reminder")
+		delete(localTools, "list_reminders")
+		delete(localTools, "cancel_reminder")
+	}
+
 	for toolName, localTool := range localTools {
 		// 只有当配置明确设为false时才跳过，配置不存在或为true时都启用
 		if viper.IsSet("local_mcp."+toolName) && !viper.GetBool("local_mcp."+toolName) {
@@ -120,6 +148,17 @@ type SearchKnowledgeParams struct {
 	KnowledgeBaseIDs []uint `json:"knowledge_base_ids,omitempty" description:"可选：仅在这些知识库ID内检索（当前智能体已关联）"`
 }
 
+type CreateReminderParams struct {
+	Message      string `json:"message" description:"到点后要播报的提醒内容，如“该吃药了”" required:"true"`
+	DelayMinutes int    `json:"delay_minutes,omitempty" description:"多少分钟后提醒，用于“20分钟后提醒我”这类相对时间"`
+	RunAt        string `json:"run_at,omitempty" description:"指定提醒时刻（本地时间），格式 HH:MM（今天或明天最近的该时刻）或 YYYY-MM-DD HH:MM"`
+	Cron         string `json:"cron,omitempty" description:"周期提醒的5段cron表达式（分 时 日 月 周），如每天20点为 0 20 * * *，工作日早上8点半为 30 8 * * 1-5"`
+}
+
+type CancelReminderParams struct {
+	ReminderID uint `json:"reminder_id" description:"要取消的提醒ID（通过 list_reminders 获取）" required:"true"`
+}
+
 // playMusicHandler 播放音乐的处理函数
 func playMusicHandler(ctx context.Context, argumentsInJSON string) (string, error) {
 	log.Info("执行播放音乐工具")
@@ -149,40 +188,45 @@ func playMusicHandler(ctx context.Context, argumentsInJSON string) (string, erro
 
 }
 
-/*
-// getCurrentDateTimeHandler 获取当前时间和日期的处理函数
+// GetCurrentDateTimeParams 获取当前时间的参数
+type GetCurrentDateTimeParams struct {
+	Timezone string `json:"timezone,omitempty" description:"IANA 时区名称，例如 Asia/Shanghai、America/New_York，留空使用服务器本地时区"`
+}
+
+// getCurrentDateTimeHandler 获取当前时间和日期的处理函数，按当前对话语言格式化
 func getCurrentDateTimeHandler(ctx context.Context, argumentsInJSON string) (string, error) {
 	log.Info("执行获取当前时间日期工具")
 
-	// 解析参数
-	var params map[string]interface{}
-	timezone := "Local" // 默认时区
-
+	var params GetCurrentDateTimeParams
 	if argumentsInJSON != "" {
-		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err == nil {
-			if tz, ok := params["timezone"].(string); ok && tz != "" {
-				timezone = tz
-			}
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			log.Warnf("解析获取时间参数失败: %v", err)
 		}
 	}
 
-	now := time.Now()
+	language := i18n.DefaultLanguage
+	if chatSessionOperator, err := getChatSessionOperator(ctx); err == nil {
+		language = chatSessionOperator.LocalMcpGetLanguage()
+	}
 
-	// 尝试解析指定的时区
-	if timezone != "Local" {
+	now := time.Now()
+	timezone := strings.TrimSpace(params.Timezone)
+	if timezone != "" {
 		if loc, err := time.LoadLocation(timezone); err == nil {
 			now = now.In(loc)
 		} else {
 			log.Warnf("无法加载时区 %s，使用本地时区", timezone)
+			timezone = ""
 		}
 	}
 
-	// 构造返回数据
+	formatted := i18n.FormatDateTime(now, language)
 	data := map[string]interface{}{
 		"datetime": map[string]interface{}{
 			"formatted":     now.Format("2006-01-02 15:04:05"),
 			"iso8601":       now.Format(time.RFC3339),
-			"chinese":       formatChineseDateTime(now),
+			"localized":     formatted,
+			"language":      language,
 			"unix":          now.Unix(),
 			"year":          now.Year(),
 			"month":         int(now.Month()),
@@ -190,23 +234,17 @@ func getCurrentDateTimeHandler(ctx context.Context, argumentsInJSON string) (str
 			"hour":          now.Hour(),
 			"minute":        now.Minute(),
 			"second":        now.Second(),
-			"weekday":       now.Weekday().String(),
-			"weekday_zh":    getWeekdayChinese(now.Weekday()),
+			"weekday":       i18n.Weekday(now.Weekday(), language),
 			"week_number":   getWeekNumber(now),
-			"timezone":      timezone,
 			"timezone_name": now.Location().String(),
 		},
 	}
 
-	// 创建内容类响应
-	response := NewContentResponse("get_current_datetime", data, fmt.Sprintf("当前时间：%s", formatChineseDateTime(now)))
-	// response.Format = "datetime"
-	// response.DisplayHint = "可用于显示当前日期时间信息"
-
+	response := NewContentResponse("get_current_datetime", data, fmt.Sprintf("%s: %s", i18n.DateTimeLabel(language), formatted))
 	log.Infof("获取当前时间日期成功: %s", now.Format("2006-01-02 15:04:05"))
-	return response.ToJSON(),nil
+	return response.ToJSON()
 }
-*/
+
 // exitConversationHandler 退出对话的处理函数
 func exitConversationHandler(ctx context.Context, argumentsInJSON string) (string, error) {
 	log.Info("执行退出对话工具")
@@ -406,6 +444,8 @@ func searchKnowledgeHandler(ctx context.Context, argumentsInJSON string) (string
 		response := NewErrorResponse("search_knowledge", fmt.Sprintf("信息检索失败: %v", err), "SEARCH_FAILED", "请稍后重试")
 		return response.ToJSON()
 	}
+	// 控制注入到工具结果中的片段总长度，避免挤占上下文
+	hits = rag.FitTokenBudget(hits, 0)
 
 	data := map[string]interface{}{
 		"query": params.Query,
@@ -423,8 +463,8 @@ func searchKnowledgeHandler(ctx context.Context, argumentsInJSON string) (string
 		if content == "" {
 			continue
 		}
-		if len(content) > 200 {
-			content = content[:200] + "..."
+		if runes := []rune(content); len(runes) > 200 {
+			content = string(runes[:200]) + "..."
 		}
 		builder.WriteString(fmt.Sprintf("%d. %s\n", i+1, content))
 	}
@@ -436,43 +476,173 @@ func searchKnowledgeHandler(ctx context.Context, argumentsInJSON string) (string
 	return response.ToJSON()
 }
 
-// getWeekNumber 获取周数
-func getWeekNumber(t time.Time) int {
-	_, week := t.ISOWeek()
-	return week
+// reminderLocation 提醒时间的解析时区：reminder.timezone 未配置时使用服务器本地时区
+func reminderLocation() *time.Location {
+	if tz := strings.TrimSpace(viper.GetString("reminder.timezone")); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return time.Local
 }
 
-// formatChineseDateTime 格式化中文日期时间
-func formatChineseDateTime(t time.Time) string {
-	weekdays := map[time.Weekday]string{
-		time.Sunday:    "星期日",
-		time.Monday:    "星期一",
-		time.Tuesday:   "星期二",
-		time.Wednesday: "星期三",
-		time.Thursday:  "星期四",
-		time.Friday:    "星期五",
-		time.Saturday:  "星期六",
-	}
-
-	return fmt.Sprintf("%d年%d月%d日 %s %02d:%02d:%02d",
-		t.Year(), int(t.Month()), t.Day(),
-		weekdays[t.Weekday()],
-		t.Hour(), t.Minute(), t.Second(),
-	)
+// resolveReminderRunAt 将 HH:MM 或 YYYY-MM-DD HH:MM 解析为带时区的 RFC3339 时间
+func resolveReminderRunAt(runAt string, now time.Time) (string, error) {
+	loc := reminderLocation()
+	now = now.In(loc)
+	if t, err := time.ParseInLocation("15:04", runAt, loc); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at.Format(time.RFC3339), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, runAt, loc); err == nil {
+			return t.Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("run_at 格式无效: %s", runAt)
+}
+
+func getChatSessionOperator(ctx context.Context) (ChatSessionOperator, error) {
+	chatSessionOperatorValue := ctx.Value("chat_session_operator")
+	if chatSessionOperatorValue == nil {
+		return nil, fmt.Errorf("从context中未找到chat_session_operator")
+	}
+	chatSessionOperator, ok := chatSessionOperatorValue.(ChatSessionOperator)
+	if !ok {
+		return nil, fmt.Errorf("从context中获取的chat_session_operator不是ChatSessionOperator类型")
+	}
+	return chatSessionOperator, nil
+}
+
+func formatReminderTime(t time.Time) string {
+	return t.In(reminderLocation()).Format("2006-01-02 15:04")
+}
+
+// createReminderHandler 创建定时提醒的处理函数
+func createReminderHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行创建提醒工具")
+
+	var params CreateReminderParams
+	if argumentsInJSON != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			response := NewErrorResponse("create_reminder", "参数解析失败", "PARSE_ERROR", "请检查参数格式是否正确")
+			return response.ToJSON()
+		}
+	}
+	params.Message = strings.TrimSpace(params.Message)
+	params.RunAt = strings.TrimSpace(params.RunAt)
+	params.Cron = strings.TrimSpace(params.Cron)
+	if params.Message == "" {
+		response := NewErrorResponse("create_reminder", "提醒内容不能为空", "INVALID_MESSAGE", "请提供 message 参数")
+		return response.ToJSON()
+	}
+
+	req := &reminder.CreateRequest{Message: params.Message}
+	switch {
+	case params.Cron != "":
+		req.CronExpr = params.Cron
+		req.Timezone = strings.TrimSpace(viper.GetString("reminder.timezone"))
+	case params.RunAt != "":
+		runAt, err := resolveReminderRunAt(params.RunAt, time.Now())
+		if err != nil {
+			response := NewErrorResponse("create_reminder", err.Error(), "INVALID_RUN_AT", "run_at 请使用 HH:MM 或 YYYY-MM-DD HH:MM 格式")
+			return response.ToJSON()
+		}
+		req.RunAt = runAt
+	case params.DelayMinutes > 0:
+		req.DelaySeconds = params.DelayMinutes * 60
+	default:
+		response := NewErrorResponse("create_reminder", "缺少提醒时间", "MISSING_SCHEDULE", "请提供 delay_minutes、run_at 或 cron 其中之一")
+		return response.ToJSON()
+	}
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		return "", err
+	}
+	created, err := chatSessionOperator.LocalMcpCreateReminder(ctx, req)
+	if err != nil {
+		log.Errorf("创建提醒失败: %v", err)
+		response := NewErrorResponse("create_reminder", fmt.Sprintf("创建提醒失败: %v", err), "CREATE_REMINDER_FAILED", "请检查提醒时间后重试")
+		return response.ToJSON()
+	}
+
+	msg := fmt.Sprintf("已设置提醒，将在 %s 提醒：%s", formatReminderTime(created.NextRunAt), created.Message)
+	if created.ScheduleType == "cron" {
+		msg = fmt.Sprintf("已设置周期提醒（%s），下次提醒时间 %s：%s", created.CronExpr, formatReminderTime(created.NextRunAt), created.Message)
+	}
+	response := NewContentResponse("create_reminder", created, msg)
+	return response.ToJSON()
 }
 
-// getWeekdayChinese 获取中文星期几
-func getWeekdayChinese(weekday time.Weekday) string {
-	weekdays := map[time.Weekday]string{
-		time.Sunday:    "星期日",
-		time.Monday:    "星期一",
-		time.Tuesday:   "星期二",
-		time.Wednesday: "星期三",
-		time.Thursday:  "星期四",
-		time.Friday:    "星期五",
-		time.Saturday:  "星期六",
-	}
-	return weekdays[weekday]
+// listRemindersHandler 查询提醒列表的处理函数
+func listRemindersHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行查询提醒工具")
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		return "", err
+	}
+	reminders, err := chatSessionOperator.LocalMcpListReminders(ctx)
+	if err != nil {
+		response := NewErrorResponse("list_reminders", fmt.Sprintf("查询提醒失败: %v", err), "LIST_REMINDERS_FAILED", "请稍后重试")
+		return response.ToJSON()
+	}
+	if len(reminders) == 0 {
+		response := NewContentResponse("list_reminders", reminders, "当前没有待执行的提醒")
+		return response.ToJSON()
+	}
+
+	var builder strings.Builder
+	for _, item := range reminders {
+		line := fmt.Sprintf("ID %d：%s 提醒“%s”", item.ID, formatReminderTime(item.NextRunAt), item.Message)
+		if item.ScheduleType == "cron" {
+			line += fmt.Sprintf("（周期 %s）", item.CronExpr)
+		}
+		if item.Status == "paused" {
+			line += "（已暂停）"
+		}
+		builder.WriteString(line + "\n")
+	}
+	response := NewContentResponse("list_reminders", reminders, strings.TrimSpace(builder.String()))
+	return response.ToJSON()
+}
+
+// cancelReminderHandler 取消提醒的处理函数
+func cancelReminderHandler(ctx context.Context, argumentsInJSON string) (string, error) {
+	log.Info("执行取消提醒工具")
+
+	var params CancelReminderParams
+	if argumentsInJSON != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			response := NewErrorResponse("cancel_reminder", "参数解析失败", "PARSE_ERROR", "请检查 reminder_id 参数格式")
+			return response.ToJSON()
+		}
+	}
+	if params.ReminderID == 0 {
+		response := NewErrorResponse("cancel_reminder", "缺少提醒ID", "MISSING_REMINDER_ID", "请先调用 list_reminders 获取提醒ID")
+		return response.ToJSON()
+	}
+
+	chatSessionOperator, err := getChatSessionOperator(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := chatSessionOperator.LocalMcpCancelReminder(ctx, params.ReminderID); err != nil {
+		response := NewErrorResponse("cancel_reminder", fmt.Sprintf("取消提醒失败: %v", err), "CANCEL_REMINDER_FAILED", "请确认提醒ID是否正确")
+		return response.ToJSON()
+	}
+	response := NewActionResponse("cancel_reminder", "cancel_reminder", fmt.Sprintf("已取消提醒 %d", params.ReminderID), "completed", false)
+	return response.ToJSON()
+}
+
+// getWeekNumber 获取周数
+func getWeekNumber(t time.Time) int {
+	_, week := t.ISOWeek()
+	return week
 }
 
 // RegisterChatMCPTools 公共函数，供外部调用注册聊天MCP工具
@@ -0,0 +1,239 @@
+package chat
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/hraban/opus.v2"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/memconn"
+	mcp_manager "xiaozhi-esp32-server-golang/internal/domain/mcp"
+)
+
+const (
+	e2eSampleRate = 16000
+	e2eFrameMs    = 60
+)
+
+// mockScript 端到端测试使用的 mock llm 脚本：第二句话触发工具调用，工具返回后再回复
+const mockScript = `
+default: 我没听清。
+rules:
+  - match: 几点
+    reply: 我查一下。
+    tool_calls:
+      - name: get_current_datetime
+        arguments: {}
+  - after_tool: get_current_datetime
+    reply: 时间查到了。
+  - match: 你好
+    reply: 你好呀，我是测试助手。
+`
+
+// setupMockProviders 把 ASR/LLM/TTS/VAD 全部配置为 mock，设备配置直接读取 viper
+func setupMockProviders(t *testing.T) {
+	t.Helper()
+	viper.Set("config_provider.type", "redis")
+	viper.Set("auth.enable", false)
+	viper.Set("vad.provider", "mock")
+	viper.Set("vad.mock", map[string]interface{}{"threshold": 0.01})
+	viper.Set("asr.provider", "mock")
+	viper.Set("asr.mock", map[string]interface{}{"transcripts": []interface{}{"你好", "现在几点了"}})
+	viper.Set("llm.provider", "mock")
+	viper.Set("llm.mock", map[string]interface{}{"type": "mock", "script_content": mockScript})
+	viper.Set("tts.provider", "mock")
+	viper.Set("tts.mock", map[string]interface{}{"ms_per_char": 20, "min_ms": 120})
+	t.Cleanup(viper.Reset)
+
+	// 与服务启动流程一致：初始化会话管理和 MCP 工具，不连接任何 MCP 服务
+	auth.Init()
+	mcp_manager.GetGlobalMCPManager()
+	InitChatLocalMCPTools()
+}
+
+type serverMessage struct {
+	Type  string `json:"type"`
+	State string `json:"state"`
+	Text  string `json:"text"`
+}
+
+// e2eDevice 通过 MemoryConn 扮演设备
+type e2eDevice struct {
+	t       *testing.T
+	conn    *memconn.MemoryConn
+	encoder *opus.Encoder
+}
+
+func (d *e2eDevice) sendJSON(msg map[string]interface{}) {
+	d.t.Helper()
+	data, _ := json.Marshal(msg)
+	if err := d.conn.PushCmd(data); err != nil {
+		d.t.Fatalf("发送 %s 失败: %v", msg["type"], err)
+	}
+}
+
+// frame 编码一帧音频，amplitude 为 0 时为静音
+func (d *e2eDevice) frame(index int, amplitude float64) []byte {
+	d.t.Helper()
+	samples := e2eSampleRate * e2eFrameMs / 1000
+	pcm := make([]int16, samples)
+	for i := range pcm {
+		n := index*samples + i
+		pcm[i] = int16(amplitude * math.MaxInt16 * math.Sin(2*math.Pi*300*float64(n)/e2eSampleRate))
+	}
+	buf := make([]byte, 4000)
+	size, err := d.encoder.Encode(pcm, buf)
+	if err != nil {
+		d.t.Fatalf("opus编码失败: %v", err)
+	}
+	return buf[:size]
+}
+
+// speak 发送约 1 秒语音后持续发送静音，直到服务端返回 stt，返回识别文本
+func (d *e2eDevice) speak() string {
+	d.t.Helper()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			amplitude := 0.0
+			if i < 1000/e2eFrameMs {
+				amplitude = 0.3
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(e2eFrameMs * time.Millisecond / 4):
+			}
+			if d.conn.PushAudio(d.frame(i, amplitude)) != nil {
+				return
+			}
+		}
+	}()
+	return d.waitFor("stt", "").Text
+}
+
+// waitFor 等待指定类型（及状态）的下行消息，期间忽略其它消息
+func (d *e2eDevice) waitFor(msgType, state string) serverMessage {
+	d.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case data := <-d.conn.Cmds():
+			var msg serverMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				d.t.Fatalf("无法解析下行消息 %s: %v", data, err)
+			}
+			if msg.Type == msgType && (state == "" || msg.State == state) {
+				return msg
+			}
+		case <-timeout:
+			d.t.Fatalf("等待 %s %s 超时", msgType, state)
+		}
+	}
+}
+
+// reply 等待一轮回复播放结束，返回播报的句子和音频帧数
+func (d *e2eDevice) reply() ([]string, int) {
+	d.t.Helper()
+	d.waitFor("tts", "start")
+	var sentences []string
+	frames := 0
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case <-d.conn.Audio():
+			frames++
+		case data := <-d.conn.Cmds():
+			var msg serverMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				d.t.Fatalf("无法解析下行消息 %s: %v", data, err)
+			}
+			if msg.Type != "tts" {
+				continue
+			}
+			switch msg.State {
+			case "sentence_start":
+				sentences = append(sentences, msg.Text)
+			case "stop":
+				// tts stop 之前的音频已经全部发出
+				for {
+					select {
+					case <-d.conn.Audio():
+						frames++
+					default:
+						return sentences, frames
+					}
+				}
+			}
+		case <-timeout:
+			d.t.Fatalf("等待回复超时，已收到句子 %v", sentences)
+		}
+	}
+}
+
+func TestChatManagerWithMockProviders(t *testing.T) {
+	setupMockProviders(t)
+
+	encoder, err := opus.NewEncoder(e2eSampleRate, 1, opus.AppVoIP)
+	if err != nil {
+		t.Skipf("opus不可用，跳过: %v", err)
+	}
+	if _, err := encoder.Encode(make([]int16, e2eSampleRate*e2eFrameMs/1000), make([]byte, 4000)); err != nil {
+		t.Skipf("opus不可用，跳过: %v", err)
+	}
+	const deviceID = "e2e-mock-device"
+	conn := memconn.NewMemoryConn(deviceID, "")
+	device := &e2eDevice{t: t, conn: conn, encoder: encoder}
+
+	cm, err := NewChatManager(deviceID, conn)
+	if err != nil {
+		t.Fatalf("创建ChatManager失败: %v", err)
+	}
+	defer cm.Close()
+	go cm.Start()
+
+	device.sendJSON(map[string]interface{}{
+		"type":      "hello",
+		"version":   1,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    e2eSampleRate,
+			"channels":       1,
+			"frame_duration": e2eFrameMs,
+		},
+	})
+	device.waitFor("hello", "")
+
+	// 第一轮：VAD 判断说话结束，ASR 返回第一条脚本文本，LLM 按规则回复
+	device.sendJSON(map[string]interface{}{"type": "listen", "state": "start", "mode": "auto"})
+	if text := device.speak(); text != "你好" {
+		t.Fatalf("第一轮识别结果 = %q", text)
+	}
+	sentences, frames := device.reply()
+	if strings.Join(sentences, "") != "你好呀，我是测试助手。" {
+		t.Fatalf("第一轮回复 = %v", sentences)
+	}
+	if frames == 0 {
+		t.Fatal("第一轮没有收到回复音频")
+	}
+
+	// 第二轮：LLM 先调用本地工具，拿到结果后再回复
+	device.sendJSON(map[string]interface{}{"type": "listen", "state": "start", "mode": "auto"})
+	if text := device.speak(); text != "现在几点了" {
+		t.Fatalf("第二轮识别结果 = %q", text)
+	}
+	sentences, frames = device.reply()
+	if got := strings.Join(sentences, ""); !strings.Contains(got, "时间查到了。") {
+		t.Fatalf("第二轮回复应包含工具调用后的回答，实际 %v", sentences)
+	}
+	if frames == 0 {
+		t.Fatal("第二轮没有收到回复音频")
+	}
+}
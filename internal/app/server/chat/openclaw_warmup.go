@@ -8,9 +8,11 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/cloudwego/eino/schema"
 
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/pool"
@@ -464,7 +466,7 @@ func (s *ChatSession) generateOpenClawWarmupPlan(ctx context.Context, correlatio
 
 	dialogue := []*schema.Message{
 		schema.SystemMessage(openClawWarmupSystemPrompt),
-		schema.UserMessage(buildOpenClawWarmupUserPrompt(userText)),
+		schema.UserMessage(buildOpenClawWarmupUserPrompt(userText) + buildOpenClawWarmupLanguageHint(s.clientState.GetLanguage())),
 	}
 
 	msgChan := llmWrapper.GetProvider().ResponseWithContext(
@@ -499,6 +501,15 @@ func buildOpenClawWarmupUserPrompt(userText string) string {
 	)
 }
 
+// buildOpenClawWarmupLanguageHint 非中文对话时要求暖场语改用对话语言
+func buildOpenClawWarmupLanguageHint(language string) string {
+	if language == "" || language == i18n.LanguageZh {
+		return ""
+	}
+	name := i18n.DisplayName(language)
+	return fmt.Sprintf("\n\n本轮对话语言为%s：11 条暖场语必须全部使用%s，不要使用普通话中文；长度要求改为每条不超过 8 个词、不超过 40 个字符，其余要求不变。", name, name)
+}
+
 func buildOpenClawWarmupSessionID(sessionID string, correlationID string) string {
 	base := strings.TrimSpace(sessionID)
 	if base == "" {
@@ -612,13 +623,22 @@ func sanitizeOpenClawWarmupText(text string) string {
 		return ""
 	}
 
-	runes := []rune(text)
-	if len(runes) > 16 {
+	if len([]rune(text)) > maxOpenClawWarmupRunes(text) {
 		return ""
 	}
 	return text
 }
 
+// maxOpenClawWarmupRunes 汉字/假名按 16 字限制，其它语言（英文、韩文等）按 40 个字符限制
+func maxOpenClawWarmupRunes(text string) int {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) {
+			return 16
+		}
+	}
+	return 40
+}
+
 func isInvalidOpenClawWarmupText(text string) bool {
 	for _, bad := range []string{
 		"帮我",
@@ -81,3 +81,18 @@ func TestSanitizeOpenClawWarmupTextRejectsUserCommandEcho(t *testing.T) {
 		t.Fatalf("expected invalid warmup text to be rejected, got %q", got)
 	}
 }
+
+func TestSanitizeOpenClawWarmupTextLanguageLimit(t *testing.T) {
+	if got := sanitizeOpenClawWarmupText("Let me take a look."); got != "Let me take a look." {
+		t.Fatalf("expected english warmup text to be kept, got %q", got)
+	}
+	if got := sanitizeOpenClawWarmupText("这个问题我还在认真地帮你继续确认最新的结果"); got != "" {
+		t.Fatalf("expected long chinese warmup text to be rejected, got %q", got)
+	}
+	if got := buildOpenClawWarmupLanguageHint("zh"); got != "" {
+		t.Fatalf("expected no language hint for zh, got %q", got)
+	}
+	if got := buildOpenClawWarmupLanguageHint("en"); !strings.Contains(got, "English") {
+		t.Fatalf("expected english language hint, got %q", got)
+	}
+}
@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolveReminderRunAt(t *testing.T) {
+	viper.Set("reminder.timezone", "Asia/Shanghai")
+	defer viper.Set("reminder.timezone", "")
+
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	now := time.Date(2026, 3, 14, 21, 30, 0, 0, loc)
+
+	cases := map[string]string{
+		"22:00":            "2026-03-14T22:00:00+08:00",
+		"20:00":            "2026-03-15T20:00:00+08:00", // 今天已过，顺延到明天
+		"2026-04-01 08:30": "2026-04-01T08:30:00+08:00",
+	}
+	for input, want := range cases {
+		got, err := resolveReminderRunAt(input, now)
+		if err != nil || got != want {
+			t.Fatalf("resolveReminderRunAt(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := resolveReminderRunAt("明天早上", now); err == nil {
+		t.Fatalf("invalid run_at should fail")
+	}
+}
@@ -45,7 +45,7 @@ func (s *ServerTransport) SendTtsStart() error {
 	if err != nil {
 		return err
 	}
-	s.clientState.SetTtsStart(true)
+	s.clientState.SetState(StateSpeaking, "tts_start")
 	return nil
 }
 
@@ -63,8 +63,12 @@ func (s *ServerTransport) SendTtsStop() error {
 	if err != nil {
 		return err
 	}
-	// 一轮对话播报结束后，回到可触发下一轮对话的状态。
-	s.clientState.SetStatus(ClientStatusListenStop)
+	// 一轮对话播报结束后，回到可触发下一轮对话的状态：realtime 模式继续拾音，否则等待设备下一次 listen start
+	if s.clientState.IsRealTime() {
+		s.clientState.SetState(StateListening, "tts_stop")
+	} else {
+		s.clientState.SetState(StateIdle, "tts_stop")
+	}
 	return nil
 }
 
@@ -155,7 +159,8 @@ func (s *ServerTransport) SendSentenceStart(text string) error {
 	if err != nil {
 		return err
 	}
-	s.clientState.SetStatus(ClientStatusTTSStart)
+	// 工具调用后的后续回复只在思考中切回播报，打断后迟到的句子事件不改变状态
+	s.clientState.Conversation.TransitionFrom(StateSpeaking, "sentence", StateThinking)
 	return nil
 }
 
@@ -174,7 +179,8 @@ func (s *ServerTransport) SendSentenceEnd(text string) error {
 	if err != nil {
 		return err
 	}
-	s.clientState.SetStatus(ClientStatusTTSStart)
+	// 工具调用后的后续回复只在思考中切回播报，打断后迟到的句子事件不改变状态
+	s.clientState.Conversation.TransitionFrom(StateSpeaking, "sentence", StateThinking)
 	return nil
 }
 
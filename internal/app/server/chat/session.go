@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +20,7 @@ import (
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
 	"xiaozhi-esp32-server-golang/internal/domain/config/types"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
@@ -197,10 +197,26 @@ func NewChatSession(clientState *ClientState, serverTransport *ServerTransport,
 	clientState.OnAsrFirstTextCallback = func(text string, isFinal bool) {
 		log.Debugf("ASR首次返回字符: device=%s, text=%s, isFinal=%v", clientState.DeviceID, text, isFinal)
 		if clientState.IsRealTime() && viper.GetInt("chat.realtime_mode") == 4 {
+			clientState.Conversation.Interrupt("realtime_asr_first_text")
 			clientState.AfterAsrSessionCtx.Cancel()
 			s.InterruptAndClearTTSQueue()
 		}
-	}
+		clientState.SetState(StateRecognizing, "asr_first_text")
+	}
+
+	// 对话状态迁移：记录日志并发布事件，供指标统计与 webhook 使用
+	clientState.Conversation.OnTransition(func(t Transition) {
+		log.Debugf("对话状态迁移: device=%s, %s -> %s, reason=%s, turnID=%s, duration=%s", clientState.DeviceID, t.From, t.To, t.Reason, t.TurnID, t.Duration)
+		eventbus.Publish(eventbus.TopicConversation, &eventbus.ConversationStateEvent{
+			ClientState: clientState,
+			From:        t.From,
+			To:          t.To,
+			TurnID:      t.TurnID,
+			Reason:      t.Reason,
+			Duration:    t.Duration,
+			Timestamp:   t.At,
+		})
+	})
 
 	return s
 }
@@ -503,6 +519,10 @@ func (s *ChatSession) HandleHelloMessage(msg *ClientMessage) error {
 		return s.HandleWebsocketHelloMessage(msg)
 	} else if msg.Transport == types_conn.TransportTypeMqttUdp {
 		return s.HandleMqttHelloMessage(msg)
+	} else if msg.Transport == types_conn.TransportTypeWebRTC {
+		return s.HandleWebRTCHelloMessage(msg)
+	} else if msg.Transport == types_conn.TransportTypeSip {
+		return s.HandleSipHelloMessage(msg)
 	}
 	return fmt.Errorf("不支持的传输类型: %s", msg.Transport)
 }
@@ -581,6 +601,7 @@ func (s *ChatSession) HandleCommonHelloMessage(msg *ClientMessage) error {
 
 	// 更新客户端状态
 	clientState.SessionID = session.ID
+	eventbus.Publish(eventbus.TopicSessionStart, clientState)
 
 	if !s.vadLoopStarted {
 		s.asrManager.ProcessVadAudio(clientState.Ctx, s.Close)
@@ -629,6 +650,26 @@ func (s *ChatSession) HandleWebsocketHelloMessage(msg *ClientMessage) error {
 	return s.serverTransport.SendHello("websocket", &s.clientState.OutputAudioFormat, nil)
 }
 
+// HandleWebRTCHelloMessage 处理 WebRTC 数据通道上的 hello，音频走 RTP，不需要下发 udp 配置
+func (s *ChatSession) HandleWebRTCHelloMessage(msg *ClientMessage) error {
+	err := s.HandleCommonHelloMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.serverTransport.SendHello(types_conn.TransportTypeWebRTC, &s.clientState.OutputAudioFormat, nil)
+}
+
+// HandleSipHelloMessage 处理电话网关的 hello，音频由网关在 RTP 与 Opus 之间转码，无需额外通道参数
+func (s *ChatSession) HandleSipHelloMessage(msg *ClientMessage) error {
+	err := s.HandleCommonHelloMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.serverTransport.SendHello(types_conn.TransportTypeSip, &s.clientState.OutputAudioFormat, nil)
+}
+
 // handleListenMessage 处理监听消息
 func (s *ChatSession) HandleListenMessage(msg *ClientMessage) error {
 	// 根据状态处理
@@ -669,8 +710,13 @@ func (s *ChatSession) HandleListenDetect(msg *ClientMessage) error {
 		// 移除标点符号和处理长度
 		text = removePunctuation(text)
 
-		// 检查是否是唤醒词
-		isWakeupWord := isWakeupWord(text)
+		// 检查是否是唤醒词；auto 语言模式下唤醒词的语言即为本次对话语言
+		wakeupLanguage, isWakeupWord := matchWakeupWord(text)
+		if isWakeupWord {
+			s.clientState.UpdateLanguage(wakeupLanguage, "")
+		} else {
+			s.clientState.UpdateLanguage("", text)
+		}
 		enableGreeting := viper.GetBool("enable_greeting") // 从配置获取
 
 		var needStartChat bool
@@ -716,7 +762,7 @@ func (s *ChatSession) HandleNotActivated() {
 
 	sessionCtx := s.clientState.SessionCtx.Get(s.clientState.Ctx)
 	_ = s.ttsManager.handleTextResponse(s.clientState.AfterAsrSessionCtx.Get(sessionCtx), llm_common.LLMResponseStruct{
-		Text: fmt.Sprintf("请在后台添加设备，激活码: %s", code),
+		Text: i18n.ActivationPrompt(s.clientState.GetLanguage(), code),
 	}, false)
 
 }
@@ -734,9 +780,9 @@ func (s *ChatSession) HandleWelcome() {
 }
 
 func (a *ChatSession) checkExitWords(text string) bool {
-	exitWords := []string{"再见", "退下吧", "退出", "退出对话"}
-	for _, word := range exitWords {
-		if strings.Contains(text, word) {
+	lowerText := strings.ToLower(text)
+	for _, word := range i18n.ExitWords(a.clientState.GetLanguage()) {
+		if word != "" && strings.Contains(lowerText, strings.ToLower(word)) {
 			return true
 		}
 	}
@@ -772,6 +818,16 @@ func (s *ChatSession) isOpenClawExitKeyword(text string) bool {
 	return containsOpenClawKeyword(text, s.clientState.DeviceConfig.OpenClaw.ExitKeywords)
 }
 
+// publishOpenClawMode 发布 OpenClaw 模式切换事件
+func (s *ChatSession) publishOpenClawMode(enabled bool, trigger string) {
+	eventbus.Publish(eventbus.TopicOpenClawMode, &eventbus.OpenClawModeEvent{
+		ClientState: s.clientState,
+		Enabled:     enabled,
+		Trigger:     trigger,
+		Timestamp:   time.Now(),
+	})
+}
+
 func openClawLogSnippet(text string, maxRunes int) string {
 	if maxRunes <= 0 {
 		return ""
@@ -788,12 +844,7 @@ func openClawLogSnippet(text string, maxRunes int) string {
 }
 
 func (s *ChatSession) GetRandomGreeting() string {
-	greetingList := viper.GetStringSlice("greeting_list")
-	if len(greetingList) == 0 {
-		return "你好，有啥好玩的."
-	}
-	rand.Seed(time.Now().UnixNano())
-	return greetingList[rand.Intn(len(greetingList))]
+	return i18n.RandomGreeting(s.clientState.GetLanguage())
 }
 
 func (s *ChatSession) AddTextToTTSQueue(text string) error {
@@ -921,8 +972,7 @@ func (s *ChatSession) InterruptAndClearTTSQueue() {
 
 // handleAbortMessage 处理中止消息
 func (s *ChatSession) HandleAbortMessage(msg *ClientMessage) error {
-	// 设置打断状态
-	s.clientState.Abort = true
+	s.clientState.Conversation.Interrupt("abort")
 
 	s.StopSpeaking(true)
 
@@ -1027,6 +1077,7 @@ func (s *ChatSession) HandleListenStart(msg *ClientMessage) error {
 		s.clientState.ListenMode = msg.Mode
 		log.Infof("设备 %s 拾音模式: %s", msg.DeviceID, msg.Mode)
 	}
+	s.ensureEchoCanceller()
 	//if s.clientState.ListenMode == "manual" {
 	s.StopSpeaking(false)
 	//}
@@ -1058,7 +1109,7 @@ func (s *ChatSession) OnListenStart() error {
 
 	s.clientState.Destroy()
 
-	s.clientState.SetStatus(ClientStatusListening)
+	s.clientState.SetState(StateListening, "listen_start")
 
 	ctx := s.clientState.SessionCtx.Get(s.clientState.Ctx)
 
@@ -1078,8 +1129,9 @@ func (s *ChatSession) OnListenStart() error {
 	// 定义消息保存回调
 	onMessageSave := func(userMsg *schema.Message, messageID string, audioData []float32) {
 		// ASR 文本和音频同时获取，一次性保存（不需要两阶段）
-		eventbus.Get().Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+		eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
 			ClientState: s.clientState,
+			TurnID:      s.clientState.TurnID(),
 			Msg:         *userMsg,
 			MessageID:   messageID,
 			AudioData:   [][]byte{util.Float32SliceToBytes(audioData)}, // 转换为字节数组
@@ -1150,7 +1202,7 @@ func (s *ChatSession) ClearChatTextQueue() {
 // DoExitChat 执行退出聊天逻辑（发送再见语并关闭会话）
 func (s *ChatSession) DoExitChat() {
 	// 友好的再见语
-	goodbyeText := "好的，再见！期待下次与您聊天～"
+	goodbyeText := i18n.Text(s.clientState.GetLanguage(), i18n.TextGoodbye)
 
 	// 保存一条 assistant 角色的消息
 	goodbyeMsg := schema.AssistantMessage(goodbyeText, nil)
@@ -1197,6 +1249,9 @@ func (s *ChatSession) Close() {
 			s.cancel()
 		}
 		s.finishOpenClawWarmup("", false)
+		if s.llmManager != nil {
+			s.llmManager.CancelToolConfirm()
+		}
 
 		// 清理聊天文本队列
 		s.ClearChatTextQueue()
@@ -1215,7 +1270,7 @@ func (s *ChatSession) Close() {
 		}
 
 		if s.clientState != nil {
-			eventbus.Get().Publish(eventbus.TopicSessionEnd, s.clientState)
+			eventbus.Publish(eventbus.TopicSessionEnd, s.clientState)
 		}
 
 		log.Debugf("ChatSession.Close() 会话资源清理完成, 设备 %s", deviceID)
@@ -1230,6 +1285,11 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 	default:
 	}
 
+	// 上一轮询问过敏感工具的确认，这句话先作为回答处理
+	if s.llmManager.HandleToolConfirmAnswer(ctx, text) {
+		return nil
+	}
+
 	agentID := strings.TrimSpace(s.clientState.AgentID)
 	deviceID := strings.TrimSpace(s.clientState.DeviceID)
 	openclawSessionID := strings.TrimSpace(s.clientState.SessionID)
@@ -1260,7 +1320,8 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 			if isExitKeyword {
 				s.finishOpenClawWarmup("", true)
 				exited := openclawManager.ExitMode(agentID, deviceID)
-				_ = s.AddTextToTTSQueue("已退出OpenClaw模式")
+				s.publishOpenClawMode(false, "exit_keyword")
+				_ = s.AddTextToTTSQueue(i18n.Text(s.clientState.GetLanguage(), i18n.TextOpenClawExited))
 				log.Infof("设备 %s 退出OpenClaw模式: agent=%s exited=%v", deviceID, agentID, exited)
 				return nil
 			}
@@ -1290,7 +1351,8 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 					err,
 				)
 				openclawManager.ExitMode(agentID, deviceID)
-				_ = s.AddTextToTTSQueue("OpenClaw当前不可用，已退出OpenClaw模式")
+				s.publishOpenClawMode(false, "send_failed")
+				_ = s.AddTextToTTSQueue(i18n.Text(s.clientState.GetLanguage(), i18n.TextOpenClawFallback))
 			} else {
 				s.startOpenClawWarmup(messageID, text)
 				log.Infof("OpenClaw发送STT成功: agent=%s device=%s session=%s message_id=%s", agentID, deviceID, openclawSessionID, messageID)
@@ -1300,11 +1362,12 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 
 		if isEnterKeyword {
 			if !openclawManager.EnterMode(agentID, deviceID) {
-				_ = s.AddTextToTTSQueue("OpenClaw当前不可用，请稍后再试")
+				_ = s.AddTextToTTSQueue(i18n.Text(s.clientState.GetLanguage(), i18n.TextOpenClawUnavailable))
 				log.Warnf("设备 %s 进入OpenClaw模式失败: agent=%s agent session not ready", deviceID, agentID)
 				return nil
 			}
-			_ = s.AddTextToTTSQueue("已进入OpenClaw模式，请继续说")
+			s.publishOpenClawMode(true, "enter_keyword")
+			_ = s.AddTextToTTSQueue(i18n.Text(s.clientState.GetLanguage(), i18n.TextOpenClawEntered))
 			log.Infof("设备 %s 进入OpenClaw模式: agent=%s trigger=%q", deviceID, agentID, openClawLogSnippet(trimmedText, 32))
 			return nil
 		}
@@ -1325,7 +1388,7 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 
 	if s.checkExitWords(text) {
 		// 发布退出聊天事件
-		eventbus.Get().Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
+		eventbus.Publish(eventbus.TopicExitChat, &eventbus.ExitChatEvent{
 			ClientState: s.clientState,
 			Reason:      "用户主动退出",
 			TriggerType: "exit_words",
@@ -1363,6 +1426,7 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string, speakerResu
 			log.Infof("设备 %s 未关联可用知识库，已移除工具 search_knowledge", clientState.DeviceID)
 		}
 	}
+	s.llmManager.removeDeniedTools(ctx, mcpTools)
 
 	// 将MCP工具转换为接口格式以便传递给转换函数
 	mcpToolsInterface := make(map[string]interface{})
@@ -11,8 +11,10 @@ import (
 	"sync"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/data/reminder"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	llm_memory "xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
 	"xiaozhi-esp32-server-golang/internal/domain/rag"
 	log "xiaozhi-esp32-server-golang/logger"
@@ -177,6 +179,47 @@ func (c *ChatManager) LocalMcpSearchKnowledge(ctx context.Context, query string,
 	return rag.Search(ctx, query, topK, c.clientState.DeviceConfig.KnowledgeBases, knowledgeBaseIDs)
 }
 
+// LocalMcpGetLanguage 获取当前对话语言
+func (c *ChatManager) LocalMcpGetLanguage() string {
+	if c == nil || c.clientState == nil {
+		return i18n.DefaultLanguage
+	}
+	return c.clientState.GetLanguage()
+}
+
+// LocalMcpCreateReminder 为当前设备创建定时提醒
+func (c *ChatManager) LocalMcpCreateReminder(ctx context.Context, req *reminder.CreateRequest) (*reminder.Reminder, error) {
+	client := reminder.Default()
+	if client == nil {
+		return nil, fmt.Errorf("定时提醒未启用")
+	}
+	req.DeviceID = c.DeviceID
+	created, err := client.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("设备 %s 创建提醒成功, id=%d type=%s next_run_at=%s", c.DeviceID, created.ID, created.ScheduleType, created.NextRunAt.Format(time.RFC3339))
+	return created, nil
+}
+
+// LocalMcpListReminders 查询当前设备待执行的提醒
+func (c *ChatManager) LocalMcpListReminders(ctx context.Context) ([]reminder.Reminder, error) {
+	client := reminder.Default()
+	if client == nil {
+		return nil, fmt.Errorf("定时提醒未启用")
+	}
+	return client.List(ctx, c.DeviceID)
+}
+
+// LocalMcpCancelReminder 取消当前设备的提醒
+func (c *ChatManager) LocalMcpCancelReminder(ctx context.Context, reminderID uint) error {
+	client := reminder.Default()
+	if client == nil {
+		return fmt.Errorf("定时提醒未启用")
+	}
+	return client.Cancel(ctx, c.DeviceID, reminderID)
+}
+
 // searchMusicFromAPI 从API搜索音乐
 func getMusicURL(musicName string) (string, string, error) {
 	client := getHTTPClient()
@@ -0,0 +1,358 @@
+package chat
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/toolconfirm"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultToolConfirmTimeout = 20 * time.Second
+	toolConfirmLabelMaxRunes  = 24
+	// 确认通过后重新执行时使用新的 ToolCallID，与等待确认时的工具消息区分
+	toolConfirmCallIDSuffix = "_confirmed"
+)
+
+// 回写给 LLM 的工具结果
+const (
+	toolConfirmPendingResult = "该操作需要用户确认，已询问用户，等用户回答后再执行，不要重复调用"
+	toolConfirmBusyResult    = "已有其他操作在等待用户确认，本次未执行"
+	toolConfirmBlockedResult = "该工具已被禁止调用，请告诉用户无法执行该操作"
+)
+
+var toolConfirmDecisionResults = map[string]string{
+	toolconfirm.DecisionRejected: "用户拒绝执行该操作，未执行",
+	toolconfirm.DecisionUnclear:  "用户没有确认，未执行该操作",
+	toolconfirm.DecisionTimeout:  "用户超时未确认，未执行该操作",
+}
+
+// pendingToolConfirm 等待用户语音确认的工具调用，每个会话同一时间最多一个
+type pendingToolConfirm struct {
+	call   schema.ToolCall
+	record toolconfirm.Record
+	timer  *time.Timer
+}
+
+// approvedToolCall 用户已同意的工具调用，放在 context 中让确认后的重新执行跳过确认
+type approvedToolCall struct {
+	id     string
+	record toolconfirm.Record
+}
+
+type approvedToolCallKeyType struct{}
+
+var approvedToolCallKey = approvedToolCallKeyType{}
+
+// toolConfirmState LLMManager 中的确认状态
+type toolConfirmState struct {
+	mu      sync.Mutex
+	pending *pendingToolConfirm
+}
+
+// toolPolicy 返回工具的调用策略：全局 chat.tool_confirm.policies < 智能体 tool_policies
+func (l *LLMManager) toolPolicy(toolName string) string {
+	var agentPolicies map[string]string
+	if l.clientState != nil && l.clientState.DeviceConfig.ToolPolicies != nil {
+		agentPolicies = l.clientState.DeviceConfig.ToolPolicies
+	}
+	policies := toolconfirm.MergePolicies(viper.GetStringMapString("chat.tool_confirm.policies"), agentPolicies)
+	return toolconfirm.ResolvePolicy(policies, toolName)
+}
+
+// policyRank 策略的严格程度，多个名称命中不同策略时取最严格的
+var policyRank = map[string]int{toolconfirm.PolicyAllow: 0, toolconfirm.PolicyConfirm: 1, toolconfirm.PolicyDeny: 2}
+
+// effectiveToolPolicy 工具的生效策略。全局 MCP 工具的 key 带服务名前缀（server_tool），模型看到的是工具自身的名称，
+// 按调用名、工具自身名称和带服务名前缀的名称分别解析，取最严格的一个；过滤工具列表与拦截调用都使用它，保证结果一致
+func (l *LLMManager) effectiveToolPolicy(ctx context.Context, name string, t tool.InvokableTool) string {
+	names := []string{name}
+	if t != nil {
+		if info, err := t.Info(ctx); err == nil && info != nil && info.Name != "" {
+			names = append(names, info.Name)
+			if named, ok := t.(interface{ ServerName() string }); ok && named.ServerName() != "" {
+				names = append(names, named.ServerName()+"_"+info.Name)
+			}
+		}
+	}
+	resolved := toolconfirm.PolicyAllow
+	for _, n := range names {
+		if policy := l.toolPolicy(n); policyRank[policy] > policyRank[resolved] {
+			resolved = policy
+		}
+	}
+	return resolved
+}
+
+// removeDeniedTools 移除策略为 deny 的工具，不提供给模型
+func (l *LLMManager) removeDeniedTools(ctx context.Context, tools map[string]tool.InvokableTool) {
+	for key, t := range tools {
+		if l.effectiveToolPolicy(ctx, key, t) == toolconfirm.PolicyDeny {
+			delete(tools, key)
+			log.Infof("设备 %s 工具 %s 策略为 deny，不提供给模型", l.clientState.DeviceID, key)
+		}
+	}
+}
+
+// lookupTool 按模型给出的工具名查找工具
+func (l *LLMManager) lookupTool(name string) (tool.InvokableTool, bool) {
+	state := l.clientState
+	return mcp.GetToolByName(state.DeviceID, state.AgentID, name, state.DeviceConfig.MCPServiceNames)
+}
+
+func toolConfirmTimeout() time.Duration {
+	if timeout := viper.GetDuration("chat.tool_confirm.timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultToolConfirmTimeout
+}
+
+func approvedToolCallFromContext(ctx context.Context, callID string) (approvedToolCall, bool) {
+	approved, ok := ctx.Value(approvedToolCallKey).(approvedToolCall)
+	if !ok || approved.id != callID {
+		return approvedToolCall{}, false
+	}
+	return approved, true
+}
+
+func toolConfirmExtra(record toolconfirm.Record) map[string]any {
+	return map[string]any{toolconfirm.MetadataKey: record}
+}
+
+// gateToolCalls 按策略过滤模型返回的工具调用：
+// allow 与已获同意的调用返回给执行器；deny 直接回写拒绝；confirm 登记为等待确认并返回需要播报的问题。
+// 一轮内只发起一次确认，其余需要确认的调用回写"已有操作等待确认"。
+func (l *LLMManager) gateToolCalls(ctx context.Context, calls []schema.ToolCall, lookup func(name string) (tool.InvokableTool, bool), addMessage func(schema.ToolCall, string) *schema.Message) ([]schema.ToolCall, string) {
+	allowed := make([]schema.ToolCall, 0, len(calls))
+	var question string
+	for _, call := range calls {
+		if _, ok := approvedToolCallFromContext(ctx, call.ID); ok {
+			allowed = append(allowed, call)
+			continue
+		}
+		toolName := call.Function.Name
+		t, _ := lookup(toolName)
+		switch policy := l.effectiveToolPolicy(ctx, toolName, t); policy {
+		case toolconfirm.PolicyDeny:
+			log.Warnf("工具 %s 策略为 deny，拒绝执行, turnID: %s", toolName, l.clientState.TurnID())
+			now := time.Now()
+			msg := addMessage(call, toolConfirmBlockedResult)
+			msg.Extra = toolConfirmExtra(toolconfirm.Record{
+				ToolName:  toolName,
+				Arguments: call.Function.Arguments,
+				Policy:    policy,
+				Decision:  toolconfirm.DecisionBlocked,
+				AskedAt:   now,
+				DecidedAt: &now,
+			})
+			l.publishToolCall(call, "", "工具已被禁止调用", 0)
+		case toolconfirm.PolicyConfirm:
+			if question != "" {
+				addMessage(call, toolConfirmBusyResult)
+				continue
+			}
+			record, ok := l.beginToolConfirm(call)
+			if !ok {
+				addMessage(call, toolConfirmBusyResult)
+				continue
+			}
+			log.Infof("工具 %s 需要用户确认, 参数: %s, turnID: %s", toolName, call.Function.Arguments, l.clientState.TurnID())
+			msg := addMessage(call, toolConfirmPendingResult)
+			msg.Extra = toolConfirmExtra(record)
+			question = fmt.Sprintf(i18n.Text(l.clientState.GetLanguage(), i18n.TextToolConfirmAsk), l.toolConfirmLabel(call))
+		default:
+			allowed = append(allowed, call)
+		}
+	}
+	return allowed, question
+}
+
+// toolConfirmLabel 播报给用户的操作名称：工具描述较短时用描述的第一句，否则用工具名
+func (l *LLMManager) toolConfirmLabel(call schema.ToolCall) string {
+	if t, ok := l.lookupTool(call.Function.Name); ok {
+		if info, err := t.Info(context.Background()); err == nil && info != nil {
+			desc := strings.TrimSpace(info.Desc)
+			if idx := strings.IndexAny(desc, "。.\n；;"); idx > 0 {
+				desc = strings.TrimSpace(desc[:idx])
+			}
+			if desc != "" && len([]rune(desc)) <= toolConfirmLabelMaxRunes {
+				return desc
+			}
+		}
+	}
+	return call.Function.Name
+}
+
+// askToolConfirm 播报确认问题并写入聊天记录，本轮不再继续请求 LLM
+func (l *LLMManager) askToolConfirm(ctx context.Context, question string) {
+	if err := l.ttsManager.handleTextResponse(ctx, llm_common.LLMResponseStruct{Text: question, IsEnd: true}, true); err != nil {
+		log.Warnf("播报工具确认问题失败: %v", err)
+	}
+	l.AddLlmMessage(ctx, schema.AssistantMessage(question, nil))
+}
+
+// beginToolConfirm 登记等待确认的调用并启动超时计时，已有等待中的确认时返回 false
+func (l *LLMManager) beginToolConfirm(call schema.ToolCall) (toolconfirm.Record, bool) {
+	l.toolConfirm.mu.Lock()
+	defer l.toolConfirm.mu.Unlock()
+	if l.toolConfirm.pending != nil {
+		return toolconfirm.Record{}, false
+	}
+	p := &pendingToolConfirm{
+		call: call,
+		record: toolconfirm.Record{
+			ToolName:  call.Function.Name,
+			Arguments: call.Function.Arguments,
+			Policy:    toolconfirm.PolicyConfirm,
+			Decision:  toolconfirm.DecisionPending,
+			AskedAt:   time.Now(),
+		},
+	}
+	p.timer = time.AfterFunc(toolConfirmTimeout(), func() { l.expireToolConfirm(p) })
+	l.toolConfirm.pending = p
+	return p.record, true
+}
+
+// takeToolConfirm 取出并清除等待中的确认
+func (l *LLMManager) takeToolConfirm() *pendingToolConfirm {
+	l.toolConfirm.mu.Lock()
+	defer l.toolConfirm.mu.Unlock()
+	p := l.toolConfirm.pending
+	l.toolConfirm.pending = nil
+	if p != nil {
+		p.timer.Stop()
+	}
+	return p
+}
+
+func (l *LLMManager) expireToolConfirm(p *pendingToolConfirm) {
+	l.toolConfirm.mu.Lock()
+	if l.toolConfirm.pending != p {
+		l.toolConfirm.mu.Unlock()
+		return
+	}
+	l.toolConfirm.pending = nil
+	l.toolConfirm.mu.Unlock()
+
+	log.Infof("工具 %s 等待确认超时，取消执行, 设备 %s", p.call.Function.Name, l.clientState.DeviceID)
+	l.recordToolConfirmDecision(context.Background(), p, toolconfirm.DecisionTimeout, "", true)
+}
+
+// CancelToolConfirm 会话结束时丢弃等待中的确认，记为超时
+func (l *LLMManager) CancelToolConfirm() {
+	if p := l.takeToolConfirm(); p != nil {
+		log.Infof("会话结束，取消等待确认的工具 %s", p.call.Function.Name)
+		l.recordToolConfirmDecision(context.Background(), p, toolconfirm.DecisionTimeout, "", false)
+	}
+}
+
+// HandleToolConfirmAnswer 有等待确认的工具调用时处理用户的回答，返回 true 表示本句已被消费。
+// 同意则执行；简短的拒绝播报已取消；较长的拒绝或听不出是否同意时放弃执行，并把这句话当作新的请求继续对话。
+func (l *LLMManager) HandleToolConfirmAnswer(ctx context.Context, text string) bool {
+	p := l.takeToolConfirm()
+	if p == nil {
+		return false
+	}
+	switch toolconfirm.ClassifyAnswer(text) {
+	case toolconfirm.AnswerYes:
+		log.Infof("用户同意执行工具 %s: %s", p.call.Function.Name, text)
+		l.runApprovedToolCall(ctx, p, text)
+		return true
+	case toolconfirm.AnswerNo:
+		short := toolconfirm.IsShortAnswer(text)
+		log.Infof("用户拒绝执行工具 %s: %s", p.call.Function.Name, text)
+		l.recordToolConfirmDecision(ctx, p, toolconfirm.DecisionRejected, text, short)
+		if !short {
+			return false
+		}
+		if err := l.AddTextToTTSQueue(i18n.Text(l.clientState.GetLanguage(), i18n.TextToolConfirmCanceled)); err != nil {
+			log.Warnf("播报取消提示失败: %v", err)
+		}
+		return true
+	default:
+		log.Infof("未能识别用户对工具 %s 的确认，按新请求处理: %s", p.call.Function.Name, text)
+		l.recordToolConfirmDecision(ctx, p, toolconfirm.DecisionUnclear, text, false)
+		return false
+	}
+}
+
+func decidedToolConfirmRecord(p *pendingToolConfirm, decision string, answer string) toolconfirm.Record {
+	record := p.record
+	now := time.Now()
+	record.Decision = decision
+	record.Answer = answer
+	record.DecidedAt = &now
+	return record
+}
+
+func confirmedToolCall(call schema.ToolCall) schema.ToolCall {
+	call.ID += toolConfirmCallIDSuffix
+	return call
+}
+
+// runApprovedToolCall 以一次只含该工具调用的 LLM 响应重新走工具调用流程，结果照常回给 LLM 生成回复
+func (l *LLMManager) runApprovedToolCall(ctx context.Context, p *pendingToolConfirm, answer string) {
+	call := confirmedToolCall(p.call)
+	ctx = context.WithValue(ctx, approvedToolCallKey, approvedToolCall{
+		id:     call.ID,
+		record: decidedToolConfirmRecord(p, toolconfirm.DecisionApproved, answer),
+	})
+
+	responseChan := make(chan llm_common.LLMResponseStruct, 1)
+	responseChan <- llm_common.LLMResponseStruct{IsStart: true, IsEnd: true, ToolCalls: []schema.ToolCall{call}}
+	close(responseChan)
+
+	l.clientState.SetState(client.StateThinking, "tool_confirmed")
+	if _, err := l.HandleLLMResponseChannelSync(ctx, nil, responseChan, l.einoTools); err != nil {
+		log.Errorf("执行已确认的工具 %s 失败: %v", call.Function.Name, err)
+	}
+}
+
+// recordToolConfirmDecision 记录未执行的确认结果：补一对 assistant(tool_calls) + tool 消息，
+// toMemory 为 false 时只写聊天历史，不进入 LLM 上下文（用户这句话随后会作为新请求，避免上下文顺序错乱）
+func (l *LLMManager) recordToolConfirmDecision(ctx context.Context, p *pendingToolConfirm, decision string, answer string, toMemory bool) {
+	call := confirmedToolCall(p.call)
+	result := toolConfirmDecisionResults[decision]
+	callMsg := schema.AssistantMessage("", []schema.ToolCall{call})
+	resultMsg := &schema.Message{
+		Role:       schema.Tool,
+		ToolCallID: call.ID,
+		Content:    result,
+		Extra:      toolConfirmExtra(decidedToolConfirmRecord(p, decision, answer)),
+	}
+	if toMemory {
+		l.AddLlmMessage(ctx, callMsg)
+		l.AddLlmMessage(ctx, resultMsg)
+	} else {
+		l.saveHistoryMessage(callMsg, call.ID)
+		l.saveHistoryMessage(resultMsg, call.ID)
+	}
+	l.publishToolCall(call, "", result, 0)
+}
+
+// saveHistoryMessage 只写聊天历史，不加入会话内存
+func (l *LLMManager) saveHistoryMessage(msg *schema.Message, callID string) {
+	hash := md5.Sum([]byte(fmt.Sprintf("%s-%s-%s", l.clientState.SessionID, msg.Role, callID)))
+	eventbus.Publish(eventbus.TopicAddMessage, &eventbus.AddMessageEvent{
+		ClientState: l.clientState,
+		TurnID:      l.clientState.TurnID(),
+		Msg:         *msg,
+		MessageID:   hex.EncodeToString(hash[:]),
+		Timestamp:   time.Now(),
+	})
+}
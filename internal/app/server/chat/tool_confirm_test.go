@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/toolconfirm"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+)
+
+func newToolConfirmTestManager(policies map[string]string) *LLMManager {
+	state := &client.ClientState{DeviceID: "dev1"}
+	state.DeviceConfig.ToolPolicies = policies
+	return &LLMManager{clientState: state}
+}
+
+func TestToolPolicyAgentOverridesGlobal(t *testing.T) {
+	viper.Set("chat.tool_confirm.policies", map[string]string{"unlock_*": "confirm", "reboot": "deny"})
+	defer viper.Set("chat.tool_confirm.policies", nil)
+
+	l := newToolConfirmTestManager(map[string]string{"reboot": "confirm", "unlock_garage": "allow"})
+	cases := map[string]string{
+		"unlock_door":   toolconfirm.PolicyConfirm,
+		"unlock_garage": toolconfirm.PolicyAllow,
+		"reboot":        toolconfirm.PolicyConfirm,
+		"get_weather":   toolconfirm.PolicyAllow,
+	}
+	for name, want := range cases {
+		if got := l.toolPolicy(name); got != want {
+			t.Errorf("toolPolicy(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestRemoveDeniedTools(t *testing.T) {
+	l := newToolConfirmTestManager(map[string]string{"delete_*": "deny"})
+	tools := map[string]tool.InvokableTool{
+		"files_delete_file": &fakeTool{name: "delete_file", server: "files"},
+		"files_read_file":   &fakeTool{name: "read_file", server: "files"},
+	}
+	l.removeDeniedTools(context.Background(), tools)
+	if _, ok := tools["files_delete_file"]; ok {
+		t.Fatalf("denied tool should be removed by its own name")
+	}
+	if _, ok := tools["files_read_file"]; !ok {
+		t.Fatalf("allowed tool should be kept")
+	}
+}
+
+func TestGateToolCallsDenyAndApproved(t *testing.T) {
+	l := newToolConfirmTestManager(map[string]string{"format_disk": "deny", "unlock_door": "confirm"})
+	var added []*schema.Message
+	addMessage := func(call schema.ToolCall, result string) *schema.Message {
+		msg := &schema.Message{Role: schema.Tool, ToolCallID: call.ID, Content: result}
+		added = append(added, msg)
+		return msg
+	}
+
+	unlock := toolCall("unlock_door", "{}")
+	ctx := context.WithValue(context.Background(), approvedToolCallKey, approvedToolCall{id: unlock.ID})
+	allowed, question := l.gateToolCalls(ctx, []schema.ToolCall{
+		toolCall("get_weather", "{}"), toolCall("format_disk", "{}"), unlock,
+	}, lookupOf(), addMessage)
+
+	if question != "" {
+		t.Fatalf("approved call should not ask again, got %q", question)
+	}
+	if len(allowed) != 2 || allowed[0].Function.Name != "get_weather" || allowed[1].Function.Name != "unlock_door" {
+		t.Fatalf("unexpected allowed calls: %+v", allowed)
+	}
+	if len(added) != 1 || added[0].ToolCallID != "format_disk" {
+		t.Fatalf("denied call should get a tool message: %+v", added)
+	}
+	record, ok := added[0].Extra[toolconfirm.MetadataKey].(toolconfirm.Record)
+	if !ok || record.Decision != toolconfirm.DecisionBlocked {
+		t.Fatalf("denied call should carry a blocked record: %+v", added[0].Extra)
+	}
+}
+
+func TestGateToolCallsUsesToolPolicyNames(t *testing.T) {
+	l := newToolConfirmTestManager(map[string]string{"delete_*": "deny"})
+	// 调用名是注册时的 key，策略只写了工具自身的名字
+	lookup := func(name string) (tool.InvokableTool, bool) {
+		if name == "files_delete_file" {
+			return &fakeTool{name: "delete_file", server: "files"}, true
+		}
+		return nil, false
+	}
+	addMessage := func(call schema.ToolCall, result string) *schema.Message {
+		return &schema.Message{Role: schema.Tool, ToolCallID: call.ID, Content: result}
+	}
+
+	allowed, question := l.gateToolCalls(context.Background(), []schema.ToolCall{toolCall("files_delete_file", "{}")}, lookup, addMessage)
+	if question != "" || len(allowed) != 0 {
+		t.Fatalf("call denied by the tool's own name should be blocked, allowed=%+v question=%q", allowed, question)
+	}
+}
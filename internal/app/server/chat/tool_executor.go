@@ -0,0 +1,321 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/pool"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultToolCallTimeout     = 15 * time.Second
+	defaultToolCallParallel    = 4
+	defaultToolResultMaxChars  = 4000
+	defaultToolCallMaxRounds   = 5
+	toolResultSummaryInputCap  = 20000 // 送去摘要的结果最多保留的字符数
+	toolResultOversizeTruncate = "truncate"
+	toolResultOversizeSummary  = "summarize"
+)
+
+// errToolCallTimeout 工具调用超时；超时后工具可能仍在后台执行，不能重试
+var errToolCallTimeout = errors.New("调用超时")
+
+// toolCallOverride 单个工具或 MCP 服务的超时/重试覆盖，未配置的字段沿用全局值
+type toolCallOverride struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+	Retries *int          `mapstructure:"retries"`
+}
+
+// toolCallPolicy 工具调用策略，来自 chat.tool_call 配置
+type toolCallPolicy struct {
+	MaxParallel    int                         // 同一轮内并发执行的工具数，1 表示顺序执行
+	Timeout        time.Duration               // 单次调用超时
+	RetryBackoff   time.Duration               // 第 n 次重试前等待 n*RetryBackoff
+	Servers        map[string]toolCallOverride // 按 MCP 服务名覆盖，支持前缀匹配（如 iot_over_mcp）；重试只能在这里或 Tools 中开启
+	Tools          map[string]toolCallOverride // 按工具名覆盖，优先级高于服务
+	MaxResultChars int                         // 回传给 LLM 的结果最大字符数，0 表示不限制
+	Oversize       string                      // 结果超长时的处理方式：truncate / summarize
+	SummaryTimeout time.Duration               // summarize 时调用 LLM 摘要的超时
+	MaxRounds      int                         // 一轮对话内连续工具调用的最大轮数，0 表示不限制
+	FillerAfter    time.Duration               // 工具执行超过该时长仍未返回时播报一句过渡语，0 表示关闭
+	FillerText     string                      // 过渡语，留空按对话语言使用内置话术
+}
+
+// loadToolCallPolicy 读取 chat.tool_call 配置并补齐默认值
+func loadToolCallPolicy() toolCallPolicy {
+	policy := toolCallPolicy{
+		MaxParallel:    viper.GetInt("chat.tool_call.max_parallel"),
+		Timeout:        viper.GetDuration("chat.tool_call.timeout"),
+		RetryBackoff:   viper.GetDuration("chat.tool_call.retry_backoff"),
+		MaxResultChars: defaultToolResultMaxChars,
+		Oversize:       strings.ToLower(strings.TrimSpace(viper.GetString("chat.tool_call.oversize"))),
+		SummaryTimeout: viper.GetDuration("chat.tool_call.summary_timeout"),
+		MaxRounds:      defaultToolCallMaxRounds,
+		FillerAfter:    viper.GetDuration("chat.tool_call.filler_after"),
+		FillerText:     strings.TrimSpace(viper.GetString("chat.tool_call.filler_text")),
+	}
+	if viper.IsSet("chat.tool_call.max_result_chars") {
+		policy.MaxResultChars = viper.GetInt("chat.tool_call.max_result_chars")
+	}
+	if viper.IsSet("chat.tool_call.max_rounds") {
+		policy.MaxRounds = viper.GetInt("chat.tool_call.max_rounds")
+	}
+	if policy.MaxParallel <= 0 {
+		policy.MaxParallel = defaultToolCallParallel
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultToolCallTimeout
+	}
+	if viper.GetInt("chat.tool_call.retries") > 0 {
+		log.Warnf("chat.tool_call.retries 已不再生效，工具调用默认不重试，请在 chat.tool_call.servers / tools 中为幂等的服务或工具单独配置 retries")
+	}
+	if policy.SummaryTimeout <= 0 {
+		policy.SummaryTimeout = 5 * time.Second
+	}
+	if policy.Oversize != toolResultOversizeSummary {
+		policy.Oversize = toolResultOversizeTruncate
+	}
+	if err := viper.UnmarshalKey("chat.tool_call.servers", &policy.Servers); err != nil {
+		log.Warnf("解析 chat.tool_call.servers 失败，忽略服务级配置: %v", err)
+		policy.Servers = nil
+	}
+	if err := viper.UnmarshalKey("chat.tool_call.tools", &policy.Tools); err != nil {
+		log.Warnf("解析 chat.tool_call.tools 失败，忽略工具级配置: %v", err)
+		policy.Tools = nil
+	}
+	return policy
+}
+
+// limitsFor 计算某个工具的超时与重试次数：全局值 < 服务覆盖（最长前缀） < 工具覆盖。
+// 重试可能重复产生副作用，默认不重试，只有服务或工具显式配置了 retries 才会重试。
+func (p toolCallPolicy) limitsFor(toolName, serverName string) (time.Duration, int) {
+	timeout, retries := p.Timeout, 0
+	apply := func(o toolCallOverride) {
+		if o.Timeout > 0 {
+			timeout = o.Timeout
+		}
+		if o.Retries != nil && *o.Retries >= 0 {
+			retries = *o.Retries
+		}
+	}
+	// viper 读取的 map key 均为小写
+	serverName, toolName = strings.ToLower(serverName), strings.ToLower(toolName)
+	if serverName != "" {
+		matched := ""
+		for name := range p.Servers {
+			if strings.HasPrefix(serverName, name) && len(name) > len(matched) {
+				matched = name
+			}
+		}
+		if matched != "" {
+			apply(p.Servers[matched])
+		}
+	}
+	if o, ok := p.Tools[toolName]; ok {
+		apply(o)
+	}
+	return timeout, retries
+}
+
+// toolCallResult 单个工具调用的执行结果
+type toolCallResult struct {
+	call     schema.ToolCall
+	tool     tool.InvokableTool // 未找到工具时为 nil
+	output   string
+	err      error
+	duration time.Duration
+	attempts int
+}
+
+// runToolCalls 按策略执行一轮工具调用：互不依赖的调用并发执行，结果按模型给出的顺序返回。
+// 任一调用执行超过 FillerAfter 仍未全部完成时调用一次 onSlow。
+func runToolCalls(ctx context.Context, calls []schema.ToolCall, lookup func(name string) (tool.InvokableTool, bool), policy toolCallPolicy, onSlow func()) []toolCallResult {
+	results := make([]toolCallResult, len(calls))
+	if len(calls) == 0 {
+		return results
+	}
+
+	done := make(chan struct{})
+	if policy.FillerAfter > 0 && onSlow != nil {
+		go func() {
+			timer := time.NewTimer(policy.FillerAfter)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				onSlow()
+			case <-done:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	sem := make(chan struct{}, max(policy.MaxParallel, 1))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		results[i].call = call
+		t, ok := lookup(call.Function.Name)
+		if !ok || t == nil {
+			results[i].err = fmt.Errorf("未找到工具: %s", call.Function.Name)
+			continue
+		}
+		results[i].tool = t
+		wg.Add(1)
+		go func(r *toolCallResult) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				r.err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			invokeToolWithRetry(ctx, r, policy)
+		}(&results[i])
+	}
+	wg.Wait()
+	close(done)
+	return results
+}
+
+// invokeToolWithRetry 执行单个工具调用，出错时按策略重试；超时不重试，因为超时的调用可能仍在执行
+func invokeToolWithRetry(ctx context.Context, r *toolCallResult, policy toolCallPolicy) {
+	toolName := r.call.Function.Name
+	var serverName string
+	if named, ok := r.tool.(interface{ ServerName() string }); ok {
+		serverName = named.ServerName()
+	}
+	timeout, retries := policy.limitsFor(toolName, serverName)
+
+	start := time.Now()
+	defer func() { r.duration = time.Since(start) }()
+	for attempt := 0; ; attempt++ {
+		r.attempts = attempt + 1
+		r.output, r.err = invokeToolWithTimeout(ctx, r.tool, r.call.Function.Arguments, timeout)
+		if r.err == nil || ctx.Err() != nil || attempt >= retries || errors.Is(r.err, errToolCallTimeout) {
+			return
+		}
+		backoff := policy.RetryBackoff * time.Duration(attempt+1)
+		log.Warnf("工具 %s 第 %d 次调用失败: %v，%s 后重试", toolName, attempt+1, r.err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// invokeToolWithTimeout 带超时执行一次工具调用；工具不响应 ctx 取消时也会按时返回，调用协程在后台自行结束
+func invokeToolWithTimeout(ctx context.Context, t tool.InvokableTool, args string, timeout time.Duration) (string, error) {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		output string
+		err    error
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		output, err := t.InvokableRun(callCtx, args)
+		ch <- outcome{output, err}
+	}()
+
+	select {
+	case o := <-ch:
+		if o.err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return "", fmt.Errorf("%w（%s）: %w", errToolCallTimeout, timeout, o.err)
+		}
+		return o.output, o.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("%w（%s）", errToolCallTimeout, timeout)
+	}
+}
+
+// truncateToolResult 按字符数截断工具结果，并注明原始长度，提示模型结果不完整
+func truncateToolResult(result string, maxChars int) string {
+	if maxChars <= 0 {
+		return result
+	}
+	runes := []rune(result)
+	if len(runes) <= maxChars {
+		return result
+	}
+	return string(runes[:maxChars]) + fmt.Sprintf("\n…（结果过长已截断，原始长度 %d 字符）", len(runes))
+}
+
+// toolRoundFromContext 当前处于本轮对话的第几轮工具调用，未调用过工具时为 0
+func toolRoundFromContext(ctx context.Context) int {
+	round, _ := ctx.Value(toolRoundKey).(int)
+	return round
+}
+
+// executeToolCalls 查找并执行模型返回的工具调用，执行较慢时播报过渡语
+func (l *LLMManager) executeToolCalls(ctx context.Context, calls []schema.ToolCall, policy toolCallPolicy) []toolCallResult {
+	state := l.clientState
+	onSlow := func() {
+		text := policy.FillerText
+		if text == "" {
+			text = i18n.Text(state.GetLanguage(), i18n.TextToolFiller)
+		}
+		log.Infof("工具执行超过 %s 未返回，播报过渡语: %s", policy.FillerAfter, text)
+		// 过渡语不计入助手回复，只进入当前 TTS 会话
+		if err := l.ttsManager.handleTextResponse(ctx, llm_common.LLMResponseStruct{Text: text, IsEnd: true}, false); err != nil {
+			log.Warnf("播报工具过渡语失败: %v", err)
+		}
+	}
+	return runToolCalls(ctx, calls, l.lookupTool, policy, onSlow)
+}
+
+// fitToolResult 结果超过 MaxResultChars 时按策略截断或调用 LLM 摘要，摘要失败时退回截断
+func (l *LLMManager) fitToolResult(ctx context.Context, toolName string, result string, policy toolCallPolicy) string {
+	if policy.MaxResultChars <= 0 || len([]rune(result)) <= policy.MaxResultChars {
+		return result
+	}
+	if policy.Oversize == toolResultOversizeSummary {
+		summary, err := l.summarizeToolResult(ctx, toolName, result, policy)
+		if err == nil && strings.TrimSpace(summary) != "" {
+			log.Infof("工具 %s 结果过长（%d 字符），已摘要为 %d 字符", toolName, len([]rune(result)), len([]rune(summary)))
+			return truncateToolResult(summary, policy.MaxResultChars)
+		}
+		log.Warnf("工具 %s 结果摘要失败，改为截断: %v", toolName, err)
+	}
+	log.Infof("工具 %s 结果过长（%d 字符），截断到 %d 字符", toolName, len([]rune(result)), policy.MaxResultChars)
+	return truncateToolResult(result, policy.MaxResultChars)
+}
+
+// summarizeToolResult 使用当前智能体的 LLM 对超长工具结果做摘要
+func (l *LLMManager) summarizeToolResult(ctx context.Context, toolName string, result string, policy toolCallPolicy) (string, error) {
+	llmWrapper, err := pool.Acquire[llm.LLMProvider](
+		"llm",
+		l.clientState.DeviceConfig.Llm.Provider,
+		l.clientState.DeviceConfig.Llm.Config,
+	)
+	if err != nil {
+		return "", fmt.Errorf("获取LLM资源失败: %w", err)
+	}
+	defer pool.Release(llmWrapper)
+
+	summaryCtx, cancel := context.WithTimeout(ctx, policy.SummaryTimeout)
+	defer cancel()
+
+	dialogue := []*schema.Message{
+		schema.SystemMessage(fmt.Sprintf("你是工具结果压缩助手。请保留与用户问题相关的关键事实、数字、名称和结论，删除冗余内容，输出不超过 %d 字的纯文本摘要，不要添加结果中没有的信息。", policy.MaxResultChars/2)),
+		schema.UserMessage(fmt.Sprintf("工具 %s 的返回结果：\n%s", toolName, truncateToolResult(result, toolResultSummaryInputCap))),
+	}
+	msgChan := llmWrapper.GetProvider().ResponseWithContext(summaryCtx, l.clientState.SessionID+":tool_summary", dialogue, nil)
+	return collectOpenClawWarmupResponse(summaryCtx, msgChan)
+}
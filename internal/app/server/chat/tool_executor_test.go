@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+type fakeTool struct {
+	name   string
+	server string
+	delay  time.Duration
+	hang   int32 // 前 hang 次调用耗时 delay，之后立即返回；-1 表示每次都耗时 delay
+	fail   int32 // 前 fail 次调用直接返回错误
+	calls  atomic.Int32
+}
+
+func (f *fakeTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: f.name}, nil
+}
+
+func (f *fakeTool) InvokableRun(ctx context.Context, args string, _ ...tool.Option) (string, error) {
+	n := f.calls.Add(1)
+	if n <= f.fail {
+		return "", errors.New("unavailable")
+	}
+	if f.hang < 0 || n <= f.hang {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return f.name + ":" + args, nil
+}
+
+func (f *fakeTool) ServerName() string { return f.server }
+func (f *fakeTool) IsLocal() bool      { return f.server == "" }
+
+func lookupOf(tools ...*fakeTool) func(string) (tool.InvokableTool, bool) {
+	return func(name string) (tool.InvokableTool, bool) {
+		for _, t := range tools {
+			if t.name == name {
+				return t, true
+			}
+		}
+		return nil, false
+	}
+}
+
+func toolCall(name, args string) schema.ToolCall {
+	return schema.ToolCall{ID: name, Function: schema.FunctionCall{Name: name, Arguments: args}}
+}
+
+func TestRunToolCallsParallelKeepsOrder(t *testing.T) {
+	a := &fakeTool{name: "a", delay: 100 * time.Millisecond, hang: -1}
+	b := &fakeTool{name: "b", delay: 100 * time.Millisecond, hang: -1}
+	c := &fakeTool{name: "c", delay: 10 * time.Millisecond, hang: -1}
+	policy := toolCallPolicy{MaxParallel: 4, Timeout: time.Second}
+
+	start := time.Now()
+	results := runToolCalls(context.Background(), []schema.ToolCall{
+		toolCall("a", "1"), toolCall("missing", ""), toolCall("b", "2"), toolCall("c", "3"),
+	}, lookupOf(a, b, c), policy, nil)
+	elapsed := time.Since(start)
+
+	if elapsed > 180*time.Millisecond {
+		t.Fatalf("tool calls should run concurrently, took %s", elapsed)
+	}
+	want := []string{"a:1", "", "b:2", "c:3"}
+	for i, r := range results {
+		if r.output != want[i] {
+			t.Fatalf("result %d = %q, want %q", i, r.output, want[i])
+		}
+	}
+	if results[1].tool != nil || results[1].err == nil {
+		t.Fatalf("missing tool should report an error: %+v", results[1])
+	}
+}
+
+func TestRunToolCallsSequentialWhenMaxParallelIsOne(t *testing.T) {
+	a := &fakeTool{name: "a", delay: 50 * time.Millisecond, hang: -1}
+	b := &fakeTool{name: "b", delay: 50 * time.Millisecond, hang: -1}
+	start := time.Now()
+	runToolCalls(context.Background(), []schema.ToolCall{toolCall("a", ""), toolCall("b", "")},
+		lookupOf(a, b), toolCallPolicy{MaxParallel: 1, Timeout: time.Second}, nil)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("max_parallel=1 should run tools one by one, took %s", elapsed)
+	}
+}
+
+func TestRunToolCallsTimeoutAndRetry(t *testing.T) {
+	// 超时的调用可能仍在执行，即使配置了重试也不再重试
+	slow := &fakeTool{name: "slow", server: "weather", delay: time.Second, hang: 1}
+	// 出错的调用在配置了重试时重试
+	flaky := &fakeTool{name: "flaky", server: "weather", fail: 1}
+	// 未配置重试的服务不重试
+	other := &fakeTool{name: "other", server: "news", fail: 1}
+	two := 2
+	policy := toolCallPolicy{MaxParallel: 4, Timeout: 50 * time.Millisecond, RetryBackoff: time.Millisecond,
+		Servers: map[string]toolCallOverride{"weather": {Retries: &two}}}
+
+	results := runToolCalls(context.Background(), []schema.ToolCall{toolCall("slow", "x"), toolCall("flaky", "y"), toolCall("other", "z")},
+		lookupOf(slow, flaky, other), policy, nil)
+
+	if r := results[0]; !errors.Is(r.err, errToolCallTimeout) || r.attempts != 1 || slow.calls.Load() != 1 {
+		t.Fatalf("timed out tool should not be retried: %+v", r)
+	}
+	if r := results[1]; r.err != nil || r.output != "flaky:y" || r.attempts != 2 {
+		t.Fatalf("failed tool should succeed on retry: %+v", r)
+	}
+	if r := results[2]; r.err == nil || r.attempts != 1 {
+		t.Fatalf("tool without retries configured should not be retried: %+v", r)
+	}
+}
+
+func TestRunToolCallsCanceled(t *testing.T) {
+	slow := &fakeTool{name: "slow", server: "s", delay: time.Second, hang: -1}
+	three := 3
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	results := runToolCalls(ctx, []schema.ToolCall{toolCall("slow", "")}, lookupOf(slow),
+		toolCallPolicy{MaxParallel: 1, Timeout: time.Second, Tools: map[string]toolCallOverride{"slow": {Retries: &three}}}, nil)
+	if !errors.Is(results[0].err, context.DeadlineExceeded) || results[0].attempts != 1 {
+		t.Fatalf("canceled session should stop without retry: %+v", results[0])
+	}
+}
+
+func TestRunToolCallsFiller(t *testing.T) {
+	slow := &fakeTool{name: "slow", delay: 100 * time.Millisecond, hang: -1}
+	fast := &fakeTool{name: "fast"}
+	policy := toolCallPolicy{MaxParallel: 4, Timeout: time.Second, FillerAfter: 30 * time.Millisecond}
+
+	var fillers atomic.Int32
+	onSlow := func() { fillers.Add(1) }
+	runToolCalls(context.Background(), []schema.ToolCall{toolCall("slow", ""), toolCall("fast", "")}, lookupOf(slow, fast), policy, onSlow)
+	if fillers.Load() != 1 {
+		t.Fatalf("filler should be spoken once for a slow round, got %d", fillers.Load())
+	}
+
+	fillers.Store(0)
+	runToolCalls(context.Background(), []schema.ToolCall{toolCall("fast", "")}, lookupOf(fast), policy, onSlow)
+	time.Sleep(50 * time.Millisecond)
+	if fillers.Load() != 0 {
+		t.Fatalf("filler should not be spoken for a fast round")
+	}
+}
+
+func TestToolCallPolicyLimitsFor(t *testing.T) {
+	zero, one, three := 0, 1, 3
+	policy := toolCallPolicy{
+		Timeout: 10 * time.Second,
+		Servers: map[string]toolCallOverride{
+			"weather":      {Retries: &one},
+			"iot_over_mcp": {Retries: &zero},
+			"search":       {Timeout: 20 * time.Second},
+			"search_news":  {Retries: &three},
+		},
+		Tools: map[string]toolCallOverride{"play_music": {Timeout: 30 * time.Second}},
+	}
+	cases := []struct {
+		tool, server string
+		timeout      time.Duration
+		retries      int
+	}{
+		{"get_weather", "weather", 10 * time.Second, 1},
+		{"set_volume", "iot_over_mcp_dev1", 10 * time.Second, 0},
+		{"query", "search_news", 10 * time.Second, 3},
+		{"query", "search_web", 20 * time.Second, 0},
+		{"play_music", "", 30 * time.Second, 0},
+	}
+	for _, c := range cases {
+		timeout, retries := policy.limitsFor(c.tool, c.server)
+		if timeout != c.timeout || retries != c.retries {
+			t.Errorf("limitsFor(%s, %s) = %s/%d, want %s/%d", c.tool, c.server, timeout, retries, c.timeout, c.retries)
+		}
+	}
+}
+
+func TestTruncateToolResult(t *testing.T) {
+	if got := truncateToolResult("短结果", 10); got != "短结果" {
+		t.Fatalf("short result should be kept: %q", got)
+	}
+	got := truncateToolResult(strings.Repeat("天气", 10), 5)
+	if !strings.HasPrefix(got, "天气天气天\n") || !strings.Contains(got, "原始长度 20 字符") {
+		t.Fatalf("unexpected truncated result: %q", got)
+	}
+	if got := truncateToolResult("abc", 0); got != "abc" {
+		t.Fatalf("max 0 should disable truncation: %q", got)
+	}
+}
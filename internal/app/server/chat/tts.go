@@ -8,9 +8,9 @@ import (
 	"sync/atomic"
 	"time"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
-	"xiaozhi-esp32-server-golang/internal/domain/tts"
-	"xiaozhi-esp32-server-golang/internal/pool"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/textnorm"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -61,6 +61,11 @@ type TTSManager struct {
 	sessionAudioQueue chan AudioQueueElem // 会话级全局音频队列，兼容帧与控制消息
 	interruptCh       chan struct{}       // 打断信号：收到后 runSenderLoop 清空 sessionAudioQueue 并继续
 	audioGeneration   atomic.Uint64       // 会话级音频代际：打断时递增，旧代际元素会被发送协程丢弃
+	ttsFallbackIndex  atomic.Int32        // 本轮使用的TTS候选序号，0 为主TTS；切换到备用后本轮保持，本轮结束或打断时重置
+
+	// 回声消除参考信号解码器，仅 runSenderLoop 使用
+	echoRefDecoder *audio.AudioProcesser
+	echoRefPcm     []float32
 
 	// 聊天历史音频缓存：持续累积多段TTS音频（Opus帧数组）
 	audioHistoryBuffer [][]byte
@@ -167,11 +172,12 @@ func (t *TTSManager) runSenderLoop(ctx context.Context) {
 				copy(frameCopy, elem.Data)
 				t.audioHistoryBuffer = append(t.audioHistoryBuffer, frameCopy)
 				t.audioMutex.Unlock()
+				t.pushEchoReference(elem.Data, playbackTail)
 				totalFrames++
 				currentSentenceFrames++
 				playbackTail = playbackTail.Add(frameDuration)
 				if needReportFirstFrame && totalFrames == 1 {
-					log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms", t.clientState.GetAsrLlmTtsDuration())
+					log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms, turnID: %s", t.clientState.GetAsrLlmTtsDuration(), t.clientState.TurnID())
 					needReportFirstFrame = false
 				}
 			case AudioQueueKindSentenceEnd:
@@ -262,6 +268,7 @@ func (t *TTSManager) enqueueSessionElem(ctx context.Context, generation uint64,
 // InterruptAndClearQueue 触发打断：通知 runSenderLoop 清空 sessionAudioQueue 后继续运行（非阻塞）
 func (t *TTSManager) InterruptAndClearQueue() {
 	t.nextAudioGeneration()
+	t.resetTTSFallback()
 	select {
 	case t.interruptCh <- struct{}{}:
 	default:
@@ -273,9 +280,10 @@ func (t *TTSManager) EnqueueTtsStart(ctx context.Context) {
 	t.enqueueSessionElem(ctx, t.currentAudioGeneration(), AudioQueueElem{Kind: AudioQueueKindTtsStart})
 }
 
-// EnqueueTtsStop 向会话级音频队列投递 TtsStop，由 runSenderLoop 统一发送；队列满时阻塞直到入队或 ctx.Done
+// EnqueueTtsStop 向会话级音频队列投递 TtsStop，由 runSenderLoop 统一发送；队列满时阻塞直到入队或 ctx.Done；同时结束本轮的备用TTS保持
 func (t *TTSManager) EnqueueTtsStop(ctx context.Context) {
 	t.enqueueSessionElem(ctx, t.currentAudioGeneration(), AudioQueueElem{Kind: AudioQueueKindTtsStop})
+	t.resetTTSFallback()
 }
 
 func (t *TTSManager) processTTSQueue(ctx context.Context) {
@@ -417,8 +425,8 @@ func (t *TTSManager) handleTextResponse(ctx context.Context, llmResponse llm_com
 	return nil
 }
 
-// getTTSProviderInstance 获取TTS Provider实例（使用provider+音色作为资源池唯一key）
-func (t *TTSManager) getTTSProviderInstance() (*pool.ResourceWrapper[tts.TTSProvider], error) {
+// primaryTTSCandidate 当前主TTS：声纹TTS配置优先，其次默认TTS配置（叠加当前语言的专属音色）
+func (t *TTSManager) primaryTTSCandidate() ttsCandidate {
 	// 获取TTS配置和provider
 	var ttsConfig map[string]interface{}
 	var ttsProvider string
@@ -441,68 +449,67 @@ func (t *TTSManager) getTTSProviderInstance() (*pool.ResourceWrapper[tts.TTSProv
 		// 使用默认TTS配置
 		ttsProvider = t.clientState.DeviceConfig.Tts.Provider
 		ttsConfig = t.clientState.DeviceConfig.Tts.Config
+		// 当前对话语言配置了专属音色时覆盖默认音色
+		if languageVoice := t.clientState.GetLanguageVoice(); languageVoice != "" {
+			ttsConfig = withVoiceID(ttsProvider, ttsConfig, languageVoice)
+		}
 	}
 
-	// 逻辑标识（用于日志与指纹计算）：provider 或 provider:voiceID
-	voiceID := extractVoiceID(ttsConfig)
-	providerLabel := ttsProvider
-	if voiceID != "" {
-		providerLabel = fmt.Sprintf("%s:%s", ttsProvider, voiceID)
-	}
+	return newTTSCandidate(ttsProvider, ttsConfig)
+}
 
-	// 从资源池获取TTS资源（池 key 由配置指纹决定，host/voice 等变更会自动换池）
-	ttsWrapper, err := pool.Acquire[tts.TTSProvider]("tts", providerLabel, ttsConfig)
-	if err != nil {
-		log.Errorf("获取TTS资源失败: %v", err)
-		return nil, fmt.Errorf("获取TTS资源失败: %v", err)
+// voiceIDKey 音色ID在TTS配置中的字段名：cosyvoice 使用 spk_id，minimax 和其他 provider 使用 voice
+func voiceIDKey(provider string) string {
+	if provider == "cosyvoice" {
+		return "spk_id"
 	}
-
-	return ttsWrapper, nil
+	return "voice"
 }
 
-// extractVoiceID 从配置中提取音色ID
-func extractVoiceID(config map[string]interface{}) string {
+// extractVoiceID 从配置中提取音色ID，provider 为空时读取配置中的 provider 字段
+func extractVoiceID(provider string, config map[string]interface{}) string {
 	if config == nil {
 		return ""
 	}
-
-	// 尝试从config中获取provider类型
-	provider, _ := config["provider"].(string)
-
-	// cosyvoice使用spk_id字段
-	if provider == "cosyvoice" {
-		if spkID, ok := config["spk_id"].(string); ok && spkID != "" {
-			return spkID
-		}
-		return ""
+	if provider == "" {
+		provider, _ = config["provider"].(string)
 	}
-
-	// minimax和其他provider：使用voice
-	if voice, ok := config["voice"].(string); ok && voice != "" {
-		return voice
+	if voiceID, ok := config[voiceIDKey(provider)].(string); ok && voiceID != "" {
+		return voiceID
 	}
-
 	return ""
 }
 
+// withVoiceID 复制配置并替换音色ID，provider 来自 DeviceConfig.Tts.Provider（配置 map 中通常不带 provider 字段）
+func withVoiceID(provider string, config map[string]interface{}, voiceID string) map[string]interface{} {
+	result := make(map[string]interface{}, len(config)+1)
+	for k, v := range config {
+		result[k] = v
+	}
+	result[voiceIDKey(provider)] = voiceID
+	return result
+}
+
 // generateTtsOnly 方案 C：仅做 TTS 生成，不发送；返回音频 channel 与发送完成后需调用的 ReleaseFunc
 func (t *TTSManager) generateTtsOnly(ctx context.Context, llmResponse llm_common.LLMResponseStruct) (outputChan <-chan []byte, releaseFunc func(), err error) {
 	if strings.TrimSpace(llmResponse.Text) == "" {
 		return nil, nil, nil
 	}
-	ttsWrapper, err := t.getTTSProviderInstance()
-	if err != nil {
-		log.Errorf("获取TTS Provider实例失败: %v", err)
-		return nil, nil, err
+	// 仅送给 TTS 的文本做朗读归一化，sentence_start 与历史仍使用原文
+	ttsText := textnorm.Normalize(llmResponse.Text, textnorm.LoadOptions(t.clientState.GetLanguage(), t.clientState.DeviceConfig.PronunciationDict))
+	if ttsText == "" {
+		log.Debugf("TTS文本归一化后无可朗读内容，跳过: %s", llmResponse.Text)
+		return nil, nil, nil
+	}
+	if ttsText != llmResponse.Text {
+		log.Debugf("TTS文本归一化: %s -> %s", llmResponse.Text, ttsText)
 	}
-	ttsProviderInstance := ttsWrapper.GetProvider()
-	ch, err := ttsProviderInstance.TextToSpeechStream(ctx, llmResponse.Text, t.clientState.OutputAudioFormat.SampleRate, t.clientState.OutputAudioFormat.Channels, t.clientState.OutputAudioFormat.FrameDuration)
+	ch, release, err := t.synthesizeWithFailover(ctx, ttsText)
 	if err != nil {
-		pool.Release(ttsWrapper)
 		log.Errorf("生成 TTS 音频失败: %v", err)
 		return nil, nil, fmt.Errorf("生成 TTS 音频失败: %v", err)
 	}
-	return ch, func() { pool.Release(ttsWrapper) }, nil
+	return ch, release, nil
 }
 
 // handleStreamTts 流式 TTS：从 item.StreamChan 读并逐条 generateTtsOnly，向 sessionAudioQueue 推送 SentenceStart → Frame… → SentenceEnd
@@ -679,7 +686,7 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan <-chan []byte,
 
 			// 统计信息记录（仅在开始时记录一次）
 			if isStart && isStatistic && totalFrames == 1 {
-				log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms", t.clientState.GetAsrLlmTtsDuration())
+				log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms, turnID: %s", t.clientState.GetAsrLlmTtsDuration(), t.clientState.TurnID())
 				isStatistic = false
 			}
 		}
@@ -0,0 +1,344 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/tts"
+	"xiaozhi-esp32-server-golang/internal/pool"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	// 备用TTS等待首帧的默认超时，超时视为当前TTS失败并切换到下一个
+	defaultTTSFirstFrameTimeout = 8 * time.Second
+	// 首帧之后等待下一帧的默认超时，超时视为断流
+	defaultTTSStallTimeout = 5 * time.Second
+)
+
+// ttsCandidate 一个可用于合成的TTS配置
+type ttsCandidate struct {
+	provider  string
+	config    map[string]interface{}
+	label     string // provider 或 provider:voiceID，用于日志与资源池
+	healthKey string // 配置指纹，与资源池一致，用于健康状态统计
+}
+
+func newTTSCandidate(provider string, config map[string]interface{}) ttsCandidate {
+	label := provider
+	if voiceID := extractVoiceID(provider, config); voiceID != "" {
+		label = fmt.Sprintf("%s:%s", provider, voiceID)
+	}
+	return ttsCandidate{
+		provider:  provider,
+		config:    config,
+		label:     label,
+		healthKey: pool.GenerateConfigKey(label, config),
+	}
+}
+
+// ttsCandidates 主TTS + 备用TTS；智能体配置了备用TTS时使用智能体的，否则使用 tts.failover.providers
+func (t *TTSManager) ttsCandidates() []ttsCandidate {
+	primary := t.primaryTTSCandidate()
+	candidates := []ttsCandidate{primary}
+	fallbacks := t.clientState.DeviceConfig.TtsFallbacks
+	if len(fallbacks) == 0 {
+		fallbacks = globalTTSFallbacks()
+	}
+	for _, fallback := range fallbacks {
+		if fallback.Provider == "" {
+			continue
+		}
+		candidate := newTTSCandidate(fallback.Provider, fallback.Config)
+		if candidate.healthKey == primary.healthKey {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// globalTTSFallbacks 从 tts.failover.providers 读取全局备用TTS，配置取自 tts.<provider>
+func globalTTSFallbacks() []types.TtsConfig {
+	names := viper.GetStringSlice("tts.failover.providers")
+	fallbacks := make([]types.TtsConfig, 0, len(names))
+	for _, name := range names {
+		config := viper.GetStringMap("tts." + name)
+		if len(config) == 0 {
+			log.Warnf("备用TTS %s 缺少 tts.%s 配置，已忽略", name, name)
+			continue
+		}
+		fallbacks = append(fallbacks, types.TtsConfig{Provider: name, Config: config})
+	}
+	return fallbacks
+}
+
+func (t *TTSManager) resetTTSFallback() {
+	t.ttsFallbackIndex.Store(0)
+}
+
+// currentTTSFallback 本轮当前使用的候选序号，超出范围时回到主TTS
+func (t *TTSManager) currentTTSFallback(candidates []ttsCandidate) int {
+	idx := int(t.ttsFallbackIndex.Load())
+	if idx < 0 || idx >= len(candidates) {
+		return 0
+	}
+	return idx
+}
+
+// synthesizeWithFailover 从本轮当前使用的TTS开始依次尝试合成，成功后本轮后续句子保持使用该TTS，避免音色来回切换。
+// 首帧之后断流同样触发切换：换下一个TTS重新合成本句并继续输出。
+func (t *TTSManager) synthesizeWithFailover(ctx context.Context, text string) (<-chan []byte, func(), error) {
+	candidates := t.ttsCandidates()
+	order := failoverOrder(candidates, t.currentTTSFallback(candidates))
+
+	stream, pos, err := t.openTTSStream(ctx, text, candidates, order, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pos == len(order)-1 {
+		return stream.frames, stream.release, nil
+	}
+	reopen := func(relayCtx context.Context) (ttsStream, time.Duration, error) {
+		failed := candidates[order[pos]]
+		tts.ReportFailure(failed.healthKey, failed.label, errors.New("音频流中断"))
+		log.Warnf("TTS %s 合成中途断流，改用备用TTS重新合成本句", failed.label)
+		next, nextPos, err := t.openTTSStream(relayCtx, text, candidates, order, pos+1)
+		if err != nil {
+			return ttsStream{}, 0, err
+		}
+		pos = nextPos
+		if pos == len(order)-1 {
+			return next, 0, nil
+		}
+		return next, ttsStallTimeout(), nil
+	}
+	frames, release := relayFrames(ctx, stream, ttsStallTimeout(), reopen)
+	return frames, release, nil
+}
+
+// openTTSStream 按 order[from:] 依次尝试直到某个TTS产生首帧，返回该流及其在 order 中的位置
+func (t *TTSManager) openTTSStream(ctx context.Context, text string, candidates []ttsCandidate, order []int, from int) (ttsStream, int, error) {
+	lastErr := errors.New("没有可用的TTS")
+	for i := from; i < len(order); i++ {
+		idx := order[i]
+		candidate := candidates[idx]
+		// 最后一个候选不设首帧超时，保持与单一TTS时相同的行为
+		firstFrameTimeout := time.Duration(0)
+		if i < len(order)-1 {
+			firstFrameTimeout = ttsFirstFrameTimeout()
+		}
+		stream, err := t.synthesizeWith(ctx, candidate, text, firstFrameTimeout)
+		if err == nil {
+			tts.ReportSuccess(candidate.healthKey, candidate.label)
+			if cur := t.currentTTSFallback(candidates); idx != cur {
+				t.ttsFallbackIndex.Store(int32(idx))
+				log.Warnf("TTS %s 不可用，本轮改用 %s", candidates[cur].label, candidate.label)
+			}
+			return stream, i, nil
+		}
+		if ctx.Err() != nil {
+			return ttsStream{}, i, ctx.Err()
+		}
+		tts.ReportFailure(candidate.healthKey, candidate.label, err)
+		log.Warnf("TTS %s 合成失败: %v", candidate.label, err)
+		lastErr = err
+	}
+	return ttsStream{}, len(order), lastErr
+}
+
+// relayFrames 转发音频流；等待下一帧超过 stallTimeout 视为断流，取消当前合成并通过 reopen 换下一个TTS继续转发。
+// reopen 返回的超时为 0 表示已是最后一个候选，不再检测断流。
+func relayFrames(ctx context.Context, stream ttsStream, stallTimeout time.Duration, reopen func(context.Context) (ttsStream, time.Duration, error)) (<-chan []byte, func()) {
+	out := make(chan []byte, cap(stream.frames))
+	relayCtx, stop := context.WithCancel(ctx)
+
+	var mu sync.Mutex
+	current := stream
+	released := false
+	release := func() {
+		stop()
+		mu.Lock()
+		defer mu.Unlock()
+		if !released {
+			released = true
+			current.release()
+		}
+	}
+	// swap 替换当前流并中止旧流；已释放时直接中止新流
+	swap := func(next ttsStream) bool {
+		mu.Lock()
+		old := current
+		if released {
+			mu.Unlock()
+			next.abort()
+			return false
+		}
+		current = next
+		mu.Unlock()
+		old.abort()
+		return true
+	}
+
+	go func() {
+		defer close(out)
+		frames := stream.frames
+		timer := time.NewTimer(stallTimeout)
+		defer timer.Stop()
+		for {
+			var stalled <-chan time.Time
+			if stallTimeout > 0 {
+				timer.Reset(stallTimeout)
+				stalled = timer.C
+			}
+			select {
+			case <-relayCtx.Done():
+				return
+			case frame, ok := <-frames:
+				if !ok {
+					return
+				}
+				select {
+				case out <- frame:
+				case <-relayCtx.Done():
+					return
+				}
+			case <-stalled:
+				next, timeout, err := reopen(relayCtx)
+				if err != nil {
+					log.Warnf("备用TTS合成失败: %v", err)
+					swap(ttsStream{frames: closedFrames, cancel: func() {}, release: func() {}})
+					return
+				}
+				if !swap(next) {
+					return
+				}
+				frames = next.frames
+				stallTimeout = timeout
+			}
+		}
+	}()
+	return out, release
+}
+
+var closedFrames = func() chan []byte {
+	ch := make(chan []byte)
+	close(ch)
+	return ch
+}()
+
+// failoverOrder 从 start 开始的候选顺序，冷却期内的候选排到最后（全部不可用时仍会尝试，避免无声）
+func failoverOrder(candidates []ttsCandidate, start int) []int {
+	healthy := make([]int, 0, len(candidates))
+	unhealthy := make([]int, 0)
+	for i := start; i < len(candidates); i++ {
+		if tts.IsHealthy(candidates[i].healthKey) {
+			healthy = append(healthy, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func ttsFirstFrameTimeout() time.Duration {
+	if ms := viper.GetInt("tts.failover.first_frame_timeout_ms"); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultTTSFirstFrameTimeout
+}
+
+func ttsStallTimeout() time.Duration {
+	if ms := viper.GetInt("tts.failover.stall_timeout_ms"); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultTTSStallTimeout
+}
+
+// ttsStream 一次合成的音频流
+type ttsStream struct {
+	frames  <-chan []byte
+	cancel  context.CancelFunc
+	release func() // 取消合成并归还资源，音频发送完成后调用
+}
+
+// abort 中止合成：取消后等待合成协程退出再归还资源
+func (s ttsStream) abort() {
+	s.cancel()
+	go drainAndRelease(s.frames, s.release)
+}
+
+// synthesizeWith 使用指定TTS合成并等待首帧：未产生任何音频就结束或超时视为失败，此时尚未下发音频，可安全换下一个TTS重试
+func (t *TTSManager) synthesizeWith(ctx context.Context, candidate ttsCandidate, text string, firstFrameTimeout time.Duration) (ttsStream, error) {
+	ttsWrapper, err := pool.Acquire[tts.TTSProvider]("tts", candidate.label, candidate.config)
+	if err != nil {
+		return ttsStream{}, fmt.Errorf("获取TTS资源失败: %v", err)
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	release := func() {
+		cancel()
+		pool.Release(ttsWrapper)
+	}
+
+	format := t.clientState.OutputAudioFormat
+	ch, err := ttsWrapper.GetProvider().TextToSpeechStream(streamCtx, text, format.SampleRate, format.Channels, format.FrameDuration)
+	if err != nil {
+		release()
+		return ttsStream{}, err
+	}
+
+	var timeout <-chan time.Time
+	if firstFrameTimeout > 0 {
+		timer := time.NewTimer(firstFrameTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		cancel()
+		go drainAndRelease(ch, release)
+		return ttsStream{}, ctx.Err()
+	case <-timeout:
+		cancel()
+		go drainAndRelease(ch, release)
+		return ttsStream{}, fmt.Errorf("等待首帧超时(%v)", firstFrameTimeout)
+	case frame, ok := <-ch:
+		if !ok {
+			release()
+			return ttsStream{}, errors.New("未产生音频即结束")
+		}
+		return ttsStream{frames: prependFrame(streamCtx, frame, ch), cancel: cancel, release: release}, nil
+	}
+}
+
+// drainAndRelease 等待已取消的合成协程退出后再归还资源，避免资源被复用时仍在写入
+func drainAndRelease(ch <-chan []byte, release func()) {
+	for range ch {
+	}
+	release()
+}
+
+// prependFrame 把已读取的首帧放回输出 channel 头部
+func prependFrame(ctx context.Context, first []byte, rest <-chan []byte) <-chan []byte {
+	out := make(chan []byte, cap(rest)+1)
+	out <- first
+	go func() {
+		defer close(out)
+		for frame := range rest {
+			select {
+			case out <- frame:
+			case <-ctx.Done():
+				for range rest {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
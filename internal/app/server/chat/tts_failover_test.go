@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/data/client"
+	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/tts"
+)
+
+func TestFailoverOrder(t *testing.T) {
+	candidates := []ttsCandidate{
+		newTTSCandidate("doubao_ws", map[string]interface{}{"voice": "a"}),
+		newTTSCandidate("edge", map[string]interface{}{"voice": "b"}),
+		newTTSCandidate("edge_offline", map[string]interface{}{"server_url": "ws://x"}),
+	}
+	if candidates[0].label != "doubao_ws:a" || candidates[2].label != "edge_offline" {
+		t.Fatalf("unexpected labels: %q %q", candidates[0].label, candidates[2].label)
+	}
+
+	if got := failoverOrder(candidates, 0); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	// 本轮已切到备用时不再回到主TTS
+	if got := failoverOrder(candidates, 1); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("unexpected sticky order: %v", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		tts.ReportFailure(candidates[1].healthKey, candidates[1].label, errors.New("down"))
+	}
+	defer tts.ReportSuccess(candidates[1].healthKey, candidates[1].label)
+	if got := failoverOrder(candidates, 0); !reflect.DeepEqual(got, []int{0, 2, 1}) {
+		t.Fatalf("unhealthy candidate should move to the end: %v", got)
+	}
+}
+
+func TestPrimaryTTSCandidateLanguageVoice(t *testing.T) {
+	tests := []struct {
+		provider  string
+		config    map[string]interface{}
+		wantKey   string
+		wantLabel string
+	}{
+		{provider: "cosyvoice", config: map[string]interface{}{"spk_id": "default_spk"}, wantKey: "spk_id", wantLabel: "cosyvoice:en_voice"},
+		{provider: "edge", config: map[string]interface{}{"voice": "zh-CN-XiaoxiaoNeural"}, wantKey: "voice", wantLabel: "edge:en_voice"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.provider, func(t *testing.T) {
+			state := &client.ClientState{DeviceConfig: utypes.UConfig{
+				Tts:            utypes.TtsConfig{Provider: tc.provider, Config: tc.config},
+				Language:       "en",
+				LanguageVoices: map[string]string{"en": "en_voice"},
+			}}
+			candidate := (&TTSManager{clientState: state}).primaryTTSCandidate()
+			if got := candidate.config[tc.wantKey]; got != "en_voice" {
+				t.Fatalf("%s = %v, want en_voice (config %v)", tc.wantKey, got, candidate.config)
+			}
+			if tc.wantKey == "spk_id" {
+				if _, ok := candidate.config["voice"]; ok {
+					t.Fatalf("cosyvoice 不应写入 voice: %v", candidate.config)
+				}
+			}
+			if candidate.label != tc.wantLabel {
+				t.Fatalf("label = %q, want %q", candidate.label, tc.wantLabel)
+			}
+			// 不修改智能体原始配置
+			if tc.config[tc.wantKey] == "en_voice" {
+				t.Fatalf("原始配置被修改: %v", tc.config)
+			}
+		})
+	}
+}
+
+func TestPrependFrame(t *testing.T) {
+	rest := make(chan []byte, 2)
+	rest <- []byte("b")
+	rest <- []byte("c")
+	close(rest)
+
+	var got []string
+	for frame := range prependFrame(context.Background(), []byte("a"), rest) {
+		got = append(got, string(frame))
+	}
+	if !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected frames: %v", got)
+	}
+}
+
+func testTTSStream(frames chan []byte) (ttsStream, *bool) {
+	released := false
+	_, cancel := context.WithCancel(context.Background())
+	return ttsStream{frames: frames, cancel: cancel, release: func() { cancel(); released = true }}, &released
+}
+
+// 首帧之后断流时切换到下一个TTS继续输出
+func TestRelayFramesFailoverAfterFirstFrame(t *testing.T) {
+	stalled := make(chan []byte, 1)
+	stalled <- []byte("a")
+	first, _ := testTTSStream(stalled)
+
+	backup := make(chan []byte, 2)
+	backup <- []byte("x")
+	backup <- []byte("y")
+	close(backup)
+	second, secondReleased := testTTSStream(backup)
+
+	reopened := 0
+	out, release := relayFrames(context.Background(), first, 20*time.Millisecond, func(context.Context) (ttsStream, time.Duration, error) {
+		reopened++
+		return second, 0, nil
+	})
+	var got []string
+	for frame := range out {
+		got = append(got, string(frame))
+	}
+	// 断流的流被取消后 drainAndRelease 才会结束
+	close(stalled)
+	release()
+	if !reflect.DeepEqual(got, []string{"a", "x", "y"}) || reopened != 1 {
+		t.Fatalf("frames=%v reopened=%d", got, reopened)
+	}
+	if !*secondReleased {
+		t.Fatalf("current stream not released")
+	}
+}
+
+func TestRelayFramesReopenFailure(t *testing.T) {
+	stalled := make(chan []byte)
+	first, _ := testTTSStream(stalled)
+	out, release := relayFrames(context.Background(), first, 10*time.Millisecond, func(context.Context) (ttsStream, time.Duration, error) {
+		return ttsStream{}, 0, errors.New("all down")
+	})
+	defer release()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatalf("unexpected frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("relay did not stop after reopen failure")
+	}
+	close(stalled)
+}
@@ -3,6 +3,7 @@ package chat
 import (
 	"context"
 
+	"xiaozhi-esp32-server-golang/internal/data/reminder"
 	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
 )
 
@@ -27,6 +28,18 @@ type ChatSessionOperator interface {
 	// LocalMcpSearchKnowledge 检索当前智能体关联知识库
 	LocalMcpSearchKnowledge(ctx context.Context, query string, topK int, knowledgeBaseIDs []uint) ([]config_types.KnowledgeSearchHit, error)
 
+	// LocalMcpCreateReminder 为当前设备创建定时提醒
+	LocalMcpCreateReminder(ctx context.Context, req *reminder.CreateRequest) (*reminder.Reminder, error)
+
+	// LocalMcpListReminders 查询当前设备待执行的提醒
+	LocalMcpListReminders(ctx context.Context) ([]reminder.Reminder, error)
+
+	// LocalMcpCancelReminder 取消当前设备的提醒
+	LocalMcpCancelReminder(ctx context.Context, reminderID uint) error
+
+	// LocalMcpGetLanguage 获取当前对话语言
+	LocalMcpGetLanguage() string
+
 	// 未来可以根据需要添加其他操作
 	// GetDeviceID() string
 	// IsActive() bool
@@ -4,7 +4,7 @@ import (
 	"strings"
 	"unicode"
 
-	"github.com/spf13/viper"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 )
 
 // removePunctuation 移除文本中的标点符号
@@ -22,13 +22,19 @@ func removePunctuation(text string) string {
 	return builder.String()
 }
 
-// isWakeupWord 检查文本是否是唤醒词
-func isWakeupWord(text string) bool {
-	wakeupWords := viper.GetStringSlice("wakeup_words")
-	for _, word := range wakeupWords {
-		if text == word {
-			return true
+// matchWakeupWord 检查文本是否是唤醒词，返回唤醒词所属的语言。
+// 设备固件的唤醒词与智能体语言无关，因此总是匹配全部语言的唤醒词。
+func matchWakeupWord(text string) (string, bool) {
+	normalizedText := strings.ToLower(removePunctuation(text))
+	if normalizedText == "" {
+		return "", false
+	}
+	for _, language := range i18n.Languages() {
+		for _, word := range i18n.WakeupWords(language) {
+			if normalizedText == strings.ToLower(removePunctuation(word)) {
+				return language, true
+			}
 		}
 	}
-	return false
+	return "", false
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// defaultBridgeTopics 默认桥接的主题：设备上下线、会话开始/结束、工具调用、OpenClaw 模式切换
+var defaultBridgeTopics = []string{"device_*", "session_*", "tool_call", "openclaw_mode"}
+
+// setupEventBridge 按配置把选定主题桥接到 Redis pub/sub 或 NATS，供其他服务订阅
+func (a *App) setupEventBridge() {
+	if !viper.GetBool("eventbus.bridge.enable") {
+		return
+	}
+	topics := viper.GetStringSlice("eventbus.bridge.topics")
+	if len(topics) == 0 {
+		topics = defaultBridgeTopics
+	}
+	source := viper.GetString("eventbus.bridge.source")
+	if source == "" {
+		source, _ = os.Hostname()
+	}
+
+	bridgeType := viper.GetString("eventbus.bridge.type")
+	bridge, err := newEventBridge(bridgeType)
+	if err != nil {
+		log.Errorf("创建事件桥接失败, type=%s: %v", bridgeType, err)
+		return
+	}
+	if _, err := eventbus.Get().AddBridge(bridgeType, bridge, source, topics...); err != nil {
+		bridge.Close()
+		log.Errorf("注册事件桥接失败, type=%s: %v", bridgeType, err)
+		return
+	}
+	log.Infof("事件桥接已启用, type=%s, topics=%v, source=%s", bridgeType, topics, source)
+}
+
+func newEventBridge(bridgeType string) (eventbus.Bridge, error) {
+	switch bridgeType {
+	case "redis":
+		// 未单独配置时复用全局 redis 配置
+		host := viper.GetString("eventbus.bridge.redis.host")
+		port := viper.GetInt("eventbus.bridge.redis.port")
+		password := viper.GetString("eventbus.bridge.redis.password")
+		db := viper.GetInt("eventbus.bridge.redis.db")
+		if host == "" {
+			host = viper.GetString("redis.host")
+			port = viper.GetInt("redis.port")
+			password = viper.GetString("redis.password")
+			db = viper.GetInt("redis.db")
+		}
+		if port == 0 {
+			port = 6379
+		}
+		prefix := viper.GetString("eventbus.bridge.channel_prefix")
+		if prefix == "" {
+			prefix = "xiaozhi:events:"
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", host, port),
+			Password: password,
+			DB:       db,
+		})
+		return eventbus.NewRedisBridge(client, prefix), nil
+	case "nats":
+		prefix := viper.GetString("eventbus.bridge.channel_prefix")
+		if prefix == "" {
+			prefix = "xiaozhi.events."
+		}
+		return eventbus.NewNATSBridge(eventbus.NATSConfig{
+			URL:           viper.GetString("eventbus.bridge.nats.url"),
+			Token:         viper.GetString("eventbus.bridge.nats.token"),
+			SubjectPrefix: prefix,
+			Name:          "xiaozhi-esp32-server",
+		})
+	default:
+		return nil, fmt.Errorf("不支持的桥接类型: %s", bridgeType)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"hash/fnv"
 	"sync"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/data/webhook"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -180,6 +181,8 @@ type EventHandle struct {
 	workerPool *UnifiedWorkerPool
 	// App 引用，用于获取 ChatManager
 	app *App
+	// 回调事件上报使用独立的worker池（未启用回调时为nil）
+	webhookPool *UnifiedWorkerPool
 }
 
 // SessionEndHandler SessionEnd事件处理器
@@ -277,7 +280,7 @@ func NewEventHandle(app *App) (*EventHandle, error) {
 
 	// 注册SessionEnd处理器
 	sessionEndHandler := &SessionEndHandler{}
-	workerPool.RegisterHandler(eventbus.TopicSessionEnd, sessionEndHandler)
+	workerPool.RegisterHandler(eventbus.TopicNameSessionEnd, sessionEndHandler)
 
 	handle := &EventHandle{
 		workerPool: workerPool,
@@ -288,7 +291,13 @@ func NewEventHandle(app *App) (*EventHandle, error) {
 	exitChatHandler := &ExitChatHandler{
 		eventHandle: handle,
 	}
-	workerPool.RegisterHandler(eventbus.TopicExitChat, exitChatHandler)
+	workerPool.RegisterHandler(eventbus.TopicNameExitChat, exitChatHandler)
+
+	// 注册回调事件上报处理器（仅 manager 配置模式下启用）
+	if client := webhook.Default(); client != nil {
+		handle.webhookPool = NewUnifiedWorkerPool(webhookWorkerNum)
+		handle.webhookPool.RegisterHandler(webhookTopic, &WebhookHandler{client: client})
+	}
 
 	log.Infof("EventHandle初始化完成（使用统一worker池处理多个topic，Redis处理已迁移至MessageWorker）")
 	return handle, nil
@@ -301,6 +310,9 @@ func (s *EventHandle) Start() error {
 	// 订阅ExitChat事件
 	go s.HandleExitChat()
 
+	// 订阅需要上报到回调的事件
+	go s.HandleWebhookEvents()
+
 	// 在这里可以添加其他topic的订阅
 	// go s.HandleDeviceOnline()
 
@@ -309,28 +321,28 @@ func (s *EventHandle) Start() error {
 
 // HandleSessionEnd 订阅并处理SessionEnd事件
 func (s *EventHandle) HandleSessionEnd() error {
-	eventbus.Get().Subscribe(eventbus.TopicSessionEnd, func(clientState *ClientState) {
+	eventbus.Subscribe(eventbus.TopicSessionEnd, func(clientState *ClientState) {
 		if clientState == nil {
 			log.Warnf("HandleSessionEnd: clientState is nil, skipping")
 			return
 		}
 
 		// 路由到统一的worker池
-		s.workerPool.Route(eventbus.TopicSessionEnd, clientState)
+		s.workerPool.Route(eventbus.TopicNameSessionEnd, clientState)
 	})
 	return nil
 }
 
 // HandleExitChat 订阅并处理ExitChat事件
 func (s *EventHandle) HandleExitChat() error {
-	eventbus.Get().Subscribe(eventbus.TopicExitChat, func(event *eventbus.ExitChatEvent) {
+	eventbus.Subscribe(eventbus.TopicExitChat, func(event *eventbus.ExitChatEvent) {
 		if event == nil {
 			log.Warnf("HandleExitChat: event is nil, skipping")
 			return
 		}
 
 		// 路由到统一的worker池
-		s.workerPool.Route(eventbus.TopicExitChat, event)
+		s.workerPool.Route(eventbus.TopicNameExitChat, event)
 	})
 	return nil
 }
@@ -345,5 +357,8 @@ func (s *EventHandle) Close() {
 	if s.workerPool != nil {
 		s.workerPool.Close()
 	}
+	if s.webhookPool != nil {
+		s.webhookPool.Close()
+	}
 	log.Info("EventHandle已关闭")
 }
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/mcpserver"
+	"xiaozhi-esp32-server-golang/internal/data/history"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultMCPServerPath  = "/xiaozhi/mcp_server"
+	mcpServerToolTimeout  = 30 * time.Second
+	mcpServerJWTSecretKey = "xiaozhi_admin_secret_key" // 与 manager 签发 token 使用的密钥一致
+)
+
+// newMCPServerHandler 创建对外的 MCP 服务器处理器，未启用时返回空路径
+func (a *App) newMCPServerHandler() (string, *mcpserver.Handler) {
+	if viper.IsSet("mcp_server.enable") && !viper.GetBool("mcp_server.enable") {
+		return "", nil
+	}
+	path := strings.TrimSpace(viper.GetString("mcp_server.path"))
+	if path == "" {
+		path = defaultMCPServerPath
+	}
+	return path, mcpserver.NewHandler(&mcpServerBackend{app: a}, []byte(mcpServerJWTSecretKey))
+}
+
+// mcpServerBackend 基于本实例在线设备实现 mcpserver.Backend，设备归属以设备当前配置的智能体为准
+type mcpServerBackend struct {
+	app *App
+}
+
+func (b *mcpServerBackend) agentChatManager(agentID, deviceID string) (*chat.ChatManager, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	chatManager, exists := b.app.GetChatManager(deviceID)
+	if !exists || chatManager == nil || chatManager.GetClientState() == nil {
+		return nil, mcpserver.ErrDeviceNotFound
+	}
+	if chatManager.GetClientState().AgentID != agentID {
+		return nil, mcpserver.ErrDeviceNotFound
+	}
+	return chatManager, nil
+}
+
+func (b *mcpServerBackend) OnlineDevices(agentID string) []mcpserver.DeviceStatus {
+	devices := make([]mcpserver.DeviceStatus, 0)
+	for _, chatManager := range b.app.GetAllChatManagers() {
+		state := chatManager.GetClientState()
+		if state == nil || state.AgentID != agentID {
+			continue
+		}
+		devices = append(devices, buildDeviceStatus(chatManager))
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	return devices
+}
+
+func (b *mcpServerBackend) DeviceStatus(agentID, deviceID string) (*mcpserver.DeviceStatus, error) {
+	chatManager, err := b.agentChatManager(agentID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	status := buildDeviceStatus(chatManager)
+	status.Tools = deviceReportedTools(status.DeviceID)
+	return &status, nil
+}
+
+func (b *mcpServerBackend) Speak(agentID, deviceID, text string, viaLLM bool) error {
+	chatManager, err := b.agentChatManager(agentID, deviceID)
+	if err != nil {
+		return err
+	}
+	if err := chatManager.InjectMessage(text, !viaLLM); err != nil {
+		return fmt.Errorf("播报失败: %v", err)
+	}
+	return nil
+}
+
+// CallDeviceTool 与 manager 的 /api/mcp/call 一致，仅在设备上报的工具中查找
+func (b *mcpServerBackend) CallDeviceTool(ctx context.Context, agentID, deviceID, toolName string, arguments map[string]interface{}) (string, error) {
+	if _, err := b.agentChatManager(agentID, deviceID); err != nil {
+		return "", err
+	}
+	invokable, ok := mcp.GetReportedToolByDeviceIDAndName(deviceID, toolName)
+	if !ok {
+		return "", fmt.Errorf("工具不存在: %s", toolName)
+	}
+	argBytes, _ := json.Marshal(arguments)
+	ctx, cancel := context.WithTimeout(ctx, mcpServerToolTimeout)
+	defer cancel()
+	result, err := invokable.InvokableRun(ctx, string(argBytes))
+	if err != nil {
+		return "", fmt.Errorf("工具调用失败: %v", err)
+	}
+	return result, nil
+}
+
+// RecentConversation 在线设备读取当前会话上下文，离线设备从 manager 聊天记录读取
+func (b *mcpServerBackend) RecentConversation(ctx context.Context, agentID, deviceID string, limit int) ([]mcpserver.ConversationMessage, error) {
+	if chatManager, err := b.agentChatManager(agentID, deviceID); err == nil {
+		return dialogueMessages(chatManager.GetClientState().GetMessages(limit)), nil
+	}
+	if viper.GetString("config_provider.type") != "manager" {
+		return nil, mcpserver.ErrDeviceNotFound
+	}
+
+	client := history.NewHistoryClient(history.HistoryClientConfig{
+		BaseURL:   util.GetBackendURL(),
+		AuthToken: viper.GetString("manager.history_auth_token"),
+		Timeout:   viper.GetDuration("manager.history_timeout"),
+		Enabled:   true,
+	})
+	resp, err := client.GetMessages(ctx, &history.GetMessagesRequest{DeviceID: deviceID, AgentID: agentID, Limit: limit})
+	if err != nil {
+		log.Warnf("MCP服务器: 获取设备 %s 聊天记录失败: %v", deviceID, err)
+		return nil, fmt.Errorf("获取聊天记录失败: %v", err)
+	}
+	messages := make([]mcpserver.ConversationMessage, 0, len(resp.Messages))
+	for _, item := range resp.Messages {
+		if (item.Role != string(schema.User) && item.Role != string(schema.Assistant)) || strings.TrimSpace(item.Content) == "" {
+			continue
+		}
+		messages = append(messages, mcpserver.ConversationMessage{Role: item.Role, Content: item.Content, CreatedAt: item.CreatedAt})
+	}
+	return messages, nil
+}
+
+func buildDeviceStatus(chatManager *chat.ChatManager) mcpserver.DeviceStatus {
+	state := chatManager.GetClientState()
+	status := mcpserver.DeviceStatus{
+		DeviceID:   state.DeviceID,
+		AgentID:    state.AgentID,
+		SessionID:  state.SessionID,
+		State:      string(state.GetState()),
+		TurnID:     state.TurnID(),
+		ListenMode: state.ListenMode,
+		Language:   state.GetLanguage(),
+	}
+	if state.MqttLastActiveTs > 0 {
+		status.LastActive = time.Unix(state.MqttLastActiveTs, 0).Format(time.RFC3339)
+	}
+	return status
+}
+
+func deviceReportedTools(deviceID string) []mcpserver.DeviceTool {
+	reportedTools, err := mcp.GetReportedToolsByDeviceID(deviceID)
+	if err != nil {
+		log.Warnf("MCP服务器: 获取设备 %s 上报工具失败: %v", deviceID, err)
+		return nil
+	}
+	tools := make([]mcpserver.DeviceTool, 0, len(reportedTools))
+	for name, invokable := range reportedTools {
+		deviceTool := mcpserver.DeviceTool{Name: name}
+		if info, err := invokable.Info(context.Background()); err == nil && info != nil {
+			deviceTool.Description = info.Desc
+			if info.ParamsOneOf != nil {
+				if openAPISchema, err := info.ParamsOneOf.ToOpenAPIV3(); err == nil && openAPISchema != nil {
+					if raw, err := json.Marshal(openAPISchema); err == nil {
+						_ = json.Unmarshal(raw, &deviceTool.InputSchema)
+					}
+				}
+			}
+		}
+		tools = append(tools, deviceTool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// dialogueMessages 只保留用户与助手的文本消息，工具调用过程不对外暴露
+func dialogueMessages(messages []*schema.Message) []mcpserver.ConversationMessage {
+	ret := make([]mcpserver.ConversationMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg == nil || (msg.Role != schema.User && msg.Role != schema.Assistant) || strings.TrimSpace(msg.Content) == "" {
+			continue
+		}
+		ret = append(ret, mcpserver.ConversationMessage{Role: string(msg.Role), Content: msg.Content})
+	}
+	return ret
+}
@@ -0,0 +1,297 @@
+// Package mcpserver 将在线设备以 MCP 服务器（Streamable HTTP）形式暴露给外部智能体，
+// 外部调用方使用智能体级 token 接入，只能看到并操作该智能体下的设备。
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// TokenPurpose manager 为 MCP 服务器接入点签发的 token 用途，与设备接入点（mcp-endpoint）的 token 不通用
+	TokenPurpose = "mcp-server"
+
+	DefaultRecentMessages = 20
+	maxRecentMessages     = 100
+
+	serverName    = "xiaozhi-devices"
+	serverVersion = "1.0.0"
+)
+
+// ErrDeviceNotFound 设备不在线或不属于当前智能体
+var ErrDeviceNotFound = errors.New("设备不在线或不属于当前智能体")
+
+// DeviceTool 设备上报的 MCP 工具
+type DeviceTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema,omitempty"`
+}
+
+// DeviceStatus 设备当前状态
+type DeviceStatus struct {
+	DeviceID   string       `json:"device_id"`
+	AgentID    string       `json:"agent_id"`
+	SessionID  string       `json:"session_id,omitempty"`
+	State      string       `json:"state"`
+	TurnID     string       `json:"turn_id,omitempty"`
+	ListenMode string       `json:"listen_mode,omitempty"`
+	Language   string       `json:"language,omitempty"`
+	LastActive string       `json:"last_active,omitempty"`
+	Tools      []DeviceTool `json:"tools,omitempty"`
+}
+
+// ConversationMessage 对话记录中的一条消息
+type ConversationMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Backend 设备侧能力，由 App 实现；agentID 均来自 token，实现方需校验设备归属
+type Backend interface {
+	OnlineDevices(agentID string) []DeviceStatus
+	DeviceStatus(agentID, deviceID string) (*DeviceStatus, error)
+	Speak(agentID, deviceID, text string, viaLLM bool) error
+	CallDeviceTool(ctx context.Context, agentID, deviceID, toolName string, arguments map[string]interface{}) (string, error)
+	RecentConversation(ctx context.Context, agentID, deviceID string, limit int) ([]ConversationMessage, error)
+}
+
+// Claims MCP 服务器接入 token，字段与 manager 签发的 MCP token 一致
+type Claims struct {
+	UserID     uint   `json:"userId"`
+	AgentID    string `json:"agentId"`
+	EndpointID string `json:"endpointId"`
+	Purpose    string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+type agentIDKey struct{}
+
+// AgentIDFromContext 获取当前请求 token 对应的智能体ID
+func AgentIDFromContext(ctx context.Context) string {
+	agentID, _ := ctx.Value(agentIDKey{}).(string)
+	return agentID
+}
+
+// Handler 对外提供 MCP 服务的 HTTP 处理器
+type Handler struct {
+	backend Backend
+	secret  []byte
+	mcp     *server.StreamableHTTPServer
+}
+
+// NewHandler 创建 MCP 服务器处理器，secret 为校验 token 的 JWT 密钥
+func NewHandler(backend Backend, secret []byte) *Handler {
+	h := &Handler{backend: backend, secret: secret}
+	s := server.NewMCPServer(serverName, serverVersion, server.WithToolCapabilities(false))
+	h.registerTools(s)
+	h.mcp = server.NewStreamableHTTPServer(s,
+		server.WithStateLess(true),
+		server.WithHTTPContextFunc(func(ctx context.Context, r *http.Request) context.Context {
+			return context.WithValue(ctx, agentIDKey{}, AgentIDFromContext(r.Context()))
+		}),
+	)
+	return h
+}
+
+// ServeHTTP 校验 token 后交给 MCP Streamable HTTP 服务处理
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := h.ParseToken(tokenFromRequest(r))
+	if err != nil {
+		log.Warnf("MCP服务器token校验失败: %v, remote: %s", err, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="xiaozhi-mcp"`)
+		http.Error(w, "无效的token", http.StatusUnauthorized)
+		return
+	}
+	h.mcp.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), agentIDKey{}, claims.AgentID)))
+}
+
+// ParseToken 解析并校验智能体级 token
+func (h *Handler) ParseToken(tokenString string) (*Claims, error) {
+	tokenString = strings.TrimSpace(tokenString)
+	if tokenString == "" {
+		return nil, fmt.Errorf("缺少token")
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("不支持的签名算法: %v", token.Header["alg"])
+		}
+		return h.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrInvalidKey
+	}
+	if claims.Purpose != TokenPurpose {
+		return nil, fmt.Errorf("token用途不匹配: %s", claims.Purpose)
+	}
+	if strings.TrimSpace(claims.AgentID) == "" {
+		return nil, fmt.Errorf("token缺少agentId")
+	}
+	return claims, nil
+}
+
+// tokenFromRequest 优先读取 Authorization: Bearer，其次是 URL 参数 token（部分客户端只支持配置 URL）
+func tokenFromRequest(r *http.Request) string {
+	if auth := strings.TrimSpace(r.Header.Get("Authorization")); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return auth[7:]
+		}
+		return auth
+	}
+	return r.URL.Query().Get("token")
+}
+
+func (h *Handler) registerTools(s *server.MCPServer) {
+	s.AddTool(mcp.NewTool("list_online_devices",
+		mcp.WithDescription("列出当前智能体下所有在线设备及其对话状态"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), h.listOnlineDevices)
+
+	s.AddTool(mcp.NewTool("get_device_status",
+		mcp.WithDescription("获取设备的对话状态、会话信息以及设备上报的可调用工具"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), h.getDeviceStatus)
+
+	s.AddTool(mcp.NewTool("speak_on_device",
+		mcp.WithDescription("让设备播报一段话。mode=tts 直接朗读文本；mode=llm 将文本作为用户请求交给设备上的智能体处理后播报回复"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithString("text", mcp.Required(), mcp.Description("要播报的文本或交给智能体的请求")),
+		mcp.WithString("mode", mcp.Enum("tts", "llm"), mcp.DefaultString("tts"), mcp.Description("播报方式，默认 tts")),
+	), h.speakOnDevice)
+
+	s.AddTool(mcp.NewTool("call_device_tool",
+		mcp.WithDescription("调用设备上报的 MCP 工具（如调节音量、控制外设），可用工具见 get_device_status"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithString("tool_name", mcp.Required(), mcp.Description("设备工具名")),
+		mcp.WithObject("arguments", mcp.Description("工具参数")),
+	), h.callDeviceTool)
+
+	s.AddTool(mcp.NewTool("get_recent_conversation",
+		mcp.WithDescription("获取设备最近的对话记录（用户与助手的消息）"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithNumber("limit", mcp.Min(1), mcp.Max(maxRecentMessages), mcp.Description(fmt.Sprintf("返回的消息条数，默认 %d", DefaultRecentMessages))),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), h.getRecentConversation)
+}
+
+func (h *Handler) listOnlineDevices(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	devices := h.backend.OnlineDevices(AgentIDFromContext(ctx))
+	if devices == nil {
+		devices = []DeviceStatus{}
+	}
+	return jsonResult(map[string]interface{}{"devices": devices, "count": len(devices)})
+}
+
+func (h *Handler) getDeviceStatus(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID, err := req.RequireString("device_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	status, err := h.backend.DeviceStatus(AgentIDFromContext(ctx), deviceID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonResult(status)
+}
+
+func (h *Handler) speakOnDevice(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID, err := req.RequireString("device_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	text := strings.TrimSpace(req.GetString("text", ""))
+	if text == "" {
+		return mcp.NewToolResultError("text 不能为空"), nil
+	}
+	mode := strings.ToLower(strings.TrimSpace(req.GetString("mode", "tts")))
+	if mode != "tts" && mode != "llm" {
+		return mcp.NewToolResultError(fmt.Sprintf("不支持的 mode: %s", mode)), nil
+	}
+	agentID := AgentIDFromContext(ctx)
+	if err := h.backend.Speak(agentID, deviceID, text, mode == "llm"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log.Infof("MCP服务器: agent %s 在设备 %s 播报, mode: %s", agentID, deviceID, mode)
+	return mcp.NewToolResultText("已提交播报"), nil
+}
+
+func (h *Handler) callDeviceTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID, err := req.RequireString("device_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	toolName, err := req.RequireString("tool_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	arguments := map[string]interface{}{}
+	if raw, ok := req.GetArguments()["arguments"]; ok && raw != nil {
+		switch v := raw.(type) {
+		case map[string]interface{}:
+			arguments = v
+		case string:
+			// 兼容把参数序列化成字符串传入的客户端
+			if err := json.Unmarshal([]byte(v), &arguments); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("arguments 不是有效的JSON对象: %v", err)), nil
+			}
+		default:
+			return mcp.NewToolResultError("arguments 必须是对象"), nil
+		}
+	}
+	agentID := AgentIDFromContext(ctx)
+	start := time.Now()
+	result, err := h.backend.CallDeviceTool(ctx, agentID, deviceID, toolName, arguments)
+	if err != nil {
+		log.Warnf("MCP服务器: agent %s 调用设备 %s 工具 %s 失败: %v", agentID, deviceID, toolName, err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log.Infof("MCP服务器: agent %s 调用设备 %s 工具 %s 成功, 耗时: %s", agentID, deviceID, toolName, time.Since(start))
+	return mcp.NewToolResultText(result), nil
+}
+
+func (h *Handler) getRecentConversation(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID, err := req.RequireString("device_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	limit := req.GetInt("limit", DefaultRecentMessages)
+	if limit <= 0 {
+		limit = DefaultRecentMessages
+	}
+	if limit > maxRecentMessages {
+		limit = maxRecentMessages
+	}
+	messages, err := h.backend.RecentConversation(ctx, AgentIDFromContext(ctx), deviceID, limit)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if messages == nil {
+		messages = []ConversationMessage{}
+	}
+	return jsonResult(map[string]interface{}{"device_id": deviceID, "messages": messages})
+}
+
+func jsonResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
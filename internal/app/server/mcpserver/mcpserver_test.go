@@ -0,0 +1,216 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var testSecret = []byte("test-secret")
+
+type spoken struct {
+	agentID, deviceID, text string
+	viaLLM                  bool
+}
+
+// fakeBackend 设备 d1、d2 属于 agent a1，d3 属于 a2
+type fakeBackend struct {
+	spoken   []spoken
+	toolArgs map[string]interface{}
+}
+
+var fakeDevices = map[string]string{"d1": "a1", "d2": "a1", "d3": "a2"}
+
+func (f *fakeBackend) check(agentID, deviceID string) error {
+	if fakeDevices[deviceID] != agentID {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (f *fakeBackend) OnlineDevices(agentID string) []DeviceStatus {
+	var ret []DeviceStatus
+	for _, id := range []string{"d1", "d2", "d3"} {
+		if fakeDevices[id] == agentID {
+			ret = append(ret, DeviceStatus{DeviceID: id, AgentID: agentID, State: "idle"})
+		}
+	}
+	return ret
+}
+
+func (f *fakeBackend) DeviceStatus(agentID, deviceID string) (*DeviceStatus, error) {
+	if err := f.check(agentID, deviceID); err != nil {
+		return nil, err
+	}
+	return &DeviceStatus{DeviceID: deviceID, AgentID: agentID, State: "speaking", Tools: []DeviceTool{{Name: "self.audio_speaker.set_volume"}}}, nil
+}
+
+func (f *fakeBackend) Speak(agentID, deviceID, text string, viaLLM bool) error {
+	if err := f.check(agentID, deviceID); err != nil {
+		return err
+	}
+	f.spoken = append(f.spoken, spoken{agentID, deviceID, text, viaLLM})
+	return nil
+}
+
+func (f *fakeBackend) CallDeviceTool(ctx context.Context, agentID, deviceID, toolName string, arguments map[string]interface{}) (string, error) {
+	if err := f.check(agentID, deviceID); err != nil {
+		return "", err
+	}
+	f.toolArgs = arguments
+	return `{"success":true}`, nil
+}
+
+func (f *fakeBackend) RecentConversation(ctx context.Context, agentID, deviceID string, limit int) ([]ConversationMessage, error) {
+	if err := f.check(agentID, deviceID); err != nil {
+		return nil, err
+	}
+	msgs := []ConversationMessage{{Role: "user", Content: "你好"}, {Role: "assistant", Content: "你好呀"}, {Role: "user", Content: "几点了"}}
+	if limit < len(msgs) {
+		msgs = msgs[len(msgs)-limit:]
+	}
+	return msgs, nil
+}
+
+func signToken(t *testing.T, agentID, purpose string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{AgentID: agentID, Purpose: purpose}).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func newTestClient(t *testing.T, url, token string) *client.Client {
+	t.Helper()
+	tr, err := transport.NewStreamableHTTP(url, transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer " + token}))
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	c := client.NewClient(tr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}}); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func callTool(t *testing.T, c *client.Client, name string, args map[string]interface{}) *mcp.CallToolResult {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+	res, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("call %s: %v", name, err)
+	}
+	return res
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	return res.Content[0].(mcp.TextContent).Text
+}
+
+func TestHandlerRejectsInvalidToken(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(&fakeBackend{}, testSecret))
+	defer srv.Close()
+
+	otherSecret, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{AgentID: "a1", Purpose: TokenPurpose}).SignedString([]byte("other"))
+	cases := map[string]string{
+		"missing":       "",
+		"wrong purpose": "Bearer " + signToken(t, "a1", "mcp-endpoint"),
+		"no agent":      "Bearer " + signToken(t, "", TokenPurpose),
+		"wrong secret":  "Bearer " + otherSecret,
+	}
+	for name, auth := range cases {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandlerToolsAreAgentScoped(t *testing.T) {
+	backend := &fakeBackend{}
+	srv := httptest.NewServer(NewHandler(backend, testSecret))
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, signToken(t, "a1", TokenPurpose))
+
+	tools, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil || len(tools.Tools) != 5 {
+		t.Fatalf("list tools: %+v %v", tools, err)
+	}
+
+	var listed struct {
+		Devices []DeviceStatus `json:"devices"`
+		Count   int            `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(resultText(callTool(t, c, "list_online_devices", nil))), &listed); err != nil || listed.Count != 2 {
+		t.Fatalf("list_online_devices = %+v %v", listed, err)
+	}
+
+	// 其他智能体的设备不可见
+	if res := callTool(t, c, "get_device_status", map[string]interface{}{"device_id": "d3"}); !res.IsError {
+		t.Fatalf("device of another agent should be rejected: %s", resultText(res))
+	}
+	if res := callTool(t, c, "speak_on_device", map[string]interface{}{"device_id": "d3", "text": "hi"}); !res.IsError {
+		t.Fatalf("speaking on another agent's device should be rejected")
+	}
+
+	if res := callTool(t, c, "speak_on_device", map[string]interface{}{"device_id": "d1", "text": "开饭了", "mode": "llm"}); res.IsError {
+		t.Fatalf("speak: %s", resultText(res))
+	}
+	if res := callTool(t, c, "speak_on_device", map[string]interface{}{"device_id": "d1", "text": "hi", "mode": "shout"}); !res.IsError {
+		t.Fatalf("unknown mode should be rejected")
+	}
+	if len(backend.spoken) != 1 || backend.spoken[0] != (spoken{"a1", "d1", "开饭了", true}) {
+		t.Fatalf("spoken = %+v", backend.spoken)
+	}
+
+	res := callTool(t, c, "call_device_tool", map[string]interface{}{
+		"device_id": "d2", "tool_name": "self.audio_speaker.set_volume", "arguments": map[string]interface{}{"volume": 30},
+	})
+	if res.IsError || resultText(res) != `{"success":true}` || backend.toolArgs["volume"] != float64(30) {
+		t.Fatalf("call_device_tool = %s, args = %v", resultText(res), backend.toolArgs)
+	}
+
+	var conv struct {
+		Messages []ConversationMessage `json:"messages"`
+	}
+	res = callTool(t, c, "get_recent_conversation", map[string]interface{}{"device_id": "d1", "limit": 2})
+	if err := json.Unmarshal([]byte(resultText(res)), &conv); err != nil || len(conv.Messages) != 2 || conv.Messages[1].Content != "几点了" {
+		t.Fatalf("get_recent_conversation = %s", resultText(res))
+	}
+}
+
+func TestTokenFromQuery(t *testing.T) {
+	h := NewHandler(&fakeBackend{}, testSecret)
+	r := httptest.NewRequest(http.MethodPost, "/xiaozhi/mcp_server?token="+signToken(t, "a2", TokenPurpose), nil)
+	claims, err := h.ParseToken(tokenFromRequest(r))
+	if err != nil || claims.AgentID != "a2" {
+		t.Fatalf("token from query: %+v %v", claims, err)
+	}
+}
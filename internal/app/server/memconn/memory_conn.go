@@ -0,0 +1,191 @@
+package memconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+)
+
+var errClosed = errors.New("connection is closed")
+
+// MemoryConn 实现 types.IConn 接口的进程内连接，不经过网络，用于端到端测试
+// 服务端通过 IConn 方法收发，测试代码扮演设备：PushCmd/PushAudio 发送上行数据，Cmds/Audio 读取下行数据
+type MemoryConn struct {
+	deviceID      string
+	transportType string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+	sendCmdChan   chan []byte
+	sendAudioChan chan []byte
+
+	mu            sync.RWMutex
+	data          map[string]interface{}
+	onCloseCbList []func(deviceId string)
+	closed        bool
+}
+
+// NewMemoryConn 创建进程内连接，transportType 为空时按 websocket 处理
+func NewMemoryConn(deviceID string, transportType string) *MemoryConn {
+	if transportType == "" {
+		transportType = types.TransportTypeWebsocket
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryConn{
+		deviceID:      deviceID,
+		transportType: transportType,
+		ctx:           ctx,
+		cancel:        cancel,
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+		sendCmdChan:   make(chan []byte, 100),
+		sendAudioChan: make(chan []byte, 1000),
+		data:          make(map[string]interface{}),
+	}
+}
+
+// SetData 设置私有数据，如 MQTT+UDP 的 aes_key、full_nonce
+func (c *MemoryConn) SetData(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+}
+
+// PushCmd 模拟设备发送信令消息
+func (c *MemoryConn) PushCmd(msg []byte) error {
+	return c.push(c.recvCmdChan, msg)
+}
+
+// PushAudio 模拟设备发送一帧音频
+func (c *MemoryConn) PushAudio(audio []byte) error {
+	return c.push(c.recvAudioChan, audio)
+}
+
+func (c *MemoryConn) push(ch chan []byte, msg []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return errClosed
+	case ch <- msg:
+		return nil
+	}
+}
+
+// Cmds 服务端下发的信令消息
+func (c *MemoryConn) Cmds() <-chan []byte {
+	return c.sendCmdChan
+}
+
+// Audio 服务端下发的音频帧
+func (c *MemoryConn) Audio() <-chan []byte {
+	return c.sendAudioChan
+}
+
+// Disconnect 模拟设备断开连接，触发 OnClose 回调
+func (c *MemoryConn) Disconnect() {
+	c.mu.RLock()
+	cbList := append([]func(deviceId string){}, c.onCloseCbList...)
+	c.mu.RUnlock()
+	for _, cb := range cbList {
+		cb(c.deviceID)
+	}
+}
+
+func (c *MemoryConn) SendCmd(msg []byte) error {
+	return c.send(c.sendCmdChan, msg)
+}
+
+func (c *MemoryConn) SendAudio(audio []byte) error {
+	return c.send(c.sendAudioChan, audio)
+}
+
+// send 下行通道满时阻塞，直到测试代码读取或连接关闭
+func (c *MemoryConn) send(ch chan []byte, msg []byte) error {
+	c.mu.RLock()
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return errClosed
+	}
+	select {
+	case <-c.ctx.Done():
+		return errClosed
+	case ch <- msg:
+		return nil
+	}
+}
+
+func (c *MemoryConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvCmdChan, timeout)
+}
+
+func (c *MemoryConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvAudioChan, timeout)
+}
+
+func (c *MemoryConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, errClosed
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *MemoryConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *MemoryConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	return nil
+}
+
+// IsClosed 服务端是否已关闭连接
+func (c *MemoryConn) IsClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
+
+func (c *MemoryConn) OnClose(cb func(deviceId string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onCloseCbList = append(c.onCloseCbList, cb)
+}
+
+func (c *MemoryConn) CloseAudioChannel() error {
+	return nil
+}
+
+func (c *MemoryConn) GetTransportType() string {
+	return c.transportType
+}
+
+func (c *MemoryConn) GetData(key string) (interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.data[key]
+	if !ok {
+		return nil, fmt.Errorf("data %s not found", key)
+	}
+	return value, nil
+}
+
+var _ types.IConn = (*MemoryConn)(nil)
@@ -13,6 +13,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/data/history"
 	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
 	"xiaozhi-esp32-server-golang/internal/domain/memory/llm_memory"
+	"xiaozhi-esp32-server-golang/internal/domain/toolconfirm"
 	"xiaozhi-esp32-server-golang/internal/util"
 	log "xiaozhi-esp32-server-golang/logger"
 
@@ -20,6 +21,11 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultHistorySpoolDir    = "./data/history_spool"
+	historySpoolUploadTimeout = 30 * time.Second
+)
+
 var (
 	// MessageWorkerNum 消息处理worker数量（基于CPU核心数，统一配置，用于Redis+History处理）
 	// 必须是2的幂次以便hash分布
@@ -52,6 +58,7 @@ func getMessageWorkerNum() int {
 // 统一处理Redis、MemoryProvider和History消息
 type MessageWorker struct {
 	client  *history.HistoryClient
+	spool   *history.Spool                   // 聊天记录本地落盘队列，未启用时为 nil
 	workers []chan *eventbus.AddMessageEvent // 每个worker的channel
 	ctx     context.Context
 	cancel  context.CancelFunc
@@ -77,6 +84,14 @@ func NewMessageWorker(cfg history.HistoryClientConfig) *MessageWorker {
 		go worker.workerLoop(i)
 	}
 
+	if spool := openHistorySpool(); spool != nil {
+		worker.spool = spool
+		history.SetDefaultSpool(spool)
+		uploadCfg := cfg
+		uploadCfg.Timeout = historySpoolUploadTimeout
+		go spool.RunUploader(ctx, history.NewHistoryClient(uploadCfg), viper.GetInt("manager.history_spool.batch_size"), historySpoolUploadTimeout)
+	}
+
 	worker.subscribeEvents()
 	log.Infof("MessageWorker初始化完成，启动 %d 个worker goroutine（统一处理Redis+MemoryProvider+History）", MessageWorkerNum)
 	return worker
@@ -173,9 +188,8 @@ func (w *MessageWorker) hashSessionID(sessionID string) int {
 
 // subscribeEvents 订阅EventBus事件
 func (w *MessageWorker) subscribeEvents() {
-	bus := eventbus.Get()
 	// 订阅统一的消息添加事件（与 EventHandle 监听同一个 Topic）
-	bus.Subscribe(eventbus.TopicAddMessage, w.handleAddMessage)
+	eventbus.Subscribe(eventbus.TopicAddMessage, w.handleAddMessage)
 }
 
 // handleAddMessage 统一处理消息添加事件（路由到对应的worker）
@@ -208,6 +222,44 @@ func (w *MessageWorker) handleAddMessage(event *eventbus.AddMessageEvent) {
 	}
 }
 
+// openHistorySpool 按配置打开聊天记录落盘队列，仅 manager 模式下启用，打开失败时退回直接上传
+func openHistorySpool() *history.Spool {
+	if viper.GetString("config_provider.type") != "manager" {
+		return nil
+	}
+	if viper.IsSet("manager.history_spool.enable") && !viper.GetBool("manager.history_spool.enable") {
+		return nil
+	}
+	dir := viper.GetString("manager.history_spool.dir")
+	if dir == "" {
+		dir = defaultHistorySpoolDir
+	}
+	spool, err := history.OpenSpool(history.SpoolConfig{
+		Dir:      dir,
+		MaxBytes: viper.GetInt64("manager.history_spool.max_size_mb") << 20,
+		Sync:     viper.GetBool("manager.history_spool.sync"),
+	})
+	if err != nil {
+		log.Errorf("打开聊天记录落盘队列失败，改为直接上传: %v", err)
+		return nil
+	}
+	stats := spool.Stats()
+	log.Infof("聊天记录落盘队列已启用, dir=%s, 待上传 %d 条", dir, stats.PendingEntries)
+	return spool
+}
+
+// appendToSpool 写入落盘队列，由上传协程按顺序批量上传；返回 false 时由调用方直接上传
+func (w *MessageWorker) appendToSpool(entry *history.SpoolEntry) bool {
+	if w.spool == nil {
+		return false
+	}
+	if err := w.spool.Append(entry); err != nil {
+		log.Warnf("聊天记录落盘失败，改为直接上传, op=%s session_id=%s: %v", entry.Op, entry.SessionID, err)
+		return false
+	}
+	return true
+}
+
 // saveMessageText 保存文本消息（第一阶段，或一次性保存文本+音频）
 // 包含Redis处理（当config_provider.type为redis时）
 func (w *MessageWorker) saveMessageText(ctx context.Context, event *eventbus.AddMessageEvent) {
@@ -289,6 +341,13 @@ func (w *MessageWorker) saveMessageText(ctx context.Context, event *eventbus.Add
 	metadata := map[string]interface{}{
 		"timestamp": event.Timestamp.Format(time.RFC3339),
 	}
+	if event.TurnID != "" {
+		metadata["turn_id"] = event.TurnID
+	}
+	// 敏感工具的确认记录
+	if record, ok := event.Msg.Extra[toolconfirm.MetadataKey]; ok {
+		metadata[toolconfirm.MetadataKey] = record
+	}
 
 	// 准备工具调用相关字段
 	var toolCallID string
@@ -327,6 +386,9 @@ func (w *MessageWorker) saveMessageText(ctx context.Context, event *eventbus.Add
 		Metadata:      metadata,
 	}
 
+	if w.appendToSpool(&history.SpoolEntry{Op: history.SpoolOpSave, SessionID: req.SessionID, Save: req}) {
+		return
+	}
 	if err := w.client.SaveMessage(ctx, req); err != nil {
 		log.Errorf("保存消息失败, device_id: %s, message_id: %s, error: %v",
 			event.ClientState.DeviceID, event.MessageID, err)
@@ -390,6 +452,10 @@ func (w *MessageWorker) updateMessageAudio(ctx context.Context, event *eventbus.
 		},
 	}
 
+	if w.appendToSpool(&history.SpoolEntry{Op: history.SpoolOpUpdateAudio, SessionID: event.ClientState.SessionID, UpdateAudio: req}) {
+		return
+	}
+
 	// 调用更新接口
 	if err := w.client.UpdateMessageAudio(ctx, req); err != nil {
 		log.Errorf("更新消息音频失败, device_id: %s, message_id: %s, error: %v",
@@ -24,6 +24,9 @@ type MqttConfig struct {
 	ClientID string
 	Username string
 	Password string
+	// SharedSubscription 以共享订阅接收上行消息（内置 MQTT Server 集群模式或 mqtt.shared_subscription 开启时），
+	// 默认使用普通订阅，兼容不支持 $share 的外部 broker
+	SharedSubscription bool
 }
 
 // MqttUdpAdapter MQTT-UDP适配器结构
@@ -150,6 +153,10 @@ func (s *MqttUdpAdapter) connectAndRetry() {
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		Info("MQTT已连接")
 		topic := ServerSubTopicPrefix
+		if cfg.SharedSubscription {
+			// 共享订阅：多个主程序实例连同一 broker 或集群时，每条上行消息只由一个实例处理
+			topic = ServerShareSubTopic
+		}
 		if token := client.Subscribe(topic, 0, s.handleMessage); token.Wait() && token.Error() != nil {
 			Errorf("订阅主题失败: %v", token.Error())
 		}
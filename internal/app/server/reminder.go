@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/data/reminder"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultReminderPollInterval = 15 * time.Second
+	reminderClaimLimit          = 20
+	reminderDeviceBatchSize     = 200
+	reminderConnectDelay        = 2 * time.Second // 设备刚连接时等待会话初始化
+)
+
+var reminderOwner = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}()
+
+// startReminderScheduler 周期性为本实例在线设备领取到期提醒并注入播报
+func (a *App) startReminderScheduler(ctx context.Context) {
+	if reminder.Default() == nil {
+		log.Info("设备定时提醒未启用（需 config_provider.type=manager 且配置 manager.backend_url）")
+		return
+	}
+	interval := viper.GetDuration("reminder.poll_interval")
+	if interval <= 0 {
+		interval = defaultReminderPollInterval
+	}
+	log.Infof("设备定时提醒已启动, poll_interval=%s owner=%s", interval, reminderOwner)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deviceIDs := make([]string, 0, a.chatManagers.Count())
+				for tuple := range a.chatManagers.IterBuffered() {
+					deviceIDs = append(deviceIDs, tuple.Key)
+				}
+				a.deliverDueReminders(ctx, deviceIDs)
+			}
+		}
+	}()
+}
+
+// deliverRemindersOnConnect 设备上线后补发离线期间到期的提醒
+func (a *App) deliverRemindersOnConnect(deviceID string) {
+	if reminder.Default() == nil {
+		return
+	}
+	time.Sleep(reminderConnectDelay)
+	if _, exists := a.GetChatManager(deviceID); !exists {
+		return
+	}
+	a.deliverDueReminders(context.Background(), []string{deviceID})
+}
+
+func (a *App) deliverDueReminders(ctx context.Context, deviceIDs []string) {
+	client := reminder.Default()
+	if client == nil || len(deviceIDs) == 0 {
+		return
+	}
+	for start := 0; start < len(deviceIDs); start += reminderDeviceBatchSize {
+		end := start + reminderDeviceBatchSize
+		if end > len(deviceIDs) {
+			end = len(deviceIDs)
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		claimed, err := client.Claim(reqCtx, deviceIDs[start:end], reminderOwner, reminderClaimLimit)
+		cancel()
+		if err != nil {
+			log.Warnf("领取设备提醒失败: %v", err)
+			return
+		}
+		for _, item := range claimed {
+			a.deliverReminder(ctx, client, item)
+		}
+	}
+}
+
+func (a *App) deliverReminder(ctx context.Context, client *reminder.Client, item reminder.Reminder) {
+	var deliverErr error
+	chatManager, exists := a.GetChatManager(item.DeviceID)
+	switch {
+	case !exists || chatManager == nil:
+		deliverErr = fmt.Errorf("设备不在线")
+	case strings.TrimSpace(item.Message) == "":
+		// 空内容直接视为已投递，避免反复领取
+	default:
+		deliverErr = chatManager.InjectMessage(item.Message, item.SkipLlm)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ack(reqCtx, item.ID, reminderOwner, deliverErr == nil, deliverErr); err != nil {
+		log.Warnf("提醒投递回执失败, device=%s reminder=%d err=%v", item.DeviceID, item.ID, err)
+	}
+	if deliverErr != nil {
+		log.Warnf("提醒投递失败, device=%s reminder=%d err=%v", item.DeviceID, item.ID, deliverErr)
+		return
+	}
+	log.Infof("提醒已投递, device=%s reminder=%d type=%s skip_llm=%v", item.DeviceID, item.ID, item.ScheduleType, item.SkipLlm)
+}
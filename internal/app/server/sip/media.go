@@ -0,0 +1,291 @@
+package sip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio/g711"
+	"xiaozhi-esp32-server-golang/internal/domain/audio/g722"
+
+	"github.com/pion/sdp/v3"
+)
+
+const (
+	// PacketDuration 发送 RTP 包的打包时长
+	PacketDuration = 20 * time.Millisecond
+	// DefaultDTMFPayloadType 本端 SDP 中 telephone-event 使用的动态负载类型
+	DefaultDTMFPayloadType = 101
+
+	telephoneEvent = "telephone-event"
+	dtmfDigits     = "0123456789*#ABCD"
+)
+
+// Codec 电话网关支持的 RTP 音频编码
+type Codec struct {
+	Name        string
+	PayloadType uint8
+	// RTP 时钟频率，G.722 按 RFC 3551 的历史约定为 8000
+	ClockRate uint32
+	// 实际音频采样率
+	SampleRate int
+}
+
+var supportedCodecs = []Codec{
+	{Name: "G722", PayloadType: 9, ClockRate: 8000, SampleRate: g722.SampleRate},
+	{Name: "PCMU", PayloadType: 0, ClockRate: 8000, SampleRate: 8000},
+	{Name: "PCMA", PayloadType: 8, ClockRate: 8000, SampleRate: 8000},
+}
+
+// LookupCodec 按名称（不区分大小写）查找支持的编码
+func LookupCodec(name string) (Codec, bool) {
+	for _, c := range supportedCodecs {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Codec{}, false
+}
+
+// FrameSamples 返回一个 RTP 包（PacketDuration）包含的采样数
+func (c Codec) FrameSamples() int {
+	return c.SampleRate * int(PacketDuration/time.Millisecond) / 1000
+}
+
+// TimestampStep 返回一个 RTP 包对应的时间戳增量
+func (c Codec) TimestampStep() uint32 {
+	return c.ClockRate * uint32(PacketDuration/time.Millisecond) / 1000
+}
+
+// NewEncoder 创建 PCM 到 RTP 负载的编码函数，G.722 有状态，每路通话单独创建
+func (c Codec) NewEncoder() func(dst []byte, pcm []int16) []byte {
+	switch c.Name {
+	case "G722":
+		return g722.NewEncoder().Encode
+	case "PCMA":
+		return g711.EncodeAlaw
+	default:
+		return g711.EncodeUlaw
+	}
+}
+
+// NewDecoder 创建 RTP 负载到 PCM 的解码函数，G.722 有状态，每路通话单独创建
+func (c Codec) NewDecoder() func(dst []int16, payload []byte) []int16 {
+	switch c.Name {
+	case "G722":
+		return g722.NewDecoder().Decode
+	case "PCMA":
+		return g711.DecodeAlaw
+	default:
+		return g711.DecodeUlaw
+	}
+}
+
+// RemoteMedia 从对端 SDP 中解析出的媒体参数
+type RemoteMedia struct {
+	Addr  *net.UDPAddr
+	Codec Codec
+	// 对端是否支持 RFC 4733 DTMF 及其负载类型
+	DTMF            bool
+	DTMFPayloadType uint8
+}
+
+// ParseSDP 解析对端 SDP（offer 或 answer），按 preferred 的顺序选择双方都支持的编码
+func ParseSDP(body []byte, preferred []string) (*RemoteMedia, error) {
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(body); err != nil {
+		return nil, fmt.Errorf("解析SDP失败: %v", err)
+	}
+
+	for _, md := range sd.MediaDescriptions {
+		if md.MediaName.Media != "audio" || md.MediaName.Port.Value == 0 {
+			continue
+		}
+		// 只支持明文 RTP，SRTP（RTP/SAVP）需要密钥协商
+		if strings.Join(md.MediaName.Protos, "/") != "RTP/AVP" {
+			continue
+		}
+
+		connInfo := md.ConnectionInformation
+		if connInfo == nil {
+			connInfo = sd.ConnectionInformation
+		}
+		if connInfo == nil || connInfo.Address == nil {
+			return nil, errors.New("SDP缺少连接地址")
+		}
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(connInfo.Address.Address, strconv.Itoa(md.MediaName.Port.Value)))
+		if err != nil {
+			return nil, fmt.Errorf("SDP连接地址无效: %v", err)
+		}
+
+		media := &RemoteMedia{Addr: addr}
+		offered := offeredCodecs(md)
+		var payloadTypes []uint8
+		for _, f := range md.MediaName.Formats {
+			pt, err := strconv.Atoi(f)
+			if err != nil || pt < 0 || pt > 127 {
+				continue
+			}
+			payloadTypes = append(payloadTypes, uint8(pt))
+			if m := offered[uint8(pt)]; strings.EqualFold(m.name, telephoneEvent) && m.rate == 8000 {
+				media.DTMF = true
+				media.DTMFPayloadType = uint8(pt)
+			}
+		}
+
+		for _, name := range preferred {
+			codec, ok := LookupCodec(name)
+			if !ok {
+				continue
+			}
+			for _, pt := range payloadTypes {
+				if m := offered[pt]; strings.EqualFold(m.name, codec.Name) && m.rate == codec.ClockRate {
+					media.Codec = codec
+					// 负载类型以对端声明为准
+					media.Codec.PayloadType = pt
+					return media, nil
+				}
+			}
+		}
+		return nil, errNoCommonCodec
+	}
+	return nil, errors.New("SDP中没有可用的RTP音频流")
+}
+
+var errNoCommonCodec = errors.New("没有双方都支持的音频编码")
+
+type rtpmap struct {
+	name string
+	rate uint32
+}
+
+// offeredCodecs 汇总媒体描述中的负载类型映射，未声明 rtpmap 的静态负载类型按 RFC 3551 补全
+func offeredCodecs(md *sdp.MediaDescription) map[uint8]rtpmap {
+	result := make(map[uint8]rtpmap)
+	for _, c := range supportedCodecs {
+		result[c.PayloadType] = rtpmap{name: c.Name, rate: c.ClockRate}
+	}
+	for _, attr := range md.Attributes {
+		if attr.Key != "rtpmap" {
+			continue
+		}
+		// a=rtpmap:<payload type> <encoding name>/<clock rate>[/<channels>]
+		ptStr, encoding, ok := strings.Cut(attr.Value, " ")
+		if !ok {
+			continue
+		}
+		pt, err := strconv.Atoi(ptStr)
+		if err != nil || pt < 0 || pt > 127 {
+			continue
+		}
+		parts := strings.Split(encoding, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		rate, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		result[uint8(pt)] = rtpmap{name: parts[0], rate: uint32(rate)}
+	}
+	return result
+}
+
+// BuildSDP 生成本端 SDP，codecs 按优先级排列；dtmfPayloadType 小于 0 时不声明 telephone-event
+func BuildSDP(host string, port int, codecs []Codec, dtmfPayloadType int) ([]byte, error) {
+	if len(codecs) == 0 {
+		return nil, errors.New("至少需要一个音频编码")
+	}
+	addressType := "IP4"
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		addressType = "IP6"
+	}
+
+	md := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:  "audio",
+			Port:   sdp.RangedPort{Value: port},
+			Protos: []string{"RTP", "AVP"},
+		},
+	}
+	for _, c := range codecs {
+		md.MediaName.Formats = append(md.MediaName.Formats, strconv.Itoa(int(c.PayloadType)))
+		md.Attributes = append(md.Attributes, sdp.NewAttribute("rtpmap", fmt.Sprintf("%d %s/%d", c.PayloadType, c.Name, c.ClockRate)))
+	}
+	if dtmfPayloadType >= 0 {
+		pt := strconv.Itoa(dtmfPayloadType)
+		md.MediaName.Formats = append(md.MediaName.Formats, pt)
+		md.Attributes = append(md.Attributes,
+			sdp.NewAttribute("rtpmap", pt+" "+telephoneEvent+"/8000"),
+			sdp.NewAttribute("fmtp", pt+" 0-16"),
+		)
+	}
+	md.Attributes = append(md.Attributes,
+		sdp.NewAttribute("ptime", strconv.Itoa(int(PacketDuration/time.Millisecond))),
+		sdp.NewPropertyAttribute("sendrecv"),
+	)
+
+	sessionID := uint64(time.Now().UnixNano())
+	sd := &sdp.SessionDescription{
+		Origin: sdp.Origin{
+			Username:       "xiaozhi",
+			SessionID:      sessionID,
+			SessionVersion: sessionID,
+			NetworkType:    "IN",
+			AddressType:    addressType,
+			UnicastAddress: host,
+		},
+		SessionName: "xiaozhi",
+		ConnectionInformation: &sdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: addressType,
+			Address:     &sdp.Address{Address: host},
+		},
+		TimeDescriptions:  []sdp.TimeDescription{{Timing: sdp.Timing{}}},
+		MediaDescriptions: []*sdp.MediaDescription{md},
+	}
+	return sd.Marshal()
+}
+
+// DTMFEvent RFC 4733 电话事件（按键）
+type DTMFEvent struct {
+	Digit byte
+	// 按键结束，结束包通常重复发送 3 次
+	End    bool
+	Volume uint8
+	// 按键已持续的时长，单位为 RTP 时钟
+	Duration uint16
+}
+
+// ParseDTMFEvent 解析 telephone-event 负载，非 DTMF 按键事件返回 false
+func ParseDTMFEvent(payload []byte) (DTMFEvent, bool) {
+	if len(payload) < 4 || int(payload[0]) >= len(dtmfDigits) {
+		return DTMFEvent{}, false
+	}
+	return DTMFEvent{
+		Digit:    dtmfDigits[payload[0]],
+		End:      payload[1]&0x80 != 0,
+		Volume:   payload[1] & 0x3F,
+		Duration: binary.BigEndian.Uint16(payload[2:4]),
+	}, true
+}
+
+// Marshal 编码为 telephone-event 负载，不支持的按键返回 nil
+func (e DTMFEvent) Marshal() []byte {
+	event := strings.IndexByte(dtmfDigits, e.Digit)
+	if event < 0 {
+		return nil
+	}
+	payload := make([]byte, 4)
+	payload[0] = byte(event)
+	payload[1] = e.Volume & 0x3F
+	if e.End {
+		payload[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(payload[2:], e.Duration)
+	return payload
+}
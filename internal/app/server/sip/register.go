@@ -0,0 +1,177 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+const (
+	defaultRegisterExpires = 300
+	registerRetryInterval  = 30 * time.Second
+	registerTimeout        = 10 * time.Second
+)
+
+// TrunkConfig SIP 中继/PBX 注册配置
+type TrunkConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// 注册服务器地址，如 sip.example.com:5060
+	Registrar string `mapstructure:"registrar"`
+	// SIP 域，为空时使用 registrar 的主机部分
+	Domain   string `mapstructure:"domain"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// 注册有效期（秒）
+	Expires int `mapstructure:"expires"`
+}
+
+// trunkRegistrar 周期性向中继注册，使打到该账号的电话转给本网关
+type trunkRegistrar struct {
+	client  *sipgo.Client
+	config  TrunkConfig
+	contact sip.ContactHeader
+	target  sip.Uri
+	aor     sip.Uri
+
+	callID string
+	tag    string
+	cseq   uint32
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newTrunkRegistrar(client *sipgo.Client, config TrunkConfig, transport string, host string, port int) *trunkRegistrar {
+	if config.Expires <= 0 {
+		config.Expires = defaultRegisterExpires
+	}
+	target := sip.Uri{Scheme: "sip"}
+	if err := sip.ParseUri("sip:"+config.Registrar, &target); err != nil {
+		target.Host = config.Registrar
+	}
+	if transport == "tcp" {
+		target.UriParams = sip.NewParams()
+		target.UriParams.Add("transport", "tcp")
+	}
+	domain := config.Domain
+	if domain == "" {
+		domain = target.Host
+	}
+
+	contact := sip.ContactHeader{
+		Address: sip.Uri{Scheme: "sip", User: config.Username, Host: host, Port: port},
+	}
+	if transport == "tcp" {
+		contact.Address.UriParams = sip.NewParams()
+		contact.Address.UriParams.Add("transport", "tcp")
+	}
+
+	return &trunkRegistrar{
+		client:  client,
+		config:  config,
+		contact: contact,
+		target:  target,
+		aor:     sip.Uri{Scheme: "sip", User: config.Username, Host: domain},
+		callID:  sip.GenerateTagN(16),
+		tag:     sip.GenerateTagN(8),
+		done:    make(chan struct{}),
+	}
+}
+
+// run 注册并在有效期到达前刷新，ctx 取消后注销
+func (r *trunkRegistrar) run(ctx context.Context) {
+	defer close(r.done)
+
+	for {
+		wait := registerRetryInterval
+		expires, err := r.register(ctx, r.config.Expires)
+		if err != nil {
+			log.Errorf("SIP 中继注册失败: %s, err: %v, %s 后重试", r.target.String(), err, registerRetryInterval)
+		} else {
+			log.Infof("SIP 中继注册成功: %s, 账号: %s, 有效期: %ds", r.target.String(), r.config.Username, expires)
+			// 提前刷新，避免到期后短暂不可达
+			wait = time.Duration(expires) * time.Second * 4 / 5
+		}
+
+		select {
+		case <-ctx.Done():
+			unregisterCtx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+			if _, err := r.register(unregisterCtx, 0); err != nil {
+				log.Warnf("SIP 中继注销失败: %v", err)
+			} else {
+				log.Infof("SIP 中继已注销: %s", r.target.String())
+			}
+			cancel()
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// wait 等待注销完成
+func (r *trunkRegistrar) wait() {
+	<-r.done
+}
+
+// register 发送一次 REGISTER，返回服务器批准的有效期
+func (r *trunkRegistrar) register(ctx context.Context, expires int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, registerTimeout)
+	defer cancel()
+
+	req := r.newRequest(expires)
+	res, err := r.client.Do(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode == sip.StatusUnauthorized || res.StatusCode == sip.StatusProxyAuthRequired {
+		res, err = r.client.DoDigestAuth(ctx, req, res, sipgo.DigestAuth{
+			Username: r.config.Username,
+			Password: r.config.Password,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	// 鉴权重发时 CSeq 已递增
+	if cseq := req.CSeq(); cseq != nil {
+		r.cseq = cseq.SeqNo
+	}
+	if res.StatusCode != sip.StatusOK {
+		return 0, fmt.Errorf("注册被拒绝: %d %s", res.StatusCode, res.Reason)
+	}
+
+	granted := expires
+	if h := res.GetHeader("Expires"); h != nil {
+		if v, err := strconv.Atoi(h.Value()); err == nil {
+			granted = v
+		}
+	}
+	if granted <= 0 && expires > 0 {
+		granted = expires
+	}
+	return granted, nil
+}
+
+func (r *trunkRegistrar) newRequest(expires int) *sip.Request {
+	r.cseq++
+	req := sip.NewRequest(sip.REGISTER, r.target)
+
+	fromParams := sip.NewParams()
+	fromParams.Add("tag", r.tag)
+	req.AppendHeader(&sip.FromHeader{Address: r.aor, Params: fromParams})
+	req.AppendHeader(&sip.ToHeader{Address: r.aor, Params: sip.NewParams()})
+	callID := sip.CallIDHeader(r.callID)
+	req.AppendHeader(&callID)
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: r.cseq, MethodName: sip.REGISTER})
+	contact := r.contact
+	req.AppendHeader(&contact)
+	req.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
+	return req
+}
@@ -0,0 +1,509 @@
+package sip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	// hello 中声明的上行音频参数：Opus 解码器可按任意采样率输出，电话音频编码后由服务端按 16kHz 解码
+	helloSampleRate    = 16000
+	helloFrameDuration = 20
+	// 一个 Opus 包最长 120ms
+	maxOpusFrameDuration = 120
+	// 下行播放缓冲上限，服务端按实时速度下发 TTS，正常情况下远小于该值
+	maxPlayoutDuration = 30 * time.Second
+)
+
+// DTMF 按键可配置的动作
+const (
+	DTMFActionAbort       = "abort"
+	DTMFActionHangup      = "hangup"
+	DTMFActionListenStart = "listen_start"
+	DTMFActionListenStop  = "listen_stop"
+	// text:<文本>，以该文本发送 listen detect，等同于用户说出这句话（或唤醒词）
+	DTMFActionTextPrefix = "text:"
+)
+
+// deviceMessage 代替话机发给会话的设备侧 JSON 消息
+type deviceMessage struct {
+	Type        string         `json:"type"`
+	DeviceID    string         `json:"device_id,omitempty"`
+	Version     int            `json:"version,omitempty"`
+	Transport   string         `json:"transport,omitempty"`
+	State       string         `json:"state,omitempty"`
+	Mode        string         `json:"mode,omitempty"`
+	Text        string         `json:"text,omitempty"`
+	AudioParams map[string]any `json:"audio_params,omitempty"`
+}
+
+// rawAudioDepacketizer 语音编码的每个 RTP 包都是完整的一帧，samplebuilder 只用来按序号重排
+type rawAudioDepacketizer struct{}
+
+func (rawAudioDepacketizer) Unmarshal(packet []byte) ([]byte, error) { return packet, nil }
+func (rawAudioDepacketizer) IsPartitionHead(payload []byte) bool     { return true }
+func (rawAudioDepacketizer) IsPartitionTail(marker bool, payload []byte) bool {
+	return true
+}
+
+// callOptions 单路通话的会话参数，来自网关配置
+type callOptions struct {
+	listenMode    string
+	wakeupText    string
+	dtmfActions   map[string]string
+	jitterPackets uint16
+}
+
+// SipConn 实现 types.IConn 接口，把一路 SIP 通话适配为一台虚拟设备：
+// 连接建立后代替设备发送 hello/listen，通话音频在 G.711/G.722 RTP 与 Opus 之间转码，DTMF 按键映射为命令，挂机映射为 goodbye
+type SipConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	onCloseCbList []func(deviceId string)
+	closeNotified sync.Once
+
+	deviceID     string
+	callerNumber string
+	callID       string
+	options      callOptions
+
+	codec      Codec
+	dtmf       bool
+	dtmfPT     uint8
+	rtpConn    *net.UDPConn
+	remoteAddr *net.UDPAddr
+	latched    bool
+	// 只接受来自 SDP 声明地址或信令源地址的 RTP，防止第三方抢先发包劫持媒体流
+	sdpIP         net.IP
+	signalingIP   net.IP
+	warnedForeign bool
+
+	// 上行：RTP 负载解码为 PCM 后按 20ms 编码为 Opus；下行：Opus 解码为 PCM 后按 20ms 编码为 RTP
+	processor     *audio.AudioProcesser
+	decodeRTP     func(dst []int16, payload []byte) []int16
+	encodeRTP     func(dst []byte, pcm []int16) []byte
+	playout       []int16
+	playoutMu     sync.Mutex
+	helloOnce     sync.Once
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+
+	closed bool
+	sync.RWMutex
+}
+
+// newSipConn 在应答 INVITE 前创建连接，signalingIP 为 INVITE 的来源地址，rtpConn 为本端 RTP 端口，media 为协商结果
+func newSipConn(deviceID, callerNumber, callID string, signalingIP net.IP, rtpConn *net.UDPConn, media *RemoteMedia, options callOptions) (*SipConn, error) {
+	processor, err := audio.GetAudioProcesser(media.Codec.SampleRate, 1, helloFrameDuration)
+	if err != nil {
+		return nil, fmt.Errorf("创建opus编解码器失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	instance := &SipConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		deviceID:      deviceID,
+		callerNumber:  callerNumber,
+		callID:        callID,
+		options:       options,
+		codec:         media.Codec,
+		dtmf:          media.DTMF,
+		dtmfPT:        media.DTMFPayloadType,
+		rtpConn:       rtpConn,
+		remoteAddr:    media.Addr,
+		sdpIP:         media.Addr.IP,
+		signalingIP:   signalingIP,
+		processor:     processor,
+		decodeRTP:     media.Codec.NewDecoder(),
+		encodeRTP:     media.Codec.NewEncoder(),
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+	}
+
+	// 话机没有协议栈，由连接代替设备发起 hello
+	instance.pushCmd(deviceMessage{
+		Type:      "hello",
+		DeviceID:  deviceID,
+		Version:   1,
+		Transport: types.TransportTypeSip,
+		AudioParams: map[string]any{
+			"format":         "opus",
+			"sample_rate":    helloSampleRate,
+			"channels":       1,
+			"frame_duration": helloFrameDuration,
+		},
+	})
+	return instance, nil
+}
+
+// start 启动 RTP 收发，在 200 OK 收到 ACK 后调用
+func (w *SipConn) start() {
+	go w.readRTP()
+	go w.writeRTP()
+}
+
+func (w *SipConn) pushCmd(msg deviceMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Errorf("SIP 生成设备消息失败: %v", err)
+		return
+	}
+	select {
+	case w.recvCmdChan <- data:
+	default:
+		log.Errorf("recv cmd channel is full")
+	}
+}
+
+func (w *SipConn) pushListenStart() {
+	w.pushCmd(deviceMessage{Type: "listen", State: "start", Mode: w.options.listenMode})
+}
+
+// readRTP 接收上行 RTP：语音包按序号重排后转码为 Opus，telephone-event 包转为按键
+func (w *SipConn) readRTP() {
+	builder := samplebuilder.New(w.options.jitterPackets, rawAudioDepacketizer{}, w.codec.ClockRate)
+	frameSamples := w.codec.FrameSamples()
+	var (
+		pcm           []int16
+		uplink        []int16
+		opusBuf       = make([]byte, 4000)
+		buf           = make([]byte, 1500)
+		lastDTMFStamp uint32
+		hasDTMF       bool
+	)
+
+	for {
+		n, addr, err := w.rtpConn.ReadFromUDP(buf)
+		if err != nil {
+			log.Debugf("SIP RTP 接收结束，设备ID: %s, err: %v", w.deviceID, err)
+			return
+		}
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+		if !w.latchRemote(addr) {
+			continue
+		}
+
+		switch {
+		case w.dtmf && packet.PayloadType == w.dtmfPT:
+			event, ok := ParseDTMFEvent(packet.Payload)
+			// 同一次按键的所有包时间戳相同，只在第一个包到达时触发
+			if !ok || (hasDTMF && packet.Timestamp == lastDTMFStamp) {
+				continue
+			}
+			lastDTMFStamp, hasDTMF = packet.Timestamp, true
+			w.handleDTMF(string(event.Digit))
+
+		case packet.PayloadType == w.codec.PayloadType:
+			builder.Push(packet)
+			for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+				pcm = w.decodeRTP(pcm, sample.Data)
+				uplink = append(uplink, pcm...)
+				for len(uplink) >= frameSamples {
+					size, err := w.processor.Encoder(uplink[:frameSamples], opusBuf)
+					uplink = append(uplink[:0], uplink[frameSamples:]...)
+					if err != nil {
+						log.Errorf("SIP 上行音频编码失败，设备ID: %s, err: %v", w.deviceID, err)
+						continue
+					}
+					select {
+					case <-w.ctx.Done():
+						return
+					case w.recvAudioChan <- append([]byte(nil), opusBuf[:size]...):
+					default:
+						log.Errorf("recv audio channel is full")
+					}
+				}
+			}
+		}
+	}
+}
+
+// latchRemote 对称 RTP：以收到的第一个包的源地址作为发送目标，适配位于 NAT 后的话机。
+// 源 IP 既不是 SDP 声明的地址也不是信令来源地址时丢弃该包并返回 false
+func (w *SipConn) latchRemote(addr *net.UDPAddr) bool {
+	w.Lock()
+	defer w.Unlock()
+	if !addr.IP.Equal(w.sdpIP) && !addr.IP.Equal(w.signalingIP) {
+		if !w.warnedForeign {
+			w.warnedForeign = true
+			log.Warnf("SIP 丢弃来自未知地址 %s 的RTP包，SDP地址: %s, 信令地址: %s, 设备ID: %s", addr, w.sdpIP, w.signalingIP, w.deviceID)
+		}
+		return false
+	}
+	if w.latched {
+		return true
+	}
+	w.latched = true
+	if addr.String() != w.remoteAddr.String() {
+		log.Infof("SIP RTP 对端地址 %s 与 SDP 声明的 %s 不一致，改为向实际地址发送，设备ID: %s", addr, w.remoteAddr, w.deviceID)
+		w.remoteAddr = addr
+	}
+	return true
+}
+
+// writeRTP 每 20ms 从播放缓冲取一帧发送，缓冲为空时发送静音，保持 RTP 流连续
+func (w *SipConn) writeRTP() {
+	frameSamples := w.codec.FrameSamples()
+	frame := make([]int16, frameSamples)
+	var payload []byte
+
+	header := rtp.Header{
+		Version:        2,
+		PayloadType:    w.codec.PayloadType,
+		SequenceNumber: uint16(rand.Uint32()),
+		Timestamp:      rand.Uint32(),
+		SSRC:           rand.Uint32(),
+		Marker:         true,
+	}
+
+	ticker := time.NewTicker(PacketDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		w.playoutMu.Lock()
+		n := copy(frame, w.playout)
+		w.playout = append(w.playout[:0], w.playout[n:]...)
+		w.playoutMu.Unlock()
+		clear(frame[n:])
+
+		payload = w.encodeRTP(payload, frame)
+		packet := rtp.Packet{Header: header, Payload: payload}
+		raw, err := packet.Marshal()
+		if err == nil {
+			w.RLock()
+			remote := w.remoteAddr
+			w.RUnlock()
+			if _, err := w.rtpConn.WriteToUDP(raw, remote); err != nil {
+				log.Debugf("SIP RTP 发送失败，设备ID: %s, err: %v", w.deviceID, err)
+			}
+		}
+
+		header.Marker = false
+		header.SequenceNumber++
+		header.Timestamp += w.codec.TimestampStep()
+	}
+}
+
+func (w *SipConn) clearPlayout() {
+	w.playoutMu.Lock()
+	w.playout = w.playout[:0]
+	w.playoutMu.Unlock()
+}
+
+// handleDTMF 执行按键对应的动作，RTP telephone-event 和 SIP INFO 两种方式的按键都走这里
+func (w *SipConn) handleDTMF(digit string) {
+	action, ok := w.options.dtmfActions[digit]
+	if !ok {
+		log.Debugf("SIP 按键 %s 未配置动作，设备ID: %s", digit, w.deviceID)
+		return
+	}
+	log.Infof("SIP 按键 %s -> %s，设备ID: %s", digit, action, w.deviceID)
+
+	switch {
+	case action == DTMFActionAbort:
+		w.clearPlayout()
+		w.pushCmd(deviceMessage{Type: "abort"})
+	case action == DTMFActionHangup:
+		go w.hangup()
+	case action == DTMFActionListenStart:
+		w.clearPlayout()
+		w.pushListenStart()
+	case action == DTMFActionListenStop:
+		w.pushCmd(deviceMessage{Type: "listen", State: "stop"})
+	case strings.HasPrefix(action, DTMFActionTextPrefix):
+		w.pushCmd(deviceMessage{Type: "listen", State: "detect", Text: strings.TrimPrefix(action, DTMFActionTextPrefix)})
+	default:
+		log.Warnf("SIP 不支持的按键动作: %s", action)
+	}
+}
+
+// remoteHangup 对端挂机：按设备主动 goodbye 处理，并通知注册方连接已断开
+func (w *SipConn) remoteHangup() {
+	w.pushCmd(deviceMessage{Type: "goodbye"})
+	w.notifyClose()
+}
+
+// hangup 本端按键挂机：通知注册方后关闭连接，由网关发送 BYE
+func (w *SipConn) hangup() {
+	w.pushCmd(deviceMessage{Type: "goodbye"})
+	w.notifyClose()
+	w.Close()
+}
+
+// notifyClose 通知注册方连接已断开，只通知一次
+func (w *SipConn) notifyClose() {
+	w.closeNotified.Do(func() {
+		w.RLock()
+		cbList := append([]func(deviceId string){}, w.onCloseCbList...)
+		w.RUnlock()
+		for _, cb := range cbList {
+			cb(w.deviceID)
+		}
+	})
+}
+
+// SendCmd 接收会话下发给设备的消息，话机无法展示，只据此驱动虚拟设备的状态
+func (w *SipConn) SendCmd(msg []byte) error {
+	w.RLock()
+	closed := w.closed
+	w.RUnlock()
+
+	if closed {
+		return errors.New("connection is closed")
+	}
+
+	log.Debugf("send cmd: %s", string(msg))
+
+	var serverMsg struct {
+		Type  string `json:"type"`
+		State string `json:"state"`
+		Text  string `json:"text"`
+	}
+	if err := json.Unmarshal(msg, &serverMsg); err != nil {
+		return nil
+	}
+
+	switch serverMsg.Type {
+	case "hello":
+		// 握手完成后开始拾音；配置了唤醒文本时再发送一次 listen detect，由会话播报欢迎语或直接回复
+		w.helloOnce.Do(func() {
+			w.pushListenStart()
+			if w.options.wakeupText != "" {
+				w.pushCmd(deviceMessage{Type: "listen", State: "detect", Text: w.options.wakeupText})
+			}
+		})
+	case "tts":
+		// 非 realtime 模式下，设备在播报结束后重新发送 listen start 进入下一轮
+		if serverMsg.State == "stop" && w.options.listenMode != "realtime" {
+			w.pushListenStart()
+		}
+	case "stt":
+		log.Infof("SIP 识别结果，设备ID: %s, 主叫: %s, 文本: %s", w.deviceID, w.callerNumber, serverMsg.Text)
+	}
+	return nil
+}
+
+// SendAudio 把下行 Opus 帧解码为 PCM 放入播放缓冲，由 writeRTP 按实时速度发送
+func (w *SipConn) SendAudio(data []byte) error {
+	w.RLock()
+	closed := w.closed
+	w.RUnlock()
+
+	if closed {
+		return errors.New("connection is closed")
+	}
+
+	pcm := make([]int16, w.codec.SampleRate*maxOpusFrameDuration/1000)
+	n, err := w.processor.Decoder(data, pcm)
+	if err != nil {
+		log.Errorf("send audio error: %v", err)
+		return err
+	}
+
+	maxSamples := int(maxPlayoutDuration/time.Millisecond) * w.codec.SampleRate / 1000
+	w.playoutMu.Lock()
+	defer w.playoutMu.Unlock()
+	if len(w.playout)+n > maxSamples {
+		log.Warnf("SIP 播放缓冲已满，丢弃音频，设备ID: %s", w.deviceID)
+		return nil
+	}
+	w.playout = append(w.playout, pcm[:n]...)
+	return nil
+}
+
+func (w *SipConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return w.recv(ctx, w.recvCmdChan, timeout)
+}
+
+func (w *SipConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return w.recv(ctx, w.recvAudioChan, timeout)
+}
+
+func (w *SipConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-ch:
+		return msg, nil
+	case <-w.ctx.Done():
+		return nil, errors.New("connection is closed")
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+// Close 结束通话，网关在连接关闭后发送 BYE
+func (w *SipConn) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return nil // Already closed
+	}
+	w.closed = true
+	w.cancel()
+	w.Unlock()
+
+	// 主动关闭时不再通知注册方
+	w.closeNotified.Do(func() {})
+	return w.rtpConn.Close()
+}
+
+// Done 通话结束（本端关闭）时关闭
+func (w *SipConn) Done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+func (w *SipConn) OnClose(cb func(deviceId string)) {
+	w.Lock()
+	defer w.Unlock()
+	w.onCloseCbList = append(w.onCloseCbList, cb)
+}
+
+func (w *SipConn) GetDeviceID() string {
+	return w.deviceID
+}
+
+func (w *SipConn) GetTransportType() string {
+	return types.TransportTypeSip
+}
+
+// GetData 支持获取 caller_number（主叫号码）和 call_id
+func (w *SipConn) GetData(key string) (interface{}, error) {
+	switch key {
+	case "caller_number":
+		return w.callerNumber, nil
+	case "call_id":
+		return w.callID, nil
+	}
+	return nil, fmt.Errorf("unknown key: %s", key)
+}
+
+func (w *SipConn) CloseAudioChannel() error {
+	return nil
+}
+
+var _ types.IConn = (*SipConn)(nil)
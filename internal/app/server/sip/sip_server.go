@@ -0,0 +1,515 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+const (
+	defaultListenPort     = 5060
+	defaultDeviceIDPrefix = "sip_"
+	defaultJitterPackets  = 5
+	byeTimeout            = 5 * time.Second
+	resolveTimeout        = 5 * time.Second
+	userAgent             = "xiaozhi-sip-gateway"
+)
+
+var defaultCodecs = []string{"G722", "PCMU", "PCMA"}
+
+// 默认按键：* 打断播报，# 挂机
+var defaultDTMFActions = map[string]string{
+	"*": DTMFActionAbort,
+	"#": DTMFActionHangup,
+}
+
+// SipConfig SIP 电话网关配置，对应配置文件中的 sip 节点
+type SipConfig struct {
+	ListenHost string `mapstructure:"listen_host"`
+	ListenPort int    `mapstructure:"listen_port"`
+	// 信令传输方式 udp/tcp
+	Transport string `mapstructure:"transport"`
+	// 写入 Contact 和 SDP 的本机地址，话机/中继必须能访问该地址
+	ExternalHost string `mapstructure:"external_host"`
+	// RTP 使用的 UDP 端口范围，为 0 时由系统分配
+	RTPPortMin int `mapstructure:"rtp_port_min"`
+	RTPPortMax int `mapstructure:"rtp_port_max"`
+	// 音频编码优先级，支持 G722/PCMU/PCMA
+	Codecs []string `mapstructure:"codecs"`
+	// 上行音频重排时最多等待的乱序包个数
+	JitterPackets uint16 `mapstructure:"jitter_packets"`
+
+	// 拾音模式 auto/manual/realtime，电话通常使用 realtime 以支持插话打断
+	ListenMode string `mapstructure:"listen_mode"`
+	// 接通后以该文本发送一次 listen detect，填写唤醒词时按 enable_greeting 播报欢迎语，为空则直接拾音
+	WakeupText string `mapstructure:"wakeup_text"`
+	// 按键动作：abort/hangup/listen_start/listen_stop/text:<文本>
+	DTMF map[string]string `mapstructure:"dtmf"`
+
+	// 允许发来 INVITE 的信令源地址（CIDR 或单个 IP），为空时只接受中继注册服务器的地址
+	TrustedSources []string `mapstructure:"trusted_sources"`
+	// 主叫号码到设备ID的映射，设备ID决定使用的智能体配置。
+	// 主叫号码取自 From 头，SIP 不对其做认证，任何能把 INVITE 发到网关的人都可以伪造，需配合 trusted_sources 使用
+	CallerDevices map[string]string `mapstructure:"caller_devices"`
+	// 是否接听未配置的主叫，设备ID为 device_id_prefix + 主叫号码
+	AllowUnknownCallers bool   `mapstructure:"allow_unknown_callers"`
+	DeviceIDPrefix      string `mapstructure:"device_id_prefix"`
+
+	// 向 SIP 中继/PBX 注册，用于接听打到该账号的电话
+	Trunk TrunkConfig `mapstructure:"trunk"`
+}
+
+// SipServer SIP 用户代理：接听 INVITE，协商 RTP 媒体后把通话作为虚拟设备交给 onNewConnection
+type SipServer struct {
+	config SipConfig
+	// trusted 由 trusted_sources（或中继注册服务器地址）解析出的可信信令源
+	trusted []netip.Prefix
+
+	ua      *sipgo.UserAgent
+	server  *sipgo.Server
+	client  *sipgo.Client
+	dialogs *sipgo.DialogServerCache
+
+	listener io.Closer
+	addr     net.Addr
+	// dialog ID -> *SipConn，用于 SIP INFO 按键
+	calls sync.Map
+
+	registrar *trunkRegistrar
+	cancel    context.CancelFunc
+
+	onNewConnection types.OnNewConnection
+}
+
+// SipServerOption 用于配置 SipServer 的可选参数
+type SipServerOption func(*SipServer)
+
+func WithOnNewConnection(onNewConnection types.OnNewConnection) SipServerOption {
+	return func(s *SipServer) {
+		s.onNewConnection = onNewConnection
+	}
+}
+
+// NewSipServer 创建 SIP 网关，Start 后开始监听
+func NewSipServer(config SipConfig, opts ...SipServerOption) (*SipServer, error) {
+	if config.ListenPort == 0 {
+		config.ListenPort = defaultListenPort
+	}
+	config.Transport = strings.ToLower(config.Transport)
+	if config.Transport == "" {
+		config.Transport = "udp"
+	}
+	if config.Transport != "udp" && config.Transport != "tcp" {
+		return nil, fmt.Errorf("不支持的SIP传输方式: %s", config.Transport)
+	}
+	if config.ExternalHost == "" {
+		config.ExternalHost = config.ListenHost
+		if ip := net.ParseIP(config.ListenHost); config.ListenHost == "" || (ip != nil && ip.IsUnspecified()) {
+			config.ExternalHost = "127.0.0.1"
+			log.Warnf("SIP 未配置 external_host，使用 %s，外部话机将无法接通", config.ExternalHost)
+		}
+	}
+	if len(config.Codecs) == 0 {
+		config.Codecs = defaultCodecs
+	}
+	for _, name := range config.Codecs {
+		if _, ok := LookupCodec(name); !ok {
+			return nil, fmt.Errorf("不支持的音频编码: %s", name)
+		}
+	}
+	if config.JitterPackets == 0 {
+		config.JitterPackets = defaultJitterPackets
+	}
+	if config.ListenMode == "" {
+		config.ListenMode = "realtime"
+	}
+	if config.DTMF == nil {
+		config.DTMF = defaultDTMFActions
+	}
+	// viper 会把配置的键转为小写，按键 A-D 统一为大写
+	dtmfActions := make(map[string]string, len(config.DTMF))
+	for digit, action := range config.DTMF {
+		dtmfActions[strings.ToUpper(digit)] = action
+	}
+	config.DTMF = dtmfActions
+	if config.DeviceIDPrefix == "" {
+		config.DeviceIDPrefix = defaultDeviceIDPrefix
+	}
+
+	trusted, err := parseTrustedSources(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(trusted) == 0 {
+		log.Warnf("SIP 未配置 trusted_sources 且未启用中继，将拒绝所有来电")
+	}
+
+	ua, err := sipgo.NewUA(sipgo.WithUserAgent(userAgent), sipgo.WithUserAgentHostname(config.ExternalHost))
+	if err != nil {
+		return nil, fmt.Errorf("创建SIP UA失败: %v", err)
+	}
+	server, err := sipgo.NewServer(ua)
+	if err != nil {
+		ua.Close()
+		return nil, fmt.Errorf("创建SIP服务失败: %v", err)
+	}
+	client, err := sipgo.NewClient(ua, sipgo.WithClientHostname(config.ExternalHost))
+	if err != nil {
+		ua.Close()
+		return nil, fmt.Errorf("创建SIP客户端失败: %v", err)
+	}
+
+	s := &SipServer{
+		config:  config,
+		trusted: trusted,
+		ua:      ua,
+		server:  server,
+		client:  client,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	server.OnInvite(s.onInvite)
+	server.OnAck(s.onAck)
+	server.OnBye(s.onBye)
+	server.OnInfo(s.onInfo)
+	server.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+	return s, nil
+}
+
+// Start 开始监听 SIP 信令，启用中继时在后台注册
+func (s *SipServer) Start() error {
+	address := net.JoinHostPort(s.config.ListenHost, strconv.Itoa(s.config.ListenPort))
+	var (
+		port  int
+		serve func() error
+	)
+	switch s.config.Transport {
+	case "tcp":
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("SIP 监听失败: %v", err)
+		}
+		s.listener, s.addr = listener, listener.Addr()
+		port = listener.Addr().(*net.TCPAddr).Port
+		serve = func() error { return s.server.ServeTCP(listener) }
+	default:
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return fmt.Errorf("SIP 监听失败: %v", err)
+		}
+		s.listener, s.addr = conn, conn.LocalAddr()
+		port = conn.LocalAddr().(*net.UDPAddr).Port
+		serve = func() error { return s.server.ServeUDP(conn) }
+	}
+
+	// 监听端口可能由系统分配，确定后再生成 Contact，并在开始处理请求前完成
+	contact := sip.ContactHeader{
+		Address: sip.Uri{Scheme: "sip", User: "xiaozhi", Host: s.config.ExternalHost, Port: port},
+	}
+	if s.config.Transport == "tcp" {
+		contact.Address.UriParams = sip.NewParams()
+		contact.Address.UriParams.Add("transport", "tcp")
+	}
+	s.dialogs = sipgo.NewDialogServerCache(s.client, contact)
+	go func() {
+		if err := serve(); err != nil {
+			log.Debugf("SIP 服务退出: %v", err)
+		}
+	}()
+	log.Infof("SIP 网关已启动，监听 %s/%s, 对外地址: %s:%d", s.addr, s.config.Transport, s.config.ExternalHost, port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	if s.config.Trunk.Enable {
+		s.registrar = newTrunkRegistrar(s.client, s.config.Trunk, s.config.Transport, s.config.ExternalHost, port)
+		go s.registrar.run(ctx)
+	}
+	return nil
+}
+
+// Addr 返回实际监听的地址
+func (s *SipServer) Addr() net.Addr {
+	return s.addr
+}
+
+// Stop 注销中继，挂断所有通话并停止监听
+func (s *SipServer) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.registrar != nil {
+		s.registrar.wait()
+	}
+	s.calls.Range(func(_, value any) bool {
+		value.(*SipConn).Close()
+		return true
+	})
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.ua.Close()
+}
+
+func (s *SipServer) callOptions() callOptions {
+	return callOptions{
+		listenMode:    s.config.ListenMode,
+		wakeupText:    s.config.WakeupText,
+		dtmfActions:   s.config.DTMF,
+		jitterPackets: s.config.JitterPackets,
+	}
+}
+
+// parseTrustedSources 解析可信信令源，未配置时使用中继注册服务器解析出的地址
+func parseTrustedSources(config SipConfig) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, source := range config.TrustedSources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(source); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, fmt.Errorf("无效的SIP可信来源: %s", source)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	if len(prefixes) > 0 || !config.Trunk.Enable {
+		return prefixes, nil
+	}
+
+	var target sip.Uri
+	host := config.Trunk.Registrar
+	if err := sip.ParseUri("sip:"+config.Trunk.Registrar, &target); err == nil {
+		host = target.Host
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return nil, fmt.Errorf("解析中继注册服务器 %s 失败，请配置 trusted_sources: %v", host, err)
+	}
+	for _, addr := range addrs {
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedSource 信令源地址（host:port）是否在可信来源内
+func (s *SipServer) trustedSource(source string) bool {
+	addrPort, err := netip.ParseAddrPort(source)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range s.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDevice 由主叫号码确定设备ID，未配置且不允许陌生来电时返回 false
+func (s *SipServer) resolveDevice(caller string) (string, bool) {
+	if deviceID, ok := s.config.CallerDevices[caller]; ok && deviceID != "" {
+		return deviceID, true
+	}
+	if !s.config.AllowUnknownCallers || caller == "" {
+		return "", false
+	}
+	return s.config.DeviceIDPrefix + caller, true
+}
+
+// callerNumber 取 From 头中的用户部分作为主叫号码
+func callerNumber(req *sip.Request) string {
+	from := req.From()
+	if from == nil {
+		return ""
+	}
+	return from.Address.User
+}
+
+func (s *SipServer) onInvite(req *sip.Request, tx sip.ServerTransaction) {
+	caller := callerNumber(req)
+	callID := ""
+	if h := req.CallID(); h != nil {
+		callID = h.Value()
+	}
+
+	// From 头不经认证，只接受可信来源（中继/PBX）转来的呼叫，否则任何人都能冒充已配置的主叫号码
+	source := req.Source()
+	if !s.trustedSource(source) {
+		log.Warnf("SIP 拒绝来自不可信地址 %s 的呼叫，主叫: %q, Call-ID: %s", source, caller, callID)
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusForbidden, "Forbidden", nil))
+		return
+	}
+
+	deviceID, ok := s.resolveDevice(caller)
+	if !ok {
+		log.Warnf("SIP 拒绝未授权的主叫: %q, Call-ID: %s", caller, callID)
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusForbidden, "Forbidden", nil))
+		return
+	}
+
+	dialog, err := s.dialogs.ReadInvite(req, tx)
+	if err != nil {
+		log.Errorf("SIP 处理INVITE失败，主叫: %s, err: %v", caller, err)
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusBadRequest, "Bad Request", nil))
+		return
+	}
+	defer dialog.Close()
+
+	media, err := ParseSDP(req.Body(), s.config.Codecs)
+	if err != nil {
+		log.Warnf("SIP 媒体协商失败，主叫: %s, err: %v", caller, err)
+		dialog.Respond(sip.StatusNotAcceptableHere, "Not Acceptable Here", nil)
+		return
+	}
+	dialog.Respond(sip.StatusTrying, "Trying", nil)
+
+	rtpConn, err := s.listenRTP()
+	if err != nil {
+		log.Errorf("SIP 分配RTP端口失败: %v", err)
+		dialog.Respond(sip.StatusServiceUnavailable, "Service Unavailable", nil)
+		return
+	}
+	var signalingIP net.IP
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		signalingIP = net.ParseIP(host)
+	}
+	conn, err := newSipConn(deviceID, caller, callID, signalingIP, rtpConn, media, s.callOptions())
+	if err != nil {
+		log.Errorf("SIP 创建连接失败，设备ID: %s, err: %v", deviceID, err)
+		rtpConn.Close()
+		dialog.Respond(sip.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+	defer conn.Close()
+
+	dtmfPayloadType := -1
+	if media.DTMF {
+		dtmfPayloadType = int(media.DTMFPayloadType)
+	}
+	answer, err := BuildSDP(s.config.ExternalHost, rtpConn.LocalAddr().(*net.UDPAddr).Port, []Codec{media.Codec}, dtmfPayloadType)
+	if err != nil {
+		log.Errorf("SIP 生成SDP失败: %v", err)
+		dialog.Respond(sip.StatusInternalServerError, "Internal Server Error", nil)
+		return
+	}
+	// 阻塞到收到 ACK
+	if err := dialog.RespondSDP(answer); err != nil {
+		log.Warnf("SIP 应答失败，主叫: %s, err: %v", caller, err)
+		return
+	}
+
+	log.Infof("SIP 通话已接通，主叫: %s, 设备ID: %s, 编码: %s, 对端RTP: %s", caller, deviceID, media.Codec.Name, media.Addr)
+	s.calls.Store(dialog.ID, conn)
+	defer s.calls.Delete(dialog.ID)
+
+	conn.start()
+	if s.onNewConnection != nil {
+		s.onNewConnection(conn)
+	}
+
+	select {
+	case <-dialog.Context().Done():
+		log.Infof("SIP 对端挂机，主叫: %s, 设备ID: %s", caller, deviceID)
+		conn.remoteHangup()
+	case <-conn.Done():
+		log.Infof("SIP 本端挂机，主叫: %s, 设备ID: %s", caller, deviceID)
+		ctx, cancel := context.WithTimeout(context.Background(), byeTimeout)
+		if err := dialog.Bye(ctx); err != nil {
+			log.Warnf("SIP 发送BYE失败，设备ID: %s, err: %v", deviceID, err)
+		}
+		cancel()
+	}
+}
+
+func (s *SipServer) onAck(req *sip.Request, tx sip.ServerTransaction) {
+	if err := s.dialogs.ReadAck(req, tx); err != nil {
+		log.Debugf("SIP 处理ACK失败: %v", err)
+	}
+}
+
+func (s *SipServer) onBye(req *sip.Request, tx sip.ServerTransaction) {
+	if err := s.dialogs.ReadBye(req, tx); err != nil {
+		if errors.Is(err, sipgo.ErrDialogDoesNotExists) {
+			tx.Respond(sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil))
+			return
+		}
+		log.Warnf("SIP 处理BYE失败: %v", err)
+	}
+}
+
+// onInfo 处理 SIP INFO 方式的按键（application/dtmf-relay 或 application/dtmf）
+func (s *SipServer) onInfo(req *sip.Request, tx sip.ServerTransaction) {
+	id, err := sip.DialogIDFromRequestUAS(req)
+	value, ok := s.calls.Load(id)
+	if err != nil || !ok {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist", nil))
+		return
+	}
+	tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+
+	if digit := parseDTMFInfo(req.Body()); digit != "" {
+		value.(*SipConn).handleDTMF(digit)
+	}
+}
+
+// parseDTMFInfo 解析 INFO 消息体中的按键，支持 "Signal=5\r\nDuration=160" 和单独的 "5" 两种格式
+func parseDTMFInfo(body []byte) string {
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if key, value, ok := strings.Cut(line, "="); ok {
+			if strings.EqualFold(strings.TrimSpace(key), "signal") {
+				line = strings.TrimSpace(value)
+			} else {
+				continue
+			}
+		}
+		if len(line) == 1 && strings.Contains(dtmfDigits, strings.ToUpper(line)) {
+			return strings.ToUpper(line)
+		}
+	}
+	return ""
+}
+
+// listenRTP 在配置的端口范围内分配 RTP 端口
+func (s *SipServer) listenRTP() (*net.UDPConn, error) {
+	ip := net.ParseIP(s.config.ListenHost)
+	if s.config.RTPPortMin <= 0 || s.config.RTPPortMax < s.config.RTPPortMin {
+		return net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	}
+	span := s.config.RTPPortMax - s.config.RTPPortMin + 1
+	start := rand.Intn(span)
+	for i := 0; i < span; i++ {
+		port := s.config.RTPPortMin + (start+i)%span
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("端口范围 %d-%d 内没有可用的RTP端口", s.config.RTPPortMin, s.config.RTPPortMax)
+}
@@ -0,0 +1,403 @@
+package sip
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/audio"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOffer = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.0.2.10\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.0.2.10\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 40000 RTP/AVP 0 8 9 96\r\n" +
+	"a=rtpmap:96 telephone-event/8000\r\n" +
+	"a=fmtp:96 0-15\r\n"
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		name      string
+		offer     string
+		preferred []string
+		codec     string
+		pt        uint8
+		dtmf      bool
+		wantErr   bool
+	}{
+		{"按本端优先级选择", testOffer, []string{"G722", "PCMU"}, "G722", 9, true, false},
+		{"静态负载类型无需 rtpmap", testOffer, []string{"PCMA"}, "PCMA", 8, true, false},
+		{"没有共同编码", strings.Replace(testOffer, "0 8 9 96", "18 96", 1), []string{"G722", "PCMU"}, "", 0, false, true},
+		{"不支持 SRTP", strings.Replace(testOffer, "RTP/AVP", "RTP/SAVP", 1), []string{"PCMU"}, "", 0, false, true},
+		{"没有按键", strings.Replace(testOffer, " 96\r\n", "\r\n", 1), []string{"PCMU"}, "PCMU", 0, false, false},
+		{
+			"动态负载类型的 G.722",
+			strings.Replace(testOffer, "0 8 9 96", "97 96", 1) + "a=rtpmap:97 G722/8000\r\n",
+			[]string{"G722"}, "G722", 97, true, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			media, err := ParseSDP([]byte(tt.offer), tt.preferred)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "192.0.2.10:40000", media.Addr.String())
+			assert.Equal(t, tt.codec, media.Codec.Name)
+			assert.Equal(t, tt.pt, media.Codec.PayloadType)
+			assert.Equal(t, tt.dtmf, media.DTMF)
+			if tt.dtmf {
+				assert.Equal(t, uint8(96), media.DTMFPayloadType)
+			}
+		})
+	}
+}
+
+func TestBuildSDPRoundTrip(t *testing.T) {
+	g722, _ := LookupCodec("g722")
+	pcmu, _ := LookupCodec("PCMU")
+	body, err := BuildSDP("203.0.113.5", 20002, []Codec{g722, pcmu}, DefaultDTMFPayloadType)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "a=rtpmap:101 telephone-event/8000")
+	assert.Contains(t, string(body), "a=ptime:20")
+
+	media, err := ParseSDP(body, []string{"PCMU", "G722"})
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5:20002", media.Addr.String())
+	assert.Equal(t, "PCMU", media.Codec.Name)
+	assert.True(t, media.DTMF)
+	assert.Equal(t, uint8(DefaultDTMFPayloadType), media.DTMFPayloadType)
+
+	body, err = BuildSDP("203.0.113.5", 20002, []Codec{pcmu}, -1)
+	require.NoError(t, err)
+	media, err = ParseSDP(body, []string{"PCMU"})
+	require.NoError(t, err)
+	assert.False(t, media.DTMF)
+}
+
+func TestCodecFraming(t *testing.T) {
+	g722, _ := LookupCodec("G722")
+	assert.Equal(t, 320, g722.FrameSamples())
+	assert.Equal(t, uint32(160), g722.TimestampStep())
+	assert.Len(t, g722.NewEncoder()(nil, make([]int16, g722.FrameSamples())), 160)
+
+	pcma, _ := LookupCodec("PCMA")
+	assert.Equal(t, 160, pcma.FrameSamples())
+	assert.Len(t, pcma.NewEncoder()(nil, make([]int16, pcma.FrameSamples())), 160)
+
+	_, ok := LookupCodec("opus")
+	assert.False(t, ok)
+}
+
+func TestDTMFEvent(t *testing.T) {
+	for _, digit := range []byte(dtmfDigits) {
+		event := DTMFEvent{Digit: digit, End: digit == '#', Volume: 10, Duration: 800}
+		parsed, ok := ParseDTMFEvent(event.Marshal())
+		require.True(t, ok)
+		assert.Equal(t, event, parsed)
+	}
+	assert.Nil(t, DTMFEvent{Digit: 'x'}.Marshal())
+
+	// 事件 16 是 flash，不是按键
+	_, ok := ParseDTMFEvent([]byte{16, 0, 0, 0})
+	assert.False(t, ok)
+	_, ok = ParseDTMFEvent([]byte{1, 0})
+	assert.False(t, ok)
+}
+
+func TestParseDTMFInfo(t *testing.T) {
+	assert.Equal(t, "5", parseDTMFInfo([]byte("Signal=5\r\nDuration=160\r\n")))
+	assert.Equal(t, "*", parseDTMFInfo([]byte("Signal= *\r\n")))
+	assert.Equal(t, "#", parseDTMFInfo([]byte("#")))
+	assert.Equal(t, "A", parseDTMFInfo([]byte("signal=a")))
+	assert.Equal(t, "", parseDTMFInfo([]byte("Duration=160")))
+	assert.Equal(t, "", parseDTMFInfo(nil))
+}
+
+func TestResolveDevice(t *testing.T) {
+	s := &SipServer{config: SipConfig{
+		CallerDevices:       map[string]string{"13800138000": "ba:8f:17:de:94:94"},
+		AllowUnknownCallers: true,
+		DeviceIDPrefix:      "sip_",
+	}}
+	deviceID, ok := s.resolveDevice("13800138000")
+	assert.True(t, ok)
+	assert.Equal(t, "ba:8f:17:de:94:94", deviceID)
+
+	deviceID, ok = s.resolveDevice("10086")
+	assert.True(t, ok)
+	assert.Equal(t, "sip_10086", deviceID)
+
+	_, ok = s.resolveDevice("")
+	assert.False(t, ok)
+
+	s.config.AllowUnknownCallers = false
+	_, ok = s.resolveDevice("10086")
+	assert.False(t, ok)
+	_, ok = s.resolveDevice("13800138000")
+	assert.True(t, ok)
+}
+
+func TestTrustedSources(t *testing.T) {
+	s, err := NewSipServer(SipConfig{TrustedSources: []string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"}})
+	require.NoError(t, err)
+	defer s.ua.Close()
+	assert.True(t, s.trustedSource("10.1.2.3:5060"))
+	assert.True(t, s.trustedSource("192.168.1.5:5080"))
+	assert.True(t, s.trustedSource("[2001:db8::1]:5060"))
+	assert.False(t, s.trustedSource("192.168.1.6:5060"))
+	assert.False(t, s.trustedSource("not-an-address"))
+
+	_, err = NewSipServer(SipConfig{TrustedSources: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+
+	// 未配置时默认只信任中继注册服务器
+	s, err = NewSipServer(SipConfig{Trunk: TrunkConfig{Enable: true, Registrar: "127.0.0.1:5060"}})
+	require.NoError(t, err)
+	defer s.ua.Close()
+	assert.True(t, s.trustedSource("127.0.0.1:5060"))
+	assert.False(t, s.trustedSource("127.0.0.2:5060"))
+
+	// 既没有可信来源也没有中继时拒绝所有来电
+	s, err = NewSipServer(SipConfig{})
+	require.NoError(t, err)
+	defer s.ua.Close()
+	assert.False(t, s.trustedSource("127.0.0.1:5060"))
+}
+
+func TestLatchRemoteOnlyFromKnownAddresses(t *testing.T) {
+	sdpAddr := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 40000}
+	w := &SipConn{remoteAddr: sdpAddr, sdpIP: sdpAddr.IP, signalingIP: net.ParseIP("203.0.113.5")}
+
+	// 第三方地址的包不能改变发送目标
+	assert.False(t, w.latchRemote(&net.UDPAddr{IP: net.ParseIP("198.51.100.9"), Port: 40000}))
+	assert.Equal(t, sdpAddr, w.remoteAddr)
+
+	// NAT 后的话机从信令来源地址发包，以实际地址为准
+	natAddr := &net.UDPAddr{IP: net.ParseIP("203.0.113.5"), Port: 51000}
+	assert.True(t, w.latchRemote(natAddr))
+	assert.Equal(t, natAddr, w.remoteAddr)
+	assert.True(t, w.latchRemote(sdpAddr))
+	assert.Equal(t, natAddr, w.remoteAddr)
+}
+
+func TestNewSipServerConfig(t *testing.T) {
+	_, err := NewSipServer(SipConfig{Codecs: []string{"G729"}})
+	assert.Error(t, err)
+	_, err = NewSipServer(SipConfig{Transport: "tls"})
+	assert.Error(t, err)
+
+	s, err := NewSipServer(SipConfig{})
+	require.NoError(t, err)
+	defer s.ua.Close()
+	assert.Equal(t, defaultListenPort, s.config.ListenPort)
+	assert.Equal(t, defaultCodecs, s.config.Codecs)
+	assert.Equal(t, "realtime", s.config.ListenMode)
+	assert.Equal(t, DTMFActionHangup, s.config.DTMF["#"])
+
+	s, err = NewSipServer(SipConfig{DTMF: map[string]string{"a": DTMFActionListenStart}})
+	require.NoError(t, err)
+	defer s.ua.Close()
+	assert.Equal(t, map[string]string{"A": DTMFActionListenStart}, s.config.DTMF)
+}
+
+// TestTrunkRegister 模拟需要摘要认证的注册服务器：首次 REGISTER 返回 401，带认证后返回 200，停止时注销
+func TestTrunkRegister(t *testing.T) {
+	ua, err := sipgo.NewUA()
+	require.NoError(t, err)
+	defer ua.Close()
+	registrar, err := sipgo.NewServer(ua)
+	require.NoError(t, err)
+
+	expires := make(chan string, 10)
+	var challenged atomic.Int32
+	registrar.OnRegister(func(req *sip.Request, tx sip.ServerTransaction) {
+		if req.GetHeader("Authorization") == nil {
+			challenged.Add(1)
+			res := sip.NewResponseFromRequest(req, sip.StatusUnauthorized, "Unauthorized", nil)
+			res.AppendHeader(sip.NewHeader("WWW-Authenticate", `Digest realm="test", nonce="abc123", algorithm=MD5`))
+			tx.Respond(res)
+			return
+		}
+		assert.Contains(t, req.GetHeader("Authorization").Value(), `username="1001"`)
+		assert.Equal(t, "1001", req.Contact().Address.User)
+		value := req.GetHeader("Expires").Value()
+		expires <- value
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		if value != "0" {
+			res.AppendHeader(sip.NewHeader("Expires", "120"))
+		}
+		tx.Respond(res)
+	})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go registrar.ServeUDP(conn)
+
+	clientUA, err := sipgo.NewUA()
+	require.NoError(t, err)
+	defer clientUA.Close()
+	client, err := sipgo.NewClient(clientUA, sipgo.WithClientHostname("127.0.0.1"))
+	require.NoError(t, err)
+
+	r := newTrunkRegistrar(client, TrunkConfig{
+		Enable:    true,
+		Registrar: conn.LocalAddr().String(),
+		Username:  "1001",
+		Password:  "secret",
+	}, "udp", "127.0.0.1", 5060)
+
+	granted, err := r.register(context.Background(), 300)
+	require.NoError(t, err)
+	assert.Equal(t, 120, granted)
+	assert.Equal(t, "300", <-expires)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.run(ctx)
+	select {
+	case v := <-expires:
+		assert.Equal(t, "300", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待注册超时")
+	}
+	cancel()
+	r.wait()
+	select {
+	case v := <-expires:
+		assert.Equal(t, "0", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待注销超时")
+	}
+	assert.Equal(t, int32(3), challenged.Load())
+}
+
+func requireOpus(t *testing.T, sampleRate int) {
+	t.Helper()
+	processor, err := audio.GetAudioProcesser(sampleRate, 1, helloFrameDuration)
+	if err != nil {
+		t.Skipf("opus不可用，跳过: %v", err)
+	}
+	if _, err := processor.Encoder(make([]int16, sampleRate*helloFrameDuration/1000), make([]byte, 4000)); err != nil {
+		t.Skipf("opus不可用，跳过: %v", err)
+	}
+}
+
+func recvMessage(t *testing.T, conn *SipConn) deviceMessage {
+	t.Helper()
+	data, err := conn.RecvCmd(context.Background(), 2)
+	require.NoError(t, err)
+	var msg deviceMessage
+	require.NoError(t, json.Unmarshal(data, &msg))
+	return msg
+}
+
+// TestSipConnVirtualDevice 验证连接代替话机完成 hello/listen、上下行音频转码、按键和挂机
+func TestSipConnVirtualDevice(t *testing.T) {
+	requireOpus(t, g722SampleRate(t))
+
+	phone, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer phone.Close()
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	codec, _ := LookupCodec("G722")
+	media := &RemoteMedia{Addr: phone.LocalAddr().(*net.UDPAddr), Codec: codec, DTMF: true, DTMFPayloadType: 101}
+	conn, err := newSipConn("sip_10086", "10086", "call-1", net.IPv4(127, 0, 0, 1), rtpConn, media, callOptions{
+		listenMode:    "realtime",
+		wakeupText:    "你好小智",
+		dtmfActions:   map[string]string{"*": DTMFActionAbort, "1": "text:今天天气怎么样"},
+		jitterPackets: 2,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	var closedDevice atomic.Value
+	conn.OnClose(func(deviceID string) { closedDevice.Store(deviceID) })
+	conn.start()
+
+	hello := recvMessage(t, conn)
+	assert.Equal(t, "hello", hello.Type)
+	assert.Equal(t, "sip", hello.Transport)
+	assert.Equal(t, "sip_10086", hello.DeviceID)
+
+	require.NoError(t, conn.SendCmd([]byte(`{"type":"hello","transport":"sip"}`)))
+	assert.Equal(t, deviceMessage{Type: "listen", State: "start", Mode: "realtime"}, recvMessage(t, conn))
+	assert.Equal(t, deviceMessage{Type: "listen", State: "detect", Text: "你好小智"}, recvMessage(t, conn))
+
+	// 上行语音：RTP 负载转码为 Opus
+	encode := codec.NewEncoder()
+	header := rtp.Header{Version: 2, PayloadType: codec.PayloadType, SequenceNumber: 100, Timestamp: 1000, SSRC: 1}
+	sendRTP := func(h rtp.Header, payload []byte) {
+		raw, err := (&rtp.Packet{Header: h, Payload: payload}).Marshal()
+		require.NoError(t, err)
+		_, err = phone.WriteToUDP(raw, rtpConn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		sendRTP(header, encode(nil, make([]int16, codec.FrameSamples())))
+		header.SequenceNumber++
+		header.Timestamp += codec.TimestampStep()
+	}
+	frame, err := conn.RecvAudio(context.Background(), 2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, frame)
+
+	// 按键：同一按键的重复包只触发一次
+	dtmf := header
+	dtmf.PayloadType = 101
+	for i := 0; i < 3; i++ {
+		sendRTP(dtmf, DTMFEvent{Digit: '1', End: i > 0, Duration: 800}.Marshal())
+		dtmf.SequenceNumber++
+	}
+	assert.Equal(t, deviceMessage{Type: "listen", State: "detect", Text: "今天天气怎么样"}, recvMessage(t, conn))
+	dtmf.Timestamp += 1600
+	sendRTP(dtmf, DTMFEvent{Digit: '*', End: true}.Marshal())
+	assert.Equal(t, deviceMessage{Type: "abort"}, recvMessage(t, conn))
+
+	// 下行：Opus 解码后按 20ms 发出 RTP
+	processor, err := audio.GetAudioProcesser(codec.SampleRate, 1, helloFrameDuration)
+	require.NoError(t, err)
+	opusBuf := make([]byte, 4000)
+	n, err := processor.Encoder(make([]int16, codec.FrameSamples()), opusBuf)
+	require.NoError(t, err)
+	require.NoError(t, conn.SendAudio(opusBuf[:n]))
+
+	phone.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, err = phone.Read(buf)
+	require.NoError(t, err)
+	var packet rtp.Packet
+	require.NoError(t, packet.Unmarshal(buf[:n]))
+	assert.Equal(t, codec.PayloadType, packet.PayloadType)
+	assert.Len(t, packet.Payload, 160)
+
+	// 对端挂机：发送 goodbye 并通知注册方
+	conn.remoteHangup()
+	assert.Equal(t, deviceMessage{Type: "goodbye"}, recvMessage(t, conn))
+	assert.Equal(t, "sip_10086", closedDevice.Load())
+
+	caller, err := conn.GetData("caller_number")
+	require.NoError(t, err)
+	assert.Equal(t, "10086", caller)
+	assert.Equal(t, "sip", conn.GetTransportType())
+}
+
+func g722SampleRate(t *testing.T) int {
+	codec, ok := LookupCodec("G722")
+	require.True(t, ok)
+	return codec.SampleRate
+}
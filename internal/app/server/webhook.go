@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/data/webhook"
+	"xiaozhi-esp32-server-golang/internal/domain/eventbus"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookTopic 回调 worker 池内部 topic：各 eventbus 事件转换为回调事件后统一路由到这里
+	webhookTopic = "webhook"
+	// webhookWorkerNum 回调上报是网络请求，使用独立的 worker 池，避免阻塞会话结束、退出聊天等事件的处理
+	webhookWorkerNum     = 4
+	webhookReportTimeout = 10 * time.Second
+	webhookMaxTextRunes  = 2000
+)
+
+// WebhookHandler 把回调事件上报到 manager，由 manager 匹配回调配置并负责签名、重试与投递记录
+type WebhookHandler struct {
+	client *webhook.Client
+}
+
+func (h *WebhookHandler) Process(ctx context.Context, data interface{}) error {
+	event, ok := data.(*webhook.Event)
+	if !ok || event == nil {
+		return nil
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, webhookReportTimeout)
+	defer cancel()
+	if err := h.client.Report(reqCtx, event); err != nil {
+		log.Warnf("回调事件上报失败, type=%s device=%s err=%v", event.Type, event.DeviceID, err)
+	}
+	return nil
+}
+
+// GetRoutingKey 按设备路由，保证同一设备的事件按顺序上报
+func (h *WebhookHandler) GetRoutingKey(data interface{}) string {
+	event, ok := data.(*webhook.Event)
+	if !ok || event == nil {
+		return ""
+	}
+	return event.DeviceID
+}
+
+// HandleWebhookEvents 订阅设备、会话、消息、工具调用与 OpenClaw 模式事件，转换为回调事件后交给回调 worker 池
+func (s *EventHandle) HandleWebhookEvents() error {
+	if s.webhookPool == nil {
+		return nil
+	}
+	route := func(event *webhook.Event) {
+		if event != nil {
+			s.webhookPool.Route(webhookTopic, event)
+		}
+	}
+	eventbus.Subscribe(eventbus.TopicDeviceOnline, func(event *eventbus.DeviceEvent) {
+		route(webhookFromDeviceEvent(webhook.EventDeviceOnline, event))
+	})
+	eventbus.Subscribe(eventbus.TopicDeviceOffline, func(event *eventbus.DeviceEvent) {
+		route(webhookFromDeviceEvent(webhook.EventDeviceOffline, event))
+	})
+	eventbus.Subscribe(eventbus.TopicSessionStart, func(clientState *ClientState) {
+		route(webhookFromSession(webhook.EventSessionStart, clientState))
+	})
+	eventbus.Subscribe(eventbus.TopicSessionEnd, func(clientState *ClientState) {
+		route(webhookFromSession(webhook.EventSessionEnd, clientState))
+	})
+	eventbus.Subscribe(eventbus.TopicAddMessage, func(event *eventbus.AddMessageEvent) {
+		route(webhookFromMessage(event))
+	})
+	eventbus.Subscribe(eventbus.TopicToolCall, func(event *eventbus.ToolCallEvent) {
+		route(webhookFromToolCall(event))
+	})
+	eventbus.Subscribe(eventbus.TopicOpenClawMode, func(event *eventbus.OpenClawModeEvent) {
+		route(webhookFromOpenClawMode(event))
+	})
+	return nil
+}
+
+// newWebhookEvent 在发布方 goroutine 中复制会话标识，避免异步上报时 ClientState 已变化
+func newWebhookEvent(eventType string, clientState *ClientState, timestamp time.Time) *webhook.Event {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	event := &webhook.Event{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		Timestamp: timestamp,
+		Data:      map[string]interface{}{},
+	}
+	if clientState != nil {
+		event.DeviceID = clientState.DeviceID
+		event.AgentID = clientState.AgentID
+		event.SessionID = clientState.SessionID
+	}
+	return event
+}
+
+func webhookFromDeviceEvent(eventType string, event *eventbus.DeviceEvent) *webhook.Event {
+	if event == nil || event.DeviceID == "" {
+		return nil
+	}
+	ret := newWebhookEvent(eventType, nil, event.Timestamp)
+	ret.DeviceID = event.DeviceID
+	ret.AgentID = event.AgentID
+	return ret
+}
+
+// webhookFromSession 会话事件以 session_id 作为事件ID：会话结束会从多处发布，manager 按事件ID去重
+func webhookFromSession(eventType string, clientState *ClientState) *webhook.Event {
+	if clientState == nil || clientState.DeviceID == "" || clientState.SessionID == "" {
+		return nil
+	}
+	event := newWebhookEvent(eventType, clientState, time.Now())
+	event.ID = eventType + ":" + clientState.SessionID
+	return event
+}
+
+// webhookFromMessage 仅上报新增的用户/助手文本消息，音频回填与工具结果消息不上报
+func webhookFromMessage(event *eventbus.AddMessageEvent) *webhook.Event {
+	if event == nil || event.ClientState == nil || event.IsUpdate || event.Msg.Content == "" {
+		return nil
+	}
+	var eventType string
+	switch event.Msg.Role {
+	case schema.User:
+		eventType = webhook.EventMessageUser
+	case schema.Assistant:
+		eventType = webhook.EventMessageAssistant
+	default:
+		return nil
+	}
+	ret := newWebhookEvent(eventType, event.ClientState, event.Timestamp)
+	if event.MessageID != "" {
+		ret.ID = eventType + ":" + event.MessageID
+	}
+	ret.Data["message_id"] = event.MessageID
+	ret.Data["turn_id"] = event.TurnID
+	ret.Data["role"] = string(event.Msg.Role)
+	ret.Data["content"] = event.Msg.Content
+	return ret
+}
+
+func webhookFromToolCall(event *eventbus.ToolCallEvent) *webhook.Event {
+	if event == nil || event.ClientState == nil {
+		return nil
+	}
+	ret := newWebhookEvent(webhook.EventToolCall, event.ClientState, event.Timestamp)
+	ret.Data["turn_id"] = event.TurnID
+	ret.Data["tool_call_id"] = event.ToolCallID
+	ret.Data["tool_name"] = event.ToolName
+	ret.Data["arguments"] = event.Arguments
+	ret.Data["result"] = truncateRunes(event.Result, webhookMaxTextRunes)
+	ret.Data["error"] = event.Error
+	ret.Data["success"] = event.Error == ""
+	ret.Data["duration_ms"] = event.Duration.Milliseconds()
+	return ret
+}
+
+func webhookFromOpenClawMode(event *eventbus.OpenClawModeEvent) *webhook.Event {
+	if event == nil || event.ClientState == nil {
+		return nil
+	}
+	ret := newWebhookEvent(webhook.EventOpenClawMode, event.ClientState, event.Timestamp)
+	ret.Data["enabled"] = event.Enabled
+	ret.Data["trigger"] = event.Trigger
+	return ret
+}
+
+func truncateRunes(text string, maxRunes int) string {
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+	return string([]rune(text)[:maxRunes]) + "..."
+}
@@ -0,0 +1,298 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	// opus RTP 时钟频率固定为 48kHz，与实际编码采样率无关
+	opusClockRate = 48000
+	// 无法从 TOC 解析帧时长时使用的默认值
+	defaultFrameDuration = 20 * time.Millisecond
+)
+
+// WebRTCConn 实现 types.IConn 接口，适配 WebRTC 连接
+// 信令（JSON 命令）走数据通道，音频走 Opus 音频轨道，上行音频经过 samplebuilder 按序号重排
+type WebRTCConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	onCloseCbList []func(deviceId string)
+	closeNotified sync.Once
+
+	pc         *webrtc.PeerConnection
+	audioTrack *webrtc.TrackLocalStaticSample
+	deviceID   string
+
+	dataChannel   *webrtc.DataChannel
+	dataReady     chan struct{}
+	dataReadyOnce sync.Once
+
+	jitterPackets uint16
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+
+	closed bool
+	sync.RWMutex
+}
+
+// newWebRTCConn 在完成 SDP 协商前创建连接并注册回调，jitterPackets 为上行音频最多等待乱序包的个数
+func newWebRTCConn(pc *webrtc.PeerConnection, audioTrack *webrtc.TrackLocalStaticSample, deviceID string, jitterPackets uint16) *WebRTCConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	instance := &WebRTCConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		pc:            pc,
+		audioTrack:    audioTrack,
+		deviceID:      deviceID,
+		dataReady:     make(chan struct{}),
+		jitterPackets: jitterPackets,
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+	}
+
+	pc.OnDataChannel(instance.onDataChannel)
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		log.Infof("WebRTC 收到音频轨道，设备ID: %s, codec: %s", deviceID, track.Codec().MimeType)
+		go instance.readAudioTrack(track)
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Infof("WebRTC 连接状态变化，设备ID: %s, 状态: %s", deviceID, state.String())
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			instance.notifyClose()
+		}
+	})
+
+	return instance
+}
+
+func (w *WebRTCConn) onDataChannel(dc *webrtc.DataChannel) {
+	w.Lock()
+	if w.dataChannel != nil {
+		w.Unlock()
+		log.Warnf("WebRTC 忽略多余的数据通道，设备ID: %s, label: %s", w.deviceID, dc.Label())
+		return
+	}
+	w.dataChannel = dc
+	w.Unlock()
+
+	dc.OnOpen(func() {
+		log.Infof("WebRTC 数据通道已打开，设备ID: %s, label: %s", w.deviceID, dc.Label())
+		w.dataReadyOnce.Do(func() { close(w.dataReady) })
+	})
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			log.Warnf("WebRTC 数据通道只接受文本消息，设备ID: %s", w.deviceID)
+			return
+		}
+		select {
+		case w.recvCmdChan <- msg.Data:
+		default:
+			log.Errorf("recv cmd channel is full")
+		}
+	})
+	dc.OnClose(func() {
+		log.Infof("WebRTC 数据通道已关闭，设备ID: %s", w.deviceID)
+		w.notifyClose()
+	})
+}
+
+// readAudioTrack 读取上行 RTP 包，按序号重排后以 Opus 帧送入接收队列
+func (w *WebRTCConn) readAudioTrack(track *webrtc.TrackRemote) {
+	builder := samplebuilder.New(w.jitterPackets, &codecs.OpusPacket{}, opusClockRate)
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			log.Debugf("WebRTC 音频轨道结束，设备ID: %s, err: %v", w.deviceID, err)
+			return
+		}
+		builder.Push(packet)
+		for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+			if len(sample.Data) == 0 {
+				continue
+			}
+			select {
+			case <-w.ctx.Done():
+				return
+			case w.recvAudioChan <- sample.Data:
+			default:
+				log.Errorf("recv audio channel is full")
+			}
+		}
+	}
+}
+
+// notifyClose 通知注册方连接已断开，只通知一次
+func (w *WebRTCConn) notifyClose() {
+	w.closeNotified.Do(func() {
+		w.RLock()
+		cbList := append([]func(deviceId string){}, w.onCloseCbList...)
+		w.RUnlock()
+		for _, cb := range cbList {
+			cb(w.deviceID)
+		}
+	})
+}
+
+// waitDataChannel 等待数据通道打开，超时未打开视为连接失败
+func (w *WebRTCConn) waitDataChannel(timeout time.Duration) bool {
+	select {
+	case <-w.dataReady:
+		return true
+	case <-w.ctx.Done():
+		return false
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (w *WebRTCConn) SendCmd(msg []byte) error {
+	w.RLock()
+	closed := w.closed
+	dc := w.dataChannel
+	w.RUnlock()
+
+	if closed {
+		return errors.New("connection is closed")
+	}
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return errors.New("data channel is not open")
+	}
+
+	log.Debugf("send cmd: %s", string(msg))
+
+	if err := dc.SendText(string(msg)); err != nil {
+		log.Errorf("send cmd error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (w *WebRTCConn) SendAudio(audio []byte) error {
+	w.RLock()
+	closed := w.closed
+	w.RUnlock()
+
+	if closed {
+		return errors.New("connection is closed")
+	}
+
+	duration := opusPacketDuration(audio)
+	if duration <= 0 {
+		duration = defaultFrameDuration
+	}
+	err := w.audioTrack.WriteSample(media.Sample{Data: audio, Duration: duration})
+	if err != nil {
+		log.Errorf("send audio error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (w *WebRTCConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return w.recv(ctx, w.recvCmdChan, timeout)
+}
+
+func (w *WebRTCConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return w.recv(ctx, w.recvAudioChan, timeout)
+}
+
+func (w *WebRTCConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-w.ctx.Done():
+		return nil, errors.New("connection is closed")
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (w *WebRTCConn) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return nil // Already closed
+	}
+	w.closed = true
+	w.cancel()
+	w.Unlock()
+
+	// 主动关闭时不再通知注册方；PeerConnection.Close 会同步触发状态回调，不能持锁调用
+	w.closeNotified.Do(func() {})
+	return w.pc.Close()
+}
+
+func (w *WebRTCConn) OnClose(cb func(deviceId string)) {
+	w.Lock()
+	defer w.Unlock()
+	w.onCloseCbList = append(w.onCloseCbList, cb)
+}
+
+func (w *WebRTCConn) GetDeviceID() string {
+	return w.deviceID
+}
+
+func (w *WebRTCConn) GetTransportType() string {
+	return types.TransportTypeWebRTC
+}
+
+func (w *WebRTCConn) GetData(key string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (w *WebRTCConn) CloseAudioChannel() error {
+	return nil
+}
+
+// opusPacketDuration 根据 Opus TOC 字节（RFC 6716 3.1）计算一个包包含的音频时长，无法解析时返回 0
+func opusPacketDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	config := toc >> 3
+
+	var frame time.Duration
+	switch {
+	case config < 12: // SILK
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16: // Hybrid
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default: // CELT
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+
+	switch toc & 0x03 {
+	case 0:
+		return frame
+	case 1, 2:
+		return 2 * frame
+	default:
+		if len(packet) < 2 {
+			return 0
+		}
+		return time.Duration(packet[1]&0x3F) * frame
+	}
+}
+
+var _ types.IConn = (*WebRTCConn)(nil)
@@ -0,0 +1,232 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// offer 请求体上限，SDP 一般只有几 KB
+	maxOfferSize = 64 * 1024
+
+	defaultJitterPackets  = 10
+	defaultConnectTimeout = 30 * time.Second
+	gatheringTimeout      = 10 * time.Second
+)
+
+// WebRTCConfig WebRTC 传输配置，对应配置文件中的 webrtc 节点
+type WebRTCConfig struct {
+	// ICE 服务器（STUN/TURN），服务端有公网 IP 时可以为空
+	ICEServers []ICEServerConfig `mapstructure:"ice_servers"`
+	// 服务端位于 NAT 后且做了端口映射时，在候选地址中使用的公网 IP
+	PublicIPs []string `mapstructure:"public_ips"`
+	// 媒体使用的 UDP 端口范围，为 0 时由系统分配
+	UDPPortMin uint16 `mapstructure:"udp_port_min"`
+	UDPPortMax uint16 `mapstructure:"udp_port_max"`
+	// 上行音频重排时最多等待的乱序包个数
+	JitterPackets uint16 `mapstructure:"jitter_packets"`
+	// 应答后等待数据通道打开的超时时间
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+}
+
+// ICEServerConfig STUN/TURN 服务器配置
+type ICEServerConfig struct {
+	URLs       []string `mapstructure:"urls"`
+	Username   string   `mapstructure:"username"`
+	Credential string   `mapstructure:"credential"`
+}
+
+// WebRTCServer 处理 SDP offer/answer 信令，协商成功后把连接交给 onNewConnection
+type WebRTCServer struct {
+	api    *webrtc.API
+	config WebRTCConfig
+
+	onNewConnection types.OnNewConnection
+}
+
+// WebRTCServerOption 用于配置 WebRTCServer 的可选参数
+type WebRTCServerOption func(*WebRTCServer)
+
+func WithOnNewConnection(onNewConnection types.OnNewConnection) WebRTCServerOption {
+	return func(s *WebRTCServer) {
+		s.onNewConnection = onNewConnection
+	}
+}
+
+// NewWebRTCServer 创建 WebRTC 服务器，只注册 Opus 音频编码
+func NewWebRTCServer(config WebRTCConfig, opts ...WebRTCServerOption) (*WebRTCServer, error) {
+	if config.JitterPackets == 0 {
+		config.JitterPackets = defaultJitterPackets
+	}
+	if config.ConnectTimeout <= 0 {
+		config.ConnectTimeout = defaultConnectTimeout
+	}
+
+	mediaEngine := &webrtc.MediaEngine{}
+	err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: opusCodecCapability(),
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio)
+	if err != nil {
+		return nil, fmt.Errorf("注册opus编码失败: %v", err)
+	}
+
+	// 默认拦截器提供 NACK 重传和 RTCP 报告
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, fmt.Errorf("注册拦截器失败: %v", err)
+	}
+
+	settingEngine := webrtc.SettingEngine{}
+	if config.UDPPortMin > 0 && config.UDPPortMax >= config.UDPPortMin {
+		if err := settingEngine.SetEphemeralUDPPortRange(config.UDPPortMin, config.UDPPortMax); err != nil {
+			return nil, fmt.Errorf("设置UDP端口范围失败: %v", err)
+		}
+	}
+	if len(config.PublicIPs) > 0 {
+		settingEngine.SetNAT1To1IPs(config.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+
+	s := &WebRTCServer{
+		api: webrtc.NewAPI(
+			webrtc.WithMediaEngine(mediaEngine),
+			webrtc.WithInterceptorRegistry(registry),
+			webrtc.WithSettingEngine(settingEngine),
+		),
+		config: config,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+func (s *WebRTCServer) iceServers() []webrtc.ICEServer {
+	iceServers := make([]webrtc.ICEServer, 0, len(s.config.ICEServers))
+	for _, server := range s.config.ICEServers {
+		iceServer := webrtc.ICEServer{URLs: server.URLs, Username: server.Username}
+		if server.Credential != "" {
+			iceServer.Credential = server.Credential
+		}
+		iceServers = append(iceServers, iceServer)
+	}
+	return iceServers
+}
+
+func opusCodecCapability() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeOpus,
+		ClockRate:   opusClockRate,
+		Channels:    2,
+		SDPFmtpLine: "minptime=10;useinbandfec=1",
+	}
+}
+
+// HandleOffer 处理设备的 SDP offer（POST JSON: {"type":"offer","sdp":"..."}），返回包含全部 ICE 候选的 answer
+// 设备身份由调用方校验后传入
+func (s *WebRTCServer) HandleOffer(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxOfferSize))
+	if err != nil {
+		http.Error(w, "读取请求失败", http.StatusBadRequest)
+		return
+	}
+	var offer webrtc.SessionDescription
+	if err := json.Unmarshal(body, &offer); err != nil || offer.Type != webrtc.SDPTypeOffer || offer.SDP == "" {
+		log.Warnf("WebRTC offer 格式错误，设备ID: %s, err: %v", deviceID, err)
+		http.Error(w, "无效的offer", http.StatusBadRequest)
+		return
+	}
+
+	conn, answer, err := s.accept(deviceID, offer)
+	if err != nil {
+		log.Errorf("WebRTC 协商失败，设备ID: %s, err: %v", deviceID, err)
+		http.Error(w, "WebRTC协商失败", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(answer); err != nil {
+		log.Errorf("WebRTC 发送answer失败，设备ID: %s, err: %v", deviceID, err)
+		conn.Close()
+		return
+	}
+
+	// 数据通道打开后设备才能发送 hello，此时再创建会话，避免为协商失败的连接分配资源
+	go func() {
+		if !conn.waitDataChannel(s.config.ConnectTimeout) {
+			log.Warnf("WebRTC 等待数据通道超时，设备ID: %s", deviceID)
+			conn.Close()
+			return
+		}
+		if s.onNewConnection != nil {
+			s.onNewConnection(conn)
+		}
+	}()
+}
+
+// accept 创建 PeerConnection 并完成 offer/answer 协商
+func (s *WebRTCServer) accept(deviceID string, offer webrtc.SessionDescription) (*WebRTCConn, *webrtc.SessionDescription, error) {
+	pc, err := s.api.NewPeerConnection(webrtc.Configuration{ICEServers: s.iceServers()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建PeerConnection失败: %v", err)
+	}
+
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(opusCodecCapability(), "audio", "xiaozhi")
+	if err != nil {
+		pc.Close()
+		return nil, nil, fmt.Errorf("创建音频轨道失败: %v", err)
+	}
+	sender, err := pc.AddTrack(audioTrack)
+	if err != nil {
+		pc.Close()
+		return nil, nil, fmt.Errorf("添加音频轨道失败: %v", err)
+	}
+	// 读取 RTCP，拦截器依赖它处理 NACK
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := newWebRTCConn(pc, audioTrack, deviceID, s.config.JitterPackets)
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("设置offer失败: %v", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("创建answer失败: %v", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("设置answer失败: %v", err)
+	}
+	// 不使用 trickle ICE，等待候选收集完成后一次性返回
+	select {
+	case <-gatherComplete:
+	case <-time.After(gatheringTimeout):
+		log.Warnf("WebRTC 收集ICE候选超时，使用已收集的候选，设备ID: %s", deviceID)
+	}
+
+	return conn, pc.LocalDescription(), nil
+}
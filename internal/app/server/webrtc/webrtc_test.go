@@ -0,0 +1,193 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpusPacketDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   time.Duration
+	}{
+		{"empty", nil, 0},
+		{"silk 20ms", []byte{1 << 3}, 20 * time.Millisecond},
+		{"silk 60ms", []byte{3 << 3}, 60 * time.Millisecond},
+		{"hybrid 10ms", []byte{12 << 3}, 10 * time.Millisecond},
+		{"celt 2.5ms", []byte{16 << 3}, 2500 * time.Microsecond},
+		{"celt 20ms", []byte{31 << 3}, 20 * time.Millisecond},
+		{"two frames", []byte{31<<3 | 1}, 40 * time.Millisecond},
+		{"code 3 three frames", []byte{31<<3 | 3, 3}, 60 * time.Millisecond},
+		{"code 3 missing count", []byte{31<<3 | 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, opusPacketDuration(tt.packet))
+		})
+	}
+}
+
+// testClient 模拟浏览器：发送麦克风音轨并创建数据通道
+type testClient struct {
+	pc       *webrtc.PeerConnection
+	track    *webrtc.TrackLocalStaticSample
+	dc       *webrtc.DataChannel
+	cmds     chan string
+	audio    chan []byte
+	dcOpened chan struct{}
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	c := &testClient{
+		pc:       pc,
+		cmds:     make(chan string, 10),
+		audio:    make(chan []byte, 100),
+		dcOpened: make(chan struct{}),
+	}
+	c.track, err = webrtc.NewTrackLocalStaticSample(opusCodecCapability(), "mic", "client")
+	require.NoError(t, err)
+	_, err = pc.AddTrack(c.track)
+	require.NoError(t, err)
+
+	c.dc, err = pc.CreateDataChannel("xiaozhi", nil)
+	require.NoError(t, err)
+	c.dc.OnOpen(func() { close(c.dcOpened) })
+	c.dc.OnMessage(func(msg webrtc.DataChannelMessage) { c.cmds <- string(msg.Data) })
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			c.audio <- packet.Payload
+		}
+	})
+	return c
+}
+
+// connect 通过信令端点完成 offer/answer
+func (c *testClient) connect(t *testing.T, url string) {
+	t.Helper()
+	offer, err := c.pc.CreateOffer(nil)
+	require.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(c.pc)
+	require.NoError(t, c.pc.SetLocalDescription(offer))
+	<-gatherComplete
+
+	body, _ := json.Marshal(c.pc.LocalDescription())
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var answer webrtc.SessionDescription
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&answer))
+	require.NoError(t, c.pc.SetRemoteDescription(answer))
+}
+
+func TestWebRTCConnLoopback(t *testing.T) {
+	newConns := make(chan types.IConn, 1)
+	server, err := NewWebRTCServer(WebRTCConfig{JitterPackets: 5}, WithOnNewConnection(func(conn types.IConn) {
+		newConns <- conn
+	}))
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.HandleOffer(w, r, "webrtc-test-device")
+	}))
+	defer httpServer.Close()
+
+	client := newTestClient(t)
+	client.connect(t, httpServer.URL)
+
+	var conn types.IConn
+	select {
+	case conn = <-newConns:
+	case <-time.After(10 * time.Second):
+		t.Fatal("数据通道打开后应创建连接")
+	}
+	<-client.dcOpened
+	assert.Equal(t, "webrtc-test-device", conn.GetDeviceID())
+	assert.Equal(t, types.TransportTypeWebRTC, conn.GetTransportType())
+	closed := make(chan string, 1)
+	conn.OnClose(func(deviceId string) { closed <- deviceId })
+
+	ctx := context.Background()
+
+	// 信令：数据通道双向收发
+	require.NoError(t, client.dc.SendText(`{"type":"hello"}`))
+	cmd, err := conn.RecvCmd(ctx, 5)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"hello"}`, string(cmd))
+
+	require.NoError(t, conn.SendCmd([]byte(`{"type":"tts","state":"start"}`)))
+	select {
+	case got := <-client.cmds:
+		assert.JSONEq(t, `{"type":"tts","state":"start"}`, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("客户端未收到下行信令")
+	}
+
+	// 上行音频：samplebuilder 需要下一包到达才输出上一包，最后一包留在缓冲中
+	for i := 0; i < 5; i++ {
+		frame := []byte{31 << 3, byte(i)}
+		require.NoError(t, client.track.WriteSample(media.Sample{Data: frame, Duration: 20 * time.Millisecond}))
+		time.Sleep(20 * time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		audio, err := conn.RecvAudio(ctx, 5)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{31 << 3, byte(i)}, audio)
+	}
+
+	// 下行音频
+	require.NoError(t, conn.SendAudio([]byte{31 << 3, 0xAA}))
+	select {
+	case got := <-client.audio:
+		assert.Equal(t, []byte{31 << 3, 0xAA}, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("客户端未收到下行音频")
+	}
+
+	// 客户端断开后通知注册方
+	client.pc.Close()
+	select {
+	case deviceID := <-closed:
+		assert.Equal(t, "webrtc-test-device", deviceID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("客户端断开后应触发 OnClose")
+	}
+	require.NoError(t, conn.Close())
+	assert.Error(t, conn.SendCmd([]byte("{}")))
+}
+
+func TestHandleOfferRejectsInvalidRequest(t *testing.T) {
+	server, err := NewWebRTCServer(WebRTCConfig{})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	server.HandleOffer(rec, httptest.NewRequest(http.MethodGet, "/offer", nil), "dev")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.HandleOffer(rec, httptest.NewRequest(http.MethodPost, "/offer", bytes.NewBufferString(`{"type":"answer","sdp":"x"}`)), "dev")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -54,6 +54,11 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("authEnable: %v", authEnable)
 	if authEnable {
 		configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
+		if err != nil {
+			log.Errorf("获取配置Provider失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
 		//检查此deviceId是否已认证
 		isActivited, err := configProvider.IsDeviceActivated(r.Context(), deviceId, clientId)
 		if err != nil {
@@ -81,7 +86,12 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 		otaConfigPrefix = "ota.external."
 	}
 
-	mqttInfo := getMqttInfo(deviceId, clientId, otaConfigPrefix, ip)
+	// 未激活的设备不下发MQTT凭据：凭据中签名的 clientId 就是内置 MQTT 服务器认定的设备身份，
+	// 否则任何人拿他人的 MAC 请求 OTA 即可订阅该设备的下行主题
+	var mqttInfo *MqttInfo
+	if activationInfo == nil {
+		mqttInfo = getMqttInfo(deviceId, clientId, otaConfigPrefix, ip)
+	}
 	//密码
 	respData := &OtaResponse{
 		Websocket: WebsocketInfo{
@@ -114,8 +124,11 @@ func getMqttInfo(deviceId, clientId, otaConfigPrefix, ip string) *MqttInfo {
 		return nil
 	}
 
-	// 生成MQTT凭据
-	signatureKey := viper.GetString("ota.signature_key")
+	// 生成MQTT凭据：每台设备的密码是对自身 clientId 的签名，内置 MQTT 服务器据此确定设备身份和可访问的主题
+	signatureKey := util.MqttSignatureKey()
+	if signatureKey == "" {
+		log.Warnf("未配置 ota.signature_key，下发的MQTT凭据无法通过内置MQTT服务器鉴权")
+	}
 	credentials, err := util.GenerateMqttCredentials(deviceId, clientId, ip, signatureKey)
 	if err != nil {
 		log.Errorf("生成MQTT凭据失败: %v", err)
@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// newActivationBackend 模拟后台管理系统的设备激活接口
+func newActivationBackend(activated bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/public/device/check-activation":
+			json.NewEncoder(w).Encode(map[string]interface{}{"activated": activated})
+		case "/api/public/device/activation-info":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"activated": activated,
+				"code":      "123456",
+				"challenge": "challenge",
+				"message":   "请在控制台输入验证码",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func requestOta(t *testing.T) OtaResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/xiaozhi/ota/", nil)
+	req.Header.Set("Device-Id", "aa:bb:cc:dd:ee:ff")
+	req.Header.Set("Client-Id", "client-1")
+	req.RemoteAddr = "8.8.8.8:1234"
+	rec := httptest.NewRecorder()
+	(&WebSocketServer{}).handleOta(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp OtaResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp
+}
+
+func TestOtaWithholdsMqttCredentialsUntilActivated(t *testing.T) {
+	for key, value := range map[string]interface{}{
+		"auth.enable":                true,
+		"config_provider.type":       "manager",
+		"ota.signature_key":          "test-key",
+		"ota.external.mqtt.enable":   true,
+		"ota.external.mqtt.endpoint": "mqtt.example.com:1883",
+	} {
+		viper.Set(key, value)
+		defer viper.Set(key, nil)
+	}
+
+	pending := newActivationBackend(false)
+	defer pending.Close()
+	t.Setenv("BACKEND_URL", pending.URL)
+	resp := requestOta(t)
+	if resp.Activation == nil {
+		t.Fatalf("未激活设备应返回激活信息")
+	}
+	if resp.Mqtt != nil {
+		t.Fatalf("未激活设备不应下发MQTT凭据: %+v", resp.Mqtt)
+	}
+
+	activated := newActivationBackend(true)
+	defer activated.Close()
+	t.Setenv("BACKEND_URL", activated.URL)
+	resp = requestOta(t)
+	if resp.Activation != nil {
+		t.Fatalf("已激活设备不应返回激活信息: %+v", resp.Activation)
+	}
+	if resp.Mqtt == nil || resp.Mqtt.Password == "" {
+		t.Fatalf("已激活设备应下发MQTT凭据: %+v", resp.Mqtt)
+	}
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
@@ -10,8 +11,10 @@ import (
 
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/data/history"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/openclaw"
+	"xiaozhi-esp32-server-golang/internal/domain/tts"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -30,8 +33,19 @@ type WebSocketServer struct {
 
 	onNewConnection    types.OnNewConnection
 	onOpenClawResponse func(event openclaw.ResponseDelivery) bool
+
+	// 对外 MCP 服务器（Streamable HTTP），为空时不注册
+	mcpServerPath    string
+	mcpServerHandler http.Handler
+
+	// WebRTC 信令端点，为空时不注册
+	webrtcPath        string
+	webrtcOfferHandle WebRTCOfferHandler
 }
 
+// WebRTCOfferHandler 处理已通过设备校验的 WebRTC offer 请求
+type WebRTCOfferHandler func(w http.ResponseWriter, r *http.Request, deviceID string)
+
 // Option 类型定义
 // WebSocketServerOption 用于配置 WebSocketServer 的可选参数
 type WebSocketServerOption func(*WebSocketServer)
@@ -62,6 +76,22 @@ func WithOnOpenClawResponse(handler func(event openclaw.ResponseDelivery) bool)
 	}
 }
 
+// WithMCPServer 设置对外 MCP 服务器的路径与处理器
+func WithMCPServer(path string, handler http.Handler) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.mcpServerPath = path
+		s.mcpServerHandler = handler
+	}
+}
+
+// WithWebRTC 设置 WebRTC 信令端点的路径与处理函数，设备校验与 WebSocket 连接相同
+func WithWebRTC(path string, handle WebRTCOfferHandler) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.webrtcPath = path
+		s.webrtcOfferHandle = handle
+	}
+}
+
 // NewWebSocketServer 创建新的 WebSocket 服务器（WithOption 方式）
 func NewWebSocketServer(port int, opts ...WebSocketServerOption) *WebSocketServer {
 	s := &WebSocketServer{
@@ -105,12 +135,26 @@ func (s *WebSocketServer) Start() error {
 	http.HandleFunc("/xiaozhi/api/vision", s.handleVisionAPI) //图片识别API
 
 	http.HandleFunc("/admin/inject_msg", s.handleInjectMsg)
+	http.HandleFunc("/admin/history_spool", s.handleHistorySpoolStats)
+	http.HandleFunc("/admin/tts_health", s.handleTTSHealth)
+	if s.mcpServerHandler != nil && s.mcpServerPath != "" {
+		http.Handle(s.mcpServerPath, s.mcpServerHandler)
+	}
+	if s.webrtcOfferHandle != nil && s.webrtcPath != "" {
+		http.HandleFunc(s.webrtcPath, s.handleWebRTCOffer)
+	}
 
 	listenAddr := fmt.Sprintf("0.0.0.0:%d", s.port)
 	log.Infof("WebSocket 服务器启动在 ws://%s/xiaozhi/v1/", listenAddr)
 	log.Infof("MCP WebSocket 端点: ws://%s/mcp?token=xxx", listenAddr)
 	log.Infof("OpenClaw WebSocket 端点: ws://%s/ws/openclaw?token=xxx", listenAddr)
 	log.Infof("MCP API 端点: http://%s/xiaozhi/api/mcp/tools/{deviceId}", listenAddr)
+	if s.mcpServerHandler != nil && s.mcpServerPath != "" {
+		log.Infof("MCP 服务器端点: http://%s%s (Authorization: Bearer xxx)", listenAddr, s.mcpServerPath)
+	}
+	if s.webrtcOfferHandle != nil && s.webrtcPath != "" {
+		log.Infof("WebRTC 信令端点: http://%s%s", listenAddr, s.webrtcPath)
+	}
 
 	if err := http.ListenAndServe(listenAddr, nil); err != nil {
 		log.Log().Fatalf("WebSocket 服务器启动失败: %v", err)
@@ -144,12 +188,34 @@ func (s *WebSocketServer) handleMqttUdpChat(w http.ResponseWriter, r *http.Reque
 
 // handleWebSocket 处理 WebSocket 连接
 func (s *WebSocketServer) internalHandleChat(w http.ResponseWriter, r *http.Request, isMqttUdp bool) {
+	deviceID, ok := s.authenticateDevice(w, r)
+	if !ok {
+		return
+	}
+
+	// 升级 HTTP 连接为 WebSocket
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Errorf("WebSocket 升级失败: %v", err)
+		return
+	}
+
+	// 适配为 IConn 接口
+	wsConn := NewWebSocketConn(conn, deviceID, isMqttUdp)
+	if s.onNewConnection != nil {
+		s.onNewConnection(wsConn)
+	}
+
+}
+
+// authenticateDevice 校验设备请求头，失败时已写入错误响应
+func (s *WebSocketServer) authenticateDevice(w http.ResponseWriter, r *http.Request) (string, bool) {
 	// 验证请求头
 	deviceID := r.Header.Get("Device-Id")
 	if deviceID == "" {
 		log.Warn("缺少 Device-Id 请求头")
 		http.Error(w, "缺少 Device-Id 请求头", http.StatusBadRequest)
-		return
+		return "", false
 	}
 
 	/*isAuth := viper.GetBool("auth.enable")
@@ -158,32 +224,54 @@ func (s *WebSocketServer) internalHandleChat(w http.ResponseWriter, r *http.Requ
 		if token == "" {
 			log.Warn("缺少 Authorization 请求头")
 			http.Error(w, "缺少 Authorization 请求头", http.StatusUnauthorized)
-			return
+			return "", false
 		}
 
 		// 验证令牌
 		if !s.authManager.ValidateToken(token) {
 			log.Warnf("无效的令牌: %s", token)
 			http.Error(w, "无效的令牌", http.StatusUnauthorized)
-			return
+			return "", false
 		}
 	}*/
 
-	// 升级 HTTP 连接为 WebSocket
-	conn, err := s.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Errorf("WebSocket 升级失败: %v", err)
+	return deviceID, true
+}
+
+// handleWebRTCOffer 处理 WebRTC offer，允许浏览器跨域调用
+func (s *WebSocketServer) handleWebRTCOffer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Device-Id, Client-Id, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// 适配为 IConn 接口
-	wsConn := NewWebSocketConn(conn, deviceID, isMqttUdp)
-	if s.onNewConnection != nil {
-		s.onNewConnection(wsConn)
+	deviceID, ok := s.authenticateDevice(w, r)
+	if !ok {
+		return
 	}
-
+	s.webrtcOfferHandle(w, r, deviceID)
 }
 
 func (s *WebSocketServer) handleInjectMsg(w http.ResponseWriter, r *http.Request) {
 
 }
+
+// handleHistorySpoolStats 查询聊天记录落盘队列积压情况
+func (s *WebSocketServer) handleHistorySpoolStats(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"enabled": false}
+	if spool := history.DefaultSpool(); spool != nil {
+		resp["enabled"] = true
+		resp["stats"] = spool.Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleTTSHealth 查询各TTS配置的健康状态（连续失败次数、冷却截止时间等）
+func (s *WebSocketServer) handleTTSHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": tts.HealthSnapshot()})
+}
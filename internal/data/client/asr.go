@@ -5,6 +5,7 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"time"
 	asr_types "xiaozhi-esp32-server-golang/internal/domain/asr/types"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -27,6 +28,9 @@ type Asr struct {
 	AsrType string // ASR 类型，如 "funasr", "doubao"
 	Mode    string // ASR 模式，如 "online", "offline"
 
+	// DetectedLanguage 最近一次识别中 ASR 返回的语种，引擎不支持语种识别时为空
+	DetectedLanguage string
+
 	// ClientState 引用，用于回调通知
 	ClientState *ClientState
 
@@ -48,6 +52,7 @@ func (a *Asr) RetireAsrResult(ctx context.Context) (string, bool, error) {
 	// 使用局部变量跟踪是否已发送首次字符事件
 	firstTextSent := false
 	lastAliyunText := ""
+	a.DetectedLanguage = ""
 
 	for {
 		select {
@@ -62,6 +67,9 @@ func (a *Asr) RetireAsrResult(ctx context.Context) (string, bool, error) {
 				}
 				return "", false, result.Error
 			}
+			if result.Language != "" {
+				a.DetectedLanguage = result.Language
+			}
 
 			// 检测首次返回字符（文本不为空且未发送过）
 			if result.Text != "" && !firstTextSent && a.ClientState != nil && a.ClientState.OnAsrFirstTextCallback != nil {
@@ -70,6 +78,13 @@ func (a *Asr) RetireAsrResult(ctx context.Context) (string, bool, error) {
 				a.ClientState.OnAsrFirstTextCallback(result.Text, result.IsFinal)
 			}
 
+			// 部分识别结果参与自适应断句：只关心文本结尾，增量或全量结果都适用
+			if result.Text != "" && a.ClientState != nil {
+				if detector := a.ClientState.Endpointer(); detector != nil {
+					detector.OnPartial(result.Text, time.Now())
+				}
+			}
+
 			// 如果是 funasr 的流式模式（online），直接返回 IsFinal 中的文字
 			if a.AsrType == "funasr" {
 				if a.Mode == "2pass" || a.Mode == "online" {
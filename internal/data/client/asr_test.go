@@ -41,3 +41,24 @@ func TestRetireAsrResult_DoubaoNonRetryableError(t *testing.T) {
 		t.Fatalf("expected isRetry to be false")
 	}
 }
+
+func TestRetireAsrResult_RecordsDetectedLanguage(t *testing.T) {
+	a := &Asr{
+		AsrType:          "aliyun_qwen3",
+		AsrResultChannel: make(chan asr_types.StreamingResult, 2),
+		DetectedLanguage: "zh",
+	}
+	a.AsrResultChannel <- asr_types.StreamingResult{Text: "hello", Language: "en"}
+	a.AsrResultChannel <- asr_types.StreamingResult{Text: " world", IsFinal: true}
+
+	text, _, err := a.RetireAsrResult(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text != "hello world" {
+		t.Fatalf("expected merged text, got %q", text)
+	}
+	if a.DetectedLanguage != "en" {
+		t.Fatalf("expected detected language en, got %q", a.DetectedLanguage)
+	}
+}
@@ -10,8 +10,12 @@ import (
 	"time"
 
 	"sync"
+	"sync/atomic"
 
+	"xiaozhi-esp32-server-golang/internal/domain/audio/aec"
 	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/endpointing"
+	"xiaozhi-esp32-server-golang/internal/domain/i18n"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/memory"
@@ -33,12 +37,6 @@ type Dialogue struct {
 }
 
 const (
-	ClientStatusInit       = "init"
-	ClientStatusListening  = "listening"
-	ClientStatusListenStop = "listenStop"
-	ClientStatusLLMStart   = "llmStart"
-	ClientStatusTTSStart   = "ttsStart"
-
 	MemoryModeNone  = "none"
 	MemoryModeShort = "short"
 	MemoryModeLong  = "long"
@@ -62,8 +60,6 @@ type ClientState struct {
 	IsActivated bool
 	// 对话历史
 	Dialogue *Dialogue
-	// 打断状态
-	Abort bool
 	// 拾音模式
 	ListenMode string
 	// 设备ID
@@ -96,6 +92,10 @@ type ClientState struct {
 	//prompt, 系统提示词
 	SystemPrompt string
 
+	// 当前对话语言，auto 模式下随 ASR 识别结果切换；ASR 协程写入，LLM/TTS/欢迎语并发读取，经 GetLanguage/UpdateLanguage 加锁访问
+	language     string
+	languageLock sync.RWMutex
+
 	InputAudioFormat  AudioFormat //输入音频格式
 	OutputAudioFormat AudioFormat //输出音频格式
 
@@ -112,10 +112,10 @@ type ClientState struct {
 	MqttLastActiveTs int64         //最后活跃时间
 	VadLastActiveTs  int64         //vad最后活跃时间, 超过 60s && 没有在tts则断开连接
 
-	Status string //状态 listening, llmStart, ttsStart
+	// 对话状态机：idle → listening → recognizing → thinking → speaking（可被 interrupted），并维护当前轮次ID
+	Conversation ConversationStateMachine
 
-	IsTtsStart        bool //是否tts开始
-	IsWelcomeSpeaking bool //是否已经欢迎语
+	IsWelcomeSpeaking bool //是否已经播放过欢迎语
 
 	// 声纹识别相关
 	SpeakerProvider speaker.SpeakerProvider // 声纹识别提供者（在 session 中初始化）
@@ -125,6 +125,46 @@ type ClientState struct {
 
 	// ASR首次返回字符的回调函数（在 session 中设置）
 	OnAsrFirstTextCallback func(text string, isFinal bool)
+
+	// 回声消除器（realtime 模式且启用 chat.aec 时在 session 中初始化），TTS 发送协程写入参考信号、VAD 协程处理麦克风音频
+	echoCanceller atomic.Pointer[aec.Canceller]
+
+	// 自适应断句检测器（按智能体 asr_speed 初始化），为 nil 时使用固定静音阈值 SilenceThresholdTime
+	endpointer atomic.Pointer[endpointing.Detector]
+}
+
+// EchoCanceller 获取回声消除器，未启用时返回 nil
+func (c *ClientState) EchoCanceller() *aec.Canceller {
+	return c.echoCanceller.Load()
+}
+
+// SetEchoCanceller 设置回声消除器，传 nil 关闭
+func (c *ClientState) SetEchoCanceller(canceller *aec.Canceller) {
+	c.echoCanceller.Store(canceller)
+}
+
+// Endpointer 获取自适应断句检测器，未启用时返回 nil
+func (c *ClientState) Endpointer() *endpointing.Detector {
+	return c.endpointer.Load()
+}
+
+// SetEndpointer 设置自适应断句检测器，传 nil 退回固定静音阈值
+func (c *ClientState) SetEndpointer(detector *endpointing.Detector) {
+	c.endpointer.Store(detector)
+}
+
+// IsEndOfUtterance 判断连续静音 silenceMs 后用户是否已说完：启用自适应断句时综合部分识别结果判断，否则比较固定静音阈值
+func (c *ClientState) IsEndOfUtterance(silenceMs int64) bool {
+	detector := c.Endpointer()
+	if detector == nil {
+		return c.IsSilence(silenceMs)
+	}
+	decision := detector.Decide(silenceMs, time.Now())
+	if decision.End {
+		log.Debugf("自适应断句: 静音 %dms, 阈值 %dms, 完整度 %.2f, 稳定: %v, 文本: %s, turnID: %s",
+			silenceMs, decision.ThresholdMs, decision.Completeness, decision.Stable, decision.Text, c.TurnID())
+	}
+	return decision.End
 }
 
 // IsSpeakerEnabled 检查是否启用声纹识别（从全局配置中读取）
@@ -148,6 +188,30 @@ func (c *ClientState) GetMemoryMode() string {
 	return NormalizeMemoryMode(c.DeviceConfig.MemoryMode)
 }
 
+// GetLanguage 获取当前对话语言：固定语言直接返回，auto 模式返回最近一次识别出的语言
+func (c *ClientState) GetLanguage() string {
+	c.languageLock.RLock()
+	defer c.languageLock.RUnlock()
+	return i18n.Resolve(c.DeviceConfig.Language, "", "", c.language)
+}
+
+// UpdateLanguage 根据本轮 ASR 语种与用户文本更新对话语言（固定语言时不变），返回更新前后的语言
+func (c *ClientState) UpdateLanguage(asrLanguage, text string) (string, string) {
+	c.languageLock.Lock()
+	defer c.languageLock.Unlock()
+	previous := i18n.Resolve(c.DeviceConfig.Language, "", "", c.language)
+	c.language = i18n.Resolve(c.DeviceConfig.Language, asrLanguage, text, c.language)
+	return previous, c.language
+}
+
+// GetLanguageVoice 获取当前对话语言对应的音色，未配置时返回空
+func (c *ClientState) GetLanguageVoice() string {
+	if len(c.DeviceConfig.LanguageVoices) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(c.DeviceConfig.LanguageVoices[c.GetLanguage()])
+}
+
 func (c *ClientState) GetDeviceIDOrAgentID() string {
 	if c.AgentID != "" {
 		return c.AgentID
@@ -275,14 +339,6 @@ func (c *ClientState) InitMessages(messages []*schema.Message) error {
 
 //历史消息相关的方法结束
 
-func (c *ClientState) SetTtsStart(isStart bool) {
-	c.IsTtsStart = isStart
-}
-
-func (c *ClientState) GetTtsStart() bool {
-	return c.IsTtsStart
-}
-
 func (c *ClientState) GetMaxIdleDuration() int64 {
 	if !viper.IsSet("chat.max_idle_duration") {
 		return 30000
@@ -304,12 +360,23 @@ func (c *ClientState) IsActive() bool {
 	return c.MqttLastActiveTs > 0 && diff <= ClientActiveTs
 }
 
-func (c *ClientState) SetStatus(status string) {
-	c.Status = status
+// GetState 当前对话状态
+func (c *ClientState) GetState() ConversationState {
+	return c.Conversation.State()
 }
 
-func (c *ClientState) GetStatus() string {
-	return c.Status
+// TurnID 当前对话轮次ID
+func (c *ClientState) TurnID() string {
+	return c.Conversation.TurnID()
+}
+
+// SetState 迁移对话状态，非法迁移只记录日志并保持原状态（并发触发点较多，如播报中到达的 ASR 回调）
+func (c *ClientState) SetState(to ConversationState, reason string) bool {
+	if err := c.Conversation.Transition(to, reason); err != nil {
+		log.Debugf("忽略对话状态迁移, deviceID: %s, sessionID: %s, %v", c.DeviceID, c.SessionID, err)
+		return false
+	}
+	return true
 }
 
 type Ctx struct {
@@ -420,13 +487,15 @@ func (c *ClientState) Destroy() {
 
 	c.VoiceStatus.Reset()
 	c.AsrAudioBuffer.ClearAsrAudioData()
+	if detector := c.Endpointer(); detector != nil {
+		detector.Reset()
+	}
 
 	c.SessionCtx.Reset()
 	c.AfterAsrSessionCtx.Reset()
 
 	c.Statistic.Reset()
-	c.SetStatus(ClientStatusInit)
-	c.SetTtsStart(false)
+	c.SetState(StateIdle, "reset")
 }
 
 func (state *ClientState) OnManualStop() {
@@ -441,7 +510,7 @@ func (state *ClientState) OnVoiceSilence() {
 	//释放vad
 	state.Vad.Reset() //释放vad实例
 
-	state.SetStatus(ClientStatusListenStop)
+	state.SetState(StateRecognizing, "voice_silence")
 
 	// 如果设置了异步获取声纹结果的回调，则调用
 	if state.OnVoiceSilenceSpeakerCallback != nil {
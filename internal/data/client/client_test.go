@@ -0,0 +1,56 @@
+package client
+
+import (
+	"sync"
+	"testing"
+
+	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+// ASR 协程更新对话语言的同时 LLM/TTS 读取语言和音色，需在 -race 下无数据竞争
+func TestLanguageConcurrentAccess(t *testing.T) {
+	state := &ClientState{DeviceConfig: utypes.UConfig{
+		Language:       "auto",
+		LanguageVoices: map[string]string{"zh": "zh_voice", "en": "en_voice"},
+	}}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if i%2 == 0 {
+				state.UpdateLanguage("en", "hello there")
+			} else {
+				state.UpdateLanguage("zh", "你好")
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if lang := state.GetLanguage(); lang != "zh" && lang != "en" {
+				t.Errorf("unexpected language %q", lang)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if voice := state.GetLanguageVoice(); voice != "zh_voice" && voice != "en_voice" {
+				t.Errorf("unexpected voice %q", voice)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	previous, current := state.UpdateLanguage("en", "good morning")
+	if current != "en" || state.GetLanguage() != "en" {
+		t.Fatalf("language = %q, want en", current)
+	}
+	if previous != "zh" && previous != "en" {
+		t.Fatalf("previous = %q", previous)
+	}
+}
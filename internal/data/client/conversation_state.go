@@ -0,0 +1,210 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConversationState 会话对话状态
+type ConversationState string
+
+const (
+	StateIdle        ConversationState = "idle"        // 空闲：未拾音也未播报
+	StateListening   ConversationState = "listening"   // 拾音中，等待用户说话
+	StateRecognizing ConversationState = "recognizing" // 用户说话中或等待 ASR 最终结果
+	StateThinking    ConversationState = "thinking"    // LLM 处理中（含工具调用）
+	StateSpeaking    ConversationState = "speaking"    // TTS 播报中
+	StateInterrupted ConversationState = "interrupted" // 播报或思考被打断
+)
+
+// conversationTransitions 合法的状态迁移，任意状态都可以回到 idle
+// thinking/speaking → recognizing 只出现在 realtime 模式未打断播报时用户开始说下一句
+var conversationTransitions = map[ConversationState][]ConversationState{
+	StateIdle:        {StateListening, StateRecognizing, StateThinking, StateSpeaking},
+	StateListening:   {StateRecognizing, StateThinking, StateSpeaking},
+	StateRecognizing: {StateListening, StateThinking},
+	StateThinking:    {StateSpeaking, StateListening, StateRecognizing, StateInterrupted},
+	StateSpeaking:    {StateThinking, StateListening, StateRecognizing, StateInterrupted},
+	StateInterrupted: {StateListening, StateRecognizing, StateThinking, StateSpeaking},
+}
+
+// CanTransition 判断 from → to 是否合法（相同状态视为合法的空操作）
+func CanTransition(from, to ConversationState) bool {
+	if from == to || to == StateIdle {
+		return true
+	}
+	for _, next := range conversationTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// startsTurn 判断迁移是否开始新的一轮对话：
+// 用户开始说话（进入 recognizing）；或未经识别直接进入思考/播报，如文本输入、欢迎语、主动播报
+// 思考与播报之间的往返（工具调用）属于同一轮
+func startsTurn(from, to ConversationState) bool {
+	switch to {
+	case StateRecognizing:
+		return true
+	case StateThinking, StateSpeaking:
+		return from == StateIdle || from == StateListening || from == StateInterrupted
+	}
+	return false
+}
+
+// AsrRestartAllowed ASR 返回空结果时是否允许重启识别
+// 非 realtime 模式只在拾音和识别中重启，一轮结束回到 idle 后必须由设备显式 listen start 进入拾音，
+// 避免会话空闲后残留的事件重新拉起 ASR；realtime 模式需要持续监听，除了会话重置后的 idle 外都允许重启
+func AsrRestartAllowed(state ConversationState, realtime bool) bool {
+	if realtime {
+		return state != StateIdle
+	}
+	switch state {
+	case StateListening, StateRecognizing:
+		return true
+	}
+	return false
+}
+
+// Transition 一次状态迁移
+type Transition struct {
+	From     ConversationState
+	To       ConversationState
+	TurnID   string        // 迁移后的轮次ID
+	Reason   string        // 触发原因，如 listen_start、asr_final、tts_stop、abort
+	Duration time.Duration // 在 From 状态停留的时长
+	At       time.Time
+}
+
+// TransitionHook 状态迁移回调，在迁移完成后于调用方 goroutine 中同步执行，不应阻塞
+type TransitionHook func(Transition)
+
+// ErrInvalidTransition 非法状态迁移
+type ErrInvalidTransition struct {
+	From, To ConversationState
+	Reason   string
+}
+
+func (e *ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("invalid conversation transition %s -> %s (%s)", e.From, e.To, e.Reason)
+}
+
+// ConversationStateMachine 每个会话一个的对话状态机，零值即为 idle 状态，可直接使用
+// 负责校验状态迁移、分配轮次ID（turn ID 贯穿 ASR/LLM/TTS/聊天记录）并通知迁移回调
+type ConversationStateMachine struct {
+	mu      sync.Mutex
+	state   ConversationState
+	turnID  string
+	turnSeq uint64
+	since   time.Time
+	hooks   []TransitionHook
+}
+
+// State 当前状态
+func (m *ConversationStateMachine) State() ConversationState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current()
+}
+
+func (m *ConversationStateMachine) current() ConversationState {
+	if m.state == "" {
+		return StateIdle
+	}
+	return m.state
+}
+
+// Is 当前状态是否为 states 之一
+func (m *ConversationStateMachine) Is(states ...ConversationState) bool {
+	current := m.State()
+	for _, state := range states {
+		if current == state {
+			return true
+		}
+	}
+	return false
+}
+
+// TurnID 当前轮次ID，尚未开始任何轮次时为空
+func (m *ConversationStateMachine) TurnID() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.turnID
+}
+
+// TurnSeq 当前会话内的轮次序号，从 1 开始
+func (m *ConversationStateMachine) TurnSeq() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.turnSeq
+}
+
+// OnTransition 注册状态迁移回调
+func (m *ConversationStateMachine) OnTransition(hook TransitionHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Transition 迁移到 to；非法迁移返回 *ErrInvalidTransition 且状态不变，相同状态为空操作
+func (m *ConversationStateMachine) Transition(to ConversationState, reason string) error {
+	_, err := m.transitionIf(to, reason, nil)
+	return err
+}
+
+// Interrupt 思考或播报中被打断时迁移到 interrupted，返回是否发生了打断
+func (m *ConversationStateMachine) Interrupt(reason string) bool {
+	return m.TransitionFrom(StateInterrupted, reason, StateThinking, StateSpeaking)
+}
+
+// TransitionFrom 仅当前状态为 from 之一时迁移到 to，返回是否发生了迁移
+// 用于只对特定来源状态生效的事件，例如打断后迟到的句子事件不应开始新的一轮
+func (m *ConversationStateMachine) TransitionFrom(to ConversationState, reason string, from ...ConversationState) bool {
+	ok, _ := m.transitionIf(to, reason, func(current ConversationState) bool {
+		for _, state := range from {
+			if current == state {
+				return true
+			}
+		}
+		return false
+	})
+	return ok
+}
+
+// transitionIf 在持锁状态下检查 cond 与迁移合法性，返回是否发生了迁移
+func (m *ConversationStateMachine) transitionIf(to ConversationState, reason string, cond func(from ConversationState) bool) (bool, error) {
+	m.mu.Lock()
+	from := m.current()
+	if from == to || (cond != nil && !cond(from)) {
+		m.mu.Unlock()
+		return false, nil
+	}
+	if !CanTransition(from, to) {
+		m.mu.Unlock()
+		return false, &ErrInvalidTransition{From: from, To: to, Reason: reason}
+	}
+
+	now := time.Now()
+	if startsTurn(from, to) {
+		m.turnSeq++
+		m.turnID = uuid.NewString()
+	}
+	transition := Transition{From: from, To: to, TurnID: m.turnID, Reason: reason, At: now}
+	if !m.since.IsZero() {
+		transition.Duration = now.Sub(m.since)
+	}
+	m.state = to
+	m.since = now
+	hooks := m.hooks
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(transition)
+	}
+	return true, nil
+}
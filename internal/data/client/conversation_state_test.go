@@ -0,0 +1,179 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+type stateStep struct {
+	to        ConversationState
+	interrupt bool // 使用 Interrupt 而不是 Transition
+	wantState ConversationState
+	wantErr   bool
+	newTurn   bool // 迁移后轮次ID是否变化
+}
+
+func TestConversationStateMachine(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []stateStep
+	}{
+		{
+			name: "非 realtime 完整一轮",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateThinking, wantState: StateThinking},
+				{to: StateSpeaking, wantState: StateSpeaking},
+				{to: StateThinking, wantState: StateThinking}, // 工具调用后继续思考，同一轮
+				{to: StateSpeaking, wantState: StateSpeaking},
+				{to: StateIdle, wantState: StateIdle},
+			},
+		},
+		{
+			name: "播报中 abort 打断后重新拾音",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateThinking, wantState: StateThinking},
+				{to: StateSpeaking, wantState: StateSpeaking},
+				{interrupt: true, wantState: StateInterrupted},
+				{interrupt: true, wantState: StateInterrupted}, // 重复打断为空操作
+				{to: StateIdle, wantState: StateIdle},
+				{to: StateListening, wantState: StateListening},
+			},
+		},
+		{
+			name: "拾音中打断不生效",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{interrupt: true, wantState: StateListening},
+				{to: StateInterrupted, wantState: StateListening, wantErr: true},
+			},
+		},
+		{
+			name: "realtime 播报结束回到拾音，下一句开始新一轮",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateThinking, wantState: StateThinking},
+				{to: StateSpeaking, wantState: StateSpeaking},
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+			},
+		},
+		{
+			name: "realtime 未打断时播报中用户开口",
+			steps: []stateStep{
+				{to: StateThinking, wantState: StateThinking, newTurn: true},
+				{to: StateSpeaking, wantState: StateSpeaking},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+			},
+		},
+		{
+			name: "realtime VAD 打断后识别",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateThinking, wantState: StateThinking},
+				{interrupt: true, wantState: StateInterrupted},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateThinking, wantState: StateThinking},
+			},
+		},
+		{
+			name: "欢迎语从空闲直接播报",
+			steps: []stateStep{
+				{to: StateSpeaking, wantState: StateSpeaking, newTurn: true},
+				{to: StateIdle, wantState: StateIdle},
+			},
+		},
+		{
+			name: "非法迁移保持原状态",
+			steps: []stateStep{
+				{to: StateListening, wantState: StateListening},
+				{to: StateRecognizing, wantState: StateRecognizing, newTurn: true},
+				{to: StateSpeaking, wantState: StateRecognizing, wantErr: true},
+				{to: StateInterrupted, wantState: StateRecognizing, wantErr: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m ConversationStateMachine
+			if m.State() != StateIdle {
+				t.Fatalf("zero value state = %s, want idle", m.State())
+			}
+			for i, step := range tt.steps {
+				prevTurn := m.TurnID()
+				var err error
+				if step.interrupt {
+					m.Interrupt("test")
+				} else {
+					err = m.Transition(step.to, "test")
+				}
+				var invalid *ErrInvalidTransition
+				if step.wantErr != errors.As(err, &invalid) {
+					t.Fatalf("step %d: err = %v, wantErr %v", i, err, step.wantErr)
+				}
+				if got := m.State(); got != step.wantState {
+					t.Fatalf("step %d: state = %s, want %s", i, got, step.wantState)
+				}
+				if changed := m.TurnID() != prevTurn; changed != step.newTurn {
+					t.Fatalf("step %d: turn changed = %v, want %v", i, changed, step.newTurn)
+				}
+			}
+		})
+	}
+}
+
+func TestConversationStateHooks(t *testing.T) {
+	var m ConversationStateMachine
+	var got []Transition
+	m.OnTransition(func(tr Transition) {
+		got = append(got, tr)
+	})
+
+	m.Transition(StateListening, "listen_start")
+	m.Transition(StateListening, "listen_start") // 相同状态不触发回调
+	m.Transition(StateRecognizing, "asr_first_text")
+	m.Transition(StateSpeaking, "bad")                         // 非法迁移不触发回调
+	m.TransitionFrom(StateSpeaking, "sentence", StateThinking) // 不在 thinking，不迁移
+	m.Transition(StateThinking, "llm_request")
+
+	if len(got) != 3 {
+		t.Fatalf("got %d transitions, want 3: %+v", len(got), got)
+	}
+	if got[1].From != StateListening || got[1].To != StateRecognizing || got[1].Reason != "asr_first_text" || got[1].TurnID == "" {
+		t.Fatalf("unexpected transition: %+v", got[1])
+	}
+	if got[2].TurnID != got[1].TurnID || m.TurnSeq() != 1 {
+		t.Fatalf("thinking should stay in the same turn: %+v, seq=%d", got[2], m.TurnSeq())
+	}
+}
+
+func TestAsrRestartAllowed(t *testing.T) {
+	tests := []struct {
+		state    ConversationState
+		realtime bool
+		want     bool
+	}{
+		{StateIdle, false, false}, // 空闲后需显式 listen start 才重新拾音
+		{StateListening, false, true},
+		{StateRecognizing, false, true},
+		{StateThinking, false, false},
+		{StateSpeaking, false, false},
+		{StateInterrupted, false, false},
+		{StateIdle, true, false},
+		{StateListening, true, true},
+		{StateThinking, true, true},
+		{StateSpeaking, true, true},
+		{StateInterrupted, true, true},
+	}
+	for _, tt := range tests {
+		if got := AsrRestartAllowed(tt.state, tt.realtime); got != tt.want {
+			t.Errorf("AsrRestartAllowed(%s, %v) = %v, want %v", tt.state, tt.realtime, got, tt.want)
+		}
+	}
+}
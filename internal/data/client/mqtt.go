@@ -10,6 +10,7 @@ const (
 	DeviceSubTopicPrefix     = msg.MDeviceSubTopicPrefix
 	DevicePubTopicPrefix     = msg.MDevicePubTopicPrefix
 	ServerSubTopicPrefix     = msg.MServerSubTopicPrefix
+	ServerShareSubTopic      = msg.MServerShareSubTopic
 	ServerPubTopicPrefix     = msg.MServerPubTopicPrefix
 )
 
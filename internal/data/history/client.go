@@ -150,3 +150,41 @@ func (c *HistoryClient) GetMessages(ctx context.Context, req *GetMessagesRequest
 	}
 	return &resp, nil
 }
+
+// SaveBatchRequest 批量保存消息/更新音频请求
+type SaveBatchRequest struct {
+	Items []*SpoolEntry `json:"items"`
+}
+
+// SaveBatchResult 单条结果，status 与单条接口的 HTTP 状态码一致
+type SaveBatchResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SaveBatchResponse 批量保存响应；manager 遇到 5xx 会停止执行，结果数可能少于请求条数
+type SaveBatchResponse struct {
+	Results []SaveBatchResult `json:"results"`
+}
+
+// SaveBatch 按顺序批量保存消息/更新音频
+func (c *HistoryClient) SaveBatch(ctx context.Context, items []*SpoolEntry) ([]SaveBatchResult, error) {
+	if !c.enabled {
+		results := make([]SaveBatchResult, len(items))
+		for i := range results {
+			results[i].Status = 200
+		}
+		return results, nil
+	}
+	var resp SaveBatchResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:   "POST",
+		Path:     "/api/internal/history/messages/batch",
+		Body:     &SaveBatchRequest{Items: items},
+		Response: &resp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
@@ -0,0 +1,463 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SpoolOpSave        = "save"
+	SpoolOpUpdateAudio = "update_audio"
+
+	spoolSegmentSuffix = ".seg"
+	spoolCursorFile    = "cursor"
+
+	defaultSpoolMaxBytes     = 512 << 20
+	defaultSpoolSegmentBytes = 16 << 20
+)
+
+// SpoolEntry 落盘队列中的一条待上传记录，同时也是批量上传接口的条目格式
+type SpoolEntry struct {
+	Op          string                     `json:"op"` // save / update_audio
+	SessionID   string                     `json:"session_id,omitempty"`
+	Save        *SaveMessageRequest        `json:"save,omitempty"`
+	UpdateAudio *UpdateMessageAudioRequest `json:"update_audio,omitempty"`
+	EnqueuedAt  time.Time                  `json:"enqueued_at"`
+}
+
+// hasAudio 是否携带音频数据
+func (e *SpoolEntry) hasAudio() bool {
+	if e.Save != nil && e.Save.AudioData != "" {
+		return true
+	}
+	return e.UpdateAudio != nil
+}
+
+// SpoolConfig 落盘队列配置
+type SpoolConfig struct {
+	Dir          string // 存储目录
+	MaxBytes     int64  // 积压上限，超过后丢弃音频，文本消息额外保留 10% 空间
+	SegmentBytes int64  // 单个分段文件大小
+	Sync         bool   // 每次追加后 fsync，可抵御断电但写入变慢
+}
+
+// SpoolStats 落盘队列统计
+type SpoolStats struct {
+	PendingEntries int64     `json:"pending_entries"` // 积压条数
+	PendingBytes   int64     `json:"pending_bytes"`   // 积压字节数
+	Segments       int       `json:"segments"`        // 分段文件数
+	OldestPending  time.Time `json:"oldest_pending,omitempty"`
+	Appended       int64     `json:"appended"`      // 累计写入条数
+	Uploaded       int64     `json:"uploaded"`      // 累计上传成功条数
+	Rejected       int64     `json:"rejected"`      // manager 明确拒绝（4xx）而丢弃的条数
+	Dropped        int64     `json:"dropped"`       // 超出积压上限丢弃的条数
+	AudioDropped   int64     `json:"audio_dropped"` // 超出积压上限仅丢弃音频的条数
+	Corrupted      int64     `json:"corrupted"`     // 无法解析而跳过的记录数
+	UploadFailures int64     `json:"upload_failures"`
+	LastError      string    `json:"last_error,omitempty"`
+	LastUploadAt   time.Time `json:"last_upload_at,omitempty"`
+}
+
+type spoolSegment struct {
+	id   uint64
+	path string
+	size int64
+}
+
+// spoolPosition 读取位置：分段ID + 段内偏移，entries/bytes 为从当前头部起累计读取的记录数与字节数
+type spoolPosition struct {
+	segment uint64
+	offset  int64
+	entries int64
+	bytes   int64
+}
+
+// spoolRecord Peek 读出的记录；Entry 为 nil 表示无法解析的记录，只需确认跳过
+type spoolRecord struct {
+	Entry *SpoolEntry
+	end   spoolPosition
+}
+
+// Spool 聊天记录本地落盘队列
+// 采用追加写的分段日志（每行一条 JSON），单个消费者按写入顺序读取、确认，天然保证同一会话内的顺序；
+// 已确认的位置记录在 cursor 文件中，整段确认后删除分段文件
+type Spool struct {
+	cfg SpoolConfig
+
+	mu         sync.Mutex
+	segments   []*spoolSegment // 按ID升序，第一个为读取头，最后一个为写入段
+	writer     *os.File
+	headOffset int64
+	pending    int64
+	pendingLen int64
+	oldest     time.Time
+	lastError  string
+	lastUpload time.Time
+	notify     chan struct{}
+
+	appended       atomic.Int64
+	uploaded       atomic.Int64
+	rejected       atomic.Int64
+	dropped        atomic.Int64
+	audioDropped   atomic.Int64
+	corrupted      atomic.Int64
+	uploadFailures atomic.Int64
+}
+
+// OpenSpool 打开（或创建）落盘队列，恢复上次未上传的积压并截断写了一半的尾部记录
+func OpenSpool(cfg SpoolConfig) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool dir is empty")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSpoolMaxBytes
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = defaultSpoolSegmentBytes
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建落盘目录失败: %w", err)
+	}
+
+	s := &Spool{cfg: cfg, notify: make(chan struct{}, 1)}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", id, spoolSegmentSuffix))
+}
+
+func (s *Spool) recover() error {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("读取落盘目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, &spoolSegment{id: id, path: filepath.Join(s.cfg.Dir, name), size: info.Size()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	// 丢弃 cursor 之前已确认的分段
+	cursorSeg, cursorOffset := s.readCursor()
+	for len(s.segments) > 0 && s.segments[0].id < cursorSeg {
+		os.Remove(s.segments[0].path)
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].id == cursorSeg && cursorOffset <= s.segments[0].size {
+		s.headOffset = cursorOffset
+	}
+
+	// 统计积压，并截断最后一段中写了一半的记录
+	for i, seg := range s.segments {
+		offset := int64(0)
+		if i == 0 {
+			offset = s.headOffset
+		}
+		entries, validEnd, err := scanSpoolSegment(seg.path, offset)
+		if err != nil {
+			return err
+		}
+		if validEnd < seg.size && i == len(s.segments)-1 {
+			if err := os.Truncate(seg.path, validEnd); err != nil {
+				return fmt.Errorf("截断落盘分段失败: %w", err)
+			}
+			seg.size = validEnd
+		}
+		s.pending += entries
+		s.pendingLen += seg.size - offset
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, &spoolSegment{id: cursorSeg + 1, path: s.segmentPath(cursorSeg + 1)})
+		s.headOffset = 0
+	}
+	return s.openWriter()
+}
+
+// scanSpoolSegment 统计分段中从 offset 起的完整记录数，返回最后一个完整行之后的偏移
+func scanSpoolSegment(path string, offset int64) (int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("打开落盘分段失败: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	reader := bufio.NewReader(f)
+	var entries int64
+	validEnd := offset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, validEnd, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		entries++
+		validEnd += int64(len(line))
+	}
+}
+
+func (s *Spool) openWriter() error {
+	tail := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(tail.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开落盘分段失败: %w", err)
+	}
+	s.writer = f
+	return nil
+}
+
+func (s *Spool) readCursor() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(s.cfg.Dir, spoolCursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var segment uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &segment, &offset); err != nil {
+		return 0, 0
+	}
+	return segment, offset
+}
+
+// writeCursor 先写临时文件再 rename，避免崩溃时 cursor 损坏
+func (s *Spool) writeCursor(segment uint64, offset int64) error {
+	path := filepath.Join(s.cfg.Dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", segment, offset)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Append 追加一条记录
+// 积压超过上限时先丢弃音频（保存消息只保留文本，音频回填直接丢弃），文本超过上限的 110% 后整条丢弃
+func (s *Spool) Append(entry *SpoolEntry) error {
+	if entry.EnqueuedAt.IsZero() {
+		entry.EnqueuedAt = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化落盘记录失败: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		return ErrSpoolClosed
+	}
+	if s.pendingLen+int64(len(line)) > s.cfg.MaxBytes && entry.hasAudio() {
+		if entry.Save == nil {
+			s.dropped.Add(1)
+			return ErrSpoolFull
+		}
+		save := *entry.Save
+		save.AudioData, save.AudioFormat, save.AudioSize, save.AudioDuration = "", "", 0, 0
+		stripped := *entry
+		stripped.Save = &save
+		if line, err = json.Marshal(&stripped); err != nil {
+			return fmt.Errorf("序列化落盘记录失败: %w", err)
+		}
+		s.audioDropped.Add(1)
+	}
+	if s.pendingLen+int64(len(line)) > s.cfg.MaxBytes+s.cfg.MaxBytes/10 {
+		s.dropped.Add(1)
+		return ErrSpoolFull
+	}
+	line = append(line, '\n')
+
+	tail := s.segments[len(s.segments)-1]
+	if tail.size > 0 && tail.size+int64(len(line)) > s.cfg.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		tail = s.segments[len(s.segments)-1]
+	}
+	if _, err := s.writer.Write(line); err != nil {
+		return fmt.Errorf("写入落盘记录失败: %w", err)
+	}
+	if s.cfg.Sync {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("落盘同步失败: %w", err)
+		}
+	}
+	tail.size += int64(len(line))
+	s.pending++
+	s.pendingLen += int64(len(line))
+	s.appended.Add(1)
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+var (
+	// ErrSpoolFull 积压超过上限
+	ErrSpoolFull = errors.New("history spool is full")
+	// ErrSpoolClosed 落盘队列已关闭
+	ErrSpoolClosed = errors.New("history spool is closed")
+)
+
+func (s *Spool) rotate() error {
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	id := s.segments[len(s.segments)-1].id + 1
+	s.segments = append(s.segments, &spoolSegment{id: id, path: s.segmentPath(id)})
+	return s.openWriter()
+}
+
+// peek 从头部按顺序读取最多 maxEntries 条、累计约 maxBytes 字节的记录（至少一条），不移动头部
+func (s *Spool) peek(maxEntries int, maxBytes int64) ([]spoolRecord, error) {
+	s.mu.Lock()
+	segments := make([]spoolSegment, len(s.segments))
+	for i, seg := range s.segments {
+		segments[i] = *seg
+	}
+	pos := spoolPosition{segment: segments[0].id, offset: s.headOffset}
+	s.mu.Unlock()
+
+	var records []spoolRecord
+	for i, seg := range segments {
+		if i > 0 {
+			pos.segment, pos.offset = seg.id, 0
+		}
+		if pos.offset >= seg.size {
+			continue
+		}
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return records, fmt.Errorf("打开落盘分段失败: %w", err)
+		}
+		reader := bufio.NewReader(io.NewSectionReader(f, pos.offset, seg.size-pos.offset))
+		for len(records) < maxEntries && (len(records) == 0 || pos.bytes < maxBytes) {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			pos.offset += int64(len(line))
+			pos.entries++
+			pos.bytes += int64(len(line))
+			record := spoolRecord{end: pos}
+			var entry SpoolEntry
+			if err := json.Unmarshal(line, &entry); err == nil {
+				record.Entry = &entry
+			}
+			records = append(records, record)
+		}
+		f.Close()
+		if len(records) >= maxEntries || (len(records) > 0 && pos.bytes >= maxBytes) {
+			break
+		}
+	}
+
+	if len(records) > 0 && records[0].Entry != nil {
+		s.mu.Lock()
+		s.oldest = records[0].Entry.EnqueuedAt
+		s.mu.Unlock()
+	}
+	return records, nil
+}
+
+// ack 确认到 pos 为止的记录已处理，删除整段确认的分段并持久化 cursor
+func (s *Spool) ack(pos spoolPosition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.segments) > 1 && s.segments[0].id < pos.segment {
+		os.Remove(s.segments[0].path)
+		s.segments = s.segments[1:]
+	}
+	// 头部分段已读完且不是写入段时直接删除
+	if len(s.segments) > 1 && s.segments[0].id == pos.segment && pos.offset >= s.segments[0].size {
+		os.Remove(s.segments[0].path)
+		s.segments = s.segments[1:]
+		pos.segment, pos.offset = s.segments[0].id, 0
+	}
+	s.headOffset = pos.offset
+	s.pending -= pos.entries
+	s.pendingLen -= pos.bytes
+	if s.pending <= 0 {
+		s.pending, s.pendingLen = 0, 0
+		s.oldest = time.Time{}
+	}
+	return s.writeCursor(pos.segment, pos.offset)
+}
+
+// Stats 返回落盘队列统计
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	stats := SpoolStats{
+		PendingEntries: s.pending,
+		PendingBytes:   s.pendingLen,
+		Segments:       len(s.segments),
+		OldestPending:  s.oldest,
+		LastError:      s.lastError,
+		LastUploadAt:   s.lastUpload,
+	}
+	s.mu.Unlock()
+	stats.Appended = s.appended.Load()
+	stats.Uploaded = s.uploaded.Load()
+	stats.Rejected = s.rejected.Load()
+	stats.Dropped = s.dropped.Load()
+	stats.AudioDropped = s.audioDropped.Load()
+	stats.Corrupted = s.corrupted.Load()
+	stats.UploadFailures = s.uploadFailures.Load()
+	return stats
+}
+
+// Close 关闭写入文件，未上传的记录保留在磁盘上，下次启动继续上传
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	s.writer = nil
+	return err
+}
+
+var defaultSpool atomic.Pointer[Spool]
+
+// SetDefaultSpool 设置全局落盘队列（用于统计查询）
+func SetDefaultSpool(s *Spool) {
+	defaultSpool.Store(s)
+}
+
+// DefaultSpool 返回全局落盘队列，未启用时为 nil
+func DefaultSpool() *Spool {
+	return defaultSpool.Load()
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func saveEntry(sessionID, messageID string) *SpoolEntry {
+	return &SpoolEntry{
+		Op:        SpoolOpSave,
+		SessionID: sessionID,
+		Save:      &SaveMessageRequest{MessageID: messageID, SessionID: sessionID, Role: MessageTypeUser, Content: "hi"},
+	}
+}
+
+func peekMessageIDs(t *testing.T, s *Spool, max int) []string {
+	t.Helper()
+	records, err := s.peek(max, 1<<20)
+	if err != nil {
+		t.Fatalf("peek: %v", err)
+	}
+	var ids []string
+	for _, record := range records {
+		if record.Entry == nil {
+			ids = append(ids, "<corrupt>")
+			continue
+		}
+		ids = append(ids, record.Entry.Save.MessageID)
+	}
+	return ids
+}
+
+func TestSpoolRecoverAndAck(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(SpoolConfig{Dir: dir, SegmentBytes: 300})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := s.Append(saveEntry("s1", fmt.Sprintf("m%d", i))); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if stats := s.Stats(); stats.PendingEntries != 5 || stats.Segments < 2 {
+		t.Fatalf("unexpected stats after append: %+v", stats)
+	}
+
+	records, _ := s.peek(2, 1<<20)
+	if err := s.ack(records[1].end); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	s.Close()
+
+	// 模拟写了一半的尾部记录
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	f, _ := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"op":"save","save":{"message_id":"half`)
+	f.Close()
+
+	s, err = OpenSpool(SpoolConfig{Dir: dir, SegmentBytes: 300})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if stats := s.Stats(); stats.PendingEntries != 3 {
+		t.Fatalf("pending after reopen = %d, want 3", stats.PendingEntries)
+	}
+	if err := s.Append(saveEntry("s1", "m6")); err != nil {
+		t.Fatalf("append after reopen: %v", err)
+	}
+	if got := strings.Join(peekMessageIDs(t, s, 10), ","); got != "m3,m4,m5,m6" {
+		t.Fatalf("pending ids = %s", got)
+	}
+}
+
+func TestSpoolDropsAudioWhenFull(t *testing.T) {
+	s, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 1000})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+
+	audio := strings.Repeat("A", 700)
+	entry := saveEntry("s1", "m1")
+	entry.Save.AudioData = audio
+	if err := s.Append(entry); err != nil {
+		t.Fatalf("first append should fit: %v", err)
+	}
+	entry = saveEntry("s1", "m2")
+	entry.Save.AudioData = audio
+	if err := s.Append(entry); err != nil {
+		t.Fatalf("text should be kept when audio is dropped: %v", err)
+	}
+	update := &SpoolEntry{Op: SpoolOpUpdateAudio, SessionID: "s1", UpdateAudio: &UpdateMessageAudioRequest{MessageID: "m1", AudioData: audio}}
+	if err := s.Append(update); err != ErrSpoolFull {
+		t.Fatalf("audio update should be dropped, got %v", err)
+	}
+
+	records, _ := s.peek(10, 1<<20)
+	if len(records) != 2 || records[1].Entry.Save.AudioData != "" || records[1].Entry.Save.Content != "hi" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if stats := s.Stats(); stats.AudioDropped != 1 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSpoolUploaderOrderAndRetry(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	failNext := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SaveBatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		var results []SaveBatchResult
+		for i, item := range req.Items {
+			// 第一次请求第 2 条返回 500，manager 会停止执行后续条目
+			if failNext && i == 1 {
+				failNext = false
+				results = append(results, SaveBatchResult{Status: http.StatusInternalServerError, Error: "db down"})
+				break
+			}
+			if item.Save.MessageID == "bad" {
+				results = append(results, SaveBatchResult{Status: http.StatusNotFound, Error: "设备不存在"})
+				continue
+			}
+			received = append(received, item.Save.MessageID)
+			results = append(results, SaveBatchResult{Status: http.StatusCreated})
+		}
+		json.NewEncoder(w).Encode(SaveBatchResponse{Results: results})
+	}))
+	defer server.Close()
+
+	s, err := OpenSpool(SpoolConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	for _, id := range []string{"m1", "m2", "bad", "m3"} {
+		s.Append(saveEntry("s1", id))
+	}
+
+	client := NewHistoryClient(HistoryClientConfig{BaseURL: server.URL, Timeout: time.Second, Enabled: true})
+	ctx := context.Background()
+	if progressed, err := s.uploadOnce(ctx, client, 10, time.Second); !progressed || err == nil {
+		t.Fatalf("first upload should be partial, progressed=%v err=%v", progressed, err)
+	}
+	if stats := s.Stats(); stats.PendingEntries != 3 {
+		t.Fatalf("pending after partial upload = %d, want 3", stats.PendingEntries)
+	}
+	if progressed, err := s.uploadOnce(ctx, client, 10, time.Second); !progressed || err != nil {
+		t.Fatalf("second upload should succeed, progressed=%v err=%v", progressed, err)
+	}
+
+	mu.Lock()
+	got := strings.Join(received, ",")
+	mu.Unlock()
+	if got != "m1,m2,m3" {
+		t.Fatalf("received = %s, want m1,m2,m3", got)
+	}
+	stats := s.Stats()
+	if stats.PendingEntries != 0 || stats.PendingBytes != 0 || stats.Uploaded != 3 || stats.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
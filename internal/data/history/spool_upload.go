@@ -0,0 +1,141 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	spoolBatchBytes      = 2 << 20
+	spoolMaxBatchEntries = 200 // 与 manager 批量接口上限一致
+	spoolRetryMin        = time.Second
+	spoolRetryMax        = time.Minute
+	spoolStatsInterval   = time.Minute
+)
+
+// RunUploader 按写入顺序把落盘记录批量上传到 manager，直到 ctx 结束
+// manager 不可用时指数退避重试，积压不会丢失；manager 明确拒绝（4xx）的记录记日志后跳过
+func (s *Spool) RunUploader(ctx context.Context, client *HistoryClient, batchSize int, timeout time.Duration) {
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+	if batchSize > spoolMaxBatchEntries {
+		batchSize = spoolMaxBatchEntries
+	}
+	backoff := spoolRetryMin
+	lastStats := time.Now()
+	for {
+		if time.Since(lastStats) >= spoolStatsInterval {
+			lastStats = time.Now()
+			if stats := s.Stats(); stats.PendingEntries > 0 {
+				log.Infof("聊天记录落盘积压: entries=%d bytes=%d oldest=%s uploaded=%d failures=%d dropped=%d",
+					stats.PendingEntries, stats.PendingBytes, stats.OldestPending.Format(time.RFC3339),
+					stats.Uploaded, stats.UploadFailures, stats.Dropped)
+			}
+		}
+
+		progressed, err := s.uploadOnce(ctx, client, batchSize, timeout)
+		if err != nil {
+			s.uploadFailures.Add(1)
+			s.mu.Lock()
+			s.lastError = err.Error()
+			s.mu.Unlock()
+			log.Warnf("聊天记录批量上传失败，%s 后重试: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if !progressed {
+				backoff *= 2
+				if backoff > spoolRetryMax {
+					backoff = spoolRetryMax
+				}
+			}
+			continue
+		}
+		backoff = spoolRetryMin
+		if progressed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		case <-time.After(spoolStatsInterval):
+		}
+	}
+}
+
+// uploadOnce 上传一批记录，返回是否有记录被确认
+func (s *Spool) uploadOnce(ctx context.Context, client *HistoryClient, batchSize int, timeout time.Duration) (bool, error) {
+	records, err := s.peek(batchSize, spoolBatchBytes)
+	if err != nil || len(records) == 0 {
+		return false, err
+	}
+
+	items := make([]*SpoolEntry, 0, len(records))
+	recordIndex := make([]int, 0, len(records))
+	for i, record := range records {
+		if record.Entry != nil {
+			items = append(items, record.Entry)
+			recordIndex = append(recordIndex, i)
+		}
+	}
+
+	// done 为已处理完成（成功或被拒绝）的记录数
+	done := len(records)
+	var uploadErr error
+	if len(items) > 0 {
+		reqCtx, cancel := context.WithTimeout(ctx, timeout)
+		results, err := client.SaveBatch(reqCtx, items)
+		cancel()
+		if err != nil {
+			return false, err
+		}
+
+		var uploaded int64
+		processed := 0
+		for ; processed < len(items) && processed < len(results); processed++ {
+			result := results[processed]
+			if result.Status >= 500 {
+				break
+			}
+			if result.Status >= 400 {
+				s.rejected.Add(1)
+				log.Warnf("聊天记录被 manager 拒绝，已丢弃, op=%s session_id=%s status=%d err=%s",
+					items[processed].Op, items[processed].SessionID, result.Status, result.Error)
+				continue
+			}
+			uploaded++
+		}
+		s.uploaded.Add(uploaded)
+		if processed < len(items) {
+			done = recordIndex[processed]
+			uploadErr = fmt.Errorf("manager 仅返回 %d/%d 条结果", len(results), len(items))
+			if processed < len(results) {
+				uploadErr = fmt.Errorf("第 %d/%d 条失败: HTTP %d %s", processed+1, len(items), results[processed].Status, results[processed].Error)
+			}
+		}
+	}
+
+	if done == 0 {
+		return false, uploadErr
+	}
+	for _, record := range records[:done] {
+		if record.Entry == nil {
+			s.corrupted.Add(1)
+		}
+	}
+	if err := s.ack(records[done-1].end); err != nil {
+		return true, fmt.Errorf("保存落盘进度失败: %w", err)
+	}
+	s.mu.Lock()
+	s.lastUpload = time.Now()
+	s.mu.Unlock()
+	return true, uploadErr
+}
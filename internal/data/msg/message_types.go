@@ -12,7 +12,9 @@ const (
 	MDeviceSubTopicPrefix     = "/p2p/device_sub/"
 	MDevicePubTopicPrefix     = "/p2p/device_public/"
 	MServerSubTopicPrefix     = "/p2p/device_public/#"
-	MServerPubTopicPrefix     = MDeviceSubTopicPrefix
+	// MServerShareSubTopic 主程序以共享订阅接收上行消息，多个主程序实例（包括集群中不同节点）每条消息只处理一次
+	MServerShareSubTopic  = "$share/xiaozhi/" + MServerSubTopicPrefix
+	MServerPubTopicPrefix = MDeviceSubTopicPrefix
 )
 
 // 消息类型常量
@@ -0,0 +1,195 @@
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/components/http"
+	"xiaozhi-esp32-server-golang/internal/util"
+
+	"github.com/spf13/viper"
+)
+
+// Reminder 设备定时提醒（存储于 Manager）
+type Reminder struct {
+	ID           uint      `json:"id"`
+	DeviceID     string    `json:"device_id"`
+	Message      string    `json:"message"`
+	SkipLlm      bool      `json:"skip_llm"`
+	ScheduleType string    `json:"schedule_type"` // once/cron
+	CronExpr     string    `json:"cron_expr"`
+	Timezone     string    `json:"timezone"`
+	NextRunAt    time.Time `json:"next_run_at"`
+	Status       string    `json:"status"`
+	Source       string    `json:"source"`
+}
+
+// CreateRequest 创建提醒请求，delay_seconds / run_at / cron_expr 三选一
+type CreateRequest struct {
+	DeviceID     string `json:"device_id"`
+	Message      string `json:"message"`
+	SkipLlm      *bool  `json:"skip_llm,omitempty"`
+	DelaySeconds int    `json:"delay_seconds,omitempty"`
+	RunAt        string `json:"run_at,omitempty"`
+	CronExpr     string `json:"cron_expr,omitempty"`
+	Timezone     string `json:"timezone,omitempty"`
+}
+
+// Client 提醒HTTP客户端
+type Client struct {
+	client *http.ManagerClient
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// NewClient 创建提醒客户端
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		client: http.NewManagerClient(http.ManagerClientConfig{
+			BaseURL:    strings.TrimRight(baseURL, "/"),
+			Timeout:    timeout,
+			MaxRetries: 1,
+		}),
+	}
+}
+
+// Enabled 提醒依赖 manager 持久化，仅在 manager 配置模式且 reminder.enable 未关闭时可用
+func Enabled() bool {
+	if viper.IsSet("reminder.enable") && !viper.GetBool("reminder.enable") {
+		return false
+	}
+	return viper.GetString("config_provider.type") == "manager" && util.GetBackendURL() != ""
+}
+
+// Default 获取默认提醒客户端，未启用时返回 nil
+func Default() *Client {
+	if !Enabled() {
+		return nil
+	}
+	defaultClientOnce.Do(func() {
+		defaultClient = NewClient(util.GetBackendURL(), 10*time.Second)
+	})
+	return defaultClient
+}
+
+type reminderResponse struct {
+	Data  Reminder `json:"data"`
+	Error string   `json:"error"`
+}
+
+type reminderListResponse struct {
+	Data  []Reminder `json:"data"`
+	Error string     `json:"error"`
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// Create 为设备创建提醒
+func (c *Client) Create(ctx context.Context, req *CreateRequest) (*Reminder, error) {
+	var resp reminderResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:   "POST",
+		Path:     "/api/internal/reminders",
+		Body:     req,
+		Response: &resp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建提醒失败: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &resp.Data, nil
+}
+
+// List 查询设备待执行（含暂停）的提醒
+func (c *Client) List(ctx context.Context, deviceID string) ([]Reminder, error) {
+	var resp reminderListResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:      "GET",
+		Path:        "/api/internal/reminders",
+		QueryParams: map[string]string{"device_id": deviceID},
+		Response:    &resp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询提醒失败: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// Cancel 取消设备的提醒
+func (c *Client) Cancel(ctx context.Context, deviceID string, reminderID uint) error {
+	var resp messageResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:   "POST",
+		Path:     fmt.Sprintf("/api/internal/reminders/%d/cancel", reminderID),
+		Body:     map[string]string{"device_id": deviceID},
+		Response: &resp,
+	})
+	if err != nil {
+		return fmt.Errorf("取消提醒失败: %w", err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	return nil
+}
+
+// Claim 为在线设备领取到期提醒（租约方式，多实例不会重复领取）
+func (c *Client) Claim(ctx context.Context, deviceIDs []string, owner string, limit int) ([]Reminder, error) {
+	var resp reminderListResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method: "POST",
+		Path:   "/api/internal/reminders/claim",
+		Body: map[string]interface{}{
+			"device_ids": deviceIDs,
+			"owner":      owner,
+			"limit":      limit,
+		},
+		Response: &resp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("领取提醒失败: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// Ack 回执提醒投递结果；delivered=false 时提醒稍后重新投递
+func (c *Client) Ack(ctx context.Context, reminderID uint, owner string, delivered bool, deliverErr error) error {
+	body := map[string]interface{}{
+		"owner":     owner,
+		"delivered": delivered,
+	}
+	if deliverErr != nil {
+		body["error"] = deliverErr.Error()
+	}
+	var resp messageResponse
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:   "POST",
+		Path:     fmt.Sprintf("/api/internal/reminders/%d/ack", reminderID),
+		Body:     body,
+		Response: &resp,
+	})
+	if err != nil {
+		return fmt.Errorf("回执提醒失败: %w", err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/components/http"
+	"xiaozhi-esp32-server-golang/internal/util"
+
+	"github.com/spf13/viper"
+)
+
+// 事件类型，与 manager 回调配置中可订阅的事件一致
+const (
+	EventDeviceOnline     = "device.online"
+	EventDeviceOffline    = "device.offline"
+	EventSessionStart     = "session.start"
+	EventSessionEnd       = "session.end"
+	EventMessageUser      = "message.user"
+	EventMessageAssistant = "message.assistant"
+	EventToolCall         = "tool.call"
+	EventOpenClawMode     = "openclaw.mode_changed"
+)
+
+// Event 上报到 manager 的回调事件，manager 匹配回调配置后原样签名投递
+type Event struct {
+	ID        string                 `json:"id"` // 同一 id 重复上报只投递一次
+	Type      string                 `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	DeviceID  string                 `json:"device_id"`
+	AgentID   string                 `json:"agent_id,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// internalTokenHeader manager 校验内部接口调用方的请求头，值为 webhook.internal_token
+const internalTokenHeader = "X-Internal-Token"
+
+// Client 回调事件上报客户端
+type Client struct {
+	client        *http.ManagerClient
+	internalToken string
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// NewClient 创建回调事件上报客户端，internalToken 需与 manager 的 webhook.internal_token 一致
+func NewClient(baseURL, internalToken string, timeout time.Duration) *Client {
+	return &Client{
+		client: http.NewManagerClient(http.ManagerClientConfig{
+			BaseURL:    strings.TrimRight(baseURL, "/"),
+			Timeout:    timeout,
+			MaxRetries: 2,
+		}),
+		internalToken: strings.TrimSpace(internalToken),
+	}
+}
+
+// Enabled 回调配置与投递由 manager 负责，仅在 manager 配置模式且 webhook.enable 未关闭时上报
+func Enabled() bool {
+	if viper.IsSet("webhook.enable") && !viper.GetBool("webhook.enable") {
+		return false
+	}
+	return viper.GetString("config_provider.type") == "manager" && util.GetBackendURL() != ""
+}
+
+// Default 获取默认上报客户端，未启用时返回 nil
+func Default() *Client {
+	if !Enabled() {
+		return nil
+	}
+	defaultClientOnce.Do(func() {
+		defaultClient = NewClient(util.GetBackendURL(), internalToken(), 5*time.Second)
+	})
+	return defaultClient
+}
+
+// internalToken 优先使用环境变量 WEBHOOK_INTERNAL_TOKEN（容器部署时与 manager 共用），其次读取 webhook.internal_token
+func internalToken() string {
+	if token := os.Getenv("WEBHOOK_INTERNAL_TOKEN"); token != "" {
+		return token
+	}
+	return viper.GetString("webhook.internal_token")
+}
+
+type reportResponse struct {
+	Error string `json:"error"`
+}
+
+// Report 上报一个事件
+func (c *Client) Report(ctx context.Context, event *Event) error {
+	var resp reportResponse
+	var headers map[string]string
+	if c.internalToken != "" {
+		headers = map[string]string{internalTokenHeader: c.internalToken}
+	}
+	err := c.client.DoRequest(ctx, http.RequestOptions{
+		Method:   "POST",
+		Path:     "/api/internal/webhooks/events",
+		Headers:  headers,
+		Body:     event,
+		Response: &resp,
+	})
+	if err != nil {
+		return fmt.Errorf("上报回调事件失败: %w", err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	return nil
+}
@@ -244,10 +244,11 @@ func (a *AliyunQwen3ASR) StreamingRecognize(ctx context.Context, audioStream <-c
 				log.Debugf("[aliyun_qwen3] transcription.text (partial): %q", text)
 				if text != "" {
 					sendResult(types.StreamingResult{
-						Text:    text,
-						IsFinal: false,
-						AsrType: constants.AsrTypeAliyunQwen3,
-						Mode:    "online",
+						Text:     text,
+						IsFinal:  false,
+						AsrType:  constants.AsrTypeAliyunQwen3,
+						Mode:     "online",
+						Language: GetTranscriptionLanguage(&event),
 					})
 				}
 
@@ -263,10 +264,11 @@ func (a *AliyunQwen3ASR) StreamingRecognize(ctx context.Context, audioStream <-c
 					}
 				}
 				sendResult(types.StreamingResult{
-					Text:    text,
-					IsFinal: true,
-					AsrType: constants.AsrTypeAliyunQwen3,
-					Mode:    "online",
+					Text:     text,
+					IsFinal:  true,
+					AsrType:  constants.AsrTypeAliyunQwen3,
+					Mode:     "online",
+					Language: GetTranscriptionLanguage(&event),
 				})
 
 			case "session.finished":
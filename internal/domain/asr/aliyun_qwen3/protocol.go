@@ -3,6 +3,7 @@ package aliyun_qwen3
 import (
 	"encoding/base64"
 	"encoding/json"
+	"strings"
 
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -67,13 +68,21 @@ type ErrorInfo struct {
 	Code    string `json:"code,omitempty"`
 }
 
+// transcriptionLanguage language=auto 时不指定语种，由服务端自动识别
+func transcriptionLanguage(language string) string {
+	if strings.EqualFold(strings.TrimSpace(language), "auto") {
+		return ""
+	}
+	return language
+}
+
 // NewSessionUpdateEvent 创建 session.update 事件
 func NewSessionUpdateEvent(config Config) *ClientEvent {
 	session := &Session{
 		Modalities:               []string{"text"},
 		InputAudioFormat:         config.Format,
 		SampleRate:               config.SampleRate,
-		InputAudioTranscription:  &InputAudioTranscription{Language: config.Language},
+		InputAudioTranscription:  &InputAudioTranscription{Language: transcriptionLanguage(config.Language)},
 	}
 
 	if config.AutoEnd {
@@ -149,3 +158,11 @@ func GetTranscriptionText(event *ServerEvent) string {
 	}
 	return ""
 }
+
+// GetTranscriptionLanguage 从事件中提取识别出的语种
+func GetTranscriptionLanguage(event *ServerEvent) string {
+	if event == nil || event.Item == nil || event.Item.Transcription == nil {
+		return ""
+	}
+	return event.Item.Transcription.Language
+}
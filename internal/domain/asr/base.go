@@ -6,6 +6,7 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/doubao"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/mock"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -27,7 +28,7 @@ type AsrProvider interface {
 }
 
 // NewAsrProvider 创建一个新的ASR实例
-// asrType: ASR引擎类型，目前支持 "funasr"
+// asrType: ASR引擎类型，如 "funasr"、"doubao"，端到端测试可使用 "mock"
 // config: ASR引擎配置，为 map[string]interface{} 类型
 func NewAsrProvider(asrType string, config map[string]interface{}) (AsrProvider, error) {
 	// 优先使用 config 中的 provider，否则使用参数中的 provider
@@ -57,7 +58,10 @@ func NewAsrProvider(asrType string, config map[string]interface{}) (AsrProvider,
 			log.Info("阿里云 Qwen3 ASR 适配器创建成功")
 		}
 		return provider, err
+	case constants.AsrTypeMock:
+		log.Info("使用 mock ASR 提供者")
+		return mock.NewMockASR(config)
 	default:
-		return nil, fmt.Errorf("不支持的ASR引擎类型: %s，目前仅支持 'funasr', 'aliyun_funasr', 'doubao', 'aliyun_qwen3'", asrType)
+		return nil, fmt.Errorf("不支持的ASR引擎类型: %s，目前仅支持 'funasr', 'aliyun_funasr', 'doubao', 'aliyun_qwen3', 'mock'", asrType)
 	}
 }
@@ -297,6 +297,9 @@ func (f *Funasr) recvResult(ctx context.Context, conn *websocket.Conn, resultCha
 			continue
 		}*/
 
+		// SenseVoice 模型会在文本中带上语种/情绪标签，剥离后作为语种识别结果
+		text, language := types.StripSenseVoiceTags(response.Text)
+
 		// 发送识别结果
 		select {
 		case <-ctx.Done():
@@ -304,8 +307,9 @@ func (f *Funasr) recvResult(ctx context.Context, conn *websocket.Conn, resultCha
 			log.Debugf("funasr recvResult 已取消: %v", ctx.Err())
 			return
 		case resultChan <- types.StreamingResult{
-			Text:    response.Text,
-			IsFinal: response.IsFinal,
+			Text:     text,
+			IsFinal:  response.IsFinal,
+			Language: language,
 		}:
 		}
 		/*if f.config.AutoEnd {
@@ -0,0 +1,140 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// MockASR 脚本化的语音识别，不访问任何外部服务，用于端到端测试和压测
+// 每次识别按顺序返回 transcripts 中的一条文本，用完后从头循环；音频内容只用于判断是否有输入
+// 配置参数：transcripts（字符串或字符串列表）、language、delay_ms（音频结束到返回结果的延迟）
+type MockASR struct {
+	transcripts []string
+	language    string
+	delay       time.Duration
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewMockASR 创建 MockASR
+func NewMockASR(config map[string]interface{}) (*MockASR, error) {
+	m := &MockASR{
+		transcripts: parseTranscripts(config["transcripts"]),
+		language:    strings.TrimSpace(stringValue(config["language"])),
+		delay:       time.Duration(intValue(config["delay_ms"])) * time.Millisecond,
+	}
+	if len(m.transcripts) == 0 {
+		m.transcripts = []string{"你好"}
+	}
+	return m, nil
+}
+
+func parseTranscripts(v interface{}) []string {
+	var transcripts []string
+	switch value := v.(type) {
+	case string:
+		if value != "" {
+			transcripts = append(transcripts, value)
+		}
+	case []string:
+		transcripts = append(transcripts, value...)
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				transcripts = append(transcripts, s)
+			}
+		}
+	}
+	return transcripts
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func intValue(v interface{}) int {
+	switch value := v.(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// nextTranscript 取下一条脚本文本
+func (m *MockASR) nextTranscript() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	text := m.transcripts[m.next%len(m.transcripts)]
+	m.next++
+	return text
+}
+
+// Process 有音频时返回下一条脚本文本，空音频返回空文本
+func (m *MockASR) Process(pcmData []float32) (string, error) {
+	if len(pcmData) == 0 {
+		return "", nil
+	}
+	return m.nextTranscript(), nil
+}
+
+// StreamingRecognize 读取音频直到 audioStream 关闭，然后返回一条最终结果
+// 没有收到任何音频时返回空文本，与真实引擎在静音输入下的行为一致
+func (m *MockASR) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 1)
+	go func() {
+		defer close(resultChan)
+		samples := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case pcm, ok := <-audioStream:
+				if ok {
+					samples += len(pcm)
+					continue
+				}
+				text := ""
+				if samples > 0 {
+					text = m.nextTranscript()
+				}
+				if m.delay > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(m.delay):
+					}
+				}
+				log.Debugf("mock asr 识别结果: %q, 音频采样数: %d", text, samples)
+				resultChan <- types.StreamingResult{
+					Text:     text,
+					IsFinal:  true,
+					AsrType:  "mock",
+					Language: m.language,
+				}
+				return
+			}
+		}
+	}()
+	return resultChan, nil
+}
+
+// Close 无需释放资源
+func (m *MockASR) Close() error {
+	return nil
+}
+
+// IsValid 检查资源是否有效
+func (m *MockASR) IsValid() bool {
+	return m != nil
+}
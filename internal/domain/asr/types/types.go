@@ -1,10 +1,37 @@
 package types
 
+import (
+	"regexp"
+	"strings"
+)
+
 // StreamingResult 流式识别结果
 type StreamingResult struct {
-	Text    string // 识别的文本
-	IsFinal bool   // 是否为最终结果
-	Error   error  // 错误信息
-	AsrType string // asr 类型
-	Mode    string // 模式
+	Text     string // 识别的文本
+	IsFinal  bool   // 是否为最终结果
+	Error    error  // 错误信息
+	AsrType  string // asr 类型
+	Mode     string // 模式
+	Language string // 识别出的语种（如 zh/en/ja），引擎不支持语种识别时为空
+}
+
+var senseVoiceTagPattern = regexp.MustCompile(`<\|([^|<>]*)\|>`)
+
+var senseVoiceLanguageTags = map[string]bool{
+	"zh": true, "en": true, "yue": true, "ja": true, "ko": true,
+}
+
+// StripSenseVoiceTags 去掉 SenseVoice 模型输出中的 <|zh|><|NEUTRAL|><|Speech|> 等标签，并返回其中的语种标签
+func StripSenseVoiceTags(text string) (string, string) {
+	if !strings.Contains(text, "<|") {
+		return text, ""
+	}
+	language := ""
+	for _, match := range senseVoiceTagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(match[1])
+		if language == "" && senseVoiceLanguageTags[tag] {
+			language = tag
+		}
+	}
+	return strings.TrimSpace(senseVoiceTagPattern.ReplaceAllString(text, "")), language
 }
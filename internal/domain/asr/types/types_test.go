@@ -0,0 +1,14 @@
+package types
+
+import "testing"
+
+func TestStripSenseVoiceTags(t *testing.T) {
+	text, language := StripSenseVoiceTags("<|en|><|NEUTRAL|><|Speech|><|woitn|>what time is it")
+	if text != "what time is it" || language != "en" {
+		t.Fatalf("unexpected result: text=%q language=%q", text, language)
+	}
+	text, language = StripSenseVoiceTags("今天天气怎么样")
+	if text != "今天天气怎么样" || language != "" {
+		t.Fatalf("plain text should be unchanged: text=%q language=%q", text, language)
+	}
+}
@@ -0,0 +1,456 @@
+// Package aec 服务端参考信号回声消除
+//
+// realtime 拾音模式下设备麦克风会拾取自身播放的 TTS 声音。服务端知道下发给设备的每一帧 TTS 音频（参考信号）
+// 及其计划播放时间，本包把参考信号与上行麦克风音频对齐，在 VAD/ASR 之前消除回声：
+//
+//  1. 延迟估计：麦克风与参考信号 10ms 能量包络做互相关，得到下行+播放缓冲+上行的整体延迟；
+//  2. 线性回声消除：NLMS 自适应滤波器，覆盖估计延迟前后余量与回声尾长；
+//  3. 双讲检测：近端（用户）说话时冻结滤波器更新，避免把用户语音当作回声学习；
+//  4. 残留回声抑制：播放期间没有近端语音的帧额外衰减；
+//  5. 播放感知的语音判定：播放期间只有参考信号无法解释的声音才视为近端语音（Result.NearEnd），
+//     供上层提高 VAD 门限，既能检测到真实打断，又不会被自身回声触发。
+package aec
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	silenceRMS       = 1e-3 // 约 -60dBFS，低于该值的参考信号视为静音
+	silenceEnergy    = silenceRMS * silenceRMS
+	convergeERLE     = 6.0 // dB，超过视为滤波器已收敛
+	divergeERLE      = 3.0 // dB，低于视为未收敛（迟滞）
+	erleSmoothing    = 0.1
+	trackerSmoothing = 0.1  // 增益跟踪输入能量的平滑系数（约 10 帧）
+	trackerRise      = 1.02 // 增益跟踪：比值高于当前值时每帧的上升倍数
+	fastSmoothing    = 0.5  // 逐帧判定的能量平滑系数
+	noiseFloorRise   = 1.05 // 噪声底最小值跟踪的每帧上升系数
+	maxDoubleTalkMs  = 2000 // 播放期间持续判定为双讲超过该时长，认为回声路径已变化，重新跟踪耦合增益
+	resyncMs         = 200  // 麦克风/参考时间轴与墙钟偏差超过该值时重新对齐
+)
+
+// Config 回声消除配置，零值字段使用默认值
+type Config struct {
+	SampleRate      int     // 麦克风采样率，默认 16000
+	TailMs          int     // 回声尾长（滤波器覆盖的房间混响长度），默认 64ms
+	MaxDelayMs      int     // 最大回声延迟（网络往返 + 设备播放缓冲），默认 500ms
+	StepSize        float64 // NLMS 步长 (0,1]，默认 0.5
+	SuppressDB      float64 // 播放期间非近端语音帧的额外衰减，默认 20dB
+	NearEndMarginDB float64 // 播放期间判定近端语音需高出回声估计的幅度，默认 6dB
+	CouplingDB      float64 // 初始声学耦合增益（回声能量相对参考信号），滤波器收敛前用于判定，默认 0dB
+}
+
+func (c Config) withDefaults() Config {
+	if c.SampleRate <= 0 {
+		c.SampleRate = 16000
+	}
+	if c.TailMs <= 0 {
+		c.TailMs = 64
+	}
+	if c.MaxDelayMs <= 0 {
+		c.MaxDelayMs = 500
+	}
+	if c.StepSize <= 0 || c.StepSize > 1 {
+		c.StepSize = 0.5
+	}
+	if c.SuppressDB <= 0 {
+		c.SuppressDB = 20
+	}
+	if c.NearEndMarginDB <= 0 {
+		c.NearEndMarginDB = 6
+	}
+	return c
+}
+
+// Result 单帧处理结果
+type Result struct {
+	Output         []float32 // 消除回声后的音频，长度与输入相同
+	PlaybackActive bool      // 该帧对应时段设备正在播放（参考信号非静音）
+	NearEnd        bool      // 判定含近端语音；未播放时恒为 true，由 VAD 自行判断
+	Converged      bool      // 线性滤波器已收敛
+	ERLE           float64   // 平滑后的回声损耗增强（dB）
+	DelayMs        int       // 当前回声延迟估计，-1 表示未知
+}
+
+// Canceller 单路（单声道）回声消除器，每个会话一个，可并发调用
+type Canceller struct {
+	mu  sync.Mutex
+	cfg Config
+
+	taps   int // 滤波器长度（采样）
+	margin int // 延迟估计前后余量（采样）
+
+	ref   *ring
+	mic   *ring
+	delay *delayEstimator
+
+	epoch       time.Time
+	nextRefPos  int64
+	refStarted  bool
+	nextMicPos  int64
+	micStarted  bool
+	lastEstPos  int64
+	estInterval int64
+
+	w    []float64
+	xbuf []float64
+	dbuf []float64
+	ebuf []float64
+
+	erle         float64
+	erleIn       float64 // 平滑后的滤波前、后能量，用于计算 ERLE
+	erleOut      float64
+	converged    bool
+	doubleTalk   int64       // 连续双讲采样数
+	coupling     gainTracker // 麦克风 / 参考 能量比，近似声学耦合增益
+	edFast       float64     // 快速平滑的麦克风、参考、残差能量，用于逐帧判定
+	exFast       float64
+	eeFast       float64
+	noiseFloor   float64
+	suppressGain float32
+	nearEndRatio float64
+}
+
+// New 创建回声消除器
+func New(cfg Config) *Canceller {
+	cfg = cfg.withDefaults()
+	sr := cfg.SampleRate
+	blockSize := sr * blockMs / 1000
+	margin := blockSize * 3 / 2
+	taps := sr*cfg.TailMs/1000 + 2*margin + 1
+	history := sr * (estimateWindowMs + cfg.MaxDelayMs + 1000) / 1000
+
+	c := &Canceller{
+		cfg:          cfg,
+		taps:         taps,
+		margin:       margin,
+		ref:          newRing(history + taps),
+		mic:          newRing(sr * (estimateWindowMs + 500) / 1000),
+		delay:        newDelayEstimator(sr, cfg.MaxDelayMs),
+		epoch:        time.Now(),
+		estInterval:  int64(sr * estimateIntervalMs / 1000),
+		w:            make([]float64, taps),
+		coupling:     newGainTracker(math.Pow(10, cfg.CouplingDB/10)),
+		noiseFloor:   silenceEnergy,
+		suppressGain: float32(math.Pow(10, -cfg.SuppressDB/20)),
+		nearEndRatio: math.Pow(10, cfg.NearEndMarginDB/10),
+	}
+	return c
+}
+
+// SampleRate 麦克风采样率
+func (c *Canceller) SampleRate() int {
+	return c.cfg.SampleRate
+}
+
+func (c *Canceller) timePos(t time.Time) int64 {
+	return int64(t.Sub(c.epoch).Seconds() * float64(c.cfg.SampleRate))
+}
+
+// PushReference 写入下发给设备的参考音频，playAt 为该段音频计划开始播放的时间
+func (c *Canceller) PushReference(pcm []float32, sampleRate int, playAt time.Time) {
+	pcm = resample(pcm, sampleRate, c.cfg.SampleRate)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos := c.timePos(playAt)
+	// 连续的 TTS 帧保持采样级连续，避免时间换算误差引入的缝隙
+	if c.refStarted && absInt64(pos-c.nextRefPos) <= int64(c.cfg.SampleRate*resyncMs/1000) {
+		pos = c.nextRefPos
+	}
+	c.pushReferenceLocked(pos, pcm)
+}
+
+// PushReferenceAt 按采样位置写入参考音频（采样率须与 Config.SampleRate 一致），用于离线评估
+func (c *Canceller) PushReferenceAt(pos int64, pcm []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pushReferenceLocked(pos, pcm)
+}
+
+func (c *Canceller) pushReferenceLocked(pos int64, pcm []float32) {
+	c.ref.write(pos, pcm)
+	c.nextRefPos = pos + int64(len(pcm))
+	c.refStarted = true
+}
+
+// Process 处理一帧麦克风音频，at 为该帧到达服务端的时间
+func (c *Canceller) Process(mic []float32, at time.Time) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos := c.timePos(at) - int64(len(mic))
+	// 上行按帧连续推进，只在抖动过大或断流后按墙钟重新对齐
+	if !c.micStarted || absInt64(pos-c.nextMicPos) > int64(c.cfg.SampleRate*resyncMs/1000) {
+		c.nextMicPos = pos
+		c.micStarted = true
+	}
+	return c.processLocked(c.nextMicPos, mic)
+}
+
+// ProcessAt 按采样位置处理一帧麦克风音频，用于离线评估
+func (c *Canceller) ProcessAt(pos int64, mic []float32) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.micStarted = true
+	return c.processLocked(pos, mic)
+}
+
+// Reset 清空滤波器与延迟估计（参考信号保留）
+func (c *Canceller) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resetFilterLocked()
+	c.delay.lag = -1
+}
+
+func (c *Canceller) resetFilterLocked() {
+	for i := range c.w {
+		c.w[i] = 0
+	}
+	c.erle, c.erleIn, c.erleOut = 0, 0, 0
+	c.converged = false
+	c.doubleTalk = 0
+}
+
+func (c *Canceller) delayMsLocked() int {
+	if c.delay.lag < 0 {
+		return -1
+	}
+	return c.delay.lag * blockMs
+}
+
+func (c *Canceller) processLocked(pos int64, mic []float32) Result {
+	n := len(mic)
+	c.nextMicPos = pos + int64(n)
+	c.mic.write(pos, mic)
+	// 滤波器收敛时延迟已可信，不再重新估计，避免双讲期间包络互相关被近端语音带偏；回声路径变化导致发散后自然恢复估计
+	if !c.converged && pos+int64(n)-c.lastEstPos >= c.estInterval {
+		c.lastEstPos = pos + int64(n)
+		if c.delay.estimate(c.mic, c.ref, pos+int64(n)) {
+			c.resetFilterLocked()
+		}
+	}
+
+	result := Result{Output: make([]float32, n), NearEnd: true, DelayMs: c.delayMsLocked()}
+	if n == 0 {
+		return result
+	}
+	c.dbuf = growFloat64(c.dbuf, n)
+	for i, v := range mic {
+		c.dbuf[i] = float64(v)
+	}
+	ed := energy(c.dbuf[:n])
+
+	if c.delay.lag < 0 {
+		// 延迟未知：无法做线性消除，只根据参考信号能量与耦合增益做播放感知判定
+		maxDelay := int64(c.delay.maxLag * c.delay.blockSize)
+		c.xbuf = growFloat64(c.xbuf, int(maxDelay)+n)
+		c.ref.read(pos-maxDelay, c.xbuf[:int(maxDelay)+n])
+		ex := energy(c.xbuf[:int(maxDelay)+n])
+		if ex < silenceEnergy {
+			return c.passThrough(mic, ed, result)
+		}
+		result.PlaybackActive = true
+		result.NearEnd = c.detectDoubleTalk(ed, ex, n)
+		copy(result.Output, mic)
+		c.finish(&result)
+		return result
+	}
+
+	// 对齐参考信号：第 i 个采样使用 xbuf[i : i+taps]，最新参考为 ref[pos+i-delay+margin]
+	delay := int64(c.delay.lag * c.delay.blockSize)
+	c.xbuf = growFloat64(c.xbuf, c.taps-1+n)
+	xbuf := c.xbuf[:c.taps-1+n]
+	c.ref.read(pos-delay+int64(c.margin)-int64(c.taps-1), xbuf)
+	ex := energy(xbuf)
+	if ex < silenceEnergy {
+		return c.passThrough(mic, ed, result)
+	}
+	result.PlaybackActive = true
+
+	doubleTalk := c.detectDoubleTalk(ed, ex, n)
+
+	c.ebuf = growFloat64(c.ebuf, n)
+	ebuf := c.ebuf[:n]
+	var ee float64
+	if doubleTalk {
+		// 双讲时冻结滤波器，只做消除
+		for i := 0; i < n; i++ {
+			ebuf[i] = c.dbuf[i] - dot(c.w, xbuf[i:i+c.taps])
+			ee += ebuf[i] * ebuf[i]
+		}
+		ee /= float64(n)
+	} else {
+		// 单讲时 NLMS 更新
+		ee = c.adapt(xbuf, ebuf)
+		if ed > 4*c.noiseFloor {
+			// 能量加权的 ERLE，避免回声尾部等低能量帧的比值波动
+			c.erleIn += erleSmoothing * (ed - c.erleIn)
+			c.erleOut += erleSmoothing * (ee - c.erleOut)
+			c.erle = 10 * math.Log10(c.erleIn/math.Max(c.erleOut, 1e-12))
+			if c.converged && c.erle < divergeERLE {
+				c.converged = false
+			} else if !c.converged && c.erle > convergeERLE {
+				c.converged = true
+			}
+		}
+	}
+
+	// 近端语音判定：滤波器收敛后回声大部分可被线性消除，残差仍接近麦克风能量说明存在参考信号无法解释的声音；
+	// 未收敛时退化为双讲检测结果
+	c.eeFast += fastSmoothing * (ee - c.eeFast)
+	result.NearEnd = doubleTalk
+	if c.converged {
+		result.NearEnd = c.eeFast*c.nearEndRatio > c.edFast && c.eeFast > c.nearEndRatio*c.noiseFloor
+	}
+	// 滤波器输出能量持续明显大于输入，说明已发散
+	if c.eeFast > 4*c.edFast && c.edFast > 4*c.noiseFloor {
+		c.resetFilterLocked()
+		copy(ebuf, c.dbuf[:n])
+	}
+
+	for i, e := range ebuf {
+		result.Output[i] = float32(e)
+	}
+	c.finish(&result)
+	return result
+}
+
+// adapt 逐采样 NLMS 更新，ebuf 写入后验残差，返回平均残差能量
+func (c *Canceller) adapt(xbuf, ebuf []float64) float64 {
+	power := dot(xbuf[:c.taps], xbuf[:c.taps])
+	eps := silenceEnergy * float64(c.taps)
+	mu := c.cfg.StepSize
+	var ee float64
+	for i := range ebuf {
+		if i > 0 {
+			out, in := xbuf[i-1], xbuf[i+c.taps-1]
+			power += in*in - out*out
+			if power < 0 {
+				power = 0
+			}
+		}
+		x := xbuf[i : i+c.taps]
+		e := c.dbuf[i] - dot(c.w, x)
+		ebuf[i] = e
+		ee += e * e
+		g := mu * e / (power + eps)
+		for k, xv := range x {
+			c.w[k] += g * xv
+		}
+	}
+	return ee / float64(len(ebuf))
+}
+
+// detectDoubleTalk 播放期间的双讲（近端说话）检测：麦克风能量明显高于按耦合增益推算的回声能量。
+// 只依赖能量比与耦合增益，不依赖滤波器状态，避免误判后滤波器停止更新而无法恢复
+func (c *Canceller) detectDoubleTalk(ed, ex float64, n int) bool {
+	c.edFast += fastSmoothing * (ed - c.edFast)
+	c.exFast += fastSmoothing * (ex - c.exFast)
+	doubleTalk := c.edFast > c.nearEndRatio*math.Max(c.coupling.value*c.exFast, c.noiseFloor)
+	if !doubleTalk {
+		c.doubleTalk = 0
+		c.coupling.update(ed, ex, c.noiseFloor)
+		return false
+	}
+	c.doubleTalk += int64(n)
+	if c.doubleTalk > int64(c.cfg.SampleRate*maxDoubleTalkMs/1000) {
+		// 播放期间长时间“双讲”多半是音量或回声路径变化，按当前能量比重新跟踪耦合增益
+		c.coupling.reset(c.edFast / c.exFast)
+		c.doubleTalk = 0
+	}
+	return true
+}
+
+// gainTracker 跟踪回声路径增益（能量比）的低位值：输入能量先做慢速平滑，比值低于当前值时立即跟随、
+// 高于时按固定速率缓慢上升。只有回声时比值较低，近端说话会抬高比值且双讲期间不更新，
+// 因此结果近似声学耦合增益
+type gainTracker struct {
+	num   float64
+	den   float64
+	value float64
+}
+
+func newGainTracker(value float64) gainTracker {
+	return gainTracker{value: value}
+}
+
+func (g *gainTracker) update(num, den, noiseFloor float64) {
+	if num < 4*noiseFloor || den < silenceEnergy {
+		return
+	}
+	if g.den == 0 {
+		g.num, g.den = num, den
+	} else {
+		g.num += trackerSmoothing * (num - g.num)
+		g.den += trackerSmoothing * (den - g.den)
+	}
+	ratio := g.num / g.den
+	if ratio < g.value {
+		g.value = ratio
+	} else {
+		g.value = math.Min(g.value*trackerRise, ratio)
+	}
+}
+
+func (g *gainTracker) reset(value float64) {
+	*g = newGainTracker(math.Max(value, 1e-12))
+}
+
+func (c *Canceller) passThrough(mic []float32, ed float64, result Result) Result {
+	copy(result.Output, mic)
+	c.noiseFloor *= noiseFloorRise
+	if ed < c.noiseFloor {
+		c.noiseFloor = math.Max(ed, silenceEnergy*1e-2)
+	}
+	c.finish(&result)
+	return result
+}
+
+// finish 播放期间非近端语音帧做残留回声抑制，并填充统计字段
+func (c *Canceller) finish(result *Result) {
+	if !result.NearEnd {
+		for i := range result.Output {
+			result.Output[i] *= c.suppressGain
+		}
+	}
+	result.Converged = c.converged
+	result.ERLE = c.erle
+}
+
+func energy(data []float64) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	return dot(data, data) / float64(len(data))
+}
+
+func dot(a, b []float64) float64 {
+	var s0, s1, s2, s3 float64
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+func growFloat64(buf []float64, n int) []float64 {
+	if cap(buf) < n {
+		return make([]float64, n)
+	}
+	return buf[:n]
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
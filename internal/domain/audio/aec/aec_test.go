@@ -0,0 +1,196 @@
+package aec
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSampleRate = 16000
+
+// synthSpeech 生成类语音信号：按音节开关的谐波 + 少量噪声，基频在音节间随机变化
+func synthSpeech(rng *rand.Rand, n int, f0 float64, amp float64) []float32 {
+	out := make([]float32, n)
+	pos := 0
+	for pos < n {
+		on := testSampleRate * (150 + rng.Intn(150)) / 1000
+		off := testSampleRate * (50 + rng.Intn(100)) / 1000
+		pitch := f0 * (0.8 + 0.4*rng.Float64())
+		weights := make([]float64, 8)
+		for h := range weights {
+			weights[h] = (0.5 + rng.Float64()) / float64(h+1)
+		}
+		for i := 0; i < on && pos+i < n; i++ {
+			env := math.Sin(math.Pi * float64(i) / float64(on))
+			t := float64(i) / testSampleRate
+			var v float64
+			for h, w := range weights {
+				v += w * math.Sin(2*math.Pi*pitch*float64(h+1)*t)
+			}
+			v += 0.1 * rng.NormFloat64()
+			out[pos+i] = float32(amp * env * v / 2)
+		}
+		pos += on + off
+	}
+	return out
+}
+
+// echoPath 模拟声学路径：指数衰减的随机房间冲激响应 + 整体延迟
+func echoPath(rng *rand.Rand, far []float32, delay int, gain float64) []float32 {
+	rir := make([]float64, testSampleRate*30/1000)
+	var norm float64
+	for k := range rir {
+		rir[k] = rng.NormFloat64() * math.Exp(-float64(k)/80)
+		norm += rir[k] * rir[k]
+	}
+	for k := range rir {
+		rir[k] *= gain / math.Sqrt(norm)
+	}
+	out := make([]float32, len(far))
+	for i := delay; i < len(out); i++ {
+		var v float64
+		for k, h := range rir {
+			j := i - delay - k
+			if j < 0 {
+				break
+			}
+			v += h * float64(far[j])
+		}
+		out[i] = float32(v)
+	}
+	return out
+}
+
+func frameEnergy(data []float32) float64 {
+	var sum float64
+	for _, v := range data {
+		sum += float64(v) * float64(v)
+	}
+	return sum / float64(len(data))
+}
+
+// TestCancellerSyntheticWav 合成“参考信号 + 经房间路径的回声 + 近端语音”的 WAV，离线验证延迟估计、回声消除与播放感知判定
+func TestCancellerSyntheticWav(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	total := testSampleRate * 10
+	const delayMs = 120
+
+	far := synthSpeech(rng, total, 140, 0.6)
+	for i := 0; i < testSampleRate/2; i++ {
+		far[i] = 0 // 开头 0.5s 没有播放
+	}
+	echo := echoPath(rng, far, testSampleRate*delayMs/1000, 0.5)
+	near := make([]float32, total)
+	nearStart, nearEnd := testSampleRate*6, testSampleRate*8
+	copy(near[nearStart:nearEnd], synthSpeech(rng, nearEnd-nearStart, 230, 0.6))
+	mic := make([]float32, total)
+	for i := range mic {
+		mic[i] = echo[i] + near[i] + float32(0.001*rng.NormFloat64())
+	}
+
+	// 写入并读回 WAV，与离线评估工具走同一条路径
+	dir := t.TempDir()
+	refPath, micPath := filepath.Join(dir, "ref.wav"), filepath.Join(dir, "mic.wav")
+	if err := WriteWavFile(refPath, far, testSampleRate); err != nil {
+		t.Fatalf("write ref: %v", err)
+	}
+	if err := WriteWavFile(micPath, mic, testSampleRate); err != nil {
+		t.Fatalf("write mic: %v", err)
+	}
+	ref, sr, err := ReadWavFile(refPath)
+	if err != nil || sr != testSampleRate {
+		t.Fatalf("read ref: %v, sr=%d", err, sr)
+	}
+	micWav, _, err := ReadWavFile(micPath)
+	if err != nil {
+		t.Fatalf("read mic: %v", err)
+	}
+
+	c := New(Config{SampleRate: testSampleRate})
+	const frame = testSampleRate * 20 / 1000
+	const lookahead = 6 // 参考信号比播放提前下发约 120ms
+	for k := 0; k < lookahead; k++ {
+		c.PushReferenceAt(int64(k*frame), ref[k*frame:(k+1)*frame])
+	}
+
+	var echoFrames, echoNearEnd, nearFrames, nearDetected int
+	var echoIn, echoOut float64
+	var last Result
+	for pos := 0; pos+frame <= total; pos += frame {
+		if next := pos + lookahead*frame; next+frame <= total {
+			c.PushReferenceAt(int64(next), ref[next:next+frame])
+		}
+		last = c.ProcessAt(int64(pos), micWav[pos:pos+frame])
+		if len(last.Output) != frame {
+			t.Fatalf("output length %d, want %d", len(last.Output), frame)
+		}
+
+		switch {
+		case pos >= testSampleRate*3 && pos+frame <= nearStart:
+			// 收敛后的单讲段：不应判定为近端语音
+			if frameEnergy(echo[pos:pos+frame]) > 1e-4 {
+				echoFrames++
+				if last.NearEnd {
+					echoNearEnd++
+				}
+				echoIn += frameEnergy(micWav[pos : pos+frame])
+				echoOut += frameEnergy(last.Output)
+			}
+		case pos >= nearStart && pos+frame <= nearEnd:
+			// 双讲段：近端语音明显的帧应判定为近端
+			if frameEnergy(near[pos:pos+frame]) > 4*frameEnergy(echo[pos:pos+frame]) && frameEnergy(near[pos:pos+frame]) > 1e-3 {
+				nearFrames++
+				if last.NearEnd {
+					nearDetected++
+				}
+			}
+		}
+	}
+
+	if last.DelayMs < delayMs-20 || last.DelayMs > delayMs+20 {
+		t.Fatalf("delay estimate %dms, want about %dms", last.DelayMs, delayMs)
+	}
+	if !last.Converged {
+		t.Fatalf("filter did not converge, erle=%.1fdB", last.ERLE)
+	}
+	if echoFrames == 0 || float64(echoNearEnd) > 0.05*float64(echoFrames) {
+		t.Fatalf("self echo detected as near-end in %d/%d frames", echoNearEnd, echoFrames)
+	}
+	if reduction := 10 * math.Log10(echoIn/echoOut); reduction < 20 {
+		t.Fatalf("echo reduced by %.1fdB, want >= 20dB", reduction)
+	}
+	if nearFrames == 0 || float64(nearDetected) < 0.7*float64(nearFrames) {
+		t.Fatalf("near-end detected in %d/%d double-talk frames", nearDetected, nearFrames)
+	}
+}
+
+func TestCancellerWithoutPlayback(t *testing.T) {
+	c := New(Config{})
+	rng := rand.New(rand.NewSource(2))
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		mic := synthSpeech(rng, 320, 200, 0.5)
+		res := c.Process(mic, start.Add(time.Duration(i+1)*20*time.Millisecond))
+		if res.PlaybackActive || !res.NearEnd || res.DelayMs != -1 {
+			t.Fatalf("frame %d: unexpected result %+v", i, res)
+		}
+		for j := range mic {
+			if res.Output[j] != mic[j] {
+				t.Fatalf("frame %d: output should pass through unchanged", i)
+			}
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	in := make([]float32, 480) // 24kHz 20ms
+	for i := range in {
+		in[i] = float32(i)
+	}
+	out := resample(in, 24000, 16000)
+	if len(out) != 320 || out[3] != 4.5 {
+		t.Fatalf("unexpected resample output: len=%d out[3]=%v", len(out), out[3])
+	}
+}
@@ -0,0 +1,131 @@
+package aec
+
+import "math"
+
+const (
+	blockMs            = 10   // 延迟估计的能量包络块长
+	estimateWindowMs   = 1500 // 参与互相关的历史长度
+	estimateIntervalMs = 250  // 估计周期
+	minCorrelation     = 0.5  // 互相关低于该值时不采信
+	fastAcceptCorr     = 0.7  // 尚无估计时，互相关高于该值直接采用
+)
+
+// delayEstimator 通过麦克风与参考信号能量包络的互相关估计回声延迟（块精度，10ms）
+// 延迟包含下行网络、设备播放缓冲、声学路径与上行网络，细粒度偏差由 NLMS 滤波器的前后余量吸收
+type delayEstimator struct {
+	blockSize int
+	window    int // 块数
+	maxLag    int // 块数
+
+	lag           int // 当前采用的延迟（块），-1 表示未知
+	candidate     int
+	candidateHits int
+
+	micEnv []float64
+	refEnv []float64
+	buf    []float64
+}
+
+func newDelayEstimator(sampleRate, maxDelayMs int) *delayEstimator {
+	blockSize := sampleRate * blockMs / 1000
+	window := estimateWindowMs / blockMs
+	maxLag := maxDelayMs / blockMs
+	return &delayEstimator{
+		blockSize: blockSize,
+		window:    window,
+		maxLag:    maxLag,
+		lag:       -1,
+		candidate: -1,
+		micEnv:    make([]float64, window),
+		refEnv:    make([]float64, window+maxLag),
+		buf:       make([]float64, blockSize),
+	}
+}
+
+func (d *delayEstimator) envelope(r *ring, startBlock int64, dst []float64) {
+	for i := range dst {
+		r.read((startBlock+int64(i))*int64(d.blockSize), d.buf)
+		var sum float64
+		for _, v := range d.buf {
+			sum += v * v
+		}
+		dst[i] = math.Sqrt(sum / float64(len(d.buf)))
+	}
+}
+
+// estimate 以 endPos 之前的历史做一次估计，返回延迟是否发生变化
+func (d *delayEstimator) estimate(mic, ref *ring, endPos int64) bool {
+	endBlock := endPos / int64(d.blockSize)
+	micStart := endBlock - int64(d.window)
+	if micStart < 0 {
+		return false
+	}
+	d.envelope(mic, micStart, d.micEnv)
+	d.envelope(ref, micStart-int64(d.maxLag), d.refEnv)
+
+	// 参考信号需要有足够的起伏，静音或持续平稳信号无法定位
+	active := 0
+	for _, v := range d.refEnv[d.maxLag:] {
+		if v > silenceRMS {
+			active++
+		}
+	}
+	if active < d.window/5 {
+		return false
+	}
+
+	bestLag, bestCorr := -1, minCorrelation
+	for lag := 0; lag <= d.maxLag; lag++ {
+		corr := pearson(d.micEnv, d.refEnv[d.maxLag-lag:d.maxLag-lag+d.window])
+		if corr > bestCorr {
+			bestLag, bestCorr = lag, corr
+		}
+	}
+	if bestLag < 0 {
+		return false
+	}
+
+	if d.lag >= 0 && absInt(bestLag-d.lag) <= 1 {
+		d.candidate, d.candidateHits = -1, 0
+		return false
+	}
+	if d.candidate >= 0 && absInt(bestLag-d.candidate) <= 1 {
+		d.candidateHits++
+	} else {
+		d.candidate, d.candidateHits = bestLag, 1
+	}
+	if d.candidateHits >= 2 || (d.lag < 0 && bestCorr >= fastAcceptCorr) {
+		d.lag = bestLag
+		d.candidate, d.candidateHits = -1, 0
+		return true
+	}
+	return false
+}
+
+func pearson(a, b []float64) float64 {
+	n := float64(len(a))
+	var sa, sb float64
+	for i := range a {
+		sa += a[i]
+		sb += b[i]
+	}
+	ma, mb := sa/n, sb/n
+	var cov, va, vb float64
+	for i := range a {
+		da, db := a[i]-ma, b[i]-mb
+		cov += da * db
+		va += da * da
+		vb += db * db
+	}
+	if va == 0 || vb == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(va*vb)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,73 @@
+package aec
+
+// ring 按绝对采样位置存取的环形缓冲，保存 [end-len(buf), end) 区间的采样，区间外读取为 0
+type ring struct {
+	buf []float32
+	end int64
+}
+
+func newRing(size int) *ring {
+	return &ring{buf: make([]float32, size)}
+}
+
+func (r *ring) index(pos int64) int {
+	size := int64(len(r.buf))
+	return int(((pos % size) + size) % size)
+}
+
+// write 写入从 pos 开始的采样；写入位置超过 end 时，中间未写入的部分清零
+func (r *ring) write(pos int64, data []float32) {
+	size := int64(len(r.buf))
+	newEnd := pos + int64(len(data))
+	if newEnd > r.end {
+		from := r.end
+		if from < newEnd-size {
+			from = newEnd - size
+		}
+		for p := from; p < newEnd; p++ {
+			r.buf[r.index(p)] = 0
+		}
+		r.end = newEnd
+	}
+	for i, v := range data {
+		p := pos + int64(i)
+		if p < r.end-size {
+			continue
+		}
+		r.buf[r.index(p)] = v
+	}
+}
+
+// read 读取从 pos 开始的 len(dst) 个采样
+func (r *ring) read(pos int64, dst []float64) {
+	start := r.end - int64(len(r.buf))
+	for i := range dst {
+		p := pos + int64(i)
+		if p < start || p >= r.end {
+			dst[i] = 0
+			continue
+		}
+		dst[i] = float64(r.buf[r.index(p)])
+	}
+}
+
+// resample 线性插值重采样，参考信号与麦克风采样率不一致时使用（如 24kHz TTS、16kHz 麦克风）
+func resample(data []float32, from, to int) []float32 {
+	if from == to || from <= 0 || to <= 0 || len(data) == 0 {
+		return data
+	}
+	n := int(int64(len(data)) * int64(to) / int64(from))
+	out := make([]float32, n)
+	ratio := float64(from) / float64(to)
+	for i := range out {
+		src := float64(i) * ratio
+		j := int(src)
+		frac := float32(src - float64(j))
+		if j+1 < len(data) {
+			out[i] = data[j]*(1-frac) + data[j+1]*frac
+		} else {
+			out[i] = data[len(data)-1]
+		}
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package aec
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// ReadWavFile 读取单声道 PCM WAV 文件，返回 [-1,1] 范围的采样与采样率（离线评估使用）
+func ReadWavFile(path string) ([]float32, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	dec := wav.NewDecoder(f)
+	if !dec.IsValidFile() {
+		return nil, 0, fmt.Errorf("无效的 WAV 文件: %s", path)
+	}
+	buf, err := dec.FullPCMBuffer()
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取 WAV 数据失败: %w", err)
+	}
+	if buf.Format.NumChannels != 1 {
+		return nil, 0, fmt.Errorf("只支持单声道 WAV，实际 %d 声道: %s", buf.Format.NumChannels, path)
+	}
+	scale := float32(math.Pow(2, float64(buf.SourceBitDepth-1)))
+	pcm := make([]float32, len(buf.Data))
+	for i, v := range buf.Data {
+		pcm[i] = float32(v) / scale
+	}
+	return pcm, buf.Format.SampleRate, nil
+}
+
+// WriteWavFile 把 [-1,1] 范围的采样写成 16bit 单声道 WAV 文件
+func WriteWavFile(path string, pcm []float32, sampleRate int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := wav.NewEncoder(f, sampleRate, 16, 1, 1)
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: 1, SampleRate: sampleRate},
+		SourceBitDepth: 16,
+		Data:           make([]int, len(pcm)),
+	}
+	for i, v := range pcm {
+		if v > 1 {
+			v = 1
+		} else if v < -1 {
+			v = -1
+		}
+		buf.Data[i] = int(v * math.MaxInt16)
+	}
+	if err := enc.Write(buf); err != nil {
+		return fmt.Errorf("写入 WAV 数据失败: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,157 @@
+// Package g711 实现 ITU-T G.711 μ-law（PCMU）和 A-law（PCMA）编解码，用于电话网关的 RTP 音频
+package g711
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+var (
+	ulawDecodeTable [256]int16
+	alawDecodeTable [256]int16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		ulawDecodeTable[i] = decodeUlaw(byte(i))
+		alawDecodeTable[i] = decodeAlaw(byte(i))
+	}
+}
+
+// EncodeUlaw 把 16bit 线性 PCM 编码为 μ-law，dst 长度不足时重新分配
+func EncodeUlaw(dst []byte, pcm []int16) []byte {
+	dst = grow(dst, len(pcm))
+	for i, sample := range pcm {
+		dst[i] = LinearToUlaw(sample)
+	}
+	return dst
+}
+
+// DecodeUlaw 把 μ-law 解码为 16bit 线性 PCM，dst 长度不足时重新分配
+func DecodeUlaw(dst []int16, payload []byte) []int16 {
+	dst = growPCM(dst, len(payload))
+	for i, b := range payload {
+		dst[i] = ulawDecodeTable[b]
+	}
+	return dst
+}
+
+// EncodeAlaw 把 16bit 线性 PCM 编码为 A-law，dst 长度不足时重新分配
+func EncodeAlaw(dst []byte, pcm []int16) []byte {
+	dst = grow(dst, len(pcm))
+	for i, sample := range pcm {
+		dst[i] = LinearToAlaw(sample)
+	}
+	return dst
+}
+
+// DecodeAlaw 把 A-law 解码为 16bit 线性 PCM，dst 长度不足时重新分配
+func DecodeAlaw(dst []int16, payload []byte) []int16 {
+	dst = growPCM(dst, len(payload))
+	for i, b := range payload {
+		dst[i] = alawDecodeTable[b]
+	}
+	return dst
+}
+
+// LinearToUlaw 编码单个采样
+func LinearToUlaw(sample int16) byte {
+	pcm := int32(sample)
+	var sign int32
+	if pcm < 0 {
+		sign = 0x80
+		pcm = -pcm
+	}
+	if pcm > ulawClip {
+		pcm = ulawClip
+	}
+	pcm += ulawBias
+
+	exponent := int32(7)
+	for mask := int32(0x4000); pcm&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (pcm >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// UlawToLinear 解码单个采样
+func UlawToLinear(b byte) int16 {
+	return ulawDecodeTable[b]
+}
+
+// LinearToAlaw 编码单个采样
+func LinearToAlaw(sample int16) byte {
+	pcm := int32(sample) >> 3
+	mask := int32(0xD5)
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	seg := int32(0)
+	for end := int32(0x1F); seg < 8 && pcm > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (pcm >> 1) & 0x0F
+	} else {
+		aval |= (pcm >> seg) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// AlawToLinear 解码单个采样
+func AlawToLinear(b byte) int16 {
+	return alawDecodeTable[b]
+}
+
+func decodeUlaw(b byte) int16 {
+	u := ^b
+	exponent := int32(u>>4) & 0x07
+	mantissa := int32(u) & 0x0F
+	sample := ((mantissa << 3) + ulawBias) << exponent
+	sample -= ulawBias
+	if u&0x80 != 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
+
+func decodeAlaw(b byte) int16 {
+	a := int32(b ^ 0x55)
+	t := (a & 0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func grow(dst []byte, n int) []byte {
+	if cap(dst) < n {
+		return make([]byte, n)
+	}
+	return dst[:n]
+}
+
+func growPCM(dst []int16, n int) []int16 {
+	if cap(dst) < n {
+		return make([]int16, n)
+	}
+	return dst[:n]
+}
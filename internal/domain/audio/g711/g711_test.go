@@ -0,0 +1,69 @@
+package g711
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnownValues(t *testing.T) {
+	assert.Equal(t, byte(0xFF), LinearToUlaw(0))
+	assert.Equal(t, int16(0), UlawToLinear(0xFF))
+	assert.Equal(t, int16(-32124), UlawToLinear(0x00))
+	assert.Equal(t, int16(32124), UlawToLinear(0x80))
+	assert.Equal(t, byte(0x80), LinearToUlaw(math.MaxInt16))
+	assert.Equal(t, byte(0x00), LinearToUlaw(math.MinInt16))
+
+	assert.Equal(t, byte(0xD5), LinearToAlaw(0))
+	assert.Equal(t, int16(8), AlawToLinear(0xD5))
+	assert.Equal(t, int16(-8), AlawToLinear(0x55))
+	assert.Equal(t, int16(32256), AlawToLinear(0xAA))
+	assert.Equal(t, byte(0xAA), LinearToAlaw(math.MaxInt16))
+	assert.Equal(t, byte(0x2A), LinearToAlaw(math.MinInt16))
+}
+
+// 每个码字解码后再编码应得到原码字（μ-law 的负零 0x7F 编码为正零 0xFF）
+func TestCodeRoundTrip(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		code := byte(i)
+		if code != 0x7F {
+			assert.Equal(t, code, LinearToUlaw(UlawToLinear(code)), "ulaw 0x%02x", code)
+		}
+		assert.Equal(t, code, LinearToAlaw(AlawToLinear(code)), "alaw 0x%02x", code)
+	}
+}
+
+func TestSineSNR(t *testing.T) {
+	pcm := make([]int16, 8000)
+	for i := range pcm {
+		pcm[i] = int16(16000 * math.Sin(2*math.Pi*1000*float64(i)/8000))
+	}
+
+	ulaw := DecodeUlaw(nil, EncodeUlaw(nil, pcm))
+	alaw := DecodeAlaw(nil, EncodeAlaw(nil, pcm))
+	// G.711 的量化信噪比约为 38dB
+	assert.Greater(t, snr(pcm, ulaw), 30.0)
+	assert.Greater(t, snr(pcm, alaw), 30.0)
+}
+
+func TestBufferReuse(t *testing.T) {
+	buf := make([]byte, 0, 160)
+	out := EncodeUlaw(buf, make([]int16, 160))
+	assert.Len(t, out, 160)
+	assert.Equal(t, &buf[:1][0], &out[0], "容量足够时应复用传入的缓冲区")
+
+	pcm := DecodeAlaw(make([]int16, 10), make([]byte, 20))
+	assert.Len(t, pcm, 20)
+}
+
+func snr(ref, got []int16) float64 {
+	var signal, noise float64
+	for i := range ref {
+		s := float64(ref[i])
+		d := s - float64(got[i])
+		signal += s * s
+		noise += d * d
+	}
+	return 10 * math.Log10(signal/noise)
+}
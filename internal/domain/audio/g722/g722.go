@@ -0,0 +1,315 @@
+// Package g722 实现 ITU-T G.722 64kbit/s 宽带语音编解码（16kHz 采样，每个采样对编码为 1 字节）
+// 算法按 G.722 标准的定点参考实现移植，用于电话网关的 RTP 音频
+//
+// 注意 SDP 中 G.722 的 RTP 时钟频率按历史约定写为 8000，但实际采样率为 16kHz
+package g722
+
+// SampleRate G.722 的音频采样率
+const SampleRate = 16000
+
+var (
+	qmfCoeffs = [12]int32{3, -11, 12, 32, -210, 951, 3876, -805, 362, -156, 53, -11}
+
+	q6  = [32]int32{0, 35, 72, 110, 150, 190, 233, 276, 323, 370, 422, 473, 530, 587, 650, 714, 786, 858, 940, 1023, 1121, 1219, 1339, 1458, 1612, 1765, 1980, 2195, 2557, 2919, 0, 0}
+	iln = [32]int32{0, 63, 62, 31, 30, 29, 28, 27, 26, 25, 24, 23, 22, 21, 20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 0}
+	ilp = [32]int32{0, 61, 60, 59, 58, 57, 56, 55, 54, 53, 52, 51, 50, 49, 48, 47, 46, 45, 44, 43, 42, 41, 40, 39, 38, 37, 36, 35, 34, 33, 32, 0}
+	ihn = [3]int32{0, 1, 0}
+	ihp = [3]int32{0, 3, 2}
+
+	wl   = [8]int32{-60, -30, 58, 172, 334, 538, 1198, 3042}
+	rl42 = [16]int32{0, 7, 6, 5, 4, 3, 2, 1, 7, 6, 5, 4, 3, 2, 1, 0}
+	ilb  = [32]int32{2048, 2093, 2139, 2186, 2233, 2282, 2332, 2383, 2435, 2489, 2543, 2599, 2656, 2714, 2774, 2834, 2896, 2960, 3025, 3091, 3158, 3228, 3298, 3371, 3444, 3520, 3597, 3676, 3756, 3838, 3922, 4008}
+	wh   = [3]int32{0, -214, 798}
+	rh2  = [4]int32{2, 1, 2, 1}
+	qm2  = [4]int32{-7408, -1616, 7408, 1616}
+	qm4  = [16]int32{0, -20456, -12896, -8968, -6288, -4240, -2584, -1200, 20456, 12896, 8968, 6288, 4240, 2584, 1200, 0}
+	qm6  = [64]int32{
+		-136, -136, -136, -136, -24808, -21904, -19008, -16704, -14984, -13512, -12280, -11192, -10232, -9360, -8576, -7856,
+		-7192, -6576, -6000, -5456, -4944, -4464, -4008, -3576, -3168, -2776, -2400, -2032, -1688, -1360, -1040, -728,
+		24808, 21904, 19008, 16704, 14984, 13512, 12280, 11192, 10232, 9360, 8576, 7856, 7192, 6576, 6000, 5456,
+		4944, 4464, 4008, 3576, 3168, 2776, 2400, 2032, 1688, 1360, 1040, 728, 432, 136, -432, -136,
+	}
+)
+
+// band 一个子带（低频/高频）的自适应预测器状态
+type band struct {
+	s   int32
+	sp  int32
+	sz  int32
+	r   [3]int32
+	a   [3]int32
+	ap  [3]int32
+	p   [3]int32
+	d   [7]int32
+	b   [7]int32
+	bp  [7]int32
+	nb  int32
+	det int32
+}
+
+func saturate(v int32) int32 {
+	if v > 32767 {
+		return 32767
+	}
+	if v < -32768 {
+		return -32768
+	}
+	return v
+}
+
+func clamp(v, lo, hi int32) int32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// scale 由对数量化步长 nb 计算线性步长 det（SCALEL/SCALEH）
+func scale(nb int32, shift int32) int32 {
+	wd1 := (nb >> 6) & 31
+	wd2 := shift - (nb >> 11)
+	var wd3 int32
+	if wd2 < 0 {
+		wd3 = ilb[wd1] << -wd2
+	} else {
+		wd3 = ilb[wd1] >> wd2
+	}
+	return wd3 << 2
+}
+
+// update 用量化后的差值 dx 更新子带的零极点预测器（标准中的 block 4）
+func (s *band) update(dx int32) {
+	// RECONS
+	s.d[0] = dx
+	s.r[0] = saturate(s.s + dx)
+	// PARREC
+	s.p[0] = saturate(s.sz + dx)
+
+	// UPPOL2
+	var sg [7]int32
+	for i := 0; i < 3; i++ {
+		sg[i] = s.p[i] >> 15
+	}
+	wd1 := saturate(s.a[1] << 2)
+	wd2 := wd1
+	if sg[0] == sg[1] {
+		wd2 = -wd1
+	}
+	if wd2 > 32767 {
+		wd2 = 32767
+	}
+	wd3 := int32(-128)
+	if sg[0] == sg[2] {
+		wd3 = 128
+	}
+	wd3 += wd2 >> 7
+	wd3 += (s.a[2] * 32512) >> 15
+	s.ap[2] = clamp(wd3, -12288, 12288)
+
+	// UPPOL1
+	sg[0] = s.p[0] >> 15
+	sg[1] = s.p[1] >> 15
+	wd1 = -192
+	if sg[0] == sg[1] {
+		wd1 = 192
+	}
+	wd2 = (s.a[1] * 32640) >> 15
+	s.ap[1] = saturate(wd1 + wd2)
+	wd3 = saturate(15360 - s.ap[2])
+	s.ap[1] = clamp(s.ap[1], -wd3, wd3)
+
+	// UPZERO
+	wd1 = 128
+	if dx == 0 {
+		wd1 = 0
+	}
+	sg[0] = dx >> 15
+	for i := 1; i < 7; i++ {
+		sg[i] = s.d[i] >> 15
+		wd2 = -wd1
+		if sg[i] == sg[0] {
+			wd2 = wd1
+		}
+		wd3 = (s.b[i] * 32640) >> 15
+		s.bp[i] = saturate(wd2 + wd3)
+	}
+
+	// DELAYA
+	for i := 6; i > 0; i-- {
+		s.d[i] = s.d[i-1]
+		s.b[i] = s.bp[i]
+	}
+	for i := 2; i > 0; i-- {
+		s.r[i] = s.r[i-1]
+		s.p[i] = s.p[i-1]
+		s.a[i] = s.ap[i]
+	}
+
+	// FILTEP
+	wd1 = saturate(s.r[1] + s.r[1])
+	wd1 = (s.a[1] * wd1) >> 15
+	wd2 = saturate(s.r[2] + s.r[2])
+	wd2 = (s.a[2] * wd2) >> 15
+	s.sp = saturate(wd1 + wd2)
+
+	// FILTEZ
+	s.sz = 0
+	for i := 6; i > 0; i-- {
+		wd1 = saturate(s.d[i] + s.d[i])
+		s.sz += (s.b[i] * wd1) >> 15
+	}
+	s.sz = saturate(s.sz)
+
+	// PREDIC
+	s.s = saturate(s.sp + s.sz)
+}
+
+// Encoder G.722 编码器，有状态，每路音频流使用独立实例
+type Encoder struct {
+	band [2]band
+	x    [24]int32
+}
+
+// NewEncoder 创建编码器
+func NewEncoder() *Encoder {
+	e := &Encoder{}
+	e.band[0].det = 32
+	e.band[1].det = 8
+	return e
+}
+
+// Encode 把 16kHz PCM 编码为 G.722，每两个采样输出 1 字节，奇数个采样时最后一个采样被忽略
+func (e *Encoder) Encode(dst []byte, pcm []int16) []byte {
+	n := len(pcm) / 2
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	for j := 0; j < n; j++ {
+		dst[j] = e.encodePair(int32(pcm[2*j]), int32(pcm[2*j+1]))
+	}
+	return dst
+}
+
+func (e *Encoder) encodePair(s0, s1 int32) byte {
+	// 发送端 QMF：拆分为低频和高频两个 8kHz 子带
+	copy(e.x[:22], e.x[2:])
+	e.x[22] = s0
+	e.x[23] = s1
+	var sumEven, sumOdd int32
+	for i := 0; i < 12; i++ {
+		sumOdd += e.x[2*i] * qmfCoeffs[i]
+		sumEven += e.x[2*i+1] * qmfCoeffs[11-i]
+	}
+	xlow := (sumEven + sumOdd) >> 14
+	xhigh := (sumEven - sumOdd) >> 14
+
+	// 低频子带：6bit 自适应量化
+	low := &e.band[0]
+	el := saturate(xlow - low.s)
+	wd := el
+	if el < 0 {
+		wd = -(el + 1)
+	}
+	i := 1
+	for ; i < 30; i++ {
+		if wd < (q6[i]*low.det)>>12 {
+			break
+		}
+	}
+	ilow := ilp[i]
+	if el < 0 {
+		ilow = iln[i]
+	}
+	ril := ilow >> 2
+	dlow := (low.det * qm4[ril]) >> 15
+	low.nb = clamp(((low.nb*127)>>7)+wl[rl42[ril]], 0, 18432)
+	low.det = scale(low.nb, 8)
+	low.update(dlow)
+
+	// 高频子带：2bit 自适应量化
+	high := &e.band[1]
+	eh := saturate(xhigh - high.s)
+	wd = eh
+	if eh < 0 {
+		wd = -(eh + 1)
+	}
+	mih := 1
+	if wd >= (564*high.det)>>12 {
+		mih = 2
+	}
+	ihigh := ihp[mih]
+	if eh < 0 {
+		ihigh = ihn[mih]
+	}
+	dhigh := (high.det * qm2[ihigh]) >> 15
+	high.nb = clamp(((high.nb*127)>>7)+wh[rh2[ihigh]], 0, 22528)
+	high.det = scale(high.nb, 10)
+	high.update(dhigh)
+
+	return byte(ihigh<<6 | ilow)
+}
+
+// Decoder G.722 解码器，有状态，每路音频流使用独立实例
+type Decoder struct {
+	band [2]band
+	x    [24]int32
+}
+
+// NewDecoder 创建解码器
+func NewDecoder() *Decoder {
+	d := &Decoder{}
+	d.band[0].det = 32
+	d.band[1].det = 8
+	return d
+}
+
+// Decode 把 G.722 解码为 16kHz PCM，每字节输出 2 个采样
+func (d *Decoder) Decode(dst []int16, payload []byte) []int16 {
+	n := len(payload) * 2
+	if cap(dst) < n {
+		dst = make([]int16, n)
+	}
+	dst = dst[:n]
+	for j, code := range payload {
+		dst[2*j], dst[2*j+1] = d.decodeByte(int32(code))
+	}
+	return dst
+}
+
+func (d *Decoder) decodeByte(code int32) (int16, int16) {
+	ilow := code & 0x3F
+	ihigh := (code >> 6) & 0x03
+
+	// 低频子带
+	low := &d.band[0]
+	wd2 := (low.det * qm6[ilow]) >> 15
+	rlow := clamp(low.s+wd2, -16384, 16383)
+	ril := ilow >> 2
+	dlow := (low.det * qm4[ril]) >> 15
+	low.nb = clamp(((low.nb*127)>>7)+wl[rl42[ril]], 0, 18432)
+	low.det = scale(low.nb, 8)
+	low.update(dlow)
+
+	// 高频子带
+	high := &d.band[1]
+	dhigh := (high.det * qm2[ihigh]) >> 15
+	rhigh := clamp(dhigh+high.s, -16384, 16383)
+	high.nb = clamp(((high.nb*127)>>7)+wh[rh2[ihigh]], 0, 22528)
+	high.det = scale(high.nb, 10)
+	high.update(dhigh)
+
+	// 接收端 QMF：合成两个子带
+	copy(d.x[:22], d.x[2:])
+	d.x[22] = rlow + rhigh
+	d.x[23] = rlow - rhigh
+	var xout1, xout2 int32
+	for i := 0; i < 12; i++ {
+		xout2 += d.x[2*i] * qmfCoeffs[i]
+		xout1 += d.x[2*i+1] * qmfCoeffs[11-i]
+	}
+	return int16(saturate(xout1 >> 11)), int16(saturate(xout2 >> 11))
+}
@@ -0,0 +1,97 @@
+package g722
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sine(freq float64, n int, amplitude float64) []int16 {
+	pcm := make([]int16, n)
+	for i := range pcm {
+		pcm[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/SampleRate))
+	}
+	return pcm
+}
+
+// bestSNR 在给定延迟范围内寻找最佳对齐后的信噪比，QMF 滤波器组会引入固定延迟
+func bestSNR(ref, got []int16, maxLag int) (float64, int) {
+	best, bestLag := math.Inf(-1), 0
+	// 跳过开头的自适应收敛阶段
+	start := len(ref) / 4
+	for lag := 0; lag <= maxLag; lag++ {
+		var signal, noise float64
+		for i := start; i+lag < len(got) && i < len(ref); i++ {
+			s := float64(ref[i])
+			d := s - float64(got[i+lag])
+			signal += s * s
+			noise += d * d
+		}
+		if snr := 10 * math.Log10(signal/noise); snr > best {
+			best, bestLag = snr, lag
+		}
+	}
+	return best, bestLag
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, freq := range []float64{300, 1000, 3000, 6000} {
+		pcm := sine(freq, SampleRate, 10000)
+		encoded := NewEncoder().Encode(nil, pcm)
+		require.Len(t, encoded, len(pcm)/2)
+
+		decoded := NewDecoder().Decode(nil, encoded)
+		require.Len(t, decoded, len(pcm))
+
+		snr, _ := bestSNR(pcm, decoded, 64)
+		t.Logf("%.0fHz SNR %.1fdB", freq, snr)
+		assert.Greater(t, snr, 20.0, "频率 %.0fHz 编解码后信噪比过低", freq)
+	}
+}
+
+// 用扫频信号确定收发两端 QMF 滤波器组引入的总延迟（正弦信号是周期的，无法唯一确定延迟）
+func TestDelay(t *testing.T) {
+	pcm := make([]int16, SampleRate)
+	for i := range pcm {
+		x := float64(i) / SampleRate
+		pcm[i] = int16(8000 * math.Sin(2*math.Pi*(200*x+1500*x*x)))
+	}
+	decoded := NewDecoder().Decode(nil, NewEncoder().Encode(nil, pcm))
+	snr, lag := bestSNR(pcm, decoded, 64)
+	t.Logf("chirp SNR %.1fdB lag %d", snr, lag)
+	assert.Greater(t, snr, 30.0)
+	assert.Equal(t, 22, lag)
+}
+
+func TestSilence(t *testing.T) {
+	decoded := NewDecoder().Decode(nil, NewEncoder().Encode(nil, make([]int16, 3200)))
+	for _, v := range decoded[400:] {
+		assert.LessOrEqual(t, math.Abs(float64(v)), 8.0)
+	}
+}
+
+// 分块编码与整段编码结果一致，编解码器跨 RTP 包保持状态
+func TestStreaming(t *testing.T) {
+	pcm := sine(1000, 3200, 8000)
+	whole := NewEncoder().Encode(nil, pcm)
+
+	enc := NewEncoder()
+	var chunked []byte
+	for i := 0; i < len(pcm); i += 320 {
+		chunked = append(chunked, enc.Encode(nil, pcm[i:i+320])...)
+	}
+	assert.Equal(t, whole, chunked)
+
+	dec := NewDecoder()
+	var decoded []int16
+	for i := 0; i < len(whole); i += 160 {
+		decoded = append(decoded, dec.Decode(nil, whole[i:i+160])...)
+	}
+	assert.Equal(t, NewDecoder().Decode(nil, whole), decoded)
+}
+
+func TestOddSamplesIgnored(t *testing.T) {
+	assert.Len(t, NewEncoder().Encode(nil, make([]int16, 5)), 2)
+}
@@ -94,12 +94,22 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 				Voice              *string  `json:"voice"`
 				VoiceModelOverride *string  `json:"voice_model_override"`
 			} `json:"voice_identify"`
-			KnowledgeBases  []types.KnowledgeBaseRef `json:"knowledge_bases"`
-			Prompt          string                   `json:"prompt"`
-			AgentId         string                   `json:"agent_id"`
-			MemoryMode      string                   `json:"memory_mode"`
-			MCPServiceNames string                   `json:"mcp_service_names"`
-			OpenClaw        struct {
+			KnowledgeBases    []types.KnowledgeBaseRef `json:"knowledge_bases"`
+			Prompt            string                   `json:"prompt"`
+			AgentId           string                   `json:"agent_id"`
+			MemoryMode        string                   `json:"memory_mode"`
+			MCPServiceNames   string                   `json:"mcp_service_names"`
+			Language          string                   `json:"language"`
+			LanguageVoices    map[string]string        `json:"language_voices"`
+			PronunciationDict map[string]string        `json:"pronunciation_dict"`
+			AsrSpeed          string                   `json:"asr_speed"`
+			ToolPolicies      map[string]string        `json:"tool_policies"`
+			MCPResources      []types.MCPResourceRef   `json:"mcp_resources"`
+			TtsFallbacks      []struct {
+				Provider string `json:"provider"`
+				JsonData string `json:"json_data"`
+			} `json:"tts_fallbacks"`
+			OpenClaw struct {
 				Allowed       bool     `json:"allowed"`
 				EnterKeywords []string `json:"enter_keywords"`
 				ExitKeywords  []string `json:"exit_keywords"`
@@ -153,6 +163,17 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 		}
 	}
 
+	ttsFallbacks := make([]types.TtsConfig, 0, len(response.Data.TtsFallbacks))
+	for _, fallback := range response.Data.TtsFallbacks {
+		if fallback.Provider == "" {
+			continue
+		}
+		ttsFallbacks = append(ttsFallbacks, types.TtsConfig{
+			Provider: fallback.Provider,
+			Config:   parseJsonData(fallback.JsonData),
+		})
+	}
+
 	// 构建配置结果
 	enterKeywords := response.Data.OpenClaw.EnterKeywords
 	if len(enterKeywords) == 0 {
@@ -185,11 +206,18 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 			Provider: response.Data.Memory.Provider,
 			Config:   parseJsonData(response.Data.Memory.JsonData),
 		},
-		KnowledgeBases:  response.Data.KnowledgeBases,
-		VoiceIdentify:   voiceIdentifyData,
-		MemoryMode:      response.Data.MemoryMode,
-		AgentId:         response.Data.AgentId,
-		MCPServiceNames: strings.TrimSpace(response.Data.MCPServiceNames),
+		KnowledgeBases:    response.Data.KnowledgeBases,
+		VoiceIdentify:     voiceIdentifyData,
+		MemoryMode:        response.Data.MemoryMode,
+		AgentId:           response.Data.AgentId,
+		MCPServiceNames:   strings.TrimSpace(response.Data.MCPServiceNames),
+		Language:          strings.TrimSpace(response.Data.Language),
+		LanguageVoices:    response.Data.LanguageVoices,
+		PronunciationDict: response.Data.PronunciationDict,
+		TtsFallbacks:      ttsFallbacks,
+		AsrSpeed:          strings.TrimSpace(response.Data.AsrSpeed),
+		ToolPolicies:      response.Data.ToolPolicies,
+		MCPResources:      response.Data.MCPResources,
 		OpenClaw: types.OpenClawConfig{
 			Allowed:       response.Data.OpenClaw.Allowed,
 			EnterKeywords: enterKeywords,
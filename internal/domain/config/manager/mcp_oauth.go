@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// fetchMCPOAuthToken 向 manager 获取智能体访问 MCP 服务器的令牌，manager 会在令牌即将过期时先刷新
+func fetchMCPOAuthToken(ctx context.Context, agentID, server string) (mcp.OAuthToken, error) {
+	resp, err := SendManagerRequest(ctx, "POST", "/api/mcp/oauth/token", map[string]interface{}{
+		"agent_id": agentID,
+		"server":   server,
+	})
+	if err != nil {
+		return mcp.OAuthToken{}, err
+	}
+	if resp.Status == 404 {
+		// 未授权
+		return mcp.OAuthToken{}, nil
+	}
+	if resp.Status != 200 {
+		return mcp.OAuthToken{}, fmt.Errorf("manager返回状态 %d: %s", resp.Status, resp.Error)
+	}
+	return parseMCPOAuthToken(resp.Body), nil
+}
+
+// parseMCPOAuthToken 解析 access_token 与 expires_at（Unix 秒，0 表示未声明）
+func parseMCPOAuthToken(body map[string]interface{}) mcp.OAuthToken {
+	token := mcp.OAuthToken{AccessToken: requestBodyString(body, "access_token")}
+	if expiresAt, ok := body["expires_at"].(float64); ok && expiresAt > 0 {
+		token.ExpiresAt = time.Unix(int64(expiresAt), 0)
+	}
+	return token
+}
+
+// handleMcpOAuthTokenPush 更新智能体的访问令牌，access_token 为空表示撤销授权
+func (c *WebSocketClient) handleMcpOAuthTokenPush(request *WebSocketRequest) {
+	agentID := requestBodyString(request.Body, "agent_id")
+	server := requestBodyString(request.Body, "server")
+	if agentID == "" || server == "" {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少agent_id或server参数")
+		return
+	}
+	token := parseMCPOAuthToken(request.Body)
+	// 撤销时需要断开连接，不阻塞读循环
+	go mcp.SetOAuthToken(agentID, server, token)
+	log.Infof("收到智能体 %s 的MCP服务器 %s 访问令牌更新，已授权: %v", agentID, server, token.AccessToken != "")
+	_ = c.SendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id": agentID,
+		"server":   server,
+	}, "")
+}
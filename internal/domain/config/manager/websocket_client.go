@@ -727,6 +727,20 @@ func (c *WebSocketClient) handleDefaultRequest(request *WebSocketRequest) {
 		// 处理MCP工具调用请求
 		c.handleMcpToolCallRequest(request)
 
+	case "/api/mcp/resources":
+		// MCP资源列表需要逐个查询服务器，不阻塞读循环
+		go c.handleMcpResourceListRequest(request)
+
+	case "/api/mcp/prompts":
+		go c.handleMcpPromptListRequest(request)
+
+	case "/api/mcp/prompt":
+		go c.handleMcpPromptGetRequest(request)
+
+	case "/api/mcp/oauth/token":
+		// manager 授权完成、刷新或撤销后推送的智能体访问令牌
+		c.handleMcpOAuthTokenPush(request)
+
 	case "/api/openclaw/status":
 		c.handleOpenClawStatusRequest(request)
 
@@ -1159,6 +1173,9 @@ func SendMcpToolListRequestWithCallback(ctx context.Context, agentID string, cal
 func Init(ctx context.Context) error {
 	log.Infof("Initializing Manager config provider with WebSocket client")
 
+	// OAuth 授权的 MCP 服务器按智能体向 manager 获取访问令牌
+	mcp.SetOAuthTokenFetcher(fetchMCPOAuthToken)
+
 	// 创建WebSocket客户端
 	client := GetDefaultClient()
 
@@ -1253,6 +1270,84 @@ func (c *WebSocketClient) handleMcpToolCallRequest(request *WebSocketRequest) {
 	}, "")
 }
 
+// mcpResourceRequestTimeout 资源/提示词查询的整体超时，需小于 manager 的广播等待时间
+const mcpResourceRequestTimeout = 10 * time.Second
+
+func requestBodyString(body map[string]interface{}, key string) string {
+	if body == nil {
+		return ""
+	}
+	v, _ := body[key].(string)
+	return strings.TrimSpace(v)
+}
+
+// handleMcpResourceListRequest 列出智能体可挂载的MCP资源（全局服务器与智能体接入点）
+func (c *WebSocketClient) handleMcpResourceListRequest(request *WebSocketRequest) {
+	agentID := requestBodyString(request.Body, "agent_id")
+	if agentID == "" {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少agent_id参数")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mcpResourceRequestTimeout)
+	defer cancel()
+	resources := mcp.ListResources(ctx, agentID, "")
+	_ = c.SendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id":  agentID,
+		"resources": resources,
+		"count":     len(resources),
+	}, "")
+}
+
+// handleMcpPromptListRequest 列出智能体可选用的MCP提示词模板
+func (c *WebSocketClient) handleMcpPromptListRequest(request *WebSocketRequest) {
+	agentID := requestBodyString(request.Body, "agent_id")
+	if agentID == "" {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少agent_id参数")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mcpResourceRequestTimeout)
+	defer cancel()
+	prompts := mcp.ListPrompts(ctx, agentID, "")
+	_ = c.SendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id": agentID,
+		"prompts":  prompts,
+		"count":    len(prompts),
+	}, "")
+}
+
+// handleMcpPromptGetRequest 渲染MCP提示词模板，返回文本供智能体作为角色设定使用
+func (c *WebSocketClient) handleMcpPromptGetRequest(request *WebSocketRequest) {
+	agentID := requestBodyString(request.Body, "agent_id")
+	source := requestBodyString(request.Body, "source")
+	server := requestBodyString(request.Body, "server")
+	name := requestBodyString(request.Body, "name")
+	if agentID == "" || source == "" || name == "" {
+		_ = c.SendResponse(request.ID, 400, nil, "缺少agent_id、source或name参数")
+		return
+	}
+	arguments := map[string]string{}
+	if args, ok := request.Body["arguments"].(map[string]interface{}); ok {
+		for k, v := range args {
+			arguments[k] = fmt.Sprint(v)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpResourceRequestTimeout)
+	defer cancel()
+	text, err := mcp.GetPromptText(ctx, agentID, "", source, server, name, arguments)
+	if err != nil {
+		_ = c.SendResponse(request.ID, 404, nil, err.Error())
+		return
+	}
+	_ = c.SendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id": agentID,
+		"source":   source,
+		"server":   server,
+		"name":     name,
+		"text":     text,
+	}, "")
+}
+
 func (c *WebSocketClient) handleOpenClawStatusRequest(request *WebSocketRequest) {
 	agentID := ""
 	if request.Body != nil {
@@ -13,4 +13,5 @@ const (
 // 下行pull事件 管理内控 => 主程序
 const (
 	EventHandleMessageInject = "/api/device/inject_msg" //处理消息注入
+	EventHandleMqttClients   = "/api/mqtt/clients"      //内置MQTT服务器客户端列表
 )
@@ -59,6 +59,14 @@ type OpenClawConfig struct {
 	ExitKeywords  []string `json:"exit_keywords"`
 }
 
+// MCPResourceRef 挂载到智能体的 MCP 资源，对话时读取正文作为上下文
+type MCPResourceRef struct {
+	Source string `json:"source"` // global/agent/device
+	Server string `json:"server"` // 服务器名，空=在该来源的所有服务器中查找
+	URI    string `json:"uri"`
+	Name   string `json:"name"`
+}
+
 type UConfig struct {
 	SystemPrompt    string                      `json:"system_prompt"`
 	Asr             AsrConfig                   `json:"asr"`
@@ -72,6 +80,18 @@ type UConfig struct {
 	MCPServiceNames string                      `json:"mcp_service_names"` // 逗号分隔的MCP服务名，空=使用全部已启用全局MCP服务
 	OpenClaw        OpenClawConfig              `json:"openclaw"`          // OpenClaw 配置
 	KnowledgeBases  []KnowledgeBaseRef          `json:"knowledge_bases"`
+	Language        string                      `json:"language"`        // 对话语言: zh/yue/en/ja/ko/auto，空=zh
+	LanguageVoices  map[string]string           `json:"language_voices"` // 各语言对应的TTS音色，key 为语言代码
+	// 发音词典：原词 -> 读法，合成前替换
+	PronunciationDict map[string]string `json:"pronunciation_dict"`
+	// 备用TTS，按顺序在主TTS失败时接替合成
+	TtsFallbacks []TtsConfig `json:"tts_fallbacks"`
+	// 断句速度档位: normal/patient/fast，空=normal
+	AsrSpeed string `json:"asr_speed"`
+	// 工具调用策略：工具名或通配模式 -> allow/confirm/deny，未配置的工具为 allow
+	ToolPolicies map[string]string `json:"tool_policies"`
+	// 挂载的 MCP 资源，作为系统提示词的参考资料
+	MCPResources []MCPResourceRef `json:"mcp_resources"`
 }
 
 type TtsConfigItem struct {
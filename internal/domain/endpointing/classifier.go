@@ -0,0 +1,100 @@
+package endpointing
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Classifier 评估部分识别文本的语义完整度，返回 [0,1]：越接近 1 越像一句话已经说完，0.5 表示无法判断
+type Classifier interface {
+	Completeness(text string) float64
+}
+
+const (
+	scoreTerminal    = 0.95 // 句末标点
+	scoreParticle    = 0.8  // 句末语气词
+	scoreNeutral     = 0.5
+	scoreSeparator   = 0.15 // 逗号、顿号等句中停顿
+	scoreConjunction = 0.1  // 连接词、填充词，后面大概率还有内容
+)
+
+var (
+	terminalPunct  = "。！？!?…~～"
+	separatorPunct = "，,、：:；;—-"
+	// 句末语气词：出现在结尾时通常表示问句或陈述结束
+	zhParticles = []string{"吗", "呢", "吧", "啊", "呀", "啦", "哦", "嘛", "了"}
+	// 连接词与填充词：出现在结尾时说明用户还在组织语言
+	zhContinuations = []string{
+		"嗯", "呃", "额", "那个", "这个", "就是", "然后", "而且", "但是", "可是", "所以", "因为", "如果",
+		"还有", "或者", "还是", "以及", "和", "跟", "与", "把", "给", "比如", "另外",
+	}
+	enContinuations = map[string]bool{
+		"and": true, "but": true, "so": true, "or": true, "because": true, "if": true, "then": true,
+		"the": true, "a": true, "an": true, "to": true, "of": true, "for": true, "with": true, "in": true,
+		"on": true, "at": true, "my": true, "your": true, "is": true, "are": true, "like": true,
+		"um": true, "uh": true, "er": true, "erm": true, "hmm": true,
+	}
+)
+
+// RuleClassifier 基于句末标点、语气词与连接词的规则分类器，不依赖外部服务
+type RuleClassifier struct{}
+
+// Completeness 实现 Classifier
+func (RuleClassifier) Completeness(text string) float64 {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return scoreNeutral
+	}
+	runes := []rune(text)
+	last := runes[len(runes)-1]
+	switch {
+	case strings.ContainsRune(terminalPunct, last):
+		return scoreTerminal
+	case strings.ContainsRune(separatorPunct, last):
+		return scoreSeparator
+	case last == '.':
+		// 英文句点；数字中的小数点等在流式结果末尾很少出现
+		return scoreTerminal
+	}
+
+	if unicode.Is(unicode.Han, last) {
+		for _, word := range zhContinuations {
+			if strings.HasSuffix(text, word) {
+				return scoreConjunction
+			}
+		}
+		for _, word := range zhParticles {
+			if strings.HasSuffix(text, word) {
+				return scoreParticle
+			}
+		}
+		return scoreNeutral
+	}
+
+	fields := strings.Fields(text)
+	word := strings.ToLower(strings.TrimFunc(fields[len(fields)-1], func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}))
+	if enContinuations[word] {
+		return scoreConjunction
+	}
+	return scoreNeutral
+}
+
+// NoneClassifier 不做语义判断，断句只依赖静音时长与识别稳定性
+type NoneClassifier struct{}
+
+// Completeness 实现 Classifier
+func (NoneClassifier) Completeness(string) float64 {
+	return scoreNeutral
+}
+
+// GetClassifier 按名称获取分类器：rule（默认）/ none
+func GetClassifier(name string) Classifier {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "none":
+		return NoneClassifier{}
+	default:
+		return RuleClassifier{}
+	}
+}
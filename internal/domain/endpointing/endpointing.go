@@ -0,0 +1,162 @@
+// Package endpointing 自适应断句：综合 VAD 静音时长、ASR 部分结果的稳定性与文本语义完整度判断用户是否说完
+//
+// 固定静音阈值在用户句中停顿时会过早截断，对说话快的用户又等待过久。检测器为每句话动态计算静音阈值：
+// 部分识别文本看起来已经说完（句末标点、语气词）时阈值缩短到 MinSilenceMs，以连接词、逗号结尾时延长到 MaxSilenceMs，
+// 无法判断时使用 DefaultSilenceMs；ASR 部分结果仍在变化时视为识别未稳定，除非静音超过 MaxSilenceMs 否则不结束。
+package endpointing
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// 断句速度档位，对应智能体的 asr_speed 配置
+const (
+	SpeedNormal  = "normal"
+	SpeedPatient = "patient"
+	SpeedFast    = "fast"
+)
+
+// Profile 一个档位的断句参数（毫秒）
+type Profile struct {
+	MinSilenceMs     int64 `mapstructure:"min_silence_ms" json:"min_silence_ms"`         // 语义完整时的最短静音
+	DefaultSilenceMs int64 `mapstructure:"default_silence_ms" json:"default_silence_ms"` // 无法判断语义时的静音
+	MaxSilenceMs     int64 `mapstructure:"max_silence_ms" json:"max_silence_ms"`         // 语义明显未完时的最长静音，同时是兜底上限
+	StableMs         int64 `mapstructure:"stable_ms" json:"stable_ms"`                   // 部分识别结果保持不变多久视为稳定
+}
+
+// DefaultProfiles 内置档位，normal 的默认静音与原固定阈值（400ms）一致
+var DefaultProfiles = map[string]Profile{
+	SpeedNormal:  {MinSilenceMs: 250, DefaultSilenceMs: 400, MaxSilenceMs: 1200, StableMs: 200},
+	SpeedPatient: {MinSilenceMs: 400, DefaultSilenceMs: 700, MaxSilenceMs: 2000, StableMs: 300},
+	SpeedFast:    {MinSilenceMs: 200, DefaultSilenceMs: 300, MaxSilenceMs: 800, StableMs: 150},
+}
+
+// withDefaults 补齐未配置的字段并保证 Min <= Default <= Max
+func (p Profile) withDefaults(fallback Profile) Profile {
+	if p.MinSilenceMs <= 0 {
+		p.MinSilenceMs = fallback.MinSilenceMs
+	}
+	if p.DefaultSilenceMs <= 0 {
+		p.DefaultSilenceMs = fallback.DefaultSilenceMs
+	}
+	if p.MaxSilenceMs <= 0 {
+		p.MaxSilenceMs = fallback.MaxSilenceMs
+	}
+	if p.StableMs <= 0 {
+		p.StableMs = fallback.StableMs
+	}
+	if p.DefaultSilenceMs < p.MinSilenceMs {
+		p.DefaultSilenceMs = p.MinSilenceMs
+	}
+	if p.MaxSilenceMs < p.DefaultSilenceMs {
+		p.MaxSilenceMs = p.DefaultSilenceMs
+	}
+	return p
+}
+
+// ResolveProfile 按档位名获取参数，overrides 中的同名档位覆盖内置值，未知档位按 normal 处理
+func ResolveProfile(speed string, overrides map[string]Profile) Profile {
+	speed = strings.ToLower(strings.TrimSpace(speed))
+	base, ok := DefaultProfiles[speed]
+	if !ok {
+		speed = SpeedNormal
+		base = DefaultProfiles[SpeedNormal]
+	}
+	if override, ok := overrides[speed]; ok {
+		return override.withDefaults(base)
+	}
+	return base
+}
+
+// Decision 一次断句判断的结果
+type Decision struct {
+	End          bool    // 是否结束本句
+	ThresholdMs  int64   // 当前的静音阈值
+	Completeness float64 // 部分识别文本的语义完整度，没有文本时为 0.5
+	Stable       bool    // 部分识别结果是否已稳定
+	Text         string  // 参与判断的部分识别文本
+}
+
+// Detector 单个会话的断句检测器，ASR 协程写入部分结果、VAD 协程查询，可并发调用
+type Detector struct {
+	mu         sync.Mutex
+	profile    Profile
+	classifier Classifier
+
+	text      string
+	changedAt time.Time
+}
+
+// NewDetector 创建断句检测器，classifier 为 nil 时使用规则分类器
+func NewDetector(profile Profile, classifier Classifier) *Detector {
+	if classifier == nil {
+		classifier = RuleClassifier{}
+	}
+	return &Detector{
+		profile:    profile.withDefaults(DefaultProfiles[SpeedNormal]),
+		classifier: classifier,
+	}
+}
+
+// Profile 当前使用的断句参数
+func (d *Detector) Profile() Profile {
+	return d.profile
+}
+
+// OnPartial 记录 ASR 返回的部分识别结果，at 为收到结果的时间
+func (d *Detector) OnPartial(text string, at time.Time) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if text != d.text {
+		d.text = text
+		d.changedAt = at
+	}
+}
+
+// Reset 一句话结束后清空部分识别结果
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.text = ""
+	d.changedAt = time.Time{}
+}
+
+// Decide 根据当前连续静音时长判断是否结束本句
+func (d *Detector) Decide(silenceMs int64, now time.Time) Decision {
+	d.mu.Lock()
+	text, changedAt := d.text, d.changedAt
+	d.mu.Unlock()
+
+	p := d.profile
+	decision := Decision{Completeness: scoreNeutral, Stable: true, Text: text}
+	if text != "" {
+		decision.Completeness = d.classifier.Completeness(text)
+		decision.Stable = now.Sub(changedAt) >= time.Duration(p.StableMs)*time.Millisecond
+	}
+	decision.ThresholdMs = thresholdFor(p, decision.Completeness)
+
+	switch {
+	case silenceMs >= p.MaxSilenceMs:
+		decision.End = true
+	case silenceMs >= decision.ThresholdMs:
+		// 静音已足够，但识别结果还在变化（ASR 仍在追赶音频），等结果稳定再结束
+		decision.End = decision.Stable
+	}
+	return decision
+}
+
+// thresholdFor 把语义完整度映射为静音阈值：0.5 对应默认值，1 对应最短，0 对应最长
+func thresholdFor(p Profile, completeness float64) int64 {
+	if completeness >= scoreNeutral {
+		ratio := (completeness - scoreNeutral) / (1 - scoreNeutral)
+		return p.DefaultSilenceMs - int64(ratio*float64(p.DefaultSilenceMs-p.MinSilenceMs))
+	}
+	ratio := (scoreNeutral - completeness) / scoreNeutral
+	return p.DefaultSilenceMs + int64(ratio*float64(p.MaxSilenceMs-p.DefaultSilenceMs))
+}
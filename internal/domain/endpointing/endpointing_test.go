@@ -0,0 +1,117 @@
+package endpointing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRuleClassifier(t *testing.T) {
+	cases := []struct {
+		text string
+		want float64
+	}{
+		{"", scoreNeutral},
+		{"今天天气怎么样？", scoreTerminal},
+		{"what time is it?", scoreTerminal},
+		{"Turn on the light.", scoreTerminal},
+		{"明天会下雨吗", scoreParticle},
+		{"帮我设置一个闹钟，", scoreSeparator},
+		{"我想听那个", scoreConjunction},
+		{"先开灯然后", scoreConjunction},
+		{"book a table and", scoreConjunction},
+		{"what's the weather like in", scoreConjunction},
+		{"好的", scoreNeutral},
+		{"Shanghai today", scoreNeutral},
+	}
+	for _, c := range cases {
+		if got := (RuleClassifier{}).Completeness(c.text); got != c.want {
+			t.Errorf("Completeness(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	if p := ResolveProfile("unknown", nil); p != DefaultProfiles[SpeedNormal] {
+		t.Fatalf("unknown speed should fall back to normal, got %+v", p)
+	}
+	p := ResolveProfile(" Patient ", map[string]Profile{SpeedPatient: {MaxSilenceMs: 3000}})
+	if p.MaxSilenceMs != 3000 || p.MinSilenceMs != DefaultProfiles[SpeedPatient].MinSilenceMs {
+		t.Fatalf("override not merged: %+v", p)
+	}
+	p = ResolveProfile(SpeedFast, map[string]Profile{SpeedFast: {MinSilenceMs: 900}})
+	if p.DefaultSilenceMs < p.MinSilenceMs || p.MaxSilenceMs < p.DefaultSilenceMs {
+		t.Fatalf("profile should be ordered min <= default <= max: %+v", p)
+	}
+}
+
+func TestDetectorDecide(t *testing.T) {
+	p := Profile{MinSilenceMs: 200, DefaultSilenceMs: 400, MaxSilenceMs: 1200, StableMs: 200}
+	d := NewDetector(p, RuleClassifier{})
+	start := time.Unix(0, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	// 没有部分结果时使用默认阈值
+	if res := d.Decide(380, at(0)); res.End || res.ThresholdMs != 400 {
+		t.Fatalf("no text: %+v", res)
+	}
+	if res := d.Decide(400, at(0)); !res.End {
+		t.Fatalf("no text should end at default threshold: %+v", res)
+	}
+
+	// 连接词结尾：延长阈值
+	d.OnPartial("我想听那个", at(0))
+	if res := d.Decide(800, at(1000)); res.End || res.ThresholdMs <= 800 {
+		t.Fatalf("continuation should extend threshold: %+v", res)
+	}
+	if res := d.Decide(1200, at(1400)); !res.End {
+		t.Fatalf("max silence should always end: %+v", res)
+	}
+
+	// 句末标点：缩短阈值，但结果刚变化时要等稳定
+	d.OnPartial("我想听那个周杰伦的稻香。", at(2000))
+	res := d.Decide(250, at(2100))
+	if res.End || res.Stable || res.ThresholdMs >= 250 {
+		t.Fatalf("unstable partial should not end yet: %+v", res)
+	}
+	if res := d.Decide(350, at(2200)); !res.End {
+		t.Fatalf("stable terminal partial should end: %+v", res)
+	}
+
+	d.Reset()
+	if res := d.Decide(300, at(3000)); res.Text != "" || res.End {
+		t.Fatalf("reset should clear partial text: %+v", res)
+	}
+}
+
+// TestEvaluateFixtures 在 test/endpointing 的标注样本上对比固定阈值与自适应断句
+func TestEvaluateFixtures(t *testing.T) {
+	cases, err := LoadCases("../../../test/endpointing/cases.json")
+	if err != nil {
+		t.Fatalf("load cases: %v", err)
+	}
+	fixed, err := Evaluate(cases, func() *Detector {
+		return NewDetector(Profile{MinSilenceMs: 400, DefaultSilenceMs: 400, MaxSilenceMs: 400, StableMs: 1}, NoneClassifier{})
+	}, EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate fixed: %v", err)
+	}
+	adaptive, err := Evaluate(cases, func() *Detector {
+		return NewDetector(ResolveProfile(SpeedNormal, nil), RuleClassifier{})
+	}, EvalOptions{})
+	if err != nil {
+		t.Fatalf("evaluate adaptive: %v", err)
+	}
+
+	if fixed.Premature == 0 {
+		t.Fatalf("fixtures should contain mid-sentence pauses that cut off a fixed 400ms threshold")
+	}
+	if adaptive.Premature != 0 || adaptive.Missed != 0 {
+		for _, r := range adaptive.Results {
+			t.Logf("%+v", r)
+		}
+		t.Fatalf("adaptive endpointing: premature=%d missed=%d", adaptive.Premature, adaptive.Missed)
+	}
+	if adaptive.MeanLatencyMs > fixed.MeanLatencyMs {
+		t.Fatalf("adaptive latency %.0fms should not exceed fixed %.0fms", adaptive.MeanLatencyMs, fixed.MeanLatencyMs)
+	}
+}
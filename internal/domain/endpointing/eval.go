@@ -0,0 +1,169 @@
+package endpointing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-audio/wav"
+)
+
+// Partial 标注的部分识别结果：AtMs 时刻 ASR 返回 Text
+type Partial struct {
+	AtMs int64  `json:"at_ms"`
+	Text string `json:"text"`
+}
+
+// Case 一条离线评估样本：WAV 录音 + ASR 部分结果时间线 + 用户真正说完的时刻
+type Case struct {
+	Name      string    `json:"name"`
+	Wav       string    `json:"wav"`         // 相对标注文件所在目录
+	TurnEndMs int64     `json:"turn_end_ms"` // 最后一个字结束的时刻，早于该时刻断句即为截断
+	Partials  []Partial `json:"partials"`
+}
+
+// CaseResult 单条样本的评估结果
+type CaseResult struct {
+	Name       string
+	EndpointMs int64 // 判定说完的时刻，-1 表示直到录音结束都未断句
+	TurnEndMs  int64
+	Premature  bool  // 在用户说完前断句（截断）
+	LatencyMs  int64 // 断句时刻相对真正说完的延迟
+}
+
+// Report 一组样本的评估汇总
+type Report struct {
+	Results       []CaseResult
+	Premature     int
+	Missed        int
+	MeanLatencyMs float64 // 只统计正确断句的样本
+}
+
+// EvalOptions 评估参数
+type EvalOptions struct {
+	FrameMs      int     // VAD 帧长，默认 20ms
+	VadThreshold float64 // 能量 VAD 的 RMS 门限，默认 0.01
+}
+
+// LoadCases 读取标注文件（JSON 数组），WAV 路径转换为绝对路径
+func LoadCases(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("解析标注文件失败: %w", err)
+	}
+	dir := filepath.Dir(path)
+	for i := range cases {
+		if !filepath.IsAbs(cases[i].Wav) {
+			cases[i].Wav = filepath.Join(dir, cases[i].Wav)
+		}
+		sort.Slice(cases[i].Partials, func(a, b int) bool {
+			return cases[i].Partials[a].AtMs < cases[i].Partials[b].AtMs
+		})
+	}
+	return cases, nil
+}
+
+// Evaluate 用能量 VAD 模拟服务端的静音计时，逐帧回放部分识别结果，统计 newDetector 创建的检测器的断句效果
+func Evaluate(cases []Case, newDetector func() *Detector, opts EvalOptions) (*Report, error) {
+	if opts.FrameMs <= 0 {
+		opts.FrameMs = 20
+	}
+	if opts.VadThreshold <= 0 {
+		opts.VadThreshold = 0.01
+	}
+	report := &Report{}
+	var latencySum int64
+	for _, c := range cases {
+		voiced, err := voicedFrames(c.Wav, opts)
+		if err != nil {
+			return nil, fmt.Errorf("样本 %s: %w", c.Name, err)
+		}
+		result := runCase(c, voiced, newDetector(), opts.FrameMs)
+		switch {
+		case result.EndpointMs < 0:
+			report.Missed++
+		case result.Premature:
+			report.Premature++
+		default:
+			latencySum += result.LatencyMs
+		}
+		report.Results = append(report.Results, result)
+	}
+	if ok := len(cases) - report.Premature - report.Missed; ok > 0 {
+		report.MeanLatencyMs = float64(latencySum) / float64(ok)
+	}
+	return report, nil
+}
+
+func runCase(c Case, voiced []bool, d *Detector, frameMs int) CaseResult {
+	result := CaseResult{Name: c.Name, EndpointMs: -1, TurnEndMs: c.TurnEndMs}
+	base := time.Unix(0, 0)
+	next := 0
+	haveVoice := false
+	var silenceMs int64
+	for i, v := range voiced {
+		t := int64((i + 1) * frameMs)
+		for next < len(c.Partials) && c.Partials[next].AtMs <= t {
+			d.OnPartial(c.Partials[next].Text, base.Add(time.Duration(c.Partials[next].AtMs)*time.Millisecond))
+			next++
+		}
+		if v {
+			haveVoice = true
+			silenceMs = 0
+			continue
+		}
+		if !haveVoice {
+			continue
+		}
+		silenceMs += int64(frameMs)
+		if d.Decide(silenceMs, base.Add(time.Duration(t)*time.Millisecond)).End {
+			result.EndpointMs = t
+			break
+		}
+	}
+	if result.EndpointMs >= 0 {
+		result.Premature = result.EndpointMs < c.TurnEndMs
+		result.LatencyMs = result.EndpointMs - c.TurnEndMs
+	}
+	return result
+}
+
+// voicedFrames 读取单声道 WAV，按帧计算 RMS 判定是否有声
+func voicedFrames(path string, opts EvalOptions) ([]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := wav.NewDecoder(f)
+	if !dec.IsValidFile() {
+		return nil, fmt.Errorf("无效的 WAV 文件: %s", path)
+	}
+	buf, err := dec.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("读取 WAV 数据失败: %w", err)
+	}
+	if buf.Format.NumChannels != 1 {
+		return nil, fmt.Errorf("只支持单声道 WAV: %s", path)
+	}
+	scale := math.Pow(2, float64(buf.SourceBitDepth-1))
+	frame := buf.Format.SampleRate * opts.FrameMs / 1000
+	var voiced []bool
+	for pos := 0; pos+frame <= len(buf.Data); pos += frame {
+		var sum float64
+		for _, s := range buf.Data[pos : pos+frame] {
+			v := float64(s) / scale
+			sum += v * v
+		}
+		voiced = append(voiced, math.Sqrt(sum/float64(frame)) > opts.VadThreshold)
+	}
+	return voiced, nil
+}
@@ -23,6 +23,9 @@ type AddMessageEvent struct {
 	// 消息ID（用于关联两阶段保存）
 	MessageID string
 
+	// 对话轮次ID（同一轮的用户消息、工具消息与助手回复相同）
+	TurnID string
+
 	// 音频数据（可选，不属于 schema.Message 标准格式）
 	// 第一阶段：AudioData = nil（仅保存文本）
 	// 第二阶段：AudioData != nil（更新音频）
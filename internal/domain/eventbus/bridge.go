@@ -0,0 +1,56 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	bridgeQueueSize = 1024
+	bridgeTimeout   = 5 * time.Second
+)
+
+// Bridge 外部消息系统，把选定主题的事件转发给其他服务消费
+type Bridge interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Close() error
+}
+
+// BridgeMessage 转发到外部系统的消息体（JSON）
+type BridgeMessage struct {
+	Topic     string    `json:"topic"`
+	Source    string    `json:"source,omitempty"` // 发布实例标识
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+// AddBridge 把匹配 patterns（语法同 path.Match）的主题异步转发到外部系统
+// 事件在发布方 goroutine 中按主题的 encoder 序列化，转发在独立的有序队列中执行，外部系统变慢不会阻塞发布方
+func (b *Bus) AddBridge(name string, bridge Bridge, source string, patterns ...string) (*Subscription, error) {
+	if err := validatePatterns(patterns...); err != nil {
+		return nil, err
+	}
+	sub := b.subscribe(name, patterns, true, func(d delivery) {
+		if d.encoded == nil {
+			return
+		}
+		payload, err := json.Marshal(BridgeMessage{Topic: d.topic, Source: source, Timestamp: time.Now(), Data: d.encoded})
+		if err != nil {
+			log.Warnf("事件桥接序列化失败, bridge=%s topic=%s: %v", name, d.topic, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), bridgeTimeout)
+		defer cancel()
+		if err := bridge.Publish(ctx, d.topic, payload); err != nil {
+			log.Warnf("事件桥接发送失败, bridge=%s topic=%s: %v", name, d.topic, err)
+		}
+	}, []SubscribeOption{WithAsync(bridgeQueueSize)})
+
+	b.mu.Lock()
+	b.bridges = append(b.bridges, bridge)
+	b.mu.Unlock()
+	return sub, nil
+}
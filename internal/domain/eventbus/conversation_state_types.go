@@ -0,0 +1,21 @@
+package eventbus
+
+import (
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+// ConversationStateEvent 对话状态迁移事件，每次合法迁移后同步发布
+type ConversationStateEvent struct {
+	// 客户端状态
+	ClientState *ClientState
+
+	From     ConversationState
+	To       ConversationState
+	TurnID   string        // 迁移后的轮次ID
+	Reason   string        // 触发原因
+	Duration time.Duration // 在 From 状态停留的时长
+
+	Timestamp time.Time
+}
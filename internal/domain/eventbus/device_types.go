@@ -0,0 +1,10 @@
+package eventbus
+
+import "time"
+
+// DeviceEvent 设备上下线事件
+type DeviceEvent struct {
+	DeviceID  string    `json:"device_id"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -1,23 +1,371 @@
 package eventbus
 
 import (
+	"fmt"
+	"path"
+	"reflect"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 
-	evbus "github.com/asaskevich/EventBus"
+	log "xiaozhi-esp32-server-golang/logger"
 )
 
 var (
-	instance evbus.Bus
+	instance *Bus
 	once     sync.Once
+
+	// topicTypes 主题名 → 事件类型，防止同名主题绑定不同类型
+	topicTypes sync.Map
 )
 
-func Get() evbus.Bus {
+// Get 返回进程内全局事件总线
+func Get() *Bus {
 	once.Do(func() {
 		instance = New()
 	})
 	return instance
 }
 
-func New() evbus.Bus {
-	return evbus.New()
+// Bus 进程内事件总线
+// 主题通过 Topic[T] 绑定事件类型，发布与订阅在编译期检查类型；同步订阅者在发布方 goroutine 中按订阅顺序执行，
+// 异步订阅者各自拥有有序队列与处理 goroutine；单个订阅者 panic 只记录日志，不影响其他订阅者与发布方
+type Bus struct {
+	mu       sync.RWMutex
+	exact    map[string][]*subscriber
+	patterns []*subscriber
+	bridges  []Bridge
+	nextID   uint64
+	closed   bool
+}
+
+// New 创建独立的事件总线（测试或隔离场景使用，业务代码使用 Get）
+func New() *Bus {
+	return &Bus{exact: make(map[string][]*subscriber)}
+}
+
+// Topic 强类型主题
+type Topic[T any] struct {
+	name   string
+	encode func(T) any
+}
+
+// NewTopic 声明主题；同名主题只能绑定同一事件类型，否则 panic
+func NewTopic[T any](name string) Topic[T] {
+	eventType := reflect.TypeOf((*T)(nil)).Elem()
+	if prev, loaded := topicTypes.LoadOrStore(name, eventType); loaded && prev != eventType {
+		panic(fmt.Sprintf("eventbus: topic %q already declared with type %v, got %v", name, prev, eventType))
+	}
+	return Topic[T]{name: name}
+}
+
+// WithEncoder 设置桥接到外部系统时的序列化方式，在发布方 goroutine 中调用，应只复制需要的字段
+func (t Topic[T]) WithEncoder(encode func(T) any) Topic[T] {
+	t.encode = encode
+	return t
+}
+
+// Name 主题名
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+func (t Topic[T]) String() string {
+	return t.name
+}
+
+// Publish 在全局事件总线上发布事件
+func Publish[T any](topic Topic[T], event T) {
+	PublishOn(Get(), topic, event)
+}
+
+// PublishOn 在指定事件总线上发布事件
+func PublishOn[T any](b *Bus, topic Topic[T], event T) {
+	b.publish(delivery{
+		topic: topic.name,
+		event: event,
+		encode: func() any {
+			if topic.encode != nil {
+				return topic.encode(event)
+			}
+			return event
+		},
+	})
+}
+
+// Subscribe 在全局事件总线上订阅主题
+func Subscribe[T any](topic Topic[T], handler func(T), opts ...SubscribeOption) *Subscription {
+	return SubscribeOn(Get(), topic, handler, opts...)
+}
+
+// SubscribeOn 在指定事件总线上订阅主题
+func SubscribeOn[T any](b *Bus, topic Topic[T], handler func(T), opts ...SubscribeOption) *Subscription {
+	return b.subscribe(topic.name, nil, false, func(d delivery) {
+		event, _ := d.event.(T)
+		handler(event)
+	}, opts)
+}
+
+// SubscribePattern 在全局事件总线上通配订阅
+func SubscribePattern(pattern string, handler func(topic string, event any), opts ...SubscribeOption) (*Subscription, error) {
+	return Get().SubscribePattern(pattern, handler, opts...)
+}
+
+// SubscribePattern 通配订阅，pattern 语法同 path.Match，例如 "session_*"、"*"
+func (b *Bus) SubscribePattern(pattern string, handler func(topic string, event any), opts ...SubscribeOption) (*Subscription, error) {
+	if err := validatePatterns(pattern); err != nil {
+		return nil, err
+	}
+	return b.subscribe(pattern, []string{pattern}, false, func(d delivery) {
+		handler(d.topic, d.event)
+	}, opts), nil
+}
+
+func validatePatterns(patterns ...string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("eventbus: empty topic pattern")
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("eventbus: empty topic pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("eventbus: bad topic pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// SubscribeOption 订阅选项
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	async     bool
+	queueSize int
+}
+
+const defaultAsyncQueueSize = 256
+
+// WithAsync 异步投递：事件进入订阅者自己的有序队列，由独立 goroutine 依次处理；
+// 队列满时丢弃事件并记录日志，不阻塞发布方。queueSize<=0 时使用默认值 256
+func WithAsync(queueSize int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.async = true
+		if queueSize > 0 {
+			o.queueSize = queueSize
+		}
+	}
+}
+
+// Subscription 订阅句柄
+type Subscription struct {
+	bus *Bus
+	sub *subscriber
+}
+
+// Unsubscribe 取消订阅；异步订阅队列中尚未处理的事件会被丢弃
+func (s *Subscription) Unsubscribe() {
+	if s == nil || s.sub == nil {
+		return
+	}
+	s.bus.remove(s.sub)
+	s.sub.stop()
+}
+
+// Dropped 异步队列满而丢弃的事件数
+func (s *Subscription) Dropped() int64 {
+	if s == nil || s.sub == nil {
+		return 0
+	}
+	return s.sub.dropped.Load()
+}
+
+type delivery struct {
+	topic   string
+	event   any
+	encode  func() any
+	encoded any // 桥接订阅使用的序列化结果
+}
+
+type subscriber struct {
+	id       uint64
+	name     string   // 主题名或通配模式，用于日志
+	patterns []string // 非空时为通配订阅
+	encoded  bool     // 需要序列化结果（桥接）
+	handler  func(delivery)
+	queue    chan delivery // nil 表示同步订阅
+	done     chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Int64
+}
+
+func (b *Bus) subscribe(name string, patterns []string, encoded bool, handler func(delivery), opts []SubscribeOption) *Subscription {
+	options := subscribeOptions{queueSize: defaultAsyncQueueSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	sub := &subscriber{
+		name:     name,
+		patterns: patterns,
+		encoded:  encoded,
+		handler:  handler,
+		done:     make(chan struct{}),
+	}
+	if options.async {
+		sub.queue = make(chan delivery, options.queueSize)
+		go sub.run()
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	if len(patterns) > 0 {
+		b.patterns = append(b.patterns, sub)
+	} else {
+		b.exact[name] = append(b.exact[name], sub)
+	}
+	b.mu.Unlock()
+	return &Subscription{bus: b, sub: sub}
+}
+
+func (b *Bus) remove(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(sub.patterns) > 0 {
+		b.patterns = removeSubscriber(b.patterns, sub)
+		return
+	}
+	b.exact[sub.name] = removeSubscriber(b.exact[sub.name], sub)
+	if len(b.exact[sub.name]) == 0 {
+		delete(b.exact, sub.name)
+	}
+}
+
+// removeSubscriber 复制后删除，发布方持有的旧切片不受影响
+func removeSubscriber(subs []*subscriber, target *subscriber) []*subscriber {
+	ret := make([]*subscriber, 0, len(subs))
+	for _, sub := range subs {
+		if sub != target {
+			ret = append(ret, sub)
+		}
+	}
+	return ret
+}
+
+func (b *Bus) publish(d delivery) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	exact := b.exact[d.topic]
+	subs := make([]*subscriber, 0, len(exact)+len(b.patterns))
+	subs = append(subs, exact...)
+	for _, sub := range b.patterns {
+		if sub.match(d.topic) {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.encoded && d.encoded == nil {
+			d.encoded = safeEncode(d)
+		}
+		sub.deliver(d)
+	}
+}
+
+func safeEncode(d delivery) (encoded any) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("eventbus 事件序列化 panic, topic=%s: %v", d.topic, r)
+			encoded = nil
+		}
+	}()
+	return d.encode()
+}
+
+func (s *subscriber) match(topic string) bool {
+	for _, pattern := range s.patterns {
+		if ok, _ := path.Match(pattern, topic); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *subscriber) deliver(d delivery) {
+	if s.queue == nil {
+		s.invoke(d)
+		return
+	}
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	select {
+	case s.queue <- d:
+	default:
+		if n := s.dropped.Add(1); n == 1 || n%100 == 0 {
+			log.Warnf("eventbus 异步订阅队列已满，丢弃事件, topic=%s subscriber=%s dropped=%d", d.topic, s.name, n)
+		}
+	}
+}
+
+// invoke 执行订阅者回调，panic 只影响当前事件
+func (s *subscriber) invoke(d delivery) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("eventbus 订阅者处理事件 panic, topic=%s subscriber=%s: %v\n%s", d.topic, s.name, r, debug.Stack())
+		}
+	}()
+	s.handler(d)
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case d := <-s.queue:
+			s.invoke(d)
+		}
+	}
+}
+
+func (s *subscriber) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Close 停止所有订阅与桥接，之后发布的事件被忽略
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	var subs []*subscriber
+	for _, list := range b.exact {
+		subs = append(subs, list...)
+	}
+	subs = append(subs, b.patterns...)
+	bridges := b.bridges
+	b.exact = make(map[string][]*subscriber)
+	b.patterns = nil
+	b.bridges = nil
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+	for _, bridge := range bridges {
+		if err := bridge.Close(); err != nil {
+			log.Warnf("关闭事件桥接失败: %v", err)
+		}
+	}
 }
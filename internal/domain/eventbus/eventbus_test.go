@@ -0,0 +1,204 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+type testEvent struct {
+	N int
+}
+
+var (
+	testTopicA = NewTopic[*testEvent]("test_a")
+	testTopicB = NewTopic[*testEvent]("test_b")
+	testTopicC = NewTopic[string]("other_c")
+)
+
+func TestTypedPublishSubscribe(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	var got []string
+	SubscribeOn(bus, testTopicA, func(e *testEvent) {
+		got = append(got, "first")
+	})
+	SubscribeOn(bus, testTopicA, func(e *testEvent) {
+		panic("boom")
+	})
+	sub := SubscribeOn(bus, testTopicA, func(e *testEvent) {
+		got = append(got, "third")
+	})
+	if _, err := bus.SubscribePattern("test_*", func(topic string, event any) {
+		got = append(got, "pattern:"+topic)
+	}); err != nil {
+		t.Fatalf("subscribe pattern: %v", err)
+	}
+
+	PublishOn(bus, testTopicA, &testEvent{N: 1})
+	PublishOn(bus, testTopicB, &testEvent{N: 2})
+	PublishOn(bus, testTopicC, "ignored")
+	sub.Unsubscribe()
+	PublishOn(bus, testTopicA, &testEvent{N: 3})
+
+	want := "first,third,pattern:test_a,pattern:test_b,first,pattern:test_a"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+}
+
+func TestAsyncSubscriberKeepsOrder(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	var mu sync.Mutex
+	var got []int
+	done := make(chan struct{})
+	SubscribeOn(bus, testTopicA, func(e *testEvent) {
+		if e.N == 2 {
+			panic("boom")
+		}
+		mu.Lock()
+		got = append(got, e.N)
+		mu.Unlock()
+		if e.N == 50 {
+			close(done)
+		}
+	}, WithAsync(100))
+
+	for i := 1; i <= 50; i++ {
+		PublishOn(bus, testTopicA, &testEvent{N: i})
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("async subscriber did not finish")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 49 || got[0] != 1 || got[1] != 3 || got[48] != 50 {
+		t.Fatalf("unexpected order: %v", got)
+	}
+}
+
+func TestNewTopicTypeConflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("declaring a topic with another type should panic")
+		}
+	}()
+	NewTopic[int]("test_a")
+}
+
+func TestBadPattern(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+	if _, err := bus.SubscribePattern("[", func(string, any) {}); err == nil {
+		t.Fatal("bad pattern should be rejected")
+	}
+	if _, err := bus.AddBridge("x", nil, ""); err == nil {
+		t.Fatal("bridge without patterns should be rejected")
+	}
+}
+
+type fakeBridge struct {
+	ch chan BridgeMessage
+}
+
+func (f *fakeBridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	var msg BridgeMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+	f.ch <- msg
+	return nil
+}
+
+func (f *fakeBridge) Close() error { return nil }
+
+func TestBridgeEncodesInPublisher(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+	bridge := &fakeBridge{ch: make(chan BridgeMessage, 4)}
+	if _, err := bus.AddBridge("fake", bridge, "node-1", "session_*"); err != nil {
+		t.Fatalf("add bridge: %v", err)
+	}
+
+	state := &ClientState{DeviceID: "aa:bb", AgentID: "3", SessionID: "s1"}
+	PublishOn(bus, TopicSessionEnd, state)
+	// 发布后立即修改状态，桥接收到的应是发布时的快照
+	state.SessionID = "s2"
+	PublishOn(bus, TopicDeviceOnline, &DeviceEvent{DeviceID: "aa:bb"})
+
+	select {
+	case msg := <-bridge.ch:
+		data, _ := msg.Data.(map[string]any)
+		if msg.Topic != TopicNameSessionEnd || msg.Source != "node-1" || data["session_id"] != "s1" || data["device_id"] != "aa:bb" {
+			t.Fatalf("unexpected bridge message: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bridge did not receive message")
+	}
+	select {
+	case msg := <-bridge.ch:
+		t.Fatalf("device_online should not be bridged: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNATSBridgePublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n"))
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "PING"):
+				conn.Write([]byte("PONG\r\n"))
+			case strings.HasPrefix(line, "PUB "):
+				payload, _ := reader.ReadString('\n')
+				received <- strings.TrimSpace(line) + "|" + strings.TrimSpace(payload)
+			}
+		}
+	}()
+
+	bridge, err := NewNATSBridge(NATSConfig{URL: "nats://" + ln.Addr().String(), SubjectPrefix: "xiaozhi.events."})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer bridge.Close()
+	if err := bridge.Publish(context.Background(), "session_end", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got != `PUB xiaozhi.events.session_end 7|{"a":1}` {
+			t.Fatalf("unexpected PUB: %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not receive PUB")
+	}
+}
@@ -0,0 +1,78 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	natsDialTimeout    = 5 * time.Second
+	natsReconnectDelay = 2 * time.Second
+)
+
+// NATSConfig NATS 桥接配置
+type NATSConfig struct {
+	URL           string // nats://[user:pass@]host:port，tls:// 使用 TLS，多个地址用逗号分隔
+	Token         string
+	SubjectPrefix string // 主题前缀，subject = prefix + 主题名
+	Name          string // 连接名，便于在 NATS 监控中识别
+}
+
+// NATSBridge 通过 NATS core 发布事件，断线重连与重连期间的缓冲由 nats.go 负责
+type NATSBridge struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATSBridge 创建 NATS 桥接并建立首次连接
+func NewNATSBridge(cfg NATSConfig) (*NATSBridge, error) {
+	if cfg.URL == "" {
+		cfg.URL = nats.DefaultURL
+	}
+	opts := []nats.Option{
+		nats.Name(cfg.Name),
+		nats.Timeout(natsDialTimeout),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsReconnectDelay),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warnf("NATS 连接断开: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Infof("NATS 已重新连接: %s", nc.ConnectedUrlRedacted())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			log.Warnf("NATS 服务端返回错误: %v", err)
+		}),
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("连接 NATS 失败: %w", err)
+	}
+	return &NATSBridge{conn: conn, prefix: cfg.SubjectPrefix}, nil
+}
+
+func (n *NATSBridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := n.conn.Publish(n.prefix+topic, payload); err != nil {
+		return fmt.Errorf("NATS 发布失败: %w", err)
+	}
+	return nil
+}
+
+func (n *NATSBridge) Close() error {
+	// Drain 会先把缓冲中的消息发出再关闭连接
+	if err := n.conn.Drain(); err != nil {
+		n.conn.Close()
+		return err
+	}
+	return nil
+}
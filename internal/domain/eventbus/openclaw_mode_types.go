@@ -0,0 +1,18 @@
+package eventbus
+
+import (
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+// OpenClawModeEvent OpenClaw 模式切换事件
+type OpenClawModeEvent struct {
+	// 客户端状态
+	ClientState *ClientState
+
+	Enabled bool   // true=进入，false=退出
+	Trigger string // "enter_keyword"、"exit_keyword"、"send_failed" 等
+
+	Timestamp time.Time
+}
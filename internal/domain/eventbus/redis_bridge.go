@@ -0,0 +1,26 @@
+package eventbus
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBridge 通过 Redis pub/sub 转发事件，频道名为 prefix + 主题名
+type RedisBridge struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBridge 创建 Redis 桥接，关闭桥接时会关闭 client
+func NewRedisBridge(client *redis.Client, prefix string) *RedisBridge {
+	return &RedisBridge{client: client, prefix: prefix}
+}
+
+func (r *RedisBridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	return r.client.Publish(ctx, r.prefix+topic, payload).Err()
+}
+
+func (r *RedisBridge) Close() error {
+	return r.client.Close()
+}
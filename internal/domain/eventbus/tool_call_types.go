@@ -0,0 +1,23 @@
+package eventbus
+
+import (
+	"time"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+// ToolCallEvent 工具调用事件（每次调用结束后发布，无论成功与否）
+type ToolCallEvent struct {
+	// 客户端状态
+	ClientState *ClientState
+
+	TurnID     string // 对话轮次ID
+	ToolCallID string
+	ToolName   string
+	Arguments  string // LLM 生成的 JSON 参数
+	Result     string // 工具返回结果（失败时为空）
+	Error      string // 调用失败原因（成功时为空）
+	Duration   time.Duration
+
+	Timestamp time.Time
+}
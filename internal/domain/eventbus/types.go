@@ -1,12 +1,118 @@
 package eventbus
 
+import (
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+)
+
+// 主题名
 const (
-	TopicAddMessage = "add_message"
-	TopicSessionEnd = "session_end"
-	TopicExitChat   = "exit_chat" // 退出聊天事件
-
-	// 聊天历史相关事件（已废弃，统一使用 TopicAddMessage）
-	// Deprecated: 使用 TopicAddMessage 替代
-	TopicChatHistoryUserMessage      = "chat_history_user_message"      // 用户消息(ASR后) - 已废弃
-	TopicChatHistoryAssistantMessage = "chat_history_assistant_message" // 机器人回复(LLM+TTS后) - 已废弃
+	TopicNameAddMessage    = "add_message"
+	TopicNameSessionEnd    = "session_end"
+	TopicNameExitChat      = "exit_chat"
+	TopicNameSessionStart  = "session_start"
+	TopicNameDeviceOnline  = "device_online"
+	TopicNameDeviceOffline = "device_offline"
+	TopicNameToolCall      = "tool_call"
+	TopicNameOpenClawMode  = "openclaw_mode"
+	TopicNameConversation  = "conversation_state"
+)
+
+// 强类型主题，发布与订阅的事件类型在编译期检查
+var (
+	TopicAddMessage    = NewTopic[*AddMessageEvent](TopicNameAddMessage).WithEncoder(encodeAddMessage)
+	TopicSessionEnd    = NewTopic[*ClientState](TopicNameSessionEnd).WithEncoder(encodeClientState)   // 会话结束
+	TopicExitChat      = NewTopic[*ExitChatEvent](TopicNameExitChat).WithEncoder(encodeExitChat)      // 退出聊天
+	TopicSessionStart  = NewTopic[*ClientState](TopicNameSessionStart).WithEncoder(encodeClientState) // 会话开始（首次 hello）
+	TopicDeviceOnline  = NewTopic[*DeviceEvent](TopicNameDeviceOnline)                                // 设备上线
+	TopicDeviceOffline = NewTopic[*DeviceEvent](TopicNameDeviceOffline)                               // 设备下线
+	TopicToolCall      = NewTopic[*ToolCallEvent](TopicNameToolCall).WithEncoder(encodeToolCall)      // 工具调用完成
+	TopicOpenClawMode  = NewTopic[*OpenClawModeEvent](TopicNameOpenClawMode).WithEncoder(encodeOpenClawMode)
+	TopicConversation  = NewTopic[*ConversationStateEvent](TopicNameConversation).WithEncoder(encodeConversationState) // 对话状态迁移
 )
+
+// 桥接到外部系统时只输出会话标识与业务字段，不输出音频、上下文等运行时状态
+
+func sessionFields(clientState *ClientState) map[string]any {
+	if clientState == nil {
+		return map[string]any{}
+	}
+	return map[string]any{
+		"device_id":  clientState.DeviceID,
+		"agent_id":   clientState.AgentID,
+		"session_id": clientState.SessionID,
+	}
+}
+
+func encodeClientState(clientState *ClientState) any {
+	if clientState == nil {
+		return nil
+	}
+	return sessionFields(clientState)
+}
+
+func encodeAddMessage(event *AddMessageEvent) any {
+	if event == nil {
+		return nil
+	}
+	data := sessionFields(event.ClientState)
+	data["message_id"] = event.MessageID
+	data["turn_id"] = event.TurnID
+	data["role"] = string(event.Msg.Role)
+	data["content"] = event.Msg.Content
+	data["is_update"] = event.IsUpdate
+	data["timestamp"] = event.Timestamp
+	return data
+}
+
+func encodeExitChat(event *ExitChatEvent) any {
+	if event == nil {
+		return nil
+	}
+	data := sessionFields(event.ClientState)
+	data["reason"] = event.Reason
+	data["trigger_type"] = event.TriggerType
+	data["user_text"] = event.UserText
+	data["timestamp"] = event.Timestamp
+	return data
+}
+
+func encodeToolCall(event *ToolCallEvent) any {
+	if event == nil {
+		return nil
+	}
+	data := sessionFields(event.ClientState)
+	data["turn_id"] = event.TurnID
+	data["tool_call_id"] = event.ToolCallID
+	data["tool_name"] = event.ToolName
+	data["arguments"] = event.Arguments
+	data["result"] = event.Result
+	data["error"] = event.Error
+	data["duration_ms"] = event.Duration.Milliseconds()
+	data["timestamp"] = event.Timestamp
+	return data
+}
+
+func encodeOpenClawMode(event *OpenClawModeEvent) any {
+	if event == nil {
+		return nil
+	}
+	data := sessionFields(event.ClientState)
+	data["enabled"] = event.Enabled
+	data["trigger"] = event.Trigger
+	data["timestamp"] = event.Timestamp
+	return data
+}
+
+func encodeConversationState(event *ConversationStateEvent) any {
+	if event == nil {
+		return nil
+	}
+	data := sessionFields(event.ClientState)
+	data["from"] = string(event.From)
+	data["to"] = string(event.To)
+	data["turn_id"] = event.TurnID
+	data["reason"] = event.Reason
+	data["duration_ms"] = event.Duration.Milliseconds()
+	data["timestamp"] = event.Timestamp
+	return data
+}
@@ -0,0 +1,206 @@
+package i18n
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// 支持的对话语言
+const (
+	LanguageAuto = "auto" // 按 ASR 识别结果自动切换
+	LanguageZh   = "zh"
+	LanguageYue  = "yue"
+	LanguageEn   = "en"
+	LanguageJa   = "ja"
+	LanguageKo   = "ko"
+
+	DefaultLanguage = LanguageZh
+)
+
+var languageAliases = map[string]string{
+	"zh": LanguageZh, "zh-cn": LanguageZh, "zh-hans": LanguageZh, "zh-tw": LanguageZh, "zh-hant": LanguageZh,
+	"cmn": LanguageZh, "chinese": LanguageZh, "mandarin": LanguageZh, "中文": LanguageZh, "普通话": LanguageZh,
+	"yue": LanguageYue, "zh-hk": LanguageYue, "cantonese": LanguageYue, "粤语": LanguageYue,
+	"en": LanguageEn, "en-us": LanguageEn, "en-gb": LanguageEn, "english": LanguageEn,
+	"ja": LanguageJa, "ja-jp": LanguageJa, "jp": LanguageJa, "japanese": LanguageJa,
+	"ko": LanguageKo, "ko-kr": LanguageKo, "kr": LanguageKo, "korean": LanguageKo,
+}
+
+// Normalize 将 ASR / 配置中的语言标识归一化为支持的语言代码，不支持时返回空
+func Normalize(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "_", "-")
+	if code == LanguageAuto {
+		return LanguageAuto
+	}
+	return languageAliases[code]
+}
+
+// NormalizeSetting 归一化智能体语言设置，空或不支持时使用 i18n.default_language（默认中文）
+func NormalizeSetting(setting string) string {
+	if lang := Normalize(setting); lang != "" {
+		return lang
+	}
+	if lang := Normalize(viper.GetString("i18n.default_language")); lang != "" {
+		return lang
+	}
+	return DefaultLanguage
+}
+
+// Resolve 计算本轮对话使用的语言：
+// 固定语言直接返回；auto 模式优先使用 ASR 识别出的语言，其次按文本字符判断，都无法判断时沿用上一轮语言
+func Resolve(setting, asrLanguage, text, previous string) string {
+	setting = NormalizeSetting(setting)
+	if setting != LanguageAuto {
+		return setting
+	}
+	if lang := Normalize(asrLanguage); lang != "" && lang != LanguageAuto {
+		return lang
+	}
+	if lang := Detect(text); lang != "" {
+		return lang
+	}
+	if lang := Normalize(previous); lang != "" && lang != LanguageAuto {
+		return lang
+	}
+	return DefaultLanguage
+}
+
+// Detect 按文字脚本粗略判断文本语言，无法判断时返回空。
+// 汉字按字计数、拉丁字母按单词计数，避免中文里夹杂英文歌名等被误判为英文；粤语无法与普通话区分，统一判为中文。
+func Detect(text string) string {
+	var han, kana, hangul, latinWords int
+	inLatinWord := false
+	for _, r := range text {
+		isLatin := r < unicode.MaxASCII && unicode.IsLetter(r)
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case isLatin && !inLatinWord:
+			latinWords++
+		}
+		inLatinWord = isLatin
+	}
+
+	switch {
+	case kana > 0 && kana+han >= hangul && kana+han >= latinWords:
+		return LanguageJa
+	case hangul > 0 && hangul >= han && hangul >= latinWords:
+		return LanguageKo
+	case han > 0 && han >= latinWords:
+		return LanguageZh
+	case latinWords >= 2:
+		return LanguageEn
+	}
+	return ""
+}
+
+// DisplayName 语言的本地名称
+func DisplayName(lang string) string {
+	return phrasesOf(lang).DisplayName
+}
+
+// ReplyInstruction 追加到系统提示词中的回复语言要求
+func ReplyInstruction(lang string) string {
+	return phrasesOf(lang).ReplyInstruction
+}
+
+// FormatDateTime 按语言习惯格式化日期时间（含星期）
+func FormatDateTime(t time.Time, lang string) string {
+	p := phrasesOf(lang)
+	weekday := p.Weekdays[t.Weekday()]
+	switch Normalize(lang) {
+	case LanguageEn:
+		return fmt.Sprintf("%s, %s %d, %d %02d:%02d:%02d", weekday, t.Month().String(), t.Day(), t.Year(), t.Hour(), t.Minute(), t.Second())
+	case LanguageJa:
+		return fmt.Sprintf("%d年%d月%d日(%s) %02d:%02d:%02d", t.Year(), int(t.Month()), t.Day(), weekday, t.Hour(), t.Minute(), t.Second())
+	case LanguageKo:
+		return fmt.Sprintf("%d년 %d월 %d일 %s %02d:%02d:%02d", t.Year(), int(t.Month()), t.Day(), weekday, t.Hour(), t.Minute(), t.Second())
+	default:
+		return fmt.Sprintf("%d年%d月%d日 %s %02d:%02d:%02d", t.Year(), int(t.Month()), t.Day(), weekday, t.Hour(), t.Minute(), t.Second())
+	}
+}
+
+// DateTimeLabel 系统提示词中当前时间一行的标签
+func DateTimeLabel(lang string) string {
+	return phrasesOf(lang).DateTimeLabel
+}
+
+// Weekday 本地化的星期名称
+func Weekday(weekday time.Weekday, lang string) string {
+	return phrasesOf(lang).Weekdays[weekday]
+}
+
+// Greetings 欢迎语列表：中文沿用顶层 greeting_list，其它语言读取 i18n.<lang>.greeting_list，未配置时使用内置欢迎语
+func Greetings(lang string) []string {
+	return configuredOrBuiltin(lang, "greeting_list", phrasesOf(lang).Greetings)
+}
+
+// RandomGreeting 随机选取一条欢迎语
+func RandomGreeting(lang string) string {
+	greetings := Greetings(lang)
+	if len(greetings) == 0 {
+		return phrasesOf(DefaultLanguage).Greetings[0]
+	}
+	return greetings[rand.Intn(len(greetings))]
+}
+
+// WakeupWords 唤醒词列表：中文沿用顶层 wakeup_words，其它语言读取 i18n.<lang>.wakeup_words
+func WakeupWords(lang string) []string {
+	return configuredOrBuiltin(lang, "wakeup_words", phrasesOf(lang).WakeupWords)
+}
+
+// ExitWords 退出对话的关键词，可通过 exit_words / i18n.<lang>.exit_words 覆盖
+func ExitWords(lang string) []string {
+	return configuredOrBuiltin(lang, "exit_words", phrasesOf(lang).ExitWords)
+}
+
+// Text 获取内置提示语，目标语言缺失时回退中文
+func Text(lang, key string) string {
+	if text, ok := phrasesOf(lang).Texts[key]; ok {
+		return text
+	}
+	return builtinPhrases[DefaultLanguage].Texts[key]
+}
+
+// ActivationPrompt 设备未激活时播报的提示语
+func ActivationPrompt(lang, code string) string {
+	return fmt.Sprintf(Text(lang, TextActivationPrompt), code)
+}
+
+// Languages 除 auto 外的全部支持语言
+func Languages() []string {
+	return []string{LanguageZh, LanguageYue, LanguageEn, LanguageJa, LanguageKo}
+}
+
+func configuredOrBuiltin(lang, key string, builtin []string) []string {
+	lang = Normalize(lang)
+	if lang == "" || lang == LanguageAuto {
+		lang = DefaultLanguage
+	}
+	configKey := "i18n." + lang + "." + key
+	if lang == DefaultLanguage {
+		// 中文兼容原有的顶层配置项
+		configKey = key
+	}
+	if values := viper.GetStringSlice(configKey); len(values) > 0 {
+		return values
+	}
+	return builtin
+}
+
+func phrasesOf(lang string) phrases {
+	if p, ok := builtinPhrases[Normalize(lang)]; ok {
+		return p
+	}
+	return builtinPhrases[DefaultLanguage]
+}
@@ -0,0 +1,82 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"今天天气怎么样":                       LanguageZh,
+		"帮我放一首 Taylor Swift":            LanguageZh,
+		"what's the weather like today": LanguageEn,
+		"今日はいい天気ですね":                    LanguageJa,
+		"오늘 날씨 어때요":                     LanguageKo,
+		"ok":                            "",
+		"123":                           "",
+	}
+	for text, want := range cases {
+		if got := Detect(text); got != want {
+			t.Fatalf("Detect(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cases := []struct {
+		setting, asrLang, text, previous, want string
+	}{
+		{"", "", "hello there friend", "", LanguageZh},
+		{"en", "ja", "今日は", "", LanguageEn},
+		{"auto", "ja", "hello there", "", LanguageJa},
+		{"auto", "", "hello there", "zh", LanguageEn},
+		{"auto", "fr", "ok", "ko", LanguageKo},
+		{"auto", "", "", "", LanguageZh},
+		{"AUTO", "en-US", "", "", LanguageEn},
+	}
+	for _, c := range cases {
+		if got := Resolve(c.setting, c.asrLang, c.text, c.previous); got != c.want {
+			t.Fatalf("Resolve(%q, %q, %q, %q) = %q, want %q", c.setting, c.asrLang, c.text, c.previous, got, c.want)
+		}
+	}
+}
+
+func TestFormatDateTime(t *testing.T) {
+	now := time.Date(2026, 3, 9, 8, 5, 0, 0, time.UTC)
+	cases := map[string]string{
+		LanguageZh: "2026年3月9日 星期一 08:05:00",
+		LanguageEn: "Monday, March 9, 2026 08:05:00",
+		LanguageJa: "2026年3月9日(月) 08:05:00",
+		LanguageKo: "2026년 3월 9일 월요일 08:05:00",
+		"fr":       "2026年3月9日 星期一 08:05:00",
+	}
+	for lang, want := range cases {
+		if got := FormatDateTime(now, lang); got != want {
+			t.Fatalf("FormatDateTime(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestGreetingsConfigOverride(t *testing.T) {
+	viper.Set("greeting_list", []string{"你好呀"})
+	viper.Set("i18n.en.greeting_list", []string{"Hello!"})
+	defer func() {
+		viper.Set("greeting_list", nil)
+		viper.Set("i18n.en.greeting_list", nil)
+	}()
+
+	if got := Greetings(LanguageZh); len(got) != 1 || got[0] != "你好呀" {
+		t.Fatalf("zh greetings = %v", got)
+	}
+	if got := Greetings(LanguageEn); len(got) != 1 || got[0] != "Hello!" {
+		t.Fatalf("en greetings = %v", got)
+	}
+	if got := Greetings(LanguageJa); len(got) == 0 {
+		t.Fatalf("ja greetings should fall back to builtin")
+	}
+	if got := Text("fr", TextGoodbye); got != builtinPhrases[LanguageZh].Texts[TextGoodbye] {
+		t.Fatalf("unsupported language should fall back to zh, got %q", got)
+	}
+}
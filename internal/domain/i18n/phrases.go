@@ -0,0 +1,161 @@
+package i18n
+
+import "time"
+
+// 内置提示语的 key
+const (
+	TextActivationPrompt    = "activation_prompt" // 含一个 %s 占位符（激活码）
+	TextGoodbye             = "goodbye"
+	TextOpenClawEntered     = "openclaw_entered"
+	TextOpenClawExited      = "openclaw_exited"
+	TextOpenClawUnavailable = "openclaw_unavailable"
+	TextOpenClawFallback    = "openclaw_fallback"
+	TextToolFiller          = "tool_filler"           // 工具执行较慢时的过渡语
+	TextToolConfirmAsk      = "tool_confirm_ask"      // 含一个 %s 占位符（操作名称）
+	TextToolConfirmCanceled = "tool_confirm_canceled" // 用户拒绝执行敏感工具
+)
+
+// phrases 单个语言的内置话术
+type phrases struct {
+	DisplayName      string
+	ReplyInstruction string
+	DateTimeLabel    string
+	Weekdays         map[time.Weekday]string
+	Greetings        []string
+	WakeupWords      []string
+	ExitWords        []string
+	Texts            map[string]string
+}
+
+var zhWeekdays = map[time.Weekday]string{
+	time.Sunday:    "星期日",
+	time.Monday:    "星期一",
+	time.Tuesday:   "星期二",
+	time.Wednesday: "星期三",
+	time.Thursday:  "星期四",
+	time.Friday:    "星期五",
+	time.Saturday:  "星期六",
+}
+
+var builtinPhrases = map[string]phrases{
+	LanguageZh: {
+		DisplayName:      "中文",
+		ReplyInstruction: "请使用中文回复用户。",
+		DateTimeLabel:    "当前时间和日期",
+		Weekdays:         zhWeekdays,
+		Greetings:        []string{"你好，有啥好玩的."},
+		ExitWords:        []string{"再见", "退下吧", "退出", "退出对话"},
+		Texts: map[string]string{
+			TextActivationPrompt:    "请在后台添加设备，激活码: %s",
+			TextGoodbye:             "好的，再见！期待下次与您聊天～",
+			TextOpenClawEntered:     "已进入OpenClaw模式，请继续说",
+			TextOpenClawExited:      "已退出OpenClaw模式",
+			TextOpenClawUnavailable: "OpenClaw当前不可用，请稍后再试",
+			TextOpenClawFallback:    "OpenClaw当前不可用，已退出OpenClaw模式",
+			TextToolFiller:          "稍等，我查一下。",
+			TextToolConfirmAsk:      "即将执行「%s」，确定吗？",
+			TextToolConfirmCanceled: "好的，已取消。",
+		},
+	},
+	LanguageYue: {
+		DisplayName:      "粤语",
+		ReplyInstruction: "请使用粤语（广东话口语，繁体或简体汉字均可）回复用户。",
+		DateTimeLabel:    "当前时间和日期",
+		Weekdays:         zhWeekdays,
+		Greetings:        []string{"你好呀，有咩可以帮到你？"},
+		ExitWords:        []string{"拜拜", "再见", "退出", "退出对话"},
+		Texts: map[string]string{
+			TextActivationPrompt:    "请喺后台添加设备，激活码: %s",
+			TextGoodbye:             "好啊，拜拜！下次再倾～",
+			TextOpenClawEntered:     "已经入咗OpenClaw模式，请继续讲",
+			TextOpenClawExited:      "已经退出咗OpenClaw模式",
+			TextOpenClawUnavailable: "OpenClaw而家用唔到，请迟啲再试",
+			TextOpenClawFallback:    "OpenClaw而家用唔到，已经退出咗OpenClaw模式",
+			TextToolFiller:          "等我睇下先。",
+			TextToolConfirmAsk:      "准备执行「%s」，确定吗？",
+			TextToolConfirmCanceled: "好，已经取消咗。",
+		},
+	},
+	LanguageEn: {
+		DisplayName:      "English",
+		ReplyInstruction: "Always reply to the user in English, even though the instructions above are written in another language.",
+		DateTimeLabel:    "Current date and time",
+		Weekdays: map[time.Weekday]string{
+			time.Sunday:    "Sunday",
+			time.Monday:    "Monday",
+			time.Tuesday:   "Tuesday",
+			time.Wednesday: "Wednesday",
+			time.Thursday:  "Thursday",
+			time.Friday:    "Friday",
+			time.Saturday:  "Saturday",
+		},
+		Greetings:   []string{"Hi there, what can I do for you?"},
+		WakeupWords: []string{"hi esp"},
+		ExitWords:   []string{"goodbye", "bye bye", "stop the conversation"},
+		Texts: map[string]string{
+			TextActivationPrompt:    "Please add this device in the console. Activation code: %s",
+			TextGoodbye:             "Okay, goodbye! Talk to you next time.",
+			TextOpenClawEntered:     "OpenClaw mode is on, go ahead.",
+			TextOpenClawExited:      "OpenClaw mode is off.",
+			TextOpenClawUnavailable: "OpenClaw is unavailable right now, please try again later.",
+			TextOpenClawFallback:    "OpenClaw is unavailable right now, so I have left OpenClaw mode.",
+			TextToolFiller:          "One moment, let me check.",
+			TextToolConfirmAsk:      "I'm about to run \"%s\". Should I go ahead?",
+			TextToolConfirmCanceled: "Okay, I've cancelled it.",
+		},
+	},
+	LanguageJa: {
+		DisplayName:      "日本語",
+		ReplyInstruction: "上記の指示が他の言語で書かれていても、ユーザーには必ず日本語で返答してください。",
+		DateTimeLabel:    "現在の日時",
+		Weekdays: map[time.Weekday]string{
+			time.Sunday:    "日",
+			time.Monday:    "月",
+			time.Tuesday:   "火",
+			time.Wednesday: "水",
+			time.Thursday:  "木",
+			time.Friday:    "金",
+			time.Saturday:  "土",
+		},
+		Greetings: []string{"こんにちは、何かお手伝いできることはありますか？"},
+		ExitWords: []string{"さようなら", "バイバイ", "終了"},
+		Texts: map[string]string{
+			TextActivationPrompt:    "管理画面でデバイスを追加してください。アクティベーションコードは %s です",
+			TextGoodbye:             "はい、さようなら。またお話ししましょう。",
+			TextOpenClawEntered:     "OpenClawモードに入りました。どうぞお話しください。",
+			TextOpenClawExited:      "OpenClawモードを終了しました。",
+			TextOpenClawUnavailable: "OpenClawは現在利用できません。しばらくしてからもう一度お試しください。",
+			TextOpenClawFallback:    "OpenClawが利用できないため、OpenClawモードを終了しました。",
+			TextToolFiller:          "少々お待ちください、確認しますね。",
+			TextToolConfirmAsk:      "「%s」を実行します。よろしいですか？",
+			TextToolConfirmCanceled: "わかりました、キャンセルしました。",
+		},
+	},
+	LanguageKo: {
+		DisplayName:      "한국어",
+		ReplyInstruction: "위의 지시가 다른 언어로 작성되어 있더라도 사용자에게는 반드시 한국어로 답변하세요.",
+		DateTimeLabel:    "현재 날짜와 시간",
+		Weekdays: map[time.Weekday]string{
+			time.Sunday:    "일요일",
+			time.Monday:    "월요일",
+			time.Tuesday:   "화요일",
+			time.Wednesday: "수요일",
+			time.Thursday:  "목요일",
+			time.Friday:    "금요일",
+			time.Saturday:  "토요일",
+		},
+		Greetings: []string{"안녕하세요, 무엇을 도와드릴까요?"},
+		ExitWords: []string{"잘 가", "안녕히 계세요", "종료"},
+		Texts: map[string]string{
+			TextActivationPrompt:    "관리 콘솔에서 기기를 추가해 주세요. 활성화 코드는 %s 입니다",
+			TextGoodbye:             "네, 안녕히 계세요! 다음에 또 이야기해요.",
+			TextOpenClawEntered:     "OpenClaw 모드에 들어왔어요. 계속 말씀하세요.",
+			TextOpenClawExited:      "OpenClaw 모드를 종료했어요.",
+			TextOpenClawUnavailable: "지금은 OpenClaw를 사용할 수 없어요. 잠시 후 다시 시도해 주세요.",
+			TextOpenClawFallback:    "OpenClaw를 사용할 수 없어 OpenClaw 모드를 종료했어요.",
+			TextToolFiller:          "잠시만요, 확인해 볼게요.",
+			TextToolConfirmAsk:      "「%s」을(를) 실행할게요. 진행할까요?",
+			TextToolConfirmCanceled: "알겠어요, 취소했어요.",
+		},
+	},
+}
@@ -10,6 +10,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/llm/coze_llm"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/dify_llm"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/eino_llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock_llm"
 )
 
 // LLMExtraErrorKey 错误透传约定：ResponseWithContext 失败时在 Message.Extra 中使用的 key
@@ -95,6 +96,12 @@ func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProv
 			return nil, fmt.Errorf("创建Coze LLM提供者失败: %v", err)
 		}
 		return provider, nil
+	case constants.LlmTypeMock:
+		provider, err := mock_llm.NewMockLLMProvider(config)
+		if err != nil {
+			return nil, fmt.Errorf("创建Mock LLM提供者失败: %v", err)
+		}
+		return provider, nil
 	}
 	return nil, fmt.Errorf("不支持的LLM提供者: %s", llmType)
 }
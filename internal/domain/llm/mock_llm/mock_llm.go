@@ -0,0 +1,311 @@
+package mock_llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultReply     = "好的。"
+	defaultChunkSize = 4
+	llmExtraErrorKey = "error"
+)
+
+// Script 对话脚本，规则按顺序匹配，第一条命中的规则生效，都不命中时回复 Default
+//
+//	default: 我没听清，请再说一遍。
+//	rules:
+//	  - match: 几点                  # 最后一条用户消息包含该文本
+//	    tool_calls:
+//	      - name: get_current_datetime
+//	        arguments: {}
+//	  - after_tool: get_current_datetime   # 最后一条消息是该工具的调用结果
+//	    reply: "查到了：{tool_result}"
+//	  - regex: "^(再见|拜拜)"
+//	    reply: 再见！
+//	  - match: 出错
+//	    error: 模拟的模型错误
+type Script struct {
+	Default string `yaml:"default"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Rule 一条脚本规则，match/regex/after_tool 都为空时匹配任意用户消息
+// reply 中的 {input} 替换为用户消息，{tool_result} 替换为工具调用结果
+type Rule struct {
+	Match     string         `yaml:"match"`
+	Regex     string         `yaml:"regex"`
+	AfterTool string         `yaml:"after_tool"`
+	Reply     string         `yaml:"reply"`
+	ToolCalls []ToolCallSpec `yaml:"tool_calls"`
+	Error     string         `yaml:"error"`
+
+	pattern *regexp.Regexp
+}
+
+// ToolCallSpec 规则中的工具调用
+type ToolCallSpec struct {
+	Name      string                 `yaml:"name"`
+	Arguments map[string]interface{} `yaml:"arguments"`
+}
+
+// MockLLMProvider 按脚本返回回复和工具调用的 LLM，不访问任何外部服务，用于端到端测试和压测
+// 配置参数：script（YAML 脚本文件路径）、script_content（内联 YAML 脚本）、chunk_size（每个流式分片的字数）、
+// first_token_delay_ms（首个分片前的延迟）、chunk_delay_ms（分片间隔）
+type MockLLMProvider struct {
+	script          *Script
+	chunkSize       int
+	firstTokenDelay time.Duration
+	chunkDelay      time.Duration
+}
+
+// NewMockLLMProvider 创建 MockLLMProvider
+func NewMockLLMProvider(config map[string]interface{}) (*MockLLMProvider, error) {
+	var data []byte
+	if content, _ := config["script_content"].(string); strings.TrimSpace(content) != "" {
+		data = []byte(content)
+	} else if path, _ := config["script"].(string); strings.TrimSpace(path) != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取mock llm脚本失败: %w", err)
+		}
+	}
+	script, err := ParseScript(data)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := getInt(config, "chunk_size", defaultChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	return &MockLLMProvider{
+		script:          script,
+		chunkSize:       chunkSize,
+		firstTokenDelay: time.Duration(getInt(config, "first_token_delay_ms", 0)) * time.Millisecond,
+		chunkDelay:      time.Duration(getInt(config, "chunk_delay_ms", 0)) * time.Millisecond,
+	}, nil
+}
+
+// ParseScript 解析 YAML 脚本，data 为空时返回只有默认回复的脚本
+func ParseScript(data []byte) (*Script, error) {
+	script := &Script{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := yaml.Unmarshal(data, script); err != nil {
+			return nil, fmt.Errorf("解析mock llm脚本失败: %w", err)
+		}
+	}
+	if script.Default == "" {
+		script.Default = defaultReply
+	}
+	for i := range script.Rules {
+		rule := &script.Rules[i]
+		if rule.Regex == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("mock llm脚本第 %d 条规则正则无效: %w", i+1, err)
+		}
+		rule.pattern = pattern
+	}
+	return script, nil
+}
+
+func getInt(config map[string]interface{}, key string, defaultValue int) int {
+	switch value := config[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return defaultValue
+}
+
+// Respond 按脚本计算对话的下一条回复，不做流式切分
+func (s *Script) Respond(dialogue []*schema.Message) (*schema.Message, error) {
+	input, toolName, toolResult := lastTurn(dialogue)
+	for _, rule := range s.Rules {
+		if !rule.matches(input, toolName) {
+			continue
+		}
+		if rule.Error != "" {
+			return nil, errors.New(rule.Error)
+		}
+		msg := &schema.Message{
+			Role:    schema.Assistant,
+			Content: expand(rule.Reply, input, toolResult),
+		}
+		for i, call := range rule.ToolCalls {
+			arguments, err := json.Marshal(call.Arguments)
+			if err != nil {
+				return nil, fmt.Errorf("序列化工具 %s 参数失败: %w", call.Name, err)
+			}
+			if call.Arguments == nil {
+				arguments = []byte("{}")
+			}
+			index := i
+			msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+				Index: &index,
+				// 以对话长度生成 ID，相同对话得到相同的 ID
+				ID:   fmt.Sprintf("mock_call_%d_%d", len(dialogue), i),
+				Type: "function",
+				Function: schema.FunctionCall{
+					Name:      call.Name,
+					Arguments: string(arguments),
+				},
+			})
+		}
+		return msg, nil
+	}
+	if toolName != "" {
+		// 没有针对工具结果的规则时直接复述结果，避免再次命中同一条工具调用规则
+		return &schema.Message{Role: schema.Assistant, Content: toolResult}, nil
+	}
+	return &schema.Message{Role: schema.Assistant, Content: expand(s.Default, input, "")}, nil
+}
+
+func (r *Rule) matches(input, toolName string) bool {
+	if toolName != "" {
+		return r.AfterTool == toolName
+	}
+	if r.AfterTool != "" {
+		return false
+	}
+	if r.Match != "" && !strings.Contains(input, r.Match) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(input) {
+		return false
+	}
+	return true
+}
+
+func expand(reply, input, toolResult string) string {
+	return strings.NewReplacer("{input}", input, "{tool_result}", toolResult).Replace(reply)
+}
+
+// lastTurn 返回最后一条用户消息；若对话以工具结果结尾，同时返回对应的工具名和结果
+func lastTurn(dialogue []*schema.Message) (input, toolName, toolResult string) {
+	for i := len(dialogue) - 1; i >= 0; i-- {
+		if msg := dialogue[i]; msg != nil && msg.Role == schema.User {
+			input = strings.TrimSpace(msg.Content)
+			break
+		}
+	}
+	if len(dialogue) == 0 {
+		return
+	}
+	last := dialogue[len(dialogue)-1]
+	if last == nil || last.Role != schema.Tool {
+		return
+	}
+	toolResult = last.Content
+	// 找不到对应的调用时以调用 ID 代替工具名，仍按工具结果处理
+	toolName = last.ToolCallID
+	for i := len(dialogue) - 2; i >= 0; i-- {
+		msg := dialogue[i]
+		if msg == nil || msg.Role != schema.Assistant {
+			continue
+		}
+		for _, call := range msg.ToolCalls {
+			if call.ID == last.ToolCallID {
+				return input, call.Function.Name, toolResult
+			}
+		}
+	}
+	return
+}
+
+func (p *MockLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, _ []*schema.ToolInfo) chan *schema.Message {
+	out := make(chan *schema.Message, 200)
+
+	go func() {
+		defer close(out)
+
+		reply, err := p.script.Respond(dialogue)
+		if err != nil {
+			sendLLMError(out, err)
+			return
+		}
+		if !sleep(ctx, p.firstTokenDelay) {
+			return
+		}
+
+		runes := []rune(reply.Content)
+		for start := 0; start < len(runes); start += p.chunkSize {
+			if start > 0 && !sleep(ctx, p.chunkDelay) {
+				return
+			}
+			end := min(start+p.chunkSize, len(runes))
+			select {
+			case <-ctx.Done():
+				return
+			case out <- &schema.Message{Role: schema.Assistant, Content: string(runes[start:end])}:
+			}
+		}
+		if len(reply.ToolCalls) > 0 {
+			select {
+			case <-ctx.Done():
+			case out <- &schema.Message{Role: schema.Assistant, ToolCalls: reply.ToolCalls}:
+			}
+		}
+	}()
+
+	return out
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (p *MockLLMProvider) ResponseWithVllm(_ context.Context, _ []byte, text string, _ string) (string, error) {
+	reply, err := p.script.Respond([]*schema.Message{schema.UserMessage(text)})
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
+
+func (p *MockLLMProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "mock",
+		"provider": "mock",
+		"rules":    len(p.script.Rules),
+	}
+}
+
+func (p *MockLLMProvider) Close() error {
+	return nil
+}
+
+func (p *MockLLMProvider) IsValid() bool {
+	return p != nil && p.script != nil
+}
+
+func sendLLMError(ch chan *schema.Message, err error) {
+	ch <- &schema.Message{
+		Role:  schema.System,
+		Extra: map[string]any{llmExtraErrorKey: err.Error()},
+	}
+}
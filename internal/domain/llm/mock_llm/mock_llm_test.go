@@ -0,0 +1,104 @@
+package mock_llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScript = `
+default: 没听懂：{input}
+rules:
+  - match: 几点
+    reply: 我查一下。
+    tool_calls:
+      - name: get_current_datetime
+  - after_tool: get_current_datetime
+    reply: "现在是 {tool_result}"
+  - regex: "^(再见|拜拜)"
+    reply: 再见！
+  - match: 出错
+    error: 模拟的模型错误
+`
+
+func TestScriptRespond(t *testing.T) {
+	script, err := ParseScript([]byte(testScript))
+	require.NoError(t, err)
+
+	reply, err := script.Respond([]*schema.Message{schema.UserMessage("拜拜啦")})
+	require.NoError(t, err)
+	assert.Equal(t, "再见！", reply.Content)
+
+	reply, err = script.Respond([]*schema.Message{schema.UserMessage("随便说说")})
+	require.NoError(t, err)
+	assert.Equal(t, "没听懂：随便说说", reply.Content)
+
+	_, err = script.Respond([]*schema.Message{schema.UserMessage("让它出错")})
+	assert.EqualError(t, err, "模拟的模型错误")
+}
+
+func TestScriptToolCall(t *testing.T) {
+	script, err := ParseScript([]byte(testScript))
+	require.NoError(t, err)
+
+	dialogue := []*schema.Message{schema.UserMessage("现在几点了")}
+	reply, err := script.Respond(dialogue)
+	require.NoError(t, err)
+	assert.Equal(t, "我查一下。", reply.Content)
+	require.Len(t, reply.ToolCalls, 1)
+	call := reply.ToolCalls[0]
+	assert.Equal(t, "get_current_datetime", call.Function.Name)
+	assert.Equal(t, "{}", call.Function.Arguments)
+	assert.Equal(t, "mock_call_1_0", call.ID)
+
+	dialogue = append(dialogue, reply, schema.ToolMessage("12:00", call.ID))
+	reply, err = script.Respond(dialogue)
+	require.NoError(t, err)
+	assert.Equal(t, "现在是 12:00", reply.Content)
+	assert.Empty(t, reply.ToolCalls)
+}
+
+func TestScriptDefault(t *testing.T) {
+	script, err := ParseScript(nil)
+	require.NoError(t, err)
+	reply, err := script.Respond([]*schema.Message{schema.UserMessage("你好")})
+	require.NoError(t, err)
+	assert.Equal(t, defaultReply, reply.Content)
+
+	_, err = ParseScript([]byte("rules:\n  - regex: \"(\"\n"))
+	assert.Error(t, err)
+}
+
+func TestResponseWithContextStreams(t *testing.T) {
+	provider, err := NewMockLLMProvider(map[string]interface{}{
+		"script_content": testScript,
+		"chunk_size":     2,
+	})
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var toolCalls []schema.ToolCall
+	chunks := 0
+	for msg := range provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("几点了")}, nil) {
+		if msg.Content != "" {
+			chunks++
+			content.WriteString(msg.Content)
+		}
+		toolCalls = append(toolCalls, msg.ToolCalls...)
+	}
+	assert.Equal(t, "我查一下。", content.String())
+	assert.Equal(t, 3, chunks)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "get_current_datetime", toolCalls[0].Function.Name)
+
+	var errMsg *schema.Message
+	for msg := range provider.ResponseWithContext(context.Background(), "s1", []*schema.Message{schema.UserMessage("出错")}, nil) {
+		errMsg = msg
+	}
+	require.NotNil(t, errMsg)
+	assert.Equal(t, "模拟的模型错误", errMsg.Extra[llmExtraErrorKey])
+}
@@ -3,6 +3,8 @@ package mcp
 import (
 	"fmt"
 	"net/url"
+	"os/exec"
+	"path/filepath"
 	"strings"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -61,6 +63,12 @@ func CheckMCPConfig() {
 			status = "❌"
 			issues = append(issues, err.Error())
 			problemCount++
+		} else if transportType == "stdio" {
+			if _, lookErr := exec.LookPath(stdioCommandPath(config)); lookErr != nil {
+				status = "❌"
+				issues = append(issues, "启动命令不存在或不可执行")
+				problemCount++
+			}
 		} else {
 			if _, parseErr := url.ParseRequestURI(endpoint); parseErr != nil {
 				status = "❌"
@@ -108,3 +116,12 @@ func endpointForLog(config MCPServerConfig) string {
 	}
 	return endpoint
 }
+
+// stdioCommandPath 带路径的相对命令按 work_dir 解析，与子进程启动时一致
+func stdioCommandPath(config MCPServerConfig) string {
+	command := strings.TrimSpace(config.Command)
+	if config.WorkDir != "" && !filepath.IsAbs(command) && strings.ContainsRune(command, filepath.Separator) {
+		return filepath.Join(config.WorkDir, command)
+	}
+	return command
+}
@@ -274,7 +274,9 @@ func (dc *McpClientInstance) handleJSONRPCNotification(notification mcp.JSONRPCN
 	case "notifications/message":
 		//handleMessageNotification(notification)
 	case "notifications/resources/updated":
-		//handleResourceUpdateNotification(notification)
+		if e, ok := dc.endpoint(""); ok {
+			e.onResourceUpdated(notification)
+		}
 	case "notifications/tools/updated":
 		// 收到工具更新通知，刷新工具列表
 		logger.Infof("收到工具更新通知，刷新工具列表")
@@ -303,6 +305,7 @@ func (dc *McpClientInstance) handleTransportClose(reason string) {
 
 	// 标记连接已断开
 	dc.connected = false
+	resourceContentCache.dropPrefix(dc.serverName)
 
 	// 取消上下文
 	dc.cancel()
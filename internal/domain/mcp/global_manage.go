@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -17,6 +18,7 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/spf13/viper"
 
+	"xiaozhi-esp32-server-golang/internal/domain/mcp/stdio"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -31,6 +33,15 @@ type MCPServerConfig struct {
 	ServiceID string            `json:"service_id,omitempty" mapstructure:"service_id"`
 	AuthRef   string            `json:"auth_ref,omitempty" mapstructure:"auth_ref"`
 	Headers   map[string]string `json:"headers,omitempty" mapstructure:"headers"`
+	// Auth 为 oauth 时按智能体使用各自在控制台授权得到的访问令牌连接，见 oauth.go
+	Auth string `json:"auth,omitempty" mapstructure:"auth"`
+
+	// stdio 类型：由服务端以子进程方式启动
+	Command string            `json:"command,omitempty" mapstructure:"command"`
+	Args    []string          `json:"args,omitempty" mapstructure:"args"`
+	Env     map[string]string `json:"env,omitempty" mapstructure:"env"`
+	WorkDir string            `json:"work_dir,omitempty" mapstructure:"work_dir"`
+	Limits  stdio.Limits      `json:"limits,omitempty" mapstructure:"limits"`
 }
 
 // GlobalMCPManager 全局MCP管理器
@@ -42,6 +53,10 @@ type GlobalMCPManager struct {
 	cancel        context.CancelFunc
 	reconnectConf ReconnectConfig
 	httpClient    *http.Client
+
+	// 需要 OAuth 授权的服务器不建立全局连接，按智能体懒连接，键为 oauthKey(agentID, server)
+	oauthServers map[string]MCPServerConfig
+	agentServers map[string]*MCPServerConnection
 }
 
 // ReconnectConfig 重连配置
@@ -60,6 +75,18 @@ type MCPServerConnection struct {
 	lastError  error
 	retryCount int
 	lastPing   time.Time
+
+	agentID     string    // 非空表示使用该智能体 OAuth 令牌的连接，工具不进入全局列表
+	lastAttempt time.Time // 智能体连接最近一次尝试连接的时间，用于失败后的重试间隔
+
+	capabilities mcp.ServerCapabilities // 初始化时服务器声明的能力，决定是否查询资源/提示词
+
+	// stdio 类型的子进程及异常退出后的连续重启次数
+	process  *stdio.Process
+	restarts int
+
+	reconnectMu sync.Mutex   // 串行化重连，避免 ping 检测、工具调用与进程监督同时重连
+	generation  atomic.Int64 // 每次连接成功加一
 }
 
 var (
@@ -67,15 +94,20 @@ var (
 	once          sync.Once
 )
 
+// stdioInitializeTimeout stdio 子进程完成 MCP 握手的超时，npx/uvx 首次运行需要下载依赖
+const stdioInitializeTimeout = 60 * time.Second
+
 // GetGlobalMCPManager 获取全局MCP管理器单例
 func GetGlobalMCPManager() *GlobalMCPManager {
 	once.Do(func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		globalManager = &GlobalMCPManager{
-			servers: make(map[string]*MCPServerConnection),
-			tools:   make(map[string]tool.InvokableTool),
-			ctx:     ctx,
-			cancel:  cancel,
+			servers:      make(map[string]*MCPServerConnection),
+			tools:        make(map[string]tool.InvokableTool),
+			oauthServers: make(map[string]MCPServerConfig),
+			agentServers: make(map[string]*MCPServerConnection),
+			ctx:          ctx,
+			cancel:       cancel,
 			reconnectConf: ReconnectConfig{
 				Interval:    time.Duration(viper.GetInt("mcp.global.reconnect_interval")) * time.Second,
 				MaxAttempts: viper.GetInt("mcp.global.max_reconnect_attempts"),
@@ -117,13 +149,17 @@ func (g *GlobalMCPManager) Start() error {
 
 	// 详细记录每个服务器配置
 	for i, config := range serverConfigs {
-		log.Infof("MCP服务器[%d]: Type=%s, Name=%s, Url=%s, SSEUrl=%s, Enabled=%v",
-			i+1, config.Type, config.Name, config.Url, config.SSEUrl, config.Enabled)
+		log.Infof("MCP服务器[%d]: Type=%s, Name=%s, Endpoint=%s, Enabled=%v",
+			i+1, config.Type, config.Name, endpointForLog(config), config.Enabled)
 	}
 
 	// 连接启用的服务器
 	connectedCount := 0
 	for _, config := range serverConfigs {
+		if config.Enabled && isOAuthServer(config) {
+			g.registerOAuthServer(config)
+			continue
+		}
 		if config.Enabled {
 			if err := g.connectToServer(config); err != nil {
 				log.Errorf("连接到MCP服务器 %s 失败: %v", config.Name, err)
@@ -151,14 +187,32 @@ func (g *GlobalMCPManager) Stop() error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	// stdio 子进程的优雅停止需要等待，并行断开
+	var wg sync.WaitGroup
 	for name, conn := range g.servers {
-		if err := conn.disconnect(); err != nil {
-			log.Errorf("断开MCP服务器 %s 连接失败: %v", name, err)
-		}
+		wg.Add(1)
+		go func(name string, conn *MCPServerConnection) {
+			defer wg.Done()
+			if err := conn.disconnect(); err != nil {
+				log.Errorf("断开MCP服务器 %s 连接失败: %v", name, err)
+			}
+		}(name, conn)
+	}
+	for key, conn := range g.agentServers {
+		wg.Add(1)
+		go func(key string, conn *MCPServerConnection) {
+			defer wg.Done()
+			if err := conn.disconnect(); err != nil {
+				log.Errorf("断开MCP服务器 %s 连接失败: %v", key, err)
+			}
+		}(key, conn)
 	}
+	wg.Wait()
 
 	g.servers = make(map[string]*MCPServerConnection)
 	g.tools = make(map[string]tool.InvokableTool)
+	g.oauthServers = make(map[string]MCPServerConfig)
+	g.agentServers = make(map[string]*MCPServerConnection)
 
 	log.Info("全局MCP管理器已停止")
 	return nil
@@ -222,10 +276,19 @@ func (conn *MCPServerConnection) connect() error {
 	// 使用背景上下文，不设置超时，让SSE连接长期保持
 	ctx := context.Background()
 
-	transportInstance, endpoint, err := buildMCPTransport(conn.config)
+	transportInstance, endpoint, process, err := buildMCPTransport(conn.config, conn.agentID)
 	if err != nil {
 		return err
 	}
+	connected := false
+	if process != nil {
+		defer func() {
+			// 握手失败时结束刚启动的进程，由调用方决定是否重试
+			if !connected {
+				process.Stop(stdio.DefaultStopGrace)
+			}
+		}()
+	}
 
 	// 使用 client.NewClient 创建 MCP 客户端
 	mcpClient := client.NewClient(transportInstance)
@@ -257,13 +320,24 @@ func (conn *MCPServerConnection) connect() error {
 	}
 
 	log.Infof("正在初始化MCP服务器: %s", conn.config.Name)
-	initResult, err := conn.client.Initialize(ctx, initRequest)
+	initCtx := ctx
+	if process != nil {
+		// 子进程未按 MCP 协议输出时不会返回，需要超时
+		var cancel context.CancelFunc
+		initCtx, cancel = context.WithTimeout(ctx, stdioInitializeTimeout)
+		defer cancel()
+	}
+	initResult, err := conn.client.Initialize(initCtx, initRequest)
 	if err != nil {
 		log.Errorf("初始化MCP服务器失败，服务器: %s, 错误: %v", conn.config.Name, err)
 		return fmt.Errorf("初始化失败: %v", err)
 	}
 
 	log.Infof("MCP服务器初始化成功: %s, 结果: %+v", conn.config.Name, initResult)
+	conn.mu.Lock()
+	conn.capabilities = initResult.Capabilities
+	conn.mu.Unlock()
+	mcpClient.OnNotification(conn.handleNotification)
 
 	// 获取工具列表
 	if err := conn.refreshTools(ctx); err != nil {
@@ -275,7 +349,14 @@ func (conn *MCPServerConnection) connect() error {
 	conn.connected = true
 	conn.lastError = nil
 	conn.retryCount = 0
+	conn.process = process
 	conn.mu.Unlock()
+	conn.generation.Add(1)
+	connected = true
+
+	if process != nil {
+		go GetGlobalMCPManager().superviseStdio(conn, process)
+	}
 
 	log.Infof("MCP服务器连接建立完成: %s", conn.config.Name)
 	return nil
@@ -287,6 +368,8 @@ func normalizeMCPTransportType(t string) string {
 		return "sse"
 	case "streamable_http", "streamable-http", "http":
 		return "streamablehttp"
+	case "stdio", "command":
+		return "stdio"
 	default:
 		return strings.ToLower(strings.TrimSpace(t))
 	}
@@ -295,7 +378,9 @@ func normalizeMCPTransportType(t string) string {
 func endpointForConfig(config MCPServerConfig) (string, string, error) {
 	transportType := normalizeMCPTransportType(config.Type)
 	if transportType == "" {
-		if strings.TrimSpace(config.SSEUrl) != "" {
+		if strings.TrimSpace(config.Command) != "" {
+			transportType = "stdio"
+		} else if strings.TrimSpace(config.SSEUrl) != "" {
 			transportType = "sse"
 		} else if strings.TrimSpace(config.Url) != "" {
 			transportType = "streamablehttp"
@@ -319,15 +404,36 @@ func endpointForConfig(config MCPServerConfig) (string, string, error) {
 			return transportType, strings.TrimSpace(config.SSEUrl), nil
 		}
 		return "", "", fmt.Errorf("MCP服务器 %s 缺少StreamableHTTP URL", config.Name)
+	case "stdio":
+		if strings.TrimSpace(config.Command) == "" {
+			return "", "", fmt.Errorf("MCP服务器 %s 缺少启动命令", config.Name)
+		}
+		return transportType, stdio.CommandLine(strings.TrimSpace(config.Command), config.Args), nil
 	default:
 		return "", "", fmt.Errorf("MCP服务器 %s 类型不支持: %s", config.Name, config.Type)
 	}
 }
 
-func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, error) {
+// buildMCPTransport 创建传输层，stdio 类型会启动子进程并一并返回，调用方负责停止；
+// agentID 非空且服务器需要 OAuth 时，每个请求携带该智能体当前的访问令牌
+func buildMCPTransport(config MCPServerConfig, agentID string) (transport.Interface, string, *stdio.Process, error) {
 	transportType, endpoint, err := endpointForConfig(config)
 	if err != nil {
-		return nil, "", err
+		return nil, "", nil, err
+	}
+	if transportType == "stdio" {
+		process, err := stdio.Start(stdio.Config{
+			Name:    config.Name,
+			Command: config.Command,
+			Args:    config.Args,
+			Env:     config.Env,
+			WorkDir: config.WorkDir,
+			Limits:  config.Limits,
+		})
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return process.Transport(), endpoint, process, nil
 	}
 
 	headers := make(map[string]string)
@@ -337,6 +443,10 @@ func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, err
 		}
 		headers[strings.TrimSpace(k)] = v
 	}
+	var headerFunc transport.HTTPHeaderFunc
+	if agentID != "" && isOAuthServer(config) {
+		headerFunc = oauthHeaderFunc(agentID, config.Name)
+	}
 
 	switch transportType {
 	case "sse":
@@ -344,23 +454,29 @@ func buildMCPTransport(config MCPServerConfig) (transport.Interface, string, err
 		if len(headers) > 0 {
 			opts = append(opts, transport.WithHeaders(headers))
 		}
+		if headerFunc != nil {
+			opts = append(opts, transport.WithHeaderFunc(headerFunc))
+		}
 		sseTransport, err := transport.NewSSE(endpoint, opts...)
 		if err != nil {
-			return nil, "", fmt.Errorf("创建SSE传输层失败: %v", err)
+			return nil, "", nil, fmt.Errorf("创建SSE传输层失败: %v", err)
 		}
-		return sseTransport, endpoint, nil
+		return sseTransport, endpoint, nil, nil
 	case "streamablehttp":
 		opts := make([]transport.StreamableHTTPCOption, 0)
 		if len(headers) > 0 {
 			opts = append(opts, transport.WithHTTPHeaders(headers))
 		}
+		if headerFunc != nil {
+			opts = append(opts, transport.WithHTTPHeaderFunc(headerFunc))
+		}
 		httpTransport, err := transport.NewStreamableHTTP(endpoint, opts...)
 		if err != nil {
-			return nil, "", fmt.Errorf("创建StreamableHTTP传输层失败: %v", err)
+			return nil, "", nil, fmt.Errorf("创建StreamableHTTP传输层失败: %v", err)
 		}
-		return httpTransport, endpoint, nil
+		return httpTransport, endpoint, nil, nil
 	default:
-		return nil, "", fmt.Errorf("不支持的MCP传输类型: %s", transportType)
+		return nil, "", nil, fmt.Errorf("不支持的MCP传输类型: %s", transportType)
 	}
 }
 
@@ -378,6 +494,17 @@ func (conn *MCPServerConnection) refreshTools(ctx context.Context) error {
 
 	conn.tools = ConvertMcpToolListToInvokableToolList(toolsResult.Tools, conn.config.Name, conn.client)
 
+	if conn.agentID != "" {
+		// 智能体连接的工具只对该智能体可见
+		for _, t := range conn.tools {
+			if mt, ok := t.(*McpTool); ok {
+				mt.agentID = conn.agentID
+			}
+		}
+		log.Infof("MCP服务器 %s（智能体 %s）工具列表已更新，共 %d 个工具", conn.config.Name, conn.agentID, len(conn.tools))
+		return nil
+	}
+
 	// 更新全局工具列表
 	globalManager.updateGlobalTools(conn.config.Name, conn.tools)
 
@@ -415,11 +542,9 @@ func ConvertMcpToolListToInvokableToolList(tools []mcp.Tool, serverName string,
 	return invokeTools
 }
 
-// disconnect 断开连接
+// disconnect 断开连接，stdio 类型同时停止子进程
 func (conn *MCPServerConnection) disconnect() error {
 	conn.mu.Lock()
-	defer conn.mu.Unlock()
-
 	if conn.client != nil {
 		// 关闭客户端
 		if err := conn.client.Close(); err != nil {
@@ -430,10 +555,38 @@ func (conn *MCPServerConnection) disconnect() error {
 
 	conn.connected = false
 	conn.tools = make(map[string]tool.InvokableTool)
+	process := conn.process
+	conn.process = nil
+	conn.mu.Unlock()
+	resourceContentCache.dropPrefix(conn.cacheKey())
 
+	// 等待子进程退出可能耗时数秒，不持有锁
+	if process != nil {
+		if err := process.Stop(stdio.DefaultStopGrace); err != nil {
+			return fmt.Errorf("停止MCP服务器 %s 进程失败: %v", conn.config.Name, err)
+		}
+		log.Infof("MCP服务器 %s 进程已停止", conn.config.Name)
+	}
 	return nil
 }
 
+// handleNotification 处理服务器推送：资源变更刷新缓存，工具列表变更重新拉取
+func (conn *MCPServerConnection) handleNotification(notification mcp.JSONRPCNotification) {
+	switch notification.Method {
+	case string(mcp.MethodNotificationResourceUpdated):
+		if e, ok := conn.endpoint(); ok {
+			e.onResourceUpdated(notification)
+		}
+	case string(mcp.MethodNotificationToolsListChanged):
+		log.Infof("MCP服务器 %s 工具列表已变更，重新获取", conn.config.Name)
+		go func() {
+			if err := conn.refreshTools(context.Background()); err != nil {
+				log.Errorf("刷新MCP服务器 %s 工具列表失败: %v", conn.config.Name, err)
+			}
+		}()
+	}
+}
+
 // updateGlobalTools 更新全局工具列表
 func (g *GlobalMCPManager) updateGlobalTools(serverName string, tools map[string]tool.InvokableTool) {
 	g.mu.Lock()
@@ -511,8 +664,15 @@ func (g *GlobalMCPManager) monitorConnections() {
 						conn.mu.Lock()
 						conn.connected = false
 						conn.lastError = err
+						process := conn.process
 						conn.mu.Unlock()
 
+						if process != nil {
+							// stdio 进程无响应：结束进程，由 superviseStdio 按退避重启
+							go process.Terminate(stdio.DefaultStopGrace)
+							return
+						}
+
 						// 直接触发重连
 						go g.reconnectServer(name)
 					} else {
@@ -520,6 +680,9 @@ func (g *GlobalMCPManager) monitorConnections() {
 					}
 				}(name, conn)
 			}
+			for _, conn := range g.agentServers {
+				go g.pingAgentConnection(conn)
+			}
 			g.mu.RUnlock()
 		}
 	}
@@ -540,6 +703,23 @@ func (g *GlobalMCPManager) reconnectServer(serverName string) (*client.Client, e
 	if conn == nil {
 		return nil, fmt.Errorf("未找到服务器连接: %s", serverName)
 	}
+	return g.reconnect(conn)
+}
+
+// reconnect 断开并重建连接，并发调用时只重连一次
+func (g *GlobalMCPManager) reconnect(conn *MCPServerConnection) (*client.Client, error) {
+	generation := conn.generation.Load()
+	conn.reconnectMu.Lock()
+	defer conn.reconnectMu.Unlock()
+	// 等锁期间其他调用方已完成重连，直接复用
+	if conn.generation.Load() != generation {
+		conn.mu.RLock()
+		client, connected := conn.client, conn.connected
+		conn.mu.RUnlock()
+		if connected && client != nil {
+			return client, nil
+		}
+	}
 
 	// 断开连接
 	if err := conn.disconnect(); err != nil {
@@ -575,3 +755,53 @@ func (conn *MCPServerConnection) ping(ctx context.Context) error {
 
 	return nil
 }
+
+// superviseStdio 监督 stdio 子进程：主动停止（断开、热更）时退出；异常退出时按退避重启，
+// 进程稳定运行超过 stdio.StableRun 后退避计数清零
+func (g *GlobalMCPManager) superviseStdio(conn *MCPServerConnection, process *stdio.Process) {
+	ctx := g.ctx
+	<-process.Done()
+	if process.Stopped() {
+		return
+	}
+	name := conn.config.Name
+	ranFor := time.Since(process.StartedAt()).Round(time.Second)
+
+	conn.mu.Lock()
+	conn.connected = false
+	conn.lastError = fmt.Errorf("进程异常退出: %v", process.Err())
+	if ranFor >= stdio.StableRun {
+		conn.restarts = 0
+	}
+	conn.mu.Unlock()
+
+	for {
+		conn.mu.Lock()
+		delay := stdio.Backoff(conn.restarts)
+		conn.restarts++
+		conn.mu.Unlock()
+
+		log.Warnf("MCP服务器 %s 进程异常退出（运行 %s）: %v，%s 后重启", name, ranFor, process.Err(), delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if !g.isCurrentConnection(conn) {
+			return
+		}
+		// 重连成功后新进程由新的 superviseStdio 接管
+		if _, err := g.reconnectServer(name); err != nil {
+			log.Errorf("重启MCP服务器 %s 失败: %v", name, err)
+			continue
+		}
+		return
+	}
+}
+
+// isCurrentConnection 连接是否仍在使用（热更后旧连接会被替换）
+func (g *GlobalMCPManager) isCurrentConnection(conn *MCPServerConnection) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.servers[conn.config.Name] == conn
+}
@@ -91,6 +91,11 @@ func GetToolByName(deviceId string, agentId string, toolName string, selectedMCP
 		}
 	}
 
+	// 智能体 OAuth 授权的服务器
+	if invokable, exists := findAgentTool(agentId, toolName, selected); exists {
+		return invokable, true
+	}
+
 	// 最后从设备MCP客户端池获取
 	tool, ok = mcpClientPool.GetToolByDeviceId(deviceId, toolName)
 	if ok {
@@ -106,6 +111,23 @@ func GetToolByName(deviceId string, agentId string, toolName string, selectedMCP
 	return nil, false
 }
 
+// findAgentTool 在智能体 OAuth 连接的工具中查找，兼容 "server_tool" 与原始工具名
+func findAgentTool(agentId, toolName string, selected map[string]struct{}) (tool.InvokableTool, bool) {
+	if agentId == "" {
+		return nil, false
+	}
+	agentTools := globalManager.GetAgentTools(agentId)
+	if invokable, exists := agentTools[toolName]; exists && isGlobalToolAllowed(toolName, selected) {
+		return invokable, true
+	}
+	for key, invokable := range agentTools {
+		if mt, ok := invokable.(*McpTool); ok && mt.info.Name == toolName && isGlobalToolAllowed(key, selected) {
+			return invokable, true
+		}
+	}
+	return nil, false
+}
+
 func GetDeviceMcpClient(deviceId string) *DeviceMcpSession {
 	return mcpClientPool.GetMcpClient(deviceId)
 }
@@ -142,6 +164,17 @@ func GetToolsByDeviceId(deviceId string, agentId string, selectedMCPServiceNames
 	}
 	log.Infof("从全局管理器获取到 %d 个工具（过滤后）", len(filteredGlobalTools))
 
+	// 智能体 OAuth 授权的服务器，与全局服务器一样按已选服务过滤
+	agentTools := filterGlobalToolsBySelectedServices(globalManager.GetAgentTools(agentId), selectedMCPServiceNames)
+	for toolName, tool := range agentTools {
+		if _, exists := retTools[toolName]; !exists {
+			retTools[toolName] = tool
+		}
+	}
+	if len(agentTools) > 0 {
+		log.Infof("从智能体 %s 的OAuth授权服务器获取到 %d 个工具", agentId, len(agentTools))
+	}
+
 	// 最后从MCP客户端池获取
 	deviceTools, err := mcpClientPool.GetAllToolsByDeviceIdAndAgentId(deviceId, agentId)
 	if err != nil {
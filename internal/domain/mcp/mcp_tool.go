@@ -20,6 +20,7 @@ type McpTool struct {
 	info       *schema.ToolInfo
 	serverName string
 	client     *client.Client
+	agentID    string // 智能体 OAuth 连接上的工具，重连时需定位到该智能体的连接
 
 	// 本地工具支持
 	isLocal      bool
@@ -90,7 +91,12 @@ func (t *McpTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts
 		log.Warnf("工具 %s 调用失败(session closed): %v，尝试重连后重试", t.info.Name, err)
 
 		// 重连并获取新的client
-		newClient, err := GetGlobalMCPManager().reconnectServer(t.serverName)
+		var newClient *client.Client
+		if t.agentID != "" {
+			newClient, err = GetGlobalMCPManager().reconnectAgentServer(t.agentID, t.serverName)
+		} else {
+			newClient, err = GetGlobalMCPManager().reconnectServer(t.serverName)
+		}
 		if err != nil {
 			return retContent, fmt.Errorf("重连服务器失败: %v", err)
 		}
@@ -118,3 +124,13 @@ func (t *McpTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts
 func (t *McpTool) GetClient() *client.Client {
 	return t.client
 }
+
+// ServerName 工具所属的 MCP 服务名，本地工具为空
+func (t *McpTool) ServerName() string {
+	return t.serverName
+}
+
+// IsLocal 是否为进程内的本地工具
+func (t *McpTool) IsLocal() bool {
+	return t.isLocal
+}
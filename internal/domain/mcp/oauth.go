@@ -0,0 +1,340 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// AuthOAuth 服务器配置 auth 取值：需要 OAuth 授权的远程 MCP 服务器（GitHub、Notion 等）。
+// 授权流程与令牌刷新由 manager 完成，主程序只按智能体持有访问令牌并建立各自的连接，
+// 不同用户的智能体使用各自的账号
+const AuthOAuth = "oauth"
+
+// OAuthToken 智能体访问某个 MCP 服务器的令牌
+type OAuthToken struct {
+	AccessToken string
+	ExpiresAt   time.Time // 零值表示未声明过期时间
+}
+
+// OAuthTokenFetcher 本地没有可用令牌时向 manager 获取，由配置模块注册
+type OAuthTokenFetcher func(ctx context.Context, agentID, server string) (OAuthToken, error)
+
+const (
+	// oauthTokenRefreshSkew 令牌剩余有效期不足该值时视为过期，重新获取
+	oauthTokenRefreshSkew = 30 * time.Second
+	// oauthTokenFetchTimeout 向 manager 获取令牌的超时
+	oauthTokenFetchTimeout = 5 * time.Second
+	// agentConnectRetryInterval 智能体连接未授权或失败后，间隔该时间才再次尝试
+	agentConnectRetryInterval = time.Minute
+)
+
+var oauthTokens = struct {
+	sync.RWMutex
+	tokens  map[string]OAuthToken
+	fetcher OAuthTokenFetcher
+}{tokens: make(map[string]OAuthToken)}
+
+func oauthKey(agentID, server string) string {
+	return agentID + "|" + server
+}
+
+func isOAuthServer(config MCPServerConfig) bool {
+	return strings.EqualFold(strings.TrimSpace(config.Auth), AuthOAuth)
+}
+
+func (t OAuthToken) usable() bool {
+	return t.AccessToken != "" && (t.ExpiresAt.IsZero() || time.Until(t.ExpiresAt) > oauthTokenRefreshSkew)
+}
+
+// SetOAuthTokenFetcher 注册令牌获取函数
+func SetOAuthTokenFetcher(fetcher OAuthTokenFetcher) {
+	oauthTokens.Lock()
+	oauthTokens.fetcher = fetcher
+	oauthTokens.Unlock()
+}
+
+// SetOAuthToken 更新智能体的访问令牌（manager 授权完成或刷新后推送）。
+// 传输层每个请求都读取最新令牌，已建立的连接无需重建；令牌为空表示撤销授权，断开该智能体的连接
+func SetOAuthToken(agentID, server string, token OAuthToken) {
+	key := oauthKey(agentID, server)
+	oauthTokens.Lock()
+	if token.AccessToken == "" {
+		delete(oauthTokens.tokens, key)
+	} else {
+		oauthTokens.tokens[key] = token
+	}
+	oauthTokens.Unlock()
+
+	GetGlobalMCPManager().onOAuthTokenChanged(agentID, server, token.AccessToken != "")
+}
+
+// oauthAccessToken 返回可用的访问令牌，本地缓存过期时向 manager 获取
+func oauthAccessToken(ctx context.Context, agentID, server string) (string, error) {
+	key := oauthKey(agentID, server)
+	oauthTokens.RLock()
+	token, fetcher := oauthTokens.tokens[key], oauthTokens.fetcher
+	oauthTokens.RUnlock()
+	if token.usable() {
+		return token.AccessToken, nil
+	}
+	if fetcher == nil {
+		return "", fmt.Errorf("MCP服务器 %s 需要OAuth授权，但未配置令牌来源", server)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oauthTokenFetchTimeout)
+	defer cancel()
+	fetched, err := fetcher(ctx, agentID, server)
+	if err != nil {
+		return "", fmt.Errorf("获取智能体 %s 的MCP服务器 %s 访问令牌失败: %v", agentID, server, err)
+	}
+	if fetched.AccessToken == "" {
+		return "", fmt.Errorf("智能体 %s 未授权MCP服务器 %s", agentID, server)
+	}
+	oauthTokens.Lock()
+	oauthTokens.tokens[key] = fetched
+	oauthTokens.Unlock()
+	return fetched.AccessToken, nil
+}
+
+// oauthHeaderFunc 每个请求携带智能体当前的访问令牌，令牌刷新后自动使用新令牌
+func oauthHeaderFunc(agentID, server string) transport.HTTPHeaderFunc {
+	return func(ctx context.Context) map[string]string {
+		accessToken, err := oauthAccessToken(ctx, agentID, server)
+		if err != nil {
+			log.Warnf("%v", err)
+			return nil
+		}
+		return map[string]string{"Authorization": "Bearer " + accessToken}
+	}
+}
+
+// agentConnectWait 对话时等待智能体连接建立的最长时间，超时的连接在后台继续
+func agentConnectWait() time.Duration {
+	if d := viper.GetDuration("mcp.oauth.connect_wait"); d > 0 {
+		return d
+	}
+	return 3 * time.Second
+}
+
+func (conn *MCPServerConnection) cacheKey() string {
+	if conn.agentID != "" {
+		return "global:" + conn.config.Name + "@" + conn.agentID
+	}
+	return "global:" + conn.config.Name
+}
+
+// registerOAuthServer 记录需要授权的服务器，连接在智能体首次使用时建立
+func (g *GlobalMCPManager) registerOAuthServer(config MCPServerConfig) {
+	if transportType, _, err := endpointForConfig(config); err != nil || transportType == "stdio" {
+		log.Errorf("MCP服务器 %s 配置了OAuth授权，但不是远程服务器，跳过", config.Name)
+		return
+	}
+	g.mu.Lock()
+	g.oauthServers[config.Name] = config
+	g.mu.Unlock()
+	log.Infof("MCP服务器 %s 使用OAuth授权，按智能体建立连接", config.Name)
+}
+
+// ensureAgentConnections 为智能体建立所有 OAuth 服务器的连接，最多等待 agentConnectWait
+func (g *GlobalMCPManager) ensureAgentConnections(agentID string) {
+	if agentID == "" {
+		return
+	}
+	g.mu.Lock()
+	conns := make([]*MCPServerConnection, 0, len(g.oauthServers))
+	for name, config := range g.oauthServers {
+		key := oauthKey(agentID, name)
+		conn := g.agentServers[key]
+		if conn == nil {
+			conn = &MCPServerConnection{
+				config:  config,
+				agentID: agentID,
+				tools:   make(map[string]tool.InvokableTool),
+			}
+			g.agentServers[key] = conn
+		}
+		conns = append(conns, conn)
+	}
+	g.mu.Unlock()
+
+	pending := make([]*MCPServerConnection, 0)
+	for _, conn := range conns {
+		conn.mu.RLock()
+		due := !conn.connected && time.Since(conn.lastAttempt) >= agentConnectRetryInterval
+		conn.mu.RUnlock()
+		if due {
+			pending = append(pending, conn)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, conn := range pending {
+		wg.Add(1)
+		go func(conn *MCPServerConnection) {
+			defer wg.Done()
+			g.connectAgent(conn, false)
+		}(conn)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(agentConnectWait()):
+		log.Warnf("智能体 %s 的MCP OAuth连接未在 %s 内建立，后台继续", agentID, agentConnectWait())
+	}
+}
+
+// connectAgent 建立智能体连接；force 为 false 时遵守失败后的重试间隔
+func (g *GlobalMCPManager) connectAgent(conn *MCPServerConnection, force bool) {
+	conn.reconnectMu.Lock()
+	defer conn.reconnectMu.Unlock()
+
+	conn.mu.Lock()
+	if conn.connected || (!force && time.Since(conn.lastAttempt) < agentConnectRetryInterval) {
+		conn.mu.Unlock()
+		return
+	}
+	conn.lastAttempt = time.Now()
+	conn.mu.Unlock()
+
+	// 未授权时不发起连接，避免对远程服务器产生无意义的 401
+	if _, err := oauthAccessToken(g.ctx, conn.agentID, conn.config.Name); err != nil {
+		conn.mu.Lock()
+		conn.lastError = err
+		conn.mu.Unlock()
+		log.Debugf("跳过MCP服务器 %s 的智能体连接: %v", conn.config.Name, err)
+		return
+	}
+	if err := conn.connect(); err != nil {
+		log.Errorf("连接MCP服务器 %s（智能体 %s）失败: %v", conn.config.Name, conn.agentID, err)
+		_ = conn.disconnect()
+		conn.mu.Lock()
+		conn.lastError = err
+		conn.mu.Unlock()
+		return
+	}
+	log.Infof("已连接MCP服务器 %s（智能体 %s）", conn.config.Name, conn.agentID)
+}
+
+// onOAuthTokenChanged 授权后立即建立连接（不等下一轮对话），撤销后断开
+func (g *GlobalMCPManager) onOAuthTokenChanged(agentID, server string, authorized bool) {
+	key := oauthKey(agentID, server)
+	g.mu.Lock()
+	config, isOAuth := g.oauthServers[server]
+	conn := g.agentServers[key]
+	if !authorized {
+		delete(g.agentServers, key)
+	} else if conn == nil && isOAuth {
+		conn = &MCPServerConnection{
+			config:  config,
+			agentID: agentID,
+			tools:   make(map[string]tool.InvokableTool),
+		}
+		g.agentServers[key] = conn
+	}
+	g.mu.Unlock()
+
+	if conn == nil {
+		return
+	}
+	if !authorized {
+		if err := conn.disconnect(); err != nil {
+			log.Errorf("断开MCP服务器 %s（智能体 %s）失败: %v", server, agentID, err)
+		}
+		log.Infof("智能体 %s 已撤销MCP服务器 %s 的授权", agentID, server)
+		return
+	}
+	go g.connectAgent(conn, true)
+}
+
+// pingAgentConnection 检测已建立的智能体连接，失败时标记断开，下次使用时重连
+func (g *GlobalMCPManager) pingAgentConnection(conn *MCPServerConnection) {
+	conn.mu.RLock()
+	connected := conn.connected
+	conn.mu.RUnlock()
+	if !connected {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conn.ping(ctx); err != nil {
+		log.Warnf("MCP服务器 %s（智能体 %s）ping失败: %v", conn.config.Name, conn.agentID, err)
+		conn.mu.Lock()
+		conn.connected = false
+		conn.lastError = err
+		conn.lastAttempt = time.Time{}
+		conn.mu.Unlock()
+	}
+}
+
+// reconnectAgentServer 重连智能体的 OAuth 连接并返回新的client
+func (g *GlobalMCPManager) reconnectAgentServer(agentID, serverName string) (*client.Client, error) {
+	g.mu.RLock()
+	conn := g.agentServers[oauthKey(agentID, serverName)]
+	g.mu.RUnlock()
+	if conn == nil {
+		return nil, fmt.Errorf("未找到智能体 %s 的服务器连接: %s", agentID, serverName)
+	}
+	return g.reconnect(conn)
+}
+
+// agentConnections 智能体已建立的 OAuth 连接
+func (g *GlobalMCPManager) agentConnections(agentID string) []*MCPServerConnection {
+	g.ensureAgentConnections(agentID)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	ret := make([]*MCPServerConnection, 0)
+	for _, conn := range g.agentServers {
+		if conn.agentID == agentID {
+			ret = append(ret, conn)
+		}
+	}
+	return ret
+}
+
+// GetAgentTools 智能体通过 OAuth 连接可用的工具，键与全局工具一致为 "服务器_工具"
+func (g *GlobalMCPManager) GetAgentTools(agentID string) map[string]tool.InvokableTool {
+	result := make(map[string]tool.InvokableTool)
+	if agentID == "" {
+		return result
+	}
+	for _, conn := range g.agentConnections(agentID) {
+		conn.mu.RLock()
+		for name, t := range conn.tools {
+			result[fmt.Sprintf("%s_%s", conn.config.Name, name)] = t
+		}
+		conn.mu.RUnlock()
+	}
+	return result
+}
+
+// agentEndpoints 智能体 OAuth 连接上的资源与提示词，来源与全局服务器相同
+func (g *GlobalMCPManager) agentEndpoints(agentID string) []mcpEndpoint {
+	ret := make([]mcpEndpoint, 0)
+	if agentID == "" {
+		return ret
+	}
+	for _, conn := range g.agentConnections(agentID) {
+		if e, ok := conn.endpoint(); ok {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
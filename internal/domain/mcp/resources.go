@@ -0,0 +1,465 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/mark3labs/mcp-go/client"
+	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
+)
+
+// 资源/提示词来源
+const (
+	SourceGlobal = "global" // 全局 MCP 服务器，Server 为配置中的名称
+	SourceAgent  = "agent"  // 智能体 WebSocket 接入点上报的 MCP 服务器
+	SourceDevice = "device" // 设备自身（IoT over MCP）上报，按当前对话设备解析
+)
+
+const (
+	defaultResourceCacheTTL = 10 * time.Minute
+	defaultResourceMaxChars = 4000
+)
+
+// ResourceInfo MCP 服务器提供的资源
+type ResourceInfo struct {
+	Source      string `json:"source"`
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mime_type,omitempty"`
+}
+
+// PromptArgument 提示词模板参数
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptInfo MCP 服务器提供的提示词模板
+type PromptInfo struct {
+	Source      string           `json:"source"`
+	Server      string           `json:"server"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// mcpEndpoint 一个可查询资源/提示词的 MCP 连接
+type mcpEndpoint struct {
+	source   string
+	server   string // 对外展示名
+	cacheKey string // 缓存键前缀，连接唯一
+	client   *client.Client
+	caps     mcp_go.ServerCapabilities
+}
+
+func (e mcpEndpoint) hasResources() bool { return e.client != nil && e.caps.Resources != nil }
+func (e mcpEndpoint) hasPrompts() bool   { return e.client != nil && e.caps.Prompts != nil }
+
+type cachedResource struct {
+	text    string
+	expires time.Time
+}
+
+// resourceCache 资源正文缓存，收到 notifications/resources/updated 时失效并后台重新读取
+type resourceCache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedResource
+	subscribed map[string]bool
+}
+
+var resourceContentCache = &resourceCache{
+	entries:    make(map[string]cachedResource),
+	subscribed: make(map[string]bool),
+}
+
+func resourceKey(prefix, uri string) string {
+	return prefix + "|" + uri
+}
+
+func resourceCacheTTL() time.Duration {
+	if viper.IsSet("mcp.resources.cache_ttl") {
+		return viper.GetDuration("mcp.resources.cache_ttl")
+	}
+	return defaultResourceCacheTTL
+}
+
+func resourceMaxChars() int {
+	if viper.IsSet("mcp.resources.max_chars") {
+		return viper.GetInt("mcp.resources.max_chars")
+	}
+	return defaultResourceMaxChars
+}
+
+func (c *resourceCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.text, true
+}
+
+func (c *resourceCache) set(key, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedResource{text: text, expires: time.Now().Add(resourceCacheTTL())}
+}
+
+// invalidate 删除缓存，返回之前是否存在
+func (c *resourceCache) invalidate(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	return ok
+}
+
+// markSubscribed 返回是否首次订阅
+func (c *resourceCache) markSubscribed(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscribed[key] {
+		return false
+	}
+	c.subscribed[key] = true
+	return true
+}
+
+// dropPrefix 连接断开时清理该连接的缓存与订阅记录
+func (c *resourceCache) dropPrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix+"|") {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.subscribed {
+		if strings.HasPrefix(key, prefix+"|") {
+			delete(c.subscribed, key)
+		}
+	}
+}
+
+// readText 读取资源正文，优先使用缓存；服务器支持订阅时首次读取后订阅变更通知
+func (e mcpEndpoint) readText(ctx context.Context, uri string) (string, error) {
+	key := resourceKey(e.cacheKey, uri)
+	if text, ok := resourceContentCache.get(key); ok {
+		return text, nil
+	}
+	text, err := e.fetchText(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+	resourceContentCache.set(key, text)
+
+	if e.caps.Resources.Subscribe && resourceContentCache.markSubscribed(key) {
+		subReq := mcp_go.SubscribeRequest{}
+		subReq.Params.URI = uri
+		if err := e.client.Subscribe(ctx, subReq); err != nil {
+			log.Warnf("订阅MCP资源变更失败: server=%s uri=%s err=%v", e.server, uri, err)
+		}
+	}
+	return text, nil
+}
+
+func (e mcpEndpoint) fetchText(ctx context.Context, uri string) (string, error) {
+	req := mcp_go.ReadResourceRequest{}
+	req.Params.URI = uri
+	result, err := e.client.ReadResource(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("读取MCP资源失败: %v", err)
+	}
+	return truncateRunes(resourceContentsText(result.Contents), resourceMaxChars()), nil
+}
+
+// onResourceUpdated 处理 notifications/resources/updated：已缓存的资源失效并后台重新读取
+func (e mcpEndpoint) onResourceUpdated(notification mcp_go.JSONRPCNotification) {
+	uri, _ := notification.Params.AdditionalFields["uri"].(string)
+	if uri == "" {
+		return
+	}
+	key := resourceKey(e.cacheKey, uri)
+	if !resourceContentCache.invalidate(key) {
+		return
+	}
+	log.Infof("MCP资源已更新，刷新缓存: server=%s uri=%s", e.server, uri)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		text, err := e.fetchText(ctx, uri)
+		if err != nil {
+			log.Warnf("刷新MCP资源失败: server=%s uri=%s err=%v", e.server, uri, err)
+			return
+		}
+		resourceContentCache.set(key, text)
+	}()
+}
+
+func (e mcpEndpoint) listResources(ctx context.Context) ([]ResourceInfo, error) {
+	result, err := e.client.ListResources(ctx, mcp_go.ListResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]ResourceInfo, 0, len(result.Resources))
+	for _, r := range result.Resources {
+		resources = append(resources, ResourceInfo{
+			Source:      e.source,
+			Server:      e.server,
+			URI:         r.URI,
+			Name:        r.Name,
+			Description: r.Description,
+			MimeType:    r.MIMEType,
+		})
+	}
+	return resources, nil
+}
+
+func (e mcpEndpoint) listPrompts(ctx context.Context) ([]PromptInfo, error) {
+	result, err := e.client.ListPrompts(ctx, mcp_go.ListPromptsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]PromptInfo, 0, len(result.Prompts))
+	for _, p := range result.Prompts {
+		info := PromptInfo{Source: e.source, Server: e.server, Name: p.Name, Description: p.Description}
+		for _, arg := range p.Arguments {
+			info.Arguments = append(info.Arguments, PromptArgument{Name: arg.Name, Description: arg.Description, Required: arg.Required})
+		}
+		prompts = append(prompts, info)
+	}
+	return prompts, nil
+}
+
+func (e mcpEndpoint) getPromptText(ctx context.Context, name string, arguments map[string]string) (string, error) {
+	req := mcp_go.GetPromptRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = arguments
+	result, err := e.client.GetPrompt(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("获取MCP提示词失败: %v", err)
+	}
+	parts := make([]string, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		if text := strings.TrimSpace(contentText(msg.Content)); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// resourceContentsText 拼接文本内容，二进制内容不进入上下文
+func resourceContentsText(contents []mcp_go.ResourceContents) string {
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp_go.TextResourceContents:
+			parts = append(parts, c.Text)
+		case *mcp_go.TextResourceContents:
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+func contentText(content mcp_go.Content) string {
+	switch c := content.(type) {
+	case mcp_go.TextContent:
+		return c.Text
+	case *mcp_go.TextContent:
+		return c.Text
+	case mcp_go.EmbeddedResource:
+		return resourceContentsText([]mcp_go.ResourceContents{c.Resource})
+	case *mcp_go.EmbeddedResource:
+		return resourceContentsText([]mcp_go.ResourceContents{c.Resource})
+	}
+	return ""
+}
+
+func truncateRunes(text string, maxChars int) string {
+	if maxChars <= 0 {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars]) + "…"
+}
+
+// endpoints 已连接且声明了资源或提示词能力的全局 MCP 服务器
+func (g *GlobalMCPManager) endpoints() []mcpEndpoint {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	ret := make([]mcpEndpoint, 0, len(g.servers))
+	for _, conn := range g.servers {
+		if e, ok := conn.endpoint(); ok {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func (conn *MCPServerConnection) endpoint() (mcpEndpoint, bool) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if !conn.connected || conn.client == nil {
+		return mcpEndpoint{}, false
+	}
+	return mcpEndpoint{
+		source:   SourceGlobal,
+		server:   conn.config.Name,
+		cacheKey: conn.cacheKey(),
+		client:   conn.client,
+		caps:     conn.capabilities,
+	}, true
+}
+
+// endpoint 设备/接入点连接，展示名使用 MCP 服务器自报的名称
+func (dc *McpClientInstance) endpoint(source string) (mcpEndpoint, bool) {
+	if dc == nil || dc.mcpClient == nil || dc.serverInfo == nil || !dc.connected {
+		return mcpEndpoint{}, false
+	}
+	server := strings.TrimSpace(dc.serverInfo.ServerInfo.Name)
+	if server == "" {
+		server = dc.serverName
+	}
+	return mcpEndpoint{
+		source:   source,
+		server:   server,
+		cacheKey: dc.serverName,
+		client:   dc.mcpClient,
+		caps:     dc.serverInfo.Capabilities,
+	}, true
+}
+
+func (dc *DeviceMcpSession) endpoints(source string) []mcpEndpoint {
+	ret := make([]mcpEndpoint, 0)
+	dc.wsEndPointMcp.Range(func(_, value interface{}) bool {
+		if e, ok := value.(*McpClientInstance).endpoint(source); ok {
+			ret = append(ret, e)
+		}
+		return true
+	})
+	dc.iotMux.RLock()
+	if e, ok := dc.iotOverMcp.endpoint(source); ok {
+		ret = append(ret, e)
+	}
+	dc.iotMux.RUnlock()
+	return ret
+}
+
+// scopeEndpoints 智能体可见的全部 MCP 连接：全局、智能体接入点、当前设备
+func scopeEndpoints(agentID, deviceID string) []mcpEndpoint {
+	ret := GetGlobalMCPManager().endpoints()
+	if agentID != "" {
+		ret = append(ret, GetGlobalMCPManager().agentEndpoints(agentID)...)
+		if session := mcpClientPool.GetMcpClient(agentID); session != nil {
+			ret = append(ret, session.endpoints(SourceAgent)...)
+		}
+	}
+	if deviceID != "" && deviceID != agentID {
+		if session := mcpClientPool.GetMcpClient(deviceID); session != nil {
+			ret = append(ret, session.endpoints(SourceDevice)...)
+		}
+	}
+	return ret
+}
+
+func matchEndpoints(agentID, deviceID, source, server string) []mcpEndpoint {
+	ret := make([]mcpEndpoint, 0)
+	for _, e := range scopeEndpoints(agentID, deviceID) {
+		if e.source != source || (server != "" && e.server != server) {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// ListResources 列出智能体（及当前设备）可用的 MCP 资源，单个服务器失败不影响其他服务器
+func ListResources(ctx context.Context, agentID, deviceID string) []ResourceInfo {
+	ret := make([]ResourceInfo, 0)
+	for _, e := range scopeEndpoints(agentID, deviceID) {
+		if !e.hasResources() {
+			continue
+		}
+		resources, err := e.listResources(ctx)
+		if err != nil {
+			log.Warnf("获取MCP资源列表失败: server=%s err=%v", e.server, err)
+			continue
+		}
+		ret = append(ret, resources...)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Source != ret[j].Source {
+			return ret[i].Source < ret[j].Source
+		}
+		return ret[i].Server < ret[j].Server
+	})
+	return ret
+}
+
+// ReadResourceText 读取资源文本（带缓存），server 为空时在该来源的所有服务器中查找
+func ReadResourceText(ctx context.Context, agentID, deviceID, source, server, uri string) (string, error) {
+	candidates := matchEndpoints(agentID, deviceID, source, server)
+	var lastErr error
+	for _, e := range candidates {
+		if !e.hasResources() {
+			continue
+		}
+		text, err := e.readText(ctx, uri)
+		if err == nil {
+			return text, nil
+		}
+		lastErr = err
+	}
+	if lastErr != nil {
+		return "", lastErr
+	}
+	return "", fmt.Errorf("未找到提供资源 %s 的MCP服务器(%s/%s)", uri, source, server)
+}
+
+// ListPrompts 列出智能体（及当前设备）可用的 MCP 提示词模板
+func ListPrompts(ctx context.Context, agentID, deviceID string) []PromptInfo {
+	ret := make([]PromptInfo, 0)
+	for _, e := range scopeEndpoints(agentID, deviceID) {
+		if !e.hasPrompts() {
+			continue
+		}
+		prompts, err := e.listPrompts(ctx)
+		if err != nil {
+			log.Warnf("获取MCP提示词列表失败: server=%s err=%v", e.server, err)
+			continue
+		}
+		ret = append(ret, prompts...)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Source != ret[j].Source {
+			return ret[i].Source < ret[j].Source
+		}
+		return ret[i].Server < ret[j].Server
+	})
+	return ret
+}
+
+// GetPromptText 渲染提示词模板，返回各消息文本拼接结果
+func GetPromptText(ctx context.Context, agentID, deviceID, source, server, name string, arguments map[string]string) (string, error) {
+	for _, e := range matchEndpoints(agentID, deviceID, source, server) {
+		if e.hasPrompts() {
+			return e.getPromptText(ctx, name, arguments)
+		}
+	}
+	return "", fmt.Errorf("未找到提供提示词 %s 的MCP服务器(%s/%s)", name, source, server)
+}
@@ -0,0 +1,273 @@
+// Package stdio 以子进程方式运行 stdio MCP 服务器（npx / uvx / 二进制），
+// 负责进程启动、stderr 日志、资源限制与优雅停止，重启策略由调用方根据 Done 与 Backoff 决定。
+package stdio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+const (
+	// DefaultStopGrace 关闭 stdin 后等待进程自行退出的时长，超时发送 SIGTERM，再超时发送 SIGKILL
+	DefaultStopGrace = 3 * time.Second
+	// StableRun 进程持续运行超过该时长后，重启退避计数清零
+	StableRun = time.Minute
+
+	minBackoff     = time.Second
+	maxBackoff     = time.Minute
+	maxStderrLine  = 4096
+	waitPipesDelay = 2 * time.Second
+)
+
+// Limits 子进程资源限制，0 表示不限制，仅 Linux 生效
+type Limits struct {
+	MaxMemoryMB   int `json:"max_memory_mb,omitempty" mapstructure:"max_memory_mb"`     // 数据段上限（RLIMIT_DATA）
+	MaxCPUSeconds int `json:"max_cpu_seconds,omitempty" mapstructure:"max_cpu_seconds"` // 累计 CPU 时间上限（RLIMIT_CPU）
+	MaxOpenFiles  int `json:"max_open_files,omitempty" mapstructure:"max_open_files"`   // 打开文件数上限（RLIMIT_NOFILE）
+}
+
+// Config 启动子进程所需的配置
+type Config struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     map[string]string // 追加到当前进程环境变量之后，值支持 ${VAR} 引用服务端环境变量
+	WorkDir string
+	Limits  Limits
+	// OnStderr 每行 stderr 输出的回调，为空时写入日志
+	OnStderr func(line string)
+}
+
+// Process 运行中的 stdio MCP 服务器进程
+type Process struct {
+	name      string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	startedAt time.Time
+
+	done     chan struct{}
+	err      error
+	stopped  atomic.Bool
+	stopOnce sync.Once
+}
+
+// Start 启动子进程
+func Start(cfg Config) (*Process, error) {
+	command := strings.TrimSpace(cfg.Command)
+	if command == "" {
+		return nil, fmt.Errorf("MCP服务器 %s 缺少启动命令", cfg.Name)
+	}
+
+	cmd := exec.Command(command, cfg.Args...)
+	cmd.Dir = strings.TrimSpace(cfg.WorkDir)
+	// 不继承主程序环境变量（其中有数据库密码、API Key 等），只传基础变量与配置的 env
+	cmd.Env = append(baseEnv(), buildEnv(cfg.Env)...)
+	// 子进程退出后仍有孙进程占用 stderr 时，不无限等待
+	cmd.WaitDelay = waitPipesDelay
+	onStderr := cfg.OnStderr
+	if onStderr == nil {
+		onStderr = func(line string) { log.Infof("[mcp:%s] %s", cfg.Name, line) }
+	}
+	cmd.Stderr = &lineWriter{onLine: onStderr}
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建stdin管道失败: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建stdout管道失败: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动进程失败: %w", err)
+	}
+
+	p := &Process{
+		name:      cfg.Name,
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    stdout,
+		startedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+	if err := applyLimits(cmd.Process.Pid, cfg.Limits); err != nil {
+		log.Warnf("MCP服务器 %s 设置资源限制失败: %v", cfg.Name, err)
+	}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+
+	log.Infof("MCP服务器 %s 进程已启动, pid: %d, 命令: %s", cfg.Name, cmd.Process.Pid, CommandLine(command, cfg.Args))
+	return p, nil
+}
+
+// Transport 基于进程 stdin/stdout 的 MCP 传输层，关闭传输层不会结束进程，需调用 Stop
+func (p *Process) Transport() *transport.Stdio {
+	return transport.NewIO(p.stdout, p.stdin, io.NopCloser(strings.NewReader("")))
+}
+
+// Done 进程退出后关闭
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err 进程退出原因，进程未退出时为 nil
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// Pid 进程号
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// StartedAt 进程启动时间
+func (p *Process) StartedAt() time.Time {
+	return p.startedAt
+}
+
+// Stopped 进程是否由 Stop 主动停止（区别于崩溃或被 Terminate 结束）
+func (p *Process) Stopped() bool {
+	return p.stopped.Load()
+}
+
+// Stop 主动停止进程：关闭 stdin，grace 内未退出发送 SIGTERM，再等待 grace 后 SIGKILL
+func (p *Process) Stop(grace time.Duration) error {
+	p.stopped.Store(true)
+	return p.shutdown(grace)
+}
+
+// Terminate 结束进程但不标记为主动停止，用于进程无响应时交由调用方按崩溃处理并重启
+func (p *Process) Terminate(grace time.Duration) error {
+	return p.shutdown(grace)
+}
+
+func (p *Process) shutdown(grace time.Duration) error {
+	if grace <= 0 {
+		grace = DefaultStopGrace
+	}
+	p.stopOnce.Do(func() {
+		_ = p.stdin.Close()
+	})
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(grace):
+	}
+	log.Warnf("MCP服务器 %s 进程 %d 未在 %s 内退出，发送 SIGTERM", p.name, p.Pid(), grace)
+	if err := terminateProcess(p.cmd); err != nil {
+		log.Warnf("MCP服务器 %s 发送 SIGTERM 失败: %v", p.name, err)
+	}
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(grace):
+	}
+	log.Warnf("MCP服务器 %s 进程 %d 未响应 SIGTERM，强制结束", p.name, p.Pid())
+	if err := killProcess(p.cmd); err != nil {
+		return fmt.Errorf("结束进程失败: %w", err)
+	}
+	<-p.done
+	return nil
+}
+
+// Backoff 第 restarts 次重启前的等待时间：1s、2s、4s … 最长 1 分钟
+func Backoff(restarts int) time.Duration {
+	if restarts < 0 {
+		restarts = 0
+	}
+	if restarts >= 6 {
+		return maxBackoff
+	}
+	return minBackoff << restarts
+}
+
+// CommandLine 用于日志展示的命令行
+func CommandLine(command string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, command)
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// inheritedEnvKeys 子进程从主程序继承的环境变量，其余需在 env 中显式配置
+var inheritedEnvKeys = []string{"PATH", "HOME", "LANG", "TMPDIR"}
+
+func baseEnv() []string {
+	ret := make([]string, 0, len(inheritedEnvKeys))
+	for _, k := range inheritedEnvKeys {
+		if v, ok := os.LookupEnv(k); ok {
+			ret = append(ret, k+"="+v)
+		}
+	}
+	return ret
+}
+
+func buildEnv(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		if k = strings.TrimSpace(k); k != "" && !strings.Contains(k, "=") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, k+"="+os.ExpandEnv(env[k]))
+	}
+	return ret
+}
+
+// lineWriter 将 stderr 按行回调，超长行截断
+type lineWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	onLine func(line string)
+}
+
+func (w *lineWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(data)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			if w.buf.Len() > maxStderrLine {
+				w.emit(w.buf.Next(maxStderrLine))
+			}
+			return len(data), nil
+		}
+		w.emit(w.buf.Next(idx + 1))
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	if text := strings.TrimRight(string(line), "\r\n"); strings.TrimSpace(text) != "" {
+		w.onLine(text)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package stdio
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup 子进程使用独立进程组，停止时连同 npx/uvx 拉起的孙进程一起结束
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminateProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// applyLimits 进程启动后通过 prlimit 设置资源限制，子进程 fork 出的进程继承该限制
+func applyLimits(pid int, limits Limits) error {
+	set := func(resource int, value uint64) error {
+		if value == 0 {
+			return nil
+		}
+		return unix.Prlimit(pid, resource, &unix.Rlimit{Cur: value, Max: value}, nil)
+	}
+	if err := set(unix.RLIMIT_DATA, uint64(max(limits.MaxMemoryMB, 0))*1024*1024); err != nil {
+		return err
+	}
+	if err := set(unix.RLIMIT_CPU, uint64(max(limits.MaxCPUSeconds, 0))); err != nil {
+		return err
+	}
+	return set(unix.RLIMIT_NOFILE, uint64(max(limits.MaxOpenFiles, 0)))
+}
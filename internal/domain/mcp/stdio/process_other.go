@@ -0,0 +1,26 @@
+//go:build !linux
+
+package stdio
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func terminateProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func applyLimits(pid int, limits Limits) error {
+	if limits.MaxMemoryMB > 0 || limits.MaxCPUSeconds > 0 || limits.MaxOpenFiles > 0 {
+		return fmt.Errorf("当前平台不支持资源限制")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package stdio
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 测试二进制以 fixtureEnv 环境变量重新执行自身时充当 stdio MCP 服务器
+const fixtureEnv = "XIAOZHI_MCP_STDIO_FIXTURE"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(fixtureEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "serve":
+		runFixtureServer()
+	case "crash":
+		fmt.Fprintln(os.Stderr, "fixture crashed")
+		os.Exit(3)
+	case "hang":
+		// 忽略 stdin 关闭与 SIGTERM，只能被 SIGKILL 结束
+		signal.Ignore(syscall.SIGTERM)
+		select {}
+	}
+	os.Exit(0)
+}
+
+func runFixtureServer() {
+	fmt.Fprintln(os.Stderr, "fixture ready")
+	s := server.NewMCPServer("fixture", "1.0.0")
+	s.AddTool(mcp.NewTool("echo", mcp.WithString("text", mcp.Required())), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("text", "")), nil
+	})
+	s.AddTool(mcp.NewTool("env"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		wd, _ := os.Getwd()
+		return mcp.NewToolResultText(os.Getenv("FIXTURE_GREETING") + "|" + filepath.Base(wd) + "|" + os.Getenv("USER_FOR_FIXTURE")), nil
+	})
+	if err := server.ServeStdio(s); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func fixtureConfig(t *testing.T, mode string) Config {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("executable: %v", err)
+	}
+	return Config{
+		Name:    "fixture",
+		Command: exe,
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{fixtureEnv: mode},
+	}
+}
+
+type stderrLines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *stderrLines) add(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+}
+
+func (s *stderrLines) contains(text string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range s.lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProcessServesMCP(t *testing.T) {
+	var stderr stderrLines
+	cfg := fixtureConfig(t, "serve")
+	cfg.Env["FIXTURE_GREETING"] = "hello-${USER_FOR_FIXTURE}"
+	cfg.WorkDir = t.TempDir()
+	cfg.OnStderr = stderr.add
+	t.Setenv("USER_FOR_FIXTURE", "xiaozhi")
+
+	p, err := Start(cfg)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Stop(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := client.NewClient(p.Transport())
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("client start: %v", err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}}); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil || len(tools.Tools) != 2 {
+		t.Fatalf("list tools: %+v %v", tools, err)
+	}
+
+	call := func(name string, args map[string]any) string {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		res, err := c.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("call %s: %v", name, err)
+		}
+		return res.Content[0].(mcp.TextContent).Text
+	}
+	if got := call("echo", map[string]any{"text": "你好"}); got != "你好" {
+		t.Fatalf("echo = %q", got)
+	}
+	// USER_FOR_FIXTURE 只用于展开配置，不应被子进程继承
+	if got := call("env", nil); got != "hello-xiaozhi|"+filepath.Base(cfg.WorkDir)+"|" {
+		t.Fatalf("env/workdir = %q", got)
+	}
+	if !stderr.contains("fixture ready") {
+		t.Fatalf("stderr should be captured: %v", stderr.lines)
+	}
+
+	if err := p.Stop(time.Second); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if !p.Stopped() {
+		t.Fatalf("process stopped by Stop should be marked as stopped")
+	}
+}
+
+func TestProcessCrashIsReported(t *testing.T) {
+	var stderr stderrLines
+	cfg := fixtureConfig(t, "crash")
+	cfg.OnStderr = stderr.add
+	p, err := Start(cfg)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("crashed process should be reported")
+	}
+	if p.Stopped() || p.Err() == nil {
+		t.Fatalf("crash should not look like a requested stop: stopped=%v err=%v", p.Stopped(), p.Err())
+	}
+	if !stderr.contains("fixture crashed") {
+		t.Fatalf("stderr before exit should be captured: %v", stderr.lines)
+	}
+}
+
+func TestProcessStopEscalatesToKill(t *testing.T) {
+	p, err := Start(fixtureConfig(t, "hang"))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond) // 等待 fixture 忽略 SIGTERM
+	start := time.Now()
+	if err := p.Stop(100 * time.Millisecond); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("stop should escalate to SIGKILL quickly, took %s", elapsed)
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Fatalf("process should have exited")
+	}
+}
+
+func TestStartWithoutCommand(t *testing.T) {
+	if _, err := Start(Config{Name: "empty"}); err == nil {
+		t.Fatalf("empty command should fail")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := Backoff(i); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{onLine: func(line string) { lines = append(lines, line) }}
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\n\n"))
+	w.Write([]byte(strings.Repeat("x", maxStderrLine+10)))
+	if len(lines) != 3 || lines[0] != "first" || lines[1] != "second" || len(lines[2]) != maxStderrLine {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"xiaozhi-esp32-server-golang/internal/domain/mcp/stdio"
+
 	"github.com/mark3labs/mcp-go/client"
 	mcpgo "github.com/mark3labs/mcp-go/mcp"
 )
@@ -53,6 +55,10 @@ func ValidateServerConfigs(serverConfigs []MCPServerConfig) error {
 			continue
 		}
 		enabledCount++
+		if isOAuthServer(cfg) {
+			// 令牌按智能体授权，保存配置时无法预检连接
+			continue
+		}
 		if err := validateSingleServer(cfg); err != nil {
 			errs = append(errs, fmt.Sprintf("%s: %v", cfg.Name, err))
 		}
@@ -68,10 +74,13 @@ func ValidateServerConfigs(serverConfigs []MCPServerConfig) error {
 }
 
 func validateSingleServer(config MCPServerConfig) error {
-	transportInstance, endpoint, err := buildMCPTransport(config)
+	transportInstance, endpoint, process, err := buildMCPTransport(config, "")
 	if err != nil {
 		return err
 	}
+	if process != nil {
+		defer process.Stop(stdio.DefaultStopGrace)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
 	defer cancel()
@@ -0,0 +1,97 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+
+	"github.com/spf13/viper"
+)
+
+// localSearcher 内置知识库检索：向量与分块存放在 manager 数据库中，由 manager 内部接口完成混合检索。
+type localSearcher struct{}
+
+func (s *localSearcher) Search(
+	ctx context.Context,
+	query string,
+	topK int,
+	knowledgeBases []config_types.KnowledgeBaseRef,
+	providerConfig map[string]interface{},
+) ([]config_types.KnowledgeSearchHit, error) {
+	managerURL := resolveLocalKnowledgeManagerURL(providerConfig)
+	if managerURL == "" {
+		return nil, fmt.Errorf("local 知识库缺少 manager 地址（BACKEND_URL 或 manager.backend_url）")
+	}
+
+	type kbItem struct {
+		ID                 uint     `json:"id"`
+		RetrievalThreshold *float64 `json:"retrieval_threshold,omitempty"`
+	}
+	items := make([]kbItem, 0, len(knowledgeBases))
+	for _, kb := range knowledgeBases {
+		if kb.ID == 0 {
+			continue
+		}
+		items = append(items, kbItem{ID: kb.ID, RetrievalThreshold: kb.RetrievalThreshold})
+	}
+	if len(items) == 0 {
+		return []config_types.KnowledgeSearchHit{}, nil
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"query":           query,
+		"top_k":           topK,
+		"knowledge_bases": items,
+	})
+	searchURL := strings.TrimRight(managerURL, "/") + "/api/internal/knowledge/search"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, searchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建local知识库检索请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("调用local知识库检索失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("local知识库检索返回异常: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var localResp struct {
+		Data struct {
+			Hits []config_types.KnowledgeSearchHit `json:"hits"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&localResp); err != nil {
+		return nil, fmt.Errorf("解析local知识库检索返回失败: %w", err)
+	}
+
+	hits := make([]config_types.KnowledgeSearchHit, 0, len(localResp.Data.Hits))
+	for _, hit := range localResp.Data.Hits {
+		if strings.TrimSpace(hit.Content) == "" {
+			continue
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+func resolveLocalKnowledgeManagerURL(providerConfig map[string]interface{}) string {
+	if raw, ok := providerConfig["manager_url"].(string); ok && strings.TrimSpace(raw) != "" {
+		return strings.TrimSpace(raw)
+	}
+	if backendURL := strings.TrimSpace(os.Getenv("BACKEND_URL")); backendURL != "" {
+		return backendURL
+	}
+	return strings.TrimSpace(viper.GetString("manager.backend_url"))
+}
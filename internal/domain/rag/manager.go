@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,7 +23,7 @@ const (
 	defaultKnowledgeSearchMaxParallel   = 8
 )
 
-// Search 按知识库 provider 分组检索并聚合排序。
+// Search 按知识库 provider 分组检索，随后依次进行 RRF 融合、近似去重与可选的 rerank 重排。
 func Search(
 	ctx context.Context,
 	query string,
@@ -86,7 +85,17 @@ func Search(
 	}
 	defer cancel()
 
-	hits := make([]config_types.KnowledgeSearchHit, 0, topK)
+	// 启用 rerank 时向各 provider 多取一些候选，交由重排模型挑选
+	rerankCfg, rerankEnabled := loadRerankConfig()
+	candidateK := topK
+	if rerankEnabled {
+		candidateK = rerankCfg.Candidates
+		if candidateK < topK {
+			candidateK = topK * defaultRerankCandidatesFactor
+		}
+	}
+
+	providerLists := make([][]config_types.KnowledgeSearchHit, 0, len(grouped))
 	errs := make([]string, 0)
 	successProviderCount := 0
 	for provider, providerKBs := range grouped {
@@ -101,15 +110,18 @@ func Search(
 			continue
 		}
 
-		providerHits, err := searcher.Search(totalCtx, q, topK, providerKBs, providerConfig)
+		providerHits, err := searcher.Search(totalCtx, q, candidateK, providerKBs, providerConfig)
 		if err != nil {
 			errs = append(errs, fmt.Sprintf("provider %s 检索失败: %v", provider, err))
 			continue
 		}
 		successProviderCount++
-		hits = append(hits, providerHits...)
+		providerLists = append(providerLists, providerHits)
 	}
 
+	hits := fuseHits(providerLists, getKnowledgeFusionMode(), getKnowledgeRRFK())
+	hits = dedupeHits(hits, getKnowledgeDedupeThreshold())
+
 	if len(hits) == 0 {
 		if successProviderCount == 0 && len(errs) > 0 {
 			return nil, errors.New(strings.Join(errs, "; "))
@@ -117,9 +129,18 @@ func Search(
 		return []config_types.KnowledgeSearchHit{}, nil
 	}
 
-	sort.SliceStable(hits, func(i, j int) bool {
-		return hits[i].Score > hits[j].Score
-	})
+	if rerankEnabled && len(hits) > 1 {
+		candidates := hits
+		if len(candidates) > candidateK {
+			candidates = candidates[:candidateK]
+		}
+		reranked, err := rerankHits(ctx, rerankCfg, q, candidates)
+		if err != nil {
+			log.Warnf("知识库检索 rerank 失败，使用融合排序结果: %v", err)
+		} else {
+			hits = reranked
+		}
+	}
 	if len(hits) > topK {
 		hits = hits[:topK]
 	}
@@ -138,6 +159,8 @@ func getSearcher(provider string) Searcher {
 		return &ragflowSearcher{}
 	case "weknora":
 		return &weknoraSearcher{}
+	case "local":
+		return &localSearcher{}
 	default:
 		return nil
 	}
@@ -0,0 +1,252 @@
+package rag
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	fusionModeRRF   = "rrf"
+	fusionModeScore = "score"
+
+	defaultKnowledgeFusionMode      = fusionModeRRF
+	defaultKnowledgeRRFK            = 60
+	defaultKnowledgeDedupeThreshold = 0.85
+	defaultKnowledgeMaxResultTokens = 1200
+	minKnowledgeTruncatedTokens     = 40
+)
+
+// fuseHits 合并多个 provider 的检索结果。
+// 不同 provider 的分数不可直接比较，默认使用 RRF（reciprocal rank fusion）按各自排名融合，
+// 融合分数归一化到 0~1；fusion=score 时保持旧行为，直接按原始分数排序。
+func fuseHits(lists [][]config_types.KnowledgeSearchHit, mode string, k int) []config_types.KnowledgeSearchHit {
+	total := 0
+	for _, list := range lists {
+		total += len(list)
+	}
+	ret := make([]config_types.KnowledgeSearchHit, 0, total)
+	if total == 0 {
+		return ret
+	}
+
+	if strings.EqualFold(strings.TrimSpace(mode), fusionModeScore) {
+		for _, list := range lists {
+			ret = append(ret, list...)
+		}
+		sort.SliceStable(ret, func(i, j int) bool { return ret[i].Score > ret[j].Score })
+		return ret
+	}
+
+	if k <= 0 {
+		k = defaultKnowledgeRRFK
+	}
+	type fused struct {
+		hit   config_types.KnowledgeSearchHit
+		score float64
+		order int
+	}
+	byKey := make(map[string]*fused, total)
+	order := 0
+	for _, list := range lists {
+		ranked := make([]config_types.KnowledgeSearchHit, len(list))
+		copy(ranked, list)
+		sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+		for rank, hit := range ranked {
+			key := normalizeHitContent(hit.Content)
+			if key == "" {
+				continue
+			}
+			contribution := 1.0 / float64(k+rank+1)
+			if item, ok := byKey[key]; ok {
+				item.score += contribution
+				continue
+			}
+			byKey[key] = &fused{hit: hit, score: contribution, order: order}
+			order++
+		}
+	}
+
+	items := make([]*fused, 0, len(byKey))
+	for _, item := range byKey {
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].score != items[j].score {
+			return items[i].score > items[j].score
+		}
+		return items[i].order < items[j].order
+	})
+	// 理论最大值：在每个列表中都排第一
+	maxScore := float64(len(lists)) / float64(k+1)
+	for _, item := range items {
+		hit := item.hit
+		hit.Score = item.score / maxScore
+		ret = append(ret, hit)
+	}
+	return ret
+}
+
+// dedupeHits 去除内容近似重复的片段（字符二元组 Jaccard 相似度 >= threshold），保留排名靠前者。
+// threshold <= 0 表示关闭去重。
+func dedupeHits(hits []config_types.KnowledgeSearchHit, threshold float64) []config_types.KnowledgeSearchHit {
+	if len(hits) <= 1 || threshold <= 0 {
+		return hits
+	}
+	ret := make([]config_types.KnowledgeSearchHit, 0, len(hits))
+	kept := make([]map[string]struct{}, 0, len(hits))
+	for _, hit := range hits {
+		shingles := contentShingles(normalizeHitContent(hit.Content))
+		if len(shingles) == 0 {
+			continue
+		}
+		duplicate := false
+		for _, prev := range kept {
+			if jaccard(shingles, prev) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		kept = append(kept, shingles)
+		ret = append(ret, hit)
+	}
+	return ret
+}
+
+func normalizeHitContent(content string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(content) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func contentShingles(normalized string) map[string]struct{} {
+	runes := []rune(normalized)
+	ret := make(map[string]struct{}, len(runes))
+	if len(runes) == 1 {
+		ret[normalized] = struct{}{}
+		return ret
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		ret[string(runes[i:i+2])] = struct{}{}
+	}
+	return ret
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	inter := 0
+	for key := range a {
+		if _, ok := b[key]; ok {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	return float64(inter) / float64(union)
+}
+
+// EstimateTokens 粗略估算文本 token 数：中日韩字符按 1 个 token，其余按 4 个字符 1 个 token
+func EstimateTokens(text string) int {
+	cjk := 0
+	other := 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// FitTokenBudget 按排名顺序保留检索片段直到达到 token 预算，最后一条在剩余正文预算
+// 不少于 minKnowledgeTruncatedTokens 时截断保留，否则丢弃。
+// maxTokens <= 0 时使用 knowledge.search.max_result_tokens 配置。
+func FitTokenBudget(hits []config_types.KnowledgeSearchHit, maxTokens int) []config_types.KnowledgeSearchHit {
+	if maxTokens <= 0 {
+		maxTokens = getKnowledgeMaxResultTokens()
+	}
+	if maxTokens <= 0 {
+		return hits
+	}
+	ret := make([]config_types.KnowledgeSearchHit, 0, len(hits))
+	remaining := maxTokens
+	for _, hit := range hits {
+		tokens := EstimateTokens(hit.Content) + EstimateTokens(hit.Title)
+		if tokens <= remaining {
+			ret = append(ret, hit)
+			remaining -= tokens
+			continue
+		}
+		contentBudget := remaining - EstimateTokens(hit.Title)
+		if contentBudget >= minKnowledgeTruncatedTokens {
+			if content := truncateToTokens(hit.Content, contentBudget-1); content != "" {
+				hit.Content = content + "..."
+				ret = append(ret, hit)
+			}
+		}
+		break
+	}
+	return ret
+}
+
+func truncateToTokens(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EstimateTokens(string(runes[:mid])) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return strings.TrimSpace(string(runes[:lo]))
+}
+
+func getKnowledgeFusionMode() string {
+	mode := strings.ToLower(strings.TrimSpace(viper.GetString("knowledge.search.fusion")))
+	if mode != fusionModeRRF && mode != fusionModeScore {
+		return defaultKnowledgeFusionMode
+	}
+	return mode
+}
+
+func getKnowledgeRRFK() int {
+	if v := viper.GetInt("knowledge.search.rrf_k"); v > 0 {
+		return v
+	}
+	return defaultKnowledgeRRFK
+}
+
+func getKnowledgeDedupeThreshold() float64 {
+	if !viper.IsSet("knowledge.search.dedupe_threshold") {
+		return defaultKnowledgeDedupeThreshold
+	}
+	return viper.GetFloat64("knowledge.search.dedupe_threshold")
+}
+
+func getKnowledgeMaxResultTokens() int {
+	if !viper.IsSet("knowledge.search.max_result_tokens") {
+		return defaultKnowledgeMaxResultTokens
+	}
+	return viper.GetInt("knowledge.search.max_result_tokens")
+}
@@ -0,0 +1,121 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+)
+
+func TestFuseHitsRRF(t *testing.T) {
+	dify := []config_types.KnowledgeSearchHit{
+		{Content: "退货政策：七天无理由", Score: 0.9},
+		{Content: "发货时间：48小时", Score: 0.5},
+	}
+	// RAGFlow 分数量纲不同，但排名第一的片段与 Dify 第一条相同
+	ragflow := []config_types.KnowledgeSearchHit{
+		{Content: "保修一年", Score: 12},
+		{Content: "退货政策：七天无理由。", Score: 30},
+	}
+	got := fuseHits([][]config_types.KnowledgeSearchHit{dify, ragflow}, fusionModeRRF, 60)
+	if len(got) != 3 {
+		t.Fatalf("fused len = %d, want 3: %+v", len(got), got)
+	}
+	if got[0].Content != "退货政策：七天无理由" {
+		t.Fatalf("top hit = %q, want shared top hit", got[0].Content)
+	}
+	if math.Abs(got[0].Score-1) > 1e-9 {
+		t.Fatalf("top fused score = %v, want 1", got[0].Score)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Score > got[i-1].Score {
+			t.Fatalf("fused hits not sorted: %+v", got)
+		}
+	}
+
+	legacy := fuseHits([][]config_types.KnowledgeSearchHit{dify, ragflow}, fusionModeScore, 60)
+	if legacy[0].Score != 30 {
+		t.Fatalf("score mode top = %v, want raw score 30", legacy[0].Score)
+	}
+}
+
+func TestDedupeHits(t *testing.T) {
+	hits := []config_types.KnowledgeSearchHit{
+		{Content: "小智支持七天无理由退货，请保持商品完好。"},
+		{Content: "小智支持七天无理由退货，请保持商品完好！"},
+		{Content: "发货时间为下单后48小时内。"},
+	}
+	got := dedupeHits(hits, 0.85)
+	if len(got) != 2 || got[1].Content != hits[2].Content {
+		t.Fatalf("dedupe = %+v", got)
+	}
+	if got := dedupeHits(hits, 0); len(got) != len(hits) {
+		t.Fatalf("threshold 0 should disable dedupe, got %d hits", len(got))
+	}
+}
+
+func TestFitTokenBudget(t *testing.T) {
+	hits := []config_types.KnowledgeSearchHit{
+		{Content: strings.Repeat("中", 60)},
+		{Content: strings.Repeat("文", 100)},
+		{Content: "never reached"},
+	}
+	got := FitTokenBudget(hits, 120)
+	if len(got) != 2 {
+		t.Fatalf("budgeted len = %d, want 2", len(got))
+	}
+	if n := EstimateTokens(got[1].Content); n > 61 {
+		t.Fatalf("truncated hit tokens = %d, want <= 61", n)
+	}
+
+	if got := FitTokenBudget(hits[:2], 70); len(got) != 1 {
+		t.Fatalf("small remaining budget should drop hit, got %d", len(got))
+	}
+
+	// 标题占掉剩余预算时不应留下只有 "..." 的片段
+	titled := []config_types.KnowledgeSearchHit{
+		{Content: strings.Repeat("中", 60)},
+		{Title: strings.Repeat("题", 50), Content: strings.Repeat("文", 100)},
+	}
+	if got := FitTokenBudget(titled, 120); len(got) != 1 {
+		t.Fatalf("hit with title over budget should be dropped, got %d", len(got))
+	}
+}
+
+func TestRerankHits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rerank") {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Documents []string `json:"documents"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Documents) != 3 {
+			http.Error(w, "bad documents", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results":[{"index":2,"relevance_score":0.95},{"index":0,"relevance_score":0.4},{"index":1,"relevance_score":0.01}]}`))
+	}))
+	defer server.Close()
+
+	hits := []config_types.KnowledgeSearchHit{{Content: "a"}, {Content: "b"}, {Content: "c"}}
+	got, err := rerankHits(context.Background(), &rerankConfig{BaseURL: server.URL + "/v1", MinScore: 0.1}, "q", hits)
+	if err != nil {
+		t.Fatalf("rerank: %v", err)
+	}
+	if len(got) != 2 || got[0].Content != "c" || got[0].Score != 0.95 || got[1].Content != "a" {
+		t.Fatalf("reranked = %+v", got)
+	}
+
+	scores, err := parseRerankScores([]byte(`[{"index":1,"score":0.7}]`))
+	if err != nil || len(scores) != 1 || scores[0].index != 1 || scores[0].score != 0.7 {
+		t.Fatalf("parse TEI scores = %+v, %v", scores, err)
+	}
+}
@@ -0,0 +1,183 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	config_types "xiaozhi-esp32-server-golang/internal/domain/config/types"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultRerankTimeout          = 1500 * time.Millisecond
+	defaultRerankCandidatesFactor = 3
+)
+
+// rerankConfig 交叉编码器重排配置（knowledge.rerank.*），兼容 Jina / Cohere / BGE(TEI) 的 /rerank 接口
+type rerankConfig struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Timeout    time.Duration
+	Candidates int
+	MinScore   float64
+}
+
+func loadRerankConfig() (*rerankConfig, bool) {
+	if !viper.GetBool("knowledge.rerank.enabled") {
+		return nil, false
+	}
+	baseURL := strings.TrimSpace(viper.GetString("knowledge.rerank.base_url"))
+	if baseURL == "" {
+		return nil, false
+	}
+	cfg := &rerankConfig{
+		BaseURL:    baseURL,
+		APIKey:     strings.TrimSpace(viper.GetString("knowledge.rerank.api_key")),
+		Model:      strings.TrimSpace(viper.GetString("knowledge.rerank.model")),
+		Timeout:    getKnowledgeSearchDuration("knowledge.rerank.timeout_ms", defaultRerankTimeout),
+		Candidates: viper.GetInt("knowledge.rerank.candidates"),
+		MinScore:   viper.GetFloat64("knowledge.rerank.min_score"),
+	}
+	return cfg, true
+}
+
+func buildRerankURL(baseURL string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if strings.HasSuffix(strings.ToLower(trimmed), "/rerank") {
+		return trimmed
+	}
+	return trimmed + "/rerank"
+}
+
+// rerankHits 调用重排接口按相关度重新排序，分数替换为重排分数
+func rerankHits(
+	ctx context.Context,
+	cfg *rerankConfig,
+	query string,
+	hits []config_types.KnowledgeSearchHit,
+) ([]config_types.KnowledgeSearchHit, error) {
+	if len(hits) == 0 {
+		return hits, nil
+	}
+	documents := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		documents = append(documents, hit.Content)
+	}
+	payload := map[string]interface{}{
+		"query":     query,
+		"documents": documents,
+		"texts":     documents, // TEI(BGE) 使用 texts 字段
+		"top_n":     len(documents),
+	}
+	if cfg.Model != "" {
+		payload["model"] = cfg.Model
+	}
+	body, _ := json.Marshal(payload)
+
+	reqCtx := ctx
+	cancel := func() {}
+	if cfg.Timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+	}
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, buildRerankURL(cfg.BaseURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建rerank请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("调用rerank失败: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("rerank返回异常: %d %s", resp.StatusCode, string(respBody))
+	}
+
+	scores, err := parseRerankScores(respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]config_types.KnowledgeSearchHit, 0, len(scores))
+	seen := make(map[int]struct{}, len(scores))
+	for _, item := range scores {
+		if item.index < 0 || item.index >= len(hits) {
+			continue
+		}
+		if _, ok := seen[item.index]; ok {
+			continue
+		}
+		seen[item.index] = struct{}{}
+		if cfg.MinScore > 0 && item.score < cfg.MinScore {
+			continue
+		}
+		hit := hits[item.index]
+		hit.Score = item.score
+		ret = append(ret, hit)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Score > ret[j].Score })
+	return ret, nil
+}
+
+type rerankScore struct {
+	index int
+	score float64
+}
+
+// parseRerankScores 兼容两种返回：
+// Jina/Cohere: {"results":[{"index":0,"relevance_score":0.9}]}
+// TEI(BGE):   [{"index":0,"score":0.9}]
+func parseRerankScores(body []byte) ([]rerankScore, error) {
+	type item struct {
+		Index          int      `json:"index"`
+		RelevanceScore *float64 `json:"relevance_score"`
+		Score          *float64 `json:"score"`
+	}
+	var items []item
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("解析rerank返回失败: %w", err)
+		}
+	} else {
+		var wrapped struct {
+			Results []item `json:"results"`
+			Data    []item `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+			return nil, fmt.Errorf("解析rerank返回失败: %w", err)
+		}
+		items = wrapped.Results
+		if len(items) == 0 {
+			items = wrapped.Data
+		}
+	}
+
+	ret := make([]rerankScore, 0, len(items))
+	for _, it := range items {
+		score := 0.0
+		switch {
+		case it.RelevanceScore != nil:
+			score = *it.RelevanceScore
+		case it.Score != nil:
+			score = *it.Score
+		}
+		ret = append(ret, rerankScore{index: it.Index, score: score})
+	}
+	return ret, nil
+}
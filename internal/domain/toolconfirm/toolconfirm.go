@@ -0,0 +1,222 @@
+// Package toolconfirm 敏感工具的人工确认：按工具名解析调用策略（allow / confirm / deny），
+// 并把用户对确认问题的语音回答归类为同意、拒绝或无法判断。
+package toolconfirm
+
+import (
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 工具调用策略，对应智能体的 tool_policies 配置
+const (
+	PolicyAllow   = "allow"   // 直接执行
+	PolicyConfirm = "confirm" // 语音询问用户，回答同意后才执行
+	PolicyDeny    = "deny"    // 不提供给模型，模型仍然调用时拒绝执行
+)
+
+// 确认结果，记录在聊天历史的工具消息 metadata 中
+const (
+	DecisionPending  = "pending"  // 已询问，等待用户回答
+	DecisionApproved = "approved" // 用户同意，已执行
+	DecisionRejected = "rejected" // 用户拒绝
+	DecisionUnclear  = "unclear"  // 用户的回答不是是/否，按拒绝处理并当作新的请求
+	DecisionTimeout  = "timeout"  // 超时未回答
+	DecisionBlocked  = "blocked"  // 策略为 deny，未执行
+)
+
+// MetadataKey 确认记录在消息 Extra / 聊天历史 metadata 中的 key
+const MetadataKey = "tool_confirmation"
+
+// Record 一次确认的审计记录
+type Record struct {
+	ToolName  string     `json:"tool_name"`
+	Arguments string     `json:"arguments"`
+	Policy    string     `json:"policy"`
+	Decision  string     `json:"decision"`
+	Answer    string     `json:"answer,omitempty"` // 用户的回答原文
+	AskedAt   time.Time  `json:"asked_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"` // 等待回答时为空
+}
+
+// NormalizePolicy 归一化策略名，不认识的值返回空
+func NormalizePolicy(policy string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case PolicyAllow, PolicyConfirm, PolicyDeny:
+		return p
+	default:
+		return ""
+	}
+}
+
+// ResolvePolicy 计算工具的调用策略：工具名精确匹配优先，其次是通配模式（如 unlock_*，越长越优先），都不匹配时为 allow。
+// 工具名与模式均不区分大小写。
+func ResolvePolicy(policies map[string]string, toolName string) string {
+	name := strings.ToLower(strings.TrimSpace(toolName))
+	matched, resolved := "", PolicyAllow
+	for pattern, policy := range policies {
+		policy = NormalizePolicy(policy)
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if policy == "" || pattern == "" {
+			continue
+		}
+		if pattern == name {
+			return policy
+		}
+		if ok, err := path.Match(pattern, name); err != nil || !ok {
+			continue
+		}
+		if len(pattern) > len(matched) || (len(pattern) == len(matched) && pattern < matched) {
+			matched, resolved = pattern, policy
+		}
+	}
+	return resolved
+}
+
+// MergePolicies 合并多层策略，后面的覆盖前面的（全局默认 < 智能体）
+func MergePolicies(layers ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, layer := range layers {
+		for name, policy := range layer {
+			if p := NormalizePolicy(policy); p != "" && strings.TrimSpace(name) != "" {
+				merged[strings.ToLower(strings.TrimSpace(name))] = p
+			}
+		}
+	}
+	return merged
+}
+
+// Answer 用户回答的归类
+type Answer int
+
+const (
+	AnswerUnclear Answer = iota
+	AnswerYes
+	AnswerNo
+)
+
+var (
+	// affirmativeTokens 表示同意的完整词或短语（英文去掉空格），整句第一个分句必须完全由这些词与 fillerTokens 组成才算同意；
+	// 含否定字但表示同意的说法（没问题、no problem）也在这里，先于否定判断
+	affirmativeTokens = []string{
+		"是", "对", "好", "行", "可以", "确定", "确认", "执行", "同意", "嗯", "要", "开始", "当然", "好嘞", "没问题", "没错", "不错",
+		"係", "得", "冇问题", "冇错",
+		"はい", "ええ", "うん", "いいよ", "いいです", "お願い", "お願いします", "どうぞ", "大丈夫", "問題ない", "問題ありません",
+		"네", "예", "응", "좋아", "좋아요", "그래", "그래요", "해줘", "해주세요", "문제없어", "문제없어요",
+		"yes", "yeah", "yep", "yup", "sure", "ok", "okay", "confirm", "confirmed", "proceed", "alright", "right", "correct",
+		"goahead", "doit", "pleasedo", "goforit", "ofcourse", "soundsgood", "noproblem", "whynot",
+	}
+	// fillerTokens 可以跟在同意后面的语气词与客套话，单独出现不算同意
+	fillerTokens = []string{
+		"的", "了", "啊", "呀", "吧", "哦", "噢", "喔", "嘛", "啦", "呗", "哈", "请", "谢谢", "麻烦你", "唔该",
+		"です", "ね", "よ", "요",
+		"please", "thanks", "thankyou", "now",
+	}
+	negativeMarkers = []string{
+		"不", "别", "没", "取消", "算了", "停", "等等", "等一下", "唔", "咪住", "冇",
+		"いいえ", "いや", "やめ", "キャンセル", "だめ", "ダメ", "結構です",
+		"아니", "취소", "하지 마", "하지마", "싫어", "안 돼", "안돼",
+	}
+	enNegative = map[string]bool{"no": true, "nope": true, "nah": true, "don't": true, "dont": true, "cancel": true, "stop": true, "wait": true, "never": true, "not": true}
+)
+
+// ClassifyAnswer 把用户对确认问题的回答归类为同意 / 拒绝 / 无法判断。
+// 只有简短（IsShortAnswer）且第一个分句完全由同意词和语气词组成的回答才算同意，如"好的""是的，开吧""yes, go ahead"；
+// "我想要听音乐""please play some music"这类只是包含同意字眼的句子不算。含否定词的回答算拒绝，其余都无法判断。
+func ClassifyAnswer(text string) Answer {
+	normalized := strings.ToLower(strings.TrimSpace(text))
+	if normalized == "" {
+		return AnswerUnclear
+	}
+	clauses := strings.FieldsFunc(normalized, func(r rune) bool {
+		return unicode.IsPunct(r) && r != '\'' || unicode.IsSymbol(r)
+	})
+	if len(clauses) == 0 {
+		return AnswerUnclear
+	}
+	yes := IsShortAnswer(text) && clauseCoverage(clauses[0]) == 2
+	rest := clauses
+	if yes {
+		// 第一个分句已确认是同意词（其中可能有"没问题"这类含否定字的说法），只检查后面的分句
+		rest = clauses[1:]
+	}
+	for _, clause := range rest {
+		// "唔该""没问题"这类只由同意词和语气词组成的分句虽含否定字，不算拒绝
+		if clauseCoverage(clause) == 0 && isNegativeClause(clause) {
+			return AnswerNo
+		}
+	}
+	if yes {
+		return AnswerYes
+	}
+	return AnswerUnclear
+}
+
+// clauseCoverage 判断分句（去掉空格后）能否完全切分为同意词与语气词：
+// 0 表示不能，1 表示只由语气词组成，2 表示至少包含一个同意词
+func clauseCoverage(clause string) int {
+	s := strings.Join(strings.Fields(clause), "")
+	if s == "" {
+		return 0
+	}
+	// reach[i] 表示 s[:i] 的切分结果，取值含义同返回值
+	reach := make([]int, len(s)+1)
+	reach[0] = 1
+	for i := 0; i < len(s); i++ {
+		if reach[i] == 0 {
+			continue
+		}
+		for _, token := range affirmativeTokens {
+			if strings.HasPrefix(s[i:], token) {
+				reach[i+len(token)] = 2
+			}
+		}
+		for _, token := range fillerTokens {
+			if strings.HasPrefix(s[i:], token) && reach[i+len(token)] < reach[i] {
+				reach[i+len(token)] = reach[i]
+			}
+		}
+	}
+	return reach[len(s)]
+}
+
+func isNegativeClause(clause string) bool {
+	words := strings.FieldsFunc(clause, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	for _, w := range words {
+		if enNegative[w] {
+			return true
+		}
+	}
+	for _, marker := range negativeMarkers {
+		if strings.Contains(clause, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsShortAnswer 回答是否只是简短的是/否（中日韩不超过 8 个字，英文不超过 4 个词）。
+// 较长的回答通常带有新的要求，拒绝确认后仍应作为普通对话处理。
+func IsShortAnswer(text string) bool {
+	text = strings.TrimSpace(text)
+	letters, words := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			letters++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return letters <= 8 && words <= 4
+}
@@ -0,0 +1,100 @@
+package toolconfirm
+
+import "testing"
+
+func TestResolvePolicy(t *testing.T) {
+	policies := map[string]string{
+		"unlock_door":  "confirm",
+		"Send_*":       "confirm",
+		"send_sms_*":   "deny",
+		"*":            "allow",
+		"play_music":   "invalid",
+		"get_weather":  "DENY",
+		"turn_off_all": " deny ",
+	}
+	cases := map[string]string{
+		"unlock_door":     PolicyConfirm,
+		"UNLOCK_DOOR":     PolicyConfirm,
+		"send_message":    PolicyConfirm,
+		"send_sms_friend": PolicyDeny,
+		"play_music":      PolicyAllow, // 非法值忽略，落到 *
+		"get_weather":     PolicyDeny,
+		"turn_off_all":    PolicyDeny,
+		"set_volume":      PolicyAllow,
+	}
+	for tool, want := range cases {
+		if got := ResolvePolicy(policies, tool); got != want {
+			t.Errorf("ResolvePolicy(%s) = %s, want %s", tool, got, want)
+		}
+	}
+	if got := ResolvePolicy(nil, "unlock_door"); got != PolicyAllow {
+		t.Fatalf("empty policies should allow, got %s", got)
+	}
+}
+
+func TestMergePolicies(t *testing.T) {
+	merged := MergePolicies(
+		map[string]string{"unlock_*": "confirm", "send_message": "confirm"},
+		map[string]string{"Send_Message": "allow", "bad": "maybe"},
+	)
+	if merged["send_message"] != PolicyAllow || merged["unlock_*"] != PolicyConfirm {
+		t.Fatalf("agent policies should override global ones: %v", merged)
+	}
+	if _, ok := merged["bad"]; ok {
+		t.Fatalf("invalid policy should be dropped: %v", merged)
+	}
+}
+
+func TestClassifyAnswer(t *testing.T) {
+	cases := map[string]Answer{
+		"好的":                           AnswerYes,
+		"是的，开吧":                        AnswerYes,
+		"确定":                           AnswerYes,
+		"没问题":                          AnswerYes,
+		"嗯":                            AnswerYes,
+		"不要":                           AnswerNo,
+		"不用了":                          AnswerNo,
+		"算了吧":                          AnswerNo,
+		"不确定":                          AnswerNo,
+		"别开":                           AnswerNo,
+		"好，唔该":                         AnswerYes,
+		"唔好":                           AnswerNo,
+		"Yes, go ahead.":               AnswerYes,
+		"okay":                         AnswerYes,
+		"No problem":                   AnswerYes,
+		"no thanks":                    AnswerNo,
+		"don't do it":                  AnswerNo,
+		"はい、お願いします":                    AnswerYes,
+		"いいえ":                          AnswerNo,
+		"네":                            AnswerYes,
+		"아니요":                          AnswerNo,
+		"今天天气怎么样":                      AnswerUnclear,
+		"what's the weather":           AnswerUnclear,
+		"我想要听音乐":                       AnswerUnclear,
+		"你说的是哪个门":                      AnswerUnclear,
+		"帮我查一下明天的天气好吗":                 AnswerUnclear,
+		"please play some music":       AnswerUnclear,
+		"go back to the previous song": AnswerUnclear,
+		"yes please":                   AnswerYes,
+		"好的，开吧":                        AnswerYes,
+		"":                             AnswerUnclear,
+	}
+	for text, want := range cases {
+		if got := ClassifyAnswer(text); got != want {
+			t.Errorf("ClassifyAnswer(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestIsShortAnswer(t *testing.T) {
+	for _, text := range []string{"好的", "不用了，谢谢", "yes please", "はい、お願いします"} {
+		if !IsShortAnswer(text) {
+			t.Errorf("%q should be a short answer", text)
+		}
+	}
+	for _, text := range []string{"不是，我是说打开卧室的灯", "no, I meant the bedroom light please"} {
+		if IsShortAnswer(text) {
+			t.Errorf("%q should not be a short answer", text)
+		}
+	}
+}
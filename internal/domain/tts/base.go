@@ -12,6 +12,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge_offline"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/minimax"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/mock"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/openai"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/qwen"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/xiaozhi"
@@ -74,6 +75,8 @@ func GetTTSProvider(providerName string, config map[string]interface{}) (TTSProv
 		baseProvider = qwen.NewQwenTTSProvider(config)
 	case constants.TtsTypeIndexTTSVLLM:
 		baseProvider = openai.NewOpenAITTSProvider(buildIndexTTSOpenAIConfig(config))
+	case constants.TtsTypeMock:
+		baseProvider = mock.NewMockTTSProvider(config)
 	default:
 		return nil, fmt.Errorf("不支持的TTS提供者: %s", effectiveName)
 	}
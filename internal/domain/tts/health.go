@@ -0,0 +1,98 @@
+package tts
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 30 * time.Second
+)
+
+// ProviderHealth 单个TTS配置（按配置指纹区分）的健康状态
+type ProviderHealth struct {
+	Label               string    `json:"label"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	TotalFailures       int64     `json:"total_failures"`
+	TotalSuccesses      int64     `json:"total_successes"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastFailureAt       time.Time `json:"last_failure_at,omitempty"`
+	UnhealthyUntil      time.Time `json:"unhealthy_until,omitempty"`
+}
+
+var (
+	healthMu     sync.Mutex
+	healthStates = make(map[string]*ProviderHealth)
+)
+
+func healthState(key, label string) *ProviderHealth {
+	state, ok := healthStates[key]
+	if !ok {
+		state = &ProviderHealth{Label: label}
+		healthStates[key] = state
+	}
+	if label != "" {
+		state.Label = label
+	}
+	return state
+}
+
+// ReportSuccess 记录一次合成成功，清零连续失败次数并恢复可用
+func ReportSuccess(key, label string) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	state := healthState(key, label)
+	state.ConsecutiveFailures = 0
+	state.TotalSuccesses++
+	state.UnhealthyUntil = time.Time{}
+}
+
+// ReportFailure 记录一次合成失败；连续失败达到 tts.failover.failure_threshold 后在冷却期内标记为不可用
+func ReportFailure(key, label string, err error) {
+	threshold := viper.GetInt("tts.failover.failure_threshold")
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	cooldown := time.Duration(viper.GetInt("tts.failover.cooldown_seconds")) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	state := healthState(key, label)
+	state.ConsecutiveFailures++
+	state.TotalFailures++
+	state.LastFailureAt = time.Now()
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	if state.ConsecutiveFailures >= threshold {
+		state.UnhealthyUntil = state.LastFailureAt.Add(cooldown)
+	}
+}
+
+// IsHealthy 是否可用：未记录过或不在冷却期内
+func IsHealthy(key string) bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	state, ok := healthStates[key]
+	if !ok {
+		return true
+	}
+	return !time.Now().Before(state.UnhealthyUntil)
+}
+
+// HealthSnapshot 返回所有TTS配置的健康状态快照
+func HealthSnapshot() map[string]ProviderHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	result := make(map[string]ProviderHealth, len(healthStates))
+	for key, state := range healthStates {
+		result[key] = *state
+	}
+	return result
+}
@@ -0,0 +1,33 @@
+package tts
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestProviderHealth(t *testing.T) {
+	viper.Set("tts.failover.failure_threshold", 2)
+	defer viper.Set("tts.failover.failure_threshold", nil)
+
+	key := "health-test"
+	if !IsHealthy(key) {
+		t.Fatalf("unknown provider should be healthy")
+	}
+	ReportFailure(key, "doubao_ws", errors.New("timeout"))
+	if !IsHealthy(key) {
+		t.Fatalf("single failure should not trip the breaker")
+	}
+	ReportFailure(key, "doubao_ws", errors.New("timeout"))
+	if IsHealthy(key) {
+		t.Fatalf("provider should be unhealthy after reaching threshold")
+	}
+	if state := HealthSnapshot()[key]; state.ConsecutiveFailures != 2 || state.LastError != "timeout" || state.Label != "doubao_ws" {
+		t.Fatalf("unexpected health state: %+v", state)
+	}
+	ReportSuccess(key, "doubao_ws")
+	if !IsHealthy(key) {
+		t.Fatalf("success should restore provider")
+	}
+}
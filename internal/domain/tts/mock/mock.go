@@ -0,0 +1,191 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	defaultFrequency  = 440.0
+	defaultAmplitude  = 0.3
+	defaultMsPerChar  = 80
+	defaultMinMs      = 200
+	defaultMaxMs      = 10000
+	maxOpusPacketSize = 4000
+)
+
+// MockTTSProvider 合成固定频率的正弦测试音，不访问任何外部服务，用于端到端测试和压测
+// 音频时长按文本字符数计算，相同文本总是得到相同的帧数
+// 配置参数：frequency（Hz，默认 440）、amplitude（0~1，默认 0.3）、ms_per_char（默认 80）、min_ms、max_ms
+type MockTTSProvider struct {
+	Frequency float64
+	Amplitude float64
+	MsPerChar int
+	MinMs     int
+	MaxMs     int
+}
+
+// NewMockTTSProvider 创建 MockTTSProvider
+func NewMockTTSProvider(config map[string]interface{}) *MockTTSProvider {
+	return &MockTTSProvider{
+		Frequency: getFloat(config, "frequency", defaultFrequency),
+		Amplitude: getFloat(config, "amplitude", defaultAmplitude),
+		MsPerChar: getInt(config, "ms_per_char", defaultMsPerChar),
+		MinMs:     getInt(config, "min_ms", defaultMinMs),
+		MaxMs:     getInt(config, "max_ms", defaultMaxMs),
+	}
+}
+
+func getInt(config map[string]interface{}, key string, defaultValue int) int {
+	switch value := config[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return defaultValue
+}
+
+func getFloat(config map[string]interface{}, key string, defaultValue float64) float64 {
+	switch value := config[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+	return defaultValue
+}
+
+// Duration 返回文本对应的音频时长（毫秒）
+func (p *MockTTSProvider) Duration(text string) int {
+	ms := utf8.RuneCountInString(text) * p.MsPerChar
+	if ms < p.MinMs {
+		ms = p.MinMs
+	}
+	if p.MaxMs > 0 && ms > p.MaxMs {
+		ms = p.MaxMs
+	}
+	return ms
+}
+
+// TextToSpeech 一次性合成，返回Opus帧
+func (p *MockTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	var frames [][]byte
+	err := p.synthesize(ctx, text, sampleRate, channels, frameDuration, func(frame []byte) bool {
+		frames = append(frames, frame)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// TextToSpeechStream 流式合成，返回Opus帧chan
+func (p *MockTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	encoder, err := newEncoder(sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	outputChan := make(chan []byte, 100)
+	go func() {
+		defer close(outputChan)
+		err := p.encodeTone(ctx, encoder, text, sampleRate, channels, frameDuration, func(frame []byte) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case outputChan <- frame:
+				return true
+			}
+		})
+		if err != nil {
+			log.Errorf("mock tts 合成失败: %v", err)
+		}
+	}()
+	return outputChan, nil
+}
+
+func newEncoder(sampleRate, channels, frameDuration int) (*opus.Encoder, error) {
+	if sampleRate <= 0 || channels <= 0 || frameDuration <= 0 {
+		return nil, fmt.Errorf("无效的音频参数: sampleRate=%d, channels=%d, frameDuration=%d", sampleRate, channels, frameDuration)
+	}
+	encoder, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("创建opus编码器失败: %v", err)
+	}
+	return encoder, nil
+}
+
+func (p *MockTTSProvider) synthesize(ctx context.Context, text string, sampleRate, channels, frameDuration int, emit func([]byte) bool) error {
+	encoder, err := newEncoder(sampleRate, channels, frameDuration)
+	if err != nil {
+		return err
+	}
+	return p.encodeTone(ctx, encoder, text, sampleRate, channels, frameDuration, emit)
+}
+
+// encodeTone 按帧生成正弦波并编码，首尾各 10ms 淡入淡出，避免爆音
+func (p *MockTTSProvider) encodeTone(ctx context.Context, encoder *opus.Encoder, text string, sampleRate, channels, frameDuration int, emit func([]byte) bool) error {
+	samplesPerFrame := sampleRate * frameDuration / 1000
+	frameCount := (p.Duration(text) + frameDuration - 1) / frameDuration
+	total := frameCount * samplesPerFrame
+	fade := sampleRate / 100
+	pcm := make([]int16, samplesPerFrame*channels)
+	for i := 0; i < frameCount; i++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		for j := 0; j < samplesPerFrame; j++ {
+			n := i*samplesPerFrame + j
+			gain := p.Amplitude
+			if n < fade {
+				gain *= float64(n) / float64(fade)
+			} else if total-n < fade {
+				gain *= float64(total-n) / float64(fade)
+			}
+			v := int16(gain * math.MaxInt16 * math.Sin(2*math.Pi*p.Frequency*float64(n)/float64(sampleRate)))
+			for c := 0; c < channels; c++ {
+				pcm[j*channels+c] = v
+			}
+		}
+		buf := make([]byte, maxOpusPacketSize)
+		size, err := encoder.Encode(pcm, buf)
+		if err != nil {
+			return fmt.Errorf("opus编码失败: %v", err)
+		}
+		if !emit(buf[:size]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// SetVoice 通过 frequency 调整测试音频率，便于区分不同音色
+func (p *MockTTSProvider) SetVoice(voiceConfig map[string]interface{}) error {
+	frequency := getFloat(voiceConfig, "frequency", 0)
+	if frequency <= 0 {
+		return fmt.Errorf("无效的音色配置: 缺少 frequency")
+	}
+	p.Frequency = frequency
+	return nil
+}
+
+// Close 关闭资源（无状态 Provider，无需关闭）
+func (p *MockTTSProvider) Close() error {
+	return nil
+}
+
+// IsValid 检查资源是否有效
+func (p *MockTTSProvider) IsValid() bool {
+	return p != nil
+}
@@ -0,0 +1,214 @@
+package textnorm
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	reCodeFence    = regexp.MustCompile("```[A-Za-z0-9_+-]*")
+	reImage        = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	reLink         = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	reHTMLTag      = regexp.MustCompile(`</?[A-Za-z][^>]*>`)
+	reHeading      = regexp.MustCompile(`(?m)^[ \t]*#{1,6}[ \t]*`)
+	reBlockquote   = regexp.MustCompile(`(?m)^[ \t]*>+[ \t]?`)
+	reBullet       = regexp.MustCompile(`(?m)^[ \t]*[-*+•][ \t]+`)
+	reOrderedItem  = regexp.MustCompile(`(?m)^[ \t]*(\d{1,2})[.)][ \t]+`)
+	reTableDivider = regexp.MustCompile(`(?m)^[ \t]*\|?[ \t]*:?-{3,}:?[ \t]*(\|[ \t]*:?-{3,}:?[ \t]*)*\|?[ \t]*$`)
+	reHorizontal   = regexp.MustCompile(`(?m)^[ \t]*([-*_][ \t]*){3,}$`)
+	reEmphasis     = regexp.MustCompile(`\*\*|__|~~`)
+
+	reURL   = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'，。！？、；）)\]]+`)
+	reEmail = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+\b`)
+)
+
+// stripMarkdown 去掉 markdown 标记，保留可朗读的文字
+func stripMarkdown(text string, opts Options) string {
+	text = reCodeFence.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "`", "")
+	text = reImage.ReplaceAllString(text, "$1")
+	text = reLink.ReplaceAllString(text, "$1")
+	text = reHTMLTag.ReplaceAllString(text, " ")
+	text = reTableDivider.ReplaceAllString(text, "")
+	text = reHorizontal.ReplaceAllString(text, "")
+	text = reHeading.ReplaceAllString(text, "")
+	text = reBlockquote.ReplaceAllString(text, "")
+	text = reBullet.ReplaceAllString(text, "")
+	if isCJKLanguage(opts.Language) {
+		text = reOrderedItem.ReplaceAllString(text, "${1}、")
+	} else {
+		text = reOrderedItem.ReplaceAllString(text, "${1}, ")
+	}
+	text = reEmphasis.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "|", " ")
+	return stripLooseAsterisks(text)
+}
+
+// stripLooseAsterisks 去掉剩余的 * 强调符，保留数字之间的乘号
+func stripLooseAsterisks(text string) string {
+	if !strings.Contains(text, "*") {
+		return text
+	}
+	runes := []rune(text)
+	var b strings.Builder
+	b.Grow(len(text))
+	for i, r := range runes {
+		if r == '*' {
+			if i > 0 && i < len(runes)-1 && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]) {
+				b.WriteRune('×')
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// stripEmoji 去掉 emoji 及其修饰符（变体选择符、零宽连接符、肤色、旗帜）
+func stripEmoji(text string, _ Options) string {
+	return strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // 表情、符号、旗帜、扩展象形
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // 杂项符号与 dingbats
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // ⭐ ⬆ 等
+		return true
+	case r >= 0x2300 && r <= 0x23FF: // ⌚ ⏰ 等
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r == 0x200D, r == 0x20E3:
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // 标签序列
+		return true
+	case r == 0x3030 || r == 0x303D || r == 0x3297 || r == 0x3299:
+		return true
+	}
+	return false
+}
+
+// verbalizeURLs 将 URL 替换为域名读法，邮箱读作 "用户名 at 域名"
+func verbalizeURLs(text string, opts Options) string {
+	dot, at := urlWords(opts.Language)
+	text = reURL.ReplaceAllStringFunc(text, func(raw string) string {
+		host := raw
+		if !strings.Contains(strings.ToLower(raw), "://") {
+			host = "http://" + raw
+		}
+		if u, err := url.Parse(host); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		} else {
+			host = raw
+		}
+		host = strings.TrimPrefix(strings.ToLower(host), "www.")
+		return " " + strings.ReplaceAll(host, ".", dot) + " "
+	})
+	return reEmail.ReplaceAllStringFunc(text, func(raw string) string {
+		user, domain, _ := strings.Cut(raw, "@")
+		return " " + strings.ReplaceAll(user, ".", dot) + at + strings.ReplaceAll(domain, ".", dot) + " "
+	})
+}
+
+func urlWords(lang string) (dot, at string) {
+	switch lang {
+	case "en":
+		return " dot ", " at "
+	case "ja":
+		return "ドット", "アット"
+	case "ko":
+		return "닷", "골뱅이"
+	default:
+		return "点", "艾特"
+	}
+}
+
+var builtinAbbreviations = map[string]map[string]string{
+	"zh": {
+		"e.g.": "例如",
+		"i.e.": "即",
+		"etc.": "等",
+		"vs.":  "对比",
+		"vs":   "对比",
+		"P.S.": "附言",
+	},
+	"en": {
+		"e.g.":    "for example",
+		"i.e.":    "that is",
+		"etc.":    "et cetera",
+		"vs.":     "versus",
+		"vs":      "versus",
+		"Mr.":     "Mister",
+		"Mrs.":    "Missus",
+		"Dr.":     "Doctor",
+		"St.":     "Street",
+		"approx.": "approximately",
+		"P.S.":    "P S",
+	},
+}
+
+// expandAbbreviations 按单词边界展开缩写，配置的缩写覆盖内置缩写
+func expandAbbreviations(text string, opts Options) string {
+	lang := opts.Language
+	if isCJKLanguage(lang) {
+		lang = "zh"
+	}
+	table := make(map[string]string, len(builtinAbbreviations[lang])+len(opts.Abbreviations))
+	for k, v := range builtinAbbreviations[lang] {
+		table[k] = v
+	}
+	for k, v := range opts.Abbreviations {
+		table[k] = v
+	}
+	if len(table) == 0 {
+		return text
+	}
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	// 长缩写优先，避免 "vs." 被 "vs" 抢先匹配
+	sortByLengthDesc(keys)
+	for _, key := range keys {
+		text = replaceWord(text, key, table[key])
+	}
+	return text
+}
+
+// replaceWord 仅在前后均不是 ASCII 字母时替换，避免误伤单词内部（如 canvas 中的 vs）
+func replaceWord(text, word, replacement string) string {
+	if word == "" || !strings.Contains(text, word) {
+		return text
+	}
+	var b strings.Builder
+	for {
+		idx := strings.Index(text, word)
+		if idx < 0 {
+			b.WriteString(text)
+			break
+		}
+		end := idx + len(word)
+		before := idx == 0 || !isASCIILetter(text[idx-1])
+		after := end >= len(text) || !isASCIILetter(text[end]) || !isASCIILetter(word[len(word)-1])
+		b.WriteString(text[:idx])
+		if before && after {
+			b.WriteString(replacement)
+		} else {
+			b.WriteString(word)
+		}
+		text = text[end:]
+	}
+	return b.String()
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,202 @@
+package textnorm
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reThousands = regexp.MustCompile(`\b\d{1,3}(?:,\d{3})+\b`)
+	reDate      = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	reYear      = regexp.MustCompile(`\b(\d{4})年`)
+	reTime      = regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?::(\d{2}))?\b`)
+	reCurrency  = regexp.MustCompile(`([¥￥$€£])\s?(\d+(?:\.\d+)?)`)
+	reCurrCode  = regexp.MustCompile(`(\d+(?:\.\d+)?)\s?(USD|RMB|CNY|EUR|GBP|JPY)\b`)
+	rePercent   = regexp.MustCompile(`(-?\d+(?:\.\d+)?)\s?([%％‰])`)
+	reRange     = regexp.MustCompile(`\b([1-9]\d{0,3}|0)(\.\d+)?\s?[-~～]\s?(\d{1,4}(?:\.\d+)?)`)
+	reUnit      = regexp.MustCompile(`(-?\d+(?:\.\d+)?)\s?(km/h|m/s|kWh|kg|mg|km|cm|mm|ml|mL|min|kW|℃|°C|°F|°|g|m|L|W)`)
+	reDecimal   = regexp.MustCompile(`-?\d+\.\d+`)
+	reNegative  = regexp.MustCompile(`-\d+`)
+	reLongDigit = regexp.MustCompile(`\d{11,}|0\d{2,}`)
+)
+
+// verbalizeNumbers 只处理有歧义或易读错的形式（日期、时间、货币、百分比、范围、单位、小数、负数、电话等长串数字），
+// 普通整数交给 TTS 引擎自行朗读，避免 "2个" 被读成 "二个"
+func verbalizeNumbers(text string, opts Options) string {
+	var v verbalizer
+	switch {
+	case isCJKLanguage(opts.Language):
+		v = zhVerbalizer{}
+	case opts.Language == "en":
+		v = enVerbalizer{}
+	default:
+		return text
+	}
+
+	text = reThousands.ReplaceAllStringFunc(text, func(s string) string {
+		return strings.ReplaceAll(s, ",", "")
+	})
+	text = replaceSubmatch(reDate, text, func(m []string, _ string, _ string) (string, bool) {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return "", false
+		}
+		return v.date(year, month, day), true
+	})
+	if _, ok := v.(zhVerbalizer); ok {
+		text = reYear.ReplaceAllStringFunc(text, func(s string) string {
+			return zhDigitString(strings.TrimSuffix(s, "年")) + "年"
+		})
+	}
+	text = replaceSubmatch(reTime, text, func(m []string, before, _ string) (string, bool) {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		second := -1
+		if m[3] != "" {
+			second, _ = strconv.Atoi(m[3])
+		}
+		if hour > 24 || minute > 59 || second > 59 || strings.HasSuffix(before, ":") {
+			return "", false
+		}
+		return v.time(hour, minute, second), true
+	})
+	text = replaceSubmatch(reCurrency, text, func(m []string, _, _ string) (string, bool) {
+		return v.money(m[2], currencyCode(m[1])), true
+	})
+	text = replaceSubmatch(reCurrCode, text, func(m []string, _, _ string) (string, bool) {
+		return v.money(m[1], m[2]), true
+	})
+	text = replaceSubmatch(rePercent, text, func(m []string, before, _ string) (string, bool) {
+		if endsWithDigit(before) {
+			return "", false
+		}
+		return v.percent(m[1], m[2] == "‰"), true
+	})
+	text = replaceSubmatch(reRange, text, func(m []string, before, after string) (string, bool) {
+		// 电话号码、版本号等不按范围处理
+		if endsWithDigit(before) || strings.HasSuffix(before, "-") || strings.HasPrefix(after, "-") || startsWithDigit(after) {
+			return "", false
+		}
+		return m[1] + m[2] + v.rangeWord() + m[3], true
+	})
+	text = replaceSubmatch(reUnit, text, func(m []string, before, after string) (string, bool) {
+		if endsWithDigit(before) || endsWithLetter(before) || startsWithLetter(after) {
+			return "", false
+		}
+		if strings.HasPrefix(m[1], "-") && endsWithDigitOrLetter(before) {
+			return "", false
+		}
+		return v.measure(m[1], m[2]), true
+	})
+	text = replaceSubmatch(reDecimal, text, func(m []string, before, after string) (string, bool) {
+		// IP 地址、版本号不处理
+		if strings.HasSuffix(before, ".") || strings.HasPrefix(after, ".") || endsWithLetter(before) {
+			return "", false
+		}
+		if strings.HasPrefix(m[0], "-") && endsWithDigitOrLetter(before) {
+			return v.number(m[0][1:]), true
+		}
+		return v.number(m[0]), true
+	})
+	text = replaceSubmatch(reNegative, text, func(m []string, before, after string) (string, bool) {
+		if endsWithDigitOrLetter(before) || startsWithDigit(after) {
+			return "", false
+		}
+		return v.number(m[0]), true
+	})
+	text = replaceSubmatch(reLongDigit, text, func(m []string, before, after string) (string, bool) {
+		if endsWithDigit(before) || startsWithDigit(after) {
+			return "", false
+		}
+		return v.digits(m[0]), true
+	})
+	return text
+}
+
+// replaceSubmatch 逐个处理匹配项，fn 可借助匹配前后的文本判断边界，返回 false 时保留原文
+func replaceSubmatch(re *regexp.Regexp, text string, fn func(m []string, before, after string) (string, bool)) string {
+	indexes := re.FindAllStringSubmatchIndex(text, -1)
+	if len(indexes) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range indexes {
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		replacement, ok := fn(m, text[:loc[0]], text[loc[1]:])
+		b.WriteString(text[last:loc[0]])
+		if ok {
+			b.WriteString(replacement)
+		} else {
+			b.WriteString(m[0])
+		}
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func currencyCode(symbol string) string {
+	switch symbol {
+	case "$":
+		return "USD"
+	case "€":
+		return "EUR"
+	case "£":
+		return "GBP"
+	default:
+		return "CNY"
+	}
+}
+
+func lastByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[len(s)-1]
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[0]
+}
+
+func isDigitByte(c byte) bool { return c >= '0' && c <= '9' }
+
+func endsWithDigit(s string) bool         { return isDigitByte(lastByte(s)) }
+func startsWithDigit(s string) bool       { return isDigitByte(firstByte(s)) }
+func endsWithLetter(s string) bool        { return isASCIILetter(lastByte(s)) }
+func startsWithLetter(s string) bool      { return isASCIILetter(firstByte(s)) }
+func endsWithDigitOrLetter(s string) bool { return endsWithDigit(s) || endsWithLetter(s) }
+
+// verbalizer 各语言的数字读法
+type verbalizer interface {
+	number(s string) string // 整数或小数，可带负号
+	digits(s string) string // 逐位朗读
+	date(year, month, day int) string
+	time(hour, minute, second int) string
+	money(amount, code string) string
+	percent(s string, permille bool) string
+	measure(value, unit string) string
+	rangeWord() string
+}
+
+// splitNumber 拆分为符号、整数部分、小数部分
+func splitNumber(s string) (negative bool, intPart, fracPart string) {
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	}
+	intPart, fracPart, _ = strings.Cut(s, ".")
+	return negative, intPart, fracPart
+}
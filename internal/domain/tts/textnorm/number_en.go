@@ -0,0 +1,241 @@
+package textnorm
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var enOnes = []string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+	"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen",
+}
+
+var enTens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+
+// 单位读法：单数、复数
+var enUnitWords = map[string][2]string{
+	"km/h": {"kilometer per hour", "kilometers per hour"},
+	"m/s":  {"meter per second", "meters per second"},
+	"kWh":  {"kilowatt-hour", "kilowatt-hours"},
+	"kg":   {"kilogram", "kilograms"},
+	"mg":   {"milligram", "milligrams"},
+	"km":   {"kilometer", "kilometers"},
+	"cm":   {"centimeter", "centimeters"},
+	"mm":   {"millimeter", "millimeters"},
+	"ml":   {"milliliter", "milliliters"},
+	"mL":   {"milliliter", "milliliters"},
+	"min":  {"minute", "minutes"},
+	"kW":   {"kilowatt", "kilowatts"},
+	"℃":    {"degree Celsius", "degrees Celsius"},
+	"°C":   {"degree Celsius", "degrees Celsius"},
+	"°F":   {"degree Fahrenheit", "degrees Fahrenheit"},
+	"°":    {"degree", "degrees"},
+	"g":    {"gram", "grams"},
+	"m":    {"meter", "meters"},
+	"L":    {"liter", "liters"},
+	"W":    {"watt", "watts"},
+}
+
+// 货币读法：主单位单数、复数，辅币单数、复数
+var enCurrencyWords = map[string][4]string{
+	"USD": {"dollar", "dollars", "cent", "cents"},
+	"EUR": {"euro", "euros", "cent", "cents"},
+	"GBP": {"pound", "pounds", "penny", "pence"},
+	"CNY": {"yuan", "yuan", "fen", "fen"},
+	"RMB": {"yuan", "yuan", "fen", "fen"},
+	"JPY": {"yen", "yen", "sen", "sen"},
+}
+
+type enVerbalizer struct{}
+
+func (enVerbalizer) number(s string) string {
+	negative, intPart, fracPart := splitNumber(s)
+	var b strings.Builder
+	if negative {
+		b.WriteString("minus ")
+	}
+	b.WriteString(enInteger(intPart))
+	if fracPart != "" {
+		b.WriteString(" point ")
+		b.WriteString(enDigitString(fracPart))
+	}
+	return b.String()
+}
+
+func (enVerbalizer) digits(s string) string {
+	return enDigitString(s)
+}
+
+func (enVerbalizer) date(year, month, day int) string {
+	return time.Month(month).String() + " " + enOrdinal(int64(day)) + ", " + enYear(year)
+}
+
+func (enVerbalizer) time(hour, minute, second int) string {
+	var b strings.Builder
+	b.WriteString(enCardinal(int64(hour)))
+	switch {
+	case minute == 0:
+		b.WriteString(" o'clock")
+	case minute < 10:
+		b.WriteString(" oh ")
+		b.WriteString(enOnes[minute])
+	default:
+		b.WriteString(" ")
+		b.WriteString(enCardinal(int64(minute)))
+	}
+	if second > 0 {
+		b.WriteString(" and ")
+		b.WriteString(enPlural(int64(second), "second", "seconds"))
+	}
+	return b.String()
+}
+
+func (v enVerbalizer) money(amount, code string) string {
+	words := enCurrencyWords[code]
+	_, intPart, fracPart := splitNumber(amount)
+	n, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || len(fracPart) > 2 {
+		return v.number(amount) + " " + words[1]
+	}
+	result := enPlural(n, words[0], words[1])
+	if fracPart == "" {
+		return result
+	}
+	if len(fracPart) == 1 {
+		fracPart += "0"
+	}
+	cents, _ := strconv.ParseInt(fracPart, 10, 64)
+	if cents == 0 {
+		return result
+	}
+	return result + " and " + enPlural(cents, words[2], words[3])
+}
+
+func (v enVerbalizer) percent(s string, permille bool) string {
+	if permille {
+		return v.number(s) + " per mille"
+	}
+	return v.number(s) + " percent"
+}
+
+func (v enVerbalizer) measure(value, unit string) string {
+	words := enUnitWords[unit]
+	if value == "1" || value == "-1" {
+		return v.number(value) + " " + words[0]
+	}
+	return v.number(value) + " " + words[1]
+}
+
+func (enVerbalizer) rangeWord() string {
+	return " to "
+}
+
+func enPlural(n int64, singular, plural string) string {
+	if n == 1 {
+		return enCardinal(n) + " " + singular
+	}
+	return enCardinal(n) + " " + plural
+}
+
+func enDigitString(s string) string {
+	words := make([]string, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			words = append(words, enOnes[r-'0'])
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func enInteger(s string) string {
+	if len(s) > 1 && s[0] == '0' {
+		return enDigitString(s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n >= 1e15 {
+		return enDigitString(s)
+	}
+	return enCardinal(n)
+}
+
+// enCardinal 整数读法，如 1234 -> one thousand two hundred thirty-four
+func enCardinal(n int64) string {
+	if n < 0 {
+		return "minus " + enCardinal(-n)
+	}
+	if n < 100 {
+		return enUnder100(int(n))
+	}
+	scales := []struct {
+		value int64
+		word  string
+	}{
+		{1e12, "trillion"},
+		{1e9, "billion"},
+		{1e6, "million"},
+		{1e3, "thousand"},
+		{1e2, "hundred"},
+	}
+	var parts []string
+	for _, scale := range scales {
+		if n >= scale.value {
+			parts = append(parts, enCardinal(n/scale.value)+" "+scale.word)
+			n %= scale.value
+		}
+	}
+	if n > 0 {
+		parts = append(parts, enUnder100(int(n)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func enUnder100(n int) string {
+	if n < 20 {
+		return enOnes[n]
+	}
+	if n%10 == 0 {
+		return enTens[n/10]
+	}
+	return enTens[n/10] + "-" + enOnes[n%10]
+}
+
+// enOrdinal 序数词，如 16 -> sixteenth，22 -> twenty-second
+func enOrdinal(n int64) string {
+	cardinal := enCardinal(n)
+	cut := strings.LastIndexAny(cardinal, " -") + 1
+	last := cardinal[cut:]
+	irregular := map[string]string{
+		"one": "first", "two": "second", "three": "third", "five": "fifth",
+		"eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+	}
+	switch {
+	case irregular[last] != "":
+		last = irregular[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+	return cardinal[:cut] + last
+}
+
+// enYear 年份读法，如 2026 -> twenty twenty-six，1905 -> nineteen oh five
+func enYear(year int) string {
+	switch {
+	case year >= 2000 && year < 2010:
+		return enCardinal(int64(year))
+	case year >= 1100 && year < 10000:
+		high, low := year/100, year%100
+		switch {
+		case low == 0:
+			return enUnder100(high) + " hundred"
+		case low < 10:
+			return enUnder100(high) + " oh " + enOnes[low]
+		default:
+			return enUnder100(high) + " " + enUnder100(low)
+		}
+	default:
+		return enCardinal(int64(year))
+	}
+}
@@ -0,0 +1,198 @@
+package textnorm
+
+import (
+	"strconv"
+	"strings"
+)
+
+var zhDigitWords = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+var zhUnitWords = map[string]string{
+	"km/h": "公里每小时",
+	"m/s":  "米每秒",
+	"kWh":  "千瓦时",
+	"kg":   "千克",
+	"mg":   "毫克",
+	"km":   "公里",
+	"cm":   "厘米",
+	"mm":   "毫米",
+	"ml":   "毫升",
+	"mL":   "毫升",
+	"min":  "分钟",
+	"kW":   "千瓦",
+	"℃":    "摄氏度",
+	"°C":   "摄氏度",
+	"°F":   "华氏度",
+	"°":    "度",
+	"g":    "克",
+	"m":    "米",
+	"L":    "升",
+	"W":    "瓦",
+}
+
+var zhCurrencyWords = map[string]string{
+	"CNY": "元",
+	"RMB": "元",
+	"USD": "美元",
+	"EUR": "欧元",
+	"GBP": "英镑",
+	"JPY": "日元",
+}
+
+type zhVerbalizer struct{}
+
+func (zhVerbalizer) number(s string) string {
+	negative, intPart, fracPart := splitNumber(s)
+	var b strings.Builder
+	if negative {
+		b.WriteString("负")
+	}
+	b.WriteString(zhInteger(intPart))
+	if fracPart != "" {
+		b.WriteString("点")
+		b.WriteString(zhDigitString(fracPart))
+	}
+	return b.String()
+}
+
+func (zhVerbalizer) digits(s string) string {
+	return zhDigitString(s)
+}
+
+func (zhVerbalizer) date(year, month, day int) string {
+	return zhDigitString(strconv.Itoa(year)) + "年" + zhCardinal(int64(month)) + "月" + zhCardinal(int64(day)) + "日"
+}
+
+func (zhVerbalizer) time(hour, minute, second int) string {
+	var b strings.Builder
+	b.WriteString(zhCardinal(int64(hour)))
+	b.WriteString("点")
+	switch {
+	case minute == 0 && second <= 0:
+		b.WriteString("整")
+		return b.String()
+	case minute < 10:
+		b.WriteString("零")
+	}
+	b.WriteString(zhCardinal(int64(minute)))
+	b.WriteString("分")
+	if second > 0 {
+		b.WriteString(zhCardinal(int64(second)))
+		b.WriteString("秒")
+	}
+	return b.String()
+}
+
+func (zhVerbalizer) money(amount, code string) string {
+	return zhMeasureNumber(amount) + zhCurrencyWords[code]
+}
+
+func (v zhVerbalizer) percent(s string, permille bool) string {
+	prefix := "百分之"
+	if permille {
+		prefix = "千分之"
+	}
+	if strings.HasPrefix(s, "-") {
+		return "负" + prefix + v.number(s[1:])
+	}
+	return prefix + v.number(s)
+}
+
+func (zhVerbalizer) measure(value, unit string) string {
+	return zhMeasureNumber(value) + zhUnitWords[unit]
+}
+
+func (zhVerbalizer) rangeWord() string {
+	return "到"
+}
+
+// zhMeasureNumber 量词前的 2 读作 "两"
+func zhMeasureNumber(s string) string {
+	if s == "2" {
+		return "两"
+	}
+	return zhVerbalizer{}.number(s)
+}
+
+func zhDigitString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteString(zhDigitWords[r-'0'])
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// zhInteger 超出读法范围或以 0 开头的多位数逐位朗读
+func zhInteger(s string) string {
+	if len(s) > 1 && s[0] == '0' {
+		return zhDigitString(s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n >= 1e16 {
+		return zhDigitString(s)
+	}
+	return zhCardinal(n)
+}
+
+// zhCardinal 整数读法，如 10005 -> 一万零五，15 -> 十五
+func zhCardinal(n int64) string {
+	if n == 0 {
+		return zhDigitWords[0]
+	}
+	if n < 0 {
+		return "负" + zhCardinal(-n)
+	}
+	var sections []int
+	for n > 0 {
+		sections = append(sections, int(n%10000))
+		n /= 10000
+	}
+	sectionUnits := []string{"", "万", "亿", "万亿"}
+	var b strings.Builder
+	zero := false
+	for i := len(sections) - 1; i >= 0; i-- {
+		section := sections[i]
+		if section == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 && (zero || section < 1000) {
+			b.WriteString(zhDigitWords[0])
+		}
+		zero = false
+		b.WriteString(zhSection(section))
+		b.WriteString(sectionUnits[i])
+	}
+	result := b.String()
+	if strings.HasPrefix(result, "一十") {
+		result = strings.TrimPrefix(result, "一")
+	}
+	return result
+}
+
+// zhSection 四位以内的读法
+func zhSection(n int) string {
+	units := []string{"千", "百", "十", ""}
+	divisors := []int{1000, 100, 10, 1}
+	var b strings.Builder
+	started, zero := false, false
+	for i, d := range divisors {
+		digit := n / d % 10
+		if digit == 0 {
+			zero = started
+			continue
+		}
+		if zero {
+			b.WriteString(zhDigitWords[0])
+			zero = false
+		}
+		b.WriteString(zhDigitWords[digit])
+		b.WriteString(units[i])
+		started = true
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+// Package textnorm 在送入 TTS 合成前对文本做朗读归一化：
+// 去除 markdown/emoji、URL 与缩写转读法、数字/日期/时间/货币/单位转文字、自定义发音词典。
+// 只影响送给 TTS 的文本，sentence_start 与对话历史仍使用原文。
+package textnorm
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// 归一化步骤名称，可在 tts_normalize.steps 中按顺序配置
+const (
+	StepMarkdown     = "markdown"
+	StepEmoji        = "emoji"
+	StepDictionary   = "dictionary"
+	StepURL          = "url"
+	StepAbbreviation = "abbreviation"
+	StepNumber       = "number"
+)
+
+// DefaultSteps 默认归一化链。词典先于 url/数字执行，便于用户覆盖内置读法
+var DefaultSteps = []string{StepMarkdown, StepEmoji, StepDictionary, StepURL, StepAbbreviation, StepNumber}
+
+// Options 单次归一化参数
+type Options struct {
+	Enabled       bool
+	Language      string            // 对话语言：zh/yue/en/ja/ko，决定数字、缩写、URL 的读法
+	Steps         []string          // 为空时使用 DefaultSteps
+	Dictionary    map[string]string // 发音词典：原词 -> 读法，区分大小写，长词优先
+	Abbreviations map[string]string // 额外缩写表，覆盖内置缩写
+}
+
+type stepFunc func(text string, opts Options) string
+
+var steps = map[string]stepFunc{
+	StepMarkdown:     stripMarkdown,
+	StepEmoji:        stripEmoji,
+	StepDictionary:   applyDictionary,
+	StepURL:          verbalizeURLs,
+	StepAbbreviation: expandAbbreviations,
+	StepNumber:       verbalizeNumbers,
+}
+
+// LoadOptions 从 tts_normalize 配置生成归一化参数，agentDictionary 为智能体发音词典，同名词条覆盖全局词典
+func LoadOptions(language string, agentDictionary map[string]string) Options {
+	opts := Options{
+		Enabled:  !viper.IsSet("tts_normalize.enable") || viper.GetBool("tts_normalize.enable"),
+		Language: language,
+		Steps:    viper.GetStringSlice("tts_normalize.steps"),
+	}
+	opts.Dictionary = ParseDictionary(viper.GetStringSlice("tts_normalize.dictionary"))
+	for word, reading := range agentDictionary {
+		if word = strings.TrimSpace(word); word != "" {
+			opts.Dictionary[word] = strings.TrimSpace(reading)
+		}
+	}
+	opts.Abbreviations = ParseDictionary(viper.GetStringSlice("tts_normalize.abbreviations"))
+	return opts
+}
+
+// ParseDictionary 解析 "原词=读法" 格式的词条列表，忽略空行与 # 开头的注释
+func ParseDictionary(lines []string) map[string]string {
+	dict := make(map[string]string, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, reading, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if word = strings.TrimSpace(word); word != "" {
+			dict[word] = strings.TrimSpace(reading)
+		}
+	}
+	return dict
+}
+
+// Normalize 按配置的步骤依次处理文本；结果不含任何可朗读字符时返回空字符串，调用方应跳过合成
+func Normalize(text string, opts Options) string {
+	if !opts.Enabled || strings.TrimSpace(text) == "" {
+		return text
+	}
+	names := opts.Steps
+	if len(names) == 0 {
+		names = DefaultSteps
+	}
+	for _, name := range names {
+		if step, ok := steps[strings.ToLower(strings.TrimSpace(name))]; ok {
+			text = step(text, opts)
+		}
+	}
+	text = collapseSpaces(text)
+	if !hasSpeakable(text) {
+		return ""
+	}
+	return text
+}
+
+func applyDictionary(text string, opts Options) string {
+	return replaceLongestFirst(text, opts.Dictionary)
+}
+
+// replaceLongestFirst 一次扫描完成替换，长词优先，替换结果不会被再次匹配
+func replaceLongestFirst(text string, dict map[string]string) string {
+	if len(dict) == 0 {
+		return text
+	}
+	words := make([]string, 0, len(dict))
+	for word := range dict {
+		words = append(words, word)
+	}
+	sortByLengthDesc(words)
+	pairs := make([]string, 0, len(words)*2)
+	for _, word := range words {
+		pairs = append(pairs, word, dict[word])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func sortByLengthDesc(words []string) {
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+}
+
+// isCJKLanguage 中文、粤语使用中文读法
+func isCJKLanguage(lang string) bool {
+	return lang == "" || lang == "zh" || lang == "yue"
+}
+
+func collapseSpaces(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	space := false
+	for _, r := range text {
+		if r == '\n' || r == '\r' || r == '\t' || r == ' ' {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func hasSpeakable(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package textnorm
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNormalizeChinese(t *testing.T) {
+	opts := Options{Enabled: true, Language: "zh"}
+	cases := map[string]string{
+		"**重点**：买了3.5kg苹果😀":             "重点：买了三点五千克苹果",
+		"- 会议时间 2026-10-16 15:30":       "会议时间 二零二六年十月十六日 十五点三十分",
+		"价格是￥1,280，打8.5折":               "价格是一千二百八十元，打八点五折",
+		"今天气温-5℃，湿度35%":                 "今天气温负五摄氏度，湿度百分之三十五",
+		"大约需要3-5天":                      "大约需要3到5天",
+		"2026年的计划":                      "二零二六年的计划",
+		"详情见 https://www.example.com/a": "详情见 example点com",
+		"客服电话 13812345678":              "客服电话 一三八一二三四五六七八",
+		"版本 1.2.3 已发布":                  "版本 1.2.3 已发布",
+		"买2个":                           "买2个",
+		"跑了2km":                         "跑了两公里",
+		"早上8:05出发，10:00到":               "早上八点零五分出发，十点整到",
+		"1. 打开设置":                       "1、打开设置",
+		"✨🎉":                            "",
+	}
+	for input, want := range cases {
+		if got := Normalize(input, opts); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeEnglish(t *testing.T) {
+	opts := Options{Enabled: true, Language: "en"}
+	cases := map[string]string{
+		"It costs $3.99 today":            "It costs three dollars and ninety-nine cents today",
+		"The meeting is on 2026-10-16":    "The meeting is on October sixteenth, twenty twenty-six",
+		"Leave at 15:05":                  "Leave at fifteen oh five",
+		"It weighs 1kg, e.g. a bag":       "It weighs one kilogram, for example a bag",
+		"Pi is about 3.14":                "Pi is about three point one four",
+		"Growth was 12.5% vs last year":   "Growth was twelve point five percent versus last year",
+		"Visit [our site](https://a.io)":  "Visit our site",
+		"Mail me at john.doe@example.com": "Mail me at john dot doe at example dot com",
+		"canvas stays":                    "canvas stays",
+		"It is -3°C outside":              "It is minus three degrees Celsius outside",
+		"Wait 3-5 days":                   "Wait 3 to 5 days",
+	}
+	for input, want := range cases {
+		if got := Normalize(input, opts); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeOptions(t *testing.T) {
+	if got := Normalize("**3.5kg**", Options{Language: "zh"}); got != "**3.5kg**" {
+		t.Fatalf("disabled normalization should keep text, got %q", got)
+	}
+	opts := Options{Enabled: true, Language: "zh", Steps: []string{StepMarkdown}}
+	if got := Normalize("**3.5kg**", opts); got != "3.5kg" {
+		t.Fatalf("only markdown step should run, got %q", got)
+	}
+	opts = Options{Enabled: true, Language: "ja"}
+	if got := Normalize("3.5kg です", opts); got != "3.5kg です" {
+		t.Fatalf("numbers should be left to the engine for ja, got %q", got)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	viper.Set("tts_normalize.dictionary", []string{"ESP32=E S P 三十二", "# 注释", "小智=小志"})
+	defer viper.Set("tts_normalize.dictionary", nil)
+
+	opts := LoadOptions("zh", map[string]string{"小智": "晓智", "ESP32-S3": "E S P 三十二 S 三"})
+	if !opts.Enabled {
+		t.Fatalf("normalization should be enabled by default")
+	}
+	got := Normalize("小智运行在ESP32-S3和ESP32上", opts)
+	if want := "晓智运行在E S P 三十二 S 三和E S P 三十二上"; got != want {
+		t.Fatalf("Normalize() = %q, want %q", got, want)
+	}
+}
+
+func TestCardinal(t *testing.T) {
+	zh := map[int64]string{
+		0: "零", 10: "十", 15: "十五", 110: "一百一十", 1005: "一千零五", 10005: "一万零五",
+		100010000: "一亿零一万", 120000: "十二万",
+	}
+	for n, want := range zh {
+		if got := zhCardinal(n); got != want {
+			t.Errorf("zhCardinal(%d) = %q, want %q", n, got, want)
+		}
+	}
+	en := map[int64]string{
+		0: "zero", 21: "twenty-one", 105: "one hundred five", 1234: "one thousand two hundred thirty-four",
+		2000000: "two million",
+	}
+	for n, want := range en {
+		if got := enCardinal(n); got != want {
+			t.Errorf("enCardinal(%d) = %q, want %q", n, got, want)
+		}
+	}
+	if got := enOrdinal(22); got != "twenty-second" {
+		t.Errorf("enOrdinal(22) = %q", got)
+	}
+	if got := enYear(1905); got != "nineteen oh five" {
+		t.Errorf("enYear(1905) = %q", got)
+	}
+}
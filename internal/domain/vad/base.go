@@ -4,6 +4,7 @@ import (
 	"errors"
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/inter"
+	"xiaozhi-esp32-server-golang/internal/domain/vad/mock_vad"
 	// "xiaozhi-esp32-server-golang/internal/domain/vad/silero_vad"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/ten_vad"
 
@@ -18,7 +19,7 @@ func AcquireVAD(provider string, config map[string]interface{}) (inter.VAD, erro
 
 	// 如果 provider 为空，返回明确的错误信息
 	if provider == "" {
-		return nil, errors.New("vad provider is empty, please set provider in config (supported: ten_vad)")
+		return nil, errors.New("vad provider is empty, please set provider in config (supported: ten_vad, mock)")
 	}
 
 	switch provider {
@@ -28,8 +29,10 @@ func AcquireVAD(provider string, config map[string]interface{}) (inter.VAD, erro
 	// 	return webrtc_vad.AcquireVAD(config)
 	case constants.VadTypeTenVad:
 		return ten_vad.AcquireVAD(config)
+	case constants.VadTypeMock:
+		return mock_vad.AcquireVAD(config)
 	default:
-		return nil, errors.New("invalid vad provider: " + provider + " (supported: ten_vad)")
+		return nil, errors.New("invalid vad provider: " + provider + " (supported: ten_vad, mock)")
 	}
 }
 
@@ -42,6 +45,8 @@ func ReleaseVAD(vad inter.VAD) error {
 	// 	return silero_vad.ReleaseVAD(vad)
 	case *ten_vad.TenVAD:
 		return ten_vad.ReleaseVAD(vad)
+	case *mock_vad.MockVAD:
+		return mock_vad.ReleaseVAD(vad)
 	default:
 		return errors.New("invalid vad type")
 	}
@@ -0,0 +1,78 @@
+package mock_vad
+
+import (
+	"math"
+	"sync"
+
+	"xiaozhi-esp32-server-golang/internal/domain/vad/inter"
+)
+
+// 默认能量阈值（RMS），合成测试音的幅度远高于该值，数字静音为 0
+const defaultThreshold = 0.01
+
+// MockVAD 基于能量阈值的确定性 VAD，不依赖模型文件和 cgo，用于端到端测试
+// 帧的 RMS 超过 threshold 即判定为有语音
+type MockVAD struct {
+	threshold float64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// AcquireVAD 创建 MockVAD 实例（由全局资源池管理）
+// 配置参数：threshold（RMS 阈值，默认 0.01）
+func AcquireVAD(config map[string]interface{}) (inter.VAD, error) {
+	threshold := defaultThreshold
+	switch v := config["threshold"].(type) {
+	case float64:
+		threshold = v
+	case int:
+		threshold = float64(v)
+	}
+	return &MockVAD{threshold: threshold}, nil
+}
+
+// ReleaseVAD 释放 VAD 实例
+func ReleaseVAD(vad inter.VAD) error {
+	if vad != nil {
+		return vad.Close()
+	}
+	return nil
+}
+
+// IsVAD 检测音频数据中的语音活动
+func (m *MockVAD) IsVAD(pcmData []float32) (bool, error) {
+	if len(pcmData) == 0 {
+		return false, nil
+	}
+	var sum float64
+	for _, v := range pcmData {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum/float64(len(pcmData))) > m.threshold, nil
+}
+
+// IsVADExt 与 IsVAD 相同，能量判断与采样率和帧长无关
+func (m *MockVAD) IsVADExt(pcmData []float32, sampleRate int, frameSize int) (bool, error) {
+	return m.IsVAD(pcmData)
+}
+
+// Reset 无状态，无需重置
+func (m *MockVAD) Reset() error {
+	return nil
+}
+
+// Close 关闭实例
+func (m *MockVAD) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// IsValid 检查资源是否有效
+func (m *MockVAD) IsValid() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.closed
+}
@@ -16,3 +16,11 @@ func GetBackendURL() string {
 	return viper.GetString("manager.backend_url")
 }
 
+// MqttSignatureKey OTA 下发设备 MQTT 凭据与内置 MQTT 服务器验证凭据共用的签名密钥，
+// 读取 ota.signature_key，旧配置只写了 mqtt_server.signature_key 时使用它
+func MqttSignatureKey() string {
+	if key := viper.GetString("ota.signature_key"); key != "" {
+		return key
+	}
+	return viper.GetString("mqtt_server.signature_key")
+}
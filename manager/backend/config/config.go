@@ -14,6 +14,8 @@ type Config struct {
 	SpeakerService SpeakerServiceConfig `json:"speaker_service"`
 	Storage        StorageConfig        `json:"storage"`
 	History        HistoryConfig        `json:"history"`
+	MCPOAuth       MCPOAuthConfig       `json:"mcp_oauth"`
+	Webhook        WebhookConfig        `json:"webhook"`
 }
 
 type ServerConfig struct {
@@ -76,6 +78,14 @@ type HistoryConfig struct {
 	MaxFileSize   int64  `json:"max_file_size"`   // 最大文件大小(字节)，默认10MB
 }
 
+type MCPOAuthConfig struct {
+	PublicURL string `json:"public_url"` // 浏览器访问控制台的地址，如 https://console.example.com，OAuth 回调地址由它拼出
+}
+
+type WebhookConfig struct {
+	InternalToken string `json:"internal_token"` // 主程序上报回调事件时携带的共享令牌，需与主程序 webhook.internal_token 一致；为空时只接受本机上报
+}
+
 func Load() *Config {
 	return LoadWithPath("config/config.json")
 }
@@ -116,6 +126,13 @@ func LoadWithPath(configPath string) *Config {
 		config.History.AudioBasePath = audioBasePath
 	}
 
+	if publicURL := os.Getenv("MCP_OAUTH_PUBLIC_URL"); publicURL != "" {
+		config.MCPOAuth.PublicURL = publicURL
+	}
+	if token := os.Getenv("WEBHOOK_INTERNAL_TOKEN"); token != "" {
+		config.Webhook.InternalToken = token
+	}
+
 	fmt.Println("config", config)
 
 	return config
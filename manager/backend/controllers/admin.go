@@ -92,23 +92,37 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 	}
 
 	type ConfigResponse struct {
-		VAD             models.Config               `json:"vad"`
-		ASR             models.Config               `json:"asr"`
-		LLM             models.Config               `json:"llm"`
-		TTS             models.Config               `json:"tts"`
-		Memory          models.Config               `json:"memory"`
-		VoiceIdentify   map[string]SpeakerGroupInfo `json:"voice_identify"`
-		KnowledgeBases  []KnowledgeBaseInfo         `json:"knowledge_bases"`
-		Prompt          string                      `json:"prompt"`
-		AgentID         string                      `json:"agent_id"`
-		MemoryMode      string                      `json:"memory_mode"`
-		MCPServiceNames string                      `json:"mcp_service_names"`
-		OpenClaw        OpenClawConfigResponse      `json:"openclaw"`
-		ConfigSource    string                      `json:"config_source"` // 新增：配置来源
+		VAD               models.Config               `json:"vad"`
+		ASR               models.Config               `json:"asr"`
+		LLM               models.Config               `json:"llm"`
+		TTS               models.Config               `json:"tts"`
+		Memory            models.Config               `json:"memory"`
+		VoiceIdentify     map[string]SpeakerGroupInfo `json:"voice_identify"`
+		KnowledgeBases    []KnowledgeBaseInfo         `json:"knowledge_bases"`
+		Prompt            string                      `json:"prompt"`
+		AgentID           string                      `json:"agent_id"`
+		MemoryMode        string                      `json:"memory_mode"`
+		MCPServiceNames   string                      `json:"mcp_service_names"`
+		Language          string                      `json:"language"`
+		LanguageVoices    map[string]string           `json:"language_voices"`
+		PronunciationDict map[string]string           `json:"pronunciation_dict"`
+		ToolPolicies      map[string]string           `json:"tool_policies"`
+		MCPResources      []AgentMCPResource          `json:"mcp_resources"`
+		ASRSpeed          string                      `json:"asr_speed"`
+		TTSFallbacks      []models.Config             `json:"tts_fallbacks"`
+		OpenClaw          OpenClawConfigResponse      `json:"openclaw"`
+		ConfigSource      string                      `json:"config_source"` // 新增：配置来源
 	}
 
 	var response ConfigResponse
 	response.MemoryMode = "short"
+	response.Language = defaultAgentLanguage
+	response.LanguageVoices = map[string]string{}
+	response.PronunciationDict = map[string]string{}
+	response.ToolPolicies = map[string]string{}
+	response.MCPResources = []AgentMCPResource{}
+	response.ASRSpeed = "normal"
+	response.TTSFallbacks = []models.Config{}
 	response.OpenClaw = OpenClawConfigResponse{
 		Allowed:       false,
 		EnterKeywords: []string{},
@@ -154,6 +168,15 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		response.MemoryMode = normalizeAgentMemoryMode(agent.MemoryMode)
 		response.MCPServiceNames = normalizeMCPServiceNamesCSV(agent.MCPServiceNames)
 		response.OpenClaw = buildOpenClawConfigFromAgent(agent)
+		response.Language = normalizeAgentLanguage(agent.Language)
+		response.LanguageVoices = parseAgentLanguageVoices(agent.LanguageVoicesConfig)
+		response.PronunciationDict = parseAgentPronunciationDict(agent.PronunciationDict)
+		response.ToolPolicies = parseAgentToolPolicies(agent.ToolPoliciesConfig)
+		response.MCPResources = parseAgentMCPResources(agent.MCPResourcesConfig)
+		if agent.ASRSpeed != "" {
+			response.ASRSpeed = agent.ASRSpeed
+		}
+		response.TTSFallbacks = loadTTSFallbackConfigs(ac.DB, agent.TTSFallbackConfigIDs)
 	}
 
 	cloneVoiceCache := make(map[string]bool)
@@ -2911,9 +2934,13 @@ func (ac *AdminController) GetAgentMCPEndpoint(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	serverEndpoint, err := GenerateAgentMCPServerEndpoint(ac.DB, agentID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 返回单个endpoint字符串
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"endpoint": endpoint}})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"endpoint": endpoint, "server_endpoint": serverEndpoint}})
 }
 
 // GetAgentOpenClawEndpoint 获取智能体的OpenClaw接入点URL
@@ -3114,6 +3141,33 @@ func (ac *AdminController) GetAgentMcpTools(c *gin.Context) {
 	GetAgentMcpToolsCommon(c, agentID, ac.WebSocketController, adminAgentValidator)
 }
 
+// GetAgentMCPContext 获取智能体可挂载的MCP资源与可选用的提示词模板（管理员版本）
+func (ac *AdminController) GetAgentMCPContext(c *gin.Context) {
+	var agent models.Agent
+	if err := ac.DB.Where("id = ?", c.Param("id")).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return
+	}
+	GetAgentMCPContextCommon(c, agent, ac.mcpContextRequester())
+}
+
+// RenderAgentMCPPrompt 渲染MCP提示词模板（管理员版本）
+func (ac *AdminController) RenderAgentMCPPrompt(c *gin.Context) {
+	var agent models.Agent
+	if err := ac.DB.Where("id = ?", c.Param("id")).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return
+	}
+	RenderAgentMCPPromptCommon(c, agent, ac.mcpContextRequester())
+}
+
+func (ac *AdminController) mcpContextRequester() mcpContextRequester {
+	if ac.WebSocketController == nil {
+		return nil
+	}
+	return ac.WebSocketController
+}
+
 func (ac *AdminController) CreateAgent(c *gin.Context) {
 	var agent models.Agent
 	if err := c.ShouldBindBodyWith(&agent, binding.JSON); err != nil {
@@ -3136,6 +3190,14 @@ func (ac *AdminController) CreateAgent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := applyAgentLanguageSettings(&agent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.TTSFallbackConfigIDs, err = validateTTSFallbackConfigIDs(ac.DB, agent.TTSFallbackConfigIDs, agent.TTSConfigID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
 
 	var openClawCfg OpenClawConfigResponse
@@ -3190,6 +3252,14 @@ func (ac *AdminController) UpdateAgent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := applyAgentLanguageSettings(&agent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if agent.TTSFallbackConfigIDs, err = validateTTSFallbackConfigIDs(ac.DB, agent.TTSFallbackConfigIDs, agent.TTSConfigID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
 
 	var openClawCfg OpenClawConfigResponse
@@ -3751,6 +3821,22 @@ func (ac *AdminController) DeleteMQTTServerConfig(c *gin.Context) {
 	ac.deleteConfigWithType(c, "mqtt_server")
 }
 
+// GetMQTTClients 汇总所有主程序节点上内置MQTT服务器的在线客户端
+func (ac *AdminController) GetMQTTClients(c *gin.Context) {
+	if ac.WebSocketController == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket控制器未初始化"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	nodes := ac.WebSocketController.RequestMqttClientsFromAll(ctx)
+	total := 0
+	for _, node := range nodes {
+		total += len(node.Clients)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"nodes": nodes, "total": total}})
+}
+
 // UDP配置管理（兼容前端）
 func (ac *AdminController) GetUDPConfigs(c *gin.Context) {
 	var configs []models.Config
@@ -4672,6 +4758,10 @@ func (ac *AdminController) CreateMCPConfig(c *gin.Context) {
 	}
 
 	config.Type = "mcp"
+	if err := validateMCPConfigServers(config.JsonData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 如果设置为默认配置，先取消其他同类型的默认配置
 	if config.IsDefault {
@@ -4700,6 +4790,12 @@ func (ac *AdminController) UpdateMCPConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if updateData.JsonData != "" {
+		if err := validateMCPConfigServers(updateData.JsonData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// 如果设置为默认配置，先取消其他同类型的默认配置
 	if updateData.IsDefault {
@@ -4732,43 +4828,49 @@ func (ac *AdminController) DeleteMCPConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "MCP配置删除成功"})
 }
 
-// GenerateAgentMCPEndpoint 公共的MCP接入点生成函数
-func GenerateAgentMCPEndpoint(db *gorm.DB, agentID string, userID uint) (string, error) {
+// agentEndpointBaseURL 从默认OTA配置的外网WebSocket URL中取协议与域名，作为智能体接入点的基础地址
+func agentEndpointBaseURL(db *gorm.DB) (*url.URL, error) {
 	// 获取OTA配置中的外网WebSocket URL
 	var otaConfig models.Config
 	if err := db.Where("type = ? AND is_default = ?", "ota", true).First(&otaConfig).Error; err != nil {
-		return "", fmt.Errorf("failed to get OTA config: %v", err)
+		return nil, fmt.Errorf("failed to get OTA config: %v", err)
 	}
 
 	var otaData map[string]interface{}
 	if err := json.Unmarshal([]byte(otaConfig.JsonData), &otaData); err != nil {
-		return "", fmt.Errorf("failed to parse OTA config: %v", err)
+		return nil, fmt.Errorf("failed to parse OTA config: %v", err)
 	}
 
 	// 获取外网WebSocket URL
 	externalURL, ok := otaData["external"].(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("external config not found in OTA config")
+		return nil, fmt.Errorf("external config not found in OTA config")
 	}
 
 	websocketConfig, ok := externalURL["websocket"].(map[string]interface{})
 	if !ok {
-		return "", fmt.Errorf("websocket config not found in external config")
+		return nil, fmt.Errorf("websocket config not found in external config")
 	}
 
 	wsURL, ok := websocketConfig["url"].(string)
 	if !ok || wsURL == "" {
-		return "", fmt.Errorf("websocket URL not found in external config")
+		return nil, fmt.Errorf("websocket URL not found in external config")
 	}
 
 	// 解析OTA URL，只取域名部分，保持ws或wss协议不变
 	parsedURL, err := url.Parse(wsURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse WebSocket URL: %v", err)
+		return nil, fmt.Errorf("failed to parse WebSocket URL: %v", err)
 	}
+	return &url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}, nil
+}
 
-	// 构建基础URL（只包含协议和域名）
-	baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
+// GenerateAgentMCPEndpoint 公共的MCP接入点生成函数
+func GenerateAgentMCPEndpoint(db *gorm.DB, agentID string, userID uint) (string, error) {
+	baseURL, err := agentEndpointBaseURL(db)
+	if err != nil {
+		return "", err
+	}
 
 	// 生成MCP JWT token
 	token, err := generateMCPToken(agentID, userID)
@@ -4777,51 +4879,46 @@ func GenerateAgentMCPEndpoint(db *gorm.DB, agentID string, userID uint) (string,
 	}
 
 	// 构建带token的完整endpoint URL，直接使用/mcp路径
-	endpointWithToken := fmt.Sprintf("%s/mcp?token=%s", baseURL, token)
+	endpointWithToken := fmt.Sprintf("%s/mcp?token=%s", baseURL.String(), token)
 
 	return endpointWithToken, nil
 }
 
-// GenerateAgentOpenClawEndpoint 公共的OpenClaw接入点生成函数
-func GenerateAgentOpenClawEndpoint(db *gorm.DB, agentID string, userID uint) (string, error) {
-	var otaConfig models.Config
-	if err := db.Where("type = ? AND is_default = ?", "ota", true).First(&otaConfig).Error; err != nil {
-		return "", fmt.Errorf("failed to get OTA config: %v", err)
-	}
-
-	var otaData map[string]interface{}
-	if err := json.Unmarshal([]byte(otaConfig.JsonData), &otaData); err != nil {
-		return "", fmt.Errorf("failed to parse OTA config: %v", err)
+// GenerateAgentMCPServerEndpoint 生成对外MCP服务器（Streamable HTTP）接入点，外部智能体通过它操作该智能体下的设备
+func GenerateAgentMCPServerEndpoint(db *gorm.DB, agentID string, userID uint) (string, error) {
+	baseURL, err := agentEndpointBaseURL(db)
+	if err != nil {
+		return "", err
 	}
-
-	externalURL, ok := otaData["external"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("external config not found in OTA config")
+	// WebSocket 与 HTTP 共用端口，ws/wss 对应 http/https
+	switch baseURL.Scheme {
+	case "wss":
+		baseURL.Scheme = "https"
+	case "ws":
+		baseURL.Scheme = "http"
 	}
 
-	websocketConfig, ok := externalURL["websocket"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("websocket config not found in external config")
+	token, err := generateAgentJWT(agentID, userID, mcpServerTokenPurpose)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate MCP server token: %v", err)
 	}
 
-	wsURL, ok := websocketConfig["url"].(string)
-	if !ok || wsURL == "" {
-		return "", fmt.Errorf("websocket URL not found in external config")
-	}
+	return fmt.Sprintf("%s%s?token=%s", baseURL.String(), mcpServerPath, token), nil
+}
 
-	parsedURL, err := url.Parse(wsURL)
+// GenerateAgentOpenClawEndpoint 公共的OpenClaw接入点生成函数
+func GenerateAgentOpenClawEndpoint(db *gorm.DB, agentID string, userID uint) (string, error) {
+	baseURL, err := agentEndpointBaseURL(db)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse WebSocket URL: %v", err)
+		return "", err
 	}
 
-	baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
-
 	token, err := generateOpenClawToken(agentID, userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate OpenClaw token: %v", err)
 	}
 
-	endpointWithToken := fmt.Sprintf("%s/ws/openclaw?token=%s", baseURL, token)
+	endpointWithToken := fmt.Sprintf("%s/ws/openclaw?token=%s", baseURL.String(), token)
 	return endpointWithToken, nil
 }
 
@@ -4937,8 +5034,20 @@ func (ac *AdminController) SetDefaultMemoryConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "设置默认Memory配置成功", "data": config})
 }
 
+const (
+	// mcpServerTokenPurpose 对外MCP服务器接入token的用途，需与主程序 mcpserver.TokenPurpose 一致
+	mcpServerTokenPurpose = "mcp-server"
+	// mcpServerPath 主程序对外MCP服务器的默认路径（mcp_server.path）
+	mcpServerPath = "/xiaozhi/mcp_server"
+)
+
 // generateMCPToken 生成稳定的MCP JWT Token（同一agentID+userID下保持不变）
 func generateMCPToken(agentID string, userID uint) (string, error) {
+	return generateAgentJWT(agentID, userID, "mcp-endpoint")
+}
+
+// generateAgentJWT 按用途生成智能体级JWT Token，主程序按 purpose 区分设备接入点与对外MCP服务器
+func generateAgentJWT(agentID string, userID uint, purpose string) (string, error) {
 	// 创建自定义的JWT Claims
 	type MCPClaims struct {
 		UserID     uint   `json:"userId"`
@@ -4957,7 +5066,7 @@ func generateMCPToken(agentID string, userID uint) (string, error) {
 		UserID:           userID,
 		AgentID:          agentID,
 		EndpointID:       endpointID,
-		Purpose:          "mcp-endpoint",
+		Purpose:          purpose,
 		RegisteredClaims: jwt.RegisteredClaims{},
 	}
 
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xiaozhi/manager/backend/models"
+)
+
+const (
+	defaultAgentLanguage = "zh"
+	agentLanguageAuto    = "auto"
+)
+
+// 智能体支持的对话语言，需与主程序 internal/domain/i18n 保持一致
+var supportedAgentLanguages = map[string]struct{}{
+	"zh":  {},
+	"yue": {},
+	"en":  {},
+	"ja":  {},
+	"ko":  {},
+}
+
+func normalizeAgentLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == agentLanguageAuto {
+		return agentLanguageAuto
+	}
+	if _, ok := supportedAgentLanguages[language]; ok {
+		return language
+	}
+	return defaultAgentLanguage
+}
+
+// normalizeAgentLanguageVoices 校验多语言音色映射并序列化为JSON字符串，空映射返回空字符串
+func normalizeAgentLanguageVoices(voices map[string]string) (string, error) {
+	normalized := make(map[string]string, len(voices))
+	for language, voice := range voices {
+		language = strings.ToLower(strings.TrimSpace(language))
+		voice = strings.TrimSpace(voice)
+		if voice == "" {
+			continue
+		}
+		if _, ok := supportedAgentLanguages[language]; !ok {
+			return "", fmt.Errorf("不支持的音色语言: %s", language)
+		}
+		normalized[language] = voice
+	}
+	if len(normalized) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseAgentLanguageVoices(raw string) map[string]string {
+	voices := map[string]string{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return voices
+	}
+	if err := json.Unmarshal([]byte(raw), &voices); err != nil {
+		return map[string]string{}
+	}
+	return voices
+}
+
+// applyAgentLanguageSettings 归一化智能体的语言、多语言音色、发音词典、工具调用策略与挂载的MCP资源配置（直接绑定 models.Agent 的接口使用）
+func applyAgentLanguageSettings(agent *models.Agent) error {
+	if agent == nil {
+		return nil
+	}
+	agent.Language = normalizeAgentLanguage(agent.Language)
+	voicesConfig, err := normalizeAgentLanguageVoices(parseAgentLanguageVoices(agent.LanguageVoicesConfig))
+	if err != nil {
+		return err
+	}
+	agent.LanguageVoicesConfig = voicesConfig
+	pronunciationDict, err := normalizeAgentPronunciationDict(agent.PronunciationDict)
+	if err != nil {
+		return err
+	}
+	agent.PronunciationDict = pronunciationDict
+	toolPoliciesConfig, err := normalizeAgentToolPolicies(parseAgentToolPolicies(agent.ToolPoliciesConfig))
+	if err != nil {
+		return err
+	}
+	agent.ToolPoliciesConfig = toolPoliciesConfig
+	mcpResourcesConfig, err := normalizeAgentMCPResources(parseAgentMCPResources(agent.MCPResourcesConfig))
+	if err != nil {
+		return err
+	}
+	agent.MCPResourcesConfig = mcpResourcesConfig
+	return nil
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+)
+
+func TestNormalizeAgentLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":      "zh",
+		"EN":    "en",
+		" auto": "auto",
+		"fr":    "zh",
+		"yue":   "yue",
+	}
+	for input, want := range cases {
+		if got := normalizeAgentLanguage(input); got != want {
+			t.Fatalf("normalizeAgentLanguage(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeAgentLanguageVoices(t *testing.T) {
+	got, err := normalizeAgentLanguageVoices(map[string]string{"EN": " en-voice ", "ja": ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != `{"en":"en-voice"}` {
+		t.Fatalf("unexpected voices config: %s", got)
+	}
+	if got, _ := normalizeAgentLanguageVoices(map[string]string{"ja": " "}); got != "" {
+		t.Fatalf("empty voices should serialize to empty string, got %q", got)
+	}
+	if _, err := normalizeAgentLanguageVoices(map[string]string{"fr": "voice"}); err == nil {
+		t.Fatalf("unsupported language should fail")
+	}
+
+	agent := models.Agent{Language: "JA", LanguageVoicesConfig: `{"ko":"ko-voice"}`}
+	if err := applyAgentLanguageSettings(&agent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if agent.Language != "ja" || parseAgentLanguageVoices(agent.LanguageVoicesConfig)["ko"] != "ko-voice" {
+		t.Fatalf("unexpected agent language settings: %+v", agent)
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"xiaozhi/manager/backend/models"
+)
+
+const maxAgentMCPResources = 20
+
+// AgentMCPResource 挂载到智能体的 MCP 资源，对话时主程序读取正文作为系统提示词的参考资料
+type AgentMCPResource struct {
+	Source string `json:"source"` // global: 全局MCP服务器; agent: 智能体接入点; device: 当前对话设备
+	Server string `json:"server"` // 服务器名，空=在该来源的所有服务器中查找
+	URI    string `json:"uri"`
+	Name   string `json:"name"`
+}
+
+// 资源来源，需与主程序 internal/domain/mcp 保持一致
+var supportedMCPResourceSources = map[string]struct{}{
+	"global": {},
+	"agent":  {},
+	"device": {},
+}
+
+// normalizeAgentMCPResources 校验挂载的 MCP 资源并序列化为JSON字符串，按来源+服务器+URI 去重，空列表返回空字符串
+func normalizeAgentMCPResources(resources []AgentMCPResource) (string, error) {
+	normalized := make([]AgentMCPResource, 0, len(resources))
+	seen := make(map[string]struct{}, len(resources))
+	for _, r := range resources {
+		r.Source = strings.ToLower(strings.TrimSpace(r.Source))
+		r.Server = strings.TrimSpace(r.Server)
+		r.URI = strings.TrimSpace(r.URI)
+		r.Name = strings.TrimSpace(r.Name)
+		if r.URI == "" {
+			continue
+		}
+		if r.Source == "" {
+			r.Source = "global"
+		}
+		if _, ok := supportedMCPResourceSources[r.Source]; !ok {
+			return "", fmt.Errorf("MCP资源 %s 的来源无效: %s", r.URI, r.Source)
+		}
+		key := r.Source + "|" + r.Server + "|" + r.URI
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		normalized = append(normalized, r)
+	}
+	if len(normalized) > maxAgentMCPResources {
+		return "", fmt.Errorf("最多挂载%d个MCP资源", maxAgentMCPResources)
+	}
+	if len(normalized) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseAgentMCPResources(raw string) []AgentMCPResource {
+	resources := []AgentMCPResource{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return resources
+	}
+	if err := json.Unmarshal([]byte(raw), &resources); err != nil {
+		return []AgentMCPResource{}
+	}
+	return resources
+}
+
+// mcpContextRequester 向主程序查询 MCP 资源与提示词
+type mcpContextRequester interface {
+	RequestMcpResourcesFromClient(ctx context.Context, agentID string) ([]MCPResource, error)
+	RequestMcpPromptsFromClient(ctx context.Context, agentID string) ([]MCPPrompt, error)
+	RenderMcpPromptFromClient(ctx context.Context, body map[string]interface{}) (string, error)
+}
+
+// GetAgentMCPContextCommon 返回智能体可挂载的MCP资源、可选用的提示词模板以及已挂载的资源，
+// 主程序不可用时返回空列表与提示，不影响已挂载配置的展示
+func GetAgentMCPContextCommon(c *gin.Context, agent models.Agent, requester mcpContextRequester) {
+	agentID := fmt.Sprintf("%d", agent.ID)
+	data := gin.H{
+		"resources": []MCPResource{},
+		"prompts":   []MCPPrompt{},
+		"attached":  parseAgentMCPResources(agent.MCPResourcesConfig),
+	}
+	if requester == nil {
+		data["warning"] = "主程序未连接，无法获取MCP资源与提示词"
+		c.JSON(http.StatusOK, gin.H{"data": data})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var warnings []string
+	if resources, err := requester.RequestMcpResourcesFromClient(ctx, agentID); err != nil {
+		log.Printf("获取智能体 %s 的MCP资源失败: %v", agentID, err)
+		warnings = append(warnings, "获取MCP资源失败: "+err.Error())
+	} else {
+		data["resources"] = resources
+	}
+	if prompts, err := requester.RequestMcpPromptsFromClient(ctx, agentID); err != nil {
+		log.Printf("获取智能体 %s 的MCP提示词失败: %v", agentID, err)
+		warnings = append(warnings, "获取MCP提示词失败: "+err.Error())
+	} else {
+		data["prompts"] = prompts
+	}
+	if len(warnings) > 0 {
+		data["warning"] = strings.Join(warnings, "; ")
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// RenderAgentMCPPromptCommon 渲染MCP提示词模板，前端用结果填充角色设定
+func RenderAgentMCPPromptCommon(c *gin.Context, agent models.Agent, requester mcpContextRequester) {
+	var req struct {
+		Source    string            `json:"source" binding:"required"`
+		Server    string            `json:"server"`
+		Name      string            `json:"name" binding:"required"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if requester == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "主程序未连接"})
+		return
+	}
+
+	arguments := make(map[string]interface{}, len(req.Arguments))
+	for k, v := range req.Arguments {
+		arguments[k] = v
+	}
+	text, err := requester.RenderMcpPromptFromClient(c.Request.Context(), map[string]interface{}{
+		"agent_id":  fmt.Sprintf("%d", agent.ID),
+		"source":    req.Source,
+		"server":    req.Server,
+		"name":      req.Name,
+		"arguments": arguments,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "获取MCP提示词失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"text": text}})
+}
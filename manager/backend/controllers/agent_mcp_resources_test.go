@@ -0,0 +1,34 @@
+package controllers
+
+import "testing"
+
+func TestNormalizeAgentMCPResources(t *testing.T) {
+	got, err := normalizeAgentMCPResources([]AgentMCPResource{
+		{Source: " Global ", Server: "docs", URI: " file:///rules.md ", Name: "家规"},
+		{Source: "global", Server: "docs", URI: "file:///rules.md"},
+		{Source: "", URI: "memo://today"},
+		{Source: "agent", URI: "  "},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resources := parseAgentMCPResources(got)
+	if len(resources) != 2 {
+		t.Fatalf("unexpected resources: %+v", resources)
+	}
+	if resources[0] != (AgentMCPResource{Source: "global", Server: "docs", URI: "file:///rules.md", Name: "家规"}) {
+		t.Fatalf("unexpected first resource: %+v", resources[0])
+	}
+	if resources[1].Source != "global" || resources[1].URI != "memo://today" {
+		t.Fatalf("missing source should default to global: %+v", resources[1])
+	}
+	if got, err := normalizeAgentMCPResources(nil); err != nil || got != "" {
+		t.Fatalf("empty resources should be stored as empty string: %q %v", got, err)
+	}
+	if _, err := normalizeAgentMCPResources([]AgentMCPResource{{Source: "cloud", URI: "x://y"}}); err == nil {
+		t.Fatalf("unknown source should fail")
+	}
+	if resources := parseAgentMCPResources("not json"); len(resources) != 0 {
+		t.Fatalf("invalid json should parse to empty list: %v", resources)
+	}
+}
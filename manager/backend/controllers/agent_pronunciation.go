@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxAgentPronunciationEntries = 500
+
+// normalizeAgentPronunciationDict 校验发音词典（每行 "原词=读法"，# 开头为注释），去除空行与首尾空白
+func normalizeAgentPronunciationDict(raw string) (string, error) {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	normalized := make([]string, 0, len(lines))
+	entries := 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			normalized = append(normalized, line)
+			continue
+		}
+		word, reading, ok := strings.Cut(line, "=")
+		word = strings.TrimSpace(word)
+		if !ok || word == "" {
+			return "", fmt.Errorf("发音词典第%d行格式错误，应为 原词=读法", i+1)
+		}
+		entries++
+		if entries > maxAgentPronunciationEntries {
+			return "", fmt.Errorf("发音词典最多%d条", maxAgentPronunciationEntries)
+		}
+		normalized = append(normalized, word+"="+strings.TrimSpace(reading))
+	}
+	return strings.Join(normalized, "\n"), nil
+}
+
+// parseAgentPronunciationDict 将发音词典解析为 原词 -> 读法，格式错误的行忽略
+func parseAgentPronunciationDict(raw string) map[string]string {
+	dict := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, reading, ok := strings.Cut(line, "=")
+		if word = strings.TrimSpace(word); ok && word != "" {
+			dict[word] = strings.TrimSpace(reading)
+		}
+	}
+	return dict
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import "testing"
+
+func TestNormalizeAgentPronunciationDict(t *testing.T) {
+	got, err := normalizeAgentPronunciationDict(" ESP32 = E S P 三十二 \r\n\r\n# 注释\n小智=晓智")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "ESP32=E S P 三十二\n# 注释\n小智=晓智" {
+		t.Fatalf("unexpected dict: %q", got)
+	}
+	dict := parseAgentPronunciationDict(got)
+	if len(dict) != 2 || dict["ESP32"] != "E S P 三十二" || dict["小智"] != "晓智" {
+		t.Fatalf("unexpected parsed dict: %v", dict)
+	}
+	if _, err := normalizeAgentPronunciationDict("没有等号"); err == nil {
+		t.Fatalf("line without '=' should fail")
+	}
+	if _, err := normalizeAgentPronunciationDict("=读法"); err == nil {
+		t.Fatalf("empty word should fail")
+	}
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const maxAgentToolPolicies = 200
+
+// 工具调用策略，需与主程序 internal/domain/toolconfirm 保持一致
+var supportedToolPolicies = map[string]struct{}{
+	"allow":   {},
+	"confirm": {},
+	"deny":    {},
+}
+
+// normalizeAgentToolPolicies 校验工具调用策略（工具名或通配模式 -> allow/confirm/deny）并序列化为JSON字符串，空映射返回空字符串
+func normalizeAgentToolPolicies(policies map[string]string) (string, error) {
+	normalized := make(map[string]string, len(policies))
+	for name, policy := range policies {
+		name = strings.ToLower(strings.TrimSpace(name))
+		policy = strings.ToLower(strings.TrimSpace(policy))
+		if name == "" {
+			continue
+		}
+		if _, ok := supportedToolPolicies[policy]; !ok {
+			return "", fmt.Errorf("工具 %s 的调用策略无效: %s", name, policy)
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return "", fmt.Errorf("工具名通配格式错误: %s", name)
+		}
+		normalized[name] = policy
+	}
+	if len(normalized) > maxAgentToolPolicies {
+		return "", fmt.Errorf("工具调用策略最多%d条", maxAgentToolPolicies)
+	}
+	if len(normalized) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseAgentToolPolicies(raw string) map[string]string {
+	policies := map[string]string{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return policies
+	}
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return map[string]string{}
+	}
+	return policies
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import "testing"
+
+func TestNormalizeAgentToolPolicies(t *testing.T) {
+	got, err := normalizeAgentToolPolicies(map[string]string{" Unlock_* ": "Confirm", "format_disk": "deny", "  ": "allow"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policies := parseAgentToolPolicies(got)
+	if len(policies) != 2 || policies["unlock_*"] != "confirm" || policies["format_disk"] != "deny" {
+		t.Fatalf("unexpected policies: %v", policies)
+	}
+	if got, err := normalizeAgentToolPolicies(nil); err != nil || got != "" {
+		t.Fatalf("empty policies should be stored as empty string: %q %v", got, err)
+	}
+	if _, err := normalizeAgentToolPolicies(map[string]string{"reboot": "ask"}); err == nil {
+		t.Fatalf("unknown policy should fail")
+	}
+	if _, err := normalizeAgentToolPolicies(map[string]string{"unlock_[": "deny"}); err == nil {
+		t.Fatalf("malformed pattern should fail")
+	}
+	if policies := parseAgentToolPolicies("not json"); len(policies) != 0 {
+		t.Fatalf("invalid json should parse to empty map: %v", policies)
+	}
+}
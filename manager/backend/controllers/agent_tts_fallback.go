@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 备用TTS最多配置数量，链路过长会放大单句失败时的等待时间
+const maxAgentTTSFallbacks = 3
+
+// splitTTSFallbackConfigIDs 解析逗号分隔的备用TTS配置ID，保持顺序并去重
+func splitTTSFallbackConfigIDs(raw string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, part := range strings.Split(raw, ",") {
+		id := strings.TrimSpace(part)
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
+
+// validateTTSFallbackConfigIDs 校验备用TTS均为已启用的TTS配置，去掉与主TTS相同的项，返回归一化后的CSV
+func validateTTSFallbackConfigIDs(db *gorm.DB, raw string, primaryConfigID *string) (string, error) {
+	ids := splitTTSFallbackConfigIDs(raw)
+	if primaryConfigID != nil {
+		primary := strings.TrimSpace(*primaryConfigID)
+		filtered := ids[:0]
+		for _, id := range ids {
+			if id != primary {
+				filtered = append(filtered, id)
+			}
+		}
+		ids = filtered
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	if len(ids) > maxAgentTTSFallbacks {
+		return "", fmt.Errorf("备用TTS最多配置%d个", maxAgentTTSFallbacks)
+	}
+
+	var configs []models.Config
+	if err := db.Where("type = ? AND enabled = ? AND config_id IN ?", "tts", true, ids).Find(&configs).Error; err != nil {
+		return "", fmt.Errorf("查询TTS配置失败: %v", err)
+	}
+	found := make(map[string]struct{}, len(configs))
+	for _, config := range configs {
+		found[config.ConfigID] = struct{}{}
+	}
+	invalid := make([]string, 0)
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			invalid = append(invalid, id)
+		}
+	}
+	if len(invalid) > 0 {
+		return "", fmt.Errorf("备用TTS包含未启用或不存在的配置: %s", strings.Join(invalid, ","))
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// loadTTSFallbackConfigs 按顺序加载备用TTS配置，已删除或停用的配置跳过
+func loadTTSFallbackConfigs(db *gorm.DB, raw string) []models.Config {
+	ids := splitTTSFallbackConfigIDs(raw)
+	result := make([]models.Config, 0, len(ids))
+	if len(ids) == 0 {
+		return result
+	}
+	var configs []models.Config
+	if err := db.Where("type = ? AND enabled = ? AND config_id IN ?", "tts", true, ids).Find(&configs).Error; err != nil {
+		return result
+	}
+	byID := make(map[string]models.Config, len(configs))
+	for _, config := range configs {
+		byID[config.ConfigID] = config
+	}
+	for _, id := range ids {
+		if config, ok := byID[id]; ok {
+			result = append(result, config)
+		}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTTSFallbackConfigIDs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Config{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, cfg := range []models.Config{
+		{Type: "tts", Name: "豆包", ConfigID: "doubao", Provider: "doubao_ws", Enabled: true},
+		{Type: "tts", Name: "Edge", ConfigID: "edge", Provider: "edge", Enabled: true},
+		{Type: "tts", Name: "离线", ConfigID: "offline", Provider: "edge_offline", Enabled: true},
+		{Type: "tts", Name: "停用", ConfigID: "disabled", Provider: "edge", Enabled: true},
+	} {
+		if err := db.Create(&cfg).Error; err != nil {
+			t.Fatalf("create config: %v", err)
+		}
+	}
+	db.Model(&models.Config{}).Where("config_id = ?", "disabled").Update("enabled", false)
+
+	primary := "doubao"
+	got, err := validateTTSFallbackConfigIDs(db, " offline, doubao ,edge,offline", &primary)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "offline,edge" {
+		t.Fatalf("unexpected fallback ids: %q", got)
+	}
+	if _, err := validateTTSFallbackConfigIDs(db, "edge,disabled", &primary); err == nil {
+		t.Fatalf("disabled config should be rejected")
+	}
+	if got, _ := validateTTSFallbackConfigIDs(db, "doubao", &primary); got != "" {
+		t.Fatalf("primary only should normalize to empty, got %q", got)
+	}
+
+	configs := loadTTSFallbackConfigs(db, "offline,disabled,edge")
+	if len(configs) != 2 || configs[0].ConfigID != "offline" || configs[1].ConfigID != "edge" {
+		t.Fatalf("unexpected loaded configs: %+v", configs)
+	}
+}
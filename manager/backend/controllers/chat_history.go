@@ -14,6 +14,7 @@ import (
 	"xiaozhi/manager/backend/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gorm.io/gorm"
 )
 
@@ -47,17 +48,20 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	status, resp := c.saveMessage(&req)
+	ctx.JSON(status, resp)
+}
 
+// saveMessage 保存消息，返回 HTTP 状态码与响应体，供单条与批量接口共用
+func (c *ChatHistoryController) saveMessage(req *SaveMessageRequest) (int, interface{}) {
 	// 验证设备存在（使用device_name字段查询）
 	var device models.Device
 	if err := c.DB.Where("device_name = ?", req.DeviceID).First(&device).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
-			return
+			return http.StatusNotFound, gin.H{"error": "设备不存在"}
 		}
 		// 其他数据库错误
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查询设备失败: " + err.Error()})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "查询设备失败: " + err.Error()}
 	}
 
 	// 如果请求中没有提供 AgentID，使用设备关联的 AgentID
@@ -68,8 +72,7 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 
 	// 如果 AgentID 仍然为空，跳过保存
 	if agentID == "" {
-		ctx.JSON(http.StatusOK, gin.H{"message": "跳过保存: 没有关联的 AgentID"})
-		return
+		return http.StatusOK, gin.H{"message": "跳过保存: 没有关联的 AgentID"}
 	}
 
 	message := &models.ChatMessage{
@@ -93,8 +96,7 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 		if req.AudioData != "" {
 			audioPath, err := c.saveAudioFile(req.MessageID, req.AudioData)
 			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()})
-				return
+				return http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()}
 			}
 
 			// 如果之前有音频文件，先删除
@@ -126,25 +128,20 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 			// 手动序列化 metadata 到 MetadataJSON（因为 Updates 不会触发 BeforeSave hook）
 			metadataJSONBytes, err := json.Marshal(existingMessage.Metadata)
 			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "序列化 metadata 失败: " + err.Error()})
-				return
+				return http.StatusInternalServerError, gin.H{"error": "序列化 metadata 失败: " + err.Error()}
 			}
 			updates["metadata"] = string(metadataJSONBytes)
 
 			if err := c.DB.Model(&existingMessage).Updates(updates).Error; err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新消息失败"})
-				return
+				return http.StatusInternalServerError, gin.H{"error": "更新消息失败"}
 			}
-			ctx.JSON(http.StatusOK, existingMessage)
-			return
+			return http.StatusOK, existingMessage
 		}
 		// 消息已存在且没有音频数据，直接返回
-		ctx.JSON(http.StatusOK, existingMessage)
-		return
+		return http.StatusOK, existingMessage
 	} else if err != gorm.ErrRecordNotFound {
 		// 查询出错（非"记录不存在"）
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查询消息失败: " + err.Error()})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "查询消息失败: " + err.Error()}
 	}
 
 	// 消息不存在，创建新消息
@@ -152,8 +149,7 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 	if req.AudioData != "" {
 		audioPath, err := c.saveAudioFile(req.MessageID, req.AudioData)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()}
 		}
 		message.AudioPath = audioPath
 		message.AudioFormat = "wav" // 固定为wav格式
@@ -170,11 +166,10 @@ func (c *ChatHistoryController) SaveMessage(ctx *gin.Context) {
 		if message.AudioPath != "" {
 			c.deleteAudioFile(message.AudioPath)
 		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败: " + err.Error()})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "保存消息失败: " + err.Error()}
 	}
 
-	ctx.JSON(http.StatusCreated, message)
+	return http.StatusCreated, message
 }
 
 // GetMessages 获取消息列表（按agentId汇总）
@@ -536,6 +531,7 @@ func (c *ChatHistoryController) GetMessagesForInit(ctx *gin.Context) {
 
 // UpdateMessageAudioRequest 更新消息音频请求
 type UpdateMessageAudioRequest struct {
+	MessageID   string                 `json:"message_id,omitempty"` // 批量接口使用，单条接口以路径参数为准
 	AudioData   string                 `json:"audio_data" binding:"required"`
 	AudioFormat string                 `json:"audio_format"`
 	AudioSize   int                    `json:"audio_size"`
@@ -555,31 +551,32 @@ func (c *ChatHistoryController) UpdateMessageAudio(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	status, resp := c.updateMessageAudio(messageID, &req)
+	ctx.JSON(status, resp)
+}
 
+// updateMessageAudio 更新消息音频，返回 HTTP 状态码与响应体，供单条与批量接口共用
+func (c *ChatHistoryController) updateMessageAudio(messageID string, req *UpdateMessageAudioRequest) (int, interface{}) {
 	// 查找消息
 	var message models.ChatMessage
 	if err := c.DB.Where("message_id = ?", messageID).First(&message).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// 消息不存在，跳过更新（可能是因为 SaveMessage 时没有 AgentID 而被跳过）
-			ctx.JSON(http.StatusOK, gin.H{"message": "跳过更新: 消息不存在"})
-			return
+			return http.StatusOK, gin.H{"message": "跳过更新: 消息不存在"}
 		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "查询消息失败"})
-		return
+		return http.StatusInternalServerError, gin.H{"error": "查询消息失败"}
 	}
 
 	// 如果消息没有关联的 AgentID，跳过更新
 	if message.AgentID == "" {
-		ctx.JSON(http.StatusOK, gin.H{"message": "跳过更新: 没有关联的 AgentID"})
-		return
+		return http.StatusOK, gin.H{"message": "跳过更新: 没有关联的 AgentID"}
 	}
 
 	// 保存音频文件
 	if req.AudioData != "" {
 		audioPath, err := c.saveAudioFile(messageID, req.AudioData)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "保存音频文件失败: " + err.Error()}
 		}
 
 		// 如果之前有音频文件，先删除
@@ -606,16 +603,94 @@ func (c *ChatHistoryController) UpdateMessageAudio(ctx *gin.Context) {
 		// 手动序列化 metadata 到 MetadataJSON（因为 Updates 不会触发 BeforeSave hook）
 		metadataJSONBytes, err := json.Marshal(message.Metadata)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "序列化 metadata 失败: " + err.Error()})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "序列化 metadata 失败: " + err.Error()}
 		}
 		updates["metadata"] = string(metadataJSONBytes)
 
 		if err := c.DB.Model(&message).Updates(updates).Error; err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新消息失败"})
-			return
+			return http.StatusInternalServerError, gin.H{"error": "更新消息失败"}
 		}
 	}
 
-	ctx.JSON(http.StatusOK, message)
+	return http.StatusOK, message
+}
+
+const (
+	historyBatchOpSave        = "save"
+	historyBatchOpUpdateAudio = "update_audio"
+	maxHistoryBatchItems      = 200
+)
+
+// HistoryBatchItem 批量写入中的单条操作
+type HistoryBatchItem struct {
+	Op          string                     `json:"op"` // save / update_audio
+	Save        *SaveMessageRequest        `json:"save,omitempty"`
+	UpdateAudio *UpdateMessageAudioRequest `json:"update_audio,omitempty"`
+}
+
+// HistoryBatchRequest 批量写入请求（主程序本地落盘队列恢复后按顺序上传）
+type HistoryBatchRequest struct {
+	Items []HistoryBatchItem `json:"items" binding:"required"`
+}
+
+// HistoryBatchResult 单条操作结果，status 与单条接口的 HTTP 状态码一致
+type HistoryBatchResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SaveMessagesBatch 按顺序批量保存消息/更新音频（内部服务接口）
+// 遇到 5xx 立即停止，后续条目不执行，调用方从该条开始重试以保证同一会话内的顺序
+func (c *ChatHistoryController) SaveMessagesBatch(ctx *gin.Context) {
+	var req HistoryBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Items) > maxHistoryBatchItems {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多 %d 条", maxHistoryBatchItems)})
+		return
+	}
+
+	results := make([]HistoryBatchResult, 0, len(req.Items))
+	for i := range req.Items {
+		result := c.applyHistoryBatchItem(&req.Items[i])
+		results = append(results, result)
+		if result.Status >= http.StatusInternalServerError {
+			log.Printf("批量保存聊天记录中断于第 %d 条: %s", i, result.Error)
+			break
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (c *ChatHistoryController) applyHistoryBatchItem(item *HistoryBatchItem) HistoryBatchResult {
+	var status int
+	var resp interface{}
+	switch item.Op {
+	case historyBatchOpSave:
+		if item.Save == nil {
+			return HistoryBatchResult{Status: http.StatusBadRequest, Error: "缺少 save"}
+		}
+		if err := binding.Validator.ValidateStruct(item.Save); err != nil {
+			return HistoryBatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		status, resp = c.saveMessage(item.Save)
+	case historyBatchOpUpdateAudio:
+		if item.UpdateAudio == nil || item.UpdateAudio.MessageID == "" {
+			return HistoryBatchResult{Status: http.StatusBadRequest, Error: "缺少 update_audio.message_id"}
+		}
+		if err := binding.Validator.ValidateStruct(item.UpdateAudio); err != nil {
+			return HistoryBatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+		}
+		status, resp = c.updateMessageAudio(item.UpdateAudio.MessageID, item.UpdateAudio)
+	default:
+		return HistoryBatchResult{Status: http.StatusBadRequest, Error: "不支持的操作: " + item.Op}
+	}
+
+	result := HistoryBatchResult{Status: status}
+	if h, ok := resp.(gin.H); ok && status >= http.StatusBadRequest {
+		result.Error, _ = h["error"].(string)
+	}
+	return result
 }
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSaveMessagesBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Device{}, &models.ChatMessage{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.Create(&models.Device{UserID: 1, AgentID: 3, DeviceName: "aa:bb"})
+	controller := &ChatHistoryController{DB: db, AudioBasePath: t.TempDir(), MaxFileSize: 1 << 20}
+
+	audio := base64.StdEncoding.EncodeToString([]byte("RIFF"))
+	body := `{"items":[
+		{"op":"save","save":{"message_id":"m1","device_id":"aa:bb","agent_id":"3","session_id":"s1","role":"assistant","content":"你好"}},
+		{"op":"update_audio","update_audio":{"message_id":"m1","audio_data":"` + audio + `","audio_format":"wav","audio_size":4}},
+		{"op":"save","save":{"message_id":"m2","device_id":"unknown","agent_id":"3","role":"user","content":"hi"}},
+		{"op":"save","save":{"message_id":"m3","device_id":"aa:bb","agent_id":"3","role":"bad","content":"hi"}},
+		{"op":"delete"},
+		{"op":"save","save":{"message_id":"m1","device_id":"aa:bb","agent_id":"3","role":"assistant","content":"你好"}}
+	]}`
+
+	router := gin.New()
+	router.POST("/batch", controller.SaveMessagesBatch)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Results []HistoryBatchResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusBadRequest, http.StatusBadRequest, http.StatusOK}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	for i, status := range want {
+		if resp.Results[i].Status != status {
+			t.Fatalf("item %d status = %d, want %d (%s)", i, resp.Results[i].Status, status, resp.Results[i].Error)
+		}
+	}
+
+	var message models.ChatMessage
+	if err := db.Where("message_id = ?", "m1").First(&message).Error; err != nil {
+		t.Fatalf("message m1 not saved: %v", err)
+	}
+	if message.AudioPath == "" || message.SessionID != "s1" {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+	var count int64
+	db.Model(&models.ChatMessage{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("messages = %d, want 1", count)
+	}
+}
@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 持久化任务队列：任务写入 jobs 表，worker 以租约方式领取执行，
+// 进程重启后未完成的任务会在租约过期后被重新领取。
+const (
+	jobStatusQueued    = "queued"
+	jobStatusRunning   = "running"
+	jobStatusSucceeded = "succeeded"
+	jobStatusFailed    = "failed"
+	jobStatusCancelled = "cancelled"
+
+	jobDefaultWorkers      = 1
+	jobPollInterval        = 2 * time.Second
+	jobDefaultTimeout      = 2 * time.Minute
+	jobDefaultMaxAttempts  = 5
+	jobLeaseGrace          = time.Minute
+	jobRetryBaseDelay      = 10 * time.Second
+	jobRetryMaxDelay       = 10 * time.Minute
+	jobLastErrorMaxLength  = 2000
+	jobClaimCandidateLimit = 5
+)
+
+// jobHandlerFunc 执行单个任务；返回错误时按退避策略重试，直到达到最大次数
+type jobHandlerFunc func(ctx context.Context, db *gorm.DB, job *models.Job) error
+
+// permanentJobError 标记不可重试的错误，任务直接进入 failed 状态
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+// permanentJobErr 包装不可重试的错误
+func permanentJobErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentJobError{err: err}
+}
+
+type jobHandlerSpec struct {
+	handler     jobHandlerFunc
+	timeout     time.Duration
+	maxAttempts int
+	// workers 该任务类型独占的 worker 数，各类型互不阻塞（长时间的知识库同步不会拖慢回调投递）
+	workers int
+	// onCancel 任务被取消后回调，用于同步业务表状态
+	onCancel func(db *gorm.DB, job *models.Job)
+	// onRetry 任务重新排队前回调，返回错误时拒绝重试
+	onRetry func(db *gorm.DB, job *models.Job) error
+}
+
+type jobQueue struct {
+	db       *gorm.DB
+	owner    string
+	mu       sync.RWMutex
+	handlers map[string]jobHandlerSpec
+	// wakeups 每个任务类型一个唤醒通道
+	wakeups map[string]chan struct{}
+	started bool
+	running map[uint]context.CancelFunc
+}
+
+var (
+	globalJobQueue = &jobQueue{
+		handlers: make(map[string]jobHandlerSpec),
+		wakeups:  make(map[string]chan struct{}),
+		running:  make(map[uint]context.CancelFunc),
+	}
+	jobWorkersOnce sync.Once
+)
+
+// StartJobWorkers 启动持久化任务队列的 worker（重复调用无副作用）
+func StartJobWorkers(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	jobWorkersOnce.Do(func() {
+		hostname, _ := os.Hostname()
+		globalJobQueue.mu.Lock()
+		globalJobQueue.db = db
+		globalJobQueue.owner = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		globalJobQueue.started = true
+		for jobType, spec := range globalJobQueue.handlers {
+			globalJobQueue.startWorkersLocked(jobType, spec)
+		}
+		globalJobQueue.mu.Unlock()
+		log.Printf("[JobQueue] workers started owner=%s", globalJobQueue.owner)
+	})
+}
+
+// startWorkersLocked 为任务类型启动独占的 worker，调用方持有 q.mu
+func (q *jobQueue) startWorkersLocked(jobType string, spec jobHandlerSpec) {
+	for i := 1; i <= spec.workers; i++ {
+		go q.runWorker(jobType, i)
+	}
+	log.Printf("[JobQueue] type=%s workers=%d", jobType, spec.workers)
+}
+
+// registerJobHandler 注册任务类型的处理函数，未注册的任务类型不会被领取
+func registerJobHandler(jobType string, spec jobHandlerSpec) {
+	if spec.timeout <= 0 {
+		spec.timeout = jobDefaultTimeout
+	}
+	if spec.maxAttempts <= 0 {
+		spec.maxAttempts = jobDefaultMaxAttempts
+	}
+	if spec.workers <= 0 {
+		spec.workers = jobDefaultWorkers
+	}
+	globalJobQueue.mu.Lock()
+	_, registered := globalJobQueue.handlers[jobType]
+	globalJobQueue.handlers[jobType] = spec
+	if _, ok := globalJobQueue.wakeups[jobType]; !ok {
+		globalJobQueue.wakeups[jobType] = make(chan struct{}, 1)
+	}
+	// 队列已启动时，新注册的类型立即启动 worker
+	if globalJobQueue.started && !registered {
+		globalJobQueue.startWorkersLocked(jobType, spec)
+	}
+	globalJobQueue.mu.Unlock()
+	globalJobQueue.notify(jobType)
+}
+
+// enqueueJob 写入一条待执行任务；dedupeKey 非空时若已存在同 key 的排队任务则直接复用
+func enqueueJob(db *gorm.DB, jobType, dedupeKey string, payload any) (*models.Job, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库连接为空")
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化任务参数失败: %w", err)
+	}
+	maxAttempts := jobDefaultMaxAttempts
+	globalJobQueue.mu.RLock()
+	if spec, ok := globalJobQueue.handlers[jobType]; ok {
+		maxAttempts = spec.maxAttempts
+	}
+	globalJobQueue.mu.RUnlock()
+
+	var job models.Job
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if dedupeKey != "" {
+			err := tx.Where("dedupe_key = ? AND status = ?", dedupeKey, jobStatusQueued).First(&job).Error
+			if err == nil {
+				return tx.Model(&models.Job{}).Where("id = ?", job.ID).Update("payload", string(payloadJSON)).Error
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		job = models.Job{
+			JobType:     jobType,
+			DedupeKey:   dedupeKey,
+			Payload:     string(payloadJSON),
+			Status:      jobStatusQueued,
+			MaxAttempts: maxAttempts,
+			NextRunAt:   time.Now(),
+		}
+		return tx.Create(&job).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("写入任务队列失败: %w", err)
+	}
+	globalJobQueue.notify(jobType)
+	return &job, nil
+}
+
+// hasActiveJob 判断是否存在排队中或执行中的同 key 任务
+func hasActiveJob(db *gorm.DB, dedupeKey string) (bool, error) {
+	var count int64
+	err := db.Model(&models.Job{}).
+		Where("dedupe_key = ? AND status IN ?", dedupeKey, []string{jobStatusQueued, jobStatusRunning}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// retryJob 将失败或已取消的任务重新放回队列
+func retryJob(db *gorm.DB, jobID uint) error {
+	var job models.Job
+	if err := db.First(&job, jobID).Error; err != nil {
+		return fmt.Errorf("任务不存在")
+	}
+	if job.Status != jobStatusFailed && job.Status != jobStatusCancelled {
+		return fmt.Errorf("仅失败或已取消的任务可以重试")
+	}
+	if spec, ok := globalJobQueue.handlerFor(job.JobType); ok && spec.onRetry != nil {
+		if err := spec.onRetry(db, &job); err != nil {
+			return err
+		}
+	}
+	result := db.Model(&models.Job{}).
+		Where("id = ? AND status IN ?", jobID, []string{jobStatusFailed, jobStatusCancelled}).
+		Updates(map[string]any{
+			"status":      jobStatusQueued,
+			"attempts":    0,
+			"next_run_at": time.Now(),
+			"lease_owner": "",
+			"lease_until": nil,
+			"finished_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("仅失败或已取消的任务可以重试")
+	}
+	globalJobQueue.notify(job.JobType)
+	return nil
+}
+
+// cancelJob 取消排队中或执行中的任务；执行中的任务会收到 context 取消信号且结果被丢弃
+func cancelJob(db *gorm.DB, jobID uint) error {
+	now := time.Now()
+	result := db.Model(&models.Job{}).
+		Where("id = ? AND status IN ?", jobID, []string{jobStatusQueued, jobStatusRunning}).
+		Updates(map[string]any{
+			"status":      jobStatusCancelled,
+			"lease_until": nil,
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("仅排队中或执行中的任务可以取消")
+	}
+	globalJobQueue.mu.RLock()
+	cancel := globalJobQueue.running[jobID]
+	globalJobQueue.mu.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+
+	var job models.Job
+	if err := db.First(&job, jobID).Error; err == nil {
+		if spec, ok := globalJobQueue.handlerFor(job.JobType); ok && spec.onCancel != nil {
+			spec.onCancel(db, &job)
+		}
+	}
+	return nil
+}
+
+func (q *jobQueue) wakeupFor(jobType string) chan struct{} {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.wakeups[jobType]
+}
+
+func (q *jobQueue) notify(jobType string) {
+	ch := q.wakeupFor(jobType)
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *jobQueue) runWorker(jobType string, workerID int) {
+	wakeup := q.wakeupFor(jobType)
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			job, spec, err := q.claimNext(jobType, workerID)
+			if err != nil {
+				log.Printf("[JobQueue] type=%s worker=%d claim failed: %v", jobType, workerID, err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.execute(workerID, job, spec)
+		}
+		select {
+		case <-wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *jobQueue) handlerFor(jobType string) (jobHandlerSpec, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	spec, ok := q.handlers[jobType]
+	return spec, ok
+}
+
+// claimNext 领取一条指定类型的到期排队任务，或租约已过期的执行中任务（进程崩溃后恢复）
+func (q *jobQueue) claimNext(jobType string, workerID int) (*models.Job, jobHandlerSpec, error) {
+	spec, ok := q.handlerFor(jobType)
+	if !ok {
+		return nil, jobHandlerSpec{}, nil
+	}
+	now := time.Now()
+	var candidates []models.Job
+	if err := q.db.Select("id").
+		Where("job_type = ?", jobType).
+		Where("(status = ? AND next_run_at <= ?) OR (status = ? AND lease_until < ?)", jobStatusQueued, now, jobStatusRunning, now).
+		Order("next_run_at ASC").
+		Limit(jobClaimCandidateLimit).
+		Find(&candidates).Error; err != nil {
+		return nil, jobHandlerSpec{}, err
+	}
+
+	owner := fmt.Sprintf("%s-%s-w%d", q.owner, jobType, workerID)
+	for _, candidate := range candidates {
+		leaseUntil := now.Add(spec.timeout + jobLeaseGrace)
+		result := q.db.Model(&models.Job{}).
+			Where("id = ?", candidate.ID).
+			Where("(status = ? AND next_run_at <= ?) OR (status = ? AND lease_until < ?)", jobStatusQueued, now, jobStatusRunning, now).
+			Updates(map[string]any{
+				"status":      jobStatusRunning,
+				"attempts":    gorm.Expr("attempts + ?", 1),
+				"lease_owner": owner,
+				"lease_until": leaseUntil,
+				"started_at":  now,
+			})
+		if result.Error != nil {
+			return nil, jobHandlerSpec{}, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		var job models.Job
+		if err := q.db.First(&job, candidate.ID).Error; err != nil {
+			return nil, jobHandlerSpec{}, err
+		}
+		return &job, spec, nil
+	}
+	return nil, jobHandlerSpec{}, nil
+}
+
+func (q *jobQueue) execute(workerID int, job *models.Job, spec jobHandlerSpec) {
+	waitMs := time.Since(job.NextRunAt).Milliseconds()
+	start := time.Now()
+
+	if job.Attempts > job.MaxAttempts {
+		q.finish(job, fmt.Errorf("超过最大重试次数(%d)", job.MaxAttempts), false)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spec.timeout)
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	err := runJobHandler(ctx, spec.handler, q.db, job)
+	var permanent *permanentJobError
+	retryable := err != nil && !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts
+	if err != nil {
+		log.Printf("[JobQueue] worker=%d job_id=%d type=%s attempt=%d/%d wait_ms=%d cost_ms=%d retry=%v err=%v",
+			workerID, job.ID, job.JobType, job.Attempts, job.MaxAttempts, waitMs, time.Since(start).Milliseconds(), retryable, err)
+	} else {
+		log.Printf("[JobQueue] worker=%d job_id=%d type=%s attempt=%d/%d wait_ms=%d cost_ms=%d status=ok",
+			workerID, job.ID, job.JobType, job.Attempts, job.MaxAttempts, waitMs, time.Since(start).Milliseconds())
+	}
+	q.finish(job, err, retryable)
+}
+
+// runJobHandler 执行处理函数并隔离 panic，避免单个任务拖垮 worker
+func runJobHandler(ctx context.Context, handler jobHandlerFunc, db *gorm.DB, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务执行panic: %v", r)
+		}
+	}()
+	return handler(ctx, db, job)
+}
+
+// finish 回写任务结果；仅当任务仍由当前 worker 持有时生效（已取消的任务结果会被丢弃）
+func (q *jobQueue) finish(job *models.Job, jobErr error, retryable bool) {
+	now := time.Now()
+	updates := map[string]any{
+		"lease_owner": "",
+		"lease_until": nil,
+	}
+	switch {
+	case jobErr == nil:
+		updates["status"] = jobStatusSucceeded
+		updates["last_error"] = ""
+		updates["finished_at"] = now
+	case retryable:
+		updates["status"] = jobStatusQueued
+		updates["last_error"] = truncateForLog(strings.TrimSpace(jobErr.Error()), jobLastErrorMaxLength)
+		updates["next_run_at"] = now.Add(jobRetryDelay(job.Attempts))
+	default:
+		updates["status"] = jobStatusFailed
+		updates["last_error"] = truncateForLog(strings.TrimSpace(jobErr.Error()), jobLastErrorMaxLength)
+		updates["finished_at"] = now
+	}
+	result := q.db.Model(&models.Job{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", job.ID, jobStatusRunning, job.LeaseOwner).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[JobQueue] job_id=%d update result failed: %v", job.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("[JobQueue] job_id=%d result discarded (cancelled or lease lost)", job.ID)
+	}
+}
+
+// jobRetryDelay 指数退避：10s、20s、40s ... 最长 10 分钟
+func jobRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= jobRetryMaxDelay {
+			return jobRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// decodeJobPayload 解析任务参数
+func decodeJobPayload(job *models.Job, out any) error {
+	if job == nil || strings.TrimSpace(job.Payload) == "" {
+		return fmt.Errorf("任务参数为空")
+	}
+	if err := json.Unmarshal([]byte(job.Payload), out); err != nil {
+		return fmt.Errorf("解析任务参数失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newJobQueueTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func newTestJobQueue(db *gorm.DB, jobType string, spec jobHandlerSpec) *jobQueue {
+	return &jobQueue{
+		db:       db,
+		owner:    "test",
+		handlers: map[string]jobHandlerSpec{jobType: spec},
+		wakeups:  map[string]chan struct{}{jobType: make(chan struct{}, 1)},
+		running:  make(map[uint]context.CancelFunc),
+	}
+}
+
+func TestJobRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 10 * time.Second},
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 4, want: 80 * time.Second},
+		{attempts: 20, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := jobRetryDelay(tt.attempts); got != tt.want {
+			t.Fatalf("jobRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestEnqueueJobDedupe(t *testing.T) {
+	db := newJobQueueTestDB(t)
+
+	first, err := enqueueJob(db, "test_dedupe", "kb:1", map[string]any{"v": 1})
+	if err != nil {
+		t.Fatalf("enqueue first: %v", err)
+	}
+	second, err := enqueueJob(db, "test_dedupe", "kb:1", map[string]any{"v": 2})
+	if err != nil {
+		t.Fatalf("enqueue second: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Fatalf("dedupe enqueue created new job: %d != %d", first.ID, second.ID)
+	}
+	var stored models.Job
+	db.First(&stored, first.ID)
+	if stored.Payload != `{"v":2}` {
+		t.Fatalf("payload = %s, want latest payload", stored.Payload)
+	}
+
+	if _, err := enqueueJob(db, "test_dedupe", "", map[string]any{"v": 3}); err != nil {
+		t.Fatalf("enqueue without key: %v", err)
+	}
+	var count int64
+	db.Model(&models.Job{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("job count = %d, want 2", count)
+	}
+}
+
+func TestJobQueueRetryThenFail(t *testing.T) {
+	db := newJobQueueTestDB(t)
+	calls := 0
+	q := newTestJobQueue(db, "test_retry", jobHandlerSpec{
+		handler: func(context.Context, *gorm.DB, *models.Job) error {
+			calls++
+			return errors.New("boom")
+		},
+		timeout:     time.Second,
+		maxAttempts: 2,
+	})
+	job := models.Job{JobType: "test_retry", Status: jobStatusQueued, MaxAttempts: 2, NextRunAt: time.Now().Add(-time.Second)}
+	db.Create(&job)
+
+	claimed, spec, err := q.claimNext("test_retry", 1)
+	if err != nil || claimed == nil {
+		t.Fatalf("claimNext() = %v, %v", claimed, err)
+	}
+	q.execute(1, claimed, spec)
+	db.First(&job, job.ID)
+	if job.Status != jobStatusQueued || job.Attempts != 1 || job.LastError != "boom" {
+		t.Fatalf("after first failure: status=%s attempts=%d last_error=%q", job.Status, job.Attempts, job.LastError)
+	}
+	if !job.NextRunAt.After(time.Now()) {
+		t.Fatalf("next_run_at should be in the future after failure")
+	}
+
+	// 退避期间不应被领取
+	if again, _, _ := q.claimNext("test_retry", 1); again != nil {
+		t.Fatalf("job claimed before backoff elapsed")
+	}
+
+	db.Model(&models.Job{}).Where("id = ?", job.ID).Update("next_run_at", time.Now().Add(-time.Second))
+	claimed, spec, _ = q.claimNext("test_retry", 1)
+	q.execute(1, claimed, spec)
+	db.First(&job, job.ID)
+	if job.Status != jobStatusFailed || job.Attempts != 2 || calls != 2 {
+		t.Fatalf("after final failure: status=%s attempts=%d calls=%d", job.Status, job.Attempts, calls)
+	}
+
+	if err := retryJob(db, job.ID); err != nil {
+		t.Fatalf("retryJob: %v", err)
+	}
+	db.First(&job, job.ID)
+	if job.Status != jobStatusQueued || job.Attempts != 0 {
+		t.Fatalf("after retry: status=%s attempts=%d", job.Status, job.Attempts)
+	}
+}
+
+func TestJobQueuePermanentErrorAndCancel(t *testing.T) {
+	db := newJobQueueTestDB(t)
+	q := newTestJobQueue(db, "test_permanent", jobHandlerSpec{
+		handler: func(context.Context, *gorm.DB, *models.Job) error {
+			return permanentJobErr(errors.New("bad payload"))
+		},
+		timeout:     time.Second,
+		maxAttempts: 5,
+	})
+	job := models.Job{JobType: "test_permanent", Status: jobStatusQueued, MaxAttempts: 5, NextRunAt: time.Now().Add(-time.Second)}
+	db.Create(&job)
+	claimed, spec, _ := q.claimNext("test_permanent", 1)
+	q.execute(1, claimed, spec)
+	db.First(&job, job.ID)
+	if job.Status != jobStatusFailed || job.Attempts != 1 {
+		t.Fatalf("permanent error: status=%s attempts=%d", job.Status, job.Attempts)
+	}
+
+	queued := models.Job{JobType: "test_permanent", Status: jobStatusQueued, MaxAttempts: 5, NextRunAt: time.Now().Add(time.Hour)}
+	db.Create(&queued)
+	if err := cancelJob(db, queued.ID); err != nil {
+		t.Fatalf("cancelJob: %v", err)
+	}
+	db.First(&queued, queued.ID)
+	if queued.Status != jobStatusCancelled {
+		t.Fatalf("cancelled status = %s", queued.Status)
+	}
+	if err := cancelJob(db, queued.ID); err == nil {
+		t.Fatalf("cancelling a cancelled job should fail")
+	}
+}
+
+func TestJobQueueReclaimsExpiredLease(t *testing.T) {
+	db := newJobQueueTestDB(t)
+	q := newTestJobQueue(db, "test_lease", jobHandlerSpec{
+		handler:     func(context.Context, *gorm.DB, *models.Job) error { return nil },
+		timeout:     time.Second,
+		maxAttempts: 3,
+	})
+	expired := time.Now().Add(-time.Minute)
+	job := models.Job{JobType: "test_lease", Status: jobStatusRunning, Attempts: 1, MaxAttempts: 3, LeaseOwner: "dead-worker", LeaseUntil: &expired, NextRunAt: expired}
+	db.Create(&job)
+
+	claimed, spec, err := q.claimNext("test_lease", 2)
+	if err != nil || claimed == nil {
+		t.Fatalf("expired lease not reclaimed: %v", err)
+	}
+	if claimed.LeaseOwner != "test-test_lease-w2" || claimed.Attempts != 2 {
+		t.Fatalf("reclaimed owner=%s attempts=%d", claimed.LeaseOwner, claimed.Attempts)
+	}
+	q.execute(2, claimed, spec)
+	db.First(&job, job.ID)
+	if job.Status != jobStatusSucceeded {
+		t.Fatalf("status = %s, want succeeded", job.Status)
+	}
+}
+
+// 每个 worker 只领取自己类型的任务，长任务不会阻塞其他类型
+func TestJobQueueClaimsOnlyOwnType(t *testing.T) {
+	db := newJobQueueTestDB(t)
+	q := newTestJobQueue(db, "test_fast", jobHandlerSpec{
+		handler:     func(context.Context, *gorm.DB, *models.Job) error { return nil },
+		timeout:     time.Second,
+		maxAttempts: 1,
+	})
+	q.handlers["test_slow"] = q.handlers["test_fast"]
+	slow := models.Job{JobType: "test_slow", Status: jobStatusQueued, MaxAttempts: 1, NextRunAt: time.Now().Add(-time.Minute)}
+	db.Create(&slow)
+	fast := models.Job{JobType: "test_fast", Status: jobStatusQueued, MaxAttempts: 1, NextRunAt: time.Now().Add(-time.Second)}
+	db.Create(&fast)
+
+	claimed, _, err := q.claimNext("test_fast", 1)
+	if err != nil || claimed == nil || claimed.ID != fast.ID {
+		t.Fatalf("claimNext(test_fast) = %v, %v; want job %d", claimed, err, fast.ID)
+	}
+	if again, _, _ := q.claimNext("test_fast", 1); again != nil {
+		t.Fatalf("test_fast worker claimed job of another type: %d", again.ID)
+	}
+}
+
+func TestJobQueueCancelAndRetryHooks(t *testing.T) {
+	db := newJobQueueTestDB(t)
+	var cancelled []uint
+	retryErr := errors.New("任务已完成")
+	registerJobHandler("test_hooks", jobHandlerSpec{
+		handler: func(context.Context, *gorm.DB, *models.Job) error { return nil },
+		onCancel: func(_ *gorm.DB, job *models.Job) {
+			cancelled = append(cancelled, job.ID)
+		},
+		onRetry: func(_ *gorm.DB, job *models.Job) error {
+			if job.Payload == `{"done":true}` {
+				return retryErr
+			}
+			return nil
+		},
+	})
+	t.Cleanup(func() {
+		globalJobQueue.mu.Lock()
+		delete(globalJobQueue.handlers, "test_hooks")
+		globalJobQueue.mu.Unlock()
+	})
+
+	job := models.Job{JobType: "test_hooks", Status: jobStatusQueued, MaxAttempts: 1, NextRunAt: time.Now()}
+	db.Create(&job)
+	if err := cancelJob(db, job.ID); err != nil {
+		t.Fatalf("cancelJob: %v", err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != job.ID {
+		t.Fatalf("onCancel calls = %v", cancelled)
+	}
+	if err := retryJob(db, job.ID); err != nil {
+		t.Fatalf("retryJob: %v", err)
+	}
+
+	done := models.Job{JobType: "test_hooks", Status: jobStatusFailed, MaxAttempts: 1, Payload: `{"done":true}`, NextRunAt: time.Now()}
+	db.Create(&done)
+	if err := retryJob(db, done.ID); !errors.Is(err, retryErr) {
+		t.Fatalf("retryJob err = %v, want onRetry error", err)
+	}
+	db.First(&done, done.ID)
+	if done.Status != jobStatusFailed {
+		t.Fatalf("rejected retry changed status to %s", done.Status)
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// JobController 持久化任务队列管理（管理员接口）
+type JobController struct {
+	DB *gorm.DB
+}
+
+// NewJobController 创建任务队列控制器并启动队列 worker
+func NewJobController(db *gorm.DB) *JobController {
+	StartJobWorkers(db)
+	return &JobController{DB: db}
+}
+
+// GetJobs 分页查询任务，支持按 status / job_type 过滤
+func (jc *JobController) GetJobs(c *gin.Context) {
+	page := parsePositiveInt(c.Query("page"), 1)
+	pageSize := parsePositiveInt(c.Query("page_size"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	query := jc.DB.Model(&models.Job{})
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := strings.TrimSpace(c.Query("job_type")); jobType != "" {
+		query = query.Where("job_type = ?", jobType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询任务失败"})
+		return
+	}
+	var jobs []models.Job
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询任务失败"})
+		return
+	}
+
+	var counts []struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+	jc.DB.Model(&models.Job{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts)
+	summary := make(map[string]int64, len(counts))
+	for _, item := range counts {
+		summary[item.Status] = item.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      jobs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"summary":   summary,
+	})
+}
+
+// GetJob 获取单个任务详情
+func (jc *JobController) GetJob(c *gin.Context) {
+	jobID, ok := parseJobIDParam(c)
+	if !ok {
+		return
+	}
+	var job models.Job
+	if err := jc.DB.First(&job, jobID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+// RetryJob 重新执行失败或已取消的任务
+func (jc *JobController) RetryJob(c *gin.Context) {
+	jobID, ok := parseJobIDParam(c)
+	if !ok {
+		return
+	}
+	if err := retryJob(jc.DB, jobID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "任务已重新排队"})
+}
+
+// CancelJob 取消排队中或执行中的任务
+func (jc *JobController) CancelJob(c *gin.Context) {
+	jobID, ok := parseJobIDParam(c)
+	if !ok {
+		return
+	}
+	if err := cancelJob(jc.DB, jobID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "任务已取消"})
+}
+
+func parseJobIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -861,6 +861,17 @@ func (uc *UserController) TestKnowledgeBaseSearch(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+	case knowledgeLocalProvider:
+		cfg, err := parseLocalKnowledgeConfig(providerData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hits, err = searchLocalKnowledge(c.Request.Context(), uc.DB, cfg, req.Threshold, []localKnowledgeSearchTarget{{KnowledgeBase: *kb}}, query, topK)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("当前 provider %s 暂不支持测试检索", provider)})
 		return
@@ -987,7 +998,7 @@ func (uc *UserController) CreateKnowledgeBaseDocumentByUpload(c *gin.Context) {
 		return
 	}
 	provider = strings.ToLower(strings.TrimSpace(provider))
-	if provider != "dify" && provider != "ragflow" && provider != "weknora" {
+	if provider != "dify" && provider != "ragflow" && provider != "weknora" && provider != knowledgeLocalProvider {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("当前知识库提供商为 %s，暂不支持文件上传创建文档", provider)})
 		return
 	}
@@ -1793,6 +1804,8 @@ func getAllowedKnowledgeUploadExtByProvider(provider string) (map[string]struct{
 		return allowedKnowledgeRagflowFileExt, "txt, text, md, markdown, pdf, doc, docx, ppt, pptx, xls, xlsx, wps, json, csv, log, xml, html, htm, yml, yaml, rtf, sql, ini, jpg, jpeg, png, gif, bmp, webp, tif, tiff, eml, msg"
 	case "weknora":
 		return allowedKnowledgeWeknoraFileExt, "txt, text, md, markdown, pdf, doc, docx, ppt, pptx, xls, xlsx, wps, json, csv, log, xml, html, htm, yml, yaml, rtf, sql, ini, jpg, jpeg, png, gif, bmp, webp, tif, tiff, eml, msg"
+	case knowledgeLocalProvider:
+		return allowedKnowledgeLocalFileExt, "txt, text, md, markdown, pdf, docx"
 	default:
 		return allowedKnowledgeRagflowFileExt, "txt, md, pdf, docx 等"
 	}
@@ -0,0 +1,832 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledongthuc/pdf"
+	"gorm.io/gorm"
+)
+
+// 内置本地知识库：文档切块后通过 OpenAI 兼容的 embedding 接口向量化，
+// 向量与分词结果存放在 knowledge_chunks 表中，检索时使用 BM25 + 余弦相似度混合打分。
+
+const (
+	knowledgeLocalProvider             = "local"
+	defaultLocalChunkSize              = 500
+	defaultLocalChunkOverlap           = 80
+	defaultLocalEmbeddingBatchSize     = 16
+	defaultLocalVectorWeight           = 0.7
+	defaultLocalScoreThreshold         = 0.3
+	localEmbeddingHTTPTimeout          = 60 * time.Second
+	localKnowledgeSearchTimeout        = 12 * time.Second
+	localBM25K1                        = 1.2
+	localBM25B                         = 0.75
+	localKnowledgeMaxChunksPerDocument = 2000
+)
+
+var allowedKnowledgeLocalFileExt = map[string]struct{}{
+	".txt":      {},
+	".text":     {},
+	".md":       {},
+	".markdown": {},
+	".pdf":      {},
+	".docx":     {},
+}
+
+type localKnowledgeConfig struct {
+	EmbeddingBaseURL    string
+	EmbeddingAPIKey     string
+	EmbeddingModel      string
+	EmbeddingDimensions int
+	ChunkSize           int
+	ChunkOverlap        int
+	BatchSize           int
+	VectorWeight        float64
+	ScoreThreshold      float64
+}
+
+func parseLocalKnowledgeConfig(providerData map[string]interface{}) (*localKnowledgeConfig, error) {
+	cfg := &localKnowledgeConfig{
+		EmbeddingBaseURL: strings.TrimSpace(firstNonEmptyMapString(providerData, "embedding_base_url", "base_url")),
+		EmbeddingAPIKey:  strings.TrimSpace(firstNonEmptyMapString(providerData, "embedding_api_key", "api_key")),
+		EmbeddingModel:   strings.TrimSpace(firstNonEmptyMapString(providerData, "embedding_model", "model")),
+		ChunkSize:        defaultLocalChunkSize,
+		ChunkOverlap:     defaultLocalChunkOverlap,
+		BatchSize:        defaultLocalEmbeddingBatchSize,
+		VectorWeight:     clampKnowledgeThreshold(parseKnowledgeSearchFloat(providerData["vector_weight"], defaultLocalVectorWeight)),
+		ScoreThreshold:   clampKnowledgeThreshold(parseKnowledgeSearchFloat(providerData["score_threshold"], defaultLocalScoreThreshold)),
+	}
+	if cfg.EmbeddingBaseURL == "" {
+		return nil, fmt.Errorf("local embedding_base_url 不能为空")
+	}
+	if cfg.EmbeddingModel == "" {
+		return nil, fmt.Errorf("local embedding_model 不能为空")
+	}
+	if v, ok := parseInt(providerData["embedding_dimensions"]); ok && v > 0 {
+		cfg.EmbeddingDimensions = v
+	}
+	if v, ok := parseInt(providerData["chunk_size"]); ok && v > 0 {
+		cfg.ChunkSize = v
+	}
+	if v, ok := parseInt(providerData["chunk_overlap"]); ok && v >= 0 {
+		cfg.ChunkOverlap = v
+	}
+	if cfg.ChunkOverlap >= cfg.ChunkSize {
+		cfg.ChunkOverlap = cfg.ChunkSize / 5
+	}
+	if v, ok := parseInt(providerData["embedding_batch_size"]); ok && v > 0 {
+		cfg.BatchSize = v
+	}
+	return cfg, nil
+}
+
+func localKnowledgeDatasetID(kbID uint) string {
+	return fmt.Sprintf("local_kb_%d", kbID)
+}
+
+func localKnowledgeDocumentID(docID uint) string {
+	return fmt.Sprintf("local_doc_%d", docID)
+}
+
+func syncKnowledgeBaseToLocal(db *gorm.DB, cfg *localKnowledgeConfig, kb *models.KnowledgeBase) (*knowledgeProviderSyncResult, error) {
+	if kb == nil {
+		return nil, fmt.Errorf("知识库数据为空")
+	}
+	result := &knowledgeProviderSyncResult{
+		DatasetID:    localKnowledgeDatasetID(kb.ID),
+		AutoDataset:  true,
+		SyncProvider: knowledgeLocalProvider,
+	}
+
+	// 知识库自身正文作为 document_id=0 的虚拟文档索引；正文为空时仅清理旧切块
+	content := strings.TrimSpace(kb.Content)
+	if content == "" {
+		if err := db.Where("knowledge_base_id = ? AND document_id = ?", kb.ID, 0).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return result, fmt.Errorf("清理本地知识库切块失败: %w", err)
+		}
+	} else {
+		count, err := indexLocalKnowledgeText(context.Background(), db, cfg, kb.ID, 0, content)
+		if err != nil {
+			return result, err
+		}
+		log.Printf("[KnowledgeSync][Local] kb indexed kb_id=%d chunks=%d", kb.ID, count)
+	}
+	now := time.Now()
+	result.LastSyncedAt = &now
+	return result, nil
+}
+
+func deleteKnowledgeBaseFromLocal(db *gorm.DB, kb *models.KnowledgeBase) error {
+	if kb == nil {
+		return fmt.Errorf("知识库数据为空")
+	}
+	return db.Where("knowledge_base_id = ?", kb.ID).Delete(&models.KnowledgeChunk{}).Error
+}
+
+func deleteKnowledgeDocumentFromLocal(db *gorm.DB, kbID, docID uint) error {
+	return db.Where("knowledge_base_id = ? AND document_id = ?", kbID, docID).Delete(&models.KnowledgeChunk{}).Error
+}
+
+func ensureLocalDatasetForKnowledgeBase(db *gorm.DB, kb *models.KnowledgeBase) (string, error) {
+	if kb == nil {
+		return "", fmt.Errorf("知识库为空")
+	}
+	datasetID := localKnowledgeDatasetID(kb.ID)
+	if strings.TrimSpace(kb.ExternalKBID) == datasetID {
+		return datasetID, nil
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"external_kb_id": datasetID,
+		"auto_dataset":   true,
+		"sync_provider":  knowledgeLocalProvider,
+		"sync_status":    knowledgeSyncStatusSynced,
+		"sync_error":     "",
+		"last_synced_at": &now,
+	}
+	if err := db.Model(&models.KnowledgeBase{}).Where("id = ?", kb.ID).Updates(updates).Error; err != nil {
+		return "", fmt.Errorf("更新知识库dataset_id失败: %w", err)
+	}
+	kb.ExternalKBID = datasetID
+	kb.AutoDataset = true
+	kb.SyncProvider = knowledgeLocalProvider
+	kb.SyncStatus = knowledgeSyncStatusSynced
+	kb.SyncError = ""
+	kb.LastSyncedAt = &now
+	return datasetID, nil
+}
+
+// indexLocalKnowledgeText 切块、向量化并整体替换某文档的切块，返回切块数量
+func indexLocalKnowledgeText(ctx context.Context, db *gorm.DB, cfg *localKnowledgeConfig, kbID, docID uint, text string) (int, error) {
+	chunks := splitLocalKnowledgeText(text, cfg.ChunkSize, cfg.ChunkOverlap)
+	if len(chunks) == 0 {
+		return 0, fmt.Errorf("文档未提取到有效文本")
+	}
+	if len(chunks) > localKnowledgeMaxChunksPerDocument {
+		return 0, fmt.Errorf("文档切块数量过多(%d)，最大支持 %d", len(chunks), localKnowledgeMaxChunksPerDocument)
+	}
+
+	client := &http.Client{Timeout: localEmbeddingHTTPTimeout}
+	vectors, err := embedLocalKnowledgeTexts(ctx, client, cfg, chunks)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := make([]models.KnowledgeChunk, 0, len(chunks))
+	for i, chunk := range chunks {
+		terms := tokenizeLocalKnowledge(chunk)
+		rows = append(rows, models.KnowledgeChunk{
+			KnowledgeBaseID: kbID,
+			DocumentID:      docID,
+			ChunkIndex:      i,
+			Content:         chunk,
+			Terms:           strings.Join(terms, " "),
+			TermCount:       len(terms),
+			Embedding:       encodeLocalEmbedding(vectors[i]),
+			EmbeddingModel:  cfg.EmbeddingModel,
+			EmbeddingDim:    len(vectors[i]),
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("knowledge_base_id = ? AND document_id = ?", kbID, docID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(rows, 100).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("保存本地知识库切块失败: %w", err)
+	}
+	return len(rows), nil
+}
+
+func extractLocalKnowledgeText(fileName string, data []byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	switch ext {
+	case ".txt", ".text", ".md", ".markdown":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("文本文件不是有效的UTF-8编码")
+		}
+		return string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), nil
+	case ".pdf":
+		return extractLocalPDFText(data)
+	case ".docx":
+		return extractLocalDocxText(data)
+	default:
+		return "", fmt.Errorf("本地知识库暂不支持文件类型: %s", ext)
+	}
+}
+
+func extractLocalPDFText(data []byte) (text string, err error) {
+	// pdf 库遇到损坏文件可能 panic，这里兜底为普通错误
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析PDF失败: %v", r)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("解析PDF失败: %w", err)
+	}
+	var sb strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("解析PDF第%d页失败: %w", i, err)
+		}
+		sb.WriteString(pageText)
+		sb.WriteString("\n\n")
+	}
+	return sb.String(), nil
+}
+
+func extractLocalDocxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("解析DOCX失败: %w", err)
+	}
+	var docFile *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			docFile = f
+			break
+		}
+	}
+	if docFile == nil {
+		return "", fmt.Errorf("解析DOCX失败: 缺少 word/document.xml")
+	}
+	rc, err := docFile.Open()
+	if err != nil {
+		return "", fmt.Errorf("解析DOCX失败: %w", err)
+	}
+	defer rc.Close()
+
+	var sb strings.Builder
+	decoder := xml.NewDecoder(io.LimitReader(rc, 32*1024*1024))
+	inText := false
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析DOCX失败: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteByte('\t')
+			case "br", "cr":
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				sb.WriteString("\n\n")
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// splitLocalKnowledgeText 按段落/句子边界聚合为不超过 size 个字符的切块，相邻切块保留 overlap 个字符的重叠
+func splitLocalKnowledgeText(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = defaultLocalChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var sentences []string
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		sentences = append(sentences, splitLocalKnowledgeSentences(para, size)...)
+	}
+
+	var chunks []string
+	var current []rune
+	flush := func() {
+		chunk := strings.TrimSpace(string(current))
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if overlap > 0 && len(current) > overlap {
+			current = append([]rune{}, current[len(current)-overlap:]...)
+		} else {
+			current = current[:0]
+		}
+	}
+	pending := false
+	for _, sentence := range sentences {
+		runes := []rune(sentence)
+		if pending && len(current)+len(runes) > size {
+			flush()
+			pending = false
+		}
+		if len(current) > 0 && !unicode.IsSpace(current[len(current)-1]) {
+			current = append(current, ' ')
+		}
+		current = append(current, runes...)
+		pending = true
+	}
+	if pending {
+		chunk := strings.TrimSpace(string(current))
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+func splitLocalKnowledgeSentences(para string, size int) []string {
+	var sentences []string
+	var current []rune
+	for _, r := range para {
+		current = append(current, r)
+		switch r {
+		case '。', '！', '？', '；', '.', '!', '?', ';', '\n':
+			if s := strings.TrimSpace(string(current)); s != "" {
+				sentences = append(sentences, s)
+			}
+			current = current[:0]
+		}
+	}
+	if s := strings.TrimSpace(string(current)); s != "" {
+		sentences = append(sentences, s)
+	}
+
+	// 超长句子按字符硬切，保证单个切块不超过 size
+	ret := make([]string, 0, len(sentences))
+	for _, s := range sentences {
+		runes := []rune(s)
+		for len(runes) > size {
+			ret = append(ret, string(runes[:size]))
+			runes = runes[size:]
+		}
+		if len(runes) > 0 {
+			ret = append(ret, string(runes))
+		}
+	}
+	return ret
+}
+
+// tokenizeLocalKnowledge 供 BM25 使用的轻量分词：英文/数字按词切分并转小写，
+// 中日韩文字输出单字和相邻二元组
+func tokenizeLocalKnowledge(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			tokens = append(tokens, string(r))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isLocalKnowledgeCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isLocalKnowledgeCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+func buildLocalEmbeddingURL(baseURL string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if strings.HasSuffix(strings.ToLower(trimmed), "/embeddings") {
+		return trimmed
+	}
+	return trimmed + "/embeddings"
+}
+
+func embedLocalKnowledgeTexts(ctx context.Context, client *http.Client, cfg *localKnowledgeConfig, texts []string) ([][]float32, error) {
+	ret := make([][]float32, 0, len(texts))
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultLocalEmbeddingBatchSize
+	}
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		vectors, err := requestLocalEmbeddings(ctx, client, cfg, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, vectors...)
+	}
+	return ret, nil
+}
+
+func requestLocalEmbeddings(ctx context.Context, client *http.Client, cfg *localKnowledgeConfig, inputs []string) ([][]float32, error) {
+	payload := map[string]interface{}{
+		"model": cfg.EmbeddingModel,
+		"input": inputs,
+	}
+	if cfg.EmbeddingDimensions > 0 {
+		payload["dimensions"] = cfg.EmbeddingDimensions
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, buildLocalEmbeddingURL(cfg.EmbeddingBaseURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建embedding请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.EmbeddingAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.EmbeddingAPIKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("调用embedding接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024*1024))
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("embedding接口返回异常: %d %s", resp.StatusCode, truncateForLog(string(respBody), 500))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("解析embedding返回失败: %w", err)
+	}
+	if len(parsed.Data) != len(inputs) {
+		return nil, fmt.Errorf("embedding返回数量不匹配: 期望%d 实际%d", len(inputs), len(parsed.Data))
+	}
+	vectors := make([][]float32, len(inputs))
+	for i, item := range parsed.Data {
+		idx := item.Index
+		if idx < 0 || idx >= len(inputs) || vectors[idx] != nil {
+			idx = i
+		}
+		if len(item.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding返回空向量(index=%d)", idx)
+		}
+		vectors[idx] = item.Embedding
+	}
+	return vectors, nil
+}
+
+func encodeLocalEmbedding(vec []float32) string {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeLocalEmbedding(s string) []float32 {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(buf)%4 != 0 {
+		return nil
+	}
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vec
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+type localKnowledgeSearchTarget struct {
+	KnowledgeBase     models.KnowledgeBase
+	ThresholdOverride *float64
+}
+
+type localKnowledgeScoredChunk struct {
+	chunk  models.KnowledgeChunk
+	terms  []string
+	bm25   float64
+	vector float64
+	score  float64
+}
+
+// scoreLocalKnowledgeChunks 计算 BM25（按批内最大值归一化）与余弦相似度的加权分数
+func scoreLocalKnowledgeChunks(chunks []localKnowledgeScoredChunk, queryTerms []string, queryVector []float32, vectorWeight float64) {
+	if len(chunks) == 0 {
+		return
+	}
+	df := make(map[string]int)
+	totalLen := 0
+	for i := range chunks {
+		totalLen += len(chunks[i].terms)
+		seen := make(map[string]struct{})
+		for _, t := range chunks[i].terms {
+			if _, ok := seen[t]; ok {
+				continue
+			}
+			seen[t] = struct{}{}
+			df[t]++
+		}
+	}
+	avgLen := float64(totalLen) / float64(len(chunks))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+	n := float64(len(chunks))
+
+	uniqueQuery := uniqueStrings(queryTerms)
+	maxBM25 := 0.0
+	for i := range chunks {
+		tf := make(map[string]int, len(chunks[i].terms))
+		for _, t := range chunks[i].terms {
+			tf[t]++
+		}
+		docLen := float64(len(chunks[i].terms))
+		score := 0.0
+		for _, q := range uniqueQuery {
+			f := float64(tf[q])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[q])+0.5)/(float64(df[q])+0.5))
+			score += idf * f * (localBM25K1 + 1) / (f + localBM25K1*(1-localBM25B+localBM25B*docLen/avgLen))
+		}
+		chunks[i].bm25 = score
+		if score > maxBM25 {
+			maxBM25 = score
+		}
+	}
+
+	if len(queryVector) == 0 {
+		vectorWeight = 0
+	}
+	for i := range chunks {
+		bm25 := 0.0
+		if maxBM25 > 0 {
+			bm25 = chunks[i].bm25 / maxBM25
+		}
+		if vectorWeight > 0 {
+			chunks[i].vector = cosineSimilarity(queryVector, decodeLocalEmbedding(chunks[i].chunk.Embedding))
+			if chunks[i].vector < 0 {
+				chunks[i].vector = 0
+			}
+		}
+		chunks[i].score = vectorWeight*chunks[i].vector + (1-vectorWeight)*bm25
+	}
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func searchLocalKnowledge(
+	ctx context.Context,
+	db *gorm.DB,
+	cfg *localKnowledgeConfig,
+	requestThreshold *float64,
+	targets []localKnowledgeSearchTarget,
+	query string,
+	topK int,
+) ([]knowledgeSearchTestHit, error) {
+	if len(targets) == 0 {
+		return []knowledgeSearchTestHit{}, nil
+	}
+	kbIDs := make([]uint, 0, len(targets))
+	targetByID := make(map[uint]localKnowledgeSearchTarget, len(targets))
+	for _, target := range targets {
+		kbIDs = append(kbIDs, target.KnowledgeBase.ID)
+		targetByID[target.KnowledgeBase.ID] = target
+	}
+
+	var rows []models.KnowledgeChunk
+	if err := db.WithContext(ctx).Where("knowledge_base_id IN ?", kbIDs).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("加载本地知识库切块失败: %w", err)
+	}
+	if len(rows) == 0 {
+		return []knowledgeSearchTestHit{}, nil
+	}
+
+	vectorWeight := cfg.VectorWeight
+	var queryVector []float32
+	if vectorWeight > 0 {
+		client := &http.Client{Timeout: localEmbeddingHTTPTimeout}
+		vectors, err := requestLocalEmbeddings(ctx, client, cfg, []string{query})
+		if err != nil {
+			// embedding 服务不可用时退化为纯 BM25 检索
+			log.Printf("[KnowledgeSearch][Local] query embedding failed, fallback to bm25 err=%v", err)
+		} else {
+			queryVector = vectors[0]
+		}
+	}
+
+	scored := make([]localKnowledgeScoredChunk, 0, len(rows))
+	docIDs := make([]uint, 0)
+	for _, row := range rows {
+		scored = append(scored, localKnowledgeScoredChunk{chunk: row, terms: strings.Fields(row.Terms)})
+		if row.DocumentID > 0 {
+			docIDs = append(docIDs, row.DocumentID)
+		}
+	}
+	scoreLocalKnowledgeChunks(scored, tokenizeLocalKnowledge(query), queryVector, vectorWeight)
+
+	docNames := make(map[uint]string)
+	if len(docIDs) > 0 {
+		var docs []models.KnowledgeBaseDocument
+		if err := db.WithContext(ctx).Select("id", "name").Where("id IN ?", uniqueUintSlice(docIDs)).Find(&docs).Error; err == nil {
+			for _, doc := range docs {
+				docNames[doc.ID] = strings.TrimSpace(doc.Name)
+			}
+		}
+	}
+
+	hits := make([]knowledgeSearchTestHit, 0, topK)
+	for _, item := range scored {
+		target := targetByID[item.chunk.KnowledgeBaseID]
+		kbThreshold := target.KnowledgeBase.RetrievalThreshold
+		if target.ThresholdOverride != nil {
+			kbThreshold = target.ThresholdOverride
+		}
+		threshold, _ := resolveKnowledgeThreshold(requestThreshold, kbThreshold, cfg.ScoreThreshold)
+		if item.score <= 0 || item.score < threshold {
+			continue
+		}
+		title := docNames[item.chunk.DocumentID]
+		if title == "" {
+			title = strings.TrimSpace(target.KnowledgeBase.Name)
+		}
+		hits = append(hits, knowledgeSearchTestHit{
+			Title:   title,
+			Score:   item.score,
+			Content: item.chunk.Content,
+		})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	log.Printf(
+		"[KnowledgeSearch][Local] query=%q kbs=%d chunks=%d hits=%d vector_enabled=%v",
+		query,
+		len(targets),
+		len(rows),
+		len(hits),
+		len(queryVector) > 0,
+	)
+	return hits, nil
+}
+
+// SearchLocalKnowledgeInternal 主程序调用的本地知识库检索接口（内部服务接口）
+func (ac *AdminController) SearchLocalKnowledgeInternal(c *gin.Context) {
+	var req struct {
+		Query          string `json:"query"`
+		TopK           int    `json:"top_k"`
+		KnowledgeBases []struct {
+			ID                 uint     `json:"id"`
+			RetrievalThreshold *float64 `json:"retrieval_threshold"`
+		} `json:"knowledge_bases"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query 不能为空"})
+		return
+	}
+	topK := req.TopK
+	if topK <= 0 {
+		topK = 5
+	}
+	if topK > 50 {
+		topK = 50
+	}
+
+	overrides := make(map[uint]*float64, len(req.KnowledgeBases))
+	ids := make([]uint, 0, len(req.KnowledgeBases))
+	for _, item := range req.KnowledgeBases {
+		if item.ID == 0 {
+			continue
+		}
+		ids = append(ids, item.ID)
+		overrides[item.ID] = item.RetrievalThreshold
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"hits": []knowledgeSearchTestHit{}}})
+		return
+	}
+
+	_, providerData, err := loadKnowledgeProviderConfigByProvider(ac.DB, knowledgeLocalProvider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未找到已启用的local知识库配置"})
+		return
+	}
+	cfg, err := parseLocalKnowledgeConfig(providerData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var kbs []models.KnowledgeBase
+	if err := ac.DB.Select("id", "name", "retrieval_threshold", "status").Where("id IN ?", uniqueUintSlice(ids)).Find(&kbs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询知识库失败"})
+		return
+	}
+	targets := make([]localKnowledgeSearchTarget, 0, len(kbs))
+	for _, kb := range kbs {
+		if strings.EqualFold(strings.TrimSpace(kb.Status), "inactive") {
+			continue
+		}
+		targets = append(targets, localKnowledgeSearchTarget{KnowledgeBase: kb, ThresholdOverride: overrides[kb.ID]})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), localKnowledgeSearchTimeout)
+	defer cancel()
+	hits, err := searchLocalKnowledge(ctx, ac.DB, cfg, nil, targets, query, topK)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"hits": hits}})
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSplitLocalKnowledgeText(t *testing.T) {
+	text := strings.Repeat("这是一个用于测试切块的句子。", 30) + "\n\n" + strings.Repeat("abcdefghij", 40)
+	chunks := splitLocalKnowledgeText(text, 100, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("chunks = %d, want >= 2", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 100+20+1 {
+			t.Fatalf("chunk %d has %d runes, exceeds size+overlap", i, n)
+		}
+	}
+	// 相邻切块之间应有重叠
+	first := []rune(chunks[0])
+	tail := string(first[len(first)-10:])
+	if !strings.Contains(chunks[1], tail) {
+		t.Fatalf("chunk[1] does not overlap with chunk[0] tail %q", tail)
+	}
+
+	if got := splitLocalKnowledgeText("  \n\n ", 100, 20); len(got) != 0 {
+		t.Fatalf("blank text chunks = %v", got)
+	}
+}
+
+func TestTokenizeLocalKnowledge(t *testing.T) {
+	got := tokenizeLocalKnowledge("Hello 小智AI, v2!")
+	want := []string{"hello", "小", "小智", "智", "ai", "v2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokenize = %v, want %v", got, want)
+	}
+}
+
+func TestLocalEmbeddingRoundTrip(t *testing.T) {
+	vec := []float32{0.5, -1.25, 3}
+	if got := decodeLocalEmbedding(encodeLocalEmbedding(vec)); !reflect.DeepEqual(got, vec) {
+		t.Fatalf("decode = %v, want %v", got, vec)
+	}
+	if sim := cosineSimilarity(vec, vec); sim < 0.9999 {
+		t.Fatalf("self cosine = %v", sim)
+	}
+	if sim := cosineSimilarity(vec, []float32{1}); sim != 0 {
+		t.Fatalf("dimension mismatch cosine = %v, want 0", sim)
+	}
+}
+
+// fakeEmbeddingServer 按关键词生成二维向量：含“退货”偏向 x 轴，其余偏向 y 轴；问句与文档向量略有偏差
+func fakeEmbeddingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		data := make([]item, 0, len(req.Input))
+		for i, input := range req.Input {
+			vec := []float32{0.1, 1}
+			switch {
+			case strings.HasPrefix(input, "怎么"):
+				vec = []float32{1, 0.5}
+			case strings.Contains(input, "退货"):
+				vec = []float32{1, 0.1}
+			}
+			data = append(data, item{Index: i, Embedding: vec})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func TestLocalKnowledgeIndexAndSearch(t *testing.T) {
+	server := fakeEmbeddingServer(t)
+	defer server.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.KnowledgeBase{}, &models.KnowledgeBaseDocument{}, &models.KnowledgeChunk{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	cfg, err := parseLocalKnowledgeConfig(map[string]interface{}{
+		"embedding_base_url": server.URL + "/v1",
+		"embedding_model":    "fake",
+		"chunk_size":         float64(20),
+		"chunk_overlap":      float64(0),
+	})
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	kb := models.KnowledgeBase{UserID: 1, Name: "售后"}
+	db.Create(&kb)
+	doc := models.KnowledgeBaseDocument{KnowledgeBaseID: kb.ID, Name: "退货政策"}
+	db.Create(&doc)
+
+	ctx := context.Background()
+	if _, err := indexLocalKnowledgeText(ctx, db, cfg, kb.ID, doc.ID, "七天无理由退货，需保持商品完好。\n\n发货时间为下单后48小时内。"); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	// 重复索引应整体替换旧切块
+	count, err := indexLocalKnowledgeText(ctx, db, cfg, kb.ID, doc.ID, "七天无理由退货，需保持商品完好。\n\n发货时间为下单后48小时内。")
+	if err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	var stored int64
+	db.Model(&models.KnowledgeChunk{}).Where("knowledge_base_id = ?", kb.ID).Count(&stored)
+	if int(stored) != count || count != 2 {
+		t.Fatalf("stored chunks = %d, indexed = %d, want 2", stored, count)
+	}
+
+	hits, err := searchLocalKnowledge(ctx, db, cfg, nil, []localKnowledgeSearchTarget{{KnowledgeBase: kb}}, "怎么退货", 5)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) == 0 || !strings.Contains(hits[0].Content, "退货") || hits[0].Title != "退货政策" {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+
+	// 知识库级阈值为 1 时应过滤掉所有结果
+	strict := 1.0
+	kb.RetrievalThreshold = &strict
+	hits, err = searchLocalKnowledge(ctx, db, cfg, nil, []localKnowledgeSearchTarget{{KnowledgeBase: kb}}, "怎么退货", 5)
+	if err != nil {
+		t.Fatalf("search strict: %v", err)
+	}
+	if len(hits) != 0 {
+		t.Fatalf("strict threshold hits = %+v, want none", hits)
+	}
+
+	if err := deleteKnowledgeDocumentFromLocal(db, kb.ID, doc.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	db.Model(&models.KnowledgeChunk{}).Where("knowledge_base_id = ?", kb.ID).Count(&stored)
+	if stored != 0 {
+		t.Fatalf("chunks after delete = %d", stored)
+	}
+}
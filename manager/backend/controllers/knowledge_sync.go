@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -201,6 +202,8 @@ func syncKnowledgeBaseDeleteBestEffort(db *gorm.DB, kb *models.KnowledgeBase) er
 			return err
 		}
 		return deleteKnowledgeBaseFromWeknora(weknoraCfg, kb)
+	case knowledgeLocalProvider:
+		return deleteKnowledgeBaseFromLocal(db, kb)
 	default:
 		return fmt.Errorf("知识库删除同步暂不支持provider: %s", provider)
 	}
@@ -231,6 +234,12 @@ func syncKnowledgeBaseWithProvider(db *gorm.DB, kb *models.KnowledgeBase) (*know
 			return nil, err
 		}
 		return syncKnowledgeBaseToWeknora(weknoraCfg, kb)
+	case knowledgeLocalProvider:
+		localCfg, err := parseLocalKnowledgeConfig(providerData)
+		if err != nil {
+			return nil, err
+		}
+		return syncKnowledgeBaseToLocal(db, localCfg, kb)
 	default:
 		return nil, fmt.Errorf("知识库同步暂不支持provider: %s", provider)
 	}
@@ -879,6 +888,37 @@ func syncKnowledgeDocumentBestEffort(db *gorm.DB, kbID, docID uint) error {
 		}
 		return nil
 
+	case knowledgeLocalProvider:
+		localCfg, err := parseLocalKnowledgeConfig(providerData)
+		if err != nil {
+			return failUpload(strings.TrimSpace(doc.ExternalDocID), err)
+		}
+		if _, err := ensureLocalDatasetForKnowledgeBase(db, &kb); err != nil {
+			return failUpload(strings.TrimSpace(doc.ExternalDocID), err)
+		}
+
+		text := doc.Content
+		if isUploadFile {
+			text, err = extractLocalKnowledgeText(uploadFileName, uploadFileData)
+			if err != nil {
+				return failParse(strings.TrimSpace(doc.ExternalDocID), err)
+			}
+		}
+		if strings.TrimSpace(text) == "" {
+			err := fmt.Errorf("文档内容为空，无法同步")
+			return failUpload(strings.TrimSpace(doc.ExternalDocID), err)
+		}
+
+		documentID := localKnowledgeDocumentID(doc.ID)
+		markProgress(documentID, knowledgeSyncStatusUploaded)
+		markProgress(documentID, knowledgeSyncStatusParsing)
+		count, err := indexLocalKnowledgeText(context.Background(), db, localCfg, kb.ID, doc.ID, text)
+		if err != nil {
+			return failParse(documentID, err)
+		}
+		log.Printf("[KnowledgeSync][Local] document indexed kb_id=%d doc_id=%d chunks=%d", kb.ID, doc.ID, count)
+		return syncSuccess(documentID)
+
 	default:
 		err := fmt.Errorf("知识库文档同步暂不支持provider: %s", provider)
 		return failUpload(strings.TrimSpace(doc.ExternalDocID), err)
@@ -994,6 +1034,8 @@ func syncKnowledgeDocumentDeleteBestEffort(db *gorm.DB, kb models.KnowledgeBase,
 			}).Error
 		}
 		return nil
+	case knowledgeLocalProvider:
+		return deleteKnowledgeDocumentFromLocal(db, kb.ID, doc.ID)
 	default:
 		return fmt.Errorf("知识库文档删除同步暂不支持provider: %s", provider)
 	}
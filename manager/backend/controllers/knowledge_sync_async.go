@@ -1,9 +1,9 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"sync"
 	"time"
 
 	"xiaozhi/manager/backend/models"
@@ -12,42 +12,57 @@ import (
 )
 
 const (
-	knowledgeSyncQueueSize   = 256
-	knowledgeSyncWorkerCount = 2
+	knowledgeSyncJobTimeout     = 10 * time.Minute
+	knowledgeSyncJobMaxAttempts = 5
 )
 
 type knowledgeSyncJobType string
 
 const (
-	knowledgeSyncJobUpsert    knowledgeSyncJobType = "upsert"
-	knowledgeSyncJobDelete    knowledgeSyncJobType = "delete"
-	knowledgeSyncJobDocUpsert knowledgeSyncJobType = "doc_upsert"
-	knowledgeSyncJobDocDelete knowledgeSyncJobType = "doc_delete"
+	knowledgeSyncJobUpsert    knowledgeSyncJobType = "knowledge_sync_upsert"
+	knowledgeSyncJobDelete    knowledgeSyncJobType = "knowledge_sync_delete"
+	knowledgeSyncJobDocUpsert knowledgeSyncJobType = "knowledge_sync_doc_upsert"
+	knowledgeSyncJobDocDelete knowledgeSyncJobType = "knowledge_sync_doc_delete"
 )
 
+// knowledgeSyncJob 知识库同步任务参数（持久化到 jobs.payload）
 type knowledgeSyncJob struct {
-	jobType           knowledgeSyncJobType
-	db                *gorm.DB
-	knowledgeBaseID   uint
-	documentID        uint
-	knowledgeSnapshot *models.KnowledgeBase
-	documentSnapshot  *models.KnowledgeBaseDocument
-	enqueuedAt        time.Time
+	KnowledgeBaseID   uint                          `json:"knowledge_base_id"`
+	DocumentID        uint                          `json:"document_id,omitempty"`
+	KnowledgeSnapshot *models.KnowledgeBase         `json:"knowledge_snapshot,omitempty"`
+	DocumentSnapshot  *models.KnowledgeBaseDocument `json:"document_snapshot,omitempty"`
 }
 
-var (
-	knowledgeSyncQueue     chan knowledgeSyncJob
-	knowledgeSyncQueueOnce sync.Once
-)
+func init() {
+	handlers := map[knowledgeSyncJobType]func(db *gorm.DB, job knowledgeSyncJob) error{
+		knowledgeSyncJobUpsert:    processKnowledgeSyncUpsert,
+		knowledgeSyncJobDelete:    processKnowledgeSyncDelete,
+		knowledgeSyncJobDocUpsert: processKnowledgeDocumentSyncUpsert,
+		knowledgeSyncJobDocDelete: processKnowledgeDocumentSyncDelete,
+	}
+	for jobType, process := range handlers {
+		process := process
+		registerJobHandler(string(jobType), jobHandlerSpec{
+			handler: func(_ context.Context, db *gorm.DB, job *models.Job) error {
+				var payload knowledgeSyncJob
+				if err := decodeJobPayload(job, &payload); err != nil {
+					return err
+				}
+				return process(db, payload)
+			},
+			timeout:     knowledgeSyncJobTimeout,
+			maxAttempts: knowledgeSyncJobMaxAttempts,
+		})
+	}
+}
 
-func ensureKnowledgeSyncWorkersStarted() {
-	knowledgeSyncQueueOnce.Do(func() {
-		knowledgeSyncQueue = make(chan knowledgeSyncJob, knowledgeSyncQueueSize)
-		for i := 1; i <= knowledgeSyncWorkerCount; i++ {
-			go runKnowledgeSyncWorker(i)
-		}
-		log.Printf("[KnowledgeSync][Async] workers started count=%d queue_size=%d", knowledgeSyncWorkerCount, knowledgeSyncQueueSize)
-	})
+func enqueueKnowledgeSync(db *gorm.DB, jobType knowledgeSyncJobType, dedupeKey string, job knowledgeSyncJob) error {
+	queued, err := enqueueJob(db, string(jobType), dedupeKey, job)
+	if err != nil {
+		return err
+	}
+	log.Printf("[KnowledgeSync][Async] enqueue type=%s kb_id=%d doc_id=%d job_id=%d", jobType, job.KnowledgeBaseID, job.DocumentID, queued.ID)
+	return nil
 }
 
 func enqueueKnowledgeSyncUpsert(db *gorm.DB, knowledgeBaseID uint) error {
@@ -57,44 +72,21 @@ func enqueueKnowledgeSyncUpsert(db *gorm.DB, knowledgeBaseID uint) error {
 	if knowledgeBaseID == 0 {
 		return fmt.Errorf("无效的知识库ID")
 	}
-	ensureKnowledgeSyncWorkersStarted()
-
-	job := knowledgeSyncJob{
-		jobType:         knowledgeSyncJobUpsert,
-		db:              db,
-		knowledgeBaseID: knowledgeBaseID,
-		enqueuedAt:      time.Now(),
-	}
-	select {
-	case knowledgeSyncQueue <- job:
-		log.Printf("[KnowledgeSync][Async] enqueue type=%s kb_id=%d", job.jobType, job.knowledgeBaseID)
-		return nil
-	default:
-		return fmt.Errorf("知识库同步队列已满，请稍后重试")
-	}
+	return enqueueKnowledgeSync(db, knowledgeSyncJobUpsert,
+		fmt.Sprintf("%s:%d", knowledgeSyncJobUpsert, knowledgeBaseID),
+		knowledgeSyncJob{KnowledgeBaseID: knowledgeBaseID})
 }
 
 func enqueueKnowledgeSyncDelete(db *gorm.DB, snapshot models.KnowledgeBase) error {
 	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
-	ensureKnowledgeSyncWorkersStarted()
-
 	s := snapshot
-	job := knowledgeSyncJob{
-		jobType:           knowledgeSyncJobDelete,
-		db:                db,
-		knowledgeBaseID:   snapshot.ID,
-		knowledgeSnapshot: &s,
-		enqueuedAt:        time.Now(),
-	}
-	select {
-	case knowledgeSyncQueue <- job:
-		log.Printf("[KnowledgeSync][Async] enqueue type=%s kb_id=%d", job.jobType, job.knowledgeBaseID)
-		return nil
-	default:
-		return fmt.Errorf("知识库同步队列已满，请稍后重试")
-	}
+	s.Content = ""
+	return enqueueKnowledgeSync(db, knowledgeSyncJobDelete, "", knowledgeSyncJob{
+		KnowledgeBaseID:   snapshot.ID,
+		KnowledgeSnapshot: &s,
+	})
 }
 
 func enqueueKnowledgeDocumentSyncUpsert(db *gorm.DB, knowledgeBaseID, documentID uint) error {
@@ -104,126 +96,65 @@ func enqueueKnowledgeDocumentSyncUpsert(db *gorm.DB, knowledgeBaseID, documentID
 	if knowledgeBaseID == 0 || documentID == 0 {
 		return fmt.Errorf("无效的知识库或文档ID")
 	}
-	ensureKnowledgeSyncWorkersStarted()
-
-	job := knowledgeSyncJob{
-		jobType:         knowledgeSyncJobDocUpsert,
-		db:              db,
-		knowledgeBaseID: knowledgeBaseID,
-		documentID:      documentID,
-		enqueuedAt:      time.Now(),
-	}
-	select {
-	case knowledgeSyncQueue <- job:
-		log.Printf("[KnowledgeSync][Async] enqueue type=%s kb_id=%d doc_id=%d", job.jobType, job.knowledgeBaseID, job.documentID)
-		return nil
-	default:
-		return fmt.Errorf("知识库同步队列已满，请稍后重试")
-	}
+	return enqueueKnowledgeSync(db, knowledgeSyncJobDocUpsert,
+		fmt.Sprintf("%s:%d:%d", knowledgeSyncJobDocUpsert, knowledgeBaseID, documentID),
+		knowledgeSyncJob{KnowledgeBaseID: knowledgeBaseID, DocumentID: documentID})
 }
 
 func enqueueKnowledgeDocumentSyncDelete(db *gorm.DB, kbSnapshot models.KnowledgeBase, docSnapshot models.KnowledgeBaseDocument) error {
 	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
-	ensureKnowledgeSyncWorkersStarted()
-
+	// 删除同步只依赖外部ID等元信息，快照中去掉正文以控制任务参数大小
 	kb := kbSnapshot
+	kb.Content = ""
 	doc := docSnapshot
-	job := knowledgeSyncJob{
-		jobType:           knowledgeSyncJobDocDelete,
-		db:                db,
-		knowledgeBaseID:   kbSnapshot.ID,
-		documentID:        docSnapshot.ID,
-		knowledgeSnapshot: &kb,
-		documentSnapshot:  &doc,
-		enqueuedAt:        time.Now(),
-	}
-	select {
-	case knowledgeSyncQueue <- job:
-		log.Printf("[KnowledgeSync][Async] enqueue type=%s kb_id=%d doc_id=%d", job.jobType, job.knowledgeBaseID, job.documentID)
-		return nil
-	default:
-		return fmt.Errorf("知识库同步队列已满，请稍后重试")
-	}
-}
-
-func runKnowledgeSyncWorker(workerID int) {
-	for job := range knowledgeSyncQueue {
-		waitMs := time.Since(job.enqueuedAt).Milliseconds()
-		start := time.Now()
-		switch job.jobType {
-		case knowledgeSyncJobUpsert:
-			err := processKnowledgeSyncUpsert(job)
-			if err != nil {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d wait_ms=%d cost_ms=%d err=%v", workerID, job.jobType, job.knowledgeBaseID, waitMs, time.Since(start).Milliseconds(), err)
-			} else {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d wait_ms=%d cost_ms=%d status=ok", workerID, job.jobType, job.knowledgeBaseID, waitMs, time.Since(start).Milliseconds())
-			}
-		case knowledgeSyncJobDelete:
-			err := processKnowledgeSyncDelete(job)
-			if err != nil {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d wait_ms=%d cost_ms=%d err=%v", workerID, job.jobType, job.knowledgeBaseID, waitMs, time.Since(start).Milliseconds(), err)
-			} else {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d wait_ms=%d cost_ms=%d status=ok", workerID, job.jobType, job.knowledgeBaseID, waitMs, time.Since(start).Milliseconds())
-			}
-		case knowledgeSyncJobDocUpsert:
-			err := processKnowledgeDocumentSyncUpsert(job)
-			if err != nil {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d doc_id=%d wait_ms=%d cost_ms=%d err=%v", workerID, job.jobType, job.knowledgeBaseID, job.documentID, waitMs, time.Since(start).Milliseconds(), err)
-			} else {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d doc_id=%d wait_ms=%d cost_ms=%d status=ok", workerID, job.jobType, job.knowledgeBaseID, job.documentID, waitMs, time.Since(start).Milliseconds())
-			}
-		case knowledgeSyncJobDocDelete:
-			err := processKnowledgeDocumentSyncDelete(job)
-			if err != nil {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d doc_id=%d wait_ms=%d cost_ms=%d err=%v", workerID, job.jobType, job.knowledgeBaseID, job.documentID, waitMs, time.Since(start).Milliseconds(), err)
-			} else {
-				log.Printf("[KnowledgeSync][Async] worker=%d type=%s kb_id=%d doc_id=%d wait_ms=%d cost_ms=%d status=ok", workerID, job.jobType, job.knowledgeBaseID, job.documentID, waitMs, time.Since(start).Milliseconds())
-			}
-		default:
-			log.Printf("[KnowledgeSync][Async] worker=%d unknown_job_type=%s kb_id=%d", workerID, job.jobType, job.knowledgeBaseID)
-		}
-	}
+	doc.Content = ""
+	return enqueueKnowledgeSync(db, knowledgeSyncJobDocDelete, "", knowledgeSyncJob{
+		KnowledgeBaseID:   kbSnapshot.ID,
+		DocumentID:        docSnapshot.ID,
+		KnowledgeSnapshot: &kb,
+		DocumentSnapshot:  &doc,
+	})
 }
 
-func processKnowledgeSyncUpsert(job knowledgeSyncJob) error {
-	if job.db == nil {
+func processKnowledgeSyncUpsert(db *gorm.DB, job knowledgeSyncJob) error {
+	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
 	var kb models.KnowledgeBase
-	if err := job.db.Where("id = ?", job.knowledgeBaseID).First(&kb).Error; err != nil {
+	if err := db.Where("id = ?", job.KnowledgeBaseID).First(&kb).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil
 		}
 		return fmt.Errorf("加载知识库失败: %w", err)
 	}
-	return syncKnowledgeBaseBestEffort(job.db, &kb)
+	return syncKnowledgeBaseBestEffort(db, &kb)
 }
 
-func processKnowledgeSyncDelete(job knowledgeSyncJob) error {
-	if job.db == nil {
+func processKnowledgeSyncDelete(db *gorm.DB, job knowledgeSyncJob) error {
+	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
-	if job.knowledgeSnapshot == nil {
+	if job.KnowledgeSnapshot == nil {
 		return fmt.Errorf("删除同步缺少知识库快照")
 	}
-	return syncKnowledgeBaseDeleteBestEffort(job.db, job.knowledgeSnapshot)
+	return syncKnowledgeBaseDeleteBestEffort(db, job.KnowledgeSnapshot)
 }
 
-func processKnowledgeDocumentSyncUpsert(job knowledgeSyncJob) error {
-	if job.db == nil {
+func processKnowledgeDocumentSyncUpsert(db *gorm.DB, job knowledgeSyncJob) error {
+	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
-	return syncKnowledgeDocumentBestEffort(job.db, job.knowledgeBaseID, job.documentID)
+	return syncKnowledgeDocumentBestEffort(db, job.KnowledgeBaseID, job.DocumentID)
 }
 
-func processKnowledgeDocumentSyncDelete(job knowledgeSyncJob) error {
-	if job.db == nil {
+func processKnowledgeDocumentSyncDelete(db *gorm.DB, job knowledgeSyncJob) error {
+	if db == nil {
 		return fmt.Errorf("数据库连接为空")
 	}
-	if job.knowledgeSnapshot == nil || job.documentSnapshot == nil {
+	if job.KnowledgeSnapshot == nil || job.DocumentSnapshot == nil {
 		return fmt.Errorf("文档删除同步缺少快照")
 	}
-	return syncKnowledgeDocumentDeleteBestEffort(job.db, *job.knowledgeSnapshot, *job.documentSnapshot)
+	return syncKnowledgeDocumentDeleteBestEffort(db, *job.KnowledgeSnapshot, *job.DocumentSnapshot)
 }
@@ -45,6 +45,7 @@ type importMCPMarketServiceRequest struct {
 	MarketID     uint   `json:"market_id" binding:"required"`
 	ServiceID    string `json:"service_id" binding:"required"`
 	NameOverride string `json:"name_override"`
+	Auth         string `json:"auth"` // oauth: 服务需要用户授权（GitHub、Notion 等），导入后由用户在智能体页面授权
 }
 
 func (ac *AdminController) GetMCPMarketProviders(c *gin.Context) {
@@ -375,6 +376,7 @@ func (ac *AdminController) ImportMCPMarketService(c *gin.Context) {
 			ProviderID:  mcpmarket.NormalizeProviderID(marketCfg.ProviderID),
 			ServiceID:   detail.ServiceID,
 			ServiceName: detail.Name,
+			Auth:        normalizeMCPServerAuth(req.Auth),
 		}
 		if row.Transport != mcpmarket.TransportSSE && row.Transport != mcpmarket.TransportStreamableHTTP {
 			continue
@@ -430,6 +432,7 @@ func (ac *AdminController) ImportMCPMarketService(c *gin.Context) {
 			"provider_id":  row.ProviderID,
 			"service_id":   row.ServiceID,
 			"service_name": row.ServiceName,
+			"auth":         row.Auth,
 		}
 		if err := tx.Model(&models.MCPMarketService{}).Where("id = ?", row.ID).Updates(updateMap).Error; err != nil {
 			tx.Rollback()
@@ -767,6 +770,17 @@ type mcpServerConfig struct {
 	ServiceID string            `json:"service_id,omitempty"`
 	AuthRef   string            `json:"auth_ref,omitempty"`
 	Headers   map[string]string `json:"headers,omitempty"`
+
+	// OAuth 授权：Auth 为 oauth 时由用户为智能体授权，主程序按智能体携带各自的访问令牌连接
+	Auth  string                `json:"auth,omitempty"`
+	OAuth *mcpOAuthClientConfig `json:"oauth,omitempty"`
+
+	// stdio 类型：由主程序以子进程方式启动
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	WorkDir string            `json:"work_dir,omitempty"`
+	Limits  *mcpStdioLimits   `json:"limits,omitempty"`
 }
 
 func buildStoredMarketConfig(req upsertMCPMarketRequest, existing *mcpmarket.MarketConnection) (mcpmarket.MarketConnection, error) {
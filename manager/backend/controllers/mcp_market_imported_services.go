@@ -27,6 +27,7 @@ type upsertMCPMarketImportedServiceRequest struct {
 	ProviderID  string            `json:"provider_id"`
 	ServiceID   string            `json:"service_id"`
 	ServiceName string            `json:"service_name"`
+	Auth        string            `json:"auth"`
 }
 
 type mcpMarketImportedServiceView struct {
@@ -40,6 +41,7 @@ type mcpMarketImportedServiceView struct {
 	ProviderID  string            `json:"provider_id,omitempty"`
 	ServiceID   string            `json:"service_id,omitempty"`
 	ServiceName string            `json:"service_name,omitempty"`
+	Auth        string            `json:"auth,omitempty"`
 	CreatedAt   string            `json:"created_at"`
 	UpdatedAt   string            `json:"updated_at"`
 }
@@ -156,6 +158,7 @@ func (ac *AdminController) UpdateMCPMarketImportedService(c *gin.Context) {
 		"provider_id":  updated.ProviderID,
 		"service_id":   updated.ServiceID,
 		"service_name": updated.ServiceName,
+		"auth":         updated.Auth,
 	}
 	if err := ac.DB.Model(&existing).Updates(updateMap).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新导入服务失败"})
@@ -248,6 +251,7 @@ func mergeManualAndMarketServers(manualMCP map[string]interface{}, marketService
 			Provider:  "mcp-market",
 			ServiceID: service.ServiceID,
 			Headers:   decodeHeadersJSON(service.HeadersJSON),
+			Auth:      normalizeMCPServerAuth(service.Auth),
 		}
 		if transport == mcpmarket.TransportSSE {
 			server.SSEUrl = service.URL
@@ -489,6 +493,7 @@ func buildImportedServiceModelFromRequest(req upsertMCPMarketImportedServiceRequ
 	row.ProviderID = mcpmarket.NormalizeProviderID(req.ProviderID)
 	row.ServiceID = strings.TrimSpace(req.ServiceID)
 	row.ServiceName = strings.TrimSpace(req.ServiceName)
+	row.Auth = normalizeMCPServerAuth(req.Auth)
 
 	return row, nil
 }
@@ -505,6 +510,7 @@ func toMCPMarketImportedServiceView(row models.MCPMarketService) mcpMarketImport
 		ProviderID:  row.ProviderID,
 		ServiceID:   row.ServiceID,
 		ServiceName: row.ServiceName,
+		Auth:        normalizeMCPServerAuth(row.Auth),
 		CreatedAt:   row.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   row.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
@@ -0,0 +1,661 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+	mcpmarket "xiaozhi/manager/backend/services/mcp_market"
+	mcpoauth "xiaozhi/manager/backend/services/mcp_oauth"
+)
+
+// MCP OAuth 授权：MCP 服务器配置 auth=oauth 时（GitHub、Notion 等），用户在智能体页面发起授权，
+// manager 完成发现、动态注册、授权码 + PKCE 换取令牌，令牌加密存储在 mcp_oauth_credentials 表，
+// 到期前自动刷新并推送给主程序；主程序按智能体携带各自的访问令牌连接，不同用户使用各自的账号。
+const (
+	mcpServerAuthOAuth = "oauth"
+
+	mcpOAuthStatusActive  = "active"
+	mcpOAuthStatusExpired = "expired" // 刷新令牌失效，需要重新授权
+
+	mcpOAuthCallbackPath    = "/api/mcp/oauth/callback"
+	mcpOAuthNonceCookie     = "mcp_oauth_nonce_" // 后接 state，同时发起多个授权时互不覆盖
+	mcpOAuthClientName      = "xiaozhi-esp32-server"
+	mcpOAuthPendingTTL      = 10 * time.Minute
+	mcpOAuthHTTPTimeout     = 15 * time.Second
+	mcpOAuthRefreshInterval = time.Minute
+	mcpOAuthRefreshAhead    = 5 * time.Minute // 到期前该时长内刷新
+	mcpOAuthPushTimeout     = 5 * time.Second
+)
+
+// mcpOAuthClientConfig 不支持动态客户端注册的授权服务器（如 GitHub）需要预先注册应用，
+// 回调地址填写 manager 的 /api/mcp/oauth/callback
+type mcpOAuthClientConfig struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func normalizeMCPServerAuth(auth string) string {
+	if strings.EqualFold(strings.TrimSpace(auth), mcpServerAuthOAuth) {
+		return mcpServerAuthOAuth
+	}
+	return ""
+}
+
+// MCPOAuthController MCP 服务器 OAuth 授权
+type MCPOAuthController struct {
+	DB                  *gorm.DB
+	WebSocketController *WebSocketController
+	PublicURL           string // 控制台对外地址，见 config.MCPOAuthConfig
+	httpClient          *http.Client
+}
+
+// mcpOAuthPending 已发起、等待回调的授权
+type mcpOAuthPending struct {
+	userID      uint
+	agentID     uint
+	server      mcpServerConfig
+	meta        *mcpoauth.Metadata
+	client      *mcpoauth.Client
+	verifier    string
+	nonce       string // 与发起授权的浏览器 cookie 绑定，防止把别人的授权链接发给用户完成
+	redirectURI string
+	scope       string
+	createdAt   time.Time
+}
+
+var (
+	mcpOAuthPendingMu     sync.Mutex
+	mcpOAuthPendingStates = make(map[string]*mcpOAuthPending)
+
+	// mcpOAuthRefreshLocks 同一凭证同时只刷新一次，刷新令牌可能是一次性的
+	mcpOAuthRefreshLocks sync.Map
+
+	mcpOAuthRefresherOnce sync.Once
+)
+
+// NewMCPOAuthController 创建控制器并启动令牌刷新任务
+func NewMCPOAuthController(db *gorm.DB, ws *WebSocketController, cfg *config.Config) *MCPOAuthController {
+	oc := &MCPOAuthController{
+		DB:                  db,
+		WebSocketController: ws,
+		httpClient:          &http.Client{Timeout: mcpOAuthHTTPTimeout},
+	}
+	if cfg != nil {
+		oc.PublicURL = cfg.MCPOAuth.PublicURL
+	}
+	if db != nil {
+		mcpOAuthRefresherOnce.Do(func() {
+			go oc.runRefresher()
+		})
+	}
+	return oc
+}
+
+// oauthMCPServers 启用且需要 OAuth 授权的 MCP 服务器（人工配置与市场导入）
+func oauthMCPServers(db *gorm.DB) ([]mcpServerConfig, error) {
+	ac := &AdminController{DB: db}
+	current, _, err := ac.loadCurrentMCPConfig()
+	if err != nil {
+		return nil, err
+	}
+	merged, _, err := ac.mergeMCPWithEnabledMarketServices(current.MCP)
+	if err != nil {
+		return nil, err
+	}
+	global := asMap(merged["global"])
+	if enabled, _ := global["enabled"].(bool); !enabled {
+		return []mcpServerConfig{}, nil
+	}
+	servers, err := decodeMCPServers(global["servers"])
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]mcpServerConfig, 0)
+	for _, server := range servers {
+		if server.Enabled && normalizeMCPServerAuth(server.Auth) == mcpServerAuthOAuth && normalizeServerURL(server) != "" {
+			ret = append(ret, server)
+		}
+	}
+	return ret, nil
+}
+
+func findOAuthMCPServer(db *gorm.DB, name string) (mcpServerConfig, error) {
+	servers, err := oauthMCPServers(db)
+	if err != nil {
+		return mcpServerConfig{}, fmt.Errorf("读取MCP配置失败: %v", err)
+	}
+	for _, server := range servers {
+		if server.Name == name {
+			return server, nil
+		}
+	}
+	return mcpServerConfig{}, fmt.Errorf("MCP服务器 %s 不存在或不需要授权", name)
+}
+
+func mcpServerEndpointURL(server mcpServerConfig) string {
+	if strings.TrimSpace(server.Url) != "" {
+		return strings.TrimSpace(server.Url)
+	}
+	return strings.TrimSpace(server.SSEUrl)
+}
+
+// mcpOAuthRedirectURI 回调地址由配置的控制台地址拼出，不信任请求中的 Host / X-Forwarded-* 头
+func mcpOAuthRedirectURI(publicURL string) (string, error) {
+	publicURL = strings.TrimRight(strings.TrimSpace(publicURL), "/")
+	if publicURL == "" {
+		return "", errors.New("未配置 mcp_oauth.public_url")
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("mcp_oauth.public_url 无效: %q", publicURL)
+	}
+	return publicURL + mcpOAuthCallbackPath, nil
+}
+
+type mcpOAuthServerView struct {
+	Server     string     `json:"server"`
+	URL        string     `json:"url"`
+	Authorized bool       `json:"authorized"`
+	Status     string     `json:"status,omitempty"`
+	Scope      string     `json:"scope,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+func (oc *MCPOAuthController) userAgent(c *gin.Context) (*models.Agent, bool) {
+	var agent models.Agent
+	if err := oc.DB.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+		return nil, false
+	}
+	return &agent, true
+}
+
+func (oc *MCPOAuthController) adminAgent(c *gin.Context) (*models.Agent, bool) {
+	var agent models.Agent
+	if err := oc.DB.Where("id = ?", c.Param("id")).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return nil, false
+	}
+	return &agent, true
+}
+
+// GetAgentMCPOAuth 智能体需要授权的MCP服务器及授权状态（用户版本）
+func (oc *MCPOAuthController) GetAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.userAgent(c); ok {
+		oc.listAgentMCPOAuth(c, agent)
+	}
+}
+
+// AuthorizeAgentMCPOAuth 发起授权，返回浏览器跳转地址（用户版本）
+func (oc *MCPOAuthController) AuthorizeAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.userAgent(c); ok {
+		oc.authorizeAgentMCPOAuth(c, agent)
+	}
+}
+
+// RevokeAgentMCPOAuth 删除授权（用户版本）
+func (oc *MCPOAuthController) RevokeAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.userAgent(c); ok {
+		oc.revokeAgentMCPOAuth(c, agent)
+	}
+}
+
+// AdminGetAgentMCPOAuth 智能体需要授权的MCP服务器及授权状态（管理员版本）
+func (oc *MCPOAuthController) AdminGetAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.adminAgent(c); ok {
+		oc.listAgentMCPOAuth(c, agent)
+	}
+}
+
+// AdminAuthorizeAgentMCPOAuth 发起授权（管理员版本），授权得到的是管理员登录的第三方账号
+func (oc *MCPOAuthController) AdminAuthorizeAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.adminAgent(c); ok {
+		oc.authorizeAgentMCPOAuth(c, agent)
+	}
+}
+
+// AdminRevokeAgentMCPOAuth 删除授权（管理员版本）
+func (oc *MCPOAuthController) AdminRevokeAgentMCPOAuth(c *gin.Context) {
+	if agent, ok := oc.adminAgent(c); ok {
+		oc.revokeAgentMCPOAuth(c, agent)
+	}
+}
+
+func (oc *MCPOAuthController) listAgentMCPOAuth(c *gin.Context, agent *models.Agent) {
+	servers, err := oauthMCPServers(oc.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取MCP配置失败"})
+		return
+	}
+	var credentials []models.MCPOAuthCredential
+	if err := oc.DB.Where("agent_id = ?", agent.ID).Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询授权失败"})
+		return
+	}
+	byServer := make(map[string]models.MCPOAuthCredential, len(credentials))
+	for _, cred := range credentials {
+		byServer[cred.ServerName] = cred
+	}
+
+	items := make([]mcpOAuthServerView, 0, len(servers))
+	for _, server := range servers {
+		view := mcpOAuthServerView{Server: server.Name, URL: mcpServerEndpointURL(server)}
+		if cred, ok := byServer[server.Name]; ok {
+			updatedAt := cred.UpdatedAt
+			view.Authorized = cred.Status == mcpOAuthStatusActive
+			view.Status = cred.Status
+			view.Scope = cred.Scope
+			view.ExpiresAt = cred.ExpiresAt
+			view.LastError = cred.LastError
+			view.UpdatedAt = &updatedAt
+		}
+		items = append(items, view)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+func (oc *MCPOAuthController) authorizeAgentMCPOAuth(c *gin.Context, agent *models.Agent) {
+	if err := mcpmarket.CheckSecretKey(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "授权令牌需要加密存储，请先配置加密密钥: " + err.Error()})
+		return
+	}
+	redirectURI, err := mcpOAuthRedirectURI(oc.PublicURL)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "请先配置控制台对外地址: " + err.Error()})
+		return
+	}
+	server, err := findOAuthMCPServer(oc.DB, c.Param("server"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	meta, err := mcpoauth.Discover(ctx, oc.httpClient, mcpServerEndpointURL(server))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "发现授权服务器失败: " + err.Error()})
+		return
+	}
+	scope := strings.Join(meta.ScopesSupported, " ")
+	var client *mcpoauth.Client
+	if server.OAuth != nil && strings.TrimSpace(server.OAuth.ClientID) != "" {
+		client = &mcpoauth.Client{ClientID: strings.TrimSpace(server.OAuth.ClientID), ClientSecret: strings.TrimSpace(server.OAuth.ClientSecret)}
+		if strings.TrimSpace(server.OAuth.Scope) != "" {
+			scope = strings.TrimSpace(server.OAuth.Scope)
+		}
+	} else {
+		client, err = mcpoauth.Register(ctx, oc.httpClient, meta, mcpOAuthClientName, redirectURI)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	verifier, challenge, err := mcpoauth.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	state, err := mcpoauth.RandomString(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nonce, err := mcpoauth.RandomString(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	authURL, err := mcpoauth.AuthorizationURL(meta, client, redirectURI, state, challenge, scope)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	mcpOAuthPendingMu.Lock()
+	for key, pending := range mcpOAuthPendingStates {
+		if now.Sub(pending.createdAt) > mcpOAuthPendingTTL {
+			delete(mcpOAuthPendingStates, key)
+		}
+	}
+	mcpOAuthPendingStates[state] = &mcpOAuthPending{
+		userID:      agent.UserID,
+		agentID:     agent.ID,
+		server:      server,
+		meta:        meta,
+		client:      client,
+		verifier:    verifier,
+		nonce:       nonce,
+		redirectURI: redirectURI,
+		scope:       scope,
+		createdAt:   now,
+	}
+	mcpOAuthPendingMu.Unlock()
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     mcpOAuthNonceCookie + state,
+		Value:    nonce,
+		Path:     mcpOAuthCallbackPath,
+		MaxAge:   int(mcpOAuthPendingTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(redirectURI, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"authorization_url": authURL,
+		"redirect_uri":      redirectURI,
+		"expires_in":        int(mcpOAuthPendingTTL.Seconds()),
+	}})
+}
+
+func (oc *MCPOAuthController) revokeAgentMCPOAuth(c *gin.Context, agent *models.Agent) {
+	server := c.Param("server")
+	result := oc.DB.Where("agent_id = ? AND server_name = ?", agent.ID, server).Delete(&models.MCPOAuthCredential{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除授权失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未授权该MCP服务器"})
+		return
+	}
+	oc.pushToken(agent.ID, server, "", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "授权已删除"})
+}
+
+// OAuthCallback 授权服务器回调（无需登录，state 一次性有效，且必须由发起授权的浏览器带着 nonce cookie 访问），
+// 完成后页面通知控制台刷新并关闭
+func (oc *MCPOAuthController) OAuthCallback(c *gin.Context) {
+	state := c.Query("state")
+	nonce, _ := c.Cookie(mcpOAuthNonceCookie + state)
+	mcpOAuthPendingMu.Lock()
+	pending := mcpOAuthPendingStates[state]
+	// nonce 不符时不作废 state，避免他人拿到回调链接后抢先访问让发起者的授权失败
+	matched := pending != nil && nonce != "" && subtle.ConstantTimeCompare([]byte(nonce), []byte(pending.nonce)) == 1
+	if matched {
+		delete(mcpOAuthPendingStates, state)
+	}
+	mcpOAuthPendingMu.Unlock()
+
+	if pending == nil || time.Since(pending.createdAt) > mcpOAuthPendingTTL {
+		renderMCPOAuthResult(c, http.StatusBadRequest, false, "授权请求不存在或已过期，请在控制台重新发起授权")
+		return
+	}
+	if !matched {
+		log.Printf("[MCP OAuth] 智能体 %d 的授权回调缺少匹配的 nonce cookie，已拒绝", pending.agentID)
+		renderMCPOAuthResult(c, http.StatusForbidden, false, "授权回调与发起授权的浏览器不一致，请在同一浏览器中重新发起授权")
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{Name: mcpOAuthNonceCookie + state, Path: mcpOAuthCallbackPath, MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	if errCode := c.Query("error"); errCode != "" {
+		msg := errCode
+		if desc := c.Query("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		renderMCPOAuthResult(c, http.StatusBadRequest, false, "授权被拒绝: "+msg)
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		renderMCPOAuthResult(c, http.StatusBadRequest, false, "回调缺少授权码")
+		return
+	}
+
+	token, err := mcpoauth.ExchangeCode(c.Request.Context(), oc.httpClient, pending.meta.TokenEndpoint, pending.client,
+		code, pending.verifier, pending.redirectURI, pending.meta.Resource)
+	if err != nil {
+		renderMCPOAuthResult(c, http.StatusBadGateway, false, "换取令牌失败: "+err.Error())
+		return
+	}
+
+	cred := models.MCPOAuthCredential{
+		UserID:        pending.userID,
+		AgentID:       pending.agentID,
+		ServerName:    pending.server.Name,
+		ServerURL:     mcpServerEndpointURL(pending.server),
+		Issuer:        pending.meta.Issuer,
+		TokenEndpoint: pending.meta.TokenEndpoint,
+		Resource:      pending.meta.Resource,
+		ClientID:      pending.client.ClientID,
+		Scope:         token.Scope,
+		Status:        mcpOAuthStatusActive,
+	}
+	if cred.Scope == "" {
+		cred.Scope = pending.scope
+	}
+	if cred.ClientSecretEnc, cred.ClientSecretNonce, err = mcpmarket.EncryptText(pending.client.ClientSecret); err == nil {
+		err = sealMCPOAuthToken(&cred, token)
+	}
+	if err != nil {
+		renderMCPOAuthResult(c, http.StatusInternalServerError, false, "加密令牌失败: "+err.Error())
+		return
+	}
+
+	var existing models.MCPOAuthCredential
+	if err := oc.DB.Where("agent_id = ? AND server_name = ?", cred.AgentID, cred.ServerName).First(&existing).Error; err == nil {
+		cred.ID = existing.ID
+		cred.CreatedAt = existing.CreatedAt
+	}
+	if err := oc.DB.Save(&cred).Error; err != nil {
+		renderMCPOAuthResult(c, http.StatusInternalServerError, false, "保存授权失败")
+		return
+	}
+
+	oc.pushToken(cred.AgentID, cred.ServerName, token.AccessToken, cred.ExpiresAt)
+	log.Printf("[MCP OAuth] 智能体 %d 已授权MCP服务器 %s", cred.AgentID, cred.ServerName)
+	renderMCPOAuthResult(c, http.StatusOK, true, fmt.Sprintf("已授权 MCP 服务器 %s，可以关闭此页面", cred.ServerName))
+}
+
+func renderMCPOAuthResult(c *gin.Context, status int, success bool, message string) {
+	title := "授权失败"
+	if success {
+		title = "授权成功"
+	}
+	page := fmt.Sprintf(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>%s</title></head>
+<body style="font-family:sans-serif;text-align:center;padding-top:60px">
+<h2>%s</h2><p>%s</p>
+<script>if (window.opener) { window.opener.postMessage({type: "mcp_oauth", success: %t}, "*"); setTimeout(function () { window.close() }, 1500) }</script>
+</body></html>`, title, title, html.EscapeString(message), success)
+	c.Data(status, "text/html; charset=utf-8", []byte(page))
+}
+
+// sealMCPOAuthToken 加密保存令牌，刷新响应未返回新的刷新令牌时沿用原值
+func sealMCPOAuthToken(cred *models.MCPOAuthCredential, token *mcpoauth.Token) error {
+	var err error
+	if cred.AccessTokenEnc, cred.AccessTokenNonce, err = mcpmarket.EncryptText(token.AccessToken); err != nil {
+		return err
+	}
+	if token.RefreshToken != "" {
+		if cred.RefreshTokenEnc, cred.RefreshTokenNonce, err = mcpmarket.EncryptText(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	cred.ExpiresAt = nil
+	if !token.ExpiresAt.IsZero() {
+		expiresAt := token.ExpiresAt
+		cred.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+func (oc *MCPOAuthController) pushToken(agentID uint, server, accessToken string, expiresAt *time.Time) {
+	if oc.WebSocketController == nil {
+		return
+	}
+	oc.WebSocketController.PushMCPOAuthToken(agentID, server, accessToken, expiresAt)
+}
+
+// refreshMCPOAuthCredential 刷新令牌并保存；刷新令牌失效时标记为过期，需要用户重新授权
+func refreshMCPOAuthCredential(ctx context.Context, db *gorm.DB, httpClient *http.Client, cred *models.MCPOAuthCredential) (*mcpoauth.Token, error) {
+	lock, _ := mcpOAuthRefreshLocks.LoadOrStore(cred.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// 等锁期间其他调用方可能已完成刷新
+	if err := db.First(cred, cred.ID).Error; err != nil {
+		return nil, err
+	}
+	if !mcpOAuthNeedsRefresh(cred, time.Now()) {
+		accessToken, err := mcpmarket.DecryptText(cred.AccessTokenEnc, cred.AccessTokenNonce)
+		if err != nil {
+			return nil, err
+		}
+		token := &mcpoauth.Token{AccessToken: accessToken}
+		if cred.ExpiresAt != nil {
+			token.ExpiresAt = *cred.ExpiresAt
+		}
+		return token, nil
+	}
+
+	refreshToken, err := mcpmarket.DecryptText(cred.RefreshTokenEnc, cred.RefreshTokenNonce)
+	if err != nil {
+		return nil, err
+	}
+	clientSecret, err := mcpmarket.DecryptText(cred.ClientSecretEnc, cred.ClientSecretNonce)
+	if err != nil {
+		return nil, err
+	}
+	token, err := mcpoauth.Refresh(ctx, httpClient, cred.TokenEndpoint,
+		&mcpoauth.Client{ClientID: cred.ClientID, ClientSecret: clientSecret}, refreshToken, cred.Resource)
+	if err != nil {
+		updates := map[string]interface{}{"last_error": err.Error()}
+		if mcpoauth.IsInvalidGrant(err) {
+			updates["status"] = mcpOAuthStatusExpired
+		}
+		db.Model(cred).Updates(updates)
+		return nil, err
+	}
+	if err := sealMCPOAuthToken(cred, token); err != nil {
+		return nil, err
+	}
+	cred.Status = mcpOAuthStatusActive
+	cred.LastError = ""
+	if token.Scope != "" {
+		cred.Scope = token.Scope
+	}
+	if err := db.Save(cred).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// mcpOAuthNeedsRefresh 有刷新令牌且即将过期
+func mcpOAuthNeedsRefresh(cred *models.MCPOAuthCredential, now time.Time) bool {
+	return cred.RefreshTokenEnc != "" && cred.ExpiresAt != nil && cred.ExpiresAt.Before(now.Add(mcpOAuthRefreshAhead))
+}
+
+// runRefresher 定期刷新即将过期的令牌并推送给主程序
+func (oc *MCPOAuthController) runRefresher() {
+	ticker := time.NewTicker(mcpOAuthRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var creds []models.MCPOAuthCredential
+		if err := oc.DB.Where("status = ? AND refresh_token_enc <> '' AND expires_at IS NOT NULL AND expires_at < ?",
+			mcpOAuthStatusActive, time.Now().Add(mcpOAuthRefreshAhead)).Find(&creds).Error; err != nil {
+			log.Printf("[MCP OAuth] 查询待刷新令牌失败: %v", err)
+			continue
+		}
+		for i := range creds {
+			cred := &creds[i]
+			ctx, cancel := context.WithTimeout(context.Background(), mcpOAuthHTTPTimeout)
+			token, err := refreshMCPOAuthCredential(ctx, oc.DB, oc.httpClient, cred)
+			cancel()
+			if err != nil {
+				log.Printf("[MCP OAuth] 刷新智能体 %d 的MCP服务器 %s 令牌失败: %v", cred.AgentID, cred.ServerName, err)
+				if mcpoauth.IsInvalidGrant(err) {
+					oc.pushToken(cred.AgentID, cred.ServerName, "", nil)
+				}
+				continue
+			}
+			oc.pushToken(cred.AgentID, cred.ServerName, token.AccessToken, cred.ExpiresAt)
+		}
+	}
+}
+
+var errMCPOAuthNotAuthorized = errors.New("未授权")
+
+// lookupMCPOAuthToken 主程序获取智能体访问令牌，即将过期时先刷新
+func lookupMCPOAuthToken(ctx context.Context, db *gorm.DB, agentID uint, server string) (string, *time.Time, error) {
+	var cred models.MCPOAuthCredential
+	if err := db.Where("agent_id = ? AND server_name = ? AND status = ?", agentID, server, mcpOAuthStatusActive).First(&cred).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, errMCPOAuthNotAuthorized
+		}
+		return "", nil, err
+	}
+	if mcpOAuthNeedsRefresh(&cred, time.Now()) {
+		token, err := refreshMCPOAuthCredential(ctx, db, &http.Client{Timeout: mcpOAuthHTTPTimeout}, &cred)
+		if err != nil {
+			if mcpoauth.IsInvalidGrant(err) {
+				return "", nil, errMCPOAuthNotAuthorized
+			}
+			return "", nil, err
+		}
+		return token.AccessToken, cred.ExpiresAt, nil
+	}
+	accessToken, err := mcpmarket.DecryptText(cred.AccessTokenEnc, cred.AccessTokenNonce)
+	if err != nil {
+		return "", nil, err
+	}
+	if cred.ExpiresAt != nil && cred.ExpiresAt.Before(time.Now()) {
+		// 已过期且无法刷新
+		return "", nil, errMCPOAuthNotAuthorized
+	}
+	return accessToken, cred.ExpiresAt, nil
+}
+
+// handleMCPOAuthTokenRequest 主程序请求智能体的访问令牌，未授权返回 404
+func (client *WebSocketClient) handleMCPOAuthTokenRequest(request *WebSocketRequest) {
+	agentIDText, _ := request.Body["agent_id"].(string)
+	server, _ := request.Body["server"].(string)
+	agentID, err := strconv.ParseUint(strings.TrimSpace(agentIDText), 10, 64)
+	if err != nil || agentID == 0 || strings.TrimSpace(server) == "" {
+		client.sendResponse(request.ID, 400, nil, "缺少agent_id或server参数")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpOAuthHTTPTimeout)
+	defer cancel()
+	accessToken, expiresAt, err := lookupMCPOAuthToken(ctx, client.controller.DB, uint(agentID), server)
+	if errors.Is(err, errMCPOAuthNotAuthorized) {
+		client.sendResponse(request.ID, 404, nil, "智能体未授权该MCP服务器")
+		return
+	}
+	if err != nil {
+		client.sendResponse(request.ID, 500, nil, err.Error())
+		return
+	}
+	client.sendResponse(request.ID, 200, mcpOAuthTokenBody(uint(agentID), server, accessToken, expiresAt), "")
+}
+
+func mcpOAuthTokenBody(agentID uint, server, accessToken string, expiresAt *time.Time) map[string]interface{} {
+	body := map[string]interface{}{
+		"agent_id":     strconv.FormatUint(uint64(agentID), 10),
+		"server":       server,
+		"access_token": accessToken,
+		"expires_at":   int64(0),
+	}
+	if expiresAt != nil {
+		body["expires_at"] = expiresAt.Unix()
+	}
+	return body
+}
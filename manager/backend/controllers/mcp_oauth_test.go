@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+	mcpmarket "xiaozhi/manager/backend/services/mcp_market"
+	mcpoauth "xiaozhi/manager/backend/services/mcp_oauth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLookupMCPOAuthTokenRefreshesBeforeExpiry(t *testing.T) {
+	t.Setenv("MCP_MARKET_SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.MCPOAuthCredential{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	refreshes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		refreshes++
+		if r.Form.Get("refresh_token") != "rt-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at-2", "refresh_token": "rt-2", "expires_in": 3600})
+	}))
+	defer srv.Close()
+
+	soon := time.Now().Add(time.Minute)
+	cred := models.MCPOAuthCredential{AgentID: 7, ServerName: "github", TokenEndpoint: srv.URL, ClientID: "cid", Status: mcpOAuthStatusActive}
+	if err := sealMCPOAuthToken(&cred, &mcpoauth.Token{AccessToken: "at-1", RefreshToken: "rt-1", ExpiresAt: soon}); err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if err := db.Create(&cred).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if cred.AccessTokenEnc == "" || cred.AccessTokenEnc == "at-1" {
+		t.Fatalf("access token should be stored encrypted")
+	}
+
+	accessToken, expiresAt, err := lookupMCPOAuthToken(context.Background(), db, 7, "github")
+	if err != nil || accessToken != "at-2" || expiresAt == nil || time.Until(*expiresAt) < 50*time.Minute {
+		t.Fatalf("expected refreshed token: %q %v %v", accessToken, expiresAt, err)
+	}
+	var saved models.MCPOAuthCredential
+	db.First(&saved, cred.ID)
+	if rt, _ := mcpmarket.DecryptText(saved.RefreshTokenEnc, saved.RefreshTokenNonce); rt != "rt-2" {
+		t.Fatalf("rotated refresh token should be saved, got %q", rt)
+	}
+
+	// 未到刷新窗口时直接返回
+	if accessToken, _, err := lookupMCPOAuthToken(context.Background(), db, 7, "github"); err != nil || accessToken != "at-2" || refreshes != 1 {
+		t.Fatalf("unexpected second lookup: %q %v refreshes=%d", accessToken, err, refreshes)
+	}
+
+	// 刷新令牌失效后标记过期，视为未授权
+	db.Model(&saved).Updates(map[string]interface{}{"expires_at": time.Now()})
+	if _, _, err := lookupMCPOAuthToken(context.Background(), db, 7, "github"); !errors.Is(err, errMCPOAuthNotAuthorized) {
+		t.Fatalf("expected not authorized after invalid_grant, got %v", err)
+	}
+	db.First(&saved, cred.ID)
+	if saved.Status != mcpOAuthStatusExpired {
+		t.Fatalf("credential should be marked expired, got %s", saved.Status)
+	}
+	if _, _, err := lookupMCPOAuthToken(context.Background(), db, 8, "github"); !errors.Is(err, errMCPOAuthNotAuthorized) {
+		t.Fatalf("unknown agent should be not authorized, got %v", err)
+	}
+}
+
+func TestMergeMarketServerKeepsOAuth(t *testing.T) {
+	manual := map[string]interface{}{"global": map[string]interface{}{"enabled": true, "servers": []interface{}{
+		map[string]interface{}{"name": "notion", "type": "streamablehttp", "url": "https://mcp.notion.com/mcp", "enabled": true, "auth": "OAuth"},
+	}}}
+	merged, _, err := mergeManualAndMarketServers(manual, []models.MCPMarketService{
+		{Name: "github", Enabled: true, Transport: "streamablehttp", URL: "https://api.githubcopilot.com/mcp/", Auth: "oauth"},
+	})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	servers, _ := decodeMCPServers(asMap(merged["global"])["servers"])
+	if len(servers) != 2 || normalizeMCPServerAuth(servers[0].Auth) != mcpServerAuthOAuth || servers[1].Auth != mcpServerAuthOAuth {
+		t.Fatalf("auth should survive merge: %+v", servers)
+	}
+}
+
+func TestMCPOAuthRedirectURIFromConfig(t *testing.T) {
+	if got, err := mcpOAuthRedirectURI("https://console.example.com/"); err != nil || got != "https://console.example.com"+mcpOAuthCallbackPath {
+		t.Fatalf("unexpected redirect uri: %q %v", got, err)
+	}
+	for _, publicURL := range []string{"", "console.example.com", "ftp://console.example.com", "https://console.example.com/?a=1"} {
+		if _, err := mcpOAuthRedirectURI(publicURL); err == nil {
+			t.Errorf("expected error for %q", publicURL)
+		}
+	}
+}
+
+func TestOAuthCallbackRequiresNonceCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MCP_MARKET_SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.MCPOAuthCredential{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at-1", "expires_in": 3600})
+	}))
+	defer srv.Close()
+
+	const state = "state-1"
+	mcpOAuthPendingMu.Lock()
+	mcpOAuthPendingStates[state] = &mcpOAuthPending{
+		agentID:   7,
+		server:    mcpServerConfig{Name: "github", Url: "https://mcp.example.com"},
+		meta:      &mcpoauth.Metadata{TokenEndpoint: srv.URL},
+		client:    &mcpoauth.Client{ClientID: "cid"},
+		verifier:  "verifier",
+		nonce:     "nonce-1",
+		createdAt: time.Now(),
+	}
+	mcpOAuthPendingMu.Unlock()
+	defer func() {
+		mcpOAuthPendingMu.Lock()
+		delete(mcpOAuthPendingStates, state)
+		mcpOAuthPendingMu.Unlock()
+	}()
+
+	oc := &MCPOAuthController{DB: db, httpClient: srv.Client()}
+	callback := func(cookie string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, mcpOAuthCallbackPath+"?state="+state+"&code=abc", nil)
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: mcpOAuthNonceCookie + state, Value: cookie})
+		}
+		oc.OAuthCallback(c)
+		return w.Code
+	}
+
+	// 其他浏览器（没有或带着错误的 cookie）访问回调链接时拒绝，且不作废 state
+	if code := callback(""); code != http.StatusForbidden {
+		t.Fatalf("callback without cookie = %d", code)
+	}
+	if code := callback("nonce-2"); code != http.StatusForbidden {
+		t.Fatalf("callback with wrong cookie = %d", code)
+	}
+	var count int64
+	db.Model(&models.MCPOAuthCredential{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("rejected callback should not save credentials")
+	}
+
+	if code := callback("nonce-1"); code != http.StatusOK {
+		t.Fatalf("callback from the initiating browser = %d", code)
+	}
+	db.Model(&models.MCPOAuthCredential{}).Where("agent_id = ? AND server_name = ?", 7, "github").Count(&count)
+	if count != 1 {
+		t.Fatalf("credential should be saved, got %d", count)
+	}
+	if code := callback("nonce-1"); code != http.StatusBadRequest {
+		t.Fatalf("state should be single use, got %d", code)
+	}
+}
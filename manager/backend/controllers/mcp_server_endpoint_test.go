@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+func TestGenerateAgentMCPServerEndpoint(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Config{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Config{Type: "ota", Name: "ota", ConfigID: "ota", IsDefault: true,
+		JsonData: `{"external":{"websocket":{"url":"wss://xz.example.com/xiaozhi/v1/"}}}`}).Error; err != nil {
+		t.Fatalf("create ota config: %v", err)
+	}
+
+	endpoint, err := GenerateAgentMCPServerEndpoint(db, "12", 3)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host != "xz.example.com" || u.Path != mcpServerPath {
+		t.Fatalf("unexpected endpoint: %s", endpoint)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(u.Query().Get("token"), claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("xiaozhi_admin_secret_key"), nil
+	}); err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if claims["purpose"] != mcpServerTokenPurpose || claims["agentId"] != "12" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	// 设备接入点 token 仍为 mcp-endpoint，不能用于 MCP 服务器
+	deviceEndpoint, err := GenerateAgentMCPEndpoint(db, "12", 3)
+	if err != nil || !strings.HasPrefix(deviceEndpoint, "wss://xz.example.com/mcp?token=") {
+		t.Fatalf("device endpoint = %s, %v", deviceEndpoint, err)
+	}
+	if strings.Contains(deviceEndpoint, u.Query().Get("token")) {
+		t.Fatalf("device endpoint token must differ from MCP server token")
+	}
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+const mcpTransportStdio = "stdio"
+
+// mcpStdioLimits stdio MCP 子进程资源限制，需与主程序 internal/domain/mcp/stdio.Limits 保持一致
+type mcpStdioLimits struct {
+	MaxMemoryMB   int `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds int `json:"max_cpu_seconds,omitempty"`
+	MaxOpenFiles  int `json:"max_open_files,omitempty"`
+}
+
+// isMCPStdioServer 与主程序一致：type 为 stdio/command，或未填 type 但配置了 command 的都按 stdio 启动
+func isMCPStdioServer(transportType, command string) bool {
+	switch strings.ToLower(strings.TrimSpace(transportType)) {
+	case mcpTransportStdio, "command":
+		return true
+	case "":
+		return strings.TrimSpace(command) != ""
+	}
+	return false
+}
+
+// validateMCPConfigServers 校验MCP配置JSON中 stdio 类型服务器的启动参数，其余类型由主程序连接时校验
+func validateMCPConfigServers(jsonData string) error {
+	payload, err := parseJSONMap(jsonData)
+	if err != nil {
+		return fmt.Errorf("MCP配置不是有效的JSON: %v", err)
+	}
+	mcpMap := payload
+	if v, ok := payload["mcp"]; ok {
+		mcpMap = asMap(v)
+	}
+	servers, err := decodeMCPServers(asMap(mcpMap["global"])["servers"])
+	if err != nil {
+		return fmt.Errorf("解析MCP服务器失败: %v", err)
+	}
+	for i, server := range servers {
+		if !isMCPStdioServer(server.Type, server.Command) {
+			continue
+		}
+		label := strings.TrimSpace(server.Name)
+		if label == "" {
+			label = fmt.Sprintf("第%d个服务器", i+1)
+		}
+		if strings.TrimSpace(server.Command) == "" {
+			return fmt.Errorf("MCP服务器 %s 缺少启动命令", label)
+		}
+		for key := range server.Env {
+			if key = strings.TrimSpace(key); key == "" || strings.Contains(key, "=") {
+				return fmt.Errorf("MCP服务器 %s 的环境变量名无效: %q", label, key)
+			}
+		}
+		if l := server.Limits; l != nil && (l.MaxMemoryMB < 0 || l.MaxCPUSeconds < 0 || l.MaxOpenFiles < 0) {
+			return fmt.Errorf("MCP服务器 %s 的资源限制不能为负数", label)
+		}
+	}
+	return nil
+}
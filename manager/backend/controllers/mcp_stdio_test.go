@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+)
+
+func TestValidateMCPConfigServers(t *testing.T) {
+	valid := `{"mcp":{"global":{"enabled":true,"servers":[
+		{"name":"remote","type":"streamablehttp","url":"http://127.0.0.1:3001/mcp","enabled":true},
+		{"name":"fetch","type":"stdio","command":"uvx","args":["mcp-server-fetch"],"env":{"TOKEN":"${FETCH_TOKEN}"},"limits":{"max_memory_mb":512},"enabled":true}
+	]}}}`
+	if err := validateMCPConfigServers(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 旧格式：顶层 global
+	if err := validateMCPConfigServers(`{"global":{"servers":[{"name":"fs","type":"stdio","command":"npx"}]}}`); err != nil {
+		t.Fatalf("legacy format should be accepted: %v", err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","type":"stdio"}]}}}`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","type":"command","command":""}]}}}`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","type":"command","command":"uvx","env":{"A=B":"1"}}]}}}`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","command":"uvx","limits":{"max_memory_mb":-1}}]}}}`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","type":"stdio","command":"uvx","env":{"A=B":"1"}}]}}}`,
+		`{"mcp":{"global":{"servers":[{"name":"fetch","type":"stdio","command":"uvx","limits":{"max_open_files":-1}}]}}}`,
+	}
+	for _, raw := range invalid {
+		if err := validateMCPConfigServers(raw); err == nil {
+			t.Errorf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestMergeMarketServersKeepsStdioFields(t *testing.T) {
+	manual := map[string]interface{}{
+		"global": map[string]interface{}{
+			"enabled": true,
+			"servers": []interface{}{map[string]interface{}{
+				"name": "fetch", "type": "stdio", "command": "uvx", "args": []interface{}{"mcp-server-fetch"},
+				"work_dir": "/opt/mcp", "limits": map[string]interface{}{"max_memory_mb": 256}, "enabled": true,
+			}},
+		},
+	}
+	merged, _, err := mergeManualAndMarketServers(manual, []models.MCPMarketService{})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	servers, err := decodeMCPServers(asMap(merged["global"])["servers"])
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("decode merged servers: %v %v", servers, err)
+	}
+	s := servers[0]
+	if s.Command != "uvx" || len(s.Args) != 1 || s.WorkDir != "/opt/mcp" || s.Limits == nil || s.Limits.MaxMemoryMB != 256 {
+		t.Fatalf("stdio fields lost after merge: %+v", s)
+	}
+}
@@ -0,0 +1,586 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 设备定时提醒：提醒持久化在 reminders 表，主程序定期为在线设备领取到期提醒并注入播报，
+// 投递成功后回执（一次性提醒结束，cron 提醒推进到下一次）；设备离线时提醒保持待投递，上线后补发。
+const (
+	reminderTypeOnce = "once"
+	reminderTypeCron = "cron"
+
+	reminderStatusPending   = "pending"
+	reminderStatusPaused    = "paused"
+	reminderStatusDelivered = "delivered"
+	reminderStatusCancelled = "cancelled"
+
+	reminderSourceMCP     = "mcp"
+	reminderSourceUI      = "ui"
+	reminderSourceOpenAPI = "openapi"
+
+	reminderMessageMaxRunes      = 500
+	reminderMaxActivePerDevice   = 50
+	reminderMaxDelay             = 366 * 24 * time.Hour
+	reminderLeaseDuration        = time.Minute
+	reminderRetryDelay           = 30 * time.Second
+	reminderCronCatchUpWindow    = time.Hour // cron 提醒错过超过该时长不再补发，直接推进到下一次
+	reminderClaimDefaultLimit    = 20
+	reminderClaimMaxDeviceFilter = 500
+)
+
+var reminderRunAtLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// ReminderController 设备定时提醒
+type ReminderController struct {
+	DB *gorm.DB
+}
+
+// NewReminderController 创建提醒控制器
+func NewReminderController(db *gorm.DB) *ReminderController {
+	return &ReminderController{DB: db}
+}
+
+// reminderScheduleInput 提醒时间：delay_seconds / run_at / cron_expr 三选一
+type reminderScheduleInput struct {
+	DelaySeconds int    `json:"delay_seconds"`
+	RunAt        string `json:"run_at"` // RFC3339，或按 timezone 解析的 "2006-01-02 15:04[:05]"
+	CronExpr     string `json:"cron_expr"`
+	Timezone     string `json:"timezone"`
+}
+
+func (in reminderScheduleInput) isSet() bool {
+	return in.DelaySeconds != 0 || strings.TrimSpace(in.RunAt) != "" || strings.TrimSpace(in.CronExpr) != ""
+}
+
+type reminderSchedule struct {
+	Type      string
+	CronExpr  string
+	Timezone  string
+	NextRunAt time.Time
+}
+
+// resolveReminderSchedule 校验提醒时间并计算首次触发时间
+func resolveReminderSchedule(in reminderScheduleInput, now time.Time) (*reminderSchedule, error) {
+	runAt := strings.TrimSpace(in.RunAt)
+	cronExpr := strings.TrimSpace(in.CronExpr)
+	tz := strings.TrimSpace(in.Timezone)
+
+	set := 0
+	for _, ok := range []bool{in.DelaySeconds != 0, runAt != "", cronExpr != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("delay_seconds、run_at、cron_expr 必须且只能提供一个")
+	}
+	loc, err := loadReminderLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cronExpr != "":
+		next, err := nextCronRun(cronExpr, tz, now)
+		if err != nil {
+			return nil, err
+		}
+		return &reminderSchedule{Type: reminderTypeCron, CronExpr: cronExpr, Timezone: tz, NextRunAt: next}, nil
+	case in.DelaySeconds != 0:
+		if in.DelaySeconds < 0 {
+			return nil, errors.New("delay_seconds 必须大于0")
+		}
+		delay := time.Duration(in.DelaySeconds) * time.Second
+		if delay > reminderMaxDelay {
+			return nil, errors.New("提醒时间不能超过一年")
+		}
+		return &reminderSchedule{Type: reminderTypeOnce, Timezone: tz, NextRunAt: now.Add(delay)}, nil
+	default:
+		at, err := parseReminderRunAt(runAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		// 允许少量时钟误差，明显早于当前时间视为无效
+		if at.Before(now.Add(-time.Minute)) {
+			return nil, errors.New("run_at 不能早于当前时间")
+		}
+		if at.Sub(now) > reminderMaxDelay {
+			return nil, errors.New("提醒时间不能超过一年")
+		}
+		return &reminderSchedule{Type: reminderTypeOnce, Timezone: tz, NextRunAt: at}, nil
+	}
+}
+
+func parseReminderRunAt(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range reminderRunAtLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("run_at 格式无效: %s", value)
+}
+
+func normalizeReminderMessage(message string) (string, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "", errors.New("提醒内容不能为空")
+	}
+	if utf8.RuneCountInString(message) > reminderMessageMaxRunes {
+		return "", fmt.Errorf("提醒内容不能超过%d个字符", reminderMessageMaxRunes)
+	}
+	return message, nil
+}
+
+type createReminderRequest struct {
+	DeviceID string `json:"device_id" binding:"required"` // 设备名（MAC）
+	Message  string `json:"message" binding:"required"`
+	SkipLlm  *bool  `json:"skip_llm"` // 默认 true：直接播报提醒内容
+	reminderScheduleInput
+}
+
+// createReminder 为设备创建提醒，校验内容、时间与设备活跃提醒数量上限
+func createReminder(db *gorm.DB, userID uint, req createReminderRequest, source string) (*models.Reminder, error) {
+	message, err := normalizeReminderMessage(req.Message)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := resolveReminderSchedule(req.reminderScheduleInput, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var active int64
+	if err := db.Model(&models.Reminder{}).
+		Where("device_id = ? AND status IN ?", req.DeviceID, []string{reminderStatusPending, reminderStatusPaused}).
+		Count(&active).Error; err != nil {
+		return nil, fmt.Errorf("查询提醒失败: %w", err)
+	}
+	if active >= reminderMaxActivePerDevice {
+		return nil, fmt.Errorf("该设备的待执行提醒已达上限(%d)", reminderMaxActivePerDevice)
+	}
+
+	skipLlm := true
+	if req.SkipLlm != nil {
+		skipLlm = *req.SkipLlm
+	}
+	reminder := &models.Reminder{
+		UserID:       userID,
+		DeviceID:     req.DeviceID,
+		Message:      message,
+		SkipLlm:      skipLlm,
+		ScheduleType: schedule.Type,
+		CronExpr:     schedule.CronExpr,
+		Timezone:     schedule.Timezone,
+		NextRunAt:    schedule.NextRunAt,
+		Status:       reminderStatusPending,
+		Source:       source,
+	}
+	if err := db.Create(reminder).Error; err != nil {
+		return nil, fmt.Errorf("创建提醒失败: %w", err)
+	}
+	return reminder, nil
+}
+
+func reminderSourceFromContext(c *gin.Context) string {
+	if _, ok := c.Get("auth_type"); ok {
+		return reminderSourceOpenAPI
+	}
+	return reminderSourceUI
+}
+
+func parseReminderIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的提醒ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetReminders 查询当前用户的提醒，支持按 device_id / status 过滤
+func (rc *ReminderController) GetReminders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	page := parsePositiveInt(c.Query("page"), 1)
+	pageSize := parsePositiveInt(c.Query("page_size"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	query := rc.DB.Model(&models.Reminder{}).Where("user_id = ?", userID)
+	if deviceID := strings.TrimSpace(c.Query("device_id")); deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询提醒失败"})
+		return
+	}
+	var reminders []models.Reminder
+	if err := query.Order("next_run_at ASC, id ASC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&reminders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询提醒失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":      reminders,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateReminder 创建设备提醒
+func (rc *ReminderController) CreateReminder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req createReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+
+	var device models.Device
+	if err := rc.DB.Where("device_name = ? AND user_id = ?", req.DeviceID, userID).First(&device).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "设备不存在或不属于当前用户"})
+		return
+	}
+
+	reminder, err := createReminder(rc.DB, userID, req, reminderSourceFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": reminder})
+}
+
+// UpdateReminder 修改提醒内容、时间或启停状态（enabled=false 暂停）
+func (rc *ReminderController) UpdateReminder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	reminderID, ok := parseReminderIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Message *string `json:"message"`
+		SkipLlm *bool   `json:"skip_llm"`
+		Enabled *bool   `json:"enabled"`
+		reminderScheduleInput
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	var reminder models.Reminder
+	if err := rc.DB.Where("id = ? AND user_id = ?", reminderID, userID).First(&reminder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Message != nil {
+		message, err := normalizeReminderMessage(*req.Message)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["message"] = message
+	}
+	if req.SkipLlm != nil {
+		updates["skip_llm"] = *req.SkipLlm
+	}
+	if req.reminderScheduleInput.isSet() {
+		schedule, err := resolveReminderSchedule(req.reminderScheduleInput, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["schedule_type"] = schedule.Type
+		updates["cron_expr"] = schedule.CronExpr
+		updates["timezone"] = schedule.Timezone
+		updates["next_run_at"] = schedule.NextRunAt
+		// 已投递或已取消的提醒重新设置时间后恢复待执行
+		if reminder.Status == reminderStatusDelivered || reminder.Status == reminderStatusCancelled {
+			updates["status"] = reminderStatusPending
+		}
+	}
+	if req.Enabled != nil {
+		switch {
+		case !*req.Enabled && reminder.Status == reminderStatusPending:
+			updates["status"] = reminderStatusPaused
+		case *req.Enabled && reminder.Status == reminderStatusPaused:
+			updates["status"] = reminderStatusPending
+			// 恢复 cron 提醒时从当前时间重新计算，避免补发暂停期间错过的提醒
+			if reminder.ScheduleType == reminderTypeCron && !req.reminderScheduleInput.isSet() {
+				next, err := nextCronRun(reminder.CronExpr, reminder.Timezone, time.Now())
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				updates["next_run_at"] = next
+			}
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": reminder})
+		return
+	}
+	updates["lease_owner"] = ""
+	updates["lease_until"] = nil
+
+	if err := rc.DB.Model(&reminder).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新提醒失败"})
+		return
+	}
+	rc.DB.First(&reminder, reminder.ID)
+	c.JSON(http.StatusOK, gin.H{"data": reminder})
+}
+
+// DeleteReminder 删除提醒
+func (rc *ReminderController) DeleteReminder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	reminderID, ok := parseReminderIDParam(c)
+	if !ok {
+		return
+	}
+	result := rc.DB.Where("id = ? AND user_id = ?", reminderID, userID).Delete(&models.Reminder{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除提醒失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提醒已删除"})
+}
+
+// CreateReminderInternal 主程序（本地 MCP 工具）按设备名创建提醒（内部服务接口）
+func (rc *ReminderController) CreateReminderInternal(c *gin.Context) {
+	var req createReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+
+	var device models.Device
+	if err := rc.DB.Where("device_name = ?", req.DeviceID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	reminder, err := createReminder(rc.DB, device.UserID, req, reminderSourceMCP)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reminder})
+}
+
+// GetRemindersInternal 查询设备待执行的提醒（内部服务接口）
+func (rc *ReminderController) GetRemindersInternal(c *gin.Context) {
+	deviceID := strings.TrimSpace(c.Query("device_id"))
+	if deviceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id 不能为空"})
+		return
+	}
+	var reminders []models.Reminder
+	if err := rc.DB.Where("device_id = ? AND status IN ?", deviceID, []string{reminderStatusPending, reminderStatusPaused}).
+		Order("next_run_at ASC, id ASC").
+		Limit(reminderMaxActivePerDevice).
+		Find(&reminders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询提醒失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reminders})
+}
+
+// CancelReminderInternal 取消设备的提醒（内部服务接口）
+func (rc *ReminderController) CancelReminderInternal(c *gin.Context) {
+	reminderID, ok := parseReminderIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		DeviceID string `json:"device_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	result := rc.DB.Model(&models.Reminder{}).
+		Where("id = ? AND device_id = ? AND status IN ?", reminderID, strings.TrimSpace(req.DeviceID), []string{reminderStatusPending, reminderStatusPaused}).
+		Updates(map[string]interface{}{"status": reminderStatusCancelled, "lease_owner": "", "lease_until": nil})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消提醒失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在或已结束"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "提醒已取消"})
+}
+
+// ClaimDueRemindersInternal 为主程序上的在线设备领取到期提醒（内部服务接口）。
+// 领取以租约方式进行，多个主程序实例并发领取时同一提醒只会被一个实例拿到。
+func (rc *ReminderController) ClaimDueRemindersInternal(c *gin.Context) {
+	var req struct {
+		DeviceIDs []string `json:"device_ids"`
+		Owner     string   `json:"owner" binding:"required"`
+		Limit     int      `json:"limit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if len(req.DeviceIDs) > reminderClaimMaxDeviceFilter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("device_ids 数量不能超过%d", reminderClaimMaxDeviceFilter)})
+		return
+	}
+	reminders, err := claimDueReminders(rc.DB, req.DeviceIDs, strings.TrimSpace(req.Owner), req.Limit, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "领取提醒失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reminders})
+}
+
+// AckReminderInternal 主程序回执提醒投递结果（内部服务接口）
+func (rc *ReminderController) AckReminderInternal(c *gin.Context) {
+	reminderID, ok := parseReminderIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Owner     string `json:"owner" binding:"required"`
+		Delivered bool   `json:"delivered"`
+		Error     string `json:"error"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := ackReminder(rc.DB, reminderID, strings.TrimSpace(req.Owner), req.Delivered, time.Now()); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func claimDueReminders(db *gorm.DB, deviceIDs []string, owner string, limit int, now time.Time) ([]models.Reminder, error) {
+	ret := make([]models.Reminder, 0)
+	if len(deviceIDs) == 0 || owner == "" {
+		return ret, nil
+	}
+	if limit <= 0 || limit > reminderClaimDefaultLimit {
+		limit = reminderClaimDefaultLimit
+	}
+
+	var candidates []models.Reminder
+	if err := db.Where("device_id IN ? AND status = ? AND next_run_at <= ?", deviceIDs, reminderStatusPending, now).
+		Where("lease_until IS NULL OR lease_until < ?", now).
+		Order("next_run_at ASC, id ASC").
+		Limit(limit).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		updates := map[string]interface{}{
+			"lease_owner": owner,
+			"lease_until": now.Add(reminderLeaseDuration),
+		}
+		skipMissed := false
+		if candidate.ScheduleType == reminderTypeCron && now.Sub(candidate.NextRunAt) > reminderCronCatchUpWindow {
+			next, err := nextCronRun(candidate.CronExpr, candidate.Timezone, now)
+			if err != nil {
+				return nil, err
+			}
+			updates = map[string]interface{}{"next_run_at": next, "lease_owner": "", "lease_until": nil}
+			skipMissed = true
+		}
+		result := db.Model(&models.Reminder{}).
+			Where("id = ? AND status = ?", candidate.ID, reminderStatusPending).
+			Where("lease_until IS NULL OR lease_until < ?", now).
+			Updates(updates)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 || skipMissed {
+			continue
+		}
+		candidate.LeaseOwner = owner
+		ret = append(ret, candidate)
+	}
+	return ret, nil
+}
+
+func ackReminder(db *gorm.DB, reminderID uint, owner string, delivered bool, now time.Time) error {
+	var reminder models.Reminder
+	if err := db.First(&reminder, reminderID).Error; err != nil {
+		return errors.New("提醒不存在")
+	}
+	if reminder.LeaseOwner != owner {
+		return errors.New("提醒租约已失效")
+	}
+
+	updates := map[string]interface{}{"lease_owner": ""}
+	if !delivered {
+		// 投递失败（设备刚断开等）：短暂延迟后允许重新领取
+		updates["lease_until"] = now.Add(reminderRetryDelay)
+	} else {
+		updates["lease_until"] = nil
+		updates["delivery_count"] = gorm.Expr("delivery_count + ?", 1)
+		updates["last_delivered_at"] = now
+		if reminder.ScheduleType == reminderTypeCron {
+			after := now
+			if reminder.NextRunAt.After(after) {
+				after = reminder.NextRunAt
+			}
+			next, err := nextCronRun(reminder.CronExpr, reminder.Timezone, after)
+			if err != nil {
+				updates["status"] = reminderStatusCancelled
+			} else {
+				updates["next_run_at"] = next
+			}
+		} else {
+			updates["status"] = reminderStatusDelivered
+		}
+	}
+
+	result := db.Model(&models.Reminder{}).
+		Where("id = ? AND lease_owner = ?", reminderID, owner).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("提醒租约已失效")
+	}
+	return nil
+}
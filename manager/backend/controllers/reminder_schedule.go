@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule 标准 5 段 cron 表达式（分 时 日 月 周），支持 * , - / 以及 @hourly/@daily/@weekly/@monthly/@yearly。
+// 日与周同时被限定时按 cron 惯例取并集。
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type cronFieldBounds struct {
+	name     string
+	min, max int
+}
+
+var cronFieldsBounds = []cronFieldBounds{
+	{name: "分钟", min: 0, max: 59},
+	{name: "小时", min: 0, max: 23},
+	{name: "日", min: 1, max: 31},
+	{name: "月", min: 1, max: 12},
+	{name: "星期", min: 0, max: 7},
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCronExpr 解析 cron 表达式
+func parseCronExpr(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if mapped, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = mapped
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFieldsBounds) {
+		return nil, fmt.Errorf("cron 表达式需要 5 段（分 时 日 月 周），实际 %d 段", len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFieldsBounds[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 周字段 7 与 0 均表示周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = (bits[4] | 1) &^ (1 << 7)
+	}
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, bounds cronFieldBounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, fmt.Errorf("cron %s字段格式错误: %q", bounds.name, field)
+		}
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron %s字段步长无效: %q", bounds.name, part)
+			}
+			rangePart, step = part[:idx], n
+		}
+
+		lo, hi := bounds.min, bounds.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			ends := strings.SplitN(rangePart, "-", 2)
+			a, errA := strconv.Atoi(ends[0])
+			b, errB := strconv.Atoi(ends[1])
+			if errA != nil || errB != nil {
+				return 0, fmt.Errorf("cron %s字段范围无效: %q", bounds.name, part)
+			}
+			lo, hi = a, b
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("cron %s字段取值无效: %q", bounds.name, part)
+			}
+			lo = n
+			// "5/15" 表示从 5 开始每 15 个单位
+			if step == 1 {
+				hi = n
+			}
+		}
+		if lo < bounds.min || hi > bounds.max || lo > hi {
+			return 0, fmt.Errorf("cron %s字段超出范围 %d-%d: %q", bounds.name, bounds.min, bounds.max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// Next 返回严格晚于 after 的下一次触发时间（按 after 所在时区计算）；5 年内无匹配时返回零值
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// loadReminderLocation 解析提醒时区，为空时使用服务器本地时区
+func loadReminderLocation(tz string) (*time.Location, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", tz)
+	}
+	return loc, nil
+}
+
+// nextCronRun 计算 cron 提醒在 after 之后的下一次触发时间
+func nextCronRun(expr, tz string, after time.Time) (time.Time, error) {
+	schedule, err := parseCronExpr(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := loadReminderLocation(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron 表达式在未来 5 年内不会触发: %s", expr)
+	}
+	return next, nil
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	base := time.Date(2026, 3, 14, 20, 30, 0, 0, loc) // 周六
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 20 * * *", time.Date(2026, 3, 15, 20, 0, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 20, 45, 0, 0, loc)},
+		{"0 9 * * 1-5", time.Date(2026, 3, 16, 9, 0, 0, 0, loc)},
+		{"30 8 1 * *", time.Date(2026, 4, 1, 8, 30, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, loc)},
+		{"0 12 13 * 1", time.Date(2026, 3, 16, 12, 0, 0, 0, loc)}, // 日与周取并集
+		{"@hourly", time.Date(2026, 3, 14, 21, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+	}
+	for _, tc := range cases {
+		schedule, err := parseCronExpr(tc.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tc.want) {
+			t.Fatalf("%q next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCronExpr(bad); err == nil {
+			t.Fatalf("parse %q should fail", bad)
+		}
+	}
+	if _, err := nextCronRun("0 0 31 2 *", "", base); err == nil {
+		t.Fatalf("impossible cron should fail")
+	}
+}
+
+func TestResolveReminderSchedule(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	s, err := resolveReminderSchedule(reminderScheduleInput{DelaySeconds: 1200}, now)
+	if err != nil || s.Type != reminderTypeOnce || !s.NextRunAt.Equal(now.Add(20*time.Minute)) {
+		t.Fatalf("delay schedule = %+v, %v", s, err)
+	}
+	s, err = resolveReminderSchedule(reminderScheduleInput{RunAt: "2026-03-14 20:00", Timezone: "UTC"}, now)
+	if err != nil || !s.NextRunAt.Equal(time.Date(2026, 3, 14, 20, 0, 0, 0, time.UTC)) {
+		t.Fatalf("run_at schedule = %+v, %v", s, err)
+	}
+	s, err = resolveReminderSchedule(reminderScheduleInput{CronExpr: "0 20 * * *", Timezone: "UTC"}, now)
+	if err != nil || s.Type != reminderTypeCron || !s.NextRunAt.Equal(time.Date(2026, 3, 14, 20, 0, 0, 0, time.UTC)) {
+		t.Fatalf("cron schedule = %+v, %v", s, err)
+	}
+
+	for _, in := range []reminderScheduleInput{
+		{},
+		{DelaySeconds: 60, CronExpr: "* * * * *"},
+		{DelaySeconds: -1},
+		{RunAt: "2026-03-13 08:00", Timezone: "UTC"},
+		{RunAt: "tomorrow"},
+		{CronExpr: "0 8 * * *", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := resolveReminderSchedule(in, now); err == nil {
+			t.Fatalf("schedule %+v should fail", in)
+		}
+	}
+}
+
+func TestReminderClaimAndAck(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Reminder{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	now := time.Now()
+	once := models.Reminder{UserID: 1, DeviceID: "aa:bb", Message: "吃药", SkipLlm: true, ScheduleType: reminderTypeOnce, NextRunAt: now.Add(-2 * time.Hour), Status: reminderStatusPending}
+	daily := models.Reminder{UserID: 1, DeviceID: "aa:bb", Message: "喝水", ScheduleType: reminderTypeCron, CronExpr: "*/10 * * * *", NextRunAt: now.Add(-time.Minute), Status: reminderStatusPending}
+	missed := models.Reminder{UserID: 1, DeviceID: "aa:bb", Message: "错过的周期提醒", ScheduleType: reminderTypeCron, CronExpr: "0 * * * *", NextRunAt: now.Add(-3 * time.Hour), Status: reminderStatusPending}
+	future := models.Reminder{UserID: 1, DeviceID: "aa:bb", Message: "未到期", ScheduleType: reminderTypeOnce, NextRunAt: now.Add(time.Hour), Status: reminderStatusPending}
+	other := models.Reminder{UserID: 2, DeviceID: "cc:dd", Message: "其他设备", ScheduleType: reminderTypeOnce, NextRunAt: now.Add(-time.Minute), Status: reminderStatusPending}
+	for _, r := range []*models.Reminder{&once, &daily, &missed, &future, &other} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	claimed, err := claimDueReminders(db, []string{"aa:bb"}, "server-1", 0, now)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if len(claimed) != 2 || claimed[0].ID != once.ID || claimed[1].ID != daily.ID {
+		t.Fatalf("claimed = %+v", claimed)
+	}
+	// 错过超过补发窗口的 cron 提醒直接推进到下一次
+	var reloaded models.Reminder
+	db.First(&reloaded, missed.ID)
+	if !reloaded.NextRunAt.After(now) || reloaded.LeaseOwner != "" {
+		t.Fatalf("missed cron reminder not advanced: %+v", reloaded)
+	}
+
+	// 租约期内其他实例领取不到
+	if again, _ := claimDueReminders(db, []string{"aa:bb"}, "server-2", 0, now); len(again) != 0 {
+		t.Fatalf("leased reminders claimed twice: %+v", again)
+	}
+	if err := ackReminder(db, once.ID, "server-2", true, now); err == nil {
+		t.Fatalf("ack with wrong owner should fail")
+	}
+
+	if err := ackReminder(db, once.ID, "server-1", true, now); err != nil {
+		t.Fatalf("ack once: %v", err)
+	}
+	reloaded = models.Reminder{}
+	db.First(&reloaded, once.ID)
+	if reloaded.Status != reminderStatusDelivered || reloaded.DeliveryCount != 1 || reloaded.LastDeliveredAt == nil {
+		t.Fatalf("once reminder after ack: %+v", reloaded)
+	}
+
+	if err := ackReminder(db, daily.ID, "server-1", true, now); err != nil {
+		t.Fatalf("ack cron: %v", err)
+	}
+	reloaded = models.Reminder{}
+	db.First(&reloaded, daily.ID)
+	if reloaded.Status != reminderStatusPending || !reloaded.NextRunAt.After(now) || reloaded.NextRunAt.Minute()%10 != 0 {
+		t.Fatalf("cron reminder after ack: %+v", reloaded)
+	}
+
+	// 投递失败后延迟重试
+	claimed, _ = claimDueReminders(db, []string{"cc:dd"}, "server-1", 0, now)
+	if len(claimed) != 1 {
+		t.Fatalf("claim other device = %+v", claimed)
+	}
+	if err := ackReminder(db, other.ID, "server-1", false, now); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	if again, _ := claimDueReminders(db, []string{"cc:dd"}, "server-1", 0, now.Add(time.Second)); len(again) != 0 {
+		t.Fatalf("nacked reminder reclaimed before retry delay")
+	}
+	if again, _ := claimDueReminders(db, []string{"cc:dd"}, "server-1", 0, now.Add(reminderRetryDelay+time.Second)); len(again) != 1 {
+		t.Fatalf("nacked reminder not reclaimed after retry delay")
+	}
+}
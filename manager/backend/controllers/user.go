@@ -24,6 +24,9 @@ type UserController struct {
 		RequestMcpToolDetailsFromClient(ctx context.Context, agentID string) ([]MCPTool, error)
 		RequestDeviceMcpToolDetailsFromClient(ctx context.Context, deviceID string) ([]MCPTool, error)
 		CallMcpToolFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
+		RequestMcpResourcesFromClient(ctx context.Context, agentID string) ([]MCPResource, error)
+		RequestMcpPromptsFromClient(ctx context.Context, agentID string) ([]MCPPrompt, error)
+		RenderMcpPromptFromClient(ctx context.Context, body map[string]interface{}) (string, error)
 		RequestOpenClawStatusFromClient(ctx context.Context, agentID string) (map[string]interface{}, error)
 		CallOpenClawChatFromClient(ctx context.Context, body map[string]interface{}) (map[string]interface{}, error)
 		CallOpenClawChatStreamFromClient(ctx context.Context, body map[string]interface{}, onResponse func(*WebSocketResponse) error) (map[string]interface{}, error)
@@ -293,16 +296,22 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var req struct {
-		Name             string                  `json:"name" binding:"required,min=2,max=50"`
-		CustomPrompt     string                  `json:"custom_prompt"`
-		LLMConfigID      *string                 `json:"llm_config_id"`
-		TTSConfigID      *string                 `json:"tts_config_id"`
-		Voice            *string                 `json:"voice"`
-		ASRSpeed         string                  `json:"asr_speed"`
-		MemoryMode       string                  `json:"memory_mode"`
-		MCPServiceNames  string                  `json:"mcp_service_names"`
-		OpenClaw         *OpenClawConfigResponse `json:"openclaw"`
-		KnowledgeBaseIDs []uint                  `json:"knowledge_base_ids"`
+		Name                 string                  `json:"name" binding:"required,min=2,max=50"`
+		CustomPrompt         string                  `json:"custom_prompt"`
+		LLMConfigID          *string                 `json:"llm_config_id"`
+		TTSConfigID          *string                 `json:"tts_config_id"`
+		Voice                *string                 `json:"voice"`
+		ASRSpeed             string                  `json:"asr_speed"`
+		MemoryMode           string                  `json:"memory_mode"`
+		MCPServiceNames      string                  `json:"mcp_service_names"`
+		Language             *string                 `json:"language"`
+		LanguageVoices       map[string]string       `json:"language_voices"`
+		PronunciationDict    *string                 `json:"pronunciation_dict"`
+		TTSFallbackConfigIDs *string                 `json:"tts_fallback_config_ids"`
+		ToolPolicies         map[string]string       `json:"tool_policies"`
+		MCPResources         []AgentMCPResource      `json:"mcp_resources"`
+		OpenClaw             *OpenClawConfigResponse `json:"openclaw"`
+		KnowledgeBaseIDs     []uint                  `json:"knowledge_base_ids"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -321,6 +330,40 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		return
 	}
 
+	language := defaultAgentLanguage
+	if req.Language != nil {
+		language = normalizeAgentLanguage(*req.Language)
+	}
+	languageVoicesConfig, err := normalizeAgentLanguageVoices(req.LanguageVoices)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pronunciationDict := ""
+	if req.PronunciationDict != nil {
+		if pronunciationDict, err = normalizeAgentPronunciationDict(*req.PronunciationDict); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	toolPoliciesConfig, err := normalizeAgentToolPolicies(req.ToolPolicies)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mcpResourcesConfig, err := normalizeAgentMCPResources(req.MCPResources)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttsFallbackConfigIDs := ""
+	if req.TTSFallbackConfigIDs != nil {
+		if ttsFallbackConfigIDs, err = validateTTSFallbackConfigIDs(uc.DB, *req.TTSFallbackConfigIDs, req.TTSConfigID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	if err := uc.validateKnowledgeBaseOwnership(userID.(uint), req.KnowledgeBaseIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -336,8 +379,14 @@ func (uc *UserController) CreateAgent(c *gin.Context) {
 		ASRSpeed:        req.ASRSpeed,
 		MemoryMode:      req.MemoryMode,
 		MCPServiceNames: normalizedMCPServiceNames,
+		Language:        language,
 		Status:          "active",
 	}
+	agent.LanguageVoicesConfig = languageVoicesConfig
+	agent.PronunciationDict = pronunciationDict
+	agent.ToolPoliciesConfig = toolPoliciesConfig
+	agent.MCPResourcesConfig = mcpResourcesConfig
+	agent.TTSFallbackConfigIDs = ttsFallbackConfigIDs
 	openClawCfg := mergeOpenClawConfig(
 		defaultOpenClawConfig(),
 		req.OpenClaw,
@@ -409,16 +458,22 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 	}
 
 	var req struct {
-		Name             string                  `json:"name" binding:"required,min=2,max=50"`
-		CustomPrompt     string                  `json:"custom_prompt"`
-		LLMConfigID      *string                 `json:"llm_config_id"`
-		TTSConfigID      *string                 `json:"tts_config_id"`
-		Voice            *string                 `json:"voice"`
-		ASRSpeed         string                  `json:"asr_speed"`
-		MemoryMode       *string                 `json:"memory_mode"`
-		MCPServiceNames  string                  `json:"mcp_service_names"`
-		OpenClaw         *OpenClawConfigResponse `json:"openclaw"`
-		KnowledgeBaseIDs []uint                  `json:"knowledge_base_ids"`
+		Name                 string                  `json:"name" binding:"required,min=2,max=50"`
+		CustomPrompt         string                  `json:"custom_prompt"`
+		LLMConfigID          *string                 `json:"llm_config_id"`
+		TTSConfigID          *string                 `json:"tts_config_id"`
+		Voice                *string                 `json:"voice"`
+		ASRSpeed             string                  `json:"asr_speed"`
+		MemoryMode           *string                 `json:"memory_mode"`
+		MCPServiceNames      string                  `json:"mcp_service_names"`
+		Language             *string                 `json:"language"`
+		LanguageVoices       map[string]string       `json:"language_voices"`
+		PronunciationDict    *string                 `json:"pronunciation_dict"`
+		TTSFallbackConfigIDs *string                 `json:"tts_fallback_config_ids"`
+		ToolPolicies         map[string]string       `json:"tool_policies"`
+		MCPResources         []AgentMCPResource      `json:"mcp_resources"`
+		OpenClaw             *OpenClawConfigResponse `json:"openclaw"`
+		KnowledgeBaseIDs     []uint                  `json:"knowledge_base_ids"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -449,6 +504,53 @@ func (uc *UserController) UpdateAgent(c *gin.Context) {
 		return
 	}
 	agent.MCPServiceNames = normalizedMCPServiceNames
+	if req.Language != nil {
+		agent.Language = normalizeAgentLanguage(*req.Language)
+	} else {
+		agent.Language = normalizeAgentLanguage(agent.Language)
+	}
+	if req.LanguageVoices != nil {
+		languageVoicesConfig, err := normalizeAgentLanguageVoices(req.LanguageVoices)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		agent.LanguageVoicesConfig = languageVoicesConfig
+	}
+	if req.PronunciationDict != nil {
+		pronunciationDict, err := normalizeAgentPronunciationDict(*req.PronunciationDict)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		agent.PronunciationDict = pronunciationDict
+	}
+	if req.ToolPolicies != nil {
+		toolPoliciesConfig, err := normalizeAgentToolPolicies(req.ToolPolicies)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		agent.ToolPoliciesConfig = toolPoliciesConfig
+	}
+	if req.MCPResources != nil {
+		mcpResourcesConfig, err := normalizeAgentMCPResources(req.MCPResources)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		agent.MCPResourcesConfig = mcpResourcesConfig
+	}
+	if req.TTSFallbackConfigIDs != nil {
+		agent.TTSFallbackConfigIDs = *req.TTSFallbackConfigIDs
+	}
+	// 主TTS变化后也需重新校验，去掉与主TTS相同的备用项
+	ttsFallbackConfigIDs, err := validateTTSFallbackConfigIDs(uc.DB, agent.TTSFallbackConfigIDs, agent.TTSConfigID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	agent.TTSFallbackConfigIDs = ttsFallbackConfigIDs
 	openClawCfg := mergeOpenClawConfig(
 		buildOpenClawConfigFromAgent(agent),
 		req.OpenClaw,
@@ -943,9 +1045,13 @@ func (uc *UserController) GetAgentMCPEndpoint(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	serverEndpoint, err := GenerateAgentMCPServerEndpoint(uc.DB, agentID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 返回单个endpoint字符串
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"endpoint": endpoint}})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"endpoint": endpoint, "server_endpoint": serverEndpoint}})
 }
 
 // GetAgentOpenClawEndpoint 获取智能体的OpenClaw接入点URL（用户版本）
@@ -1143,6 +1249,28 @@ func (uc *UserController) GetAgentMcpTools(c *gin.Context) {
 	GetAgentMcpToolsCommon(c, agentID, uc.WebSocketController, userAgentValidator)
 }
 
+// GetAgentMCPContext 获取智能体可挂载的MCP资源与可选用的提示词模板（用户版本）
+func (uc *UserController) GetAgentMCPContext(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var agent models.Agent
+	if err := uc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+		return
+	}
+	GetAgentMCPContextCommon(c, agent, uc.WebSocketController)
+}
+
+// RenderAgentMCPPrompt 渲染MCP提示词模板（用户版本）
+func (uc *UserController) RenderAgentMCPPrompt(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var agent models.Agent
+	if err := uc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在或不属于当前用户"})
+		return
+	}
+	RenderAgentMCPPromptCommon(c, agent, uc.WebSocketController)
+}
+
 // 获取仪表板统计数据
 func (uc *UserController) GetDashboardStats(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -74,7 +74,6 @@ type VoiceCloneController struct {
 	DB           *gorm.DB
 	AudioStorage *storage.AudioStorage
 	HTTPClient   *http.Client
-	taskQueue    chan uint
 }
 
 type minimaxVoiceCloneResult struct {
@@ -119,8 +118,8 @@ const (
 	voiceCloneTaskStatusSucceeded  = "succeeded"
 	voiceCloneTaskStatusFailed     = "failed"
 
-	voiceCloneTaskQueueSize    = 128
-	voiceCloneTaskWorkerCount  = 2
+	voiceCloneJobType          = "voice_clone"
+	voiceCloneTaskMaxAttempts  = 3
 	voiceCloneTaskProcessLimit = 5 * time.Minute
 )
 
@@ -133,9 +132,8 @@ func NewVoiceCloneController(db *gorm.DB, cfg *config.Config) *VoiceCloneControl
 		HTTPClient: &http.Client{
 			Timeout: 90 * time.Second,
 		},
-		taskQueue: make(chan uint, voiceCloneTaskQueueSize),
 	}
-	controller.startVoiceCloneWorkers()
+	controller.registerVoiceCloneJobHandler()
 	return controller
 }
 
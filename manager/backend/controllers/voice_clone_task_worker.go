@@ -14,16 +14,27 @@ import (
 	"gorm.io/gorm"
 )
 
-func (vcc *VoiceCloneController) startVoiceCloneWorkers() {
+// voiceCloneJobPayload 声音复刻任务在持久化队列中的参数
+type voiceCloneJobPayload struct {
+	TaskPrimaryID uint `json:"task_primary_id"`
+}
+
+func (vcc *VoiceCloneController) registerVoiceCloneJobHandler() {
 	if vcc == nil || vcc.DB == nil {
 		return
 	}
-	for i := 0; i < voiceCloneTaskWorkerCount; i++ {
-		go vcc.voiceCloneTaskWorkerLoop(i + 1)
-	}
+	registerJobHandler(voiceCloneJobType, jobHandlerSpec{
+		handler:     vcc.handleVoiceCloneJob,
+		timeout:     voiceCloneTaskProcessLimit,
+		maxAttempts: voiceCloneTaskMaxAttempts,
+		workers:     2,
+		onCancel:    vcc.onVoiceCloneJobCancelled,
+		onRetry:     vcc.onVoiceCloneJobRetry,
+	})
 	go vcc.reloadPendingVoiceCloneTasks()
 }
 
+// reloadPendingVoiceCloneTasks 为尚未进入持久化队列的历史任务补建队列任务
 func (vcc *VoiceCloneController) reloadPendingVoiceCloneTasks() {
 	var pendingTasks []models.VoiceCloneTask
 	if err := vcc.DB.Where("status IN ?", []string{voiceCloneTaskStatusQueued, voiceCloneTaskStatusProcessing}).
@@ -32,68 +43,122 @@ func (vcc *VoiceCloneController) reloadPendingVoiceCloneTasks() {
 		log.Printf("[voice_clone][task] reload pending tasks failed: %v", err)
 		return
 	}
+	reloaded := 0
 	for _, task := range pendingTasks {
+		active, err := hasActiveJob(vcc.DB, voiceCloneJobDedupeKey(task.ID))
+		if err != nil {
+			log.Printf("[voice_clone][task] check queued job failed: task_primary_id=%d err=%v", task.ID, err)
+			continue
+		}
+		if active {
+			continue
+		}
 		vcc.enqueueVoiceCloneTask(task.ID)
+		reloaded++
 	}
-	if len(pendingTasks) > 0 {
-		log.Printf("[voice_clone][task] reloaded pending tasks: %d", len(pendingTasks))
+	if reloaded > 0 {
+		log.Printf("[voice_clone][task] reloaded pending tasks: %d", reloaded)
+	}
+}
+
+// onVoiceCloneJobCancelled 队列任务被取消后，把仍在排队/执行中的复刻任务标记为失败，用户可重新复刻
+func (vcc *VoiceCloneController) onVoiceCloneJobCancelled(db *gorm.DB, job *models.Job) {
+	var payload voiceCloneJobPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return
+	}
+	var task models.VoiceCloneTask
+	if err := db.First(&task, payload.TaskPrimaryID).Error; err != nil {
+		return
+	}
+	if task.Status != voiceCloneTaskStatusQueued && task.Status != voiceCloneTaskStatusProcessing {
+		return
 	}
+	vcc.finishVoiceCloneTaskFailed(&task, nil, errors.New("任务已被管理员取消"))
+}
+
+// onVoiceCloneJobRetry 队列任务重试前把失败的复刻任务恢复为排队状态，否则 worker 领取时会直接跳过
+func (vcc *VoiceCloneController) onVoiceCloneJobRetry(db *gorm.DB, job *models.Job) error {
+	var payload voiceCloneJobPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return err
+	}
+	var task models.VoiceCloneTask
+	if err := db.First(&task, payload.TaskPrimaryID).Error; err != nil {
+		return fmt.Errorf("复刻任务不存在")
+	}
+	switch task.Status {
+	case voiceCloneTaskStatusSucceeded:
+		return fmt.Errorf("复刻任务已成功，无需重试")
+	case voiceCloneTaskStatusQueued, voiceCloneTaskStatusProcessing:
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.VoiceCloneTask{}).Where("id = ? AND status = ?", task.ID, voiceCloneTaskStatusFailed).Updates(map[string]any{
+			"status":      voiceCloneTaskStatusQueued,
+			"last_error":  "",
+			"started_at":  nil,
+			"finished_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.VoiceClone{}).Where("id = ? AND user_id = ?", task.VoiceCloneID, task.UserID).Updates(map[string]any{
+			"status": voiceCloneStatusProcessing,
+		}).Error
+	})
+}
+
+func voiceCloneJobDedupeKey(taskPrimaryID uint) string {
+	return fmt.Sprintf("%s:%d", voiceCloneJobType, taskPrimaryID)
 }
 
 func (vcc *VoiceCloneController) enqueueVoiceCloneTask(taskPrimaryID uint) {
-	if taskPrimaryID == 0 || vcc == nil || vcc.taskQueue == nil {
+	if taskPrimaryID == 0 || vcc == nil || vcc.DB == nil {
 		return
 	}
-	select {
-	case vcc.taskQueue <- taskPrimaryID:
-	default:
-		log.Printf("[voice_clone][task] queue is full, fallback to async enqueue: task_primary_id=%d", taskPrimaryID)
-		go func(id uint) {
-			vcc.taskQueue <- id
-		}(taskPrimaryID)
+	job, err := enqueueJob(vcc.DB, voiceCloneJobType, voiceCloneJobDedupeKey(taskPrimaryID), voiceCloneJobPayload{TaskPrimaryID: taskPrimaryID})
+	if err != nil {
+		log.Printf("[voice_clone][task] enqueue failed: task_primary_id=%d err=%v", taskPrimaryID, err)
+		return
 	}
+	log.Printf("[voice_clone][task] enqueued task_primary_id=%d job_id=%d", taskPrimaryID, job.ID)
 }
 
-func (vcc *VoiceCloneController) voiceCloneTaskWorkerLoop(workerID int) {
-	for taskPrimaryID := range vcc.taskQueue {
-		log.Printf("[voice_clone][task] worker=%d picked task_primary_id=%d", workerID, taskPrimaryID)
-		vcc.processVoiceCloneTask(taskPrimaryID)
+func (vcc *VoiceCloneController) handleVoiceCloneJob(ctx context.Context, _ *gorm.DB, job *models.Job) error {
+	var payload voiceCloneJobPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return permanentJobErr(err)
 	}
+	log.Printf("[voice_clone][task] job_id=%d picked task_primary_id=%d attempt=%d/%d", job.ID, payload.TaskPrimaryID, job.Attempts, job.MaxAttempts)
+	return vcc.processVoiceCloneTask(ctx, payload.TaskPrimaryID, job.Attempts >= job.MaxAttempts)
 }
 
-func (vcc *VoiceCloneController) processVoiceCloneTask(taskPrimaryID uint) {
+// processVoiceCloneTask 执行复刻任务；提供商调用失败且非最后一次尝试时任务回到排队状态，由队列按退避重试
+func (vcc *VoiceCloneController) processVoiceCloneTask(ctx context.Context, taskPrimaryID uint, finalAttempt bool) error {
 	task, claimed, err := vcc.claimVoiceCloneTask(taskPrimaryID)
 	if err != nil {
-		log.Printf("[voice_clone][task] claim task failed: task_primary_id=%d err=%v", taskPrimaryID, err)
-		return
+		return fmt.Errorf("claim task failed: %w", err)
 	}
 	if !claimed || task == nil {
-		return
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), voiceCloneTaskProcessLimit)
-	defer cancel()
-
 	var clone models.VoiceClone
 	if err = vcc.DB.Where("id = ? AND user_id = ?", task.VoiceCloneID, task.UserID).First(&clone).Error; err != nil {
-		vcc.finishVoiceCloneTaskFailed(task, nil, fmt.Errorf("任务关联复刻记录不存在: %w", err))
-		return
+		return vcc.failVoiceCloneTaskPermanently(task, nil, fmt.Errorf("任务关联复刻记录不存在: %w", err))
 	}
 
 	var audio models.VoiceCloneAudio
 	if err = vcc.DB.Where("voice_clone_id = ? AND user_id = ?", clone.ID, task.UserID).Order("created_at DESC").First(&audio).Error; err != nil {
-		vcc.finishVoiceCloneTaskFailed(task, &clone, fmt.Errorf("任务关联音频记录不存在: %w", err))
-		return
+		return vcc.failVoiceCloneTaskPermanently(task, &clone, fmt.Errorf("任务关联音频记录不存在: %w", err))
 	}
 	if !vcc.AudioStorage.FileExists(audio.FilePath) {
-		vcc.finishVoiceCloneTaskFailed(task, &clone, fmt.Errorf("任务音频文件不存在: %s", audio.FilePath))
-		return
+		return vcc.failVoiceCloneTaskPermanently(task, &clone, fmt.Errorf("任务音频文件不存在: %s", audio.FilePath))
 	}
 
 	var ttsCfg models.Config
 	if err = vcc.DB.Where("type = ? AND config_id = ?", "tts", clone.TTSConfigID).First(&ttsCfg).Error; err != nil {
-		vcc.finishVoiceCloneTaskFailed(task, &clone, fmt.Errorf("任务关联TTS配置不存在: %w", err))
-		return
+		return vcc.failVoiceCloneTaskPermanently(task, &clone, fmt.Errorf("任务关联TTS配置不存在: %w", err))
 	}
 	provider := normalizeCloneProvider(strings.TrimSpace(ttsCfg.Provider))
 	var result *minimaxVoiceCloneResult
@@ -107,18 +172,47 @@ func (vcc *VoiceCloneController) processVoiceCloneTask(taskPrimaryID uint) {
 	case "indextts_vllm":
 		result, err = vcc.cloneWithIndexTTSVLLM(ctx, ttsCfg, audio.FilePath, audio.FileName)
 	default:
-		vcc.finishVoiceCloneTaskFailed(task, &clone, fmt.Errorf("当前任务不支持提供商: %s", provider))
-		return
+		return vcc.failVoiceCloneTaskPermanently(task, &clone, fmt.Errorf("当前任务不支持提供商: %s", provider))
 	}
 	if err != nil {
-		vcc.finishVoiceCloneTaskFailed(task, &clone, err)
-		return
+		if finalAttempt {
+			vcc.finishVoiceCloneTaskFailed(task, &clone, err)
+		} else {
+			vcc.requeueVoiceCloneTask(task, err)
+		}
+		return err
 	}
 	if err = vcc.finishVoiceCloneTaskSuccess(task, &clone, &audio, result); err != nil {
-		log.Printf("[voice_clone][task] finish success failed: task_primary_id=%d err=%v", taskPrimaryID, err)
-		return
+		return fmt.Errorf("finish success failed: %w", err)
 	}
 	log.Printf("[voice_clone][task] task completed: task_primary_id=%d task_id=%s voice_clone_id=%d", taskPrimaryID, task.TaskID, task.VoiceCloneID)
+	return nil
+}
+
+func (vcc *VoiceCloneController) failVoiceCloneTaskPermanently(task *models.VoiceCloneTask, clone *models.VoiceClone, failure error) error {
+	vcc.finishVoiceCloneTaskFailed(task, clone, failure)
+	return permanentJobErr(failure)
+}
+
+// requeueVoiceCloneTask 将任务状态退回排队，等待队列下一次重试
+func (vcc *VoiceCloneController) requeueVoiceCloneTask(task *models.VoiceCloneTask, failure error) {
+	lastError := truncateForLog(strings.TrimSpace(failure.Error()), 2000)
+	err := vcc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.VoiceCloneTask{}).Where("id = ? AND status = ?", task.ID, voiceCloneTaskStatusProcessing).Updates(map[string]any{
+			"status":     voiceCloneTaskStatusQueued,
+			"last_error": lastError,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.VoiceClone{}).Where("id = ? AND user_id = ?", task.VoiceCloneID, task.UserID).Updates(map[string]any{
+			"status": voiceCloneStatusQueued,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("[voice_clone][task] requeue task failed: task_primary_id=%d err=%v origin=%s", task.ID, err, lastError)
+		return
+	}
+	log.Printf("[voice_clone][task] task will retry: task_primary_id=%d task_id=%s reason=%s", task.ID, task.TaskID, lastError)
 }
 
 func (vcc *VoiceCloneController) claimVoiceCloneTask(taskPrimaryID uint) (*models.VoiceCloneTask, bool, error) {
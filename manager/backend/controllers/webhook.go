@@ -0,0 +1,507 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 出站回调：主程序把 eventbus 上的设备/会话/消息/工具调用事件上报到 /api/internal/webhooks/events，
+// 这里按设备所属用户与智能体匹配回调配置，为每个回调写入投递记录并交给持久化队列异步投递。
+const (
+	webhookEventDeviceOnline     = "device.online"
+	webhookEventDeviceOffline    = "device.offline"
+	webhookEventSessionStart     = "session.start"
+	webhookEventSessionEnd       = "session.end"
+	webhookEventMessageUser      = "message.user"
+	webhookEventMessageAssistant = "message.assistant"
+	webhookEventToolCall         = "tool.call"
+	webhookEventOpenClawMode     = "openclaw.mode_changed"
+	webhookEventTest             = "webhook.test"
+
+	webhookMaxPerUser  = 20
+	webhookURLMaxLen   = 500
+	webhookNameMaxLen  = 100
+	webhookSecretBytes = 24
+)
+
+// webhookEventTypes 可订阅的事件类型
+var webhookEventTypes = []string{
+	webhookEventDeviceOnline,
+	webhookEventDeviceOffline,
+	webhookEventSessionStart,
+	webhookEventSessionEnd,
+	webhookEventMessageUser,
+	webhookEventMessageAssistant,
+	webhookEventToolCall,
+	webhookEventOpenClawMode,
+}
+
+// WebhookController 出站回调配置、投递记录与内部事件上报
+type WebhookController struct {
+	DB *gorm.DB
+}
+
+// NewWebhookController 创建回调控制器并注册投递任务
+func NewWebhookController(db *gorm.DB) *WebhookController {
+	startWebhookWorkers(db)
+	return &WebhookController{DB: db}
+}
+
+// webhookEvent 主程序上报的事件，原样作为回调请求体
+type webhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	DeviceID  string                 `json:"device_id"`
+	AgentID   string                 `json:"agent_id,omitempty"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type webhookRequest struct {
+	Name    *string  `json:"name"`
+	URL     *string  `json:"url"`
+	Secret  *string  `json:"secret"`
+	AgentID *uint    `json:"agent_id"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// normalizeWebhookURL 仅允许 http/https 绝对地址，主机为 IP 时不能是内网/本机地址（域名在连接时校验）
+func normalizeWebhookURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("回调地址不能为空")
+	}
+	if len(raw) > webhookURLMaxLen {
+		return "", fmt.Errorf("回调地址不能超过%d个字符", webhookURLMaxLen)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", errors.New("回调地址必须是 http 或 https 地址")
+	}
+	host := parsed.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return "", errWebhookForbiddenAddr
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && isForbiddenWebhookAddr(addr) {
+		return "", errWebhookForbiddenAddr
+	}
+	return raw, nil
+}
+
+// normalizeWebhookEvents 校验订阅事件类型并去重，返回CSV（空表示全部）
+func normalizeWebhookEvents(events []string) (string, error) {
+	valid := make(map[string]struct{}, len(webhookEventTypes))
+	for _, eventType := range webhookEventTypes {
+		valid[eventType] = struct{}{}
+	}
+	result := make([]string, 0, len(events))
+	seen := make(map[string]struct{}, len(events))
+	for _, eventType := range events {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			continue
+		}
+		if _, ok := valid[eventType]; !ok {
+			return "", fmt.Errorf("不支持的事件类型: %s", eventType)
+		}
+		if _, ok := seen[eventType]; ok {
+			continue
+		}
+		seen[eventType] = struct{}{}
+		result = append(result, eventType)
+	}
+	return strings.Join(result, ","), nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// checkWebhookAgent 校验智能体属于当前用户（0 表示不限智能体）
+func (wc *WebhookController) checkWebhookAgent(userID, agentID uint) error {
+	if agentID == 0 {
+		return nil
+	}
+	var count int64
+	if err := wc.DB.Model(&models.Agent{}).Where("id = ? AND user_id = ?", agentID, userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("查询智能体失败: %v", err)
+	}
+	if count == 0 {
+		return errors.New("智能体不存在或不属于当前用户")
+	}
+	return nil
+}
+
+func parseWebhookIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (wc *WebhookController) findUserWebhook(c *gin.Context) (*models.Webhook, bool) {
+	webhookID, ok := parseWebhookIDParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+	var webhook models.Webhook
+	if err := wc.DB.Where("id = ? AND user_id = ?", webhookID, c.GetUint("user_id")).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回调不存在"})
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// GetWebhooks 查询当前用户的回调配置
+func (wc *WebhookController) GetWebhooks(c *gin.Context) {
+	var webhooks []models.Webhook
+	if err := wc.DB.Where("user_id = ?", c.GetUint("user_id")).Order("id ASC").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询回调失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": webhooks, "event_types": webhookEventTypes})
+}
+
+// CreateWebhook 创建回调，未提供 secret 时自动生成
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.URL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "回调地址不能为空"})
+		return
+	}
+
+	var count int64
+	wc.DB.Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count)
+	if count >= webhookMaxPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("每个用户最多配置%d个回调", webhookMaxPerUser)})
+		return
+	}
+
+	webhook := models.Webhook{UserID: userID, Enabled: true}
+	if err := wc.applyWebhookRequest(userID, &webhook, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if webhook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成签名密钥失败"})
+			return
+		}
+		webhook.Secret = secret
+	}
+	if err := wc.DB.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建回调失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": webhook})
+}
+
+// UpdateWebhook 修改回调，未传的字段保持不变
+func (wc *WebhookController) UpdateWebhook(c *gin.Context) {
+	webhook, ok := wc.findUserWebhook(c)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if err := wc.applyWebhookRequest(webhook.UserID, webhook, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wc.DB.Model(webhook).Select("name", "url", "secret", "agent_id", "events", "enabled").Updates(webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新回调失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": webhook})
+}
+
+func (wc *WebhookController) applyWebhookRequest(userID uint, webhook *models.Webhook, req webhookRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len([]rune(name)) > webhookNameMaxLen {
+			return fmt.Errorf("名称不能超过%d个字符", webhookNameMaxLen)
+		}
+		webhook.Name = name
+	}
+	if req.URL != nil {
+		normalized, err := normalizeWebhookURL(*req.URL)
+		if err != nil {
+			return err
+		}
+		webhook.URL = normalized
+	}
+	if req.Secret != nil {
+		if secret := strings.TrimSpace(*req.Secret); secret != "" {
+			if len(secret) < 16 || len(secret) > 100 {
+				return errors.New("签名密钥长度需在16到100个字符之间")
+			}
+			webhook.Secret = secret
+		}
+	}
+	if req.AgentID != nil {
+		if err := wc.checkWebhookAgent(userID, *req.AgentID); err != nil {
+			return err
+		}
+		webhook.AgentID = *req.AgentID
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(req.Events)
+		if err != nil {
+			return err
+		}
+		webhook.Events = events
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// DeleteWebhook 删除回调及其投递记录
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	webhook, ok := wc.findUserWebhook(c)
+	if !ok {
+		return
+	}
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除回调失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "回调已删除"})
+}
+
+// TestWebhook 立即同步投递一条 webhook.test 事件并返回接收方响应码，结果同样写入投递记录
+func (wc *WebhookController) TestWebhook(c *gin.Context) {
+	webhook, ok := wc.findUserWebhook(c)
+	if !ok {
+		return
+	}
+	event := webhookEvent{
+		ID:        "test-" + uuid.NewString(),
+		Type:      webhookEventTest,
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"message": "这是一条测试事件"},
+	}
+	payload, _ := json.Marshal(event)
+	delivery := models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		UserID:    webhook.UserID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		Status:    webhookDeliveryPending,
+	}
+	if err := wc.DB.Create(&delivery).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入投递记录失败"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), webhookDeliveryTimeout)
+	defer cancel()
+	result := sendWebhook(ctx, webhook, &delivery)
+	if err := recordWebhookAttempt(wc.DB, delivery.ID, result, true); err != nil {
+		log.Printf("[Webhook] delivery_id=%d record result failed: %v", delivery.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"delivery_id": delivery.ID,
+			"success":     result.Error == "",
+			"status_code": result.StatusCode,
+			"duration_ms": result.DurationMs,
+			"error":       result.Error,
+		},
+	})
+}
+
+// GetWebhookDeliveries 分页查询回调的投递记录，支持按 status / event_type 过滤
+func (wc *WebhookController) GetWebhookDeliveries(c *gin.Context) {
+	webhook, ok := wc.findUserWebhook(c)
+	if !ok {
+		return
+	}
+	page := parsePositiveInt(c.Query("page"), 1)
+	pageSize := parsePositiveInt(c.Query("page_size"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	query := wc.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := strings.TrimSpace(c.Query("event_type")); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询投递记录失败"})
+		return
+	}
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询投递记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":      deliveries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// RedeliverWebhook 将投递记录重新放入队列
+func (wc *WebhookController) RedeliverWebhook(c *gin.Context) {
+	webhook, ok := wc.findUserWebhook(c)
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseWebhookIDParam(c, "delivery_id")
+	if !ok {
+		return
+	}
+	result := wc.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND webhook_id = ? AND status IN ?", deliveryID, webhook.ID, []string{webhookDeliveryFailed, webhookDeliverySucceeded}).
+		Updates(map[string]interface{}{"status": webhookDeliveryPending, "attempts": 0, "last_error": ""})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "投递记录不存在或仍在投递中"})
+		return
+	}
+	if err := enqueueWebhookDelivery(wc.DB, deliveryID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已重新加入投递队列"})
+}
+
+// ReportWebhookEventInternal 主程序上报事件（内部服务接口），匹配回调后异步投递
+func (wc *WebhookController) ReportWebhookEventInternal(c *gin.Context) {
+	var event webhookEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	queued, err := dispatchWebhookEvent(wc.DB, &event)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"queued": queued}})
+}
+
+// dispatchWebhookEvent 按设备归属匹配已启用的回调，写入投递记录并入队；重复上报的事件（相同 id）只投递一次
+func dispatchWebhookEvent(db *gorm.DB, event *webhookEvent) (int, error) {
+	event.Type = strings.TrimSpace(event.Type)
+	event.DeviceID = strings.TrimSpace(event.DeviceID)
+	if event.Type == "" || event.Type == webhookEventTest {
+		return 0, errors.New("无效的事件类型")
+	}
+	if event.DeviceID == "" {
+		return 0, errors.New("device_id 不能为空")
+	}
+	if strings.TrimSpace(event.ID) == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Data == nil {
+		event.Data = map[string]interface{}{}
+	}
+
+	var device models.Device
+	if err := db.Where("device_name = ?", event.DeviceID).First(&device).Error; err != nil {
+		// 未注册设备没有归属用户，无需投递
+		return 0, nil
+	}
+	var webhooks []models.Webhook
+	if err := db.Where("user_id = ? AND enabled = ? AND (agent_id = 0 OR agent_id = ?)", device.UserID, true, device.AgentID).
+		Find(&webhooks).Error; err != nil {
+		return 0, fmt.Errorf("查询回调失败: %v", err)
+	}
+	if len(webhooks) == 0 {
+		return 0, nil
+	}
+	if event.AgentID == "" && device.AgentID > 0 {
+		event.AgentID = strconv.FormatUint(uint64(device.AgentID), 10)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("序列化事件失败: %v", err)
+	}
+
+	queued := 0
+	for i := range webhooks {
+		if !webhookSubscribes(&webhooks[i], event.Type) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			WebhookID: webhooks[i].ID,
+			UserID:    webhooks[i].UserID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   string(payload),
+			Status:    webhookDeliveryPending,
+		}
+		// (webhook_id, event_id) 唯一索引冲突说明该事件已投递过，并发上报时同样只有一条写入成功
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery)
+		if result.Error != nil {
+			log.Printf("[Webhook] create delivery failed: webhook_id=%d event=%s err=%v", delivery.WebhookID, event.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := enqueueWebhookDelivery(db, delivery.ID); err != nil {
+			log.Printf("[Webhook] enqueue delivery failed: delivery_id=%d err=%v", delivery.ID, err)
+			continue
+		}
+		queued++
+	}
+	return queued, nil
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 回调投递：每条投递记录对应一个持久化队列任务，失败按队列的指数退避重试（10s、20s、40s ...），
+// 2xx 视为成功，除 408/429 外的 4xx 视为接收方拒绝，不再重试。
+const (
+	webhookJobType          = "webhook_delivery"
+	webhookDeliveryTimeout  = 15 * time.Second
+	webhookMaxAttempts      = 6
+	webhookResponseMaxBytes = 64 << 10
+	webhookRetention        = 7 * 24 * time.Hour
+	webhookCleanupInterval  = time.Hour
+
+	webhookDeliveryPending   = "pending"
+	webhookDeliveryRetrying  = "retrying"
+	webhookDeliverySucceeded = "succeeded"
+	webhookDeliveryFailed    = "failed"
+
+	webhookSignatureHeader = "X-Xiaozhi-Signature"
+	webhookTimestampHeader = "X-Xiaozhi-Timestamp"
+	webhookEventHeader     = "X-Xiaozhi-Event"
+	webhookDeliveryHeader  = "X-Xiaozhi-Delivery"
+)
+
+var (
+	webhookHTTPClient   = newWebhookHTTPClient()
+	webhookWorkerOnce   sync.Once
+	errWebhookNotExists = errors.New("回调不存在或已停用")
+)
+
+// webhookJobPayload 回调投递任务在持久化队列中的参数
+type webhookJobPayload struct {
+	DeliveryID uint `json:"delivery_id"`
+}
+
+// startWebhookWorkers 注册投递任务处理函数并启动过期投递记录清理
+func startWebhookWorkers(db *gorm.DB) {
+	if db == nil {
+		return
+	}
+	webhookWorkerOnce.Do(func() {
+		StartJobWorkers(db)
+		registerJobHandler(webhookJobType, jobHandlerSpec{
+			handler:     handleWebhookJob,
+			timeout:     webhookDeliveryTimeout + 5*time.Second,
+			maxAttempts: webhookMaxAttempts,
+			workers:     3,
+		})
+		go runWebhookCleanup(db)
+	})
+}
+
+// signWebhookPayload 签名为 hex(HMAC-SHA256(secret, "<timestamp>.<body>"))，接收方用相同方式校验并检查时间戳防重放
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookAttemptResult struct {
+	StatusCode int    `json:"status_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	retryable  bool
+}
+
+// sendWebhook 执行一次 HTTP 投递
+func sendWebhook(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) webhookAttemptResult {
+	start := time.Now()
+	body := []byte(delivery.Payload)
+	timestamp := start.Unix()
+	result := webhookAttemptResult{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = fmt.Sprintf("构建请求失败: %v", err)
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xiaozhi-webhook/1.0")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(webhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		// 目标地址被拒绝时重试也不会成功
+		result.retryable = !errors.Is(err, errWebhookForbiddenAddr)
+		return result
+	}
+	defer resp.Body.Close()
+	// 响应内容不保存也不返回，只读取有限长度以便复用连接
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseMaxBytes))
+	result.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		result.retryable = true
+	default:
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return result
+}
+
+// recordWebhookAttempt 回写一次投递结果；final 表示不会再重试
+func recordWebhookAttempt(db *gorm.DB, deliveryID uint, result webhookAttemptResult, final bool) error {
+	updates := map[string]interface{}{
+		"attempts":      gorm.Expr("attempts + ?", 1),
+		"response_code": result.StatusCode,
+		"last_error":    truncateForLog(result.Error, jobLastErrorMaxLength),
+		"duration_ms":   result.DurationMs,
+	}
+	switch {
+	case result.Error == "":
+		now := time.Now()
+		updates["status"] = webhookDeliverySucceeded
+		updates["delivered_at"] = now
+	case final:
+		updates["status"] = webhookDeliveryFailed
+	default:
+		updates["status"] = webhookDeliveryRetrying
+	}
+	return db.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryID).Updates(updates).Error
+}
+
+func handleWebhookJob(ctx context.Context, db *gorm.DB, job *models.Job) error {
+	var payload webhookJobPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return permanentJobErr(err)
+	}
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, payload.DeliveryID).Error; err != nil {
+		return permanentJobErr(fmt.Errorf("投递记录不存在: %d", payload.DeliveryID))
+	}
+	if delivery.Status == webhookDeliverySucceeded {
+		return nil
+	}
+	var webhook models.Webhook
+	if err := db.Where("id = ? AND enabled = ?", delivery.WebhookID, true).First(&webhook).Error; err != nil {
+		db.Model(&delivery).Updates(map[string]interface{}{"status": webhookDeliveryFailed, "last_error": errWebhookNotExists.Error()})
+		return permanentJobErr(errWebhookNotExists)
+	}
+
+	result := sendWebhook(ctx, &webhook, &delivery)
+	final := !result.retryable || job.Attempts >= job.MaxAttempts
+	if err := recordWebhookAttempt(db, delivery.ID, result, final); err != nil {
+		log.Printf("[Webhook] delivery_id=%d record result failed: %v", delivery.ID, err)
+	}
+	if result.Error == "" {
+		return nil
+	}
+	err := fmt.Errorf("投递到 %s 失败: %s", webhook.URL, result.Error)
+	if !result.retryable {
+		return permanentJobErr(err)
+	}
+	return err
+}
+
+// enqueueWebhookDelivery 为投递记录创建队列任务
+func enqueueWebhookDelivery(db *gorm.DB, deliveryID uint) error {
+	_, err := enqueueJob(db, webhookJobType, fmt.Sprintf("%s:%d", webhookJobType, deliveryID), webhookJobPayload{DeliveryID: deliveryID})
+	return err
+}
+
+// runWebhookCleanup 定期清理过期的投递记录及对应的已结束任务，避免消息事件持续累积
+func runWebhookCleanup(db *gorm.DB) {
+	ticker := time.NewTicker(webhookCleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cleanupWebhookDeliveries(db, time.Now().Add(-webhookRetention))
+	}
+}
+
+func cleanupWebhookDeliveries(db *gorm.DB, before time.Time) {
+	result := db.Where("created_at < ? AND status IN ?", before, []string{webhookDeliverySucceeded, webhookDeliveryFailed}).
+		Delete(&models.WebhookDelivery{})
+	if result.Error != nil {
+		log.Printf("[Webhook] cleanup deliveries failed: %v", result.Error)
+		return
+	}
+	if err := db.Where("job_type = ? AND status IN ? AND finished_at < ?", webhookJobType, []string{jobStatusSucceeded, jobStatusFailed, jobStatusCancelled}, before).
+		Delete(&models.Job{}).Error; err != nil {
+		log.Printf("[Webhook] cleanup jobs failed: %v", err)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[Webhook] cleaned up %d expired deliveries", result.RowsAffected)
+	}
+}
+
+// webhookSubscribes 判断回调是否订阅了该事件类型（未配置时订阅全部，测试事件总是投递）
+func webhookSubscribes(webhook *models.Webhook, eventType string) bool {
+	if eventType == webhookEventTest {
+		return true
+	}
+	events := strings.TrimSpace(webhook.Events)
+	if events == "" {
+		return true
+	}
+	for _, item := range strings.Split(events, ",") {
+		if strings.TrimSpace(item) == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// 回调地址由用户填写，投递前在建立连接时检查实际连接的 IP，拒绝本机、内网、链路本地（含云厂商元数据地址）等地址。
+// 在连接阶段检查而不是只校验 URL，可以覆盖域名解析到内网以及 DNS rebinding 的情况。
+var errWebhookForbiddenAddr = errors.New("回调地址不能指向本机、内网或元数据服务地址")
+
+// webhookForbiddenPrefixes IsPrivate/IsLoopback 等之外需要额外拒绝的网段
+var webhookForbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT，阿里云元数据 100.100.100.200 在此网段
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 可映射到任意 IPv4
+}
+
+func isForbiddenWebhookAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range webhookForbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDialControl 在 connect 之前检查解析后的目标地址
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || isForbiddenWebhookAddr(addr) {
+		return errWebhookForbiddenAddr
+	}
+	return nil
+}
+
+// newWebhookHTTPClient 投递用的 HTTP 客户端：每次连接（包括重定向后的连接）都经过地址检查；
+// 不走环境变量代理，否则检查的只是代理地址
+func newWebhookHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookDialControl,
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Timeout: webhookDeliveryTimeout, Transport: transport}
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newWebhookTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Device{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.Job{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := signWebhookPayload("secret", 1700000000, []byte(`{"a":1}`))
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	if want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"; got != want {
+		t.Fatalf("signWebhookPayload() = %s, want %s", got, want)
+	}
+}
+
+func TestNormalizeWebhookInput(t *testing.T) {
+	if _, err := normalizeWebhookURL("ftp://example.com/hook"); err == nil {
+		t.Fatalf("ftp url should be rejected")
+	}
+	if _, err := normalizeWebhookURL("/relative"); err == nil {
+		t.Fatalf("relative url should be rejected")
+	}
+	for _, raw := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://[::ffff:192.168.1.1]/hook", "http://100.100.100.200/"} {
+		if _, err := normalizeWebhookURL(raw); !errors.Is(err, errWebhookForbiddenAddr) {
+			t.Fatalf("normalizeWebhookURL(%q) err = %v, want forbidden", raw, err)
+		}
+	}
+	if got, err := normalizeWebhookURL(" https://example.com/hook "); err != nil || got != "https://example.com/hook" {
+		t.Fatalf("normalizeWebhookURL() = %q, %v", got, err)
+	}
+	events, err := normalizeWebhookEvents([]string{"message.user", " tool.call", "message.user", ""})
+	if err != nil || events != "message.user,tool.call" {
+		t.Fatalf("normalizeWebhookEvents() = %q, %v", events, err)
+	}
+	if _, err := normalizeWebhookEvents([]string{"unknown"}); err == nil {
+		t.Fatalf("unknown event type should be rejected")
+	}
+}
+
+func TestDispatchWebhookEvent(t *testing.T) {
+	db := newWebhookTestDB(t)
+	db.Create(&models.Device{UserID: 1, AgentID: 7, DeviceName: "aa:bb"})
+	db.Create(&models.Webhook{UserID: 1, URL: "http://a", Secret: "s", Enabled: true})                                           // 全部事件
+	db.Create(&models.Webhook{UserID: 1, AgentID: 7, URL: "http://b", Secret: "s", Events: "tool.call", Enabled: true})          // 仅工具调用
+	db.Create(&models.Webhook{UserID: 1, AgentID: 8, URL: "http://c", Secret: "s", Enabled: true})                               // 其他智能体
+	db.Create(&models.Webhook{UserID: 2, URL: "http://d", Secret: "s", Enabled: true})                                           // 其他用户
+	db.Model(&models.Webhook{}).Create(map[string]interface{}{"user_id": 1, "url": "http://e", "secret": "s", "enabled": false}) // 已停用
+
+	event := &webhookEvent{ID: "evt-1", Type: webhookEventMessageUser, DeviceID: "aa:bb"}
+	queued, err := dispatchWebhookEvent(db, event)
+	if err != nil || queued != 1 {
+		t.Fatalf("dispatch message = %d, %v; want 1", queued, err)
+	}
+	if event.AgentID != "7" {
+		t.Fatalf("agent_id should be filled from device, got %q", event.AgentID)
+	}
+	// 相同事件重复上报不重复投递
+	if queued, _ := dispatchWebhookEvent(db, &webhookEvent{ID: "evt-1", Type: webhookEventMessageUser, DeviceID: "aa:bb"}); queued != 0 {
+		t.Fatalf("duplicate event should not be queued again, got %d", queued)
+	}
+	if queued, _ := dispatchWebhookEvent(db, &webhookEvent{ID: "evt-2", Type: webhookEventToolCall, DeviceID: "aa:bb"}); queued != 2 {
+		t.Fatalf("tool call should be queued for 2 webhooks, got %d", queued)
+	}
+	if queued, _ := dispatchWebhookEvent(db, &webhookEvent{ID: "evt-3", Type: webhookEventToolCall, DeviceID: "unknown"}); queued != 0 {
+		t.Fatalf("unknown device should not be queued, got %d", queued)
+	}
+
+	var jobs int64
+	db.Model(&models.Job{}).Where("job_type = ?", webhookJobType).Count(&jobs)
+	if jobs != 3 {
+		t.Fatalf("jobs = %d, want 3", jobs)
+	}
+
+	// 并发重复上报同一事件只写入一条投递记录
+	var wg sync.WaitGroup
+	var total atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, _ := dispatchWebhookEvent(db, &webhookEvent{ID: "evt-4", Type: webhookEventSessionEnd, DeviceID: "aa:bb"})
+			total.Add(int32(n))
+		}()
+	}
+	wg.Wait()
+	var deliveries int64
+	db.Model(&models.WebhookDelivery{}).Where("event_id = ?", "evt-4").Count(&deliveries)
+	if total.Load() != 1 || deliveries != 1 {
+		t.Fatalf("concurrent dispatch queued=%d deliveries=%d, want 1", total.Load(), deliveries)
+	}
+}
+
+// 投递时拒绝连接本机地址，且不再重试
+func TestSendWebhookRejectsLoopback(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	webhook := &models.Webhook{URL: server.URL, Secret: "s"}
+	result := sendWebhook(context.Background(), webhook, &models.WebhookDelivery{Payload: "{}"})
+	if called || result.retryable || result.Error == "" {
+		t.Fatalf("loopback delivery should be rejected: called=%v result=%+v", called, result)
+	}
+}
+
+func TestCleanupWebhookDeliveries(t *testing.T) {
+	db := newWebhookTestDB(t)
+	old := time.Now().Add(-2 * webhookRetention)
+	db.Create(&models.WebhookDelivery{WebhookID: 1, UserID: 1, EventID: "old", EventType: webhookEventSessionEnd, Status: webhookDeliverySucceeded, CreatedAt: old})
+	db.Create(&models.WebhookDelivery{WebhookID: 1, UserID: 1, EventID: "new", EventType: webhookEventSessionEnd, Status: webhookDeliverySucceeded})
+	db.Create(&models.Job{JobType: webhookJobType, Status: jobStatusSucceeded, FinishedAt: &old, NextRunAt: old})
+
+	cleanupWebhookDeliveries(db, time.Now().Add(-webhookRetention))
+	var deliveries, jobs int64
+	db.Model(&models.WebhookDelivery{}).Count(&deliveries)
+	db.Model(&models.Job{}).Count(&jobs)
+	if deliveries != 1 || jobs != 0 {
+		t.Fatalf("after cleanup deliveries=%d jobs=%d, want 1 and 0", deliveries, jobs)
+	}
+}
+
+func TestHandleWebhookJob(t *testing.T) {
+	db := newWebhookTestDB(t)
+	status := http.StatusInternalServerError
+	var gotSignature, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhookTimestampHeader), 10, 64)
+		if r.Header.Get(webhookSignatureHeader) == signWebhookPayload("whsec_test", ts, body) {
+			gotSignature = "ok"
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	// httptest 监听在本机，测试中绕过地址检查
+	guarded := webhookHTTPClient
+	webhookHTTPClient = server.Client()
+	defer func() { webhookHTTPClient = guarded }()
+
+	webhook := models.Webhook{UserID: 1, URL: server.URL, Secret: "whsec_test", Enabled: true}
+	db.Create(&webhook)
+	delivery := models.WebhookDelivery{WebhookID: webhook.ID, UserID: 1, EventID: "evt", EventType: webhookEventSessionEnd, Payload: `{"id":"evt"}`, Status: webhookDeliveryPending}
+	db.Create(&delivery)
+	job := &models.Job{Payload: `{"delivery_id":` + strconv.Itoa(int(delivery.ID)) + `}`, Attempts: 1, MaxAttempts: 3}
+
+	// 5xx 可重试
+	err := handleWebhookJob(context.Background(), db, job)
+	var permanent *permanentJobError
+	if err == nil || errors.As(err, &permanent) {
+		t.Fatalf("5xx should be retryable, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != webhookDeliveryRetrying || delivery.ResponseCode != 500 || delivery.Attempts != 1 {
+		t.Fatalf("unexpected delivery after 5xx: %+v", delivery)
+	}
+	if gotSignature != "ok" || gotBody != `{"id":"evt"}` {
+		t.Fatalf("signature=%q body=%q", gotSignature, gotBody)
+	}
+
+	// 4xx 不再重试
+	status = http.StatusBadRequest
+	job.Attempts = 2
+	if err := handleWebhookJob(context.Background(), db, job); !errors.As(err, &permanent) {
+		t.Fatalf("4xx should be permanent, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != webhookDeliveryFailed {
+		t.Fatalf("4xx should mark failed, got %s", delivery.Status)
+	}
+
+	// 成功
+	status = http.StatusNoContent
+	db.Model(&delivery).Update("status", webhookDeliveryPending)
+	if err := handleWebhookJob(context.Background(), db, job); err != nil {
+		t.Fatalf("2xx should succeed, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != webhookDeliverySucceeded || delivery.DeliveredAt == nil || delivery.Attempts != 3 {
+		t.Fatalf("unexpected delivery after success: %+v", delivery)
+	}
+}
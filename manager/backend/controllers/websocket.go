@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -60,6 +61,38 @@ type MCPTool struct {
 	InputSchema map[string]interface{} `json:"input_schema,omitempty"`
 }
 
+// MCPResource 主程序上报的 MCP 资源（全局服务器与智能体接入点）
+type MCPResource struct {
+	Source      string `json:"source"`
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mime_type,omitempty"`
+}
+
+// MCPPrompt 主程序上报的 MCP 提示词模板
+type MCPPrompt struct {
+	Source      string `json:"source"`
+	Server      string `json:"server"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Arguments   []struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Required    bool   `json:"required,omitempty"`
+	} `json:"arguments,omitempty"`
+}
+
+// MQTTNodeClients 主程序上报的内置MQTT服务器节点及其客户端
+type MQTTNodeClients struct {
+	ServerUUID string                   `json:"server_uuid"`
+	Node       string                   `json:"node"`
+	Running    bool                     `json:"running"`
+	Clients    []map[string]interface{} `json:"clients"`
+	Error      string                   `json:"error,omitempty"`
+}
+
 const (
 	defaultBroadcastRequestTimeout = 30 * time.Second
 	openClawChatDefaultTimeoutMs   = 10 * 60 * 1000
@@ -331,6 +364,10 @@ func (client *WebSocketClient) processRequest(request *WebSocketRequest) {
 	case "/api/device/inactive":
 		client.handleDeviceInactiveRequest(request)
 
+	case "/api/mcp/oauth/token":
+		// 可能需要先向授权服务器刷新令牌，不阻塞读循环
+		go client.handleMCPOAuthTokenRequest(request)
+
 	default:
 		log.Printf("未知的请求路径: %s", request.Path)
 		client.sendResponse(request.ID, 404, nil, "Unknown endpoint")
@@ -579,6 +616,61 @@ func mapToStruct(data map[string]interface{}, target interface{}) error {
 	return json.Unmarshal(jsonData, target)
 }
 
+// PushMCPOAuthToken 把智能体的MCP访问令牌推送给所有主程序实例，accessToken 为空表示撤销授权
+func (ctrl *WebSocketController) PushMCPOAuthToken(agentID uint, server, accessToken string, expiresAt *time.Time) {
+	body := mcpOAuthTokenBody(agentID, server, accessToken, expiresAt)
+	for item := range ctrl.clientsMap.IterBuffered() {
+		client := item.Val
+		if !client.isConnected {
+			continue
+		}
+		go func(client *WebSocketClient) {
+			ctx, cancel := context.WithTimeout(context.Background(), mcpOAuthPushTimeout)
+			defer cancel()
+			if _, err := client.SendRequestWithResponse(ctx, "POST", "/api/mcp/oauth/token", body); err != nil {
+				log.Printf("向客户端 %s 推送MCP访问令牌失败: %v", client.ID, err)
+			}
+		}(client)
+	}
+}
+
+// RequestMqttClientsFromAll 向所有主程序实例请求内置MQTT服务器的客户端列表，每个实例对应一个节点
+func (ctrl *WebSocketController) RequestMqttClientsFromAll(ctx context.Context) []MQTTNodeClients {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		nodes = make([]MQTTNodeClients, 0)
+	)
+	for item := range ctrl.clientsMap.IterBuffered() {
+		client := item.Val
+		if !client.isConnected {
+			continue
+		}
+		wg.Add(1)
+		go func(client *WebSocketClient) {
+			defer wg.Done()
+			node := MQTTNodeClients{ServerUUID: client.ID, Clients: []map[string]interface{}{}}
+			response, err := client.SendRequestWithResponse(ctx, "GET", "/api/mqtt/clients", nil)
+			if err == nil && response.Status != http.StatusOK {
+				err = fmt.Errorf("%s", response.Error)
+			}
+			if err == nil {
+				result, _ := response.Body["result"].(string)
+				err = json.Unmarshal([]byte(result), &node)
+			}
+			if err != nil {
+				node.Error = err.Error()
+			}
+			mu.Lock()
+			nodes = append(nodes, node)
+			mu.Unlock()
+		}(client)
+	}
+	wg.Wait()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ServerUUID < nodes[j].ServerUUID })
+	return nodes
+}
+
 // 向指定UUID的客户端发送请求并等待响应
 func (ctrl *WebSocketController) SendRequestToClient(ctx context.Context, uuid string, method, path string, body map[string]interface{}) (*WebSocketResponse, error) {
 	if client, exists := ctrl.clientsMap.Get(uuid); exists && client.isConnected {
@@ -694,6 +786,58 @@ func (ctrl *WebSocketController) CallMcpToolFromClient(ctx context.Context, body
 	return response.Body, nil
 }
 
+// RequestMcpResourcesFromClient 请求客户端返回智能体可挂载的MCP资源
+func (ctrl *WebSocketController) RequestMcpResourcesFromClient(ctx context.Context, agentID string) ([]MCPResource, error) {
+	response, err := ctrl.broadcastRequestAndWaitFirstSuccess(ctx, "GET", "/api/mcp/resources", map[string]interface{}{"agent_id": agentID})
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]MCPResource, 0)
+	if err := decodeResponseField(response, "resources", &resources); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// RequestMcpPromptsFromClient 请求客户端返回智能体可选用的MCP提示词模板
+func (ctrl *WebSocketController) RequestMcpPromptsFromClient(ctx context.Context, agentID string) ([]MCPPrompt, error) {
+	response, err := ctrl.broadcastRequestAndWaitFirstSuccess(ctx, "GET", "/api/mcp/prompts", map[string]interface{}{"agent_id": agentID})
+	if err != nil {
+		return nil, err
+	}
+	prompts := make([]MCPPrompt, 0)
+	if err := decodeResponseField(response, "prompts", &prompts); err != nil {
+		return nil, err
+	}
+	return prompts, nil
+}
+
+// RenderMcpPromptFromClient 请求客户端渲染MCP提示词模板，返回文本
+func (ctrl *WebSocketController) RenderMcpPromptFromClient(ctx context.Context, body map[string]interface{}) (string, error) {
+	response, err := ctrl.broadcastRequestAndWaitFirstSuccess(ctx, "POST", "/api/mcp/prompt", body)
+	if err != nil {
+		return "", err
+	}
+	text, _ := response.Body["text"].(string)
+	return text, nil
+}
+
+// decodeResponseField 把响应体中的字段解码到目标结构，字段不存在时保持目标不变
+func decodeResponseField(response *WebSocketResponse, field string, out interface{}) error {
+	if response == nil || response.Body == nil {
+		return nil
+	}
+	value, ok := response.Body[field]
+	if !ok || value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
 // RequestOpenClawStatusFromClient 请求客户端返回 OpenClaw 连接状态
 func (ctrl *WebSocketController) RequestOpenClawStatusFromClient(ctx context.Context, agentID string) (map[string]interface{}, error) {
 	body := map[string]interface{}{
@@ -61,6 +61,7 @@ func Init(cfg config.DatabaseConfig) *gorm.DB {
 		&models.KnowledgeBase{},
 		&models.KnowledgeBaseDocument{},
 		&models.AgentKnowledgeBase{},
+		&models.KnowledgeChunk{},
 		&models.Config{},
 		&models.MCPMarketService{},
 		&models.GlobalRole{},
@@ -72,6 +73,11 @@ func Init(cfg config.DatabaseConfig) *gorm.DB {
 		&models.VoiceCloneAudio{},
 		&models.VoiceCloneTask{},
 		&models.UserVoiceCloneQuota{},
+		&models.Job{},
+		&models.Reminder{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.MCPOAuthCredential{},
 	)
 	if err != nil {
 		log.Printf("数据库表结构迁移失败: %v", err)
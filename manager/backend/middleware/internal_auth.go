@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InternalTokenHeader 主程序调用内部接口时携带共享令牌的请求头
+const InternalTokenHeader = "X-Internal-Token"
+
+// InternalTokenAuth 校验内部接口的调用方。
+// 配置了 token 时要求请求头 X-Internal-Token 与之一致；未配置时只接受本机（回环地址）发起的请求。
+// 来源地址取 TCP 连接的对端地址，不信任 X-Forwarded-For 等可伪造的请求头。
+func InternalTokenAuth(token string) gin.HandlerFunc {
+	token = strings.TrimSpace(token)
+	return func(c *gin.Context) {
+		if token != "" {
+			provided := strings.TrimSpace(c.GetHeader(InternalTokenHeader))
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "内部接口令牌无效"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !isLoopbackRemote(c.Request.RemoteAddr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "未配置内部接口令牌，仅允许本机调用"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func isLoopbackRemote(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return addr.Unmap().IsLoopback()
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternalTokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name       string
+		token      string
+		remoteAddr string
+		header     map[string]string
+		want       int
+	}{
+		{"令牌正确", "secret", "203.0.113.5:5000", map[string]string{InternalTokenHeader: "secret"}, http.StatusOK},
+		{"令牌错误", "secret", "127.0.0.1:5000", map[string]string{InternalTokenHeader: "wrong"}, http.StatusUnauthorized},
+		{"缺少令牌时本机也要校验", "secret", "127.0.0.1:5000", nil, http.StatusUnauthorized},
+		{"未配置令牌时接受本机", "", "127.0.0.1:5000", nil, http.StatusOK},
+		{"未配置令牌时接受IPv6本机", "", "[::1]:5000", nil, http.StatusOK},
+		{"未配置令牌时拒绝远程", "", "203.0.113.5:5000", nil, http.StatusForbidden},
+		{"不信任X-Forwarded-For", "", "203.0.113.5:5000", map[string]string{"X-Forwarded-For": "127.0.0.1"}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/internal", InternalTokenAuth(tc.token), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodPost, "/internal", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
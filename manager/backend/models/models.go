@@ -60,6 +60,17 @@ type Agent struct {
 	ASRSpeed        string  `json:"asr_speed" gorm:"type:varchar(20);default:'normal'"`  // 语音识别速度: normal/patient/fast
 	MemoryMode      string  `json:"memory_mode" gorm:"type:varchar(20);default:'short'"` // 记忆模式: none/short/long
 	MCPServiceNames string  `json:"mcp_service_names" gorm:"type:text"`                  // 逗号分隔的MCP服务名，空=使用全部已启用全局MCP服务
+	Language        string  `json:"language" gorm:"type:varchar(20);default:'zh'"`       // 对话语言: zh/yue/en/ja/ko/auto（auto=按语音识别结果自动切换）
+	// 各语言对应的TTS音色，JSON字符串，结构：{"en":"voice_id","ja":"voice_id"}
+	LanguageVoicesConfig string `json:"language_voices_config" gorm:"type:text"`
+	// TTS发音词典，每行 "原词=读法"，合成前替换，不影响字幕与对话历史
+	PronunciationDict string `json:"pronunciation_dict" gorm:"type:text"`
+	// 备用TTS配置ID，逗号分隔，按顺序在主TTS不可用时接替合成（使用各配置的默认音色）
+	TTSFallbackConfigIDs string `json:"tts_fallback_config_ids" gorm:"type:text"`
+	// 工具调用策略，JSON字符串，结构：{"unlock_door":"confirm","format_*":"deny"}，未配置的工具为 allow
+	ToolPoliciesConfig string `json:"tool_policies_config" gorm:"type:text"`
+	// 挂载的MCP资源，JSON字符串，结构：[{"source":"global","server":"docs","uri":"file:///rules.md","name":"家规"}]
+	MCPResourcesConfig string `json:"mcp_resources_config" gorm:"type:text"`
 	// OpenClaw 配置，JSON字符串，结构：
 	// {"allowed":true,"enter_keywords":["进入openclaw"],"exit_keywords":["退出openclaw"]}
 	OpenClawConfig string    `json:"openclaw_config" gorm:"type:text"`
@@ -102,6 +113,21 @@ type KnowledgeBaseDocument struct {
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
+// KnowledgeChunk 内置(local)知识库 provider 的文档分块与向量
+type KnowledgeChunk struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	KnowledgeBaseID uint      `json:"knowledge_base_id" gorm:"not null;index"`
+	DocumentID      uint      `json:"document_id" gorm:"not null;default:0;index"` // 0 表示知识库正文
+	ChunkIndex      int       `json:"chunk_index" gorm:"not null;default:0"`
+	Content         string    `json:"content" gorm:"type:text"`
+	Terms           string    `json:"-" gorm:"type:text"` // BM25 分词结果（空格分隔）
+	TermCount       int       `json:"term_count" gorm:"not null;default:0"`
+	Embedding       string    `json:"-" gorm:"type:mediumtext"` // base64(float32 little-endian)
+	EmbeddingModel  string    `json:"embedding_model" gorm:"type:varchar(100)"`
+	EmbeddingDim    int       `json:"embedding_dim" gorm:"not null;default:0"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
 // AgentKnowledgeBase 智能体与知识库的多对多关联
 type AgentKnowledgeBase struct {
 	ID              uint      `json:"id" gorm:"primarykey"`
@@ -134,6 +160,7 @@ type MCPMarketService struct {
 	URL         string `json:"url" gorm:"type:text;not null"`
 	URLHash     string `json:"url_hash" gorm:"type:char(64);not null;uniqueIndex:idx_mcp_market_services_url_hash"` // sha256(url) hex
 	HeadersJSON string `json:"headers_json" gorm:"type:text"`
+	Auth        string `json:"auth" gorm:"type:varchar(20)"` // oauth: 需要用户为智能体授权后按智能体连接
 
 	MarketID    *uint  `json:"market_id" gorm:"index"` // 关联 configs(type=mcp_market).id
 	ProviderID  string `json:"provider_id" gorm:"type:varchar(50);index"`
@@ -276,6 +303,78 @@ type UserVoiceCloneQuota struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// Job 持久化后台任务（知识库同步、声音复刻等），由 manager 内的任务队列按租约领取执行
+type Job struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	JobType     string     `json:"job_type" gorm:"type:varchar(50);not null;index"`
+	DedupeKey   string     `json:"dedupe_key" gorm:"type:varchar(191);index"`                                               // 相同key的排队任务只保留一条
+	Payload     string     `json:"payload" gorm:"type:text"`                                                                // JSON 任务参数
+	Status      string     `json:"status" gorm:"type:varchar(20);not null;default:'queued';index:idx_jobs_status_next_run"` // queued/running/succeeded/failed/cancelled
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int        `json:"max_attempts" gorm:"not null;default:5"`
+	NextRunAt   time.Time  `json:"next_run_at" gorm:"index:idx_jobs_status_next_run"`
+	LeaseOwner  string     `json:"lease_owner" gorm:"type:varchar(100)"`
+	LeaseUntil  *time.Time `json:"lease_until" gorm:"index"`
+	LastError   string     `json:"last_error" gorm:"type:text"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Reminder 设备定时提醒：一次性或 cron 周期，到期后由主程序注入设备主动播报；设备离线时保持待投递，上线后补发
+type Reminder struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	DeviceID        string     `json:"device_id" gorm:"type:varchar(100);not null;index:idx_reminders_device_status"` // 设备名（MAC）
+	Message         string     `json:"message" gorm:"type:text;not null"`                                             // 播报内容（skip_llm=false 时作为用户输入交给 LLM）
+	SkipLlm         bool       `json:"skip_llm" gorm:"not null;default:false"`                                        // true 时直接 TTS 播报
+	ScheduleType    string     `json:"schedule_type" gorm:"type:varchar(20);not null;default:'once'"`                 // once/cron
+	CronExpr        string     `json:"cron_expr" gorm:"type:varchar(100)"`                                            // 5段 cron 表达式：分 时 日 月 周
+	Timezone        string     `json:"timezone" gorm:"type:varchar(64)"`
+	NextRunAt       time.Time  `json:"next_run_at" gorm:"index"`
+	Status          string     `json:"status" gorm:"type:varchar(20);not null;default:'pending';index:idx_reminders_device_status"` // pending/paused/delivered/cancelled
+	Source          string     `json:"source" gorm:"type:varchar(20)"`                                                              // mcp/ui/openapi
+	DeliveryCount   int        `json:"delivery_count" gorm:"not null;default:0"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at"`
+	LeaseOwner      string     `json:"-" gorm:"type:varchar(100)"`
+	LeaseUntil      *time.Time `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Webhook 出站回调：设备上下线、会话、消息、工具调用等事件以 HMAC 签名的 JSON POST 推送到配置的地址
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	AgentID   uint      `json:"agent_id" gorm:"not null;default:0;index"` // 0 表示该用户下所有智能体
+	Name      string    `json:"name" gorm:"type:varchar(100)"`
+	URL       string    `json:"url" gorm:"type:varchar(500);not null"`
+	Secret    string    `json:"secret" gorm:"type:varchar(100);not null"` // HMAC-SHA256 签名密钥
+	Events    string    `json:"events" gorm:"type:text"`                  // 逗号分隔的订阅事件类型，空表示全部
+	Enabled   bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery 回调投递记录，每个事件对每个回调一条，重试时原地更新
+type WebhookDelivery struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	WebhookID    uint       `json:"webhook_id" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	EventID      string     `json:"event_id" gorm:"type:varchar(100);not null;uniqueIndex:idx_webhook_deliveries_event"` // 同一事件重复上报时只投递一次
+	EventType    string     `json:"event_type" gorm:"type:varchar(50);not null"`
+	Payload      string     `json:"payload" gorm:"type:text"`
+	Status       string     `json:"status" gorm:"type:varchar(20);not null;default:'pending'"` // pending/retrying/succeeded/failed
+	Attempts     int        `json:"attempts" gorm:"not null;default:0"`
+	ResponseCode int        `json:"response_code"`
+	LastError    string     `json:"last_error" gorm:"type:text"`
+	DurationMs   int64      `json:"duration_ms"`
+	DeliveredAt  *time.Time `json:"delivered_at"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
 // ChatMessage 聊天消息模型
 type ChatMessage struct {
 	ID        uint   `json:"id" gorm:"primarykey"`
@@ -334,3 +433,28 @@ func (m *ChatMessage) AfterFind(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// MCPOAuthCredential 智能体对需要 OAuth 授权的 MCP 服务器的授权凭证，令牌与客户端密钥加密存储
+type MCPOAuthCredential struct {
+	ID                uint       `json:"id" gorm:"primarykey"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	AgentID           uint       `json:"agent_id" gorm:"not null;uniqueIndex:idx_mcp_oauth_agent_server"`
+	ServerName        string     `json:"server_name" gorm:"type:varchar(150);not null;uniqueIndex:idx_mcp_oauth_agent_server"`
+	ServerURL         string     `json:"server_url" gorm:"type:text"`
+	Issuer            string     `json:"issuer" gorm:"type:varchar(255)"`
+	TokenEndpoint     string     `json:"-" gorm:"type:text"`
+	Resource          string     `json:"-" gorm:"type:text"` // RFC 8707 resource 参数
+	ClientID          string     `json:"-" gorm:"type:varchar(255)"`
+	ClientSecretEnc   string     `json:"-" gorm:"type:text"`
+	ClientSecretNonce string     `json:"-" gorm:"type:varchar(64)"`
+	AccessTokenEnc    string     `json:"-" gorm:"type:text"`
+	AccessTokenNonce  string     `json:"-" gorm:"type:varchar(64)"`
+	RefreshTokenEnc   string     `json:"-" gorm:"type:text"`
+	RefreshTokenNonce string     `json:"-" gorm:"type:varchar(64)"`
+	Scope             string     `json:"scope" gorm:"type:varchar(500)"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	Status            string     `json:"status" gorm:"type:varchar(20);not null;default:'active'"` // active/expired/error
+	LastError         string     `json:"last_error" gorm:"type:text"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
@@ -33,6 +33,10 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	speakerGroupController := controllers.NewSpeakerGroupController(db, cfg)
 	voiceCloneController := controllers.NewVoiceCloneController(db, cfg)
 	poolStatsController := controllers.NewPoolStatsController()
+	jobController := controllers.NewJobController(db)
+	reminderController := controllers.NewReminderController(db)
+	webhookController := controllers.NewWebhookController(db)
+	mcpOAuthController := controllers.NewMCPOAuthController(db, webSocketController, cfg)
 
 	// 初始化聊天历史控制器（使用传入的 cfg，不重新 Load 避免内嵌时读错路径）
 	audioBasePath := "./storage/chat_history/audio"
@@ -69,12 +73,23 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		api.GET("/configs", adminController.GetDeviceConfigs)
 		api.GET("/system/configs", adminController.GetSystemConfigs)
 		api.POST("/internal/history/messages", chatHistoryController.SaveMessage)                         // 保存消息（内部服务接口）
+		api.POST("/internal/history/messages/batch", chatHistoryController.SaveMessagesBatch)             // 批量保存消息/更新音频（内部服务接口）
 		api.PUT("/internal/history/messages/:message_id/audio", chatHistoryController.UpdateMessageAudio) // 更新消息音频（内部服务接口）
 		api.GET("/internal/history/messages", chatHistoryController.GetMessagesForInit)                   // 获取消息（用于初始化加载，内部服务接口）
 		api.POST("/internal/pool/stats", poolStatsController.ReportPoolStats)                             // 上报资源池统计数据（内部服务接口）
+		api.POST("/internal/knowledge/search", adminController.SearchLocalKnowledgeInternal)              // 本地知识库检索（内部服务接口）
+		api.POST("/internal/reminders", reminderController.CreateReminderInternal)                        // 创建设备提醒（内部服务接口）
+		api.GET("/internal/reminders", reminderController.GetRemindersInternal)                           // 查询设备待执行提醒（内部服务接口）
+		api.POST("/internal/reminders/claim", reminderController.ClaimDueRemindersInternal)               // 领取在线设备的到期提醒（内部服务接口）
+		api.POST("/internal/reminders/:id/ack", reminderController.AckReminderInternal)                   // 回执提醒投递结果（内部服务接口）
+		api.POST("/internal/reminders/:id/cancel", reminderController.CancelReminderInternal)             // 取消设备提醒（内部服务接口）
+		api.GET("/mcp/oauth/callback", mcpOAuthController.OAuthCallback)                                  // MCP OAuth 授权回调（state 校验）
 		api.POST("/internal/devices/:device_name/switch-role", adminController.SwitchDeviceRoleByNameInternal)
 		api.POST("/internal/devices/:device_name/restore-default-role", adminController.RestoreDeviceDefaultRoleInternal)
 
+		// 上报回调事件（内部服务接口）：manager 会据此签名投递到第三方地址，必须校验调用方
+		api.POST("/internal/webhooks/events", middleware.InternalTokenAuth(cfg.Webhook.InternalToken), webhookController.ReportWebhookEventInternal)
+
 		// 需要认证的路由
 		auth := api.Group("")
 		auth.Use(middleware.JWTAuth())
@@ -171,12 +186,32 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				user.POST("/agents/:id/openclaw-chat-test", userController.CallAgentOpenClawChatTest)
 				user.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
 				user.POST("/agents/:id/mcp-call", userController.CallAgentMcpTool)
+				user.GET("/agents/:id/mcp-context", userController.GetAgentMCPContext)
+				user.POST("/agents/:id/mcp-prompts/render", userController.RenderAgentMCPPrompt)
+				user.GET("/agents/:id/mcp-oauth", mcpOAuthController.GetAgentMCPOAuth)
+				user.POST("/agents/:id/mcp-oauth/:server/authorize", mcpOAuthController.AuthorizeAgentMCPOAuth)
+				user.DELETE("/agents/:id/mcp-oauth/:server", mcpOAuthController.RevokeAgentMCPOAuth)
 				user.GET("/devices/:id/mcp-tools", userController.GetDeviceMcpTools)
 				user.POST("/devices/:id/mcp-call", userController.CallDeviceMcpTool)
 
 				// 消息注入
 				user.POST("/devices/inject-message", userController.InjectMessage)
 
+				// 设备定时提醒
+				user.GET("/reminders", reminderController.GetReminders)
+				user.POST("/reminders", reminderController.CreateReminder)
+				user.PUT("/reminders/:id", reminderController.UpdateReminder)
+				user.DELETE("/reminders/:id", reminderController.DeleteReminder)
+
+				// 出站回调
+				user.GET("/webhooks", webhookController.GetWebhooks)
+				user.POST("/webhooks", webhookController.CreateWebhook)
+				user.PUT("/webhooks/:id", webhookController.UpdateWebhook)
+				user.DELETE("/webhooks/:id", webhookController.DeleteWebhook)
+				user.POST("/webhooks/:id/test", webhookController.TestWebhook)
+				user.GET("/webhooks/:id/deliveries", webhookController.GetWebhookDeliveries)
+				user.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", webhookController.RedeliverWebhook)
+
 				// 声纹组管理
 				user.POST("/speaker-groups", speakerGroupController.CreateSpeakerGroup)
 				user.GET("/speaker-groups", speakerGroupController.GetSpeakerGroups)
@@ -214,8 +249,23 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				openV1.GET("/history/messages", chatHistoryController.GetMessages)
 				openV1.GET("/history/export", chatHistoryController.ExportMessages)
 				openV1.POST("/devices/inject-message", userController.InjectMessage)
+				openV1.GET("/reminders", reminderController.GetReminders)
+				openV1.POST("/reminders", reminderController.CreateReminder)
+				openV1.PUT("/reminders/:id", reminderController.UpdateReminder)
+				openV1.DELETE("/reminders/:id", reminderController.DeleteReminder)
+				openV1.GET("/webhooks", webhookController.GetWebhooks)
+				openV1.POST("/webhooks", webhookController.CreateWebhook)
+				openV1.PUT("/webhooks/:id", webhookController.UpdateWebhook)
+				openV1.DELETE("/webhooks/:id", webhookController.DeleteWebhook)
+				openV1.POST("/webhooks/:id/test", webhookController.TestWebhook)
+				openV1.GET("/webhooks/:id/deliveries", webhookController.GetWebhookDeliveries)
 				openV1.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
 				openV1.POST("/agents/:id/mcp-call", userController.CallAgentMcpTool)
+				openV1.GET("/agents/:id/mcp-context", userController.GetAgentMCPContext)
+				openV1.POST("/agents/:id/mcp-prompts/render", userController.RenderAgentMCPPrompt)
+				openV1.GET("/agents/:id/mcp-oauth", mcpOAuthController.GetAgentMCPOAuth)
+				openV1.POST("/agents/:id/mcp-oauth/:server/authorize", mcpOAuthController.AuthorizeAgentMCPOAuth)
+				openV1.DELETE("/agents/:id/mcp-oauth/:server", mcpOAuthController.RevokeAgentMCPOAuth)
 			}
 
 			// 管理员路由
@@ -283,6 +333,7 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.POST("/mqtt-server-configs", adminController.CreateMQTTServerConfig)
 				admin.PUT("/mqtt-server-configs/:id", adminController.UpdateMQTTServerConfig)
 				admin.DELETE("/mqtt-server-configs/:id", adminController.DeleteMQTTServerConfig)
+				admin.GET("/mqtt/clients", adminController.GetMQTTClients)
 
 				admin.GET("/udp-configs", adminController.GetUDPConfigs)
 				admin.POST("/udp-configs", adminController.CreateUDPConfig)
@@ -353,6 +404,11 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				admin.POST("/agents/:id/openclaw-chat-test", adminController.CallAgentOpenClawChatTest)
 				admin.GET("/agents/:id/mcp-tools", adminController.GetAgentMcpTools)
 				admin.POST("/agents/:id/mcp-call", adminController.CallAgentMcpTool)
+				admin.GET("/agents/:id/mcp-context", adminController.GetAgentMCPContext)
+				admin.POST("/agents/:id/mcp-prompts/render", adminController.RenderAgentMCPPrompt)
+				admin.GET("/agents/:id/mcp-oauth", mcpOAuthController.AdminGetAgentMCPOAuth)
+				admin.POST("/agents/:id/mcp-oauth/:server/authorize", mcpOAuthController.AdminAuthorizeAgentMCPOAuth)
+				admin.DELETE("/agents/:id/mcp-oauth/:server", mcpOAuthController.AdminRevokeAgentMCPOAuth)
 				admin.GET("/devices/:id/mcp-tools", adminController.GetDeviceMcpTools)
 				admin.POST("/devices/:id/mcp-call", adminController.CallDeviceMcpTool)
 
@@ -380,6 +436,12 @@ func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				// 资源池统计
 				admin.GET("/pool/stats", poolStatsController.GetPoolStats)
 				admin.GET("/pool/stats/summary", poolStatsController.GetPoolStatsSummary)
+
+				// 后台任务队列（知识库同步、声音复刻）
+				admin.GET("/jobs", jobController.GetJobs)
+				admin.GET("/jobs/:id", jobController.GetJob)
+				admin.POST("/jobs/:id/retry", jobController.RetryJob)
+				admin.POST("/jobs/:id/cancel", jobController.CancelJob)
 			}
 		}
 	}
@@ -34,6 +34,12 @@ func loadSecretKey() ([]byte, error) {
 	return rawKey, nil
 }
 
+// CheckSecretKey 检查加密密钥是否已配置，需要加密存储敏感数据的功能在使用前调用
+func CheckSecretKey() error {
+	_, err := loadSecretKey()
+	return err
+}
+
 func EncryptText(plain string) (ciphertextB64, nonceB64 string, err error) {
 	if plain == "" {
 		return "", "", nil
@@ -0,0 +1,390 @@
+// Package mcp_oauth 实现 MCP 授权规范（OAuth 2.1）中客户端一侧的流程：
+// 受保护资源元数据（RFC 9728）与授权服务器元数据（RFC 8414）发现、动态客户端注册（RFC 7591）、
+// 授权码 + PKCE(S256)、资源指示（RFC 8707）以及刷新令牌。
+package mcp_oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	maxResponseBytes = 1 << 20
+	// expiresAtSkew 计算过期时间时提前量，避免令牌在传输途中过期
+	expiresAtSkew = 10 * time.Second
+)
+
+// Metadata 发现得到的授权信息
+type Metadata struct {
+	Resource              string   `json:"resource"` // 请求令牌时携带的 resource 参数
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	RegistrationEndpoint  string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+}
+
+// Client 在授权服务器上的客户端身份，ClientSecret 为空表示公共客户端
+type Client struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// Token 令牌端点返回的令牌
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	Scope        string
+	ExpiresAt    time.Time // 零值表示未声明过期时间
+}
+
+// Error 授权服务器返回的 OAuth 错误，invalid_grant 表示刷新令牌已失效，需要重新授权
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// IsInvalidGrant 授权已被撤销或刷新令牌过期
+func IsInvalidGrant(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == "invalid_grant"
+}
+
+type protectedResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported"`
+}
+
+// Discover 发现 MCP 服务器的授权服务器：先读取受保护资源元数据（优先使用 401 响应 WWW-Authenticate 中的
+// resource_metadata），再读取授权服务器元数据；服务器未提供元数据时按 2025-03-26 版规范回退到服务器源站的默认端点
+func Discover(ctx context.Context, httpClient *http.Client, serverURL string) (*Metadata, error) {
+	server, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || server.Scheme == "" || server.Host == "" {
+		return nil, fmt.Errorf("MCP服务器地址无效: %s", serverURL)
+	}
+	server.Fragment = ""
+	origin := server.Scheme + "://" + server.Host
+	path := strings.TrimSuffix(server.Path, "/")
+
+	candidates := make([]string, 0, 3)
+	if hinted := probeResourceMetadataURL(ctx, httpClient, server.String()); hinted != "" {
+		candidates = append(candidates, hinted)
+	}
+	if path != "" {
+		candidates = append(candidates, origin+"/.well-known/oauth-protected-resource"+path)
+	}
+	candidates = append(candidates, origin+"/.well-known/oauth-protected-resource")
+
+	var prm protectedResourceMetadata
+	found := false
+	for _, candidate := range candidates {
+		if err := getJSON(ctx, httpClient, candidate, &prm); err == nil && len(prm.AuthorizationServers) > 0 {
+			found = true
+			break
+		}
+	}
+
+	meta := &Metadata{Resource: server.String()}
+	issuer := origin
+	if found {
+		issuer = strings.TrimSuffix(prm.AuthorizationServers[0], "/")
+		if prm.Resource != "" {
+			meta.Resource = prm.Resource
+		}
+		meta.ScopesSupported = prm.ScopesSupported
+	}
+
+	as, err := fetchAuthorizationServerMetadata(ctx, httpClient, issuer)
+	if err != nil {
+		if found {
+			return nil, err
+		}
+		// 旧版服务器：授权服务器即 MCP 服务器源站，使用默认端点
+		meta.Issuer = origin
+		meta.AuthorizationEndpoint = origin + "/authorize"
+		meta.TokenEndpoint = origin + "/token"
+		meta.RegistrationEndpoint = origin + "/register"
+		return meta, nil
+	}
+	meta.Issuer = as.Issuer
+	if meta.Issuer == "" {
+		meta.Issuer = issuer
+	}
+	meta.AuthorizationEndpoint = as.AuthorizationEndpoint
+	meta.TokenEndpoint = as.TokenEndpoint
+	meta.RegistrationEndpoint = as.RegistrationEndpoint
+	if len(meta.ScopesSupported) == 0 {
+		meta.ScopesSupported = as.ScopesSupported
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+		return nil, fmt.Errorf("授权服务器 %s 的元数据缺少授权或令牌端点", issuer)
+	}
+	return meta, nil
+}
+
+// probeResourceMetadataURL 未携带令牌访问 MCP 服务器，从 401 响应的 WWW-Authenticate 中读取 resource_metadata
+func probeResourceMetadataURL(ctx context.Context, httpClient *http.Client, serverURL string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return ""
+	}
+	return authParam(resp.Header.Get("WWW-Authenticate"), "resource_metadata")
+}
+
+// authParam 从 WWW-Authenticate 中取参数值，如 Bearer resource_metadata="https://..."
+func authParam(header, name string) string {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if idx := strings.Index(part, " "); idx > 0 && !strings.Contains(part[:idx], "=") {
+			part = strings.TrimSpace(part[idx+1:]) // 去掉认证方案
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), name) {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return ""
+}
+
+// fetchAuthorizationServerMetadata 按 RFC 8414 与 OpenID Connect Discovery 的顺序尝试元数据地址
+func fetchAuthorizationServerMetadata(ctx context.Context, httpClient *http.Client, issuer string) (*Metadata, error) {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("授权服务器地址无效: %s", issuer)
+	}
+	origin := u.Scheme + "://" + u.Host
+	path := strings.TrimSuffix(u.Path, "/")
+
+	var candidates []string
+	if path != "" {
+		candidates = []string{
+			origin + "/.well-known/oauth-authorization-server" + path,
+			origin + "/.well-known/openid-configuration" + path,
+			origin + path + "/.well-known/openid-configuration",
+		}
+	} else {
+		candidates = []string{
+			origin + "/.well-known/oauth-authorization-server",
+			origin + "/.well-known/openid-configuration",
+		}
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		var meta Metadata
+		if err := getJSON(ctx, httpClient, candidate, &meta); err != nil {
+			lastErr = err
+			continue
+		}
+		return &meta, nil
+	}
+	return nil, fmt.Errorf("获取授权服务器 %s 元数据失败: %v", issuer, lastErr)
+}
+
+// Register 动态注册公共客户端，授权服务器不支持时需要在配置中提供客户端ID
+func Register(ctx context.Context, httpClient *http.Client, meta *Metadata, clientName, redirectURI string) (*Client, error) {
+	if meta.RegistrationEndpoint == "" {
+		return nil, fmt.Errorf("授权服务器不支持动态客户端注册，请在MCP服务器配置中填写 oauth.client_id")
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"client_name":                clientName,
+		"redirect_uris":              []string{redirectURI},
+		"grant_types":                []string{"authorization_code", "refresh_token"},
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.RegistrationEndpoint, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := doJSON(httpClient, req, &result); err != nil {
+		return nil, fmt.Errorf("动态注册客户端失败: %w", err)
+	}
+	if result.ClientID == "" {
+		return nil, fmt.Errorf("动态注册客户端失败: 响应缺少 client_id")
+	}
+	return &Client{ClientID: result.ClientID, ClientSecret: result.ClientSecret}, nil
+}
+
+// NewPKCE 生成 code_verifier 与 S256 code_challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString 返回 n 字节随机数的 base64url 编码，用于 state 与 code_verifier
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthorizationURL 构造用户浏览器跳转的授权地址
+func AuthorizationURL(meta *Metadata, client *Client, redirectURI, state, challenge, scope string) (string, error) {
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("授权端点无效: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", client.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	if scope != "" {
+		q.Set("scope", scope)
+	}
+	if meta.Resource != "" {
+		q.Set("resource", meta.Resource)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ExchangeCode 用授权码换取令牌
+func ExchangeCode(ctx context.Context, httpClient *http.Client, tokenEndpoint string, client *Client, code, verifier, redirectURI, resource string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	form.Set("redirect_uri", redirectURI)
+	return requestToken(ctx, httpClient, tokenEndpoint, client, form, resource)
+}
+
+// Refresh 使用刷新令牌获取新令牌，响应未返回新的刷新令牌时沿用原值
+func Refresh(ctx context.Context, httpClient *http.Client, tokenEndpoint string, client *Client, refreshToken, resource string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	token, err := requestToken(ctx, httpClient, tokenEndpoint, client, form, resource)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+func requestToken(ctx context.Context, httpClient *http.Client, tokenEndpoint string, client *Client, form url.Values, resource string) (*Token, error) {
+	form.Set("client_id", client.ClientID)
+	if client.ClientSecret != "" {
+		form.Set("client_secret", client.ClientSecret)
+	}
+	if resource != "" {
+		form.Set("resource", resource)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		AccessToken  string      `json:"access_token"`
+		RefreshToken string      `json:"refresh_token"`
+		TokenType    string      `json:"token_type"`
+		Scope        string      `json:"scope"`
+		ExpiresIn    json.Number `json:"expires_in"`
+	}
+	if err := doJSON(httpClient, req, &result); err != nil {
+		return nil, err
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("令牌响应缺少 access_token")
+	}
+	token := &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		Scope:        result.Scope,
+	}
+	if seconds, err := result.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(seconds)*time.Second - expiresAtSkew)
+	}
+	return token, nil
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, rawURL string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(httpClient, req, target)
+}
+
+// doJSON 发送请求并解析 JSON 响应，非 2xx 时返回 *Error
+func doJSON(httpClient *http.Client, req *http.Request, target interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var oauthErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &oauthErr)
+		return &Error{StatusCode: resp.StatusCode, Code: oauthErr.Error, Description: oauthErr.ErrorDescription}
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
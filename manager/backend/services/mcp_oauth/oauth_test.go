@@ -0,0 +1,142 @@
+package mcp_oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationFlow(t *testing.T) {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp", resource_metadata="`+srv.URL+`/meta/prm"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/meta/prm", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resource":              srv.URL + "/mcp",
+			"authorization_servers": []string{srv.URL + "/as"},
+			"scopes_supported":      []string{"repo"},
+		})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server/as", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 srv.URL + "/as",
+			"authorization_endpoint": srv.URL + "/as/authorize",
+			"token_endpoint":         srv.URL + "/as/token",
+			"registration_endpoint":  srv.URL + "/as/register",
+		})
+	})
+	mux.HandleFunc("/as/register", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if uris, _ := req["redirect_uris"].([]interface{}); len(uris) != 1 {
+			t.Errorf("unexpected registration: %v", req)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"client_id": "dyn-client"})
+	})
+	var verifier string
+	mux.HandleFunc("/as/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("resource") != srv.URL+"/mcp" || r.Form.Get("client_id") != "dyn-client" {
+			t.Errorf("unexpected token request: %v", r.Form)
+		}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if r.Form.Get("code") != "the-code" || r.Form.Get("code_verifier") != verifier {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at-1", "refresh_token": "rt-1", "expires_in": 3600, "token_type": "Bearer"})
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "rt-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "revoked"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at-2", "expires_in": "60"})
+		}
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	meta, err := Discover(ctx, srv.Client(), srv.URL+"/mcp")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if meta.TokenEndpoint != srv.URL+"/as/token" || meta.Resource != srv.URL+"/mcp" || len(meta.ScopesSupported) != 1 {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+
+	client, err := Register(ctx, srv.Client(), meta, "xiaozhi", "http://manager/callback")
+	if err != nil || client.ClientID != "dyn-client" {
+		t.Fatalf("register: %+v %v", client, err)
+	}
+
+	var challenge string
+	verifier, challenge, err = NewPKCE()
+	if err != nil {
+		t.Fatalf("pkce: %v", err)
+	}
+	authURL, err := AuthorizationURL(meta, client, "http://manager/callback", "st", challenge, "repo")
+	if err != nil {
+		t.Fatalf("authorization url: %v", err)
+	}
+	q, _ := url.Parse(authURL)
+	if q.Query().Get("code_challenge_method") != "S256" || q.Query().Get("resource") != srv.URL+"/mcp" || q.Query().Get("state") != "st" {
+		t.Fatalf("unexpected authorization url: %s", authURL)
+	}
+
+	token, err := ExchangeCode(ctx, srv.Client(), meta.TokenEndpoint, client, "the-code", verifier, "http://manager/callback", meta.Resource)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if token.AccessToken != "at-1" || token.RefreshToken != "rt-1" || time.Until(token.ExpiresAt) < 50*time.Minute {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	refreshed, err := Refresh(ctx, srv.Client(), meta.TokenEndpoint, client, "rt-1", meta.Resource)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if refreshed.AccessToken != "at-2" || refreshed.RefreshToken != "rt-1" {
+		t.Fatalf("refresh should keep old refresh token: %+v", refreshed)
+	}
+
+	_, err = Refresh(ctx, srv.Client(), meta.TokenEndpoint, client, "stale", meta.Resource)
+	if !IsInvalidGrant(err) || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+}
+
+func TestDiscoverFallsBackToDefaultEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	meta, err := Discover(context.Background(), srv.Client(), srv.URL+"/mcp/")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if meta.AuthorizationEndpoint != srv.URL+"/authorize" || meta.TokenEndpoint != srv.URL+"/token" || meta.RegistrationEndpoint != srv.URL+"/register" {
+		t.Fatalf("unexpected fallback metadata: %+v", meta)
+	}
+}
+
+func TestAuthParam(t *testing.T) {
+	header := `Bearer error="invalid_token", resource_metadata="https://example.com/.well-known/oauth-protected-resource"`
+	if got := authParam(header, "resource_metadata"); got != "https://example.com/.well-known/oauth-protected-resource" {
+		t.Fatalf("unexpected resource_metadata: %q", got)
+	}
+	if got := authParam("Basic realm=x", "resource_metadata"); got != "" {
+		t.Fatalf("expected empty, got %q", got)
+	}
+}
@@ -269,6 +269,18 @@ const routes = [
         component: () => import('../views/user/KnowledgeBases.vue'),
         meta: { title: '我的知识库' }
       },
+      {
+        path: '/user/reminders',
+        name: 'UserReminders',
+        component: () => import('../views/user/Reminders.vue'),
+        meta: { title: '定时提醒' }
+      },
+      {
+        path: '/user/webhooks',
+        name: 'UserWebhooks',
+        component: () => import('../views/user/Webhooks.vue'),
+        meta: { title: '事件回调' }
+      },
       {
         path: 'user/roles',
         name: 'UserRoles',
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"xiaozhi-esp32-server-golang/internal/domain/endpointing"
+)
+
+// 断句离线评估：对标注样本分别运行固定静音阈值与自适应断句，对比截断次数与断句延迟
+func main() {
+	casesPath := flag.String("cases", "cases.json", "标注文件")
+	speed := flag.String("speed", endpointing.SpeedNormal, "断句档位 normal/patient/fast")
+	classifier := flag.String("classifier", "rule", "语义分类器 rule/none")
+	fixedMs := flag.Int64("fixed", 400, "对比用的固定静音阈值（毫秒）")
+	flag.Parse()
+
+	cases, err := endpointing.LoadCases(*casesPath)
+	if err != nil {
+		fmt.Printf("读取标注文件失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fixed := endpointing.Profile{MinSilenceMs: *fixedMs, DefaultSilenceMs: *fixedMs, MaxSilenceMs: *fixedMs, StableMs: 1}
+	profile := endpointing.ResolveProfile(*speed, nil)
+	runs := []struct {
+		name        string
+		newDetector func() *endpointing.Detector
+	}{
+		{fmt.Sprintf("固定 %dms", *fixedMs), func() *endpointing.Detector {
+			return endpointing.NewDetector(fixed, endpointing.NoneClassifier{})
+		}},
+		{fmt.Sprintf("自适应 %s/%s", *speed, *classifier), func() *endpointing.Detector {
+			return endpointing.NewDetector(profile, endpointing.GetClassifier(*classifier))
+		}},
+	}
+	for _, run := range runs {
+		report, err := endpointing.Evaluate(cases, run.newDetector, endpointing.EvalOptions{})
+		if err != nil {
+			fmt.Printf("评估失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("== %s: 截断 %d, 未断句 %d, 平均延迟 %.0fms\n", run.name, report.Premature, report.Missed, report.MeanLatencyMs)
+		for _, r := range report.Results {
+			status := "ok"
+			if r.EndpointMs < 0 {
+				status = "未断句"
+			} else if r.Premature {
+				status = "截断"
+			}
+			fmt.Printf("  %-20s 说完 %5dms  断句 %5dms  延迟 %5dms  %s\n", r.Name, r.TurnEndMs, r.EndpointMs, r.LatencyMs, status)
+		}
+	}
+}